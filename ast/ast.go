@@ -400,9 +400,10 @@ type (
 
 	// A FuncType node represents a function type.
 	FuncType struct {
-		Func    token.Pos  // position of "func" keyword (token.NoPos if there is no "func")
-		Params  *FieldList // (incoming) parameters; non-nil
-		Results *FieldList // (outgoing) results; or nil
+		Func       token.Pos      // position of "func" keyword (token.NoPos if there is no "func")
+		TypeParams *TypeParamDecl // type parameters of an interface method; or nil
+		Params     *FieldList     // (incoming) parameters; non-nil
+		Results    *FieldList     // (outgoing) results; or nil
 	}
 
 	// An InterfaceType node represents an interface type.
@@ -426,15 +427,34 @@ type (
 		Dir   ChanDir   // channel direction
 		Value Expr      // value type
 	}
+
+	// An EnumType node represents an enum type. It may only occur as the
+	// type of a TypeSpec, which then declares a defined integer type along
+	// with a constant of that type for each value.
+	EnumType struct {
+		Enum   token.Pos // position of "enum"
+		Lbrace token.Pos // position of "{"
+		Values []*Ident  // list of value names
+		Rbrace token.Pos // position of "}"
+	}
 )
 
 type (
 	// TypeParamDecl is a list of type parameter names used in function or type
-	// declarations.
+	// declarations. A type parameter written on its own line may be preceded
+	// by a doc comment, as in
+	//
+	//	type Map[
+	//		// K is the key type.
+	//		K comparable,
+	//		V] struct { ... }
+	//
 	TypeParamDecl struct {
-		Lbrack token.Pos // position of "["
-		Names  []*Ident  // list of type parameter names
-		Rbrack token.Pos // position of "]"
+		Lbrack      token.Pos       // position of "["
+		Docs        []*CommentGroup // doc comment of each type parameter (nil entry if none); or nil
+		Names       []*Ident        // list of type parameter names
+		Constraints []Expr          // constraint of each type parameter (nil entry if none); or nil
+		Rbrack      token.Pos       // position of "]"
 	}
 )
 
@@ -487,6 +507,7 @@ func (x *FuncType) Pos() token.Pos {
 func (x *InterfaceType) Pos() token.Pos { return x.Interface }
 func (x *MapType) Pos() token.Pos       { return x.Map }
 func (x *ChanType) Pos() token.Pos      { return x.Begin }
+func (x *EnumType) Pos() token.Pos      { return x.Enum }
 
 func (x *BadExpr) End() token.Pos { return x.To }
 func (x *Ident) End() token.Pos   { return token.Pos(int(x.NamePos) + len(x.Name)) }
@@ -521,6 +542,7 @@ func (x *FuncType) End() token.Pos {
 func (x *InterfaceType) End() token.Pos { return x.Methods.End() }
 func (x *MapType) End() token.Pos       { return x.Value.End() }
 func (x *ChanType) End() token.Pos      { return x.Value.End() }
+func (x *EnumType) End() token.Pos      { return x.Rbrace + 1 }
 
 // exprNode() ensures that only expression/type nodes can be
 // assigned to an Expr.
@@ -549,6 +571,71 @@ func (*FuncType) exprNode()      {}
 func (*InterfaceType) exprNode() {}
 func (*MapType) exprNode()       {}
 func (*ChanType) exprNode()      {}
+func (*EnumType) exprNode()      {}
+
+// ----------------------------------------------------------------------------
+// Convenience functions for generic nodes
+
+// NewTypeArgExpr creates a new TypeArgExpr which applies the type arguments
+// types to x, as in x[types...]. If x and the last type argument have
+// positions, the brackets are placed right after them, as if there was no
+// white space; otherwise they have no position. Useful for ASTs generated by
+// code other than the Fo parser.
+//
+// NewTypeArgExpr panics if x is nil, if there are no type arguments or if
+// any of them is nil.
+//
+func NewTypeArgExpr(x Expr, types ...Expr) *TypeArgExpr {
+	if x == nil {
+		panic("ast.NewTypeArgExpr: nil expression")
+	}
+	if len(types) == 0 {
+		panic("ast.NewTypeArgExpr: no type arguments")
+	}
+	for _, typ := range types {
+		if typ == nil {
+			panic("ast.NewTypeArgExpr: nil type argument")
+		}
+	}
+	expr := &TypeArgExpr{X: x, Types: types}
+	if end := x.End(); x.Pos().IsValid() && end.IsValid() {
+		expr.Lbrack = end
+	}
+	if last := types[len(types)-1]; last.Pos().IsValid() {
+		expr.Rbrack = last.End()
+	}
+	return expr
+}
+
+// NewTypeParamDecl creates a new TypeParamDecl which declares the type
+// parameters names without constraints, as in [names...]. If the type
+// parameters have positions, the brackets are placed right before the first
+// and right after the last one; otherwise they have no position. Useful for
+// ASTs generated by code other than the Fo parser.
+//
+// NewTypeParamDecl panics if any of the names is nil or if a name is
+// declared twice, except for the blank identifier.
+//
+func NewTypeParamDecl(names ...*Ident) *TypeParamDecl {
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if name == nil {
+			panic("ast.NewTypeParamDecl: nil type parameter")
+		}
+		if seen[name.Name] {
+			panic("ast.NewTypeParamDecl: " + name.Name + " redeclared")
+		}
+		if name.Name != "_" {
+			seen[name.Name] = true
+		}
+	}
+	decl := &TypeParamDecl{Names: names}
+	if len(names) > 0 && names[0].Pos().IsValid() && names[len(names)-1].Pos().IsValid() {
+		decl.Lbrack = names[0].Pos() - 1
+		decl.Rbrack = names[len(names)-1].End()
+	}
+	return decl
+}
 
 // ----------------------------------------------------------------------------
 // Convenience functions for Idents
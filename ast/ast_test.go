@@ -49,3 +49,67 @@ func TestCommentText(t *testing.T) {
 		}
 	}
 }
+
+func TestNewTypeArgExpr(t *testing.T) {
+	// Box[int, string] at offset 10
+	x := &Ident{NamePos: 10, Name: "Box"}
+	args := []Expr{&Ident{NamePos: 14, Name: "int"}, &Ident{NamePos: 19, Name: "string"}}
+	expr := NewTypeArgExpr(x, args...)
+	if expr.Pos() != 13 || expr.Rbrack != 25 || expr.End() != 26 {
+		t.Errorf("got brackets at %d and %d, expected 13 and 25", expr.Lbrack, expr.Rbrack)
+	}
+
+	expr = NewTypeArgExpr(NewIdent("Box"), NewIdent("int"))
+	if expr.Lbrack.IsValid() || expr.Rbrack.IsValid() {
+		t.Errorf("got brackets at %d and %d, expected no positions", expr.Lbrack, expr.Rbrack)
+	}
+
+	for _, test := range []struct {
+		x     Expr
+		types []Expr
+		err   string
+	}{
+		{nil, []Expr{NewIdent("int")}, "ast.NewTypeArgExpr: nil expression"},
+		{NewIdent("Box"), nil, "ast.NewTypeArgExpr: no type arguments"},
+		{NewIdent("Box"), []Expr{NewIdent("int"), nil}, "ast.NewTypeArgExpr: nil type argument"},
+	} {
+		func() {
+			defer func() {
+				if err := recover(); err != test.err {
+					t.Errorf("expected panic %q, got %v", test.err, err)
+				}
+			}()
+			NewTypeArgExpr(test.x, test.types...)
+		}()
+	}
+}
+
+func TestNewTypeParamDecl(t *testing.T) {
+	// [K, V] at offset 10
+	decl := NewTypeParamDecl(&Ident{NamePos: 11, Name: "K"}, &Ident{NamePos: 14, Name: "V"})
+	if decl.Pos() != 10 || decl.Rbrack != 15 || decl.Constraints != nil {
+		t.Errorf("got brackets at %d and %d, expected 10 and 15", decl.Lbrack, decl.Rbrack)
+	}
+
+	decl = NewTypeParamDecl(NewIdent("T"), NewIdent("_"), NewIdent("_"))
+	if decl.Lbrack.IsValid() || decl.Rbrack.IsValid() || len(decl.Names) != 3 {
+		t.Errorf("got brackets at %d and %d, expected no positions", decl.Lbrack, decl.Rbrack)
+	}
+
+	for _, test := range []struct {
+		names []*Ident
+		err   string
+	}{
+		{[]*Ident{NewIdent("T"), nil}, "ast.NewTypeParamDecl: nil type parameter"},
+		{[]*Ident{NewIdent("T"), NewIdent("U"), NewIdent("T")}, "ast.NewTypeParamDecl: T redeclared"},
+	} {
+		func() {
+			defer func() {
+				if err := recover(); err != test.err {
+					t.Errorf("expected panic %q, got %v", test.err, err)
+				}
+			}()
+			NewTypeParamDecl(test.names...)
+		}()
+	}
+}
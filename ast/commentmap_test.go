@@ -143,4 +143,31 @@ func TestCommentMap(t *testing.T) {
 	}
 }
 
+func TestCommentMapTypeParams(t *testing.T) {
+	const src = `package p
+
+type Map[
+	// K is the key type.
+	K comparable,
+	// V is the value type.
+	V] struct{}
+`
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmap := NewCommentMap(fset, f, f.Comments)
+	tpDecl := f.Decls[0].(*GenDecl).Specs[0].(*TypeSpec).TypeParams
+	for i, want := range []string{"K is the key type.\n", "V is the value type.\n"} {
+		name := tpDecl.Names[i]
+		if got := ctext(cmap[name]); got != want {
+			t.Errorf("%s: got %q; want %q", name.Name, got, want)
+		}
+		if tpDecl.Docs[i] != cmap[name][0] {
+			t.Errorf("%s: comment map does not contain the doc comment", name.Name)
+		}
+	}
+}
+
 // TODO(gri): add tests for Filter.
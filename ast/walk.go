@@ -92,8 +92,16 @@ func Walk(v Visitor, node Node) {
 		// nothing to do
 
 	case *TypeParamDecl:
-		for _, f := range n.Names {
+		// visit each type parameter in source order, as NewCommentMap
+		// relies on it
+		for i, f := range n.Names {
+			if i < len(n.Docs) && n.Docs[i] != nil {
+				Walk(v, n.Docs[i])
+			}
 			Walk(v, f)
+			if i < len(n.Constraints) && n.Constraints[i] != nil {
+				Walk(v, n.Constraints[i])
+			}
 		}
 
 	case *Ellipsis:
@@ -122,6 +130,10 @@ func Walk(v Visitor, node Node) {
 		Walk(v, n.X)
 		Walk(v, n.Index)
 
+	case *TypeArgExpr:
+		Walk(v, n.X)
+		walkExprList(v, n.Types)
+
 	case *SliceExpr:
 		Walk(v, n.X)
 		if n.Low != nil {
@@ -169,6 +181,9 @@ func Walk(v Visitor, node Node) {
 		Walk(v, n.Fields)
 
 	case *FuncType:
+		if n.TypeParams != nil {
+			Walk(v, n.TypeParams)
+		}
 		if n.Params != nil {
 			Walk(v, n.Params)
 		}
@@ -186,6 +201,9 @@ func Walk(v Visitor, node Node) {
 	case *ChanType:
 		Walk(v, n.Value)
 
+	case *EnumType:
+		walkIdentList(v, n.Values)
+
 	// Statements
 	case *BadStmt:
 		// nothing to do
@@ -323,6 +341,9 @@ func Walk(v Visitor, node Node) {
 			Walk(v, n.Doc)
 		}
 		Walk(v, n.Name)
+		if n.TypeParams != nil {
+			Walk(v, n.TypeParams)
+		}
 		Walk(v, n.Type)
 		if n.Comment != nil {
 			Walk(v, n.Comment)
@@ -347,6 +368,9 @@ func Walk(v Visitor, node Node) {
 			Walk(v, n.Recv)
 		}
 		Walk(v, n.Name)
+		if n.TypeParams != nil {
+			Walk(v, n.TypeParams)
+		}
 		Walk(v, n.Type)
 		if n.Body != nil {
 			Walk(v, n.Body)
@@ -109,10 +109,19 @@ func Clone(node ast.Node) ast.Node {
 		}
 
 	case *ast.TypeParamDecl:
+		var docs []*ast.CommentGroup
+		if n.Docs != nil {
+			docs = make([]*ast.CommentGroup, len(n.Docs))
+			for i, doc := range n.Docs {
+				docs[i] = cloneCommentGroup(doc)
+			}
+		}
 		return &ast.TypeParamDecl{
-			Lbrack: n.Lbrack,
-			Names:  cloneIdentList(n.Names),
-			Rbrack: n.Rbrack,
+			Lbrack:      n.Lbrack,
+			Docs:        docs,
+			Names:       cloneIdentList(n.Names),
+			Constraints: cloneExprList(n.Constraints),
+			Rbrack:      n.Rbrack,
 		}
 
 	case *ast.TypeArgExpr:
@@ -183,10 +192,15 @@ func Clone(node ast.Node) ast.Node {
 		}
 
 	case *ast.FuncType:
+		var typeParams *ast.TypeParamDecl
+		if n.TypeParams != nil {
+			typeParams = Clone(n.TypeParams).(*ast.TypeParamDecl)
+		}
 		return &ast.FuncType{
-			Func:    n.Func,
-			Params:  cloneFieldList(n.Params),
-			Results: cloneFieldList(n.Results),
+			Func:       n.Func,
+			TypeParams: typeParams,
+			Params:     cloneFieldList(n.Params),
+			Results:    cloneFieldList(n.Results),
 		}
 
 	case *ast.InterfaceType:
@@ -211,6 +225,14 @@ func Clone(node ast.Node) ast.Node {
 			Value: cloneExpr(n.Value),
 		}
 
+	case *ast.EnumType:
+		return &ast.EnumType{
+			Enum:   n.Enum,
+			Lbrace: n.Lbrace,
+			Values: cloneIdentList(n.Values),
+			Rbrace: n.Rbrace,
+		}
+
 	case *ast.BadStmt:
 		if n == nil {
 			return nil
@@ -549,7 +571,9 @@ func cloneFieldList(n *ast.FieldList) *ast.FieldList {
 		}
 	}
 	return &ast.FieldList{
-		List: list,
+		Opening: n.Opening,
+		List:    list,
+		Closing: n.Closing,
 	}
 }
 
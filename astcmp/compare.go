@@ -160,9 +160,20 @@ func Equal(x, y ast.Node, mode Mode) bool {
 				return false
 			}
 		}
+		if len(x.Docs) != len(y.Docs) {
+			return false
+		}
+		for i := range x.Docs {
+			if !Equal(x.Docs[i], y.Docs[i], mode) {
+				return false
+			}
+		}
 		if !compareIdents(x.Names, y.Names, mode) {
 			return false
 		}
+		if !compareExprs(x.Constraints, y.Constraints, mode) {
+			return false
+		}
 
 	case *ast.TypeArgExpr:
 		y := y.(*ast.TypeArgExpr)
@@ -404,6 +415,9 @@ func Equal(x, y ast.Node, mode Mode) bool {
 				return false
 			}
 		}
+		if !Equal(x.TypeParams, y.TypeParams, mode) {
+			return false
+		}
 		if !Equal(x.Params, y.Params, mode) {
 			return false
 		}
@@ -455,6 +469,21 @@ func Equal(x, y ast.Node, mode Mode) bool {
 			return false
 		}
 
+	case *ast.EnumType:
+		y := y.(*ast.EnumType)
+		if mode&IgnorePos == 0 {
+			if x.Enum != y.Enum {
+				return false
+			} else if x.Lbrace != y.Lbrace {
+				return false
+			} else if x.Rbrace != y.Rbrace {
+				return false
+			}
+		}
+		if !compareIdents(x.Values, y.Values, mode) {
+			return false
+		}
+
 	case *ast.BadStmt:
 		y := y.(*ast.BadStmt)
 		if mode&IgnorePos == 0 {
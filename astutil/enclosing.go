@@ -288,6 +288,12 @@ func childrenOf(n ast.Node) []ast.Node {
 	case *ast.EmptyStmt:
 		// nop
 
+	case *ast.EnumType:
+		children = append(children,
+			tok(n.Enum, len("enum")),
+			tok(n.Lbrace, len("{")),
+			tok(n.Rbrace, len("}")))
+
 	case *ast.ExprStmt:
 		// nop
 
@@ -535,6 +541,8 @@ func NodeDescription(n ast.Node) string {
 		return "ellipsis"
 	case *ast.EmptyStmt:
 		return "empty statement"
+	case *ast.EnumType:
+		return "enum type"
 	case *ast.ExprStmt:
 		return "expression statement"
 	case *ast.Field:
@@ -39,7 +39,9 @@ type ApplyFunc func(*Cursor) bool
 // (strings, etc.) are ignored.
 //
 // Children are traversed in the order in which they appear in the
-// respective node's struct definition. A package's files are
+// respective node's struct definition, except for the type parameters
+// of a TypeParamDecl, which are traversed one after another: the doc
+// comment, name and constraint of each. A package's files are
 // traversed in the filenames' alphabetical order.
 //
 func Apply(root ast.Node, pre, post ApplyFunc) (result ast.Node) {
@@ -70,6 +72,11 @@ var abort = new(int) // singleton, to signal termination of Apply
 //
 // The methods Replace, Delete, InsertBefore, and InsertAfter
 // can be used to change the AST without disrupting Apply.
+//
+// The Docs and Constraints of a TypeParamDecl are kept parallel to
+// its Names: inserting or deleting a name inserts or deletes the
+// doc comment and constraint at the same index, and deleting a doc
+// comment or constraint sets it to nil.
 type Cursor struct {
 	parent ast.Node
 	name   string
@@ -137,11 +144,16 @@ func (c *Cursor) Delete() {
 	if i < 0 {
 		panic("Delete node not contained in slice")
 	}
-	v := c.field()
-	l := v.Len()
-	reflect.Copy(v.Slice(i, l), v.Slice(i+1, l))
-	v.Index(l - 1).Set(reflect.Zero(v.Type().Elem()))
-	v.SetLen(l - 1)
+	if c.typeParamEntry() {
+		c.field().Index(i).Set(reflect.Zero(c.field().Type().Elem()))
+		return
+	}
+	for _, v := range c.fields() {
+		l := v.Len()
+		reflect.Copy(v.Slice(i, l), v.Slice(i+1, l))
+		v.Index(l - 1).Set(reflect.Zero(v.Type().Elem()))
+		v.SetLen(l - 1)
+	}
 	c.iter.step--
 }
 
@@ -153,11 +165,19 @@ func (c *Cursor) InsertAfter(n ast.Node) {
 	if i < 0 {
 		panic("InsertAfter node not contained in slice")
 	}
-	v := c.field()
-	v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
-	l := v.Len()
-	reflect.Copy(v.Slice(i+2, l), v.Slice(i+1, l))
-	v.Index(i + 1).Set(reflect.ValueOf(n))
+	if c.typeParamEntry() {
+		panic("InsertAfter node is not a type parameter name")
+	}
+	for j, v := range c.fields() {
+		v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+		l := v.Len()
+		reflect.Copy(v.Slice(i+2, l), v.Slice(i+1, l))
+		if j == 0 {
+			v.Index(i + 1).Set(reflect.ValueOf(n))
+		} else {
+			v.Index(i + 1).Set(reflect.Zero(v.Type().Elem()))
+		}
+	}
 	c.iter.step++
 }
 
@@ -169,14 +189,43 @@ func (c *Cursor) InsertBefore(n ast.Node) {
 	if i < 0 {
 		panic("InsertBefore node not contained in slice")
 	}
-	v := c.field()
-	v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
-	l := v.Len()
-	reflect.Copy(v.Slice(i+1, l), v.Slice(i, l))
-	v.Index(i).Set(reflect.ValueOf(n))
+	if c.typeParamEntry() {
+		panic("InsertBefore node is not a type parameter name")
+	}
+	for j, v := range c.fields() {
+		v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+		l := v.Len()
+		reflect.Copy(v.Slice(i+1, l), v.Slice(i, l))
+		if j == 0 {
+			v.Index(i).Set(reflect.ValueOf(n))
+		} else {
+			v.Index(i).Set(reflect.Zero(v.Type().Elem()))
+		}
+	}
 	c.iter.index++
 }
 
+// typeParamEntry reports whether the current Node is the doc comment or
+// constraint of a type parameter, which are optional.
+func (c *Cursor) typeParamEntry() bool {
+	_, ok := c.parent.(*ast.TypeParamDecl)
+	return ok && c.name != "Names"
+}
+
+// fields returns the current node's parent field value, followed by the
+// fields which are parallel to it and have to change along with it.
+func (c *Cursor) fields() []reflect.Value {
+	fields := []reflect.Value{c.field()}
+	if _, ok := c.parent.(*ast.TypeParamDecl); ok {
+		for _, name := range []string{"Docs", "Constraints"} {
+			if v := reflect.Indirect(reflect.ValueOf(c.parent)).FieldByName(name); !v.IsNil() {
+				fields = append(fields, v)
+			}
+		}
+	}
+	return fields
+}
+
 // application carries all the shared data so we can pass it around cheaply.
 type application struct {
 	pre, post ApplyFunc
@@ -260,7 +309,7 @@ func (a *application) apply(parent ast.Node, name string, iter *iterator, n ast.
 		a.apply(n, "Max", nil, n.Max)
 
 	case *ast.TypeParamDecl:
-		a.applyList(n, "Names")
+		a.applyTypeParams(n)
 
 	case *ast.TypeArgExpr:
 		a.apply(n, "X", nil, n.X)
@@ -297,6 +346,7 @@ func (a *application) apply(parent ast.Node, name string, iter *iterator, n ast.
 		a.apply(n, "Fields", nil, n.Fields)
 
 	case *ast.FuncType:
+		a.apply(n, "TypeParams", nil, n.TypeParams)
 		a.apply(n, "Params", nil, n.Params)
 		a.apply(n, "Results", nil, n.Results)
 
@@ -310,6 +360,9 @@ func (a *application) apply(parent ast.Node, name string, iter *iterator, n ast.
 	case *ast.ChanType:
 		a.apply(n, "Value", nil, n.Value)
 
+	case *ast.EnumType:
+		a.applyList(n, "Values")
+
 	// Statements
 	case *ast.BadStmt:
 		// nothing to do
@@ -409,6 +462,7 @@ func (a *application) apply(parent ast.Node, name string, iter *iterator, n ast.
 	case *ast.TypeSpec:
 		a.apply(n, "Doc", nil, n.Doc)
 		a.apply(n, "Name", nil, n.Name)
+		a.apply(n, "TypeParams", nil, n.TypeParams)
 		a.apply(n, "Type", nil, n.Type)
 		a.apply(n, "Comment", nil, n.Comment)
 
@@ -423,6 +477,7 @@ func (a *application) apply(parent ast.Node, name string, iter *iterator, n ast.
 		a.apply(n, "Doc", nil, n.Doc)
 		a.apply(n, "Recv", nil, n.Recv)
 		a.apply(n, "Name", nil, n.Name)
+		a.apply(n, "TypeParams", nil, n.TypeParams)
 		a.apply(n, "Type", nil, n.Type)
 		a.apply(n, "Body", nil, n.Body)
 
@@ -456,6 +511,26 @@ func (a *application) apply(parent ast.Node, name string, iter *iterator, n ast.
 	a.cursor = saved
 }
 
+// applyTypeParams traverses the type parameters of n in source order. Unless
+// the name of a type parameter is deleted, its doc comment and constraint are
+// traversed along with it.
+func (a *application) applyTypeParams(n *ast.TypeParamDecl) {
+	saved := a.iter
+	a.iter.index = 0
+	for a.iter.index < len(n.Names) {
+		a.iter.step = 1
+		if a.iter.index < len(n.Docs) {
+			a.apply(n, "Docs", &a.iter, n.Docs[a.iter.index])
+		}
+		a.apply(n, "Names", &a.iter, n.Names[a.iter.index])
+		if a.iter.step > 0 && a.iter.index < len(n.Constraints) {
+			a.apply(n, "Constraints", &a.iter, n.Constraints[a.iter.index])
+		}
+		a.iter.index += a.iter.step
+	}
+	a.iter = saved
+}
+
 // An iterator controls iteration over a slice of nodes.
 type iterator struct {
 	index, step int
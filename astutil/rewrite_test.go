@@ -189,6 +189,76 @@ var z int
 			return true
 		},
 	},
+
+	{name: "insert type parameters",
+		orig: `package p
+
+type M[
+	// K is the key type.
+	K comparable,
+	V] map[K]V
+`,
+		want: `package p
+
+type M[J,
+	// K is the key type.
+	K comparable, L,
+	V] map[K]V
+`,
+		pre: func(c *astutil.Cursor) bool {
+			if id, ok := c.Node().(*ast.Ident); ok && id.Name == "K" && c.Name() == "Names" {
+				c.InsertBefore(ast.NewIdent("J"))
+				c.InsertAfter(ast.NewIdent("L"))
+			}
+			return true
+		},
+	},
+
+	{name: "delete type parameters",
+		orig: `package p
+
+func f[K comparable, V, W fmt.Stringer](m map[K]V, w W) {}
+`,
+		want: `package p
+
+func f[K, W fmt.Stringer](m map[K]V, w W) {}
+`,
+		pre: func(c *astutil.Cursor) bool {
+			if _, ok := c.Parent().(*ast.TypeParamDecl); !ok {
+				return true
+			}
+			switch n := c.Node().(type) {
+			case *ast.Ident:
+				if n.Name == "V" || n.Name == "comparable" {
+					c.Delete()
+				}
+			}
+			return true
+		},
+	},
+
+	{name: "edit type arguments",
+		orig: `package p
+
+var m M[int, string, bool]
+`,
+		want: `package p
+
+var m M[int64, rune, string]
+`,
+		pre: func(c *astutil.Cursor) bool {
+			if id, ok := c.Node().(*ast.Ident); ok && c.Name() == "Types" {
+				switch id.Name {
+				case "int":
+					c.Replace(ast.NewIdent("int64"))
+					c.InsertAfter(ast.NewIdent("rune"))
+				case "bool":
+					c.Delete()
+				}
+			}
+			return true
+		},
+	},
 }
 
 func valspec(name, typ string) *ast.ValueSpec {
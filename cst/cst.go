@@ -0,0 +1,197 @@
+// Package cst provides a lossless view of Fo source files for formatters and
+// refactoring tools which make byte-accurate edits.
+//
+// An ast.File only records what is needed to type-check and print a file:
+// the white space between tokens, the exact placement of comments and the
+// position of most punctuation are lost, so printing a changed AST reformats
+// the whole file. A File keeps the AST together with every token of the
+// source and the trivia (white space) before it, which lets tools find the
+// exact source text of each node and rewrite single nodes while leaving the
+// rest of the file byte for byte as it was. Parentheses are tokens like any
+// other, so they are kept even where the AST does not record them.
+package cst
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"github.com/qProust/fo/ast"
+	"github.com/qProust/fo/parser"
+	"github.com/qProust/fo/scanner"
+	"github.com/qProust/fo/token"
+)
+
+// A Token is a token of a source file along with the trivia before it.
+// Comments are tokens of their own; semicolons which were inserted
+// automatically at the end of a line are not tokens, since they have no
+// source text.
+type Token struct {
+	Tok     token.Token // token.COMMENT for comments
+	Pos     token.Pos   // position of the token
+	Text    string      // source text of the token
+	Leading string      // white space before the token (and a byte order mark at the start of the file)
+}
+
+// End returns the position of the first character after the token.
+func (t Token) End() token.Pos {
+	return t.Pos + token.Pos(len(t.Text))
+}
+
+// A File is a parsed source file which keeps all of its source text. The
+// source of the file is the concatenation of the leading trivia and the text
+// of each token, followed by the trailing trivia; Bytes returns it.
+type File struct {
+	AST      *ast.File
+	Tokens   []Token
+	Trailing string // white space after the last token
+
+	file *token.File
+	src  []byte
+}
+
+// ParseFile parses the source code of a single Fo source file like
+// parser.ParseFile and returns it as a File. Comments are always parsed. If
+// the source has syntax errors, the result holds the partial AST returned by
+// the parser along with the errors, so that tools can still work on it.
+func ParseFile(fset *token.FileSet, filename string, src []byte, mode parser.Mode) (*File, error) {
+	f, err := parser.ParseFile(fset, filename, src, mode|parser.ParseComments)
+	if f == nil {
+		return nil, err
+	}
+	file := fset.File(f.Package)
+	if file == nil || file.Size() != len(src) {
+		// the parser failed before the package clause
+		return nil, err
+	}
+	cst := &File{AST: f, file: file, src: src}
+	cst.scan()
+	return cst, err
+}
+
+// scan splits the source of f into tokens. It scans the file again, which is
+// cheap compared to parsing, instead of making the parser record each token.
+func (f *File) scan() {
+	var s scanner.Scanner
+	tmp := token.NewFileSet().AddFile(f.file.Name(), -1, len(f.src))
+	s.Init(tmp, f.src, nil, scanner.ScanComments)
+	type span struct {
+		tok        token.Token
+		start, end int
+	}
+	var spans []span
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.SEMICOLON && lit == "\n" {
+			continue
+		}
+		start := tmp.Offset(pos)
+		spans = append(spans, span{tok, start, f.tokenEnd(start, tok, lit)})
+	}
+
+	f.Tokens = make([]Token, len(spans))
+	last := 0
+	for i, sp := range spans {
+		// The scanner strips carriage returns from the literals of comments
+		// and raw strings. Should the end of a token still be off, the token
+		// is cut short rather than overlapping the next one, so the source
+		// can always be reassembled.
+		if i+1 < len(spans) && sp.end > spans[i+1].start {
+			sp.end = spans[i+1].start
+		}
+		f.Tokens[i] = Token{
+			Tok:     sp.tok,
+			Pos:     f.file.Pos(sp.start),
+			Text:    string(f.src[sp.start:sp.end]),
+			Leading: string(f.src[last:sp.start]),
+		}
+		last = sp.end
+	}
+	f.Trailing = string(f.src[last:])
+}
+
+// tokenEnd returns the offset of the end of the token tok with the literal
+// lit which starts at offset start.
+func (f *File) tokenEnd(start int, tok token.Token, lit string) int {
+	src := f.src[start:]
+	end := len(lit)
+	switch {
+	case tok == token.COMMENT && bytes.HasPrefix(src, []byte("//")):
+		if end = bytes.IndexByte(src, '\n'); end > 0 && src[end-1] == '\r' {
+			end--
+		}
+	case tok == token.COMMENT:
+		if end = bytes.Index(src[2:], []byte("*/")); end >= 0 {
+			end += 4
+		}
+	case tok == token.STRING && src[0] == '`':
+		if end = bytes.IndexByte(src[1:], '`'); end >= 0 {
+			end += 2
+		}
+	case lit == "":
+		end = len(tok.String())
+	}
+	if end < 0 || end > len(src) {
+		end = len(src)
+	}
+	return start + end
+}
+
+// Bytes returns the source of f.
+func (f *File) Bytes() []byte {
+	var buf bytes.Buffer
+	for _, t := range f.Tokens {
+		buf.WriteString(t.Leading)
+		buf.WriteString(t.Text)
+	}
+	buf.WriteString(f.Trailing)
+	return buf.Bytes()
+}
+
+// Offset returns the offset of pos in the source of f.
+func (f *File) Offset(pos token.Pos) int {
+	return f.file.Offset(pos)
+}
+
+// Span returns the indices of the first token of n and of the token after its
+// last one in f.Tokens. The tokens in between include the comments inside n.
+func (f *File) Span(n ast.Node) (first, end int) {
+	first = f.tokenAt(f.Offset(n.Pos()))
+	end = f.tokenAt(f.Offset(n.End()))
+	return first, end
+}
+
+// tokenAt returns the index of the first token which starts at or after
+// offset.
+func (f *File) tokenAt(offset int) int {
+	return sort.Search(len(f.Tokens), func(i int) bool {
+		return f.Offset(f.Tokens[i].Pos) >= offset
+	})
+}
+
+// Text returns the exact source text of n.
+func (f *File) Text(n ast.Node) string {
+	return string(f.src[f.Offset(n.Pos()):f.Offset(n.End())])
+}
+
+// Leading returns the white space and comments in front of n, starting after
+// the token before it, or after the comments on the line of that token, e.g.
+// the indentation of a statement and the comments on the lines above it.
+func (f *File) Leading(n ast.Node) string {
+	start, _ := f.Span(n)
+	for start > 0 && f.Tokens[start-1].Tok == token.COMMENT {
+		if start > 1 && !strings.Contains(f.Tokens[start-1].Leading, "\n") {
+			// a line comment of the token before
+			break
+		}
+		start--
+	}
+	from := 0
+	if start > 0 {
+		from = f.Offset(f.Tokens[start-1].End())
+	}
+	return string(f.src[from:f.Offset(n.Pos())])
+}
@@ -0,0 +1,156 @@
+package cst
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/qProust/fo/ast"
+	"github.com/qProust/fo/token"
+)
+
+const src = `package p
+
+import "fmt" // fmt
+
+// Box holds a value.
+type Box[T] struct {
+	v T // the value
+}
+
+func (b Box[T]) Map[U](f func(T) U) Box[U] {
+	return Box[U]{v: f(b.v)}
+}
+
+func main() {
+	x := ((1 + 2)) * 3 /* inline */
+	fmt.Println(Box[int]{v: x}.Map[string](func(i int) string {
+		return fmt.Sprint(i)
+	}))
+}
+`
+
+func parse(t *testing.T, src string) *File {
+	t.Helper()
+	f, err := ParseFile(token.NewFileSet(), "test.fo", []byte(src), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestLossless(t *testing.T) {
+	sources := map[string]string{
+		"src":  src,
+		"crlf": strings.Replace(src, "\n", "\r\n", -1) + "var s = `raw\r\nstring`\r\n",
+		"bom":  "\uFEFFpackage p\n\n\t// trailing space  \n\n",
+	}
+	files, err := filepath.Glob(filepath.Join("..", "printer", "testdata", "*.input"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, filename := range files {
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sources[filename] = string(data)
+	}
+	for name, src := range sources {
+		f, err := ParseFile(token.NewFileSet(), name, []byte(src), 0)
+		if f == nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if got := f.Bytes(); !bytes.Equal(got, []byte(src)) {
+			t.Errorf("%s: source is not preserved:\n%s", name, got)
+		}
+		for _, tok := range f.Tokens {
+			if strings.TrimLeft(tok.Leading, " \t\r\n\uFEFF") != "" {
+				t.Errorf("%s: leading trivia %q of %s contains tokens", name, tok.Leading, tok.Text)
+			}
+		}
+	}
+}
+
+func TestText(t *testing.T) {
+	f := parse(t, src)
+	var assign *ast.AssignStmt
+	ast.Inspect(f.AST, func(n ast.Node) bool {
+		if a, ok := n.(*ast.AssignStmt); ok {
+			assign = a
+		}
+		return true
+	})
+	if got, want := f.Text(assign.Rhs[0]), "((1 + 2)) * 3"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	first, end := f.Span(assign)
+	var texts []string
+	for _, tok := range f.Tokens[first:end] {
+		texts = append(texts, tok.Text)
+	}
+	if got, want := strings.Join(texts, " "), "x := ( ( 1 + 2 ) ) * 3"; got != want {
+		t.Errorf("got tokens %q, want %q", got, want)
+	}
+	if got, want := f.Tokens[end].Text, "/* inline */"; got != want {
+		t.Errorf("got token %q after the statement, want %q", got, want)
+	}
+
+	decl := f.AST.Decls[1]
+	if got, want := f.Leading(decl), "\n\n// Box holds a value.\n"; got != want {
+		t.Errorf("got leading text %q, want %q", got, want)
+	}
+}
+
+func TestEditor(t *testing.T) {
+	f := parse(t, src)
+	e := NewEditor(f)
+	var field *ast.Field
+	ast.Inspect(f.AST.Decls[1], func(n ast.Node) bool {
+		if n, ok := n.(*ast.Field); ok {
+			field = n
+		}
+		return field == nil
+	})
+	e.Replace(field.Names[0], "value")
+	e.InsertBefore(field.Type, "*")
+	fn := f.AST.Decls[2].(*ast.FuncDecl)
+	e.Replace(fn.Name, "Apply")
+	e.InsertAfter(fn.Type.Results, " /* mapped */")
+	e.Delete(f.AST.Decls[3].(*ast.FuncDecl).Body.List[0])
+
+	got, err := e.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `package p
+
+import "fmt" // fmt
+
+// Box holds a value.
+type Box[T] struct {
+	value *T // the value
+}
+
+func (b Box[T]) Apply[U](f func(T) U) Box[U] /* mapped */ {
+	return Box[U]{v: f(b.v)}
+}
+
+func main() {
+	fmt.Println(Box[int]{v: x}.Map[string](func(i int) string {
+		return fmt.Sprint(i)
+	}))
+}
+`
+	if string(got) != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	e.Replace(fn, "")
+	if _, err := e.Bytes(); err == nil || !strings.Contains(err.Error(), "overlapping edits") {
+		t.Errorf("expected an error about overlapping edits, got %v", err)
+	}
+}
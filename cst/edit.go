@@ -0,0 +1,131 @@
+package cst
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/qProust/fo/ast"
+	"github.com/qProust/fo/token"
+)
+
+// An Editor collects changes to the nodes of a File and applies them to its
+// source, which is left unchanged outside of the edited nodes.
+type Editor struct {
+	f     *File
+	edits []edit
+}
+
+// An edit replaces the source between the offsets start and end with text.
+type edit struct {
+	start, end int
+	text       string
+}
+
+// NewEditor returns an Editor for f.
+func NewEditor(f *File) *Editor {
+	return &Editor{f: f}
+}
+
+// Replace replaces the source text of n with text.
+func (e *Editor) Replace(n ast.Node, text string) {
+	e.add(e.f.Offset(n.Pos()), e.f.Offset(n.End()), text)
+}
+
+// InsertBefore inserts text right before n.
+func (e *Editor) InsertBefore(n ast.Node, text string) {
+	start := e.f.Offset(n.Pos())
+	e.add(start, start, text)
+}
+
+// InsertAfter inserts text right after n.
+func (e *Editor) InsertAfter(n ast.Node, text string) {
+	end := e.f.Offset(n.End())
+	e.add(end, end, text)
+}
+
+// Delete removes n along with its doc comment and the comments after it on
+// the same line, if there are any. If nothing else is left on the lines of n,
+// the lines are removed as well.
+func (e *Editor) Delete(n ast.Node) {
+	f := e.f
+	start, end := f.Offset(n.Pos()), f.Offset(n.End())
+	if doc := docComment(n); doc != nil {
+		start = f.Offset(doc.Pos())
+	}
+	for i := f.tokenAt(end); i < len(f.Tokens); i++ {
+		tok := f.Tokens[i]
+		if tok.Tok != token.COMMENT || strings.Contains(tok.Leading, "\n") {
+			break
+		}
+		end = f.Offset(tok.End())
+	}
+	src := f.src
+	lineStart := bytes.LastIndexByte(src[:start], '\n') + 1
+	lineEnd := bytes.IndexByte(src[end:], '\n')
+	if lineEnd < 0 {
+		lineEnd = len(src)
+	} else {
+		lineEnd += end + 1
+	}
+	if isBlank(src[lineStart:start]) && isBlank(src[end:lineEnd]) {
+		start, end = lineStart, lineEnd
+	}
+	e.add(start, end, "")
+}
+
+func (e *Editor) add(start, end int, text string) {
+	e.edits = append(e.edits, edit{start, end, text})
+}
+
+// Bytes returns the source of the file with all edits applied. Insertions at
+// the same position are applied in the order in which they were made, before
+// a change of the text which starts there. Bytes reports an error if any
+// other edits overlap.
+func (e *Editor) Bytes() ([]byte, error) {
+	edits := append([]edit(nil), e.edits...)
+	sort.SliceStable(edits, func(i, j int) bool {
+		if edits[i].start != edits[j].start {
+			return edits[i].start < edits[j].start
+		}
+		return edits[i].start == edits[i].end && edits[j].start != edits[j].end
+	})
+	src := e.f.src
+	var buf bytes.Buffer
+	last := 0
+	for _, ed := range edits {
+		if ed.start < last {
+			pos := e.f.file.Position(e.f.file.Pos(ed.start))
+			return nil, fmt.Errorf("%s: overlapping edits", pos)
+		}
+		buf.Write(src[last:ed.start])
+		buf.WriteString(ed.text)
+		last = ed.end
+	}
+	buf.Write(src[last:])
+	return buf.Bytes(), nil
+}
+
+// docComment returns the doc comment of n, or nil.
+func docComment(n ast.Node) *ast.CommentGroup {
+	switch n := n.(type) {
+	case *ast.Field:
+		return n.Doc
+	case *ast.ImportSpec:
+		return n.Doc
+	case *ast.ValueSpec:
+		return n.Doc
+	case *ast.TypeSpec:
+		return n.Doc
+	case *ast.GenDecl:
+		return n.Doc
+	case *ast.FuncDecl:
+		return n.Doc
+	}
+	return nil
+}
+
+func isBlank(b []byte) bool {
+	return len(bytes.TrimLeft(b, " \t\r\n")) == 0
+}
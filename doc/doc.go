@@ -0,0 +1,316 @@
+// Package doc extracts the documentation of Fo packages and renders it as
+// HTML, either served over HTTP or written to a directory.
+//
+// Declarations are printed in Fo syntax, so that generic types and functions
+// show their type parameters, and the documentation of each generic
+// declaration lists its instantiations, linked to the places in the source
+// where they are required.
+package doc
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"github.com/qProust/fo/ast"
+	"github.com/qProust/fo/format"
+	"github.com/qProust/fo/query"
+	"github.com/qProust/fo/token"
+	"github.com/qProust/fo/types"
+)
+
+// A Package is the documentation of the exported declarations of a package.
+type Package struct {
+	ImportPath string
+	Name       string
+	Doc        string // package comment
+	Consts     []*Value
+	Vars       []*Value
+	Types      []*Type
+	Funcs      []*Func
+	Files      []string // names of the source files, sorted
+}
+
+// A Value is the documentation of a const or var declaration, which may
+// declare several names.
+type Value struct {
+	Names []string // exported names declared
+	Doc   string
+	Decl  string // declaration in Fo syntax
+	Pos   token.Position
+}
+
+// A Type is the documentation of a type declaration and its methods.
+type Type struct {
+	Name      string
+	Doc       string
+	Decl      string // declaration in Fo syntax
+	Pos       token.Position
+	Methods   []*Func     // exported methods, sorted by name
+	Instances []*Instance // instantiations of a generic type, sorted by name
+}
+
+// A Func is the documentation of a function or method.
+type Func struct {
+	Name      string
+	Recv      string // name of the receiver type of a method; empty for functions
+	Doc       string
+	Decl      string // signature in Fo syntax
+	Pos       token.Position
+	Instances []*Instance // instantiations of a generic function or method, sorted by name
+}
+
+// An Instance is an instantiation of a generic declaration.
+type Instance struct {
+	Name       string         // in Fo syntax, e.g. Box[int] or Box[int].Map[string]
+	Pos        token.Position // where the instantiation is first required; invalid if unknown
+	ImportPath string         // import path of the package which requires it
+}
+
+// New returns the documentation of pkg, a package of prog. The instances of
+// generic declarations include those required by all packages of prog.
+func New(prog *query.Program, pkg *query.Package) *Package {
+	d := &Package{
+		ImportPath: pkg.ImportPath,
+		Name:       pkg.Name,
+	}
+	x := &extractor{fset: prog.Fset}
+	if pkg.Types != nil {
+		x.generics = pkg.Types.Generics()
+		x.qf = types.FoNames(func(other *types.Package) string {
+			if other == pkg.Types {
+				return ""
+			}
+			return other.Name()
+		})
+	}
+	byName := map[string]*Type{}
+	var methods []*Func
+	for _, f := range pkg.Files {
+		d.Files = append(d.Files, prog.Fset.File(f.Pos()).Name())
+		if f.Doc != nil && d.Doc == "" {
+			d.Doc = f.Doc.Text()
+		}
+		for _, decl := range f.Decls {
+			switch decl := decl.(type) {
+			case *ast.GenDecl:
+				switch decl.Tok {
+				case token.CONST:
+					d.Consts = append(d.Consts, x.values(decl)...)
+				case token.VAR:
+					d.Vars = append(d.Vars, x.values(decl)...)
+				case token.TYPE:
+					for _, spec := range decl.Specs {
+						if typ := x.typ(decl, spec.(*ast.TypeSpec)); typ != nil {
+							byName[typ.Name] = typ
+							d.Types = append(d.Types, typ)
+						}
+					}
+				}
+			case *ast.FuncDecl:
+				if fn := x.fn(decl); fn == nil {
+					continue
+				} else if fn.Recv != "" {
+					methods = append(methods, fn)
+				} else {
+					d.Funcs = append(d.Funcs, fn)
+				}
+			}
+		}
+	}
+	for _, method := range methods {
+		if typ := byName[method.Recv]; typ != nil {
+			typ.Methods = append(typ.Methods, method)
+		}
+	}
+	sort.Strings(d.Files)
+	sort.Slice(d.Types, func(i, j int) bool { return d.Types[i].Name < d.Types[j].Name })
+	sort.Slice(d.Funcs, func(i, j int) bool { return d.Funcs[i].Name < d.Funcs[j].Name })
+	for _, typ := range d.Types {
+		sort.Slice(typ.Methods, func(i, j int) bool { return typ.Methods[i].Name < typ.Methods[j].Name })
+	}
+	return d
+}
+
+type extractor struct {
+	fset     *token.FileSet
+	generics map[string]*types.GenericDecl
+	qf       types.Qualifier
+}
+
+// values returns the documentation of the specs of decl which declare an
+// exported name. The specs of a group with a doc comment are documented
+// together, as are those of a group without any comments.
+func (x *extractor) values(decl *ast.GenDecl) []*Value {
+	grouped := decl.Lparen.IsValid()
+	if grouped && decl.Doc == nil {
+		for _, spec := range decl.Specs {
+			if spec.(*ast.ValueSpec).Doc != nil {
+				grouped = false
+			}
+		}
+	}
+	if grouped {
+		val := &Value{Doc: decl.Doc.Text(), Pos: x.fset.Position(decl.Pos())}
+		for _, spec := range decl.Specs {
+			val.Names = append(val.Names, exportedNames(spec.(*ast.ValueSpec))...)
+		}
+		if len(val.Names) == 0 {
+			return nil
+		}
+		val.Decl = x.print(&ast.GenDecl{Tok: decl.Tok, Lparen: decl.Lparen, Specs: decl.Specs, Rparen: decl.Rparen})
+		return []*Value{val}
+	}
+	var values []*Value
+	for _, spec := range decl.Specs {
+		spec := spec.(*ast.ValueSpec)
+		names := exportedNames(spec)
+		if len(names) == 0 {
+			continue
+		}
+		doc := spec.Doc
+		if doc == nil {
+			doc = decl.Doc
+		}
+		values = append(values, &Value{
+			Names: names,
+			Doc:   doc.Text(),
+			Decl:  x.print(&ast.GenDecl{Tok: decl.Tok, Specs: []ast.Spec{spec}}),
+			Pos:   x.fset.Position(spec.Pos()),
+		})
+	}
+	return values
+}
+
+func exportedNames(spec *ast.ValueSpec) []string {
+	var names []string
+	for _, name := range spec.Names {
+		if name.IsExported() {
+			names = append(names, name.Name)
+		}
+	}
+	return names
+}
+
+func (x *extractor) typ(decl *ast.GenDecl, spec *ast.TypeSpec) *Type {
+	if !spec.Name.IsExported() {
+		return nil
+	}
+	doc := spec.Doc
+	if doc == nil && !decl.Lparen.IsValid() {
+		doc = decl.Doc
+	}
+	if array, ok := spec.Type.(*ast.ArrayType); ok && spec.TypeParams == nil && x.generics[spec.Name.Name] != nil {
+		// The parser cannot tell a single type parameter apart from the
+		// length of an array type, as in type Box [T]struct{...}.
+		if param, ok := array.Len.(*ast.Ident); ok {
+			spec = &ast.TypeSpec{
+				Name:       spec.Name,
+				TypeParams: &ast.TypeParamDecl{Lbrack: array.Lbrack, Names: []*ast.Ident{param}, Rbrack: param.End()},
+				Type:       array.Elt,
+			}
+		}
+	}
+	return &Type{
+		Name:      spec.Name.Name,
+		Doc:       doc.Text(),
+		Decl:      x.print(&ast.GenDecl{Tok: token.TYPE, Specs: []ast.Spec{spec}}),
+		Pos:       x.fset.Position(spec.Pos()),
+		Instances: x.instances(spec.Name.Name),
+	}
+}
+
+func (x *extractor) fn(decl *ast.FuncDecl) *Func {
+	if !decl.Name.IsExported() {
+		return nil
+	}
+	fn := &Func{
+		Name: decl.Name.Name,
+		Doc:  decl.Doc.Text(),
+		Pos:  x.fset.Position(decl.Pos()),
+	}
+	key := fn.Name
+	if decl.Recv != nil && len(decl.Recv.List) > 0 {
+		fn.Recv = recvName(decl.Recv.List[0].Type)
+		if !ast.IsExported(fn.Recv) {
+			return nil
+		}
+		key = fn.Recv + "." + fn.Name
+	}
+	fn.Decl = x.print(&ast.FuncDecl{Recv: decl.Recv, Name: decl.Name, TypeParams: decl.TypeParams, Type: decl.Type})
+	fn.Instances = x.instances(key)
+	return fn
+}
+
+// instances returns the instances of the generic declaration with the given
+// key (see types.GenericDecl.Key), or nil if there is no such declaration.
+func (x *extractor) instances(key string) []*Instance {
+	decl := x.generics[key]
+	if decl == nil {
+		return nil
+	}
+	var recvParams []*types.TypeParam
+	if sig, ok := decl.Type.(*types.GenericSignature); ok {
+		recvParams = sig.RecvTypeParams()
+	}
+	var instances []*Instance
+	for _, usg := range decl.Instances() {
+		inst := &Instance{Pos: x.fset.Position(usg.Pos)}
+		if usg.Pkg != nil {
+			inst.ImportPath = usg.Pkg.Path()
+		}
+		args := usg.TypeArgs
+		if recv := decl.Recv(); recv != nil {
+			inst.Name = recv.Name() + x.typeArgs(decl.TypeParams()[:len(recvParams)], args[:len(recvParams)]) + "."
+			args = args[len(recvParams):]
+		}
+		inst.Name += decl.Name + x.typeArgs(decl.TypeParams()[len(recvParams):], args)
+		instances = append(instances, inst)
+	}
+	sort.Slice(instances, func(i, j int) bool { return instances[i].Name < instances[j].Name })
+	return instances
+}
+
+// typeArgs formats args, the type arguments for params, in square brackets.
+// Missing type arguments are printed as the name of their type parameter.
+func (x *extractor) typeArgs(params []*types.TypeParam, args []types.Type) string {
+	if len(params) == 0 {
+		return ""
+	}
+	strs := make([]string, len(params))
+	for i, param := range params {
+		if args[i] != nil {
+			strs[i] = types.TypeString(args[i], x.qf)
+		} else {
+			strs[i] = param.String()
+		}
+	}
+	return "[" + strings.Join(strs, ", ") + "]"
+}
+
+// print formats node in Fo syntax, without comments.
+func (x *extractor) print(node ast.Node) string {
+	var buf bytes.Buffer
+	if err := format.Node(&buf, x.fset, node); err != nil {
+		return ""
+	}
+	return buf.String()
+}
+
+// recvName returns the name of the receiver type expr, e.g. Box for
+// *Box[T].
+func recvName(expr ast.Expr) string {
+	switch x := expr.(type) {
+	case *ast.Ident:
+		return x.Name
+	case *ast.StarExpr:
+		return recvName(x.X)
+	case *ast.ParenExpr:
+		return recvName(x.X)
+	case *ast.TypeArgExpr:
+		return recvName(x.X)
+	case *ast.IndexExpr:
+		return recvName(x.X)
+	}
+	return ""
+}
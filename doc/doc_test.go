@@ -0,0 +1,232 @@
+package doc
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/qProust/fo/query"
+)
+
+const libSrc = `// Package lib holds boxes.
+package lib
+
+// Answer is the answer.
+const Answer = 42
+
+const (
+	A, b = 1, 2
+	C    = 3
+)
+
+// Box holds a value.
+//
+//	b := Box[int]{}
+type Box[T] struct {
+	value T
+}
+
+// Get returns the value.
+func (b Box[T]) Get() T {
+	return b.value
+}
+
+func (b Box[T]) Map[U](f func(T) U) U {
+	return f(b.value)
+}
+
+func (b Box[T]) hidden() {}
+
+// Wrap returns a Box holding x.
+func Wrap[T](x T) Box[T] {
+	return Box[T]{value: x}
+}
+
+func helper() {}
+`
+
+const mainSrc = `package main
+
+import "example.com/app/lib"
+
+func main() {
+	b := lib.Wrap[int](1)
+	_ = b.Map[string](func(int) string { return "" })
+	_ = lib.Wrap[string]("x").Get()
+}
+`
+
+func loadTestProgram(t *testing.T) (*query.Program, string, func()) {
+	t.Helper()
+	root, err := ioutil.TempDir("", "fo-doc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanup := func() { os.RemoveAll(root) }
+	files := map[string]string{
+		"go.mod":     "module example.com/app\n",
+		"lib/lib.fo": libSrc,
+		"main.fo":    mainSrc,
+	}
+	for name, content := range files {
+		filename := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			cleanup()
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			cleanup()
+			t.Fatal(err)
+		}
+	}
+	prog, err := query.Load(root, nil)
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	for _, pkg := range prog.Packages {
+		if len(pkg.Errors) > 0 {
+			cleanup()
+			t.Fatalf("unexpected errors in %s: %v", pkg.ImportPath, pkg.Errors)
+		}
+	}
+	return prog, root, cleanup
+}
+
+func formatInstances(root string, instances []*Instance) string {
+	var strs []string
+	for _, inst := range instances {
+		rel, _ := filepath.Rel(root, inst.Pos.Filename)
+		strs = append(strs, fmt.Sprintf("%s@%s:%d in %s", inst.Name, filepath.ToSlash(rel), inst.Pos.Line, inst.ImportPath))
+	}
+	return strings.Join(strs, "; ")
+}
+
+func TestNew(t *testing.T) {
+	prog, root, cleanup := loadTestProgram(t)
+	defer cleanup()
+	var lib *query.Package
+	for _, pkg := range prog.Packages {
+		if pkg.ImportPath == "example.com/app/lib" {
+			lib = pkg
+		}
+	}
+	if lib == nil {
+		t.Fatal("package lib not loaded")
+	}
+	d := New(prog, lib)
+
+	var lines []string
+	lines = append(lines, "package "+d.Name+": "+strings.TrimSpace(d.Doc))
+	for _, val := range d.Consts {
+		lines = append(lines, fmt.Sprintf("const %s: %q %q", strings.Join(val.Names, ", "), val.Doc, val.Decl))
+	}
+	for _, fn := range d.Funcs {
+		lines = append(lines, fmt.Sprintf("func %s: %q %q {%s}", fn.Name, fn.Doc, fn.Decl, formatInstances(root, fn.Instances)))
+	}
+	for _, typ := range d.Types {
+		lines = append(lines, fmt.Sprintf("type %s: %q %q {%s}", typ.Name, typ.Doc, typ.Decl, formatInstances(root, typ.Instances)))
+		for _, method := range typ.Methods {
+			lines = append(lines, fmt.Sprintf("\tmethod %s.%s: %q {%s}", method.Recv, method.Name, method.Decl, formatInstances(root, method.Instances)))
+		}
+	}
+	got := strings.Join(lines, "\n")
+	want := strings.Join([]string{
+		"package lib: Package lib holds boxes.",
+		`const Answer: "Answer is the answer.\n" "const Answer = 42"`,
+		`const A, C: "" "const (\n\tA, b = 1, 2\n\tC    = 3\n)"`,
+		`func Wrap: "Wrap returns a Box holding x.\n" "func Wrap[T](x T) Box[T]" {Wrap[int]@main.fo:6 in example.com/app; Wrap[string]@main.fo:8 in example.com/app}`,
+		`type Box: "Box holds a value.\n\n\tb := Box[int]{}\n" "type Box[T] struct {\n\tvalue T\n}" {Box[int]@main.fo:6 in example.com/app; Box[string]@main.fo:8 in example.com/app}`,
+		`	method Box.Get: "func (b Box[T]) Get() T" {Box[int].Get@main.fo:6 in example.com/app; Box[string].Get@main.fo:8 in example.com/app}`,
+		`	method Box.Map: "func (b Box[T]) Map[U](f func(T) U) U" {Box[int].Map[string]@main.fo:7 in example.com/app}`,
+	}, "\n")
+	if got != want {
+		t.Errorf("wrong documentation:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestSite(t *testing.T) {
+	prog, root, cleanup := loadTestProgram(t)
+	defer cleanup()
+	site, err := NewSite(prog, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantPaths := []string{
+		"index.html",
+		"pkg/example.com/app/index.html",
+		"pkg/example.com/app/lib/index.html",
+		"src/lib/lib.fo.html",
+		"src/main.fo.html",
+	}
+	if got := strings.Join(site.Paths(), "\n"); got != strings.Join(wantPaths, "\n") {
+		t.Fatalf("wrong pages:\ngot:\n%s\nwant:\n%s", got, strings.Join(wantPaths, "\n"))
+	}
+
+	page, _ := site.Page("pkg/example.com/app/lib/index.html")
+	for _, want := range []string{
+		`<pre>func Wrap[T](x T) Box[T]</pre>`,
+		`<pre>b := Box[int]{}</pre>`,
+		`<li><code>Box[int].Map[string]</code> required at <a href="../../../../src/main.fo.html#L7">main.fo:7:11</a> in <a href="../../../../pkg/example.com/app/index.html">example.com/app</a></li>`,
+		`<h3 id="Box">type Box <a class="src" href="../../../../src/lib/lib.fo.html#L15">source</a></h3>`,
+		`<li><a href="../../../../src/lib/lib.fo.html">lib/lib.fo</a></li>`,
+	} {
+		if !strings.Contains(string(page), want) {
+			t.Errorf("documentation of lib does not contain %s:\n%s", want, page)
+		}
+	}
+	for _, unwanted := range []string{"hidden", "helper"} {
+		if strings.Contains(string(page), unwanted) {
+			t.Errorf("documentation of lib contains unexported %s", unwanted)
+		}
+	}
+	src, _ := site.Page("src/main.fo.html")
+	if want := `<span id="L7"><a href="#L7">    7</a>  	_ = b.Map[string](func(int) string { return &#34;&#34; })`; !strings.Contains(string(src), want) {
+		t.Errorf("source of main.fo does not contain %s:\n%s", want, src)
+	}
+
+	for _, test := range []struct {
+		path     string
+		code     int
+		location string
+	}{
+		{"/", http.StatusOK, ""},
+		{"/pkg/example.com/app/lib/", http.StatusOK, ""},
+		{"/pkg/example.com/app/lib", http.StatusMovedPermanently, "/pkg/example.com/app/lib/"},
+		{"/src/main.fo.html", http.StatusOK, ""},
+		{"/src/missing.fo.html", http.StatusNotFound, ""},
+	} {
+		rec := httptest.NewRecorder()
+		site.ServeHTTP(rec, httptest.NewRequest("GET", test.path, nil))
+		if rec.Code != test.code {
+			t.Errorf("GET %s: got status %d, want %d", test.path, rec.Code, test.code)
+		}
+		if loc := rec.Header().Get("Location"); loc != test.location {
+			t.Errorf("GET %s: got location %q, want %q", test.path, loc, test.location)
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "fo-doc-html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := site.WriteFiles(dir); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range wantPaths {
+		content, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(p)))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if page, _ := site.Page(p); string(content) != string(page) {
+			t.Errorf("wrong content written for %s", p)
+		}
+	}
+}
@@ -0,0 +1,360 @@
+package doc
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/qProust/fo/query"
+	"github.com/qProust/fo/token"
+)
+
+// A Site is the HTML documentation of the packages of a Program. Its pages
+// are an index of the packages (index.html), the documentation of each
+// package (pkg/<import path>/index.html) and the source of each file
+// (src/<file name relative to the root>.html), to which declarations and
+// instantiation sites are linked. Links between pages are relative, so that
+// the pages can be served as well as browsed from a directory.
+type Site struct {
+	root  string            // absolute directory of the sources
+	pkgs  map[string]bool   // import paths of the documented packages
+	pages map[string][]byte // by slash-separated path
+}
+
+// NewSite renders the documentation of the packages of prog, the sources of
+// which are in the directory tree root.
+func NewSite(prog *query.Program, root string) (*Site, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	s := &Site{
+		root:  root,
+		pkgs:  map[string]bool{},
+		pages: map[string][]byte{},
+	}
+	var docs []*Package
+	for _, pkg := range prog.Packages {
+		docs = append(docs, New(prog, pkg))
+		s.pkgs[pkg.ImportPath] = true
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i].ImportPath < docs[j].ImportPath })
+	if err := s.render("index.html", "index", "Packages", docs); err != nil {
+		return nil, err
+	}
+	for _, d := range docs {
+		if err := s.render("pkg/"+d.ImportPath+"/index.html", "package", "Package "+d.Name, d); err != nil {
+			return nil, err
+		}
+		for _, filename := range d.Files {
+			rel, ok := s.rel(filename)
+			if !ok {
+				continue
+			}
+			src, err := ioutil.ReadFile(filename)
+			if err != nil {
+				return nil, err
+			}
+			var lines []sourceLine
+			for i, text := range strings.SplitAfter(string(src), "\n") {
+				if text != "" {
+					lines = append(lines, sourceLine{N: i + 1, Text: text})
+				}
+			}
+			if err := s.render("src/"+rel+".html", "source", rel, lines); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return s, nil
+}
+
+// Paths returns the paths of the pages of s, sorted.
+func (s *Site) Paths() []string {
+	paths := make([]string, 0, len(s.pages))
+	for p := range s.pages {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Page returns the content of the page at path p, and whether it exists.
+func (s *Site) Page(p string) ([]byte, bool) {
+	content, found := s.pages[p]
+	return content, found
+}
+
+// ServeHTTP serves the pages of s. The path of a directory serves its
+// index.html page, and is redirected to if it lacks the trailing slash.
+func (s *Site) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if p == "" || strings.HasSuffix(r.URL.Path, "/") {
+		p = path.Join(p, "index.html")
+	}
+	content, found := s.pages[p]
+	if !found && s.pages[path.Join(p, "index.html")] != nil {
+		http.Redirect(w, r, r.URL.Path+"/", http.StatusMovedPermanently)
+		return
+	}
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(content)
+}
+
+// WriteFiles writes the pages of s to the directory dir, which is created if
+// needed.
+func (s *Site) WriteFiles(dir string) error {
+	for _, p := range s.Paths() {
+		filename := filepath.Join(dir, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filename, s.pages[p], 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rel returns the slash-separated name of filename relative to the root of s,
+// and false if filename is not in the root.
+func (s *Site) rel(filename string) (string, bool) {
+	rel, err := filepath.Rel(s.root, filename)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// A sourceLine is a numbered line of a source file.
+type sourceLine struct {
+	N    int
+	Text string
+}
+
+// A page is the data of the templates. Its methods make links relative to the
+// page.
+type page struct {
+	site  *Site
+	base  string // relative path of the root of the site, e.g. "../../"
+	Title string
+	Data  interface{}
+}
+
+func (s *Site) render(p, name, title string, data interface{}) error {
+	pg := &page{
+		site:  s,
+		base:  strings.Repeat("../", strings.Count(p, "/")),
+		Title: title,
+		Data:  data,
+	}
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, name, pg); err != nil {
+		return fmt.Errorf("failed to render %s: %s", p, err)
+	}
+	s.pages[p] = buf.Bytes()
+	return nil
+}
+
+// Index returns the link to the index of the packages.
+func (pg *page) Index() string {
+	return pg.base + "index.html"
+}
+
+// Pkg returns the link to the documentation of the package importPath, or an
+// empty string if it is not documented.
+func (pg *page) Pkg(importPath string) string {
+	if !pg.site.pkgs[importPath] {
+		return ""
+	}
+	return pg.base + "pkg/" + importPath + "/index.html"
+}
+
+// Src returns the link to the line of pos in the source, or an empty string
+// if the file of pos is not part of the site.
+func (pg *page) Src(pos token.Position) string {
+	if !pos.IsValid() {
+		return ""
+	}
+	rel, ok := pg.site.rel(pos.Filename)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("%ssrc/%s.html#L%d", pg.base, rel, pos.Line)
+}
+
+// where formats pos relative to the root of the site, or returns an empty
+// string if pos is invalid.
+func (pg *page) where(pos token.Position) string {
+	if !pos.IsValid() {
+		return ""
+	}
+	if rel, ok := pg.site.rel(pos.Filename); ok {
+		pos.Filename = rel
+	}
+	return pos.String()
+}
+
+// A link is an item of a list of links in a page. Src and Pkg are empty if
+// there is nothing to link to.
+type link struct {
+	Name       string
+	Where      string
+	Src        string
+	ImportPath string
+	Pkg        string
+}
+
+// Instances returns the links of the instances of a generic declaration.
+func (pg *page) Instances(instances []*Instance) []link {
+	var links []link
+	for _, inst := range instances {
+		links = append(links, link{
+			Name:       inst.Name,
+			Where:      pg.where(inst.Pos),
+			Src:        pg.Src(inst.Pos),
+			ImportPath: inst.ImportPath,
+			Pkg:        pg.Pkg(inst.ImportPath),
+		})
+	}
+	return links
+}
+
+// Files returns the links of the source files of a package.
+func (pg *page) Files(files []string) []link {
+	var links []link
+	for _, filename := range files {
+		if rel, ok := pg.site.rel(filename); ok {
+			links = append(links, link{Name: rel, Src: pg.base + "src/" + rel + ".html"})
+		} else {
+			links = append(links, link{Name: filename})
+		}
+	}
+	return links
+}
+
+// Comment formats the text of a doc comment: paragraphs are separated by
+// blank lines, and indented lines are preformatted without their common
+// indentation.
+func (pg *page) Comment(text string) template.HTML {
+	var buf bytes.Buffer
+	var para, pre []string
+	flush := func() {
+		if len(para) > 0 {
+			buf.WriteString("<p>" + template.HTMLEscapeString(strings.Join(para, "\n")) + "</p>\n")
+			para = nil
+		}
+		if len(pre) > 0 {
+			buf.WriteString("<pre>" + template.HTMLEscapeString(unindent(pre)) + "</pre>\n")
+			pre = nil
+		}
+	}
+	for _, line := range strings.Split(text, "\n") {
+		switch {
+		case strings.TrimSpace(line) == "":
+			flush()
+		case line[0] == ' ' || line[0] == '\t':
+			if len(para) > 0 {
+				flush()
+			}
+			pre = append(pre, line)
+		default:
+			if len(pre) > 0 {
+				flush()
+			}
+			para = append(para, line)
+		}
+	}
+	flush()
+	return template.HTML(buf.String())
+}
+
+// unindent joins lines after removing the leading white space they have in
+// common.
+func unindent(lines []string) string {
+	prefix := lines[0][:len(lines[0])-len(strings.TrimLeft(lines[0], " \t"))]
+	for _, line := range lines[1:] {
+		for !strings.HasPrefix(line, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	unindented := make([]string, len(lines))
+	for i, line := range lines {
+		unindented[i] = line[len(prefix):]
+	}
+	return strings.Join(unindented, "\n")
+}
+
+var templates = template.Must(template.New("").Parse(`
+{{define "header"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; max-width: 60em; }
+pre { background: #f4f4f4; padding: 0.5em; overflow-x: auto; }
+pre.source { background: none; padding: 0; }
+pre.source a { color: #999; text-decoration: none; }
+pre.source span:target { background: #ffa; }
+a.src { font-size: small; font-weight: normal; }
+</style>
+</head>
+<body>
+<p><a href="{{.Index}}">Packages</a></p>
+{{end}}
+
+{{define "footer"}}</body>
+</html>
+{{end}}
+
+{{define "index"}}{{template "header" .}}<h1>Packages</h1>
+<table>
+{{range .Data}}<tr><td><a href="{{$.Pkg .ImportPath}}">{{.ImportPath}}</a></td><td>{{.Name}}</td></tr>
+{{end}}</table>
+{{template "footer" .}}{{end}}
+
+{{define "instances"}}{{if .}}<p>Instances:</p>
+<ul>
+{{range $inst := .}}<li><code>{{.Name}}</code>{{with .Where}} required at {{if $inst.Src}}<a href="{{$inst.Src}}">{{.}}</a>{{else}}{{.}}{{end}}{{end}}{{with .ImportPath}} in {{if $inst.Pkg}}<a href="{{$inst.Pkg}}">{{.}}</a>{{else}}{{.}}{{end}}{{end}}</li>
+{{end}}</ul>
+{{end}}{{end}}
+
+{{define "decl"}}<pre>{{.Decl}}</pre>
+{{end}}
+
+{{define "package"}}{{template "header" .}}{{with .Data}}<h1>Package {{.Name}}</h1>
+<p><code>import "{{.ImportPath}}"</code></p>
+{{$.Comment .Doc}}
+{{if .Consts}}<h2 id="consts">Constants</h2>
+{{range .Consts}}{{template "decl" .}}{{$.Comment .Doc}}{{end}}{{end}}
+{{if .Vars}}<h2 id="vars">Variables</h2>
+{{range .Vars}}{{template "decl" .}}{{$.Comment .Doc}}{{end}}{{end}}
+{{if .Funcs}}<h2 id="funcs">Functions</h2>
+{{range .Funcs}}<h3 id="{{.Name}}">func {{.Name}} {{with $.Src .Pos}}<a class="src" href="{{.}}">source</a>{{end}}</h3>
+{{template "decl" .}}{{$.Comment .Doc}}{{template "instances" $.Instances .Instances}}{{end}}{{end}}
+{{if .Types}}<h2 id="types">Types</h2>
+{{range $type := .Types}}<h3 id="{{.Name}}">type {{.Name}} {{with $.Src .Pos}}<a class="src" href="{{.}}">source</a>{{end}}</h3>
+{{template "decl" .}}{{$.Comment .Doc}}{{template "instances" $.Instances .Instances}}{{range .Methods}}<h4 id="{{$type.Name}}.{{.Name}}">func ({{$type.Name}}) {{.Name}} {{with $.Src .Pos}}<a class="src" href="{{.}}">source</a>{{end}}</h4>
+{{template "decl" .}}{{$.Comment .Doc}}{{template "instances" $.Instances .Instances}}{{end}}{{end}}{{end}}
+{{with $.Files .Files}}<h2 id="files">Files</h2>
+<ul>
+{{range .}}<li>{{if .Src}}<a href="{{.Src}}">{{.Name}}</a>{{else}}{{.Name}}{{end}}</li>
+{{end}}</ul>
+{{end}}{{end}}{{template "footer" .}}{{end}}
+
+{{define "source"}}{{template "header" .}}<h1>{{.Title}}</h1>
+<pre class="source">{{range .Data}}<span id="L{{.N}}"><a href="#L{{.N}}">{{printf "%5d" .N}}</a>  {{.Text}}</span>{{end}}</pre>
+{{template "footer" .}}{{end}}
+`))
@@ -19,6 +19,9 @@ import (
 
 var config = printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
 
+// strictConfig is the configuration of StrictNode.
+var strictConfig = printer.Config{Mode: config.Mode | printer.StrictFormat, Tabwidth: 8}
+
 const parserMode = parser.ParseComments
 
 // Node formats node in canonical gofmt style and writes the result to dst.
@@ -33,6 +36,20 @@ const parserMode = parser.ParseComments
 // and return a formatting error, for instance due to an incorrect AST.
 //
 func Node(dst io.Writer, fset *token.FileSet, node interface{}) error {
+	return formatNode(dst, fset, node, &config)
+}
+
+// StrictNode is like Node, but formats node more strictly than gofmt, in the
+// profile of the printer.StrictFormat mode: e.g. there are no empty lines at
+// the start and end of blocks, and the imports of the standard library come
+// first.
+func StrictNode(dst io.Writer, fset *token.FileSet, node interface{}) error {
+	return formatNode(dst, fset, node, &strictConfig)
+}
+
+// formatNode implements Node and StrictNode with the printer configuration
+// cfg.
+func formatNode(dst io.Writer, fset *token.FileSet, node interface{}, cfg *printer.Config) error {
 	// Determine if we have a complete source file (file != nil).
 	var file *ast.File
 	var cnode *printer.CommentedNode
@@ -51,7 +68,7 @@ func Node(dst io.Writer, fset *token.FileSet, node interface{}) error {
 		// Make a copy of the AST because ast.SortImports is destructive.
 		// TODO(gri) Do this more efficiently.
 		var buf bytes.Buffer
-		err := config.Fprint(&buf, fset, file)
+		err := cfg.Fprint(&buf, fset, file)
 		if err != nil {
 			return err
 		}
@@ -69,7 +86,7 @@ func Node(dst io.Writer, fset *token.FileSet, node interface{}) error {
 		}
 	}
 
-	return config.Fprint(dst, fset, node)
+	return cfg.Fprint(dst, fset, node)
 }
 
 // Source formats src in canonical gofmt style and returns the result
@@ -75,6 +75,77 @@ func TestSource(t *testing.T) {
 	diff(t, res, src)
 }
 
+// Imports which are only used in type arguments must be kept when imports are
+// sorted.
+func TestSourceTypeArgImports(t *testing.T) {
+	src := `package p
+
+import (
+	"strings"
+	"bytes"
+)
+
+var x Box[bytes.Buffer]
+
+func f() Pair[int, strings.Builder] { return Pair[int, strings.Builder]{} }
+`
+	res, err := Source([]byte(src))
+	if err != nil {
+		t.Fatal("Source failed:", err)
+	}
+	expected := strings.Replace(src, "\t\"strings\"\n\t\"bytes\"", "\t\"bytes\"\n\t\"strings\"", 1)
+	if string(res) != expected {
+		t.Errorf("wrong result\nexpected:\n%s\ngot:\n%s", expected, res)
+	}
+}
+
+// The imports are sorted before they are grouped by StrictNode.
+func TestStrictNode(t *testing.T) {
+	src := `package p
+
+import (
+	"github.com/example/b"
+	"strings"
+	"github.com/example/a"
+	"bytes"
+)
+
+func f() {
+
+	_ = strings.NewReader(a.S + b.S)
+	_ = bytes.MinRead + 0644
+
+}
+`
+	expected := `package p
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/example/a"
+	"github.com/example/b"
+)
+
+func f() {
+	_ = strings.NewReader(a.S + b.S)
+	_ = bytes.MinRead + 0o644
+}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := StrictNode(&buf, fset, file); err != nil {
+		t.Fatal("StrictNode failed:", err)
+	}
+	if buf.String() != expected {
+		t.Errorf("wrong result\nexpected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
 // Test cases that are expected to fail are marked by the prefix "ERROR".
 // The formatted result must look the same as the input for successful tests.
 var tests = []string{
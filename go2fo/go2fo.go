@@ -0,0 +1,230 @@
+// Package go2fo converts Go source code which uses the type parameters of Go
+// 1.18 and later into Fo source code, so that existing generic Go libraries
+// can be maintained in Fo.
+//
+// The conversion is syntactic. Type parameter lists lose the constraint any,
+// which is implied in Fo, and a constraint which applies to several type
+// parameters in Go (e.g. [K, V comparable]) is repeated for each of them, since
+// in Fo a constraint only applies to the type parameter it follows. Other uses
+// of the predeclared any become interface{}. The rest of the source is copied
+// as it is, because the syntax of instantiations and generic receivers is the
+// same in both languages.
+package go2fo
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/qProust/fo/ast"
+	"github.com/qProust/fo/cst"
+	"github.com/qProust/fo/scanner"
+	"github.com/qProust/fo/token"
+	"github.com/qProust/fo/types"
+)
+
+// Convert converts the Go files filenames, which must belong to a single
+// package, to Fo. It returns the contents of the resulting .fo files, by the
+// name of the .go file with the extension replaced.
+//
+// Some Go constructs have no equivalent in Fo: constraints other than any and
+// comparable (including type sets such as ~int | ~float64, which are reported
+// as syntax errors) and calls of generic functions whose type arguments are
+// inferred, since Fo infers fewer of them than Go (e.g. none from
+// constraints). If filenames contain any of them, Convert returns a
+// scanner.ErrorList which reports each of them.
+func Convert(filenames []string) (map[string][]byte, error) {
+	fset := token.NewFileSet()
+	var errs scanner.ErrorList
+	var files []*cst.File
+	for _, filename := range filenames {
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		file, err := cst.ParseFile(fset, filename, src, 0)
+		if list, ok := err.(scanner.ErrorList); ok {
+			errs = append(errs, list...)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	// The parser only resolves identifiers within a file, so the package-level
+	// declarations of the other files are collected here.
+	declared := map[string]bool{}
+	generic := map[string]bool{}
+	for _, file := range files {
+		for name := range file.AST.Scope.Objects {
+			declared[name] = true
+		}
+		for _, decl := range file.AST.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && fn.TypeParams != nil {
+				generic[fn.Name.Name] = true
+			}
+		}
+	}
+
+	result := map[string][]byte{}
+	for _, file := range files {
+		c := &converter{
+			fset:     fset,
+			file:     file.AST,
+			editor:   cst.NewEditor(file),
+			declared: declared,
+			generic:  generic,
+		}
+		c.convert()
+		errs = append(errs, c.errs...)
+		src, err := c.editor.Bytes()
+		if err != nil {
+			return nil, err
+		}
+		filename := fset.Position(file.AST.Pos()).Filename
+		result[strings.TrimSuffix(filename, ".go")+".fo"] = src
+	}
+	if len(errs) > 0 {
+		errs.Sort()
+		return nil, errs
+	}
+	return result, nil
+}
+
+// A converter makes the edits which convert one file.
+type converter struct {
+	fset     *token.FileSet
+	file     *ast.File
+	editor   *cst.Editor
+	declared map[string]bool // package-level declarations of all files
+	generic  map[string]bool // generic functions of all files
+	errs     scanner.ErrorList
+
+	unresolved map[*ast.Ident]bool // identifiers which are not declared in the file
+}
+
+func (c *converter) errorf(pos token.Pos, format string, args ...interface{}) {
+	c.errs.Add(c.fset.Position(pos), fmt.Sprintf(format, args...))
+}
+
+// predeclared reports whether id refers to the predeclared identifier name.
+func (c *converter) predeclared(id *ast.Ident, name string) bool {
+	return id.Name == name && !c.declared[name] && c.unresolved[id]
+}
+
+// packageLevel reports whether id refers to a package-level declaration of
+// any of the files.
+func (c *converter) packageLevel(id *ast.Ident) bool {
+	if c.unresolved[id] {
+		return c.declared[id.Name]
+	}
+	return id.Obj != nil && id.Obj == c.file.Scope.Lookup(id.Name)
+}
+
+func (c *converter) convert() {
+	c.unresolved = map[*ast.Ident]bool{}
+	for _, id := range c.file.Unresolved {
+		c.unresolved[id] = true
+	}
+
+	var typeParams []*ast.TypeParamDecl
+	instantiated := map[*ast.Ident]bool{}
+	declNames := map[*ast.Ident]bool{}
+	ast.Inspect(c.file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.TypeSpec:
+			if n.TypeParams != nil {
+				typeParams = append(typeParams, n.TypeParams)
+			}
+		case *ast.FuncDecl:
+			declNames[n.Name] = true
+			if n.TypeParams != nil {
+				typeParams = append(typeParams, n.TypeParams)
+			}
+		case *ast.IndexExpr:
+			if id, ok := n.X.(*ast.Ident); ok {
+				instantiated[id] = true
+			}
+		case *ast.TypeArgExpr:
+			if id, ok := n.X.(*ast.Ident); ok {
+				instantiated[id] = true
+			}
+		}
+		return true
+	})
+
+	inTypeParams := func(pos token.Pos) bool {
+		for _, tpDecl := range typeParams {
+			if tpDecl.Pos() <= pos && pos < tpDecl.End() {
+				return true
+			}
+		}
+		return false
+	}
+	for _, tpDecl := range typeParams {
+		if text, ok := c.typeParams(tpDecl); ok {
+			c.editor.Replace(tpDecl, text)
+		}
+	}
+	ast.Inspect(c.file, func(n ast.Node) bool {
+		id, ok := n.(*ast.Ident)
+		if !ok || inTypeParams(id.Pos()) {
+			return true
+		}
+		switch {
+		case c.predeclared(id, "any"):
+			c.editor.Replace(id, "interface{}")
+		case c.generic[id.Name] && !declNames[id] && !instantiated[id] && c.packageLevel(id):
+			c.errorf(id.Pos(), "type arguments of generic function %s must be given explicitly in Fo", id.Name)
+		}
+		return true
+	})
+}
+
+// typeParams returns the Fo text of the type parameter list tpDecl. It
+// reports false if the list needs no change.
+func (c *converter) typeParams(tpDecl *ast.TypeParamDecl) (string, bool) {
+	if tpDecl.Constraints == nil {
+		return "", false
+	}
+	// In Go, a constraint applies to the type parameters without one before it.
+	constraints := make([]string, len(tpDecl.Names))
+	constraint := ""
+	for i := len(tpDecl.Names) - 1; i >= 0; i-- {
+		if i < len(tpDecl.Constraints) && tpDecl.Constraints[i] != nil {
+			constraint = c.constraint(tpDecl.Constraints[i])
+		}
+		constraints[i] = constraint
+	}
+	var params []string
+	for i, name := range tpDecl.Names {
+		if constraints[i] != "" {
+			params = append(params, name.Name+" "+constraints[i])
+		} else {
+			params = append(params, name.Name)
+		}
+	}
+	return "[" + strings.Join(params, ", ") + "]", true
+}
+
+// constraint returns the Fo constraint for the Go constraint e, which is empty
+// if there is none.
+func (c *converter) constraint(e ast.Expr) string {
+	if id, ok := e.(*ast.Ident); ok {
+		switch {
+		case c.predeclared(id, "any"):
+			return ""
+		case c.predeclared(id, "comparable"):
+			return "comparable"
+		}
+	}
+	if iface, ok := e.(*ast.InterfaceType); ok && len(iface.Methods.List) == 0 {
+		return ""
+	}
+	c.errorf(e.Pos(), "constraint %s is not supported by Fo (only any and comparable are)", types.ExprString(e))
+	return ""
+}
@@ -0,0 +1,151 @@
+package go2fo
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/qProust/fo/loader/loadertest"
+	"github.com/qProust/fo/scanner"
+)
+
+func convert(t *testing.T, files map[string]string) (string, map[string][]byte, error) {
+	t.Helper()
+	root, cleanup := loadertest.WriteTree(t, files)
+	defer cleanup()
+	var filenames []string
+	for name := range files {
+		filenames = append(filenames, filepath.Join(root, name))
+	}
+	converted, err := Convert(filenames)
+	return root, converted, err
+}
+
+func TestConvert(t *testing.T) {
+	root, converted, err := convert(t, map[string]string{
+		"pair.go": `package pairs
+
+// Pair holds two values.
+type Pair[K comparable, V any] struct {
+	Key   K
+	Value V
+}
+
+type Set[T comparable] map[T]bool
+
+func Entries[K, V comparable](m map[K]V) []Pair[K, V] {
+	var result []Pair[K, V]
+	for k, v := range m {
+		result = append(result, Pair[K, V]{k, v})
+	}
+	return result
+}
+
+func Values[K comparable, V interface{}](ps []Pair[K, V]) []any {
+	var result []any
+	for _, p := range ps {
+		result = append(result, p.Value)
+	}
+	return result
+}
+`,
+		"use.go": `package pairs
+
+func (p Pair[K, V]) Swap() Pair[K, V] { return p }
+
+var entries = Entries[string, int]
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"pair.fo": `package pairs
+
+// Pair holds two values.
+type Pair[K comparable, V] struct {
+	Key   K
+	Value V
+}
+
+type Set[T comparable] map[T]bool
+
+func Entries[K comparable, V comparable](m map[K]V) []Pair[K, V] {
+	var result []Pair[K, V]
+	for k, v := range m {
+		result = append(result, Pair[K, V]{k, v})
+	}
+	return result
+}
+
+func Values[K comparable, V](ps []Pair[K, V]) []interface{} {
+	var result []interface{}
+	for _, p := range ps {
+		result = append(result, p.Value)
+	}
+	return result
+}
+`,
+		"use.fo": `package pairs
+
+func (p Pair[K, V]) Swap() Pair[K, V] { return p }
+
+var entries = Entries[string, int]
+`,
+	}
+	if len(converted) != len(expected) {
+		t.Errorf("expected %d files, got %d", len(expected), len(converted))
+	}
+	for name, src := range expected {
+		if got := string(converted[filepath.Join(root, name)]); got != src {
+			t.Errorf("wrong result for %s\nexpected:\n%s\ngot:\n%s", name, src, got)
+		}
+	}
+}
+
+func TestConvertErrors(t *testing.T) {
+	_, _, err := convert(t, map[string]string{
+		"lib.go": `package lib
+
+type Stringer interface {
+	String() string
+}
+
+func Join[T Stringer](xs []T) string {
+	return ""
+}
+
+func First[T any](xs []T) T {
+	return xs[0]
+}
+
+func Apply[T any](f func([]T) T, xs []T) T {
+	return f(xs)
+}
+
+var (
+	_ = First([]int{1})
+	_ = First[int]([]int{1})
+	_ = Apply[int](First, nil)
+)
+`,
+	})
+	list, ok := err.(scanner.ErrorList)
+	if !ok {
+		t.Fatalf("expected a scanner.ErrorList, got %v", err)
+	}
+	var got []string
+	for _, e := range list {
+		got = append(got, filepath.Base(e.Error()))
+	}
+	expected := []string{
+		"lib.go:7:13: constraint Stringer is not supported by Fo (only any and comparable are)",
+		"lib.go:20:6: type arguments of generic function First must be given explicitly in Fo",
+		"lib.go:22:17: type arguments of generic function First must be given explicitly in Fo",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("wrong errors\nexpected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
@@ -0,0 +1,117 @@
+// Package grammar generates syntax highlighting grammars of Fo for editors.
+//
+// The keywords, operators and predeclared identifiers of the grammars are taken
+// from the token and types packages, so that the grammars stay in sync with
+// the language when it changes: regenerating them is enough.
+//
+// Two formats are supported: TextMate grammars (.tmLanguage.json files), which
+// are used by VS Code, Sublime Text and many other editors, and tree-sitter
+// grammars, which are used by Neovim, Helix and Zed among others.
+package grammar
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/qProust/fo/token"
+	"github.com/qProust/fo/types"
+)
+
+// contextualKeywords are the identifiers which the parser treats as keywords
+// in some contexts only, and which are therefore not in the token package.
+var contextualKeywords = []string{
+	"enum", // type T enum { ... }, see parseEnumOrType
+}
+
+// controlKeywords are the keywords which affect the flow of control. They are
+// highlighted differently from the keywords which declare something.
+var controlKeywords = map[token.Token]bool{
+	token.BREAK:       true,
+	token.CASE:        true,
+	token.CONTINUE:    true,
+	token.DEFAULT:     true,
+	token.DEFER:       true,
+	token.ELSE:        true,
+	token.FALLTHROUGH: true,
+	token.FOR:         true,
+	token.GO:          true,
+	token.GOTO:        true,
+	token.IF:          true,
+	token.RANGE:       true,
+	token.RETURN:      true,
+	token.SELECT:      true,
+	token.SWITCH:      true,
+}
+
+// tokens returns the tokens for which keep reports true, in order.
+func tokens(keep func(token.Token) bool) []token.Token {
+	var toks []token.Token
+	// The token package doesn't export the number of tokens, but there are
+	// far less than 256 of them.
+	for tok := token.Token(0); tok < 256; tok++ {
+		if keep(tok) {
+			toks = append(toks, tok)
+		}
+	}
+	return toks
+}
+
+// keywords returns the keywords which affect the flow of control if control
+// is set, or the other keywords otherwise.
+func keywords(control bool) []string {
+	var names []string
+	for _, tok := range tokens(token.Token.IsKeyword) {
+		if controlKeywords[tok] == control {
+			names = append(names, tok.String())
+		}
+	}
+	return names
+}
+
+// isDelimiter reports whether tok is a delimiter, as opposed to an operator.
+func isDelimiter(tok token.Token) bool {
+	return token.LPAREN <= tok && tok <= token.COLON
+}
+
+// operators returns the operators, excluding delimiters such as parentheses.
+// Longer operators come first, so that an alternation of them matches += as a
+// whole rather than as + followed by =.
+func operators() []string {
+	var ops []string
+	for _, tok := range tokens(token.Token.IsOperator) {
+		if !isDelimiter(tok) {
+			ops = append(ops, tok.String())
+		}
+	}
+	sort.SliceStable(ops, func(i, j int) bool {
+		return len(ops[i]) > len(ops[j])
+	})
+	return ops
+}
+
+// predeclared returns the names of the predeclared types (including
+// comparable), functions and constants (including nil).
+func predeclared() (typeNames, funcs, consts []string) {
+	for _, name := range types.Universe.Names() {
+		switch types.Universe.Lookup(name).(type) {
+		case *types.TypeName:
+			typeNames = append(typeNames, name)
+		case *types.Builtin:
+			funcs = append(funcs, name)
+		case *types.Const, *types.Nil:
+			consts = append(consts, name)
+		}
+	}
+	return typeNames, funcs, consts
+}
+
+// words returns a regular expression which matches any of names as a whole
+// word.
+func words(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = regexp.QuoteMeta(name)
+	}
+	return `\b(` + strings.Join(quoted, "|") + `)\b`
+}
@@ -0,0 +1,107 @@
+package grammar
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/qProust/fo/token"
+)
+
+func TestTextMate(t *testing.T) {
+	var g textMateGrammar
+	if err := json.Unmarshal(TextMate(), &g); err != nil {
+		t.Fatalf("invalid JSON: %s", err)
+	}
+
+	// The regular expressions use the subset of the Oniguruma syntax which is
+	// understood by the regexp package as well.
+	compile := func(name string) *regexp.Regexp {
+		t.Helper()
+		r, err := regexp.Compile(g.Repository[name].Match)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		return r
+	}
+	var matchers []*regexp.Regexp
+	for _, rule := range g.Repository["declarations"].Patterns {
+		r, err := regexp.Compile(rule.Match)
+		if err != nil {
+			t.Fatal(err)
+		}
+		matchers = append(matchers, r)
+	}
+	for _, test := range []struct {
+		line     string
+		captures []string
+	}{
+		{"type Color enum {", []string{"type", "Color", "enum"}},
+		{"type Pair[K comparable, V] struct {", []string{"type", "Pair", ""}},
+		{"\tColor enum {", []string{"Color", "enum"}},
+		{"func Map[T, U](xs []T, f func(T) U) []U {", []string{"func", "Map"}},
+		{"func (b Box[T]) Map[U](f func(T) U) Box[U] {", []string{"func", "Map"}},
+	} {
+		var got []string
+		for _, r := range matchers {
+			if m := r.FindStringSubmatch(test.line); m != nil {
+				got = m[1:]
+				break
+			}
+		}
+		if !reflect.DeepEqual(got, test.captures) {
+			t.Errorf("%q: expected captures %q, got %q", test.line, test.captures, got)
+		}
+	}
+
+	operators := compile("operators")
+	for _, tok := range tokens(token.Token.IsOperator) {
+		if isDelimiter(tok) {
+			continue
+		}
+		if got := operators.FindString(tok.String()); got != tok.String() {
+			t.Errorf("operator %s: matched %q", tok, got)
+		}
+	}
+
+	var keywords []string
+	for _, rule := range g.Repository["keywords"].Patterns {
+		keywords = append(keywords, rule.Match)
+	}
+	for _, tok := range tokens(token.Token.IsKeyword) {
+		matched := 0
+		for _, k := range keywords {
+			if regexp.MustCompile(k).MatchString(tok.String()) {
+				matched++
+			}
+		}
+		if matched != 1 {
+			t.Errorf("keyword %s is matched by %d rules, expected 1", tok, matched)
+		}
+	}
+
+	numbers := compile("numbers")
+	for _, lit := range []string{"42", "0x2A", "1.5", "1e-3", "2i", ".5"} {
+		if got := numbers.FindString(lit); got != lit {
+			t.Errorf("number %s: matched %q", lit, got)
+		}
+	}
+}
+
+func TestTreeSitter(t *testing.T) {
+	files := TreeSitter()
+	if len(files) != 2 {
+		t.Errorf("expected 2 files, got %d", len(files))
+	}
+	if !strings.Contains(string(files["grammar.js"]), "'enum',") {
+		t.Errorf("grammar.js does not declare the enum keyword")
+	}
+	highlights := string(files["queries/highlights.scm"])
+	for _, name := range []string{`"func"`, `"range"`, `"enum"`, `"&^="`, `(nil)`, `"comparable"`, `"append"`} {
+		if !strings.Contains(highlights, name) {
+			t.Errorf("highlights.scm does not contain %s", name)
+		}
+	}
+}
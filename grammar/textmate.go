@@ -0,0 +1,134 @@
+package grammar
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// A rule is a TextMate grammar rule. Either Match or Begin and End are set,
+// or Include refers to a rule of the repository.
+type rule struct {
+	Name     string          `json:"name,omitempty"`
+	Match    string          `json:"match,omitempty"`
+	Begin    string          `json:"begin,omitempty"`
+	End      string          `json:"end,omitempty"`
+	Captures map[string]rule `json:"captures,omitempty"`
+	Include  string          `json:"include,omitempty"`
+	Patterns []rule          `json:"patterns,omitempty"`
+}
+
+type textMateGrammar struct {
+	Name       string          `json:"name"`
+	ScopeName  string          `json:"scopeName"`
+	FileTypes  []string        `json:"fileTypes"`
+	Patterns   []rule          `json:"patterns"`
+	Repository map[string]rule `json:"repository"`
+}
+
+// identifier matches a Fo identifier.
+const identifier = `[\p{L}_][\p{L}\p{Nd}_]*`
+
+// captures returns the captures of a rule which assign names to the groups of
+// its regular expression in order.
+func captures(names ...string) map[string]rule {
+	c := map[string]rule{}
+	for i, name := range names {
+		c[string('1'+rune(i))] = rule{Name: name}
+	}
+	return c
+}
+
+// TextMate returns a TextMate grammar for .fo files in JSON, with the scope
+// name source.fo.
+func TextMate() []byte {
+	typeNames, funcs, consts := predeclared()
+	var ops []string
+	for _, op := range operators() {
+		ops = append(ops, regexp.QuoteMeta(op))
+	}
+	g := textMateGrammar{
+		Name:      "Fo",
+		ScopeName: "source.fo",
+		FileTypes: []string{"fo"},
+		Patterns: []rule{
+			{Include: "#comments"},
+			{Include: "#strings"},
+			{Include: "#declarations"},
+			{Include: "#keywords"},
+			{Include: "#predeclared"},
+			{Include: "#numbers"},
+			{Include: "#operators"},
+		},
+		Repository: map[string]rule{
+			"comments": {Patterns: []rule{
+				{Name: "comment.block.fo", Begin: `/\*`, End: `\*/`},
+				{Name: "comment.line.double-slash.fo", Match: `//.*$`},
+			}},
+			"strings": {Patterns: []rule{
+				{
+					Name:     "string.quoted.double.fo",
+					Begin:    `"`,
+					End:      `"`,
+					Patterns: []rule{{Include: "#escapes"}},
+				},
+				{Name: "string.quoted.raw.fo", Begin: "`", End: "`"},
+				{
+					Name:     "string.quoted.single.fo",
+					Begin:    `'`,
+					End:      `'`,
+					Patterns: []rule{{Include: "#escapes"}},
+				},
+			}},
+			"escapes": {
+				Name:  "constant.character.escape.fo",
+				Match: `\\([abfnrtv\\'"]|[0-7]{3}|x[0-9A-Fa-f]{2}|u[0-9A-Fa-f]{4}|U[0-9A-Fa-f]{8})`,
+			},
+			"declarations": {Patterns: []rule{
+				{
+					// type Color enum { ... } and type Pair[K comparable, V] ...
+					Match:    `\b(type)\s+(` + identifier + `)(?:\s+(enum)\b)?`,
+					Captures: captures("keyword.other.fo", "entity.name.type.fo", "keyword.other.enum.fo"),
+				},
+				{
+					// Color enum { ... } in a group of type declarations.
+					Match:    `^\s*(` + identifier + `)\s+(enum)\b`,
+					Captures: captures("entity.name.type.fo", "keyword.other.enum.fo"),
+				},
+				{
+					// Functions and methods, including generic ones: func F[T](...),
+					// func (r R[T]) M[U](...).
+					Match:    `\b(func)\s+(?:\([^)]*\)\s*)?(` + identifier + `)`,
+					Captures: captures("keyword.other.fo", "entity.name.function.fo"),
+				},
+			}},
+			"keywords": {Patterns: []rule{
+				{Name: "keyword.control.fo", Match: words(keywords(true))},
+				{Name: "keyword.other.fo", Match: words(keywords(false))},
+			}},
+			"predeclared": {Patterns: []rule{
+				{Name: "support.type.builtin.fo", Match: words(typeNames)},
+				{Name: "support.function.builtin.fo", Match: words(funcs)},
+				{Name: "constant.language.fo", Match: words(consts)},
+			}},
+			"numbers": {
+				Name:  "constant.numeric.fo",
+				Match: `\b(0[xX][0-9A-Fa-f]+|[0-9]+(\.[0-9]*)?([eE][+-]?[0-9]+)?i?)\b|\.[0-9]+([eE][+-]?[0-9]+)?i?\b`,
+			},
+			"operators": {
+				Name:  "keyword.operator.fo",
+				Match: strings.Join(ops, "|"),
+			},
+		},
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(g); err != nil {
+		// The grammar consists of strings, slices and maps only.
+		panic(err)
+	}
+	return buf.Bytes()
+}
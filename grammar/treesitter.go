@@ -0,0 +1,153 @@
+package grammar
+
+import (
+	"fmt"
+	"strings"
+)
+
+// treeSitterGrammar extends the grammar of Go from
+// https://github.com/tree-sitter/tree-sitter-go (version 0.21.0 or later) with
+// the syntax of Fo.
+const treeSitterGrammar = `// Code generated by fo tooling grammar. DO NOT EDIT.
+
+// The grammar of Fo extends the grammar of Go, so tree-sitter-go must be
+// installed (npm install tree-sitter-go) before the parser is generated.
+const go = require('tree-sitter-go/grammar');
+
+module.exports = grammar(go, {
+  name: 'fo',
+
+  rules: {
+    // In Fo, the constraint of a type parameter is optional and only applies to
+    // the type parameter it follows: [K comparable, V].
+    type_parameter_declaration: $ => seq(
+      field('name', $.identifier),
+      optional(field('type', alias($.type_elem, $.type_constraint))),
+    ),
+
+    // type Color enum { Red; Green; Blue }
+    type_spec: ($, original) => choice(
+      original,
+      seq(field('name', $._type_identifier), field('type', $.enum_type)),
+    ),
+
+    enum_type: $ => seq(
+      '%s',
+      '{',
+      repeat(seq(field('value', $.identifier), optional(choice(',', ';', '\n')))),
+      '}',
+    ),
+
+    // Methods can have type parameters of their own: func (b Box[T]) Map[U](...).
+    method_declaration: $ => prec.right(1, seq(
+      'func',
+      field('receiver', $.parameter_list),
+      field('name', $._field_identifier),
+      optional(field('type_parameters', $.type_parameter_list)),
+      field('parameters', $.parameter_list),
+      optional(field('result', choice($.parameter_list, $._simple_type))),
+      optional(field('body', $.block)),
+    )),
+
+    method_elem: $ => seq(
+      field('name', $._field_identifier),
+      optional(field('type_parameters', $.type_parameter_list)),
+      field('parameters', $.parameter_list),
+      optional(field('result', choice($.parameter_list, $._simple_type))),
+    ),
+  },
+});
+`
+
+// treeSitterHighlights is the format of the highlights query of the tree-sitter
+// grammar. The keywords and predeclared identifiers are filled in.
+const treeSitterHighlights = `; Code generated by fo tooling grammar. DO NOT EDIT.
+
+(comment) @comment
+
+[
+  (interpreted_string_literal)
+  (raw_string_literal)
+  (rune_literal)
+] @string
+
+(escape_sequence) @string.escape
+
+[
+  (int_literal)
+  (float_literal)
+  (imaginary_literal)
+] @number
+
+[
+%s
+] @keyword
+
+[
+%s
+] @keyword.control
+
+[
+%s
+] @operator
+
+[
+%s
+] @constant.builtin
+
+((type_identifier) @type.builtin
+  (#any-of? @type.builtin %s))
+
+((identifier) @function.builtin
+  (#any-of? @function.builtin %s))
+
+(type_spec name: (type_identifier) @type.definition)
+(type_parameter_declaration name: (identifier) @type.parameter)
+(enum_type value: (identifier) @constant)
+
+(function_declaration name: (identifier) @function)
+(method_declaration name: (field_identifier) @function.method)
+(method_elem name: (field_identifier) @function.method)
+(call_expression function: (identifier) @function.call)
+(call_expression function: (selector_expression field: (field_identifier) @function.method.call))
+`
+
+// TreeSitter returns the files of a tree-sitter grammar of Fo by slash
+// separated name: grammar.js, which extends the tree-sitter grammar of Go, and
+// queries/highlights.scm.
+func TreeSitter() map[string][]byte {
+	typeNames, funcs, consts := predeclared()
+	nodes := make([]string, len(consts))
+	for i, name := range consts {
+		// tree-sitter-go has a node type for each predeclared constant.
+		nodes[i] = "(" + name + ")"
+	}
+	highlights := fmt.Sprintf(treeSitterHighlights,
+		list(append(keywords(false), contextualKeywords...), true),
+		list(keywords(true), true),
+		list(operators(), true),
+		list(nodes, false),
+		strings.Join(quote(typeNames), " "),
+		strings.Join(quote(funcs), " "))
+	return map[string][]byte{
+		"grammar.js":             []byte(fmt.Sprintf(treeSitterGrammar, contextualKeywords[0])),
+		"queries/highlights.scm": []byte(highlights),
+	}
+}
+
+// quote returns names as strings of a tree-sitter query.
+func quote(names []string) []string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = fmt.Sprintf("%q", name)
+	}
+	return quoted
+}
+
+// list returns the elements of a list of a tree-sitter query, one per line.
+func list(elems []string, quoted bool) string {
+	if quoted {
+		elems = quote(elems)
+	}
+	return "  " + strings.Join(elems, "\n  ")
+}
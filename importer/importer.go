@@ -10,6 +10,7 @@ import (
 	"go/build"
 	"io"
 	"runtime"
+	"sync"
 
 	"github.com/qProust/fo/token"
 	"github.com/qProust/fo/types"
@@ -75,6 +76,10 @@ func For(compiler string, lookup Lookup) types.Importer {
 
 // Default returns an Importer for the compiler that built the running binary.
 // If available, the result implements types.ImporterFrom.
+//
+// The importers for installed packages remember the packages they imported,
+// so each package is only read once if the same importer is used for all of
+// the packages of a program, and they are safe for concurrent use.
 func Default() types.Importer {
 	return For(runtime.Compiler, nil)
 }
@@ -82,6 +87,7 @@ func Default() types.Importer {
 // gc importer
 
 type gcimports struct {
+	mu       sync.Mutex // guards packages
 	packages map[string]*types.Package
 	lookup   Lookup
 }
@@ -94,12 +100,15 @@ func (m *gcimports) ImportFrom(path, srcDir string, mode types.ImportMode) (*typ
 	if mode != 0 {
 		panic("mode must be 0")
 	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	return gcimporter.Import(m.packages, path, srcDir, m.lookup)
 }
 
 // gccgo importer
 
 type gccgoimports struct {
+	mu       sync.Mutex // guards packages
 	packages map[string]*types.Package
 	importer gccgoimporter.Importer
 	lookup   Lookup
@@ -113,5 +122,7 @@ func (m *gccgoimports) ImportFrom(path, srcDir string, mode types.ImportMode) (*
 	if mode != 0 {
 		panic("mode must be 0")
 	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	return m.importer(m.packages, path, srcDir, m.lookup)
 }
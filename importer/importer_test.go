@@ -10,9 +10,11 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/qProust/fo/internal/testenv"
+	"github.com/qProust/fo/types"
 )
 
 func TestFor(t *testing.T) {
@@ -67,4 +69,28 @@ func TestFor(t *testing.T) {
 			t.Fatalf("Path() = %q, want %q", pkg.Path(), "math/bigger")
 		}
 	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		imp := For(compiler, nil)
+		pkgs := make([]*types.Package, 8)
+		errs := make([]error, len(pkgs))
+		var wg sync.WaitGroup
+		for i := range pkgs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				pkgs[i], errs[i] = imp.Import(thePackage)
+			}(i)
+		}
+		wg.Wait()
+		for i, pkg := range pkgs {
+			if errs[i] != nil {
+				t.Fatal(errs[i])
+			}
+			// The package is only imported once.
+			if pkg != pkgs[0] {
+				t.Fatalf("got different packages for %s", thePackage)
+			}
+		}
+	})
 }
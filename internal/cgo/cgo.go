@@ -53,10 +53,7 @@ package cgo
 
 import (
 	"fmt"
-	"go/ast"
 	"go/build"
-	"go/parser"
-	"github.com/qProust/fo/token"
 	"io/ioutil"
 	"log"
 	"os"
@@ -64,6 +61,10 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+
+	"github.com/qProust/fo/ast"
+	"github.com/qProust/fo/parser"
+	"github.com/qProust/fo/token"
 )
 
 // ProcessFiles invokes the cgo preprocessor on bp.CgoFiles, parses
@@ -1025,6 +1025,12 @@ func predeclared() []types.Type {
 
 			// used internally by gc; never used by this package or in .a files
 			anyType{},
+
+			// comparable (Go 1.18 and later)
+			types.Universe.Lookup("comparable").Type(),
+
+			// any (Go 1.18 and later), which is not predeclared in Fo
+			types.NewInterface(nil, nil).Complete(),
 		}
 	}
 	return predecl
@@ -18,6 +18,7 @@ import (
 	"github.com/qProust/fo/types"
 	"io"
 	"sort"
+	"strings"
 )
 
 type intReader struct {
@@ -56,6 +57,16 @@ const (
 	signatureType
 	structType
 	interfaceType
+	typeParamType
+	instanceType
+	unionType
+)
+
+// Export data versions.
+const (
+	iexportVersionGo1_11   = 0
+	iexportVersionPosCol   = 1
+	iexportVersionGenerics = 2 // Go 1.18
 )
 
 // IImportData imports a package from the serialized package data
@@ -63,7 +74,7 @@ const (
 // If the export data version is not recognized or the format is otherwise
 // compromised, an error is returned.
 func IImportData(fset *token.FileSet, imports map[string]*types.Package, data []byte, path string) (_ int, pkg *types.Package, err error) {
-	const currentVersion = 0
+	const currentVersion = iexportVersionGenerics
 	version := -1
 	defer func() {
 		if e := recover(); e != nil {
@@ -79,7 +90,7 @@ func IImportData(fset *token.FileSet, imports map[string]*types.Package, data []
 
 	version = int(r.uint64())
 	switch version {
-	case currentVersion:
+	case iexportVersionGo1_11, iexportVersionPosCol, iexportVersionGenerics:
 	default:
 		errorf("unknown iexport format version %d", version)
 	}
@@ -93,15 +104,17 @@ func IImportData(fset *token.FileSet, imports map[string]*types.Package, data []
 	r.Seek(sLen+dLen, io.SeekCurrent)
 
 	p := iimporter{
-		ipath: path,
+		ipath:   path,
+		version: version,
 
 		stringData:  stringData,
 		stringCache: make(map[uint64]string),
 		pkgCache:    make(map[uint64]*types.Package),
 
-		declData: declData,
-		pkgIndex: make(map[*types.Package]map[string]uint64),
-		typCache: make(map[uint64]types.Type),
+		declData:    declData,
+		pkgIndex:    make(map[*types.Package]map[string]uint64),
+		typCache:    make(map[uint64]types.Type),
+		tparamIndex: make(map[ident]*types.TypeParam),
 
 		fake: fakeFileSet{
 			fset:  fset,
@@ -162,6 +175,13 @@ func IImportData(fset *token.FileSet, imports map[string]*types.Package, data []
 		typ.Complete()
 	}
 
+	// Constraints can only be examined once the types they embed are complete.
+	for _, c := range p.later {
+		if isComparable(c.constraint) {
+			c.t.SetConstraint(types.Universe.Lookup("comparable").Type())
+		}
+	}
+
 	// record all referenced packages as imports
 	list := append(([]*types.Package)(nil), pkgList[1:]...)
 	sort.Sort(byPath(list))
@@ -175,18 +195,34 @@ func IImportData(fset *token.FileSet, imports map[string]*types.Package, data []
 }
 
 type iimporter struct {
-	ipath string
+	ipath   string
+	version int
 
 	stringData  []byte
 	stringCache map[uint64]string
 	pkgCache    map[uint64]*types.Package
 
-	declData []byte
-	pkgIndex map[*types.Package]map[string]uint64
-	typCache map[uint64]types.Type
+	declData    []byte
+	pkgIndex    map[*types.Package]map[string]uint64
+	typCache    map[uint64]types.Type
+	tparamIndex map[ident]*types.TypeParam
 
 	fake          fakeFileSet
 	interfaceList []*types.Interface
+	later         []setConstraintArgs
+}
+
+// An ident identifies a type parameter in the export data.
+type ident struct {
+	pkg  *types.Package
+	name string
+}
+
+// setConstraintArgs records the constraint of a type parameter until it can be
+// examined.
+type setConstraintArgs struct {
+	t          *types.TypeParam
+	constraint types.Type
 }
 
 func (p *iimporter) doDecl(pkg *types.Package, name string) {
@@ -194,6 +230,9 @@ func (p *iimporter) doDecl(pkg *types.Package, name string) {
 	if obj := pkg.Scope().Lookup(name); obj != nil {
 		return
 	}
+	if _, ok := p.tparamIndex[ident{pkg, name}]; ok {
+		return
+	}
 
 	off, ok := p.pkgIndex[pkg][name]
 	if !ok {
@@ -255,6 +294,7 @@ type importReader struct {
 	currPkg    *types.Package
 	prevFile   string
 	prevLine   int64
+	prevColumn int64
 }
 
 func (r *importReader) obj(name string) {
@@ -277,6 +317,67 @@ func (r *importReader) obj(name string) {
 
 		r.declare(types.NewFunc(pos, r.currPkg, name, sig))
 
+	case 'G':
+		tparams := r.tparamList()
+		sig := r.signature(nil)
+		genSig := types.NewGenericSignature(nil, sig.Params(), sig.Results(), sig.Variadic(), tparams, nil)
+
+		obj := types.NewGenericFunc(pos, r.currPkg, name, genSig)
+		r.declare(obj)
+		types.AddNativeGeneric(obj)
+
+	case 'U':
+		// As for 'T', but the type parameters must be known before the
+		// underlying type, which may mention them.
+		obj := types.NewTypeName(pos, r.currPkg, name, nil)
+		r.declare(obj)
+		tparams := r.tparamList()
+		named := types.NewGenericNamed(obj, nil, nil, tparams)
+		types.AddNativeGeneric(obj)
+
+		underlying := r.p.typAt(r.uint64(), named.Named).Underlying()
+		named.SetUnderlying(underlying)
+
+		if isInterface(underlying) {
+			break
+		}
+		for n := r.uint64(); n > 0; n-- {
+			mpos := r.pos()
+			mname := r.ident()
+			recv := r.param()
+			msig := r.signature(recv)
+
+			// The receiver is an instance of named whose type arguments are
+			// the type parameters of the method.
+			var rparams []*types.TypeParam
+			if base, ok := deref(recv.Type()).(types.PartialGenericType); ok {
+				for _, tp := range base.GenericType().TypeParams() {
+					rparam, _ := base.TypeMap()[tp.String()].(*types.TypeParam)
+					if rparam == nil {
+						errorf("unexpected type argument for receiver type parameter %s of %s", tp, name)
+					}
+					rparam.SetConstraint(tp.Constraint())
+					rparams = append(rparams, rparam)
+				}
+			}
+			genSig := types.NewGenericSignature(recv, msig.Params(), msig.Results(), msig.Variadic(), nil, rparams)
+
+			m := types.NewGenericFunc(mpos, r.currPkg, mname, genSig)
+			named.AddMethod(m)
+			types.AddNativeGeneric(m)
+		}
+
+	case 'P':
+		// Type parameters are declared as objects so that they can be
+		// referenced (e.g. in their own constraint) before being complete.
+		if r.p.version < iexportVersionGenerics {
+			errorf("unexpected type parameter")
+		}
+		t := types.NewTypeParam(tparamName(name))
+		r.p.tparamIndex[ident{r.currPkg, name}] = t
+		_ = r.bool() // implicit interface; irrelevant for Fo
+		r.p.later = append(r.p.later, setConstraintArgs{t: t, constraint: r.typ()})
+
 	case 'T':
 		// Types can be recursive. We need to setup a stub
 		// declaration before recursing.
@@ -314,6 +415,9 @@ func (r *importReader) declare(obj types.Object) {
 
 func (r *importReader) value() (typ types.Type, val constant.Value) {
 	typ = r.typ()
+	if r.p.version >= iexportVersionGenerics {
+		_ = constant.Kind(r.int64())
+	}
 
 	switch b := typ.Underlying().(*types.Basic); b.Info() & types.IsConstType {
 	case types.IsBoolean:
@@ -448,6 +552,20 @@ func (r *importReader) qualifiedIdent() (*types.Package, string) {
 }
 
 func (r *importReader) pos() token.Pos {
+	if r.p.version >= iexportVersionPosCol {
+		r.posv1()
+	} else {
+		r.posv0()
+	}
+
+	if r.prevFile == "" && r.prevLine == 0 && r.prevColumn == 0 {
+		return token.NoPos
+	}
+
+	return r.p.fake.pos(r.prevFile, int(r.prevLine))
+}
+
+func (r *importReader) posv0() {
 	delta := r.int64()
 	if delta != deltaNewFile {
 		r.prevLine += delta
@@ -457,12 +575,18 @@ func (r *importReader) pos() token.Pos {
 		r.prevFile = r.string()
 		r.prevLine = l
 	}
+}
 
-	if r.prevFile == "" && r.prevLine == 0 {
-		return token.NoPos
+func (r *importReader) posv1() {
+	delta := r.int64()
+	r.prevColumn += delta >> 1
+	if delta&1 != 0 {
+		delta = r.int64()
+		r.prevLine += delta >> 1
+		if delta&1 != 0 {
+			r.prevFile = r.string()
+		}
 	}
-
-	return r.p.fake.pos(r.prevFile, int(r.prevLine))
 }
 
 func (r *importReader) typ() types.Type {
@@ -548,7 +672,98 @@ func (r *importReader) doType(base *types.Named) types.Type {
 		typ := newInterface(methods, embeddeds)
 		r.p.interfaceList = append(r.p.interfaceList, typ)
 		return typ
+
+	case typeParamType:
+		if r.p.version < iexportVersionGenerics {
+			errorf("unexpected type parameter type")
+		}
+		pkg, name := r.qualifiedIdent()
+		id := ident{pkg, name}
+		if t, ok := r.p.tparamIndex[id]; ok {
+			// We're already in the process of importing this type parameter.
+			return t
+		}
+		r.p.doDecl(pkg, name)
+		return r.p.tparamIndex[id]
+
+	case instanceType:
+		if r.p.version < iexportVersionGenerics {
+			errorf("unexpected instantiation type")
+		}
+		// The position does not matter for instances: they are positioned on
+		// the generic type.
+		_ = r.pos()
+		targs := make([]types.Type, r.uint64())
+		for i := range targs {
+			targs[i] = r.typ()
+		}
+		genType, ok := r.typ().(types.GenericType)
+		if !ok {
+			errorf("instantiation of non-generic type in %q", r.p.ipath)
+		}
+		t, err := types.Instantiate(genType, targs)
+		if err != nil {
+			errorf("%v", err)
+		}
+		return t
+
+	case unionType:
+		// Unions only occur in constraints other than comparable, which Fo
+		// can't express, so they are imported as the empty interface.
+		if r.p.version < iexportVersionGenerics {
+			errorf("unexpected union type")
+		}
+		for n := r.uint64(); n > 0; n-- {
+			_ = r.bool() // tilde
+			_ = r.typ()
+		}
+		return types.NewInterface(nil, nil).Complete()
+	}
+}
+
+// tparamName returns the name of a type parameter without the prefix which
+// makes it unique in the export data (e.g. "Map.T" for the T of Map).
+func tparamName(exportName string) string {
+	i := strings.LastIndex(exportName, ".")
+	if i < 0 {
+		errorf("malformed type parameter export name %s: missing prefix", exportName)
+	}
+	name := exportName[i+1:]
+	if strings.HasPrefix(name, "$") {
+		return "_"
+	}
+	return name
+}
+
+// isComparable reports whether the constraint c is or embeds the predeclared
+// comparable. Fo has no other constraints, so all others are dropped and the
+// Go compiler checks them instead.
+func isComparable(c types.Type) bool {
+	if c == types.Universe.Lookup("comparable").Type() {
+		return true
+	}
+	iface, ok := c.(*types.Interface)
+	if !ok {
+		return false
+	}
+	for i := 0; i < iface.NumEmbeddeds(); i++ {
+		if isComparable(iface.EmbeddedType(i)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *importReader) tparamList() []*types.TypeParam {
+	xs := make([]*types.TypeParam, r.uint64())
+	for i := range xs {
+		t, ok := r.typ().(*types.TypeParam)
+		if !ok {
+			errorf("type parameter expected in %q", r.p.ipath)
+		}
+		xs[i] = t
 	}
+	return xs
 }
 
 func (r *importReader) kind() itag {
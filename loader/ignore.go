@@ -0,0 +1,159 @@
+package loader
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreFile is the name of the files which list, one pattern per line, the
+// files and directories to be skipped by Load in the directory containing
+// the file and below it. The patterns have the syntax of .gitignore files:
+//
+//   - blank lines and lines starting with # are ignored;
+//   - a pattern starting with ! includes again what a previous pattern
+//     excluded (though not in a directory which is excluded as a whole);
+//   - a pattern ending with / only matches directories;
+//   - a pattern which contains a / elsewhere is matched against the path
+//     relative to the directory of the IgnoreFile, otherwise against the
+//     name of the file or directory at any depth;
+//   - *, ? and [...] are as in path.Match, and ** matches any number of
+//     directories.
+//
+// The patterns of an IgnoreFile in a subdirectory take precedence over those
+// of its parents, and within a file the last matching pattern wins.
+const IgnoreFile = ".foignore"
+
+// skipDir reports whether Load skips the directory with the given name
+// regardless of the ignore files: like the go command, it skips testdata and
+// vendor directories and those whose name starts with . or _, such as .git.
+// It also skips node_modules, which can contain .fo files of unrelated
+// projects.
+func skipDir(name string) bool {
+	switch name {
+	case "testdata", "vendor", "node_modules":
+		return true
+	}
+	return strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")
+}
+
+// ignoreRules holds the patterns of the IgnoreFile of a directory, if any,
+// along with the rules of its parent directories.
+type ignoreRules struct {
+	parent   *ignoreRules
+	dir      string
+	patterns []ignorePattern
+}
+
+type ignorePattern struct {
+	pattern  string // pattern without !, leading and trailing /
+	negate   bool   // pattern starts with !
+	dirOnly  bool   // pattern ends with /
+	anchored bool   // pattern is relative to the directory of the IgnoreFile
+}
+
+// readIgnoreRules returns the rules which apply in dir: those of parent
+// followed by the patterns of the IgnoreFile in dir, if there is one.
+func readIgnoreRules(dir string, parent *ignoreRules) (*ignoreRules, error) {
+	filename := filepath.Join(dir, IgnoreFile)
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return parent, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rules := &ignoreRules{parent: parent, dir: dir}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), " \t\r")
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		var p ignorePattern
+		if strings.HasPrefix(text, "!") {
+			p.negate = true
+			text = text[1:]
+		} else if strings.HasPrefix(text, `\`) {
+			// \# and \! escape the special meaning of the first character.
+			text = text[1:]
+		}
+		if strings.HasSuffix(text, "/") {
+			p.dirOnly = true
+			text = strings.TrimRight(text, "/")
+		}
+		p.anchored = strings.Contains(text, "/")
+		p.pattern = strings.TrimPrefix(text, "/")
+		if _, err := path.Match(p.pattern, ""); err != nil || p.pattern == "" {
+			return nil, fmt.Errorf("%s:%d: invalid pattern %q", filename, line, scanner.Text())
+		}
+		rules.patterns = append(rules.patterns, p)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// ignored reports whether the file or directory p is excluded by rules.
+func (rules *ignoreRules) ignored(p string, isDir bool) bool {
+	var chain []*ignoreRules
+	for r := rules; r != nil; r = r.parent {
+		chain = append(chain, r)
+	}
+	ignored := false
+	for i := len(chain) - 1; i >= 0; i-- {
+		r := chain[i]
+		rel, err := filepath.Rel(r.dir, p)
+		if err != nil {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		for _, pattern := range r.patterns {
+			if pattern.dirOnly && !isDir {
+				continue
+			}
+			if pattern.match(rel) {
+				ignored = !pattern.negate
+			}
+		}
+	}
+	return ignored
+}
+
+// match reports whether rel matches the pattern, where rel is the slash
+// separated path of a file relative to the directory of the IgnoreFile.
+func (p ignorePattern) match(rel string) bool {
+	if !p.anchored {
+		matched, _ := path.Match(p.pattern, path.Base(rel))
+		return matched
+	}
+	return matchSegments(strings.Split(p.pattern, "/"), strings.Split(rel, "/"))
+}
+
+// matchSegments reports whether the path segments names match the pattern
+// segments patterns, where a ** segment matches any number of names.
+func matchSegments(patterns, names []string) bool {
+	for len(patterns) > 0 {
+		if patterns[0] == "**" {
+			for i := 0; i <= len(names); i++ {
+				if matchSegments(patterns[1:], names[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(names) == 0 {
+			return false
+		}
+		if matched, _ := path.Match(patterns[0], names[0]); !matched {
+			return false
+		}
+		patterns, names = patterns[1:], names[1:]
+	}
+	return len(names) == 0
+}
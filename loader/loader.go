@@ -0,0 +1,605 @@
+// Package loader locates the Fo packages in a directory tree, determines
+// their import paths, and orders them so that every package comes after the
+// packages it imports.
+package loader
+
+import (
+	"bufio"
+	"fmt"
+	"go/build"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/qProust/fo/parser"
+	"github.com/qProust/fo/token"
+)
+
+// MergedFile is the name of the file to which the Go code generated for all
+// of the .fo files of a package is written when they are merged (see the
+// --merge flag of fo build). Like the .go files generated for single .fo
+// files, it is not a source file of the package.
+const MergedFile = "zz_generated.fo.go"
+
+// MergedTestFile is the name of the file to which the Go code generated for
+// an external test package is written when its .fo files are merged. Like
+// the _test.fo files, it is only compiled by go test.
+const MergedTestFile = "zz_generated.fo_test.go"
+
+// A Package describes a directory which contains one or more Fo source files.
+type Package struct {
+	Name       string   // package name from the package clause
+	ImportPath string   // import path of the package
+	Dir        string   // directory containing the package sources
+	FoFiles    []string // .fo source files
+	GoFiles    []string // .go source files which are not generated from a .fo file, excluding CgoFiles
+	CgoFiles   []string // .go source files which import "C"
+	Imports    []string // sorted import paths used by the package sources
+	XTest      bool     // the package is an external test package (see Load)
+
+	// Fset is the file set into which the package sources should be parsed.
+	// It is shared by all packages returned by the same call to Load or
+	// LoadFileSet, so that positions can be related across packages.
+	Fset *token.FileSet
+}
+
+// An ImportCycleError is returned by Load and Sort when the import graph of
+// the loaded packages contains a cycle.
+type ImportCycleError struct {
+	// Cycle is the list of import paths which form the cycle. The first and
+	// last element are always the same.
+	Cycle []string
+}
+
+func (e *ImportCycleError) Error() string {
+	return "import cycle not allowed: " + strings.Join(e.Cycle, " -> ")
+}
+
+// Load walks the directory tree rooted at root and returns every package
+// which contains at least one .fo file. The packages are sorted in dependency
+// order: a package always comes after the packages it imports. If the import
+// graph contains a cycle, Load returns an *ImportCycleError.
+//
+// Like the go command, Load skips files whose name or //go:build lines do not
+// match the target platform, which is given by the GOOS and GOARCH
+// environment variables (see go/build.Default).
+//
+// The _test.fo files of a directory which declare the package of the other
+// files with the suffix _test (e.g. package foo_test next to package foo)
+// form an external test package, like _test.go files do for the go command.
+// It is returned as a package of its own, with XTest set and the import path
+// of the tested package followed by _test, so that it comes after the
+// packages it imports, including the tested one. The other _test.fo files
+// belong to the package of the directory.
+//
+// If root is inside a workspace (i.e. there is a go.work file in root or one
+// of its parents), the modules used by the workspace and the local
+// directories of its replace directives are loaded as well, and the packages
+// in them which are imported (directly or indirectly) by the packages in
+// root are included in the result. As with the go command, the GOWORK
+// environment variable can be used to select a different go.work file or, if
+// it is set to "off", to disable workspace mode.
+func Load(root string) ([]*Package, error) {
+	return LoadFileSet(token.NewFileSet(), root)
+}
+
+// LoadFileSet is like Load but stores fset in the Fset field of each package
+// instead of a new file set.
+func LoadFileSet(fset *token.FileSet, root string) ([]*Package, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	dirs, rules, err := foDirs(root)
+	if err != nil {
+		return nil, err
+	}
+	var extraDirs []string
+	if workFile := findWorkFile(root); workFile != "" {
+		moduleDirs, err := readWorkFile(workFile)
+		if err != nil {
+			return nil, err
+		}
+		for _, moduleDir := range moduleDirs {
+			found, moduleRules, err := foDirs(moduleDir)
+			if err != nil {
+				return nil, err
+			}
+			extraDirs = append(extraDirs, found...)
+			for dir, r := range moduleRules {
+				if _, found := rules[dir]; !found {
+					rules[dir] = r
+				}
+			}
+		}
+	}
+
+	modules := map[string]module{}
+	loaded := map[string]struct{}{}
+	var pkgs, extraPkgs []*Package
+	for i, dir := range append(dirs, extraDirs...) {
+		if _, found := loaded[dir]; found {
+			continue
+		}
+		loaded[dir] = struct{}{}
+		pkg, xtest, err := loadDir(dir, importPath(dir, modules), rules[dir])
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range []*Package{pkg, xtest} {
+			if p == nil {
+				continue
+			}
+			p.Fset = fset
+			if i < len(dirs) {
+				pkgs = append(pkgs, p)
+			} else {
+				extraPkgs = append(extraPkgs, p)
+			}
+		}
+	}
+	return Sort(append(pkgs, imported(pkgs, extraPkgs)...))
+}
+
+// foDirs returns the directories in the tree rooted at root which contain at
+// least one .fo file, along with the ignore rules which apply in each of
+// them (see walkFoFiles).
+func foDirs(root string) ([]string, map[string]*ignoreRules, error) {
+	var dirs []string
+	seen := map[string]struct{}{}
+	rules, err := walkFoFiles(root, func(p string) {
+		dir := filepath.Dir(p)
+		if _, found := seen[dir]; !found {
+			seen[dir] = struct{}{}
+			dirs = append(dirs, dir)
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return dirs, rules, nil
+}
+
+// FoFiles returns the .fo files in the directory tree rooted at root which
+// are not skipped like in Load, i.e. those outside the directories skipped by
+// default and not excluded by an IgnoreFile. Unlike Load, it ignores build
+// constraints, so that tools such as fo fmt see the files of every platform.
+func FoFiles(root string) ([]string, error) {
+	var files []string
+	_, err := walkFoFiles(root, func(p string) {
+		files = append(files, p)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// walkFoFiles calls visit for each .fo file in the tree rooted at root and
+// returns the ignore rules which apply in each directory. Directories which
+// are skipped by default (see skipDir) or excluded by an IgnoreFile are not
+// descended into, and .fo files excluded by an IgnoreFile are not visited.
+func walkFoFiles(root string, visit func(p string)) (map[string]*ignoreRules, error) {
+	rules := map[string]*ignoreRules{}
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			parent := rules[filepath.Dir(p)]
+			if p != root && (skipDir(info.Name()) || parent.ignored(p, true)) {
+				return filepath.SkipDir
+			}
+			rules[p], err = readIgnoreRules(p, parent)
+			return err
+		}
+		if !strings.HasSuffix(p, ".fo") || rules[filepath.Dir(p)].ignored(p, false) {
+			return nil
+		}
+		visit(p)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// imported returns the packages in candidates which are imported, directly or
+// indirectly, by pkgs.
+func imported(pkgs []*Package, candidates []*Package) []*Package {
+	byPath := make(map[string]*Package, len(candidates))
+	for _, pkg := range candidates {
+		byPath[pkg.ImportPath] = pkg
+	}
+	var result []*Package
+	queue := append([]*Package{}, pkgs...)
+	for len(queue) > 0 {
+		pkg := queue[0]
+		queue = queue[1:]
+		for _, path := range pkg.Imports {
+			if dep, found := byPath[path]; found {
+				delete(byPath, path)
+				result = append(result, dep)
+				queue = append(queue, dep)
+			}
+		}
+	}
+	return result
+}
+
+// loadDir reads the package clause and imports of each source file in dir
+// which matches the build constraints of the target platform. The .fo files
+// excluded by rules are left out, as if they did not exist. It returns the
+// package of dir and its external test package, each of which is nil if none
+// of its .fo files match.
+func loadDir(dir string, importPath string, rules *ignoreRules) (*Package, *Package, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	names, err := f.Readdirnames(-1)
+	f.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Strings(names)
+	foBases := map[string]struct{}{}
+	kept := names[:0]
+	for _, name := range names {
+		if strings.HasSuffix(name, ".fo") {
+			if rules.ignored(filepath.Join(dir, name), false) {
+				continue
+			}
+			foBases[strings.TrimSuffix(name, ".fo")] = struct{}{}
+		}
+		kept = append(kept, name)
+	}
+	names = kept
+
+	pkg := &Package{
+		ImportPath: importPath,
+		Dir:        dir,
+	}
+	xtest := &Package{
+		ImportPath: importPath + "_test",
+		Dir:        dir,
+		XTest:      true,
+	}
+	imports := map[*Package]map[string]struct{}{pkg: {}, xtest: {}}
+	fset := token.NewFileSet()
+	for _, name := range names {
+		filename := filepath.Join(dir, name)
+		switch {
+		case strings.HasSuffix(name, ".fo"):
+		case strings.HasSuffix(name, "_test.go"), name == MergedFile:
+			continue
+		case strings.HasSuffix(name, ".go"):
+			if _, generated := foBases[strings.TrimSuffix(name, ".go")]; generated {
+				continue
+			}
+		default:
+			continue
+		}
+		if match, err := matchFile(&build.Default, dir, name); err != nil {
+			return nil, nil, err
+		} else if !match {
+			continue
+		}
+		file, err := parser.ParseFile(fset, filename, nil, parser.ImportsOnly)
+		if err != nil {
+			return nil, nil, err
+		}
+		pkgName := file.Name.Name
+		target := pkg
+		if strings.HasSuffix(name, "_test.fo") && strings.HasSuffix(pkgName, "_test") && pkgName != pkg.Name {
+			// The name of an external test package must be the one of
+			// the package followed by _test.
+			target = xtest
+			pkgName = strings.TrimSuffix(pkgName, "_test")
+		}
+		if pkg.Name == "" {
+			pkg.Name = pkgName
+		} else if pkg.Name != pkgName {
+			return nil, nil, fmt.Errorf("found packages %s and %s in %s", pkg.Name, file.Name.Name, dir)
+		}
+		usesCgo := false
+		for _, spec := range file.Imports {
+			path, err := strconv.Unquote(spec.Path.Value)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: invalid import path %s", fset.Position(spec.Path.Pos()), spec.Path.Value)
+			}
+			// "C" is not a package but the cgo pseudo-package.
+			if path == "C" {
+				usesCgo = true
+				continue
+			}
+			imports[target][path] = struct{}{}
+		}
+		switch {
+		case strings.HasSuffix(name, ".fo"):
+			target.FoFiles = append(target.FoFiles, filename)
+		case usesCgo:
+			pkg.CgoFiles = append(pkg.CgoFiles, filename)
+		default:
+			pkg.GoFiles = append(pkg.GoFiles, filename)
+		}
+	}
+	xtest.Name = pkg.Name + "_test"
+	for _, p := range []*Package{pkg, xtest} {
+		for path := range imports[p] {
+			p.Imports = append(p.Imports, path)
+		}
+		sort.Strings(p.Imports)
+	}
+	if len(pkg.FoFiles) == 0 {
+		pkg = nil
+	}
+	if len(xtest.FoFiles) == 0 {
+		xtest = nil
+	}
+	return pkg, xtest, nil
+}
+
+// matchFile reports whether the file name in dir should be built for ctxt,
+// based on its name (e.g. a _windows or _arm64 suffix) and its //go:build
+// lines. go/build only considers files with extensions known to the go
+// command, so a .fo file is passed to it under the name of the .go file it is
+// transformed into.
+func matchFile(ctxt *build.Context, dir string, name string) (bool, error) {
+	if !strings.HasSuffix(name, ".fo") {
+		return ctxt.MatchFile(dir, name)
+	}
+	foCtxt := *ctxt
+	foCtxt.OpenFile = func(string) (io.ReadCloser, error) {
+		return os.Open(filepath.Join(dir, name))
+	}
+	return foCtxt.MatchFile(dir, strings.TrimSuffix(name, ".fo")+".go")
+}
+
+// Sort returns pkgs in dependency order, so that each package comes after all
+// the packages in pkgs that it imports. Imports of packages not contained in
+// pkgs are ignored. Packages which do not depend on each other are ordered by
+// import path. If the imports form a cycle, Sort returns an
+// *ImportCycleError.
+func Sort(pkgs []*Package) ([]*Package, error) {
+	byPath := make(map[string]*Package, len(pkgs))
+	paths := make([]string, 0, len(pkgs))
+	for _, pkg := range pkgs {
+		byPath[pkg.ImportPath] = pkg
+		paths = append(paths, pkg.ImportPath)
+	}
+	sort.Strings(paths)
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(pkgs))
+	sorted := make([]*Package, 0, len(pkgs))
+	var stack []string
+	var visit func(path string) error
+	visit = func(path string) error {
+		switch state[path] {
+		case visited:
+			return nil
+		case visiting:
+			for i, p := range stack {
+				if p == path {
+					cycle := append([]string{}, stack[i:]...)
+					return &ImportCycleError{Cycle: append(cycle, path)}
+				}
+			}
+		}
+		state[path] = visiting
+		stack = append(stack, path)
+		for _, imp := range byPath[path].Imports {
+			if _, local := byPath[imp]; !local {
+				continue
+			}
+			if err := visit(imp); err != nil {
+				return err
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[path] = visited
+		sorted = append(sorted, byPath[path])
+		return nil
+	}
+	for _, path := range paths {
+		if err := visit(path); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
+
+// A module is a directory containing a go.mod file along with the module path
+// declared in it.
+type module struct {
+	dir  string
+	path string
+}
+
+// findModule looks for a go.mod file in dir or any of its parents and returns
+// the module it declares. Results are cached in modules, which maps
+// directories to their enclosing module. If there is no go.mod file, the
+// zero module is returned.
+func findModule(dir string, modules map[string]module) module {
+	if mod, found := modules[dir]; found {
+		return mod
+	}
+	var mod module
+	if modPath := readModulePath(filepath.Join(dir, "go.mod")); modPath != "" {
+		mod = module{dir: dir, path: modPath}
+	} else if parent := filepath.Dir(dir); parent != dir {
+		mod = findModule(parent, modules)
+	}
+	modules[dir] = mod
+	return mod
+}
+
+// findWorkFile returns the go.work file which applies to dir, or the empty
+// string if there is none. Like the go command, it honors the GOWORK
+// environment variable before looking for a go.work file in dir or any of
+// its parents.
+func findWorkFile(dir string) string {
+	switch gowork := os.Getenv("GOWORK"); gowork {
+	case "off":
+		return ""
+	case "":
+	default:
+		if abs, err := filepath.Abs(gowork); err == nil {
+			return abs
+		}
+		return gowork
+	}
+	for {
+		filename := filepath.Join(dir, "go.work")
+		if info, err := os.Stat(filename); err == nil && !info.IsDir() {
+			return filename
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// readWorkFile returns the module directories named by the use directives of
+// the go.work file at filename, followed by the local directories named by its
+// replace directives. Relative directories are resolved against the directory
+// containing filename.
+func readWorkFile(filename string) ([]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var uses, replaces []string
+	block := ""
+	lineNum := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		verb := block
+		if block == "" {
+			verb, fields = fields[0], fields[1:]
+			if len(fields) == 1 && fields[0] == "(" {
+				block = verb
+				continue
+			}
+		} else if fields[0] == ")" {
+			block = ""
+			continue
+		}
+		switch verb {
+		case "use":
+			if len(fields) != 1 {
+				return nil, fmt.Errorf("%s:%d: usage: use local/dir", filename, lineNum)
+			}
+			uses = append(uses, workDir(filename, fields[0]))
+		case "replace":
+			// Only replacements with a local directory (as opposed to another
+			// module version) refer to Fo sources that need to be loaded.
+			arrow := -1
+			for i, field := range fields {
+				if field == "=>" {
+					arrow = i
+				}
+			}
+			if arrow < 0 || arrow == len(fields)-1 {
+				return nil, fmt.Errorf("%s:%d: usage: replace module/path [v1.2.3] => other/module v1.4 | local/dir", filename, lineNum)
+			}
+			if target := fields[arrow+1]; arrow == len(fields)-2 && isLocalPath(target) {
+				replaces = append(replaces, workDir(filename, target))
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return append(uses, replaces...), nil
+}
+
+// workDir resolves the (possibly quoted) directory dir of a directive in the
+// go.work file at filename.
+func workDir(filename string, dir string) string {
+	if unquoted, err := strconv.Unquote(dir); err == nil {
+		dir = unquoted
+	}
+	dir = filepath.FromSlash(dir)
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(filepath.Dir(filename), dir)
+	}
+	return filepath.Clean(dir)
+}
+
+// isLocalPath reports whether the target of a replace directive is a local
+// directory rather than a module path.
+func isLocalPath(target string) bool {
+	if unquoted, err := strconv.Unquote(target); err == nil {
+		target = unquoted
+	}
+	return filepath.IsAbs(target) || target == "." || target == ".." ||
+		strings.HasPrefix(target, "./") || strings.HasPrefix(target, "../") ||
+		strings.HasPrefix(target, `.\`) || strings.HasPrefix(target, `..\`)
+}
+
+// readModulePath returns the module path declared in the go.mod file at
+// filename, or the empty string if it cannot be read.
+func readModulePath(filename string) string {
+	f, err := os.Open(filename)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		if !strings.HasPrefix(line, "module") {
+			continue
+		}
+		modPath := strings.TrimSpace(strings.TrimPrefix(line, "module"))
+		if unquoted, err := strconv.Unquote(modPath); err == nil {
+			modPath = unquoted
+		}
+		return modPath
+	}
+	return ""
+}
+
+// importPath returns the import path for the package in dir. It is derived
+// from the enclosing module if there is one, then from GOPATH. As a last
+// resort the slash-separated directory path is used.
+func importPath(dir string, modules map[string]module) string {
+	if mod := findModule(dir, modules); mod.path != "" {
+		if rel, err := filepath.Rel(mod.dir, dir); err == nil && !strings.HasPrefix(rel, "..") {
+			return path.Join(mod.path, filepath.ToSlash(rel))
+		}
+	}
+	for _, gopath := range filepath.SplitList(build.Default.GOPATH) {
+		src := filepath.Join(gopath, "src")
+		if rel, err := filepath.Rel(src, dir); err == nil && !strings.HasPrefix(rel, "..") {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return filepath.ToSlash(dir)
+}
@@ -0,0 +1,510 @@
+package loader
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/qProust/fo/loader/loadertest"
+	"github.com/qProust/fo/token"
+)
+
+func importPaths(pkgs []*Package) []string {
+	paths := []string{}
+	for _, pkg := range pkgs {
+		paths = append(paths, pkg.ImportPath)
+	}
+	return paths
+}
+
+func TestLoadDependencyOrder(t *testing.T) {
+	root, cleanup := loadertest.WriteTree(t, map[string]string{
+		"go.mod":     "module example.com/app\n",
+		"a/a.fo":     "package a\n\nimport \"example.com/app/c\"\n\nvar _ = c.X\n",
+		"b/b.fo":     "package b\n\nimport (\n\t\"fmt\"\n\t\"example.com/app/a\"\n)\n",
+		"c/c.fo":     "package c\n\nconst X = 1\n",
+		"c/c.go":     "package c\n\nconst X = 1\n",
+		"c/extra.go": "package c\n\nimport \"strings\"\n",
+		"main.fo":    "package main\n\nimport \"example.com/app/b\"\n",
+		"docs/x.txt": "not a package",
+	})
+	defer cleanup()
+	merged := filepath.Join(root, "c", MergedFile)
+	if err := ioutil.WriteFile(merged, []byte("package c\n\nimport \"bytes\"\n\nconst X = 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pkgs, err := Load(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"example.com/app/c",
+		"example.com/app/a",
+		"example.com/app/b",
+		"example.com/app",
+	}
+	if got := importPaths(pkgs); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("wrong package order (expected %v but got %v)", expected, got)
+	}
+
+	c := pkgs[0]
+	if c.Name != "c" {
+		t.Errorf("wrong package name (expected c but got %s)", c.Name)
+	}
+	if expected := []string{filepath.Join(root, "c", "c.fo")}; !reflect.DeepEqual(c.FoFiles, expected) {
+		t.Errorf("wrong .fo files (expected %v but got %v)", expected, c.FoFiles)
+	}
+	// c.go is generated from c.fo and the merged file from all .fo files of
+	// c, so only extra.go should be included.
+	if expected := []string{filepath.Join(root, "c", "extra.go")}; !reflect.DeepEqual(c.GoFiles, expected) {
+		t.Errorf("wrong .go files (expected %v but got %v)", expected, c.GoFiles)
+	}
+	if expected := []string{"strings"}; !reflect.DeepEqual(c.Imports, expected) {
+		t.Errorf("wrong imports (expected %v but got %v)", expected, c.Imports)
+	}
+}
+
+func TestLoadCgo(t *testing.T) {
+	root, cleanup := loadertest.WriteTree(t, map[string]string{
+		"go.mod":  "module example.com/cgo\n",
+		"a.fo":    "package a\n\nfunc Twice() int { return 2 * add(1, 2) }\n",
+		"add.go":  "package a\n\n// int add(int a, int b) { return a + b; }\nimport \"C\"\n\nfunc add(a, b int) int { return int(C.add(C.int(a), C.int(b))) }\n",
+		"util.go": "package a\n\nimport \"strings\"\n\nvar _ = strings.ToUpper\n",
+	})
+	defer cleanup()
+
+	pkgs, err := Load(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkgs) != 1 {
+		t.Fatalf("expected 1 package but got %d", len(pkgs))
+	}
+	pkg := pkgs[0]
+	if expected := []string{filepath.Join(root, "util.go")}; !reflect.DeepEqual(pkg.GoFiles, expected) {
+		t.Errorf("wrong .go files (expected %v but got %v)", expected, pkg.GoFiles)
+	}
+	if expected := []string{filepath.Join(root, "add.go")}; !reflect.DeepEqual(pkg.CgoFiles, expected) {
+		t.Errorf("wrong cgo files (expected %v but got %v)", expected, pkg.CgoFiles)
+	}
+	// "C" is not a real package, so it is not an import.
+	if expected := []string{"strings"}; !reflect.DeepEqual(pkg.Imports, expected) {
+		t.Errorf("wrong imports (expected %v but got %v)", expected, pkg.Imports)
+	}
+}
+
+func TestLoadBuildConstraints(t *testing.T) {
+	otherOS := "plan9"
+	if runtime.GOOS == otherOS {
+		otherOS = "linux"
+	}
+	root, cleanup := loadertest.WriteTree(t, map[string]string{
+		"go.mod":                        "module example.com/app\n",
+		"a/a.fo":                        "package a\n",
+		"a/a_" + runtime.GOOS + ".fo":   "package a\n\nimport \"strings\"\n",
+		"a/a_" + otherOS + ".fo":        "package a\n\nimport \"example.com/app/b\"\n",
+		"a/ignored.fo":                  "//go:build ignore\n\npackage main\n",
+		"a/tagged.go":                   "//go:build " + runtime.GOOS + "\n\npackage a\n",
+		"a/other.go":                    "//go:build " + otherOS + "\n\npackage a\n",
+		"b/b_" + otherOS + ".fo":        "package b\n",
+		"c/c.fo":                        "package c\n",
+		"c/c_" + otherOS + "_amd64.fo":  "package c\n\nimport \"fmt\"\n",
+		"c/c_" + runtime.GOARCH + ".fo": "//go:build !" + runtime.GOARCH + "\n\npackage c\n",
+	})
+	defer cleanup()
+
+	pkgs, err := Load(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// b has no .fo files for the target platform.
+	expected := []string{"example.com/app/a", "example.com/app/c"}
+	if got := importPaths(pkgs); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("wrong packages (expected %v but got %v)", expected, got)
+	}
+	a, c := pkgs[0], pkgs[1]
+	if expected := []string{filepath.Join(root, "a", "a.fo"), filepath.Join(root, "a", "a_"+runtime.GOOS+".fo")}; !reflect.DeepEqual(a.FoFiles, expected) {
+		t.Errorf("wrong .fo files (expected %v but got %v)", expected, a.FoFiles)
+	}
+	if expected := []string{filepath.Join(root, "a", "tagged.go")}; !reflect.DeepEqual(a.GoFiles, expected) {
+		t.Errorf("wrong .go files (expected %v but got %v)", expected, a.GoFiles)
+	}
+	if expected := []string{"strings"}; !reflect.DeepEqual(a.Imports, expected) {
+		t.Errorf("wrong imports (expected %v but got %v)", expected, a.Imports)
+	}
+	if expected := []string{filepath.Join(root, "c", "c.fo")}; !reflect.DeepEqual(c.FoFiles, expected) {
+		t.Errorf("wrong .fo files (expected %v but got %v)", expected, c.FoFiles)
+	}
+}
+
+func TestLoadImportCycle(t *testing.T) {
+	root, cleanup := loadertest.WriteTree(t, map[string]string{
+		"go.mod": "module example.com/cycle\n",
+		"a/a.fo": "package a\n\nimport \"example.com/cycle/b\"\n",
+		"b/b.fo": "package b\n\nimport \"example.com/cycle/c\"\n",
+		"c/c.fo": "package c\n\nimport \"example.com/cycle/a\"\n",
+	})
+	defer cleanup()
+
+	_, err := Load(root)
+	cycleErr, ok := err.(*ImportCycleError)
+	if !ok {
+		t.Fatalf("expected *ImportCycleError but got %T: %v", err, err)
+	}
+	expected := []string{
+		"example.com/cycle/a",
+		"example.com/cycle/b",
+		"example.com/cycle/c",
+		"example.com/cycle/a",
+	}
+	if !reflect.DeepEqual(cycleErr.Cycle, expected) {
+		t.Errorf("wrong cycle (expected %v but got %v)", expected, cycleErr.Cycle)
+	}
+}
+
+func TestLoadMixedPackageNames(t *testing.T) {
+	root, cleanup := loadertest.WriteTree(t, map[string]string{
+		"a.fo": "package a\n",
+		"b.fo": "package b\n",
+	})
+	defer cleanup()
+
+	if _, err := Load(root); err == nil {
+		t.Fatal("expected an error for mixed package names but got none")
+	}
+}
+
+func TestLoadExternalTest(t *testing.T) {
+	root, cleanup := loadertest.WriteTree(t, map[string]string{
+		"go.mod":              "module example.com/app\n",
+		"a/a.fo":              "package a\n",
+		"a/a_test.fo":         "package a\n\nimport \"testing\"\n",
+		"a/example_test.fo":   "package a_test\n\nimport (\n\t\"example.com/app/a\"\n\t\"example.com/app/b\"\n)\n",
+		"b/b.fo":              "package b\n\nimport \"example.com/app/a\"\n",
+		"c/c.go":              "package c\n",
+		"c/c_test.fo":         "package c_test\n\nimport \"example.com/app/c\"\n",
+		"mixed/m.fo":          "package m\n",
+		"mixed/other_test.fo": "package other_test\n",
+	})
+	defer cleanup()
+
+	// The package of an external test package must be the one of its
+	// directory.
+	if _, err := Load(root); err == nil {
+		t.Fatal("expected an error for mixed package names but got none")
+	}
+	if err := os.RemoveAll(filepath.Join(root, "mixed")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The external test package of a imports b, which imports a, but since it
+	// is a package of its own, there is no cycle.
+	pkgs, err := Load(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"example.com/app/a",
+		"example.com/app/b",
+		"example.com/app/a_test",
+		"example.com/app/c_test",
+	}
+	if got := importPaths(pkgs); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("wrong packages (expected %v but got %v)", expected, got)
+	}
+	a, xtest := pkgs[0], pkgs[2]
+	if expected := []string{filepath.Join(root, "a", "a.fo"), filepath.Join(root, "a", "a_test.fo")}; !reflect.DeepEqual(a.FoFiles, expected) {
+		t.Errorf("wrong .fo files of a (expected %v but got %v)", expected, a.FoFiles)
+	}
+	if expected := []string{"testing"}; !reflect.DeepEqual(a.Imports, expected) {
+		t.Errorf("wrong imports of a (expected %v but got %v)", expected, a.Imports)
+	}
+	if a.XTest || xtest.Name != "a_test" || !xtest.XTest || xtest.Dir != a.Dir {
+		t.Errorf("wrong external test package %+v", xtest)
+	}
+	if expected := []string{filepath.Join(root, "a", "example_test.fo")}; !reflect.DeepEqual(xtest.FoFiles, expected) {
+		t.Errorf("wrong .fo files of a_test (expected %v but got %v)", expected, xtest.FoFiles)
+	}
+	if expected := []string{"example.com/app/a", "example.com/app/b"}; !reflect.DeepEqual(xtest.Imports, expected) {
+		t.Errorf("wrong imports of a_test (expected %v but got %v)", expected, xtest.Imports)
+	}
+}
+
+func TestLoadWorkspace(t *testing.T) {
+	root, cleanup := loadertest.WriteTree(t, map[string]string{
+		"go.work":               "go 1.18\n\nuse (\n\t./app\n\t./lib // the library\n)\n\nreplace example.com/util v1.0.0 => ./util\nreplace example.com/other => example.com/fork v1.2.0\n",
+		"app/go.mod":            "module example.com/app\n",
+		"app/main.fo":           "package main\n\nimport \"example.com/lib\"\n\nvar _ = lib.X\n",
+		"lib/go.mod":            "module example.com/lib\n",
+		"lib/lib.fo":            "package lib\n\nimport \"example.com/util\"\n\nconst X = util.Y\n",
+		"lib/unused/unused.fo":  "package unused\n",
+		"util/go.mod":           "module example.com/util\n",
+		"util/util.fo":          "package util\n\nconst Y = 1\n",
+		"util/nested/go.mod":    "module example.com/nested\n",
+		"util/nested/nested.fo": "package nested\n",
+	})
+	defer cleanup()
+	gowork, set := os.LookupEnv("GOWORK")
+	os.Unsetenv("GOWORK")
+	if set {
+		defer os.Setenv("GOWORK", gowork)
+	}
+
+	pkgs, err := Load(filepath.Join(root, "app"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"example.com/util",
+		"example.com/lib",
+		"example.com/app",
+	}
+	if got := importPaths(pkgs); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("wrong packages (expected %v but got %v)", expected, got)
+	}
+	if expected := filepath.Join(root, "util"); pkgs[0].Dir != expected {
+		t.Errorf("wrong directory for example.com/util (expected %s but got %s)", expected, pkgs[0].Dir)
+	}
+
+	// Nested modules get their own import paths.
+	pkgs, err = Load(filepath.Join(root, "util"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{
+		"example.com/nested",
+		"example.com/util",
+	}
+	if got := importPaths(pkgs); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("wrong packages (expected %v but got %v)", expected, got)
+	}
+
+	// Workspace mode can be turned off.
+	os.Setenv("GOWORK", "off")
+	defer os.Unsetenv("GOWORK")
+	pkgs, err = Load(filepath.Join(root, "app"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, expected := importPaths(pkgs), []string{"example.com/app"}; !reflect.DeepEqual(got, expected) {
+		t.Fatalf("wrong packages with GOWORK=off (expected %v but got %v)", expected, got)
+	}
+}
+
+func TestLoadFileSet(t *testing.T) {
+	root, cleanup := loadertest.WriteTree(t, map[string]string{
+		"go.mod": "module example.com/fset\n",
+		"a/a.fo": "package a\n",
+		"b/b.fo": "package b\n",
+	})
+	defer cleanup()
+
+	fset := token.NewFileSet()
+	pkgs, err := LoadFileSet(fset, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkgs) != 2 {
+		t.Fatalf("wrong number of packages (expected 2 but got %d)", len(pkgs))
+	}
+	for _, pkg := range pkgs {
+		if pkg.Fset != fset {
+			t.Errorf("package %s does not use the given file set", pkg.ImportPath)
+		}
+	}
+
+	pkgs, err = Load(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkgs[0].Fset == nil || pkgs[0].Fset != pkgs[1].Fset {
+		t.Error("packages returned by Load do not share a file set")
+	}
+}
+
+func TestLoadIgnore(t *testing.T) {
+	root, cleanup := loadertest.WriteTree(t, map[string]string{
+		"go.mod":                          "module example.com/ignore\n",
+		".foignore":                       "# generated by a tool\ngen/\n/scratch.fo\n**/wip/*.fo\n!keep.fo\n",
+		"main.fo":                         "package main\n",
+		"scratch.fo":                      "package main\n\nimport \"example.com/ignore/missing\"\n",
+		"a/a.fo":                          "package a\n",
+		"a/scratch.fo":                    "package a\n",
+		"a/b/.foignore":                   "*.fo\n!b.fo\n",
+		"a/b/b.fo":                        "package b\n",
+		"a/b/other.fo":                    "package other\n",
+		"a/wip/w.fo":                      "package wip\n",
+		"a/wip/keep.fo":                   "package wip\n",
+		"gen/g.fo":                        "package gen\n",
+		"testdata/t.fo":                   "package t\n",
+		"vendor/example.com/v/v.fo":       "package v\n",
+		"node_modules/pkg/n.fo":           "package n\n",
+		".git/x.fo":                       "package x\n",
+		"_old/o.fo":                       "package o\n",
+		"c/testdata.fo":                   "package c\n",
+		"c/vendor.fo":                     "package c\n",
+		"c/node_modules/deep/d.fo":        "package d\n",
+		"c/gen/nested/generated_by_x.fo":  "package nested\n",
+		"c/wip/deeper/not_matched_wip.fo": "package deeper\n",
+	})
+	defer cleanup()
+
+	pkgs, err := Load(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"example.com/ignore",
+		"example.com/ignore/a",
+		"example.com/ignore/a/b",
+		"example.com/ignore/a/wip",
+		"example.com/ignore/c",
+		"example.com/ignore/c/wip/deeper",
+	}
+	if got := importPaths(pkgs); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("wrong packages (expected %v but got %v)", expected, got)
+	}
+	files := map[string][]string{}
+	for _, pkg := range pkgs {
+		for _, filename := range pkg.FoFiles {
+			rel, _ := filepath.Rel(root, filename)
+			files[pkg.ImportPath] = append(files[pkg.ImportPath], filepath.ToSlash(rel))
+		}
+	}
+	expectedFiles := map[string][]string{
+		"example.com/ignore":              {"main.fo"},
+		"example.com/ignore/a":            {"a/a.fo", "a/scratch.fo"},
+		"example.com/ignore/a/b":          {"a/b/b.fo"},
+		"example.com/ignore/a/wip":        {"a/wip/keep.fo"},
+		"example.com/ignore/c":            {"c/testdata.fo", "c/vendor.fo"},
+		"example.com/ignore/c/wip/deeper": {"c/wip/deeper/not_matched_wip.fo"},
+	}
+	if !reflect.DeepEqual(files, expectedFiles) {
+		t.Errorf("wrong .fo files (expected %v but got %v)", expectedFiles, files)
+	}
+}
+
+func TestLoadIgnoreInvalidPattern(t *testing.T) {
+	root, cleanup := loadertest.WriteTree(t, map[string]string{
+		"go.mod":    "module example.com/ignore\n",
+		".foignore": "ok.fo\n[z-a\n",
+		"a.fo":      "package a\n",
+	})
+	defer cleanup()
+
+	_, err := Load(root)
+	if expected := filepath.Join(root, IgnoreFile) + `:2: invalid pattern "[z-a"`; err == nil || err.Error() != expected {
+		t.Errorf("wrong error (expected %s but got %v)", expected, err)
+	}
+}
+
+func TestFoFiles(t *testing.T) {
+	root, cleanup := loadertest.WriteTree(t, map[string]string{
+		".foignore":         "gen/\n*_wip.fo\n",
+		"main.fo":           "package main\n",
+		"main_windows.fo":   "package main\n",
+		"ignored.fo":        "//go:build ignore\n\npackage main\n",
+		"scratch_wip.fo":    "package main\n",
+		"a/a.fo":            "package a\n",
+		"a/a.go":            "package a\n",
+		"gen/g.fo":          "package gen\n",
+		"testdata/t.fo":     "package t\n",
+		"_old/o.fo":         "package o\n",
+		"node_modules/n.fo": "package n\n",
+	})
+	defer cleanup()
+
+	files, err := FoFiles(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, filename := range files {
+		rel, _ := filepath.Rel(root, filename)
+		got = append(got, filepath.ToSlash(rel))
+	}
+	expected := []string{"a/a.fo", "ignored.fo", "main.fo", "main_windows.fo"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("wrong .fo files (expected %v but got %v)", expected, got)
+	}
+}
+
+func TestResolvePattern(t *testing.T) {
+	root, cleanup := loadertest.WriteTree(t, map[string]string{
+		"go.work":           "go 1.18\n\nuse (\n\t./app\n\t./lib\n)\n",
+		"app/go.mod":        "module example.com/app\n",
+		"app/main.fo":       "package main\n",
+		"app/cmd/tool.fo":   "package main\n",
+		"app/nested/go.mod": "module example.com/app/nested\n",
+		"app/nested/x.fo":   "package x\n",
+		"lib/go.mod":        "module example.com/lib\n",
+		"lib/util/util.fo":  "package util\n",
+	})
+	defer cleanup()
+	gowork, set := os.LookupEnv("GOWORK")
+	os.Unsetenv("GOWORK")
+	if set {
+		defer os.Setenv("GOWORK", gowork)
+	}
+	dir := filepath.Join(root, "app")
+
+	for _, test := range []struct {
+		pattern string
+		root    string
+	}{
+		{".", "app"},
+		{"./...", "app"},
+		{"...", "app"},
+		{"./cmd", "app/cmd"},
+		{"cmd/...", "app/cmd"},
+		{"../lib/...", "lib"},
+		{filepath.Join(root, "lib") + "/...", "lib"},
+		{"example.com/app", "app"},
+		{"example.com/app/...", "app"},
+		{"example.com/app/cmd", "app/cmd"},
+		{"example.com/app/nested", "app/nested"},
+		{"example.com/lib/util/...", "lib/util"},
+	} {
+		got, err := ResolvePattern(dir, test.pattern)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.pattern, err)
+			continue
+		}
+		if expected := filepath.Join(root, filepath.FromSlash(test.root)); got != expected {
+			t.Errorf("%s: wrong root (expected %s but got %s)", test.pattern, expected, got)
+		}
+	}
+
+	for _, pattern := range []string{"example.com/other", "example.com/app/missing", "fmt"} {
+		if _, err := ResolvePattern(dir, pattern); err == nil {
+			t.Errorf("%s: expected an error", pattern)
+		}
+	}
+}
+
+func TestLoadRoots(t *testing.T) {
+	root, cleanup := loadertest.WriteTree(t, map[string]string{
+		"go.mod":    "module example.com/app\n",
+		"a/a.fo":    "package a\n",
+		"a/b/b.fo":  "package b\n\nimport \"example.com/app/c\"\n",
+		"c/c.fo":    "package c\n",
+		"d/d.fo":    "package d\n",
+		"main.fo":   "package main\n",
+		"go.sum":    "",
+		"README.md": "",
+	})
+	defer cleanup()
+
+	pkgs, err := LoadRoots(token.NewFileSet(), []string{filepath.Join(root, "a"), filepath.Join(root, "c"), filepath.Join(root, "a", "b")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"example.com/app/a", "example.com/app/c", "example.com/app/a/b"}
+	if got := importPaths(pkgs); !reflect.DeepEqual(got, expected) {
+		t.Errorf("wrong packages (expected %v but got %v)", expected, got)
+	}
+}
@@ -0,0 +1,31 @@
+// Package loadertest helps write tests which load Fo packages from a tree of
+// source files.
+package loadertest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// WriteTree creates a temporary directory containing files, which maps slash
+// separated file names to their contents. It returns the directory and a
+// function which removes it.
+func WriteTree(t testing.TB, files map[string]string) (string, func()) {
+	t.Helper()
+	root, err := ioutil.TempDir("", "fo-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		filename := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root, func() { os.RemoveAll(root) }
+}
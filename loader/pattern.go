@@ -0,0 +1,110 @@
+package loader
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/qProust/fo/token"
+)
+
+// ResolvePattern returns the root of the directory tree denoted by the
+// package pattern, like those given to the go command. A pattern is either a
+// directory or an import path, which may end in "/..." (e.g. ./..., ./lib/...,
+// example.com/app/lib or example.com/app/...). Relative directories are
+// resolved against dir. Since the trees are always walked recursively, a
+// pattern with the "/..." suffix denotes the same tree as the one without.
+//
+// Patterns which start with "." or ".." or are absolute, as well as those
+// which name an existing directory, are directories. Other patterns are import
+// paths, which are resolved in the module containing dir or, in workspace
+// mode, in the modules of the workspace (see Load).
+func ResolvePattern(dir string, pattern string) (string, error) {
+	p := pattern
+	if p == "..." || strings.HasSuffix(p, "/...") {
+		p = strings.TrimSuffix(strings.TrimSuffix(p, "..."), "/")
+		if p == "" {
+			p = "."
+		}
+	}
+	local := filepath.FromSlash(p)
+	if !filepath.IsAbs(local) {
+		local = filepath.Join(dir, local)
+	}
+	if isLocalPath(p) {
+		return local, nil
+	}
+	if info, err := os.Stat(local); err == nil && info.IsDir() {
+		return local, nil
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	var best module
+	for _, mod := range patternModules(dir) {
+		if (p == mod.path || strings.HasPrefix(p, mod.path+"/")) && len(mod.path) > len(best.path) {
+			best = mod
+		}
+	}
+	if best.path == "" {
+		return "", fmt.Errorf("cannot resolve %s: it is neither a directory nor an import path in the main module or workspace", pattern)
+	}
+	root := filepath.Join(best.dir, filepath.FromSlash(strings.TrimPrefix(p, best.path)))
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("cannot resolve %s: there is no directory %s in module %s", pattern, root, best.path)
+	}
+	return root, nil
+}
+
+// patternModules returns the modules in which import paths of patterns are
+// resolved: the module containing dir and the modules of its workspace.
+func patternModules(dir string) []module {
+	var modules []module
+	if mod := findModule(dir, map[string]module{}); mod.path != "" {
+		modules = append(modules, mod)
+	}
+	if workFile := findWorkFile(dir); workFile != "" {
+		moduleDirs, err := readWorkFile(workFile)
+		if err != nil {
+			return modules
+		}
+		for _, moduleDir := range moduleDirs {
+			if modPath := readModulePath(filepath.Join(moduleDir, "go.mod")); modPath != "" {
+				modules = append(modules, module{dir: moduleDir, path: modPath})
+			}
+		}
+	}
+	return modules
+}
+
+// LoadRoots is like LoadFileSet, but loads the packages of several directory
+// trees, such as those returned by ResolvePattern. A package found in more
+// than one tree is only included once.
+func LoadRoots(fset *token.FileSet, roots []string) ([]*Package, error) {
+	if len(roots) == 1 {
+		return LoadFileSet(fset, roots[0])
+	}
+	var pkgs []*Package
+	// A directory can hold a package and its external test package.
+	type dirPackage struct {
+		dir   string
+		xtest bool
+	}
+	seen := map[dirPackage]bool{}
+	for _, root := range roots {
+		found, err := LoadFileSet(fset, root)
+		if err != nil {
+			return nil, err
+		}
+		for _, pkg := range found {
+			key := dirPackage{pkg.Dir, pkg.XTest}
+			if !seen[key] {
+				seen[key] = true
+				pkgs = append(pkgs, pkg)
+			}
+		}
+	}
+	return Sort(pkgs)
+}
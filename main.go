@@ -1,17 +1,39 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	gobuild "go/build"
+	"io"
+	"io/ioutil"
+	"net/http"
 	"os"
 	"os/exec"
+	"os/signal"
+	"path"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 
 	"github.com/qProust/fo/ast"
+	"github.com/qProust/fo/doc"
 	"github.com/qProust/fo/format"
+	"github.com/qProust/fo/go2fo"
+	"github.com/qProust/fo/grammar"
 	"github.com/qProust/fo/importer"
+	"github.com/qProust/fo/internal/cgo"
+	"github.com/qProust/fo/loader"
 	"github.com/qProust/fo/parser"
+	"github.com/qProust/fo/query"
+	"github.com/qProust/fo/refactor"
+	"github.com/qProust/fo/scanner"
 	"github.com/qProust/fo/token"
 	"github.com/qProust/fo/transform"
 	"github.com/qProust/fo/types"
@@ -19,118 +41,2892 @@ import (
 )
 
 func main() {
+	if err := runApp(newApp(), os.Args); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %s\n", err)
+		os.Exit(exitCode(err))
+	}
+}
+
+// newApp returns the command line application of fo.
+func newApp() *cli.App {
 	app := cli.NewApp()
 
 	app.Name = "Fo"
 	app.Usage = "An experimental language which adds functional programming features to Go."
+	warningFlags := []cli.Flag{
+		cli.BoolFlag{
+			Name:  "warn-unused-generics",
+			Usage: "warn about generic types and functions which are never used",
+		},
+		cli.BoolFlag{
+			Name:  "strict-unused-generics",
+			Usage: "report generic types and functions which are never used as errors",
+		},
+		cli.BoolFlag{
+			Name:  "warn-incomplete-switches",
+			Usage: "warn about type switches which handle some instantiations of a generic type but not all of them",
+		},
+		cli.BoolFlag{
+			Name:  "strict-incomplete-switches",
+			Usage: "report type switches which handle some instantiations of a generic type but not all of them as errors",
+		},
+		cli.BoolFlag{
+			Name:  "warn-unused-type-params",
+			Usage: "warn about type parameters which are never used in the declaration of their generic type or function",
+		},
+		cli.BoolFlag{
+			Name:  "warn-shadowed-type-params",
+			Usage: "warn about type parameters which shadow a declaration of the same name, e.g. a package-level type or int",
+		},
+		cli.BoolFlag{
+			Name:  "warn-implicit-constraints",
+			Usage: "warn about type parameters without a constraint, which are implicitly constrained by interface{}",
+		},
+		cli.BoolFlag{
+			Name:  "werror",
+			Usage: "report all warnings as errors",
+		},
+	}
+	lineDirectivesFlag := cli.BoolFlag{
+		Name:  "line-directives",
+		Usage: "add //line directives to generated files so that Go tools report positions in the .fo source",
+	}
+	preserveFormattingFlag := cli.BoolFlag{
+		Name:  "preserve-formatting",
+		Usage: "copy declarations which are not changed by the transformation verbatim instead of reformatting them",
+	}
+	strictFormatFlag := cli.BoolFlag{
+		Name:  "strict-format",
+		Usage: "format the generated code more strictly than gofmt (see fo fmt --strict); cannot be combined with --preserve-formatting",
+	}
+	sourceOrderFlag := cli.BoolFlag{
+		Name:  "source-order",
+		Usage: "keep the types declared in a group in source order, with the instances of a generic type in its place, instead of sorting them by name",
+	}
+	unexportedInstancesFlag := cli.BoolFlag{
+		Name:  "unexported-instances",
+		Usage: "give the instances of exported generic types and functions which are only used in their own package unexported names (e.g. box__int), so that they are not part of its API",
+	}
+	goTypeParamsFlag := cli.BoolFlag{
+		Name:  "go-type-params",
+		Usage: "also accept type parameter lists in Go syntax (e.g. [K, V any]), so that files can be shared with the go command",
+	}
+	goVersionFlag := cli.StringFlag{
+		Name:  "go-version",
+		Usage: "generate code for Go `version` 1.x: e.g. the predeclared min and max are kept as of 1.21 and empty interfaces are written as any as of 1.18, and instantiations of generics from Go packages are errors before 1.18 (by default, the code is compatible with all versions)",
+	}
+	debugInstantiationFlag := cli.BoolFlag{
+		Name:  "debug-instantiation",
+		Usage: "print each instantiation of a generic type or function made by the type checker, with its position, type arguments and whether its type was cached, to stderr",
+	}
+	checkFlags := append(append([]cli.Flag{}, warningFlags...),
+		cli.IntFlag{
+			Name:  "max-instances",
+			Usage: "warn about generic types and functions with more than `n` instantiations",
+		},
+		cli.IntFlag{
+			Name:  "max-generated-lines",
+			Usage: "warn if more than `n` lines of code are generated for instantiations of generics, listing the generic types and functions which generate the most",
+		},
+		cli.BoolFlag{
+			Name:  "sourcemap",
+			Usage: "write a .go.map file relating positions in each generated file to the .fo source",
+		},
+		lineDirectivesFlag,
+		preserveFormattingFlag,
+		strictFormatFlag,
+		sourceOrderFlag,
+		unexportedInstancesFlag,
+		goTypeParamsFlag,
+		goVersionFlag,
+		debugInstantiationFlag,
+		cli.BoolFlag{
+			Name:  "download",
+			Usage: "download the imported packages which cannot be found (e.g. because they are missing from the module cache) with go get, instead of failing",
+		},
+	)
+	verboseFlags := []cli.Flag{
+		cli.BoolFlag{
+			Name:  "verbose, v",
+			Usage: "log each file as it is parsed and transformed (along with the instantiations generated in it) and each package as it is checked",
+		},
+		cli.BoolFlag{
+			Name:  "x",
+			Usage: "print the go commands as they are run",
+		},
+	}
+	sanitizerFlags := []cli.Flag{
+		cli.BoolFlag{
+			Name:  "race",
+			Usage: "enable data race detection (passed on as -race to the go command)",
+		},
+		cli.BoolFlag{
+			Name:  "msan",
+			Usage: "enable interoperation with the memory sanitizer (passed on as -msan to the go command)",
+		},
+		cli.BoolFlag{
+			Name:  "asan",
+			Usage: "enable interoperation with the address sanitizer (passed on as -asan to the go command)",
+		},
+	}
 	app.Commands = []cli.Command{
 		{
-			Name:   "run",
-			Usage:  "run a single .fo file",
-			Action: run,
+			Name:      "run",
+			Usage:     "run a single .fo file",
+			ArgsUsage: "<filename | -> [-- <go run flags>]",
+			Action:    run,
+			Flags:     append(append(append([]cli.Flag{}, checkFlags...), sanitizerFlags...), verboseFlags...),
+		},
+		{
+			Name:      "build",
+			Usage:     "build all Fo packages in the directory trees denoted by package patterns such as ./... or example.com/app/lib (or a single .fo file)",
+			ArgsUsage: "[<filename> | <pattern>...] [-- <go build flags>]",
+			Action:    build,
+			Flags: append([]cli.Flag{
+				cli.IntFlag{
+					Name:  "jobs, j",
+					Value: runtime.GOMAXPROCS(0),
+					Usage: "number of files to parse and transform in parallel",
+				},
+				cli.StringFlag{
+					Name:  "publish",
+					Usage: "write a copy of the tree which can be built with the go command alone to `dir`, instead of writing .go files next to the .fo files",
+				},
+				cli.BoolFlag{
+					Name:  "merge",
+					Usage: "write the Go code generated for each package to a single file, " + loader.MergedFile + ", instead of one .go file per .fo file",
+				},
+				cli.StringFlag{
+					Name:  "target",
+					Usage: "compile for `platform`; the only supported platform is wasm (GOOS=js GOARCH=wasm), for which wasm_exec.js is written next to the binary",
+				},
+				cli.BoolFlag{
+					Name:  "dry-run, n",
+					Usage: "print the files which would be written (and whether they exist), the instantiations which would be generated in them and the go command which would be run, without writing or running anything",
+				},
+			}, append(append(append([]cli.Flag{}, checkFlags...), sanitizerFlags...), verboseFlags...)...),
+		},
+		{
+			Name:      "test",
+			Usage:     "build all Fo packages in the directory trees denoted by package patterns and test them with go test",
+			ArgsUsage: "[<pattern>...] [-- <go test flags>]",
+			Action:    testPackages,
+			Flags: append([]cli.Flag{
+				cli.IntFlag{
+					Name:  "jobs, j",
+					Value: runtime.GOMAXPROCS(0),
+					Usage: "number of files to parse and transform in parallel",
+				},
+			}, append(append(append([]cli.Flag{}, checkFlags...), sanitizerFlags...), verboseFlags...)...),
+		},
+		{
+			Name:      "check",
+			Usage:     "type-check all Fo packages in the directory trees denoted by package patterns and report all errors, without writing any files",
+			ArgsUsage: "[<pattern>...]",
+			Action:    checkTree,
+			Flags: append([]cli.Flag{
+				cli.BoolFlag{
+					Name:  "fast",
+					Usage: "don't check function bodies, so that only errors in package-level declarations are reported (e.g. for editors which check on each keystroke)",
+				},
+				cli.IntFlag{
+					Name:  "jobs, j",
+					Value: runtime.GOMAXPROCS(0),
+					Usage: "number of files to parse in parallel",
+				},
+			}, append(append([]cli.Flag{}, warningFlags...), goTypeParamsFlag, goVersionFlag, debugInstantiationFlag)...),
+		},
+		{
+			Name:      "generate",
+			Usage:     "run the //go:generate directives of the .fo files in the directory trees denoted by package patterns (or of a single .fo file)",
+			ArgsUsage: "[<filename> | <pattern>...]",
+			Action:    runGenerate,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "n",
+					Usage: "print the commands which would be run, but don't run them",
+				},
+				cli.BoolFlag{
+					Name:  "x",
+					Usage: "print the commands as they are run",
+				},
+				cli.StringFlag{
+					Name:  "run",
+					Usage: "only run the directives whose full text matches `regexp`",
+				},
+			},
+		},
+		{
+			Name:   "transpile",
+			Usage:  "transpile a Fo file read from standard input and write the Go code to standard output",
+			Action: transpile,
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:  "filename",
+					Value: "stdin.fo",
+					Usage: "name of the file used in error messages and line directives",
+				},
+			}, append(append([]cli.Flag{}, warningFlags...), lineDirectivesFlag, preserveFormattingFlag, strictFormatFlag, sourceOrderFlag, unexportedInstancesFlag, goTypeParamsFlag, goVersionFlag, debugInstantiationFlag)...),
+		},
+		{
+			Name:      "debug",
+			Usage:     "debug a single .fo file with Delve",
+			ArgsUsage: "<filename> [-- <program arguments>]",
+			Action:    debug,
+			Flags: append([]cli.Flag{
+				// Breakpoints can only be set by .fo file and line if the
+				// generated code has line directives.
+				cli.BoolTFlag{
+					Name:   "line-directives",
+					Hidden: true,
+				},
+			}, append(append([]cli.Flag{}, warningFlags...), goTypeParamsFlag)...),
+		},
+		{
+			Name:      "migrate",
+			Usage:     "convert all Fo packages in a directory tree to Go code with Go 1.18 type parameters",
+			ArgsUsage: "[<dir>]",
+			Action:    migrate,
+			Flags:     []cli.Flag{goTypeParamsFlag},
+		},
+		{
+			Name:      "go2fo",
+			Usage:     "convert the Go files of a package which use Go 1.18 type parameters to .fo files",
+			ArgsUsage: "[<dir>]",
+			Action:    goToFo,
+		},
+		{
+			Name:      "query",
+			Usage:     "answer a query about the identifier at a position in a .fo file",
+			ArgsUsage: "<definition | referrers | references | implements> <filename>:<line>:<column>",
+			Action:    runQuery,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "root",
+					Value: ".",
+					Usage: "directory tree containing the packages which are searched",
+				},
+				cli.BoolFlag{
+					Name:  "json",
+					Usage: "print the results as a JSON array",
+				},
+				cli.BoolFlag{
+					Name:  "generated",
+					Usage: "also print the corresponding positions in generated .go files which have a .go.map source map (references only)",
+				},
+			},
+		},
+		{
+			Name:      "describe",
+			Usage:     "describe the identifier at a position in a .fo file, including the type arguments of instantiations",
+			ArgsUsage: "<filename>:<line>:<column> | <filename>:#<offset>",
+			Action:    describe,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "root",
+					Value: ".",
+					Usage: "directory tree containing the packages which are loaded",
+				},
+				cli.BoolFlag{
+					Name:  "json",
+					Usage: "print the description as a JSON object",
+				},
+			},
+		},
+		{
+			Name:      "outline",
+			Usage:     "print the declarations of a .fo file as a JSON array of symbols",
+			ArgsUsage: "<filename>",
+			Action:    outline,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "root",
+					Value: ".",
+					Usage: "directory tree containing the packages which are searched for instances of generics",
+				},
+			},
+		},
+		{
+			Name:      "doc",
+			Usage:     "serve or write the HTML documentation of the Fo packages in a directory tree, with the instantiations of generics linked to their source",
+			ArgsUsage: "[<dir>]",
+			Action:    documentation,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "http",
+					Usage: "serve the documentation on `address`, e.g. :6060",
+				},
+				cli.StringFlag{
+					Name:  "html",
+					Usage: "write the documentation as static HTML files to `dir`",
+				},
+			},
+		},
+		{
+			Name:   "rename",
+			Usage:  "rename a package-level declaration and all references to it, including instantiations of generics",
+			Action: rename,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "from",
+					Usage: "declaration to rename, as <package>.<name> where <package> is an import path or package name",
+				},
+				cli.StringFlag{
+					Name:  "to",
+					Usage: "new name of the declaration",
+				},
+				cli.StringFlag{
+					Name:  "root",
+					Value: ".",
+					Usage: "directory tree containing the packages which are updated",
+				},
+			},
+		},
+		{
+			Name:      "imports",
+			Usage:     "add missing imports to .fo files and remove unused ones",
+			ArgsUsage: "[<filename>...]",
+			Action:    fixImports,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "root",
+					Value: ".",
+					Usage: "directory tree containing the packages which are loaded; without filenames, all of their .fo files are fixed",
+				},
+				cli.BoolFlag{
+					Name:  "w",
+					Usage: "write the result to the files instead of printing it",
+				},
+				cli.BoolFlag{
+					Name:  "l",
+					Usage: "only print the names of the files whose imports are not correct",
+				},
+			},
+		},
+		{
+			Name:      "fmt",
+			Usage:     "format .fo files",
+			ArgsUsage: "[<filename> | <pattern>...]",
+			Action:    formatFiles,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "strict",
+					Usage: "format more strictly than gofmt: no empty lines at the start and end of blocks, the imports of the standard library in a group of their own and octal literals with the 0o prefix",
+				},
+				cli.BoolFlag{
+					Name:  "w",
+					Usage: "write the result to the files instead of printing it",
+				},
+				cli.BoolFlag{
+					Name:  "l",
+					Usage: "only print the names of the files whose formatting differs",
+				},
+				goTypeParamsFlag,
+			},
+		},
+		{
+			Name:  "refactor",
+			Usage: "apply a refactoring to .fo files",
+			Subcommands: []cli.Command{
+				{
+					Name:      "extract",
+					Usage:     "move a range of statements into a new function, which is generic if the statements use type parameters",
+					ArgsUsage: "<filename>:<line>:<column>-<line>:<column>",
+					Action:    extract,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "name",
+							Usage: "name of the new function",
+						},
+						cli.StringFlag{
+							Name:  "root",
+							Value: ".",
+							Usage: "directory tree containing the packages which are loaded",
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:  "mod",
+			Usage: "manage Fo modules",
+			Subcommands: []cli.Command{
+				{
+					Name:      "init",
+					Usage:     "start a new module in the current directory: write go.mod, a main.fo with a generic example and a .gitignore for the generated files",
+					ArgsUsage: "<module path>",
+					Action:    modInit,
+				},
+			},
 		},
 		{
-			Name:   "build",
-			Usage:  "build a single .fo file",
-			Action: build,
+			Name:  "tooling",
+			Usage: "generate files for editors and other tools",
+			Subcommands: []cli.Command{
+				{
+					Name:   "grammar",
+					Usage:  "write a syntax highlighting grammar of Fo",
+					Action: writeGrammar,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "format",
+							Value: "tmlanguage",
+							Usage: "format of the grammar: tmlanguage (fo.tmLanguage.json) or tree-sitter (grammar.js and queries/highlights.scm)",
+						},
+						cli.StringFlag{
+							Name:  "output, o",
+							Value: ".",
+							Usage: "directory to write the grammar to",
+						},
+					},
+				},
+			},
 		},
 	}
 
-	if err := app.Run(os.Args); err != nil {
-		fmt.Printf("ERROR: %s\n", err)
-		os.Exit(1)
+	app.OnUsageError = usageError
+	setUsageError(app.Commands)
+	return app
+}
+
+// runApp runs app with the command line args and returns the error which fo
+// exits with. An unknown command (e.g. fo frob, or fo help frob) is a usage
+// error: by default, the cli package would exit with exitParse instead.
+func runApp(app *cli.App, args []string) error {
+	var notFound error
+	app.CommandNotFound = func(c *cli.Context, command string) {
+		cli.ShowAppHelp(c)
+		notFound = usageErrorf("unknown command %q", command)
+	}
+	if err := app.Run(args); err != nil {
+		return err
 	}
+	return notFound
 }
 
-func buildFile(path string) (string, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return "", fmt.Errorf("could not open file: %s", err)
+// The exit codes of fo, by the class of failure, so that scripts can tell
+// them apart.
+const (
+	exitFailure   = 1 // any other failure, e.g. a file which cannot be read
+	exitUsage     = 2 // invalid flags or arguments
+	exitParse     = 3 // syntax errors in a source file
+	exitType      = 4 // type errors
+	exitTransform = 5 // the Go code could not be generated from type-checked Fo code
+	exitTool      = 6 // the go command or another tool run by fo failed
+)
+
+// An exitError is an error which makes fo exit with a specific code.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+
+// withExitCode returns err marked with the exit code code, or nil if err is
+// nil.
+func withExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &exitError{code: code, err: err}
+}
+
+// exitCode returns the code fo exits with because of err.
+func exitCode(err error) int {
+	if e, ok := err.(*exitError); ok {
+		return e.code
 	}
-	if !strings.HasSuffix(f.Name(), ".fo") {
-		return "", fmt.Errorf("%s is not a Fo file (expected '.fo' extension)", f.Name())
+	return exitFailure
+}
+
+// usageErrorf returns an error about invalid arguments, which makes fo exit
+// with exitUsage.
+func usageErrorf(format string, args ...interface{}) error {
+	return withExitCode(exitUsage, fmt.Errorf(format, args...))
+}
+
+// usageError handles invalid flags of the app and its commands: it shows the
+// help of the command and makes fo exit with exitUsage.
+func usageError(c *cli.Context, err error, isSubcommand bool) error {
+	if c.Command.Name != "" {
+		cli.ShowCommandHelp(c, c.Command.Name)
+	} else {
+		cli.ShowAppHelp(c)
 	}
+	return withExitCode(exitUsage, err)
+}
 
-	// Parse file.
-	fset := token.NewFileSet()
-	nodes, err := parser.ParseFile(fset, f.Name(), f, 0)
-	if err != nil {
-		return "", err
+// setUsageError makes usageError handle the invalid flags of commands and
+// their subcommands.
+func setUsageError(commands []cli.Command) {
+	for i := range commands {
+		commands[i].OnUsageError = usageError
+		setUsageError(commands[i].Subcommands)
 	}
+}
 
-	// Check types.
-	conf := types.Config{Importer: importer.Default()}
-	info := &types.Info{
-		Selections: map[*ast.SelectorExpr]*types.Selection{},
-		Uses:       map[*ast.Ident]types.Object{},
+// checkConfig returns the configuration used to type-check Fo packages based on
+// the flags of the current command. fset is the file set of the packages.
+func checkConfig(c *cli.Context, fset *token.FileSet, imp types.Importer) *types.Config {
+	conf := &types.Config{
+		IgnoreFuncBodies:         c.Bool("fast"),
+		Importer:                 imp,
+		Warn:                     printWarning,
+		WarnUnusedGenerics:       c.Bool("warn-unused-generics"),
+		StrictUnusedGenerics:     c.Bool("strict-unused-generics"),
+		WarnIncompleteSwitches:   c.Bool("warn-incomplete-switches"),
+		StrictIncompleteSwitches: c.Bool("strict-incomplete-switches"),
+		WarnUnusedTypeParams:     c.Bool("warn-unused-type-params"),
+		WarnShadowedTypeParams:   c.Bool("warn-shadowed-type-params"),
+		WarnImplicitConstraints:  c.Bool("warn-implicit-constraints"),
+		WarningsAsErrors:         c.Bool("werror"),
+		GoVersion:                c.String("go-version"),
 	}
-	pkg, err := conf.Check(f.Name(), fset, []*ast.File{nodes}, info)
-	if err != nil {
-		fmt.Println(err.Error())
-		os.Exit(1)
+	if c.Bool("debug-instantiation") {
+		conf.TraceInstantiation = func(inst types.Instantiation) {
+			printInstantiation(fset, inst)
+		}
 	}
+	return conf
+}
 
-	// Transform to pure Go and write the output.
-	trans := &transform.Transformer{
-		Fset: fset,
-		Pkg:  pkg,
-		Info: info,
+// goVersion returns the version of Go which the generated code targets
+// according to the --go-version flag, or the zero GoVersion if it is not set.
+func goVersion(c *cli.Context) (types.GoVersion, error) {
+	if c.String("go-version") == "" {
+		return types.GoVersion{}, nil
 	}
-	transformed, err := trans.File(nodes)
+	v, err := types.ParseGoVersion(c.String("go-version"))
 	if err != nil {
+		return v, usageErrorf("--go-version: %s", err)
+	}
+	return v, nil
+}
+
+func printWarning(err error) {
+	fmt.Fprintf(os.Stderr, "WARNING: %s\n", err)
+}
+
+// printInstantiation prints an instantiation traced by the type checker (see
+// the --debug-instantiation flag).
+func printInstantiation(fset *token.FileSet, inst types.Instantiation) {
+	pos := "-"
+	if inst.Pos.IsValid() {
+		pos = fset.Position(inst.Pos).String()
+	}
+	fmt.Fprintf(os.Stderr, "INSTANTIATE: %s: %s\n", pos, inst)
+}
+
+// buildFile transpiles the single .fo file at path, which is treated as a
+// package of its own, and returns the name of the resulting .go file.
+func buildFile(c *cli.Context, path string) (string, error) {
+	if !strings.HasSuffix(path, ".fo") {
+		return "", usageErrorf("%s is not a Fo file (expected '.fo' extension)", path)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("could not open file: %s", err)
+	}
+	pkg := &loader.Package{
+		ImportPath: path,
+		Dir:        filepath.Dir(path),
+		FoFiles:    []string{path},
+		Fset:       token.NewFileSet(),
+	}
+	if err := buildPackages(c, []*loader.Package{pkg}); err != nil {
 		return "", err
 	}
-	outputName := strings.TrimSuffix(f.Name(), ".fo") + ".go"
-	output, err := os.Create(outputName)
+	return strings.TrimSuffix(path, ".fo") + ".go", nil
+}
+
+// patternRoots returns the roots of the directory trees denoted by the package
+// patterns given as arguments (see loader.ResolvePattern), or the current
+// directory if there are none.
+func patternRoots(patterns []string) ([]string, error) {
+	if len(patterns) == 0 {
+		return []string{"."}, nil
+	}
+	roots := make([]string, len(patterns))
+	for i, pattern := range patterns {
+		root, err := loader.ResolvePattern(".", pattern)
+		if err != nil {
+			return nil, usageErrorf("%s", err)
+		}
+		roots[i] = root
+	}
+	return roots, nil
+}
+
+// inTree reports whether dir is in one of the directory trees rooted at roots.
+func inTree(dir string, roots []string) (bool, error) {
+	dir, err := filepath.Abs(dir)
 	if err != nil {
-		return "", err
+		return false, err
 	}
-	if err := format.Node(output, fset, transformed); err != nil {
-		return "", err
+	for _, root := range roots {
+		root, err := filepath.Abs(root)
+		if err != nil {
+			return false, err
+		}
+		if rel, err := filepath.Rel(root, dir); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true, nil
+		}
 	}
-	return outputName, nil
+	return false, nil
 }
 
 func build(c *cli.Context) error {
-	path := "."
-	if c.Args().Present() {
-		path = c.Args().First()
+	if err := setTarget(c.String("target")); err != nil {
+		return err
 	}
-	err := filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
-		if !strings.HasSuffix(path, ".fo") {
-			return nil
+	args, goFlags, compile := splitArgs(c)
+	goFlags = toolchainFlags(c, goFlags)
+	compile = compile || len(goFlags) > 0 || c.String("target") != ""
+	single := len(args) > 0 && strings.HasSuffix(args[0], ".fo")
+	if single && len(args) > 1 {
+		return usageErrorf("build expects either a single .fo file or package patterns")
+	}
+	if c.Bool("merge") {
+		switch {
+		case single:
+			return usageErrorf("--merge applies to packages, not to single .fo files")
+		case c.String("publish") != "":
+			return usageErrorf("--merge cannot be combined with --publish")
+		case c.Bool("sourcemap"), c.Bool("line-directives"), c.Bool("preserve-formatting"):
+			return usageErrorf("--merge cannot be combined with --sourcemap, --line-directives or --preserve-formatting")
 		}
-		_, err = buildFile(path)
-		if err != nil {
-			return fmt.Errorf("error in '%s': %s", path, err)
+	}
+	if single {
+		outputName, err := buildFile(c, args[0])
+		if err != nil || !compile {
+			return err
 		}
-		return nil
-	})
+		return goBuild(c, ".", goFlags, outputName)
+	}
+	roots, err := patternRoots(args)
 	if err != nil {
-		return fmt.Errorf("failed to walk path: %s", err)
+		return err
+	}
+	if len(roots) > 1 && c.String("publish") != "" {
+		return usageErrorf("--publish expects a single directory tree")
+	}
+	pkgs, err := loader.LoadRoots(token.NewFileSet(), roots)
+	if err != nil {
+		return fmt.Errorf("failed to load packages: %s", err)
+	}
+	if dir := c.String("publish"); dir != "" {
+		if err := publish(c, pkgs, roots[0], dir); err != nil || !compile {
+			return err
+		}
+		return goBuild(c, dir, append([]string{"-C", dir}, goFlags...), "./...")
+	}
+	if err := buildPackages(c, pkgs); err != nil {
+		return err
+	}
+	if err := removeStaleOutputs(c, pkgs); err != nil || !compile || len(pkgs) == 0 {
+		return err
+	}
+	dirs, err := treeDirs(pkgs, roots)
+	if err != nil {
+		return err
+	}
+	return goBuild(c, ".", goFlags, dirs...)
+}
+
+// testPackages builds the packages in the directory trees denoted by the
+// arguments like build, without compiling them, and then runs go test on
+// them. The arguments after "--" are passed on to go test.
+func testPackages(c *cli.Context) error {
+	args, goFlags, _ := splitArgs(c)
+	roots, err := patternRoots(args)
+	if err != nil {
+		return err
+	}
+	pkgs, err := loader.LoadRoots(token.NewFileSet(), roots)
+	if err != nil {
+		return fmt.Errorf("failed to load packages: %s", err)
+	}
+	if err := buildPackages(c, pkgs); err != nil {
+		return err
+	}
+	if err := removeStaleOutputs(c, pkgs); err != nil || len(pkgs) == 0 {
+		return err
+	}
+	dirs, err := treeDirs(pkgs, roots)
+	if err != nil {
+		return err
+	}
+	return goCommand(c, "test", toolchainFlags(c, goFlags), dirs...)
+}
+
+// treeDirs returns the directories of the packages in pkgs which are in one
+// of the directory trees rooted at roots. Packages from other modules of a
+// workspace are left out, since the go command builds them as dependencies of
+// the packages in the trees. A directory which holds a package and its
+// external test package is only returned once.
+func treeDirs(pkgs []*loader.Package, roots []string) ([]string, error) {
+	var dirs []string
+	seen := map[string]bool{}
+	for _, pkg := range pkgs {
+		if seen[pkg.Dir] {
+			continue
+		}
+		seen[pkg.Dir] = true
+		if ok, err := inTree(pkg.Dir, roots); err != nil {
+			return nil, err
+		} else if ok {
+			dirs = append(dirs, pkg.Dir)
+		}
 	}
+	return dirs, nil
+}
+
+// wasmTarget is the value of the --target flag of build for WebAssembly.
+const wasmTarget = "wasm"
 
+// setTarget sets up the environment of the go command and the build context
+// used to select files and import packages for the platform named by the
+// --target flag of build, if any.
+func setTarget(target string) error {
+	switch target {
+	case "":
+		return nil
+	case wasmTarget:
+	default:
+		return usageErrorf("unsupported target %q (the only supported target is %s)", target, wasmTarget)
+	}
+	gobuild.Default.GOOS = "js"
+	gobuild.Default.GOARCH = "wasm"
+	gobuild.Default.CgoEnabled = false
+	os.Setenv("GOOS", "js")
+	os.Setenv("GOARCH", "wasm")
 	return nil
 }
 
+// goBuild runs go build with the given flags and arguments. If the --target
+// flag selects WebAssembly, wasm_exec.js, which is needed to run the binary,
+// is written to dir first; dir is the directory in which go build writes the
+// binary. With --dry-run, the command is only printed.
+func goBuild(c *cli.Context, dir string, flags []string, args ...string) error {
+	if c.Bool("dry-run") {
+		if c.String("target") == wasmTarget {
+			fmt.Println(writeVerb(filepath.Join(dir, "wasm_exec.js")), filepath.Join(dir, "wasm_exec.js"))
+		}
+		fmt.Println(strings.Join(append(append([]string{"go", "build"}, flags...), args...), " "))
+		return nil
+	}
+	if c.String("target") == wasmTarget {
+		if err := writeWasmExec(dir); err != nil {
+			return err
+		}
+	}
+	return goCommand(c, "build", flags, args...)
+}
 
-func run(c *cli.Context) error {
-	// Read arguments and open file.
-	if !c.Args().Present() || len(c.Args().Tail()) != 0 {
-		return errors.New("run expects exactly one argument: the name of a Fo file to run")
+// writeWasmExec copies wasm_exec.js, the JavaScript code which loads and runs
+// a Go program compiled to WebAssembly, from the Go installation to dir.
+func writeWasmExec(dir string) error {
+	var src []byte
+	var err error
+	// The file moved from misc/wasm to lib/wasm in Go 1.24.
+	for _, sub := range []string{"lib", "misc"} {
+		src, err = ioutil.ReadFile(filepath.Join(gobuild.Default.GOROOT, sub, "wasm", "wasm_exec.js"))
+		if err == nil {
+			break
+		}
 	}
-	outputName, err := buildFile(c.Args().First())
 	if err != nil {
-		return err
+		return fmt.Errorf("could not find wasm_exec.js in the Go installation: %s", err)
 	}
+	return writeFile(filepath.Join(dir, "wasm_exec.js"), src, 0644)
+}
 
-	// Invoke Go command to run the resulting Go code.
-	cmd := exec.Command("go", "run", outputName)
+// checkWasmImports returns an error if one of pkgs cannot be built for
+// js/wasm, either because it uses cgo or because it imports a package which
+// has no files for that platform. files holds the parsed files of each
+// package. Imports of the packages in pkgs are left to the type checker.
+func checkWasmImports(fset *token.FileSet, pkgs []*loader.Package, files [][]*ast.File) error {
+	local := map[string]bool{}
+	for _, pkg := range pkgs {
+		local[pkg.ImportPath] = true
+	}
+	var errs []string
+	for i, pkg := range pkgs {
+		for _, filename := range pkg.CgoFiles {
+			errs = append(errs, fmt.Sprintf("%s: cgo is not supported by js/wasm", filename))
+		}
+		reported := map[string]bool{}
+		for _, file := range files[i] {
+			for _, spec := range file.Imports {
+				path, err := strconv.Unquote(spec.Path.Value)
+				if err != nil || local[path] || reported[path] {
+					continue
+				}
+				if _, err := gobuild.Default.Import(path, pkg.Dir, 0); err != nil {
+					if _, ok := err.(*gobuild.NoGoError); ok {
+						reported[path] = true
+						errs = append(errs, fmt.Sprintf("%s: package %s is not available for js/wasm", fset.Position(spec.Path.Pos()), path))
+					}
+				}
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return withExitCode(exitType, errors.New(strings.Join(errs, "\n")))
+	}
+	return nil
+}
+
+// splitArgs splits the arguments of the current command at "--". It returns
+// the arguments before it, the ones after it and whether there was a "--" at
+// all. The flag package consumes a "--" which directly follows the flags of
+// the command, so the original command line is checked for it.
+func splitArgs(c *cli.Context) (args []string, rest []string, found bool) {
+	args = c.Args()
+	for i, arg := range os.Args {
+		if arg == "--" {
+			rest = os.Args[i+1:]
+			found = true
+			break
+		}
+	}
+	if !found {
+		return args, nil, false
+	}
+	args = args[:len(args)-len(rest)]
+	if len(args) > 0 && args[len(args)-1] == "--" {
+		args = args[:len(args)-1]
+	}
+	return args, rest, true
+}
+
+// toolchainFlags returns the flags for the go command: those corresponding to
+// the sanitizer flags of the current command, followed by goFlags.
+func toolchainFlags(c *cli.Context, goFlags []string) []string {
+	var flags []string
+	for _, name := range []string{"race", "msan", "asan"} {
+		if c.Bool(name) {
+			flags = append(flags, "-"+name)
+		}
+	}
+	return append(flags, goFlags...)
+}
+
+// goCommand runs the go command with the given subcommand, flags and
+// arguments, connected to the standard input and output of the process. With
+// the -x flag, the command is printed to standard error first.
+func goCommand(c *cli.Context, subcommand string, flags []string, args ...string) error {
+	cmd := exec.Command("go", append(append([]string{subcommand}, flags...), args...)...)
+	if c.Bool("x") {
+		fmt.Fprintln(os.Stderr, strings.Join(cmd.Args, " "))
+	}
 	cmd.Stderr = os.Stderr
 	cmd.Stdout = os.Stdout
 	cmd.Stdin = os.Stdin
-	if err := cmd.Run(); err != nil {
+	return runTool(cmd)
+}
+
+// checkTree type-checks the packages in a directory tree and prints all type
+// errors, like build but without transforming or writing anything.
+func checkTree(c *cli.Context) error {
+	roots, err := patternRoots(c.Args())
+	if err != nil {
+		return err
+	}
+	pkgs, err := loader.LoadRoots(token.NewFileSet(), roots)
+	if err != nil {
+		return fmt.Errorf("failed to load packages: %s", err)
+	}
+	count := 0
+	report := func(err error) {
+		fmt.Fprintln(os.Stderr, err)
+		count++
+	}
+	if _, _, err := checkPackages(c, pkgs, parseMode(c), report, nil); err != nil {
+		switch count {
+		case 0:
+			return err
+		case 1:
+			return withExitCode(exitType, errors.New("found 1 error"))
+		}
+		return withExitCode(exitType, fmt.Errorf("found %d errors", count))
+	}
+	return nil
+}
+
+// runGenerate runs the //go:generate directives of the .fo files in a directory
+// tree, or of a single .fo file, like go generate does for .go files. The
+// files are processed in the order of the packages and of the file names, and
+// the directives of each file in source order; generate stops at the first
+// command which fails.
+func runGenerate(c *cli.Context) error {
+	single := c.NArg() > 0 && strings.HasSuffix(c.Args()[0], ".fo")
+	if single && c.NArg() > 1 {
+		return usageErrorf("generate expects either a single .fo file or package patterns")
+	}
+	var run *regexp.Regexp
+	if expr := c.String("run"); expr != "" {
+		var err error
+		if run, err = regexp.Compile(expr); err != nil {
+			return usageErrorf("invalid --run: %s", err)
+		}
+	}
+	if single {
+		path := c.Args()[0]
+		file, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.PackageClauseOnly)
+		if err != nil {
+			return withExitCode(exitParse, fmt.Errorf("error in '%s': %s", path, err))
+		}
+		return generateFile(c, path, file.Name.Name, run)
+	}
+	roots, err := patternRoots(c.Args())
+	if err != nil {
+		return err
+	}
+	pkgs, err := loader.LoadRoots(token.NewFileSet(), roots)
+	if err != nil {
+		return fmt.Errorf("failed to load packages: %s", err)
+	}
+	for _, pkg := range pkgs {
+		for _, filename := range pkg.FoFiles {
+			if err := generateFile(c, filename, pkg.Name, run); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// generateFile runs the //go:generate directives of the .fo file filename,
+// which belongs to the package pkgName, in the directory of the file.
+//
+// As with go generate, the arguments of a directive are separated by spaces
+// and may be double-quoted Go strings, and $NAME and ${NAME} are expanded in
+// them. Besides the environment, the variables include those set by go
+// generate (GOARCH, GOOS, GOPACKAGE, GOFILE, GOLINE and DOLLAR) and
+// FOFILE and FOLINE, the base name of the .fo file and the line of the
+// directive in it. GOFILE is the base name of the .go file generated from the
+// .fo file, so that tools which read it work once the package is built; GOLINE
+// is the same as FOLINE. A directive "//go:generate -command name args..."
+// defines name as an alias for args in the directives after it in the file.
+func generateFile(c *cli.Context, filename string, pkgName string, run *regexp.Regexp) error {
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	aliases := map[string][]string{}
+	for i, line := range strings.Split(string(src), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if !strings.HasPrefix(line, "//go:generate ") && !strings.HasPrefix(line, "//go:generate\t") {
+			continue
+		}
+		if run != nil && !run.MatchString(line) {
+			continue
+		}
+		pos := fmt.Sprintf("%s:%d", filename, i+1)
+		base := filepath.Base(filename)
+		vars := map[string]string{
+			"GOARCH":    gobuild.Default.GOARCH,
+			"GOOS":      gobuild.Default.GOOS,
+			"GOPACKAGE": pkgName,
+			"GOFILE":    strings.TrimSuffix(base, ".fo") + ".go",
+			"GOLINE":    strconv.Itoa(i + 1),
+			"FOFILE":    base,
+			"FOLINE":    strconv.Itoa(i + 1),
+			"DOLLAR":    "$",
+		}
+		words, err := splitDirective(line[len("//go:generate"):], vars)
+		if err != nil {
+			return fmt.Errorf("%s: %s", pos, err)
+		}
+		if len(words) == 0 {
+			return fmt.Errorf("%s: no arguments to directive", pos)
+		}
+		if words[0] == "-command" {
+			if len(words) < 3 {
+				return fmt.Errorf("%s: -command expects a name and a command", pos)
+			}
+			aliases[words[1]] = words[2:]
+			continue
+		}
+		if alias, ok := aliases[words[0]]; ok {
+			words = append(append([]string{}, alias...), words[1:]...)
+		}
+		if c.Bool("n") || c.Bool("x") {
+			fmt.Fprintln(os.Stderr, strings.Join(words, " "))
+		}
+		if c.Bool("n") {
+			continue
+		}
+		cmd := exec.Command(words[0], words[1:]...)
+		cmd.Dir = filepath.Dir(filename)
+		cmd.Env = os.Environ()
+		for _, name := range []string{"GOARCH", "GOOS", "GOPACKAGE", "GOFILE", "GOLINE", "FOFILE", "FOLINE", "DOLLAR"} {
+			cmd.Env = append(cmd.Env, name+"="+vars[name])
+		}
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := runTool(cmd); err != nil {
+			return withExitCode(exitCode(err), fmt.Errorf("%s: running %q: %s", pos, words[0], err))
+		}
+	}
+	return nil
+}
+
+// splitDirective splits the arguments of a //go:generate directive into words
+// and expands the variables in them, looking them up in vars and then in the
+// environment.
+func splitDirective(args string, vars map[string]string) ([]string, error) {
+	var words []string
+	for {
+		args = strings.TrimLeft(args, " \t")
+		if args == "" {
+			break
+		}
+		var word string
+		if args[0] == '"' {
+			end := 1
+			for ; end < len(args) && args[end] != '"'; end++ {
+				if args[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(args) {
+				return nil, errors.New("unterminated quoted string")
+			}
+			var err error
+			if word, err = strconv.Unquote(args[:end+1]); err != nil {
+				return nil, fmt.Errorf("invalid quoted string %s", args[:end+1])
+			}
+			args = args[end+1:]
+		} else {
+			end := strings.IndexAny(args, " \t")
+			if end < 0 {
+				end = len(args)
+			}
+			word, args = args[:end], args[end:]
+		}
+		words = append(words, os.Expand(word, func(name string) string {
+			if value, ok := vars[name]; ok {
+				return value
+			}
+			return os.Getenv(name)
+		}))
+	}
+	return words, nil
+}
+
+// buildPackages type-checks pkgs in order and then transforms and writes each
+// of their .fo files. pkgs must be sorted in dependency order (as returned by
+// loader.Load) so that each package is checked after the packages it imports,
+// and must share a file set.
+// Every package is checked before any output is written because usages of a
+// generic declaration in one package may require generating new concrete
+// types in the package which declares it.
+func buildPackages(c *cli.Context, pkgs []*loader.Package) error {
+	return buildPackagesTo(c, pkgs, nil)
+}
+
+// buildPackagesTo is like buildPackages, but the files generated for the
+// packages whose directories are keys of publishDirs are written to the
+// corresponding directory instead, with their formatting and comments
+// preserved and a comment which marks them as generated.
+func buildPackagesTo(c *cli.Context, pkgs []*loader.Package, publishDirs map[string]string) error {
+	output := outputOptions{
+		sourceMap:          c.Bool("sourcemap"),
+		lineDirectives:     c.Bool("line-directives"),
+		preserveFormatting: c.Bool("preserve-formatting") || publishDirs != nil,
+		publishDirs:        publishDirs,
+		merge:              c.Bool("merge"),
+		dryRun:             c.Bool("dry-run"),
+		verbose:            c.Bool("verbose"),
+		strictFormat:       c.Bool("strict-format"),
+	}
+	if output.strictFormat && output.preserveFormatting {
+		return usageErrorf("--strict-format cannot be combined with --preserve-formatting or --publish")
+	}
+	if c.Int("max-instances") > 0 || c.Int("max-generated-lines") > 0 {
+		output.budget = &instanceBudget{
+			maxInstances: c.Int("max-instances"),
+			maxLines:     c.Int("max-generated-lines"),
+			generics:     map[string]*genericCode{},
+		}
+	}
+	// A file with errors doesn't stop the others from being built; the errors
+	// are reported together at the end.
+	errs := &buildErrors{}
+	sources, transformers, err := checkPackages(c, pkgs, parseMode(c), nil, errs)
+	if err != nil || len(pkgs) == 0 {
 		return err
 	}
+
+	// The errors of the generated code which concern whole packages are found
+	// before transforming their files, so that they are reported only once.
+	for i, trans := range transformers {
+		if trans == nil {
+			continue
+		}
+		if err := trans.CheckPackage(); err != nil {
+			if list, ok := err.(scanner.ErrorList); ok {
+				for _, err := range list {
+					errs.add(err.Pos.Filename, exitTransform, err)
+				}
+			} else {
+				errs.add(pkgs[i].Dir, exitTransform, err)
+			}
+			transformers[i] = nil
+		}
+	}
+
+	// Transform and write the .fo files of the packages without errors.
+	var foSources []*sourceFile
+	for _, src := range sources {
+		if strings.HasSuffix(src.filename, ".fo") && transformers[src.pkg] != nil {
+			foSources = append(foSources, src)
+		}
+	}
+	if output.merge {
+		pkgSources := make([][]*sourceFile, len(pkgs))
+		for _, src := range foSources {
+			pkgSources[src.pkg] = append(pkgSources[src.pkg], src)
+		}
+		descriptions := make([]string, len(pkgs))
+		parallel(c.Int("jobs"), len(pkgs), func(i int) error {
+			if len(pkgSources[i]) == 0 {
+				return nil
+			}
+			desc, err := writeMerged(transformers[i], pkgs[i], pkgSources[i], output)
+			if err != nil {
+				errs.add(pkgs[i].Dir, exitCode(err), err)
+			}
+			descriptions[i] = desc
+			return nil
+		})
+		for _, desc := range descriptions {
+			fmt.Print(desc)
+		}
+		if err := errs.err(); err != nil {
+			return err
+		}
+		return output.budget.check(c.Bool("werror"))
+	}
+	descriptions := make([]string, len(foSources))
+	parallel(c.Int("jobs"), len(foSources), func(i int) error {
+		src := foSources[i]
+		desc, err := writeTransformed(transformers[src.pkg], src.file, src.filename, src.src, output)
+		if err != nil {
+			errs.add(src.filename, exitCode(err), err)
+			return nil
+		}
+		descriptions[i] = desc
+		return nil
+	})
+	for _, desc := range descriptions {
+		fmt.Print(desc)
+	}
+	if err := errs.err(); err != nil {
+		return err
+	}
+	return output.budget.check(c.Bool("werror"))
+}
+
+// A sourceFile is a parsed source file of one of the packages passed to
+// checkPackages.
+type sourceFile struct {
+	pkg      int // index of the package
+	filename string
+	src      []byte
+	file     *ast.File
+}
+
+// checkPackages parses the .fo and .go files of pkgs with the given mode and
+// type-checks the packages in order. It returns the parsed files and a
+// transformer for each package. pkgs must be sorted in dependency order and
+// share a file set, as for buildPackages.
+//
+// Parsing is spread across the number of workers given by the --jobs flag
+// (or done one file at a time if the command has no such flag). Type checking
+// is always done one package at a time, since checking a package records
+// usages of generic declarations in the packages it imports.
+//
+// If report is not nil, it is called for each type error, so that all errors
+// of a package are found rather than only the first one. Either way, the
+// packages after the first one with errors are not checked.
+//
+// If errs is not nil, checkPackages keeps going instead: the syntax and type
+// errors of each file are added to errs, and the packages with errors, as
+// well as the packages which import them, get no transformer (nor does report
+// get called).
+func checkPackages(c *cli.Context, pkgs []*loader.Package, mode parser.Mode, report func(error), errs *buildErrors) ([]*sourceFile, []*transform.Transformer, error) {
+	if len(pkgs) == 0 {
+		return nil, nil, nil
+	}
+	version, err := goVersion(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	fset := pkgs[0].Fset
+	jobs := c.Int("jobs")
+
+	// Parse the files of all packages.
+	var sources []*sourceFile
+	for i, pkg := range pkgs {
+		for _, filename := range append(append([]string{}, pkg.FoFiles...), pkg.GoFiles...) {
+			sources = append(sources, &sourceFile{pkg: i, filename: filename})
+		}
+	}
+	err = parallel(jobs, len(sources), func(i int) error {
+		verbosef(c, "parse %s", sources[i].filename)
+		src, err := ioutil.ReadFile(sources[i].filename)
+		if err != nil {
+			return fmt.Errorf("error in '%s': %s", sources[i].filename, err)
+		}
+		file, err := parser.ParseFile(fset, sources[i].filename, src, mode)
+		if err != nil && errs != nil {
+			errs.add(sources[i].filename, exitParse, err)
+			return nil
+		}
+		if err != nil {
+			return withExitCode(exitParse, fmt.Errorf("error in '%s': %s", sources[i].filename, err))
+		}
+		sources[i].src = src
+		sources[i].file = file
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	files := make([][]*ast.File, len(pkgs))
+	failed := make([]bool, len(pkgs))
+	for _, src := range sources {
+		if src.file == nil {
+			// The parse error was reported; the package is not checked.
+			failed[src.pkg] = true
+			continue
+		}
+		files[src.pkg] = append(files[src.pkg], src.file)
+	}
+	if c.String("target") == wasmTarget {
+		if err := checkWasmImports(fset, pkgs, files); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Go files which import "C" are not valid Go code by themselves. Run cgo on
+	// them, as the go command does, and check the Fo files against its output.
+	// The cgo files themselves are left alone.
+	cgoFiles := make([][]*ast.File, len(pkgs))
+	err = parallel(jobs, len(pkgs), func(i int) error {
+		pkg := pkgs[i]
+		if failed[i] || len(pkg.CgoFiles) == 0 {
+			return nil
+		}
+		// The #cgo directives of the files are only available from go/build.
+		bp, err := gobuild.ImportDir(pkg.Dir, 0)
+		if err != nil {
+			return fmt.Errorf("error in '%s': %s", pkg.Dir, err)
+		}
+		bp.ImportPath = pkg.ImportPath
+		verbosef(c, "cgo %s", pkg.ImportPath)
+		cgoFiles[i], err = cgo.ProcessFiles(bp, fset, nil, 0)
+		if err != nil {
+			return withExitCode(exitTool, fmt.Errorf("error in '%s': %s", pkg.Dir, err))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range files {
+		files[i] = append(files[i], cgoFiles[i]...)
+	}
+
+	// Check the packages in dependency order. The importer and configuration
+	// are shared by all of them, so that each imported Go package is only read
+	// once.
+	imp := &buildImporter{
+		checked:  map[string]*types.Package{},
+		fallback: importer.Default(),
+	}
+	if c.Bool("download") && !c.Bool("dry-run") {
+		imp.download = func(dir, path string) error {
+			return goGet(c, dir, path)
+		}
+	}
+	conf := checkConfig(c, fset, imp)
+	conf.Error = report
+	failedPaths := map[string]bool{}
+	transformers := make([]*transform.Transformer, len(pkgs))
+	for i, pkg := range pkgs {
+		if errs != nil && !failed[i] {
+			for _, path := range pkg.Imports {
+				if failedPaths[path] {
+					errs.add(pkg.Dir, 0, fmt.Errorf("not built because it imports %s, which has errors", path))
+					failed[i] = true
+					break
+				}
+			}
+		}
+		if failed[i] {
+			failedPaths[pkg.ImportPath] = true
+			continue
+		}
+		if errs != nil {
+			conf.Error = func(err error) {
+				errs.add(errorFile(err, pkg.Dir), exitType, err)
+			}
+		}
+		info := &types.Info{
+			Types:            map[ast.Expr]types.TypeAndValue{},
+			Selections:       map[*ast.SelectorExpr]*types.Selection{},
+			TypeArgs:         map[*ast.IndexExpr]*ast.TypeArgExpr{},
+			InferredTypeArgs: map[ast.Expr][]types.Type{},
+			Uses:             map[*ast.Ident]types.Object{},
+		}
+		verbosef(c, "check %s", pkg.ImportPath)
+		imp.dir = pkg.Dir
+		checked, err := conf.Check(pkg.ImportPath, fset, files[i], info)
+		if err != nil && errs != nil {
+			failedPaths[pkg.ImportPath] = true
+			continue
+		}
+		if err != nil {
+			return nil, nil, withExitCode(exitType, fmt.Errorf("error in '%s': %s", pkg.Dir, err))
+		}
+		imp.checked[pkg.ImportPath] = checked
+		transformers[i] = &transform.Transformer{
+			Fset:                fset,
+			Pkg:                 checked,
+			Info:                info,
+			SourceOrder:         c.Bool("source-order"),
+			UnexportedInstances: c.Bool("unexported-instances"),
+			GoVersion:           version,
+		}
+	}
+	// The packages may refer to each other's instances, whose names must
+	// then agree.
+	var shared []*transform.Transformer
+	for _, trans := range transformers {
+		if trans != nil {
+			shared = append(shared, trans)
+		}
+	}
+	transform.ShareNames(shared)
+	return sources, transformers, nil
+}
+
+// buildErrors collects the errors of a build by file, or by directory for the
+// errors which concern a whole package, so that one broken file does not hide
+// the problems of the rest of the tree. It is safe for concurrent use.
+type buildErrors struct {
+	mu      sync.Mutex
+	entries []buildError
+}
+
+type buildError struct {
+	file string
+	code int // exit code; 0 for a package which was skipped
+	err  error
+}
+
+// add records err for file. The errors of a scanner.ErrorList are recorded
+// one by one.
+func (errs *buildErrors) add(file string, code int, err error) {
+	errs.mu.Lock()
+	defer errs.mu.Unlock()
+	if list, ok := err.(scanner.ErrorList); ok {
+		for _, err := range list {
+			errs.entries = append(errs.entries, buildError{file: file, code: code, err: err})
+		}
+		return
+	}
+	errs.entries = append(errs.entries, buildError{file: file, code: code, err: err})
+}
+
+// err returns the recorded errors grouped by file, with files sorted by name
+// and the errors of each file in the order in which they were found, or nil if
+// there are none. It has the exit code of the errors if they all have the same
+// one, and exitFailure otherwise.
+func (errs *buildErrors) err() error {
+	errs.mu.Lock()
+	defer errs.mu.Unlock()
+	if len(errs.entries) == 0 {
+		return nil
+	}
+	entries := append([]buildError{}, errs.entries...)
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].file < entries[j].file })
+	var groups []string
+	count, files, code := 0, 0, 0
+	for i := 0; i < len(entries); {
+		j := i
+		failed := false
+		for j < len(entries) && entries[j].file == entries[i].file {
+			if c := entries[j].code; c != 0 {
+				count++
+				failed = true
+				if code == 0 {
+					code = c
+				} else if code != c {
+					code = exitFailure
+				}
+			}
+			j++
+		}
+		if failed {
+			files++
+		}
+		if j-i == 1 {
+			groups = append(groups, fmt.Sprintf("error in '%s': %s", entries[i].file, entries[i].err))
+		} else {
+			msgs := make([]string, j-i)
+			for k := range msgs {
+				msgs[k] = "\t" + entries[i+k].err.Error()
+			}
+			groups = append(groups, fmt.Sprintf("errors in '%s':\n%s", entries[i].file, strings.Join(msgs, "\n")))
+		}
+		i = j
+	}
+	if code == 0 {
+		code = exitFailure
+	}
+	summary := fmt.Sprintf("found %d errors in %d files", count, files)
+	switch {
+	case count == 1:
+		summary = "found 1 error"
+	case files == 1:
+		summary = fmt.Sprintf("found %d errors in 1 file", count)
+	}
+	return withExitCode(code, errors.New(summary+"\n"+strings.Join(groups, "\n")))
+}
+
+// errorFile returns the name of the file in which err, a type error, was
+// found, or dir if it has no position.
+func errorFile(err error, dir string) string {
+	if terr, ok := err.(types.Error); ok && terr.Fset != nil {
+		if pos := terr.Fset.Position(terr.Pos); pos.Filename != "" {
+			return pos.Filename
+		}
+	}
+	return dir
+}
+
+// verbosef logs a step of the build to standard error if the --verbose flag
+// is set.
+func verbosef(c *cli.Context, format string, args ...interface{}) {
+	if c.Bool("verbose") {
+		fmt.Fprintf(os.Stderr, format+"\n", args...)
+	}
+}
+
+// parallel calls f for each index in [0, n) using up to jobs goroutines. It
+// waits for all calls to return. The errors returned by f are combined in
+// order of their indices, so the result does not depend on scheduling. The
+// combined error has the exit code of the errors if they all have the same
+// one, and exitFailure otherwise.
+func parallel(jobs int, n int, f func(i int) error) error {
+	if jobs < 1 {
+		jobs = 1
+	}
+	if jobs > n {
+		jobs = n
+	}
+	errs := make([]error, n)
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				errs[i] = f(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+
+	var msgs []string
+	code := 0
+	for _, err := range errs {
+		if err != nil {
+			msgs = append(msgs, err.Error())
+			if code == 0 {
+				code = exitCode(err)
+			} else if code != exitCode(err) {
+				code = exitFailure
+			}
+		}
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return withExitCode(code, errors.New(strings.Join(msgs, "\n")))
+}
+
+// parseMode returns the mode for parsing the source files of the current
+// command. Comments are always parsed, since they may hold pragmas such as
+// //fo:instantiate, but they are only printed when declarations are copied
+// verbatim.
+func parseMode(c *cli.Context) parser.Mode {
+	mode := parser.ParseComments
+	if c.Bool("go-type-params") {
+		mode |= parser.GoTypeParams
+	}
+	return mode
+}
+
+// outputOptions controls what is written for each transformed file.
+type outputOptions struct {
+	sourceMap          bool              // write the source map to a .go.map file
+	lineDirectives     bool              // add //line directives which refer to the .fo file
+	preserveFormatting bool              // copy unchanged declarations from the .fo file
+	header             bool              // start the file with a comment which marks it as generated
+	publishDirs        map[string]string // output directories by package directory; see buildPackagesTo
+	merge              bool              // write one file per package; see writeMerged
+	dryRun             bool              // describe the output instead of writing it; see writeTransformed
+	verbose            bool              // log each transformed file and its instantiations to standard error
+	strictFormat       bool              // format the generated code with format.StrictNode
+	budget             *instanceBudget   // collect the generated instantiations; see instanceBudget
+}
+
+// writeTransformed transforms f and writes the result to a .go file next to
+// the .fo file it was parsed from, or to the publish directory of its package.
+// src is the content of the .fo file.
+//
+// If opts.dryRun is set, nothing is written. Instead, the result describes
+// the files which would be written, one per line, and lists the
+// instantiations of generic declarations generated in the .go file.
+func writeTransformed(trans *transform.Transformer, f *ast.File, filename string, src []byte, opts outputOptions) (string, error) {
+	outputName := strings.TrimSuffix(filename, ".fo") + ".go"
+	if dir, found := opts.publishDirs[filepath.Dir(filename)]; found {
+		outputName = filepath.Join(dir, filepath.Base(outputName))
+		opts.header = true
+	}
+	// The source map lists the generated declarations.
+	writeMap := opts.sourceMap
+	opts.sourceMap = writeMap || opts.dryRun || opts.verbose || opts.budget != nil
+	out, sm, err := generate(trans, f, src, outputName, opts)
+	if err != nil {
+		return "", withExitCode(exitTransform, err)
+	}
+	opts.budget.add(trans.Pkg.Path(), sm)
+	if opts.verbose {
+		fmt.Fprintf(os.Stderr, "transform %s -> %s\n%s", filename, outputName, instantiations(sm))
+	}
+	if opts.dryRun {
+		desc := fmt.Sprintf("%s %s\n%s", writeVerb(outputName), outputName, instantiations(sm))
+		if writeMap {
+			desc += fmt.Sprintf("%s %s\n", writeVerb(outputName+".map"), outputName+".map")
+		}
+		return desc, nil
+	}
+	if writeMap {
+		data, err := json.MarshalIndent(sm, "", "\t")
+		if err != nil {
+			return "", err
+		}
+		if err := writeFile(outputName+".map", append(data, '\n'), 0644); err != nil {
+			return "", err
+		}
+	}
+	return "", writeFile(outputName, out, 0644)
+}
+
+// mergedFile returns the name of the file to which the Go code generated for
+// pkg is written with --merge: loader.MergedFile, or loader.MergedTestFile for
+// an external test package.
+func mergedFile(pkg *loader.Package) string {
+	if pkg.XTest {
+		return filepath.Join(pkg.Dir, loader.MergedTestFile)
+	}
+	return filepath.Join(pkg.Dir, loader.MergedFile)
+}
+
+// writeMerged transforms srcs, the .fo files of pkg, and writes the result to
+// a single file in the directory of the package (see mergedFile). Like
+// writeTransformed, it only describes the file with opts.dryRun.
+func writeMerged(trans *transform.Transformer, pkg *loader.Package, srcs []*sourceFile, opts outputOptions) (string, error) {
+	outputName := mergedFile(pkg)
+	var files []*ast.File
+	var filenames []string
+	for _, src := range srcs {
+		if platformSpecific(src.filename) {
+			return "", withExitCode(exitTransform, fmt.Errorf("error in '%s': cannot merge a file whose name restricts it to some platforms", src.filename))
+		}
+		transformed, _, err := trans.File(src.file)
+		if err != nil {
+			return "", withExitCode(exitTransform, fmt.Errorf("error in '%s': %s", src.filename, err))
+		}
+		files = append(files, transformed)
+		filenames = append(filenames, src.filename)
+	}
+	merged, err := trans.Merge(files)
+	if err != nil {
+		return "", withExitCode(exitTransform, err)
+	}
+	buf := &bytes.Buffer{}
+	fset, renumbered := trans.Renumber(merged, outputName)
+	if err := formatOutput(buf, fset, renumbered, opts); err != nil {
+		return "", withExitCode(exitTransform, err)
+	}
+	out := buf.Bytes()
+	if opts.dryRun || opts.verbose || opts.budget != nil {
+		// The source map lists the generated declarations.
+		sm, err := trans.SourceMap(merged, outputName, out)
+		if err != nil {
+			return "", withExitCode(exitTransform, err)
+		}
+		opts.budget.add(trans.Pkg.Path(), sm)
+		if opts.verbose {
+			fmt.Fprintf(os.Stderr, "transform %s -> %s\n%s", strings.Join(filenames, ", "), outputName, instantiations(sm))
+		}
+		if opts.dryRun {
+			return fmt.Sprintf("%s %s\n%s", writeVerb(outputName), outputName, instantiations(sm)), nil
+		}
+	}
+	return "", writeFile(outputName, out, 0644)
+}
+
+// formatOutput formats the generated file f with format.Node, or with
+// format.StrictNode if opts.strictFormat is set.
+func formatOutput(dst io.Writer, fset *token.FileSet, f *ast.File, opts outputOptions) error {
+	if opts.strictFormat {
+		return format.StrictNode(dst, fset, f)
+	}
+	return format.Node(dst, fset, f)
+}
+
+// platformSpecific reports whether the name of the .fo file filename restricts
+// it to some operating systems or architectures, as in file_linux.fo.
+func platformSpecific(filename string) bool {
+	ctxt := gobuild.Default
+	ctxt.GOOS, ctxt.GOARCH = "none", "none"
+	ctxt.OpenFile = func(string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader("package p\n")), nil
+	}
+	match, err := ctxt.MatchFile(filepath.Dir(filename), strings.TrimSuffix(filepath.Base(filename), ".fo")+".go")
+	return err == nil && !match
+}
+
+// removeStaleOutputs removes the files generated by an earlier build of pkgs
+// which conflict with the files written by buildPackages: the .go files (and
+// source maps) generated for single .fo files if the --merge flag is set, and
+// the merged files otherwise. With --dry-run, the files are only listed.
+func removeStaleOutputs(c *cli.Context, pkgs []*loader.Package) error {
+	var stale []string
+	for _, pkg := range pkgs {
+		if !c.Bool("merge") {
+			stale = append(stale, mergedFile(pkg))
+			continue
+		}
+		for _, filename := range pkg.FoFiles {
+			outputName := strings.TrimSuffix(filename, ".fo") + ".go"
+			stale = append(stale, outputName, outputName+".map")
+		}
+	}
+	for _, name := range stale {
+		if _, err := os.Stat(name); err != nil {
+			continue
+		}
+		if c.Bool("dry-run") {
+			fmt.Printf("remove %s\n", name)
+			continue
+		}
+		if c.Bool("verbose") {
+			fmt.Fprintf(os.Stderr, "remove %s\n", name)
+		}
+		if err := os.Remove(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// instantiations lists the instantiations of generic types, functions and
+// methods in the generated file described by sm, one per indented line, e.g.
+// "\tBox[int] as Box__int".
+func instantiations(sm *transform.SourceMap) string {
+	var buf bytes.Buffer
+	for _, decl := range sm.Decls {
+		if decl.Generic == "" {
+			continue
+		}
+		if i := strings.LastIndex(decl.Name, "."); i >= 0 && strings.HasSuffix(decl.Generic, decl.Name[i:]) {
+			// a method without type parameters of its own, which is
+			// generated along with its receiver type
+			continue
+		}
+		fmt.Fprintf(&buf, "\t%s[%s] as %s\n", decl.Generic, strings.Join(decl.TypeArgs, ", "), decl.Name)
+	}
+	return buf.String()
+}
+
+// An instanceBudget collects the code generated for the instantiations of
+// generic types and functions in a build, so that fo can warn about those
+// which generate too much of it (see the --max-instances and
+// --max-generated-lines flags). Monomorphization makes each instantiation a
+// copy of the generic code, which adds to the size of the binary.
+//
+// The methods of instanceBudget do nothing if it is nil.
+type instanceBudget struct {
+	maxInstances int // maximum number of instantiations of each generic declaration, or 0
+	maxLines     int // maximum number of generated lines in total, or 0
+
+	sync.Mutex
+	generics map[string]*genericCode // by import path and name of the generic declaration
+}
+
+// genericCode describes the code generated for a generic declaration.
+type genericCode struct {
+	name      string          // name of the generic declaration
+	pos       string          // position of the generic declaration, if known
+	instances map[string]bool // type arguments of the instantiations, joined by ", "
+	lines     int             // number of generated lines, including methods of generic types
+}
+
+// add records the instantiations in the generated file of the package with
+// the import path pkgPath described by sm.
+func (b *instanceBudget) add(pkgPath string, sm *transform.SourceMap) {
+	if b == nil {
+		return
+	}
+	b.Lock()
+	defer b.Unlock()
+	for _, decl := range sm.Decls {
+		if decl.Generic == "" {
+			continue
+		}
+		name := decl.Generic
+		if i := strings.LastIndex(decl.Name, "."); i >= 0 && strings.HasSuffix(decl.Generic, decl.Name[i:]) {
+			// a method without type parameters of its own, which is part
+			// of the code of its receiver type
+			name = strings.TrimSuffix(decl.Generic, decl.Name[i:])
+		}
+		gen := b.generics[pkgPath+"."+name]
+		if gen == nil {
+			gen = &genericCode{name: name, instances: map[string]bool{}}
+			b.generics[pkgPath+"."+name] = gen
+		}
+		if gen.pos == "" && name == decl.Generic && decl.SourceLine > 0 {
+			gen.pos = fmt.Sprintf("%s:%d", sm.Source, decl.SourceLine)
+		}
+		gen.instances[strings.Join(decl.TypeArgs, ", ")] = true
+		gen.lines += decl.EndLine - decl.Line + 1
+	}
+}
+
+// check reports the generic declarations with more than b.maxInstances
+// instantiations, and the ones which generate the most code if more than
+// b.maxLines lines are generated in total. The reports are warnings, unless
+// werror is set.
+func (b *instanceBudget) check(werror bool) error {
+	if b == nil {
+		return nil
+	}
+	var generics []*genericCode
+	total := 0
+	for _, gen := range b.generics {
+		generics = append(generics, gen)
+		total += gen.lines
+	}
+	var reports []string
+	if b.maxInstances > 0 {
+		sort.Slice(generics, func(i, j int) bool {
+			if len(generics[i].instances) != len(generics[j].instances) {
+				return len(generics[i].instances) > len(generics[j].instances)
+			}
+			return generics[i].String() < generics[j].String()
+		})
+		for _, gen := range generics {
+			if len(gen.instances) > b.maxInstances {
+				reports = append(reports, fmt.Sprintf("%s has %s (more than %d)", gen, countInstances(len(gen.instances)), b.maxInstances))
+			}
+		}
+	}
+	if b.maxLines > 0 && total > b.maxLines {
+		sort.Slice(generics, func(i, j int) bool {
+			if generics[i].lines != generics[j].lines {
+				return generics[i].lines > generics[j].lines
+			}
+			return generics[i].String() < generics[j].String()
+		})
+		// The top offenders are listed.
+		const top = 5
+		if len(generics) > top {
+			generics = generics[:top]
+		}
+		report := fmt.Sprintf("%d lines of code are generated for instantiations of generics (more than %d), most of them for:", total, b.maxLines)
+		for _, gen := range generics {
+			report += fmt.Sprintf("\n\t%s: %d lines, %s", gen, gen.lines, countInstances(len(gen.instances)))
+		}
+		reports = append(reports, report)
+	}
+	if werror && len(reports) > 0 {
+		return withExitCode(exitType, errors.New(strings.Join(reports, "\n")))
+	}
+	for _, report := range reports {
+		printWarning(errors.New(report))
+	}
+	return nil
+}
+
+// countInstances returns "1 instantiation" or "n instantiations".
+func countInstances(n int) string {
+	if n == 1 {
+		return "1 instantiation"
+	}
+	return fmt.Sprintf("%d instantiations", n)
+}
+
+// String returns the name of the generic declaration, preceded by its
+// position if it is known.
+func (gen *genericCode) String() string {
+	if gen.pos == "" {
+		return gen.name
+	}
+	return gen.pos + ": " + gen.name
+}
+
+// writeVerb returns "overwrite" if the file name exists and "write" otherwise,
+// for describing the output of a dry run.
+func writeVerb(name string) string {
+	if _, err := os.Stat(name); err == nil {
+		return "overwrite"
+	}
+	return "write"
+}
+
+// tempFiles holds the names of the temporary files of writeFile, so that they
+// can be removed when fo is interrupted (see removeTempFilesOnInterrupt).
+var tempFiles = struct {
+	sync.Mutex
+	names   map[string]bool
+	signals chan os.Signal
+}{names: map[string]bool{}}
+
+// writeFile writes data to the file filename like ioutil.WriteFile, but
+// atomically: data is written to a temporary file in the same directory,
+// which then replaces filename. An interrupted build thus leaves either the
+// old or the new content behind, never a truncated file which breaks the next
+// go build. The name of the temporary file starts with a dot, so that the go
+// command ignores it in the meantime.
+func writeFile(filename string, data []byte, perm os.FileMode) error {
+	tempFiles.Lock()
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp")
+	if err == nil {
+		if len(tempFiles.names) == 0 {
+			removeTempFilesOnInterrupt()
+		}
+		tempFiles.names[tmp.Name()] = true
+	}
+	tempFiles.Unlock()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tempFiles.Lock()
+		delete(tempFiles.names, tmp.Name())
+		if len(tempFiles.names) == 0 {
+			signal.Stop(tempFiles.signals)
+		}
+		tempFiles.Unlock()
+	}()
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), perm)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filename)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// removeTempFilesOnInterrupt makes fo remove the temporary files of writeFile
+// which are still being written and exit with exitFailure when it is
+// interrupted (or terminated). writeFile calls it, with tempFiles locked, when
+// it creates the first of them, and stops the handling of the signals once
+// they are all gone, so that they keep their default behavior otherwise.
+func removeTempFilesOnInterrupt() {
+	if tempFiles.signals == nil {
+		tempFiles.signals = make(chan os.Signal, 1)
+		go func() {
+			<-tempFiles.signals
+			// The lock is kept, so that no more temporary files are created.
+			tempFiles.Lock()
+			for name := range tempFiles.names {
+				os.Remove(name)
+			}
+			os.Exit(exitFailure)
+		}()
+	}
+	signal.Notify(tempFiles.signals, os.Interrupt, syscall.SIGTERM)
+}
+
+// runTool runs cmd, a tool such as the go command or Delve, and returns an
+// error with exitTool as its exit code if it fails. An interrupt, which the
+// terminal sends to the tool as well, is ignored by fo until the tool exits,
+// so that fo does not exit before it, e.g. when Ctrl-C stops the program being
+// debugged in Delve. If the tool is killed by a signal, the exit code is 128
+// plus the number of the signal instead, as shells report it.
+func runTool(cmd *exec.Cmd) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	defer signal.Stop(signals)
+	err := cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return withExitCode(128+int(status.Signal()), err)
+		}
+	}
+	return withExitCode(exitTool, err)
+}
+
+// generate transforms f, which was parsed from foSrc, and returns the
+// formatted Go code for the file outputName. If opts require a source map, it
+// is returned as well.
+func generate(trans *transform.Transformer, f *ast.File, foSrc []byte, outputName string, opts outputOptions) ([]byte, *transform.SourceMap, error) {
+	var transformed *ast.File
+	var src []byte
+	if opts.preserveFormatting {
+		var err error
+		if transformed, src, err = trans.FilePreserving(f, foSrc); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		var err error
+		if transformed, _, err = trans.File(f); err != nil {
+			return nil, nil, err
+		}
+		buf := &bytes.Buffer{}
+		fset, renumbered := trans.Renumber(transformed, outputName)
+		if err := formatOutput(buf, fset, renumbered, opts); err != nil {
+			return nil, nil, err
+		}
+		src = buf.Bytes()
+	}
+	if opts.header {
+		foName := filepath.Base(trans.Fset.Position(f.Package).Filename)
+		src = append([]byte("// Code generated by fo from "+foName+". DO NOT EDIT.\n\n"), src...)
+	}
+	if !opts.sourceMap && !opts.lineDirectives {
+		return src, nil, nil
+	}
+	sm, err := trans.SourceMap(transformed, outputName, src)
+	if err != nil {
+		return nil, nil, err
+	}
+	if opts.lineDirectives {
+		if src, err = sm.LineDirectives(src); err != nil {
+			return nil, nil, err
+		}
+	}
+	return src, sm, nil
+}
+
+// publish builds pkgs, which were loaded from the tree root, and writes a
+// copy of the tree which can be built by the go command alone to dir. For each
+// package in the tree, the directory at the same relative path below dir gets
+// the generated .go files, the .go files of the package, and its license and
+// documentation files (see isPublishedFile). The go.mod and go.sum files and
+// the license and documentation files of root are copied as well. Packages
+// outside of the tree (e.g. those of other modules in a workspace) are built
+// as usual. With --dry-run, the files are only listed.
+func publish(c *cli.Context, pkgs []*loader.Package, root string, dir string) error {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	dryRun := c.Bool("dry-run")
+	publishDirs := map[string]string{}
+	copies := map[string]string{} // source file names by target file name
+	addCopies := func(srcDir, targetDir string, names []string) error {
+		if !dryRun {
+			if err := os.MkdirAll(targetDir, 0755); err != nil {
+				return err
+			}
+		}
+		for _, name := range names {
+			copies[filepath.Join(targetDir, filepath.Base(name))] = filepath.Join(srcDir, filepath.Base(name))
+		}
+		return nil
+	}
+	rootFiles, err := publishedFiles(root)
+	if err != nil {
+		return err
+	}
+	if err := addCopies(root, dir, rootFiles); err != nil {
+		return err
+	}
+	for _, pkg := range pkgs {
+		pkgDir, err := filepath.Abs(pkg.Dir)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, pkgDir)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		target := filepath.Join(dir, rel)
+		publishDirs[filepath.Clean(pkg.Dir)] = target
+		docFiles, err := publishedFiles(pkgDir)
+		if err != nil {
+			return err
+		}
+		names := append(append(append([]string{}, pkg.GoFiles...), pkg.CgoFiles...), docFiles...)
+		if err := addCopies(pkgDir, target, names); err != nil {
+			return err
+		}
+	}
+	if err := buildPackagesTo(c, pkgs, publishDirs); err != nil {
+		return err
+	}
+	targets := make([]string, 0, len(copies))
+	for target := range copies {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	for _, target := range targets {
+		if dryRun {
+			fmt.Printf("%s %s (copy of %s)\n", writeVerb(target), target, copies[target])
+			continue
+		}
+		data, err := ioutil.ReadFile(copies[target])
+		if err != nil {
+			return err
+		}
+		if err := writeFile(target, data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// publishedFiles returns the names of the files in dir which are copied by
+// publish besides the .go files: go.mod, go.sum and license and documentation
+// files such as LICENSE, NOTICE or README.md.
+func publishedFiles(dir string) ([]string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, info := range infos {
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		name := info.Name()
+		if name == "go.mod" || name == "go.sum" {
+			names = append(names, name)
+			continue
+		}
+		upper := strings.ToUpper(name)
+		for _, prefix := range []string{"LICENSE", "LICENCE", "COPYING", "NOTICE", "PATENTS", "AUTHORS", "README"} {
+			if strings.HasPrefix(upper, prefix) {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	return names, nil
+}
+
+// buildImporter resolves imports of packages which were already checked as
+// part of the current build and uses fallback for everything else.
+type buildImporter struct {
+	checked  map[string]*types.Package
+	fallback types.Importer
+
+	// If download is set, it is called with the path of each package
+	// outside the standard library which cannot be imported and dir, the
+	// directory of the package being checked, and the import is then
+	// retried once (see the --download flag).
+	download func(dir, path string) error
+	dir      string
+}
+
+func (imp *buildImporter) Import(path string) (*types.Package, error) {
+	if pkg, found := imp.checked[path]; found {
+		return pkg, nil
+	}
+	pkg, err := imp.fallback.Import(path)
+	if err == nil || !downloadable(path) {
+		return pkg, err
+	}
+	if imp.download == nil {
+		return nil, fmt.Errorf("%s; it may be missing from the module cache (pass --download to fo build or fo run to download it)", err)
+	}
+	if err := imp.download(imp.dir, path); err != nil {
+		return nil, fmt.Errorf("could not download %s: %s", path, err)
+	}
+	return imp.fallback.Import(path)
+}
+
+// downloadable reports whether the import path path may be downloaded, i.e.
+// whether its first element contains a dot like a domain name. The paths of
+// the standard library don't.
+func downloadable(path string) bool {
+	first := strings.SplitN(path, "/", 2)[0]
+	return strings.Contains(first, ".")
+}
+
+// goGet runs go get for the import path path in the directory dir, which
+// adds the module that provides it to the go.mod file of dir (in module mode)
+// and downloads it. The output of the go command is part of the error if it
+// fails.
+func goGet(c *cli.Context, dir, path string) error {
+	cmd := exec.Command("go", "get", path)
+	cmd.Dir = dir
+	if c.Bool("x") {
+		fmt.Fprintln(os.Stderr, strings.Join(cmd.Args, " "))
+	}
+	verbosef(c, "download %s", path)
+	out, err := cmd.CombinedOutput()
+	if msg := strings.TrimSpace(string(out)); err != nil && msg != "" {
+		return errors.New(msg)
+	}
+	return err
+}
+
+func run(c *cli.Context) error {
+	// Read arguments and open file.
+	args, goFlags, _ := splitArgs(c)
+	if len(args) != 1 {
+		return usageErrorf("run expects exactly one argument: the name of a Fo file to run (or - for standard input)")
+	}
+	path := args[0]
+	if path == "-" {
+		// The go command can only run files, so the source is copied to a
+		// temporary one.
+		src, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		dir, err := ioutil.TempDir("", "fo-run")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		path = filepath.Join(dir, "main.fo")
+		if err := ioutil.WriteFile(path, src, 0644); err != nil {
+			return err
+		}
+	}
+	outputName, err := buildFile(c, path)
+	if err != nil {
+		return err
+	}
+
+	// Invoke Go command to run the resulting Go code.
+	return goCommand(c, "run", toolchainFlags(c, goFlags), outputName)
+}
+
+func debug(c *cli.Context) error {
+	args, programArgs, _ := splitArgs(c)
+	if len(args) != 1 {
+		return usageErrorf("debug expects exactly one argument: the name of a Fo file to debug")
+	}
+	dlv, err := exec.LookPath("dlv")
+	if err != nil {
+		return errors.New("could not find dlv (install it with 'go install github.com/go-delve/delve/cmd/dlv@latest')")
+	}
+	outputName, err := buildFile(c, args[0])
+	if err != nil {
+		return err
+	}
+
+	// Build the resulting Go code without optimizations and run it under
+	// Delve. Because of the line directives, Delve refers to the .fo file.
+	dir, err := ioutil.TempDir("", "fo-debug")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	binary := filepath.Join(dir, strings.TrimSuffix(filepath.Base(outputName), ".go"))
+	if err := goCommand(c, "build", []string{"-gcflags=all=-N -l", "-o", binary}, outputName); err != nil {
+		return err
+	}
+	dlvArgs := []string{"exec", binary}
+	if len(programArgs) > 0 {
+		dlvArgs = append(append(dlvArgs, "--"), programArgs...)
+	}
+	cmd := exec.Command(dlv, dlvArgs...)
+	cmd.Stderr = os.Stderr
+	cmd.Stdout = os.Stdout
+	cmd.Stdin = os.Stdin
+	return runTool(cmd)
+}
+
+// transpile reads a Fo file from standard input and writes the generated Go
+// code to standard output. The file is treated as a package of its own.
+func transpile(c *cli.Context) error {
+	if c.NArg() > 0 {
+		return usageErrorf("transpile reads from standard input and does not take any arguments")
+	}
+	version, err := goVersion(c)
+	if err != nil {
+		return err
+	}
+	src, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return err
+	}
+	filename := c.String("filename")
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, parseMode(c))
+	if err != nil {
+		return withExitCode(exitParse, err)
+	}
+	conf := checkConfig(c, fset, importer.Default())
+	info := &types.Info{
+		Types:            map[ast.Expr]types.TypeAndValue{},
+		Selections:       map[*ast.SelectorExpr]*types.Selection{},
+		TypeArgs:         map[*ast.IndexExpr]*ast.TypeArgExpr{},
+		InferredTypeArgs: map[ast.Expr][]types.Type{},
+		Uses:             map[*ast.Ident]types.Object{},
+	}
+	pkg, err := conf.Check(f.Name.Name, fset, []*ast.File{f}, info)
+	if err != nil {
+		return withExitCode(exitType, err)
+	}
+	trans := &transform.Transformer{
+		Fset:                fset,
+		Pkg:                 pkg,
+		Info:                info,
+		SourceOrder:         c.Bool("source-order"),
+		UnexportedInstances: c.Bool("unexported-instances"),
+		GoVersion:           version,
+	}
+	output := outputOptions{
+		lineDirectives:     c.Bool("line-directives"),
+		preserveFormatting: c.Bool("preserve-formatting"),
+		strictFormat:       c.Bool("strict-format"),
+	}
+	if output.strictFormat && output.preserveFormatting {
+		return usageErrorf("--strict-format cannot be combined with --preserve-formatting")
+	}
+	out, _, err := generate(trans, f, src, strings.TrimSuffix(filename, ".fo")+".go", output)
+	if err != nil {
+		return withExitCode(exitTransform, err)
+	}
+	_, err = os.Stdout.Write(out)
+	return err
+}
+
+// migrate converts the .fo files of all packages in a directory tree to .go
+// files which use Go type parameters instead of generated declarations. The
+// constructs which have no equivalent in Go are reported for all files before
+// anything is written, so that either the whole tree is migrated or nothing.
+func migrate(c *cli.Context) error {
+	if c.NArg() > 1 {
+		return usageErrorf("migrate expects at most one argument: the directory containing the packages to migrate")
+	}
+	path := "."
+	if c.NArg() == 1 {
+		path = c.Args()[0]
+	}
+	pkgs, err := loader.LoadFileSet(token.NewFileSet(), path)
+	if err != nil {
+		return fmt.Errorf("failed to load packages: %s", err)
+	}
+	// The comments of the .fo files are kept in the migrated code.
+	sources, transformers, err := checkPackages(c, pkgs, parseMode(c)|parser.ParseComments, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	var errs scanner.ErrorList
+	migrated := map[string][]byte{}
+	var filenames []string
+	for _, src := range sources {
+		if !strings.HasSuffix(src.filename, ".fo") {
+			continue
+		}
+		out, err := transformers[src.pkg].Migrate(src.file, src.src)
+		if list, ok := err.(scanner.ErrorList); ok {
+			errs = append(errs, list...)
+			continue
+		} else if err != nil {
+			return withExitCode(exitTransform, fmt.Errorf("error in '%s': %s", src.filename, err))
+		}
+		outputName := strings.TrimSuffix(src.filename, ".fo") + ".go"
+		migrated[outputName] = out
+		filenames = append(filenames, outputName)
+	}
+	if len(errs) > 0 {
+		scanner.PrintError(os.Stderr, errs)
+		return withExitCode(exitTransform, fmt.Errorf("found %d constructs which have no equivalent in Go; no files were written", len(errs)))
+	}
+
+	for _, filename := range filenames {
+		if err := writeFile(filename, migrated[filename], 0644); err != nil {
+			return err
+		}
+		fmt.Println(filename)
+	}
+	return nil
+}
+
+// goToFo converts the Go files of the package in a directory to Fo and writes
+// each of them to a .fo file next to it. Test files and files which were
+// generated from a .fo file are left alone.
+func goToFo(c *cli.Context) error {
+	if c.NArg() > 1 {
+		return usageErrorf("go2fo expects at most one argument: the directory containing the package to convert")
+	}
+	dir := "."
+	if c.NArg() == 1 {
+		dir = c.Args()[0]
+	}
+	matches, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return err
+	}
+	var filenames []string
+	for _, filename := range matches {
+		if strings.HasSuffix(filename, "_test.go") {
+			continue
+		}
+		if _, err := os.Stat(strings.TrimSuffix(filename, ".go") + ".fo"); err == nil {
+			continue
+		}
+		filenames = append(filenames, filename)
+	}
+	if len(filenames) == 0 {
+		return fmt.Errorf("no Go files to convert in %s", dir)
+	}
+
+	converted, err := go2fo.Convert(filenames)
+	if list, ok := err.(scanner.ErrorList); ok {
+		scanner.PrintError(os.Stderr, list)
+		return withExitCode(exitTransform, fmt.Errorf("found %d constructs which have no equivalent in Fo; no files were written", len(list)))
+	} else if err != nil {
+		return err
+	}
+	var outputNames []string
+	for filename := range converted {
+		outputNames = append(outputNames, filename)
+	}
+	sort.Strings(outputNames)
+	for _, filename := range outputNames {
+		if err := writeFile(filename, converted[filename], 0644); err != nil {
+			return err
+		}
+		fmt.Println(filename)
+	}
+	return nil
+}
+
+func runQuery(c *cli.Context) error {
+	args := c.Args()
+	if len(args) != 2 {
+		return usageErrorf("query expects exactly two arguments: the kind of query (definition, referrers, references or implements) and a position of the form <filename>:<line>:<column>")
+	}
+	filename, line, col, err := parsePosition(args[1])
+	if err != nil {
+		return err
+	}
+	prog, err := query.Load(c.String("root"), importer.Default())
+	if err != nil {
+		return fmt.Errorf("failed to load packages: %s", err)
+	}
+	results := []query.Result{}
+	switch args[0] {
+	case "definition":
+		result, err := prog.Definition(filename, line, col)
+		if err != nil {
+			return err
+		}
+		results = append(results, result)
+	case "referrers":
+		results, err = prog.Referrers(filename, line, col)
+	case "references":
+		results, err = prog.References(filename, line, col, c.Bool("generated"))
+	case "implements":
+		results, err = prog.Implements(filename, line, col)
+	default:
+		return usageErrorf("unknown query %q (expected definition, referrers, references or implements)", args[0])
+	}
+	if err != nil {
+		return err
+	}
+	if c.Bool("json") {
+		if results == nil {
+			results = []query.Result{}
+		}
+		data, err := json.MarshalIndent(results, "", "\t")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	for _, result := range results {
+		fmt.Println(result)
+	}
+	return nil
+}
+
+func describe(c *cli.Context) error {
+	if len(c.Args()) != 1 {
+		return usageErrorf("describe expects exactly one position of the form <filename>:<line>:<column> or <filename>:#<offset>")
+	}
+	pos := c.Args()[0]
+	prog, err := query.Load(c.String("root"), importer.Default())
+	if err != nil {
+		return fmt.Errorf("failed to load packages: %s", err)
+	}
+	var filename string
+	var line, col int
+	if i := strings.LastIndex(pos, ":#"); i > 0 {
+		offset, err := strconv.Atoi(pos[i+2:])
+		if err != nil {
+			return usageErrorf("invalid position %q (expected <filename>:#<offset>)", pos)
+		}
+		filename = pos[:i]
+		line, col, err = prog.LineColumn(filename, offset)
+		if err != nil {
+			return err
+		}
+	} else if filename, line, col, err = parsePosition(pos); err != nil {
+		return err
+	}
+	description, err := prog.Describe(filename, line, col)
+	if err != nil {
+		return err
+	}
+	if !c.Bool("json") {
+		fmt.Println(description)
+		return nil
+	}
+	data, err := json.MarshalIndent(description, "", "\t")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+func outline(c *cli.Context) error {
+	if len(c.Args()) != 1 {
+		return usageErrorf("outline expects exactly one .fo file")
+	}
+	prog, err := query.Load(c.String("root"), importer.Default())
+	if err != nil {
+		return fmt.Errorf("failed to load packages: %s", err)
+	}
+	symbols, err := prog.Outline(c.Args()[0])
+	if err != nil {
+		return err
+	}
+	if symbols == nil {
+		symbols = []query.Symbol{}
+	}
+	data, err := json.MarshalIndent(symbols, "", "\t")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+func documentation(c *cli.Context) error {
+	if c.NArg() > 1 {
+		return usageErrorf("doc expects at most one argument: the directory containing the packages to document")
+	}
+	if (c.String("http") == "") == (c.String("html") == "") {
+		return usageErrorf("doc expects exactly one of --http and --html")
+	}
+	root := "."
+	if c.NArg() == 1 {
+		root = c.Args()[0]
+	}
+	prog, err := query.Load(root, importer.Default())
+	if err != nil {
+		return fmt.Errorf("failed to load packages: %s", err)
+	}
+	// Packages with errors are documented as far as they could be checked.
+	for _, pkg := range prog.Packages {
+		for _, err := range pkg.Errors {
+			printWarning(err)
+		}
+	}
+	site, err := doc.NewSite(prog, root)
+	if err != nil {
+		return err
+	}
+	if dir := c.String("html"); dir != "" {
+		return site.WriteFiles(dir)
+	}
+	fmt.Fprintf(os.Stderr, "serving documentation on %s\n", c.String("http"))
+	return http.ListenAndServe(c.String("http"), site)
+}
+
+// parseRange splits a range of the form
+// <filename>:<line>:<column>-<line>:<column>.
+func parseRange(r string) (filename string, start [2]int, end [2]int, err error) {
+	if i := strings.LastIndex(r, "-"); i >= 0 {
+		filename, start[0], start[1], err = parsePosition(r[:i])
+		parts := strings.Split(r[i+1:], ":")
+		if err == nil && len(parts) == 2 {
+			end[0], err = strconv.Atoi(parts[0])
+			if err == nil {
+				end[1], err = strconv.Atoi(parts[1])
+			}
+			if err == nil {
+				return filename, start, end, nil
+			}
+		}
+	}
+	return "", start, end, usageErrorf("invalid range %q (expected <filename>:<line>:<column>-<line>:<column>)", r)
+}
+
+// parsePosition splits a position of the form <filename>:<line>:<column>.
+// The file name may itself contain colons.
+func parsePosition(pos string) (filename string, line int, col int, err error) {
+	parts := strings.Split(pos, ":")
+	if len(parts) >= 3 {
+		filename = strings.Join(parts[:len(parts)-2], ":")
+		line, err = strconv.Atoi(parts[len(parts)-2])
+		if err == nil {
+			col, err = strconv.Atoi(parts[len(parts)-1])
+		}
+		if err == nil && filename != "" {
+			return filename, line, col, nil
+		}
+	}
+	return "", 0, 0, usageErrorf("invalid position %q (expected <filename>:<line>:<column>)", pos)
+}
+
+func rename(c *cli.Context) error {
+	if c.String("from") == "" || c.String("to") == "" {
+		return usageErrorf("rename expects both --from and --to")
+	}
+	prog, err := query.Load(c.String("root"), importer.Default())
+	if err != nil {
+		return fmt.Errorf("failed to load packages: %s", err)
+	}
+	for _, pkg := range prog.Packages {
+		if len(pkg.Errors) > 0 {
+			return fmt.Errorf("error in '%s': %s", pkg.Dir, pkg.Errors[0])
+		}
+	}
+	changed, err := refactor.Rename(prog, c.String("from"), c.String("to"))
+	if err != nil {
+		return err
+	}
+	var filenames []string
+	for filename := range changed {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	for _, filename := range filenames {
+		info, err := os.Stat(filename)
+		if err != nil {
+			return err
+		}
+		if err := writeFile(filename, changed[filename], info.Mode()); err != nil {
+			return err
+		}
+		fmt.Println(filename)
+	}
+	return nil
+}
+
+func extract(c *cli.Context) error {
+	args := c.Args()
+	if len(args) != 1 || c.String("name") == "" {
+		return usageErrorf("extract expects --name and exactly one argument: the range of statements to extract, as <filename>:<line>:<column>-<line>:<column>")
+	}
+	filename, start, end, err := parseRange(args[0])
+	if err != nil {
+		return err
+	}
+	prog, err := query.Load(c.String("root"), importer.Default())
+	if err != nil {
+		return fmt.Errorf("failed to load packages: %s", err)
+	}
+	startPos, err := prog.Pos(filename, start[0], start[1])
+	if err != nil {
+		return err
+	}
+	endPos, err := prog.Pos(filename, end[0], end[1])
+	if err != nil {
+		return err
+	}
+	changed, err := refactor.Extract(prog, filename, startPos, endPos, c.String("name"))
+	if err != nil {
+		return err
+	}
+	for filename, src := range changed {
+		info, err := os.Stat(filename)
+		if err != nil {
+			return err
+		}
+		if err := writeFile(filename, src, info.Mode()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fixImports fixes the imports of the .fo files given as arguments or, if
+// there are none, of all .fo files in the tree. Like gofmt, it prints the
+// fixed files unless -w or -l is given.
+func fixImports(c *cli.Context) error {
+	prog, err := query.Load(c.String("root"), importer.Default())
+	if err != nil {
+		return fmt.Errorf("failed to load packages: %s", err)
+	}
+	filenames := []string(c.Args())
+	if len(filenames) == 0 {
+		for _, pkg := range prog.Packages {
+			filenames = append(filenames, pkg.FoFiles...)
+		}
+	}
+	for _, filename := range filenames {
+		fix, err := refactor.FixImports(prog, filename)
+		if err != nil {
+			return err
+		}
+		for _, name := range fix.Missing {
+			printWarning(fmt.Errorf("%s: no package found for %s", filename, name))
+		}
+		switch {
+		case c.Bool("l"):
+			if fix.Changed() {
+				fmt.Println(filename)
+			}
+		case c.Bool("w"):
+			if !fix.Changed() {
+				continue
+			}
+			info, err := os.Stat(fix.Filename)
+			if err != nil {
+				return err
+			}
+			if err := writeFile(fix.Filename, fix.Src, info.Mode()); err != nil {
+				return err
+			}
+		default:
+			os.Stdout.Write(fix.Src)
+		}
+	}
+	return nil
+}
+
+// formatFiles formats the .fo files given as arguments, or those in the
+// directory trees denoted by the package patterns given as arguments (or in
+// the current one), like gofmt. With
+// the --strict flag, the stricter profile of format.StrictNode is used.
+func formatFiles(c *cli.Context) error {
+	if c.Bool("w") && c.Bool("l") {
+		return usageErrorf("-w and -l cannot be combined")
+	}
+	args := []string(c.Args())
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+	var filenames []string
+	for _, arg := range args {
+		if info, err := os.Stat(arg); err == nil && !info.IsDir() {
+			filenames = append(filenames, arg)
+			continue
+		}
+		root, err := loader.ResolvePattern(".", arg)
+		if err != nil {
+			return usageErrorf("%s", err)
+		}
+		found, err := loader.FoFiles(root)
+		if err != nil {
+			return err
+		}
+		filenames = append(filenames, found...)
+	}
+	for _, filename := range filenames {
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, filename, src, parseMode(c))
+		if err != nil {
+			return withExitCode(exitParse, err)
+		}
+		var buf bytes.Buffer
+		if c.Bool("strict") {
+			err = format.StrictNode(&buf, fset, f)
+		} else {
+			err = format.Node(&buf, fset, f)
+		}
+		if err != nil {
+			return err
+		}
+		out := buf.Bytes()
+		switch {
+		case c.Bool("l"):
+			if !bytes.Equal(src, out) {
+				fmt.Println(filename)
+			}
+		case c.Bool("w"):
+			if bytes.Equal(src, out) {
+				continue
+			}
+			info, err := os.Stat(filename)
+			if err != nil {
+				return err
+			}
+			if err := writeFile(filename, out, info.Mode()); err != nil {
+				return err
+			}
+		default:
+			os.Stdout.Write(out)
+		}
+	}
+	return nil
+}
+
+// modGoVersion is the Go version declared by the go.mod files of new modules.
+// Fo code can use the generics of packages compiled with it.
+const modGoVersion = "1.18"
+
+// modMain is the main.fo of new modules.
+const modMain = `package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// A Stack is a last-in, first-out collection of values of type T.
+type Stack[T] struct {
+	items []T
+}
+
+// Push adds v to the top of the stack.
+func (s *Stack[T]) Push(v T) {
+	s.items = append(s.items, v)
+}
+
+// Pop removes the value at the top of the stack and returns it. It reports
+// false if the stack is empty.
+func (s *Stack[T]) Pop() (T, bool) {
+	var zero T
+	if len(s.items) == 0 {
+		return zero, false
+	}
+	v := s.items[len(s.items)-1]
+	s.items = s.items[:len(s.items)-1]
+	return v, true
+}
+
+// Map returns the results of calling f for each element of list.
+func Map[T, U](list []T, f func(T) U) []U {
+	result := make([]U, len(list))
+	for i, v := range list {
+		result[i] = f(v)
+	}
+	return result
+}
+
+func main() {
+	var s Stack[string]
+	for _, word := range Map[int, string]([]int{1, 2, 3}, strconv.Itoa) {
+		s.Push(word)
+	}
+	for {
+		word, ok := s.Pop()
+		if !ok {
+			break
+		}
+		fmt.Println(word)
+	}
+}
+`
+
+// modGitignore is the .gitignore of new modules, given the name of their
+// binary.
+const modGitignore = `# Go code generated by fo build. Each .fo file is turned into a .go file with
+# the same name, so add those here along with new .fo files. .go files written
+# by hand are checked in as usual.
+/main.go
+*.go.map
+zz_generated.fo.go
+
+# The binary built by go build.
+/%s
+`
+
+// modInit creates a new module in the current directory. Like go mod init, it
+// does not touch an existing go.mod; the other files are only written if they
+// do not exist yet.
+func modInit(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return usageErrorf("mod init expects one argument: the module path, e.g. example.com/project")
+	}
+	modPath := c.Args()[0]
+	if modPath == "" || path.Clean(modPath) != modPath || path.IsAbs(modPath) || strings.HasPrefix(modPath, ".") || strings.ContainsAny(modPath, " \t\n\"'`\\") {
+		return usageErrorf("invalid module path %q", modPath)
+	}
+	if _, err := os.Stat("go.mod"); err == nil {
+		return errors.New("go.mod already exists")
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	files := []struct {
+		name    string
+		content string
+	}{
+		{"go.mod", fmt.Sprintf("module %s\n\ngo %s\n", modPath, modGoVersion)},
+		{"main.fo", modMain},
+		{".gitignore", fmt.Sprintf(modGitignore, path.Base(modPath))},
+	}
+	for _, file := range files {
+		if _, err := os.Stat(file.name); err == nil {
+			fmt.Fprintf(os.Stderr, "keep %s, which already exists\n", file.name)
+			continue
+		}
+		if err := ioutil.WriteFile(file.name, []byte(file.content), 0644); err != nil {
+			return err
+		}
+		verbosef(c, "write %s", file.name)
+	}
+	return nil
+}
+
+// writeGrammar writes the files of a syntax highlighting grammar of Fo in the
+// format given by the flags to the output directory.
+func writeGrammar(c *cli.Context) error {
+	var files map[string][]byte
+	switch format := c.String("format"); format {
+	case "tmlanguage":
+		files = map[string][]byte{"fo.tmLanguage.json": grammar.TextMate()}
+	case "tree-sitter":
+		files = grammar.TreeSitter()
+	default:
+		return usageErrorf("unknown grammar format %q, expected tmlanguage or tree-sitter", format)
+	}
+	for name, content := range files {
+		filename := filepath.Join(c.String("output"), filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filename, content, 0644); err != nil {
+			return err
+		}
+	}
 	return nil
 }
@@ -0,0 +1,130 @@
+package main
+
+import (
+	gobuild "go/build"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/qProust/fo/loader/loadertest"
+)
+
+func TestUnknownCommand(t *testing.T) {
+	for _, args := range [][]string{
+		{"fo", "frob"},
+		{"fo", "help", "frob"},
+	} {
+		app := newApp()
+		app.Writer = ioutil.Discard
+		err := runApp(app, args)
+		if err == nil {
+			t.Errorf("%v: expected an error", args)
+			continue
+		}
+		if code := exitCode(err); code != exitUsage {
+			t.Errorf("%v: got exit code %d, want %d", args, code, exitUsage)
+		}
+		if want := `unknown command "frob"`; err.Error() != want {
+			t.Errorf("%v: got error %q, want %q", args, err, want)
+		}
+	}
+}
+
+// A package with a syntax error is reported, and not checked, when building
+// for wasm as well.
+func TestBuildWasmSyntaxError(t *testing.T) {
+	root, cleanup := loadertest.WriteTree(t, map[string]string{
+		"go.mod":     "module example.com/app\n",
+		"bad/bad.fo": "package bad\n\nfunc F( {}\n",
+		"ok/ok.fo":   "package ok\n\nfunc G() {}\n",
+	})
+	defer cleanup()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(root); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	// --target changes the environment and the default build context.
+	defer func(ctxt gobuild.Context, goos, goarch string) {
+		gobuild.Default = ctxt
+		os.Setenv("GOOS", goos)
+		os.Setenv("GOARCH", goarch)
+	}(gobuild.Default, os.Getenv("GOOS"), os.Getenv("GOARCH"))
+
+	app := newApp()
+	app.Writer = ioutil.Discard
+	err = runApp(app, []string{"fo", "build", "--target", "wasm", "--dry-run", "./..."})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if code := exitCode(err); code != exitParse {
+		t.Errorf("got exit code %d, want %d", code, exitParse)
+	}
+	if want := filepath.Join("bad", "bad.fo"); !strings.Contains(err.Error(), want) {
+		t.Errorf("got error %q, want one about %s", err, want)
+	}
+}
+
+// fo test transpiles the packages, including their _test.fo files, and runs
+// go test on them.
+func TestTestPackages(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+	// The tests are init functions rather than test functions, so that they
+	// don't depend on the export data of package testing.
+	root, cleanup := loadertest.WriteTree(t, map[string]string{
+		"go.mod":             "module example.com/app\n\ngo 1.16\n",
+		"good/top.fo":        "package good\n\nfunc Top[T](s []T) T {\n\treturn s[len(s)-1]\n}\n",
+		"good/top_test.fo":   "package good\n\nfunc init() {\n\tif Top[int]([]int{1, 2}) != 2 {\n\t\tpanic(\"wrong top\")\n\t}\n}\n",
+		"bad/bottom.fo":      "package bad\n\nfunc Bottom[T](s []T) T {\n\treturn s[len(s)-1]\n}\n",
+		"bad/bottom_test.fo": "package bad\n\nfunc init() {\n\tif Bottom[int]([]int{1, 2}) != 1 {\n\t\tpanic(\"wrong bottom\")\n\t}\n}\n",
+	})
+	defer cleanup()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(root); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	app := newApp()
+	app.Writer = ioutil.Discard
+	if err := runApp(app, []string{"fo", "test", "./good"}); err != nil {
+		t.Fatalf("fo test ./good: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join("good", "top_test.go")); err != nil {
+		t.Errorf("top_test.fo was not transpiled: %s", err)
+	}
+	app = newApp()
+	app.Writer = ioutil.Discard
+	err = runApp(app, []string{"fo", "test", "./..."})
+	if code := exitCode(err); code != exitTool {
+		t.Errorf("fo test ./...: got exit code %d, want %d", code, exitTool)
+	}
+}
+
+// A tool which is interrupted makes fo exit with the status a shell reports
+// for it, not with exitTool.
+func TestRunToolInterrupted(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no signals on windows")
+	}
+	err := runTool(exec.Command("sh", "-c", "kill -INT $$"))
+	if code := exitCode(err); code != 130 {
+		t.Errorf("got exit code %d, want 130", code)
+	}
+	err = runTool(exec.Command("sh", "-c", "exit 3"))
+	if code := exitCode(err); code != exitTool {
+		t.Errorf("got exit code %d, want %d", code, exitTool)
+	}
+}
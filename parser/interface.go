@@ -61,6 +61,7 @@ const (
 	Trace                                          // print a trace of parsed productions
 	DeclarationErrors                              // report declaration errors
 	SpuriousErrors                                 // same as AllErrors, for backward-compatibility
+	GoTypeParams                                   // also accept Go type parameter lists (e.g. [K, V any])
 	AllErrors         = SpuriousErrors             // report all errors (not just the first 10 on different lines)
 )
 
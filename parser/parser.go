@@ -60,6 +60,10 @@ type parser struct {
 	exprLev int  // < 0: in control clause, >= 0: in expression
 	inRhs   bool // if set, the parser is parsing a rhs expression
 
+	// Type parameters and arguments in angle brackets (see parseAngleTypeArgs)
+	angleLev  int       // nesting level of lists of type arguments
+	angleSemi token.Pos // position of a token on a new line after a closing '>'
+
 	// Ordinary identifier scopes
 	pkgScope   *ast.Scope        // pkgScope.Outer == nil
 	topScope   *ast.Scope        // top-most scope; may be pkgScope
@@ -70,6 +74,16 @@ type parser struct {
 	// (maintained by open/close LabelScope)
 	labelScope  *ast.Scope     // label scope for current function
 	targetStack [][]*ast.Ident // stack of unresolved labels
+
+	// Identifiers are the most frequent nodes, so they are allocated in
+	// blocks (see newIdent), as are short expression lists (see exprs).
+	identBlock []ast.Ident
+	exprBlock  []ast.Expr
+
+	// The elements of the lists which are being parsed are collected on
+	// stacks, so that each list is allocated once with its final length.
+	exprStack []ast.Expr
+	stmtStack []ast.Stmt
 }
 
 func (p *parser) init(fset *token.FileSet, filename string, src []byte, mode Mode) {
@@ -420,6 +434,11 @@ func (p *parser) expectSemi() {
 		case token.SEMICOLON:
 			p.next()
 		default:
+			if p.pos == p.angleSemi {
+				// The scanner does not insert a semicolon after a '>',
+				// but the angle brackets were reported already.
+				return
+			}
 			p.errorExpected(p.pos, "';'")
 			syncStmt(p)
 		}
@@ -542,10 +561,60 @@ func (p *parser) parseIdent() *ast.Ident {
 		p.expect(token.IDENT) // use expect() error handling
 	}
 
-	return &ast.Ident{
-		NamePos: pos,
-		Name:    name,
+	return p.newIdent(pos, name)
+}
+
+// identBlockSize is the number of identifiers allocated at once by newIdent.
+const identBlockSize = 64
+
+// newIdent returns a new identifier with the given position and name.
+func (p *parser) newIdent(pos token.Pos, name string) *ast.Ident {
+	if len(p.identBlock) == 0 {
+		p.identBlock = make([]ast.Ident, identBlockSize)
+	}
+	id := &p.identBlock[0]
+	p.identBlock = p.identBlock[1:]
+	id.NamePos = pos
+	id.Name = name
+	return id
+}
+
+// exprBlockSize is the number of list elements allocated at once by exprs.
+const exprBlockSize = 64
+
+// exprs pops the expressions which were pushed onto p.exprStack since its
+// length was start and returns them as a list, which is nil if there are none.
+func (p *parser) exprs(start int) []ast.Expr {
+	n := len(p.exprStack) - start
+	var list []ast.Expr
+	switch {
+	case n == 0:
+		return nil
+	case n <= 4:
+		if len(p.exprBlock) < n {
+			p.exprBlock = make([]ast.Expr, exprBlockSize)
+		}
+		// The capacity is limited so that appending to the list doesn't
+		// overwrite the next one.
+		list = p.exprBlock[:n:n]
+		p.exprBlock = p.exprBlock[n:]
+	default:
+		list = make([]ast.Expr, n)
 	}
+	copy(list, p.exprStack[start:])
+	p.exprStack = p.exprStack[:start]
+	return list
+}
+
+// stmts is like exprs for p.stmtStack.
+func (p *parser) stmts(start int) []ast.Stmt {
+	if len(p.stmtStack) == start {
+		return nil
+	}
+	list := make([]ast.Stmt, len(p.stmtStack)-start)
+	copy(list, p.stmtStack[start:])
+	p.stmtStack = p.stmtStack[:start]
+	return list
 }
 
 func (p *parser) parseIdentList() (list []*ast.Ident) {
@@ -571,13 +640,14 @@ func (p *parser) parseExprList(lhs bool) (list []ast.Expr) {
 		defer un(trace(p, "ExpressionList"))
 	}
 
-	list = append(list, p.checkExpr(p.parseExpr(lhs)))
+	start := len(p.exprStack)
+	p.exprStack = append(p.exprStack, p.checkExpr(p.parseExpr(lhs)))
 	for p.tok == token.COMMA {
 		p.next()
-		list = append(list, p.checkExpr(p.parseExpr(lhs)))
+		p.exprStack = append(p.exprStack, p.checkExpr(p.parseExpr(lhs)))
 	}
 
-	return
+	return p.exprs(start)
 }
 
 func (p *parser) parseLhsList() []ast.Expr {
@@ -659,7 +729,7 @@ func (p *parser) parseTypeName(allowTypeParams bool) ast.Expr {
 	// a type parameter expression.
 	if allowTypeParams && p.tok == token.LBRACK && x != nil {
 		lbrack := p.expect(token.LBRACK)
-		params := p.parseTypeList()
+		params := p.parseTypeArgList(nil)
 		rbrack := p.expect(token.RBRACK)
 		return &ast.TypeArgExpr{
 			X:      x,
@@ -668,6 +738,10 @@ func (p *parser) parseTypeName(allowTypeParams bool) ast.Expr {
 			Rbrack: rbrack,
 		}
 	}
+	if allowTypeParams && p.tok == token.LSS {
+		// A '<' cannot follow a type name.
+		return p.parseAngleTypeArgs(x)
+	}
 
 	return x
 }
@@ -740,8 +814,7 @@ func (p *parser) parseFieldDecl(scope *ast.Scope) *ast.Field {
 				p.exprLev--
 				if p.tok == token.COMMA {
 					// TypeArgExpr
-					p.next()
-					params := append([]ast.Expr{len}, p.parseTypeList()...)
+					params := p.parseTypeArgList(len)
 					rbrack := p.expect(token.RBRACK)
 					x = &ast.TypeArgExpr{
 						X:      x,
@@ -928,8 +1001,7 @@ func (p *parser) parseParameterList(scope *ast.Scope, ellipsisOk bool) (params [
 				p.exprLev--
 				if p.tok == token.COMMA {
 					// TypeArgExpr
-					p.next()
-					params := append([]ast.Expr{len}, p.parseTypeList()...)
+					params := p.parseTypeArgList(len)
 					rbrack := p.expect(token.RBRACK)
 					x = &ast.TypeArgExpr{
 						X:      x,
@@ -1110,6 +1182,13 @@ func (p *parser) parseFuncType() (*ast.FuncType, *ast.Scope) {
 	}
 
 	pos := p.expect(token.FUNC)
+	if p.tok == token.LBRACK {
+		// Function values cannot be generic, since Go has no such values for
+		// them to become (e.g. var apply func[T](T) T). The type parameters
+		// are reported and skipped.
+		tparams := p.parseTypeParamDecl()
+		p.error(tparams.Lbrack, "function type cannot have type parameters: use a generic function or the function type of one of its instances (e.g. func(int) int)")
+	}
 	scope := ast.NewScope(p.topScope) // function scope
 	params, results := p.parseSignature(scope)
 
@@ -1125,12 +1204,16 @@ func (p *parser) parseMethodSpec(scope *ast.Scope) *ast.Field {
 	var idents []*ast.Ident
 	var typ ast.Expr
 	x := p.parseTypeName(false)
-	if ident, isIdent := x.(*ast.Ident); isIdent && p.tok == token.LPAREN {
+	if ident, isIdent := x.(*ast.Ident); isIdent && (p.tok == token.LPAREN || p.tok == token.LBRACK) {
 		// method
 		idents = []*ast.Ident{ident}
+		var typeParams *ast.TypeParamDecl
+		if p.tok == token.LBRACK {
+			typeParams = p.parseTypeParamDecl()
+		}
 		scope := ast.NewScope(nil) // method scope
 		params, results := p.parseSignature(scope)
-		typ = &ast.FuncType{Func: token.NoPos, Params: params, Results: results}
+		typ = &ast.FuncType{Func: token.NoPos, TypeParams: typeParams, Params: params, Results: results}
 	} else {
 		// embedded interface
 		typ = x
@@ -1256,11 +1339,12 @@ func (p *parser) parseStmtList() (list []ast.Stmt) {
 		defer un(trace(p, "StatementList"))
 	}
 
+	start := len(p.stmtStack)
 	for p.tok != token.CASE && p.tok != token.DEFAULT && p.tok != token.RBRACE && p.tok != token.EOF {
-		list = append(list, p.parseStmt())
+		p.stmtStack = append(p.stmtStack, p.parseStmt())
 	}
 
-	return
+	return p.stmts(start)
 }
 
 func (p *parser) parseBody(scope *ast.Scope) *ast.BlockStmt {
@@ -1423,8 +1507,7 @@ func (p *parser) parseBracketExpr(x ast.Expr) ast.Expr {
 		case token.COMMA:
 			// If the next token is a comma, we are dealing with a type parameter
 			// expression.
-			p.expect(token.COMMA)
-			params := append([]ast.Expr{index[0]}, p.parseTypeList()...)
+			params := p.parseTypeArgList(index[0])
 			rbrack := p.expect(token.RBRACK)
 			p.exprLev--
 			return &ast.TypeArgExpr{
@@ -1482,10 +1565,10 @@ func (p *parser) parseCallOrConversion(fun ast.Expr) *ast.CallExpr {
 
 	lparen := p.expect(token.LPAREN)
 	p.exprLev++
-	var list []ast.Expr
+	start := len(p.exprStack)
 	var ellipsis token.Pos
 	for p.tok != token.RPAREN && p.tok != token.EOF && !ellipsis.IsValid() {
-		list = append(list, p.parseRhsOrType()) // builtins may expect a type: make(some type, ...)
+		p.exprStack = append(p.exprStack, p.parseRhsOrType()) // builtins may expect a type: make(some type, ...)
 		if p.tok == token.ELLIPSIS {
 			ellipsis = p.pos
 			p.next()
@@ -1496,6 +1579,7 @@ func (p *parser) parseCallOrConversion(fun ast.Expr) *ast.CallExpr {
 		p.next()
 	}
 	p.exprLev--
+	list := p.exprs(start)
 	rparen := p.expectClosing(token.RPAREN, "argument list")
 
 	return &ast.CallExpr{Fun: fun, Lparen: lparen, Args: list, Ellipsis: ellipsis, Rparen: rparen}
@@ -2143,6 +2227,44 @@ func (p *parser) parseTypeList() (list []ast.Expr) {
 	return
 }
 
+// parseTypeArgList parses the type arguments of a TypeArgExpr. If first is
+// not nil, it is the first type argument, which has already been parsed. In
+// addition to types, a type argument may be a constant expression (the value
+// of a type parameter which is used as an array length). Since a constant may
+// also be denoted by an identifier, only expressions which cannot be types are
+// parsed as such. Like the elements of a composite literal, the list may end
+// with a comma, so that it can be split across lines.
+func (p *parser) parseTypeArgList(first ast.Expr) (list []ast.Expr) {
+	if p.trace {
+		defer un(trace(p, "TypeArgList"))
+	}
+
+	if first == nil {
+		first = p.parseTypeArg()
+	}
+	list = append(list, first)
+	for p.tok == token.COMMA {
+		p.next()
+		if p.tok == token.RBRACK {
+			break
+		}
+		list = append(list, p.parseTypeArg())
+	}
+
+	return
+}
+
+func (p *parser) parseTypeArg() ast.Expr {
+	switch p.tok {
+	case token.INT, token.FLOAT, token.IMAG, token.CHAR, token.STRING, token.ADD, token.SUB:
+		p.exprLev++
+		x := p.parseRhs()
+		p.exprLev--
+		return x
+	}
+	return p.parseType()
+}
+
 func (p *parser) parseCaseClause(typeSwitch bool) *ast.CaseClause {
 	if p.trace {
 		defer un(trace(p, "CaseClause"))
@@ -2598,22 +2720,17 @@ func (p *parser) parseTypeSpec(doc *ast.CommentGroup, _ token.Token, _ int) ast.
 
 		if p.tok == token.IDENT {
 
+			doc := p.leadComment
 			first := p.parseRhs()
-			if p.tok == token.COMMA {
-				// The comma disambiguates. We are dealing with a list of type parameter
-				// names.
+			if p.tok == token.COMMA || p.tok == token.IDENT || p.tok == token.INTERFACE && p.mode&GoTypeParams != 0 {
+				// The comma (or a constraint following the name) disambiguates. We
+				// are dealing with a list of type parameters.
 				name, ok := first.(*ast.Ident)
 				if !ok {
 					p.errorExpected(first.Pos(), token.IDENT.String())
+					name = &ast.Ident{NamePos: first.Pos(), Name: "_"}
 				}
-				p.next()
-				names := append([]*ast.Ident{name}, p.parseIdentList()...)
-				rbrack := p.expect(token.RBRACK)
-				spec.TypeParams = &ast.TypeParamDecl{
-					Lbrack: lbrack,
-					Names:  names,
-					Rbrack: rbrack,
-				}
+				spec.TypeParams = p.parseTypeParamList(lbrack, doc, name)
 
 				// We expect the type to follow the type parameters.
 				spec.Type = p.parseType()
@@ -2649,6 +2766,11 @@ func (p *parser) parseTypeSpec(doc *ast.CommentGroup, _ token.Token, _ int) ast.
 
 			spec.Type = &ast.ArrayType{Lbrack: lbrack, Len: len, Elt: elt}
 		}
+	} else if p.tok == token.LSS {
+		spec.TypeParams = p.parseAngleTypeParams(ident)
+		spec.Type = p.parseType()
+	} else if p.tok == token.IDENT && p.lit == "enum" {
+		spec.Type = p.parseEnumOrType()
 	} else {
 		// For all other cases, we expect the type to follow the name.
 		spec.Type = p.parseType()
@@ -2660,6 +2782,42 @@ func (p *parser) parseTypeSpec(doc *ast.CommentGroup, _ token.Token, _ int) ast.
 	return spec
 }
 
+// parseEnumOrType parses an EnumType or, if the identifier enum is not
+// followed by a '{', a type name. enum is not a keyword, so that Go code
+// which uses it as an identifier remains valid.
+func (p *parser) parseEnumOrType() ast.Expr {
+	if p.trace {
+		defer un(trace(p, "EnumOrType"))
+	}
+
+	x := p.parseTypeName(true)
+	ident, ok := x.(*ast.Ident)
+	if !ok || p.tok != token.LBRACE {
+		p.resolve(x)
+		return x
+	}
+
+	lbrace := p.expect(token.LBRACE)
+	var values []*ast.Ident
+	for p.tok == token.IDENT {
+		value := p.parseIdent()
+		p.declare(value, nil, p.topScope, ast.Con, value)
+		values = append(values, value)
+		if p.tok != token.COMMA && p.tok != token.SEMICOLON {
+			break
+		}
+		p.next()
+	}
+	rbrace := p.expect(token.RBRACE)
+
+	return &ast.EnumType{
+		Enum:   ident.NamePos,
+		Lbrace: lbrace,
+		Values: values,
+		Rbrace: rbrace,
+	}
+}
+
 func (p *parser) parseGenDecl(keyword token.Token, f parseSpecFunction) *ast.GenDecl {
 	if p.trace {
 		defer un(trace(p, "GenDecl("+keyword.String()+")"))
@@ -2708,8 +2866,11 @@ func (p *parser) parseFuncDecl() *ast.FuncDecl {
 	ident := p.parseIdent()
 
 	var typeParams *ast.TypeParamDecl
-	if p.tok == token.LBRACK {
+	switch p.tok {
+	case token.LBRACK:
 		typeParams = p.parseTypeParamDecl()
+	case token.LSS:
+		typeParams = p.parseAngleTypeParams(ident)
 	}
 
 	params, results := p.parseSignature(scope)
@@ -2775,13 +2936,197 @@ func (p *parser) parseDecl(sync func(*parser)) ast.Decl {
 
 func (p *parser) parseTypeParamDecl() *ast.TypeParamDecl {
 	lbrack := p.expect(token.LBRACK)
-	names := p.parseIdentList()
+	doc := p.leadComment
+	return p.parseTypeParamList(lbrack, doc, p.parseIdent())
+}
+
+// parseAngleTypeParams parses a list of type parameters in angle brackets
+// which follows name, the name of a function or type, as in C++ or Java (e.g.
+// func f<T>). Fo uses square brackets instead. Rather than the cascade of
+// errors the angle brackets would cause otherwise, a single error which
+// suggests the fix is reported, and parsing continues as if the list had been
+// written with square brackets.
+func (p *parser) parseAngleTypeParams(name *ast.Ident) *ast.TypeParamDecl {
+	if p.trace {
+		defer un(trace(p, "AngleTypeParams"))
+	}
+
+	lss := p.expect(token.LSS)
+	var names []*ast.Ident
+	var list []string
+	for {
+		ident := p.parseIdent()
+		names = append(names, ident)
+		list = append(list, ident.Name)
+		if p.tok != token.COMMA {
+			break
+		}
+		p.next()
+	}
+	p.error(lss, fmt.Sprintf("Fo uses square brackets for type parameters: write %s[%s]", name.Name, strings.Join(list, ", ")))
+	gtr := p.expectAngle()
+	return &ast.TypeParamDecl{Lbrack: lss, Names: names, Rbrack: gtr}
+}
+
+// parseAngleTypeArgs parses a list of type arguments in angle brackets which
+// follows the type name x (e.g. Box<int>), like parseAngleTypeParams. Lists
+// nested in it are included in the fix suggested for the outermost one.
+func (p *parser) parseAngleTypeArgs(x ast.Expr) *ast.TypeArgExpr {
+	if p.trace {
+		defer un(trace(p, "AngleTypeArgs"))
+	}
+
+	lss := p.expect(token.LSS)
+	p.angleLev++
+	var types []ast.Expr
+	for {
+		types = append(types, p.parseType())
+		if p.tok != token.COMMA {
+			break
+		}
+		p.next()
+	}
+	p.angleLev--
+	expr := &ast.TypeArgExpr{X: x, Lbrack: lss, Types: types}
+	if p.angleLev == 0 {
+		p.error(lss, "Fo uses square brackets for type arguments: write "+typeString(expr))
+	}
+	expr.Rbrack = p.expectAngle()
+	return expr
+}
+
+// expectAngle consumes the '>' which closes a list in angle brackets and
+// returns its position. A '>>' which closes two nested lists is split.
+func (p *parser) expectAngle() token.Pos {
+	pos := p.pos
+	if p.tok == token.SHR {
+		p.tok, p.pos = token.GTR, p.pos+1
+		return pos
+	}
+	p.expect(token.GTR)
+	if p.file.Line(p.pos) > p.file.Line(pos) {
+		p.angleSemi = p.pos
+	}
+	return pos
+}
+
+// typeString returns the source text of the type x, with its type arguments
+// in square brackets, for the fixes suggested by parseAngleTypeArgs. Types
+// other than (qualified) type names, pointers, slices and instantiations are
+// abbreviated.
+func typeString(x ast.Expr) string {
+	switch x := x.(type) {
+	case *ast.Ident:
+		return x.Name
+	case *ast.SelectorExpr:
+		return typeString(x.X) + "." + x.Sel.Name
+	case *ast.StarExpr:
+		return "*" + typeString(x.X)
+	case *ast.ArrayType:
+		if x.Len == nil {
+			return "[]" + typeString(x.Elt)
+		}
+	case *ast.TypeArgExpr:
+		args := make([]string, len(x.Types))
+		for i, typ := range x.Types {
+			args[i] = typeString(typ)
+		}
+		return typeString(x.X) + "[" + strings.Join(args, ", ") + "]"
+	}
+	return "..."
+}
+
+// parseTypeParamList parses the rest of a list of type parameters, starting
+// after the name of the first one, whose lead comment is doc. Each name may be
+// followed by a constraint, and the list may end with a comma.
+func (p *parser) parseTypeParamList(lbrack token.Pos, doc *ast.CommentGroup, first *ast.Ident) *ast.TypeParamDecl {
+	if p.trace {
+		defer un(trace(p, "TypeParamList"))
+	}
+
+	names := []*ast.Ident{first}
+	docs := []*ast.CommentGroup{doc}
+	hasDocs := doc != nil
+	var constraints []ast.Expr
+	hasConstraints := false
+	for {
+		var constraint ast.Expr
+		if p.tok != token.COMMA && p.tok != token.RBRACK {
+			constraint = p.parseType()
+			hasConstraints = true
+		}
+		constraints = append(constraints, constraint)
+		if p.tok != token.COMMA {
+			break
+		}
+		p.next()
+		if p.tok == token.RBRACK {
+			break
+		}
+		if p.leadComment != nil {
+			hasDocs = true
+		}
+		docs = append(docs, p.leadComment)
+		names = append(names, p.parseIdent())
+	}
 	rbrack := p.expect(token.RBRACK)
+	if hasConstraints && p.mode&GoTypeParams != 0 {
+		constraints = goConstraints(constraints)
+		hasConstraints = constraints != nil
+	}
+	if !hasConstraints {
+		constraints = nil
+	}
+	if !hasDocs {
+		docs = nil
+	}
 	return &ast.TypeParamDecl{
-		Lbrack: lbrack,
-		Names:  names,
-		Rbrack: rbrack,
+		Lbrack:      lbrack,
+		Docs:        docs,
+		Names:       names,
+		Constraints: constraints,
+		Rbrack:      rbrack,
+	}
+}
+
+// goConstraints normalizes the constraints of a type parameter list which is
+// written in Go syntax, where every type parameter has a constraint and each
+// constraint also applies to the type parameters without one before it, as in
+// [K, V any]. Since a Fo constraint only applies to the type parameter it
+// follows, it is repeated for each of them. The constraint any (or an empty
+// interface) is implied in Fo and is dropped. Lists whose last type parameter
+// has no constraint are not valid Go and are left as they are.
+func goConstraints(constraints []ast.Expr) []ast.Expr {
+	if constraints[len(constraints)-1] == nil {
+		return constraints
+	}
+	result := make([]ast.Expr, len(constraints))
+	hasConstraints := false
+	var constraint ast.Expr
+	for i := len(constraints) - 1; i >= 0; i-- {
+		if constraints[i] != nil {
+			constraint = constraints[i]
+		}
+		if !isAnyConstraint(constraint) {
+			result[i] = constraint
+			hasConstraints = true
+		}
+	}
+	if !hasConstraints {
+		return nil
+	}
+	return result
+}
+
+// isAnyConstraint reports whether x is the constraint any or interface{}.
+func isAnyConstraint(x ast.Expr) bool {
+	switch x := x.(type) {
+	case *ast.Ident:
+		return x.Name == "any"
+	case *ast.InterfaceType:
+		return len(x.Methods.List) == 0
 	}
+	return false
 }
 
 // ----------------------------------------------------------------------------
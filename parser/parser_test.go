@@ -549,6 +549,44 @@ type x int // comment
 		t.Errorf("got %q, want %q", comment, "// comment")
 	}
 }
+
+// Short expression lists share a block of memory; appending to one of them
+// must not overwrite the next.
+func TestExprListsAreSeparate(t *testing.T) {
+	const src = `package p
+func f() {
+	f(a, b)
+	g(c)
+	x, y := d, e
+}`
+	f, err := ParseFile(token.NewFileSet(), "", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := f.Decls[0].(*ast.FuncDecl).Body.List
+	call := body[0].(*ast.ExprStmt).X.(*ast.CallExpr)
+	call.Args = append(call.Args, ast.NewIdent("z"))
+	assign := body[2].(*ast.AssignStmt)
+	assign.Lhs = append(assign.Lhs, ast.NewIdent("z"))
+	for _, test := range []struct {
+		list     []ast.Expr
+		expected string
+	}{
+		{call.Args, "a b z"},
+		{body[1].(*ast.ExprStmt).X.(*ast.CallExpr).Args, "c"},
+		{assign.Lhs, "x y z"},
+		{assign.Rhs, "d e"},
+	} {
+		var names []string
+		for _, x := range test.list {
+			names = append(names, x.(*ast.Ident).Name)
+		}
+		if got := strings.Join(names, " "); got != test.expected {
+			t.Errorf("got %s, want %s", got, test.expected)
+		}
+	}
+}
+
 func TestTypeDecls(t *testing.T) {
 	testCases := []struct {
 		src      string
@@ -577,6 +615,48 @@ func TestTypeDecls(t *testing.T) {
 				},
 			},
 		},
+		{
+			// EnumType with values separated by commas and newlines.
+			src: "package p; type a enum {\n\tB, C\n\tD\n}",
+			expected: &ast.File{
+				Name: ast.NewIdent("p"),
+				Decls: []ast.Decl{
+					&ast.GenDecl{
+						Tok: token.TYPE,
+						Specs: []ast.Spec{
+							&ast.TypeSpec{
+								Name: ast.NewIdent("a"),
+								Type: &ast.EnumType{
+									Values: []*ast.Ident{
+										ast.NewIdent("B"),
+										ast.NewIdent("C"),
+										ast.NewIdent("D"),
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			// enum is not a keyword. Here, it is the name of a type.
+			src: "package p; type a enum",
+			expected: &ast.File{
+				Name: ast.NewIdent("p"),
+				Decls: []ast.Decl{
+					&ast.GenDecl{
+						Tok: token.TYPE,
+						Specs: []ast.Spec{
+							&ast.TypeSpec{
+								Name: ast.NewIdent("a"),
+								Type: ast.NewIdent("enum"),
+							},
+						},
+					},
+				},
+			},
+		},
 		{
 			// ArrayType with literal number
 			src: "package p; type a [5]string",
@@ -656,6 +736,99 @@ func TestTypeDecls(t *testing.T) {
 	}
 }
 
+func TestGoTypeParams(t *testing.T) {
+	for _, test := range []struct {
+		src      string
+		mode     Mode
+		expected string
+	}{
+		{"func f[K, V any]() {}", GoTypeParams, "[K, V]"},
+		{"func f[K comparable, V any]() {}", GoTypeParams, "[K comparable, V]"},
+		{"func f[K, V comparable]() {}", GoTypeParams, "[K comparable, V comparable]"},
+		{"type S[T any] struct{}", GoTypeParams, "[T]"},
+		{"type S[T interface{}] []T", GoTypeParams, "[T]"},
+		// Fo type parameter lists are accepted as well.
+		{"type M[K comparable, V] map[K]V", GoTypeParams, "[K comparable, V]"},
+		{"type P[K, V] struct{}", GoTypeParams, "[K, V]"},
+		// Lists may end with a comma.
+		{"func f[K comparable, V any,]() {}", GoTypeParams, "[K comparable, V]"},
+		{"type P[\n\tK,\n\tV,\n] struct{}", 0, "[K, V]"},
+		{"type S[T,] []T", 0, "[T]"},
+		// Without GoTypeParams, constraints only apply to a single type
+		// parameter.
+		{"func f[K, V comparable]() {}", 0, "[K, V comparable]"},
+	} {
+		f, err := ParseFile(token.NewFileSet(), "", "package p; "+test.src, test.mode)
+		if err != nil {
+			t.Errorf("%s: %v", test.src, err)
+			continue
+		}
+		var tpDecl *ast.TypeParamDecl
+		switch decl := f.Decls[0].(type) {
+		case *ast.FuncDecl:
+			tpDecl = decl.TypeParams
+		case *ast.GenDecl:
+			tpDecl = decl.Specs[0].(*ast.TypeSpec).TypeParams
+		}
+		if tpDecl == nil {
+			t.Errorf("%s: no type parameters", test.src)
+			continue
+		}
+		var params []string
+		for i, name := range tpDecl.Names {
+			param := name.Name
+			if tpDecl.Constraints != nil && tpDecl.Constraints[i] != nil {
+				param += " " + tpDecl.Constraints[i].(*ast.Ident).Name
+			}
+			params = append(params, param)
+		}
+		if got := "[" + strings.Join(params, ", ") + "]"; got != test.expected {
+			t.Errorf("%s: got type parameters %s, expected %s", test.src, got, test.expected)
+		}
+	}
+}
+
+func TestTypeParamDocs(t *testing.T) {
+	for _, test := range []struct {
+		src      string
+		expected []string // doc comment of each type parameter
+	}{
+		{"func f[T]() {}", nil},
+		{"type M[\n// K is the key type.\nK comparable,\n// V is the value type.\n// It may be anything.\nV] map[K]V", []string{"// K is the key type.", "// V is the value type.// It may be anything."}},
+		{"type P[K,\n/* V doc */\nV] struct{}", []string{"", "/* V doc */"}},
+		{"type P[K, /* not a doc comment */ V] struct{}", nil},
+		{"func f[\n// T is the element type.\nT, U]() {}", []string{"// T is the element type.", ""}},
+	} {
+		f, err := ParseFile(token.NewFileSet(), "", "package p; "+test.src, ParseComments)
+		if err != nil {
+			t.Errorf("%q: %v", test.src, err)
+			continue
+		}
+		var tpDecl *ast.TypeParamDecl
+		switch decl := f.Decls[0].(type) {
+		case *ast.FuncDecl:
+			tpDecl = decl.TypeParams
+		case *ast.GenDecl:
+			tpDecl = decl.Specs[0].(*ast.TypeSpec).TypeParams
+		}
+		if test.expected == nil {
+			if tpDecl.Docs != nil {
+				t.Errorf("%q: expected no doc comments, got %d", test.src, len(tpDecl.Docs))
+			}
+			continue
+		}
+		if len(tpDecl.Docs) != len(tpDecl.Names) {
+			t.Errorf("%q: got %d doc comments for %d type parameters", test.src, len(tpDecl.Docs), len(tpDecl.Names))
+			continue
+		}
+		for i, doc := range tpDecl.Docs {
+			if got := commentText(doc); got != test.expected[i] {
+				t.Errorf("%q: got doc comment %q for %s, expected %q", test.src, got, tpDecl.Names[i].Name, test.expected[i])
+			}
+		}
+	}
+}
+
 func TestBracketExpression(t *testing.T) {
 	testCases := []struct {
 		src      string
@@ -705,6 +878,38 @@ func TestBracketExpression(t *testing.T) {
 				},
 			},
 		},
+		{
+			// A type argument may be a constant. Expect *ast.TypeArgExpr.
+			src: "a[T, 3]",
+			expected: &ast.TypeArgExpr{
+				X: ast.NewIdent("a"),
+				Types: []ast.Expr{
+					ast.NewIdent("T"),
+					&ast.BasicLit{Kind: token.INT, Value: "3"},
+				},
+			},
+		},
+		{
+			// A list of type arguments may end with a comma. Expect
+			// *ast.TypeArgExpr.
+			src: "a[\n\tT,\n\tU,\n]",
+			expected: &ast.TypeArgExpr{
+				X: ast.NewIdent("a"),
+				Types: []ast.Expr{
+					ast.NewIdent("T"),
+					ast.NewIdent("U"),
+				},
+			},
+		},
+		{
+			// The trailing comma disambiguates the expression. Expect
+			// *ast.TypeArgExpr.
+			src: "a[T,]",
+			expected: &ast.TypeArgExpr{
+				X:     ast.NewIdent("a"),
+				Types: []ast.Expr{ast.NewIdent("T")},
+			},
+		},
 		{
 			// The colon disambiguates the expression. Expect *ast.SliceExpr.
 			src: "a[T:U]",
@@ -75,6 +75,13 @@ var valids = []string{
 	`package p; func _([5]string, T[int, bool]) { }`,
 	`package p; func (T[U]) _() U { }`,
 	`package p; func (x T[U]) _() U { }`,
+	`package p; type T[K comparable] map[K]bool`,
+	`package p; type T[K comparable, V] map[K]V`,
+	`package p; func f[T comparable, U] (t T) U {}`,
+
+	// Interface methods with type parameters
+	`package p; type I interface { Map[U](func(T) U) []U }`,
+	`package p; type I interface { f[T, U](T) U; g() }`,
 
 	// Top-level variable assignments and declarations
 	`package p; var _ T[U]`,
@@ -123,6 +130,15 @@ var valids = []string{
 	`package p; func _() { switch n := x.(type) { case T[U]: break } }`,
 	`package p; func _() { _ = x.(T[U]) }`,
 	`package p; func _() { _ = T[U](x) }`,
+
+	// Trailing commas
+	`package p; type T[U, V,] map[U]V`,
+	"package p; type T[\n\tU,\n\tV,\n] map[U]V",
+	`package p; func f[T, U,] (t T, u U) {}`,
+	`package p; var _ T[U, V,]`,
+	`package p; var _ = T[U, V,]{}`,
+	"package p; var _ = T[\n\tU,\n\tV,\n]{}",
+	`package p; func _() { f[T, U,]() }`,
 }
 
 func TestValid(t *testing.T) {
@@ -207,16 +223,29 @@ var invalids = []string{
 
 	// Wrong type parameter syntax
 	`package p; type T[V struct /* ERROR "expected '\]', found 'struct'" */ { val: "" }`,
-	`package p; type T[V, ] /* ERROR "expected 'IDENT', found '\]'" */ struct { val: "" }`,
+	`package p; type T[V, , /* ERROR "expected 'IDENT', found ','" */ ] struct { val: "" }`,
 	`package p; func f[] /* ERROR "expected 'IDENT', found '\]'" */  () { val: "" }`,
-	`package p; func f[V, ] /* ERROR "expected 'IDENT', found '\]'" */ () { val: "" }`,
+	`package p; func f[V, , /* ERROR "expected 'IDENT', found ','" */ ] () { val: "" }`,
 	`package p; var x = T[] /* ERROR "expected operand, found '\]'" */ { val: "" }`,
 	`package p; var x = T[V { val: "" } /* ERROR "expected generic type arguments or index or slice expression, found newline" */`,
-	`package p; var x = T[V, ] /* ERROR "expected type, found '\]'" */ { val: "" }`,
+	`package p; var x = T[V, , /* ERROR "expected type, found ','" */ ] { val: "" }`,
 	`package p; func main() { x := T[] /* ERROR "expected operand, found '\]'" */ { val: "" } }`,
-	`package p; func main() { x := T[V, ] /* ERROR "expected type, found '\]'" */ { val: "" } }`,
+	`package p; func main() { x := T[V, , /* ERROR "expected type, found ','" */ ] { val: "" } }`,
 	`package p; func _(T[]) /* ERROR "expected type, found '\)'" */ {}`,
 	`package p; func _() T[] /* ERROR "expected type, found '\]'" */ {}`,
+
+	// Function types with type parameters
+	`package p; var apply func[ /* ERROR "function type cannot have type parameters" */ T](T) T`,
+	`package p; type S struct { f func[ /* ERROR "function type cannot have type parameters" */ T, U](T) U }`,
+	`package p; var _ = func[ /* ERROR "function type cannot have type parameters" */ T](x T) {}`,
+
+	// Type parameters and arguments in angle brackets
+	`package p; func f< /* ERROR "Fo uses square brackets for type parameters: write f\[T, U\]" */ T, U>(x T) U { return nil }`,
+	`package p; type Box< /* ERROR "Fo uses square brackets for type parameters: write Box\[T\]" */ T> struct { v T }; var _ int`,
+	`package p; func (b Box< /* ERROR "Fo uses square brackets for type arguments: write Box\[T\]" */ T>) Get() T { return b.v }`,
+	`package p; var m Map< /* ERROR "Fo uses square brackets for type arguments: write Map\[string, \[\]List\[\*int\]\]" */ string, []List<*int>>; var _ int`,
+	`package p; type T struct { v List< /* ERROR "Fo uses square brackets for type arguments: write List\[int\]" */ int>
+	w int }`,
 }
 
 func TestInvalid(t *testing.T) {
@@ -11,6 +11,7 @@ package printer
 
 import (
 	"bytes"
+	"sort"
 	"strconv"
 	"strings"
 	"unicode"
@@ -273,8 +274,42 @@ func (p *printer) exprList(prev0 token.Pos, list []ast.Expr, depth int, mode exp
 func (p *printer) typeParams(x *ast.TypeParamDecl) {
 	if x != nil {
 		p.print(token.LBRACK)
-		p.identList(x.Names, false)
-		p.print(token.RBRACK)
+		if x.Constraints == nil && x.Docs == nil && p.lineFor(x.Lbrack) == p.lineFor(x.Rbrack) {
+			p.identList(x.Names, false)
+		} else {
+			// type parameters which are written on their own line (usually
+			// because they have a doc comment) are indented like parameters
+			prevLine := p.lineFor(x.Lbrack)
+			ws := indent
+			for i, name := range x.Names {
+				if i > 0 {
+					p.print(token.COMMA)
+				}
+				line := p.lineFor(name.Pos())
+				if 0 < prevLine && prevLine < line && p.linebreak(line, 0, ws, true) {
+					ws = ignore
+				} else if i > 0 {
+					p.print(blank)
+				}
+				p.expr(name)
+				prevLine = p.lineFor(name.End())
+				if i < len(x.Constraints) && x.Constraints[i] != nil {
+					p.print(blank)
+					p.expr(x.Constraints[i])
+					prevLine = p.lineFor(x.Constraints[i].End())
+				}
+			}
+			// if the closing "]" is on a separate line from the last type
+			// parameter, print an additional "," and line break
+			if closing := p.lineFor(x.Rbrack); 0 < prevLine && prevLine < closing {
+				p.print(token.COMMA)
+				p.linebreak(closing, 0, ignore, true)
+			}
+			if ws == ignore {
+				p.print(unindent)
+			}
+		}
+		p.print(x.Rbrack, token.RBRACK)
 	}
 }
 
@@ -497,6 +532,7 @@ func (p *printer) fieldList(fields *ast.FieldList, isStruct, isIncomplete bool)
 			if ftyp, isFtyp := f.Type.(*ast.FuncType); isFtyp {
 				// method
 				p.expr(f.Names[0])
+				p.typeParams(ftyp.TypeParams)
 				p.signature(ftyp.Params, ftyp.Results)
 			} else {
 				// embedded interface
@@ -899,14 +935,49 @@ func (p *printer) expr1(expr ast.Expr, prec1, depth int) {
 	case *ast.TypeArgExpr:
 		p.expr(x.X)
 		p.print(token.LBRACK)
-		p.exprList(x.Pos(), x.Types, 1, 0, token.NoPos)
-		p.print(token.RBRACK)
+		// type arguments which span multiple lines are printed like the
+		// elements of a composite literal, with a terminating comma
+		p.exprList(x.Pos(), x.Types, 1, commaTerm, x.Rbrack)
+		p.print(x.Rbrack, token.RBRACK)
+
+	case *ast.EnumType:
+		p.enumType(x)
 
 	default:
 		panic("unreachable")
 	}
 }
 
+// enumType prints an enum type like a struct type: on one line if the values
+// are on one line in the source, and one value per line otherwise.
+func (p *printer) enumType(x *ast.EnumType) {
+	p.print(x.Enum, &ast.Ident{NamePos: x.Enum, Name: "enum"})
+	if len(x.Values) == 0 {
+		p.print(x.Lbrace, token.LBRACE, x.Rbrace, token.RBRACE)
+		return
+	}
+	srcIsOneLine := x.Lbrace.IsValid() && x.Rbrace.IsValid() && p.lineFor(x.Lbrace) == p.lineFor(x.Rbrace)
+	if srcIsOneLine && !p.commentBefore(p.posFor(x.Rbrace)) {
+		p.print(x.Lbrace, token.LBRACE, blank)
+		for i, v := range x.Values {
+			if i > 0 {
+				p.print(token.COMMA, blank)
+			}
+			p.expr(v)
+		}
+		p.print(blank, x.Rbrace, token.RBRACE)
+		return
+	}
+	p.print(blank, x.Lbrace, token.LBRACE, indent, formfeed)
+	for i, v := range x.Values {
+		if i > 0 {
+			p.linebreak(p.lineFor(v.Pos()), 1, ignore, false)
+		}
+		p.expr(v)
+	}
+	p.print(unindent, formfeed, x.Rbrace, token.RBRACE)
+}
+
 func (p *printer) possibleSelectorExpr(expr ast.Expr, prec1, depth int) bool {
 	if x, ok := expr.(*ast.SelectorExpr); ok {
 		return p.selectorExpr(x, depth, true)
@@ -960,7 +1031,12 @@ func (p *printer) stmtList(list []ast.Stmt, nindent int, nextIsRBrace bool) {
 			if len(p.output) > 0 {
 				// only print line break if we are not at the beginning of the output
 				// (i.e., we are not printing only a partial program)
-				p.linebreak(p.lineFor(s.Pos()), 1, ignore, i == 0 || nindent == 0 || p.linesFrom(line) > 0)
+				next := p.lineFor(s.Pos())
+				if i == 0 && p.Config.Mode&StrictFormat != 0 && next > p.pos.Line+1 {
+					// no empty line at the start of the block
+					next = p.pos.Line + 1
+				}
+				p.linebreak(next, 1, ignore, i == 0 || nindent == 0 || p.linesFrom(line) > 0)
 			}
 			p.recordLine(&line)
 			p.stmt(s, nextIsRBrace && i == len(list)-1)
@@ -987,7 +1063,12 @@ func (p *printer) stmtList(list []ast.Stmt, nindent int, nextIsRBrace bool) {
 func (p *printer) block(b *ast.BlockStmt, nindent int) {
 	p.print(b.Lbrace, token.LBRACE)
 	p.stmtList(b.List, nindent, true)
-	p.linebreak(p.lineFor(b.Rbrace), 1, ignore, true)
+	end := p.lineFor(b.Rbrace)
+	if p.Config.Mode&StrictFormat != 0 && end > p.pos.Line+1 {
+		// no empty line at the end of the block
+		end = p.pos.Line + 1
+	}
+	p.linebreak(end, 1, ignore, true)
 	p.print(b.Rbrace, token.RBRACE)
 }
 
@@ -1494,6 +1575,8 @@ func (p *printer) genDecl(d *ast.GenDecl) {
 					p.recordLine(&line)
 					p.valueSpec(s.(*ast.ValueSpec), keepType[i])
 				}
+			} else if d.Tok == token.IMPORT && p.Config.Mode&StrictFormat != 0 && !p.hasCommentsIn(d.Lparen, d.Rparen) {
+				p.groupedImportSpecs(d.Specs)
 			} else {
 				var line int
 				for i, s := range d.Specs {
@@ -1514,6 +1597,72 @@ func (p *printer) genDecl(d *ast.GenDecl) {
 	}
 }
 
+// groupedImportSpecs prints the specs of an import declaration in the
+// StrictFormat mode: the imports of the standard library first, sorted by
+// path, and then the others in their original groups, with an empty line
+// between the groups.
+func (p *printer) groupedImportSpecs(specs []ast.Spec) {
+	// group[i] is the number of the group of specs[i] in the source.
+	group := make([]int, len(specs))
+	var std, other []int
+	for i, s := range specs {
+		if i > 0 {
+			group[i] = group[i-1]
+			if p.lineFor(s.Pos()) > p.lineFor(specs[i-1].End())+1 {
+				group[i]++
+			}
+		}
+		if isStdImport(s.(*ast.ImportSpec)) {
+			std = append(std, i)
+		} else {
+			other = append(other, i)
+		}
+	}
+	sort.SliceStable(std, func(i, j int) bool {
+		return importPath(specs[std[i]]) < importPath(specs[std[j]])
+	})
+	for k, i := range append(std, other...) {
+		if k > 0 {
+			lines := 1
+			if k == len(std) || k > len(std) && group[i] != group[other[k-len(std)-1]] {
+				lines = 2
+			}
+			p.linebreak(p.pos.Line+lines, 1, ignore, false)
+		}
+		p.spec(specs[i], len(specs), false)
+	}
+}
+
+// isStdImport reports whether s imports a package of the standard library,
+// i.e. whether the first element of its path has no dot like a domain name.
+func isStdImport(s *ast.ImportSpec) bool {
+	path := importPath(s)
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		path = path[:i]
+	}
+	return !strings.Contains(path, ".")
+}
+
+// importPath returns the unquoted path of the import spec s.
+func importPath(s ast.Spec) string {
+	path, err := strconv.Unquote(s.(*ast.ImportSpec).Path.Value)
+	if err != nil {
+		return s.(*ast.ImportSpec).Path.Value
+	}
+	return path
+}
+
+// hasCommentsIn reports whether the file being printed has comments between
+// the positions from and to.
+func (p *printer) hasCommentsIn(from, to token.Pos) bool {
+	for _, g := range p.comments {
+		if from <= g.Pos() && g.End() <= to {
+			return true
+		}
+	}
+	return false
+}
+
 // nodeSize determines the size of n in chars after formatting.
 // The result is <= maxSize if the node fits on one line with at
 // most maxSize chars and the formatted output doesn't contain
@@ -1534,7 +1683,7 @@ func (p *printer) nodeSize(n ast.Node, maxSize int) (size int) {
 	// nodeSize computation must be independent of particular
 	// style so that we always get the same decision; print
 	// in RawFormat
-	cfg := Config{Mode: RawFormat}
+	cfg := Config{Mode: RawFormat | p.Config.Mode&StrictFormat}
 	var buf bytes.Buffer
 	if err := cfg.fprint(&buf, p.fset, n, p.nodeSizes); err != nil {
 		return
@@ -928,6 +928,9 @@ func (p *printer) print(args ...interface{}) {
 
 		case *ast.BasicLit:
 			data = x.Value
+			if p.Config.Mode&StrictFormat != 0 && x.Kind == token.INT {
+				data = octalPrefix(data)
+			}
 			isLit = true
 			impliedSemi = true
 			p.lastTok = x.Kind
@@ -1008,6 +1011,15 @@ func (p *printer) print(args ...interface{}) {
 	}
 }
 
+// octalPrefix returns the integer literal lit with the 0o prefix if it is an
+// octal literal with the old 0 prefix (e.g. 0o755 for 0755).
+func octalPrefix(lit string) string {
+	if len(lit) > 1 && lit[0] == '0' && '0' <= lit[1] && lit[1] <= '7' {
+		return "0o" + lit[1:]
+	}
+	return lit
+}
+
 // flush prints any pending comments and whitespace occurring textually
 // before the position of the next token tok. The flush result indicates
 // if a newline was written or if a formfeed was dropped from the whitespace
@@ -1273,8 +1285,21 @@ const (
 	TabIndent                  // use tabs for indentation independent of UseSpaces
 	UseSpaces                  // use spaces instead of tabs for alignment
 	SourcePos                  // emit //line directives to preserve original source positions
+	StrictFormat               // format more strictly than gofmt; see below
 )
 
+// The StrictFormat mode is a profile in the spirit of gofumpt, which leaves
+// fewer formatting choices to the author:
+//
+//   - There are no empty lines at the start and the end of blocks (including
+//     function bodies and the bodies of case clauses).
+//   - The imports of the standard library form the first group of a
+//     parenthesized import declaration, sorted by path, followed by the
+//     other imports (in their original groups). Declarations with comments
+//     inside the parentheses are left alone.
+//   - Octal integer literals have the 0o prefix (e.g. 0o755 for 0755), which
+//     requires Go 1.13.
+
 // A Config node controls the output of Fprint.
 type Config struct {
 	Mode     Mode // default: 0
@@ -36,6 +36,7 @@ const (
 	export checkMode = 1 << iota
 	rawFormat
 	idempotent
+	strictFormat
 )
 
 // format parses src, prints the corresponding AST, verifies the resulting
@@ -59,6 +60,9 @@ func format(src []byte, mode checkMode) ([]byte, error) {
 	if mode&rawFormat != 0 {
 		cfg.Mode |= RawFormat
 	}
+	if mode&strictFormat != 0 {
+		cfg.Mode |= StrictFormat
+	}
 
 	// print AST
 	var buf bytes.Buffer
@@ -197,6 +201,7 @@ var data = []entry{
 	{"statements.input", "statements.golden", 0},
 	{"slow.input", "slow.golden", idempotent},
 	{"generics.input", "generics.golden", 0},
+	{"strict.input", "strict.golden", strictFormat | idempotent},
 }
 
 func TestFiles(t *testing.T) {
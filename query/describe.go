@@ -0,0 +1,229 @@
+package query
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/qProust/fo/ast"
+	"github.com/qProust/fo/types"
+)
+
+// A Description is what is known about the object denoted by an identifier,
+// for the hovers of editors.
+type Description struct {
+	Object     string            `json:"object"`               // declaration of the object, as in func lib.Wrap(x T) lib.Box[T]
+	Kind       string            `json:"kind"`                 // const, var, field, type, type parameter, func, method, package, label, builtin or nil
+	Type       string            `json:"type,omitempty"`       // type of the identifier where it occurs, or the underlying type of a type name
+	Constraint string            `json:"constraint,omitempty"` // constraint of a type parameter, or const for an array length
+	TypeMap    map[string]string `json:"typeMap,omitempty"`    // type arguments of an instantiation, by type parameter
+	Definition *Result           `json:"definition,omitempty"` // declaration of the object, unless it is predeclared
+}
+
+func (d Description) String() string {
+	var buf bytes.Buffer
+	buf.WriteString(d.Object)
+	if d.Type != "" {
+		fmt.Fprintf(&buf, "\ntype: %s", d.Type)
+	}
+	if d.Constraint != "" {
+		fmt.Fprintf(&buf, "\nconstraint: %s", d.Constraint)
+	}
+	if len(d.TypeMap) > 0 {
+		var params []string
+		for param := range d.TypeMap {
+			params = append(params, param)
+		}
+		sort.Strings(params)
+		for i, param := range params {
+			params[i] = param + " = " + d.TypeMap[param]
+		}
+		fmt.Fprintf(&buf, "\ntype map: %s", strings.Join(params, ", "))
+	}
+	if d.Definition != nil {
+		fmt.Fprintf(&buf, "\ndefined at %s:%d:%d", d.Definition.Filename, d.Definition.Line, d.Definition.Column)
+	}
+	return buf.String()
+}
+
+// Describe describes the object denoted by the identifier at the given
+// position. For an instantiation of a generic declaration, such as Wrap in
+// Wrap[int] or Get in b.Get where b is a Box[int], the type is that of the
+// instantiation and the type map holds its type arguments.
+func (prog *Program) Describe(filename string, line, col int) (Description, error) {
+	pkg, id, err := prog.identAt(filename, line, col)
+	if err != nil {
+		return Description{}, err
+	}
+	obj := pkg.Info.ObjectOf(id)
+	if obj == nil {
+		return Description{}, fmt.Errorf("%s:%d:%d: no object for identifier %s", filename, line, col, id.Name)
+	}
+	f, err := prog.file(filename)
+	if err != nil {
+		return Description{}, err
+	}
+	qf := qualifier(pkg.Types)
+	decl := prog.declaration(obj)
+	d := Description{
+		Object: objectString(decl, qf),
+		Kind:   objectKind(obj),
+	}
+
+	// The type of the identifier where it occurs is that of the outermost
+	// expression which instantiates it, if any.
+	typ := obj.Type()
+	var concrete types.ConcreteType
+	for _, expr := range instantiation(f.ast, pkg.Info, id) {
+		if tv, ok := pkg.Info.Types[expr]; ok && tv.Type != nil {
+			typ = tv.Type
+		}
+		if sel, ok := expr.(*ast.SelectorExpr); ok && pkg.Info.Selections[sel] != nil {
+			recv := pkg.Info.Selections[sel].Recv()
+			if ptr, ok := recv.(*types.Pointer); ok {
+				recv = ptr.Elem()
+			}
+			if recv, ok := recv.(types.ConcreteType); ok {
+				concrete = recv
+			}
+		}
+		if c, ok := typ.(types.ConcreteType); ok {
+			concrete = c
+		}
+	}
+	if concrete != nil && len(concrete.TypeMap()) > 0 {
+		d.TypeMap = map[string]string{}
+		for param, arg := range concrete.TypeMap() {
+			d.TypeMap[param] = types.TypeString(arg, qf)
+		}
+	}
+
+	switch obj := obj.(type) {
+	case *types.TypeName:
+		if param, ok := obj.Type().(*types.TypeParam); ok {
+			d.Object = "type parameter " + obj.Name()
+			if param.IsConst() {
+				d.Constraint = "const"
+			} else if param.Constraint() != nil {
+				d.Constraint = types.TypeString(param.Constraint(), qf)
+			}
+			break
+		}
+		if typ != nil {
+			d.Type = types.TypeString(typ.Underlying(), qf)
+		}
+	case *types.PkgName, *types.Label, *types.Nil:
+	default:
+		if typ != nil {
+			d.Type = types.TypeString(typ, qf)
+		}
+	}
+	if obj.Pos().IsValid() {
+		result := prog.result(decl.Pos(), d.Object)
+		d.Definition = &result
+	}
+	return d, nil
+}
+
+// objectString returns the declaration of obj as types.ObjectString does, but
+// with the type parameter list of a generic type or function after its name,
+// as in the source: func Keys[K comparable, V](m map[K]V) []K rather than func
+// Keys(m map[K]V) []K.
+func objectString(obj types.Object, qf types.Qualifier) string {
+	s := types.ObjectString(obj, qf)
+	var params []*types.TypeParam
+	var rest bytes.Buffer // what follows the name
+	switch typ := obj.Type().(type) {
+	case *types.GenericNamed:
+		if _, ok := obj.(*types.TypeName); !ok {
+			return s
+		}
+		params = typ.TypeParams()
+		rest.WriteByte(' ')
+		types.WriteType(&rest, typ.Underlying(), qf)
+	case *types.GenericSignature:
+		if _, ok := obj.(*types.Func); !ok {
+			return s
+		}
+		params = typ.TypeParams()
+		types.WriteSignature(&rest, typ.Signature, qf)
+	}
+	if len(params) == 0 || !strings.HasSuffix(s, rest.String()) {
+		return s
+	}
+	list := make([]string, len(params))
+	for i, param := range params {
+		list[i] = param.String()
+		if param.Constraint() != nil {
+			list[i] += " " + types.TypeString(param.Constraint(), qf)
+		}
+	}
+	name := strings.TrimSuffix(s, rest.String())
+	return name + "[" + strings.Join(list, ", ") + "]" + rest.String()
+}
+
+// instantiation returns the expressions of f which enclose id and through
+// which it is instantiated or selected, from the innermost to the outermost:
+// x.id, id[T] and x.id[T].
+func instantiation(f *ast.File, info *types.Info, id *ast.Ident) []ast.Expr {
+	var exprs []ast.Expr
+	var x ast.Expr = id
+	for {
+		var next ast.Expr
+		ast.Inspect(f, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.SelectorExpr:
+				if n.Sel == x {
+					next = n
+				}
+			case *ast.TypeArgExpr:
+				if n.X == x {
+					next = n
+				}
+			case *ast.IndexExpr:
+				if _, ok := info.TypeArgs[n]; ok && n.X == x {
+					next = n
+				}
+			}
+			return next == nil
+		})
+		if next == nil {
+			return exprs
+		}
+		exprs = append(exprs, next)
+		x = next
+	}
+}
+
+// objectKind returns the kind of obj, as reported by Describe.
+func objectKind(obj types.Object) string {
+	switch obj := obj.(type) {
+	case *types.Const:
+		return "const"
+	case *types.Var:
+		if obj.IsField() {
+			return "field"
+		}
+		return "var"
+	case *types.TypeName:
+		if _, ok := obj.Type().(*types.TypeParam); ok {
+			return "type parameter"
+		}
+		return "type"
+	case *types.Func:
+		if sig, ok := obj.Type().(interface{ Recv() *types.Var }); ok && sig.Recv() != nil {
+			return "method"
+		}
+		return "func"
+	case *types.PkgName:
+		return "package"
+	case *types.Label:
+		return "label"
+	case *types.Builtin:
+		return "builtin"
+	case *types.Nil:
+		return "nil"
+	}
+	return ""
+}
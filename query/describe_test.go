@@ -0,0 +1,118 @@
+package query
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/qProust/fo/loader/loadertest"
+)
+
+func TestDescribe(t *testing.T) {
+	root, cleanup := loadertest.WriteTree(t, map[string]string{
+		"go.mod":     "module example.com/app\n",
+		"lib/lib.fo": libSrc,
+		"main.fo": mainSrc + `
+func Keys[K comparable, V](m map[K]V) []K {
+	return nil
+}
+
+var _ = Keys[string, lib.Box[int]](nil)
+
+type Pair[K comparable, V] struct {
+	key K
+	value V
+}
+
+func (p Pair[K, V]) WithValue[W](w W) Pair[K, W] {
+	return Pair[K, W]{key: p.key, value: w}
+}
+`,
+	})
+	defer cleanup()
+	prog, err := Load(root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		filename  string
+		line, col int
+		expected  string
+	}{
+		{
+			// instantiation of a generic function
+			"main.fo", 10, 11,
+			`func func lib.Wrap[T](x T) lib.Box[T]: func(x int) lib.Box[int] map[T:int] lib/lib.fo:15:6`,
+		},
+		{
+			// method of a concrete type
+			"main.fo", 13, 11,
+			`method func (lib.Box[T]).Get() T: func() string map[T:string] lib/lib.fo:11:17`,
+		},
+		{
+			"main.fo", 21, 10,
+			`func func Keys[K comparable, V](m map[K]V) []K: func(m map[string]lib.Box[int]) []string map[K:string V:lib.Box[int]] main.fo:17:6`,
+		},
+		{
+			"main.fo", 12, 6,
+			`var var g lib.Getter: lib.Getter map[] main.fo:12:6`,
+		},
+		{
+			"main.fo", 12, 11,
+			`package package lib ("example.com/app/lib"):  map[] main.fo:3:8`,
+		},
+		{
+			// the underlying type of a generic type
+			"lib/lib.fo", 7, 6,
+			`type type Box[T] struct{value T}: struct{value T} map[] lib/lib.fo:7:6`,
+		},
+		{
+			// a generic type with a constraint
+			"main.fo", 23, 6,
+			`type type Pair[K comparable, V] struct{key K; value V}: struct{key K; value V} map[] main.fo:23:6`,
+		},
+		{
+			// a method with type parameters of its own
+			"main.fo", 28, 21,
+			`method func (Pair[K, V]).WithValue[W](w W) Pair[K, W]: func[W](w W) Pair[K, W] map[] main.fo:28:21`,
+		},
+		{
+			"main.fo", 17, 11,
+			`type parameter type parameter K (comparable):  map[] main.fo:17:11`,
+		},
+		{
+			"lib/lib.fo", 15, 11,
+			`type parameter type parameter T:  map[] lib/lib.fo:15:11`,
+		},
+		{
+			"main.fo", 12, 16,
+			`type type lib.Getter interface{Get() int}: interface{Get() int} map[] lib/lib.fo:3:6`,
+		},
+	} {
+		d, err := prog.Describe(filepath.Join(root, test.filename), test.line, test.col)
+		if err != nil {
+			t.Errorf("%s:%d:%d: unexpected error: %s", test.filename, test.line, test.col, err)
+			continue
+		}
+		object := d.Object
+		if d.Constraint != "" {
+			object += " (" + d.Constraint + ")"
+		}
+		rel, _ := filepath.Rel(root, d.Definition.Filename)
+		got := fmt.Sprintf("%s %s: %s %v %s:%d:%d", d.Kind, object, d.Type, d.TypeMap, filepath.ToSlash(rel), d.Definition.Line, d.Definition.Column)
+		if got != test.expected {
+			t.Errorf("%s:%d:%d: expected\n%s\ngot\n%s", test.filename, test.line, test.col, test.expected, got)
+		}
+	}
+
+	// Editors may give positions as byte offsets.
+	line, col, err := prog.LineColumn(filepath.Join(root, "main.fo"), len(mainSrc)+11)
+	if err != nil || line != 17 || col != 11 {
+		t.Errorf("got %d:%d, %v for an offset", line, col, err)
+	}
+
+	if d, err := prog.Describe(filepath.Join(root, "main.fo"), 21, 36); err != nil || d.Kind != "nil" || d.Definition != nil {
+		t.Errorf("got %+v, %v for a predeclared object", d, err)
+	}
+}
@@ -0,0 +1,283 @@
+package query
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/qProust/fo/ast"
+	"github.com/qProust/fo/token"
+	"github.com/qProust/fo/types"
+)
+
+// A Symbol is a declaration in the outline of a file, for the breadcrumbs and
+// symbol search of editors.
+type Symbol struct {
+	Name       string   `json:"name"`
+	Kind       string   `json:"kind"`                 // const, var, type, func, method or field
+	Detail     string   `json:"detail,omitempty"`     // type or signature, with struct and interface types abbreviated
+	TypeParams []string `json:"typeParams,omitempty"` // type parameters of a generic declaration
+	Instances  []string `json:"instances,omitempty"`  // instantiations of a generic declaration, e.g. Box[int].Get
+	Range      Range    `json:"range"`                // extent of the declaration, without its doc comment
+	NameRange  Range    `json:"nameRange"`            // extent of the name
+	Children   []Symbol `json:"children,omitempty"`   // fields, methods and enum values of a type
+}
+
+// A Range is an extent of the source of a Program. The end is exclusive.
+type Range struct {
+	Line      int `json:"line"`
+	Column    int `json:"column"`
+	EndLine   int `json:"endLine"`
+	EndColumn int `json:"endColumn"`
+}
+
+// Outline returns the symbols declared at the package level of the file
+// filename, in source order. The methods of a type declared in the file are
+// children of its symbol; other methods are named after their receiver type,
+// as in Box.Get. The instances of generic declarations include those of all
+// packages of prog.
+func (prog *Program) Outline(filename string) ([]Symbol, error) {
+	f, err := prog.file(filename)
+	if err != nil {
+		return nil, err
+	}
+	o := &outliner{prog: prog, pkg: f.pkg, qf: qualifier(f.pkg.Types)}
+	declared := map[string]bool{} // names of the types declared in the file
+	for _, decl := range f.ast.Decls {
+		if decl, ok := decl.(*ast.GenDecl); ok && decl.Tok == token.TYPE {
+			for _, spec := range decl.Specs {
+				declared[spec.(*ast.TypeSpec).Name.Name] = true
+			}
+		}
+	}
+	var symbols []Symbol
+	typeIndex := map[string]int{}    // indices of the symbols of types in symbols
+	methods := map[string][]Symbol{} // methods of the types declared in the file
+	for _, decl := range f.ast.Decls {
+		switch decl := decl.(type) {
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					typeIndex[spec.Name.Name] = len(symbols)
+					symbols = append(symbols, o.typeSymbol(spec))
+				case *ast.ValueSpec:
+					kind := "var"
+					if decl.Tok == token.CONST {
+						kind = "const"
+					}
+					for _, name := range spec.Names {
+						symbols = append(symbols, o.valueSymbol(kind, name, spec))
+					}
+				}
+			}
+		case *ast.FuncDecl:
+			if decl.Recv == nil || len(decl.Recv.List) == 0 {
+				symbols = append(symbols, o.funcSymbol(decl, ""))
+				continue
+			}
+			recv := recvName(decl.Recv.List[0].Type)
+			method := o.funcSymbol(decl, recv)
+			if declared[recv] {
+				methods[recv] = append(methods[recv], method)
+				continue
+			}
+			method.Name = recv + "." + method.Name
+			symbols = append(symbols, method)
+		}
+	}
+	for recv, list := range methods {
+		i := typeIndex[recv]
+		symbols[i].Children = append(symbols[i].Children, list...)
+	}
+	return symbols, nil
+}
+
+// An outliner creates the symbols of the outline of a file of pkg.
+type outliner struct {
+	prog *Program
+	pkg  *Package
+	qf   types.Qualifier
+}
+
+func (o *outliner) symbol(name, kind string, node ast.Node, id *ast.Ident) Symbol {
+	return Symbol{
+		Name:      name,
+		Kind:      kind,
+		Range:     o.rangeOf(node.Pos(), node.End()),
+		NameRange: o.rangeOf(id.Pos(), id.End()),
+	}
+}
+
+func (o *outliner) rangeOf(pos, end token.Pos) Range {
+	start, stop := o.prog.Fset.Position(pos), o.prog.Fset.Position(end)
+	return Range{Line: start.Line, Column: start.Column, EndLine: stop.Line, EndColumn: stop.Column}
+}
+
+func (o *outliner) typeSymbol(spec *ast.TypeSpec) Symbol {
+	sym := o.symbol(spec.Name.Name, "type", spec, spec.Name)
+	typ := spec.Type
+	sym.TypeParams = typeParamNames(spec.TypeParams)
+	if decl := o.pkg.Types.Generics()[spec.Name.Name]; decl != nil {
+		if array, ok := typ.(*ast.ArrayType); ok && spec.TypeParams == nil {
+			// The parser cannot tell a single type parameter apart from the
+			// length of an array type, as in type Box [T]struct{...}.
+			if param, ok := array.Len.(*ast.Ident); ok {
+				sym.TypeParams = []string{param.Name}
+				typ = array.Elt
+			}
+		}
+		for _, usg := range decl.Usages {
+			sym.Instances = append(sym.Instances, spec.Name.Name+o.typeArgs(decl.Type.TypeParams(), usg))
+		}
+		sym.Instances = sortedUnique(sym.Instances)
+	}
+	sym.Detail = typeDetail(typ)
+	switch typ := typ.(type) {
+	case *ast.StructType:
+		for _, field := range typ.Fields.List {
+			for _, name := range field.Names {
+				child := o.symbol(name.Name, "field", field, name)
+				child.Detail = types.ExprString(field.Type)
+				sym.Children = append(sym.Children, child)
+			}
+		}
+	case *ast.InterfaceType:
+		for _, field := range typ.Methods.List {
+			ftyp, ok := field.Type.(*ast.FuncType)
+			if !ok || len(field.Names) == 0 {
+				continue
+			}
+			name := field.Names[0]
+			child := o.symbol(name.Name, "method", field, name)
+			child.Detail = types.ExprString(ftyp)
+			child.TypeParams = typeParamNames(ftyp.TypeParams)
+			child.Instances = o.methodInstances(spec.Name.Name, name.Name)
+			sym.Children = append(sym.Children, child)
+		}
+	case *ast.EnumType:
+		for _, value := range typ.Values {
+			sym.Children = append(sym.Children, o.symbol(value.Name, "const", value, value))
+		}
+	}
+	return sym
+}
+
+func (o *outliner) valueSymbol(kind string, name *ast.Ident, spec *ast.ValueSpec) Symbol {
+	sym := o.symbol(name.Name, kind, spec, name)
+	if spec.Type != nil {
+		sym.Detail = types.ExprString(spec.Type)
+	} else if obj := o.pkg.Info.Defs[name]; obj != nil && obj.Type() != nil {
+		sym.Detail = types.TypeString(obj.Type(), o.qf)
+	}
+	return sym
+}
+
+// funcSymbol returns the symbol of the function or method decl, whose receiver
+// type is named recv.
+func (o *outliner) funcSymbol(decl *ast.FuncDecl, recv string) Symbol {
+	kind := "func"
+	if decl.Recv != nil {
+		kind = "method"
+	}
+	sym := o.symbol(decl.Name.Name, kind, decl, decl.Name)
+	sym.Detail = types.ExprString(decl.Type)
+	sym.TypeParams = typeParamNames(decl.TypeParams)
+	if recv != "" {
+		sym.Instances = o.methodInstances(recv, decl.Name.Name)
+	} else if generic := o.pkg.Types.Generics()[decl.Name.Name]; generic != nil {
+		for _, usg := range generic.Usages {
+			sym.Instances = append(sym.Instances, decl.Name.Name+o.typeArgs(generic.Type.TypeParams(), usg))
+		}
+		sym.Instances = sortedUnique(sym.Instances)
+	}
+	return sym
+}
+
+// methodInstances returns the instances of the method name of the type recv,
+// which are those of its receiver type (if it is generic) combined with those
+// of the method's own type parameters, e.g. Box[int].Map[string].
+func (o *outliner) methodInstances(recv, name string) []string {
+	generic := o.pkg.Types.Generics()[recv+"."+name]
+	if generic == nil {
+		return nil
+	}
+	sig, ok := generic.Type.(*types.GenericSignature)
+	if !ok {
+		return nil
+	}
+	var instances []string
+	for _, usg := range generic.Usages {
+		instances = append(instances, recv+o.typeArgs(sig.RecvTypeParams(), usg)+"."+name+o.typeArgs(sig.TypeParams(), usg))
+	}
+	return sortedUnique(instances)
+}
+
+// typeArgs formats the type arguments of usg for params in square brackets,
+// or returns the empty string if there are no params.
+func (o *outliner) typeArgs(params []*types.TypeParam, usg types.ConcreteType) string {
+	if len(params) == 0 {
+		return ""
+	}
+	args := make([]string, len(params))
+	for i, param := range params {
+		if typ := usg.TypeMap()[param.String()]; typ != nil {
+			args[i] = types.TypeString(typ, o.qf)
+		} else {
+			args[i] = param.String()
+		}
+	}
+	return "[" + strings.Join(args, ", ") + "]"
+}
+
+// typeDetail returns the detail of a type declaration of type typ, in which
+// composite types with a body are abbreviated.
+func typeDetail(typ ast.Expr) string {
+	switch typ.(type) {
+	case *ast.StructType:
+		return "struct{...}"
+	case *ast.InterfaceType:
+		return "interface{...}"
+	case *ast.EnumType:
+		return "enum{...}"
+	}
+	return types.ExprString(typ)
+}
+
+func typeParamNames(params *ast.TypeParamDecl) []string {
+	if params == nil {
+		return nil
+	}
+	var names []string
+	for _, name := range params.Names {
+		names = append(names, name.Name)
+	}
+	return names
+}
+
+// recvName returns the name of the base type of the receiver type expr.
+func recvName(expr ast.Expr) string {
+	switch x := expr.(type) {
+	case *ast.Ident:
+		return x.Name
+	case *ast.StarExpr:
+		return recvName(x.X)
+	case *ast.ParenExpr:
+		return recvName(x.X)
+	case *ast.TypeArgExpr:
+		return recvName(x.X)
+	case *ast.IndexExpr:
+		return recvName(x.X)
+	}
+	return ""
+}
+
+func sortedUnique(list []string) []string {
+	sort.Strings(list)
+	var unique []string
+	for i, s := range list {
+		if i == 0 || s != list[i-1] {
+			unique = append(unique, s)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,98 @@
+package query
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/qProust/fo/loader/loadertest"
+)
+
+// formatSymbols formats symbols one per line, indenting children by a tab.
+func formatSymbols(symbols []Symbol, indent string) string {
+	var lines []string
+	for _, sym := range symbols {
+		line := fmt.Sprintf("%s%d:%d-%d:%d %s %s", indent, sym.Range.Line, sym.Range.Column, sym.Range.EndLine, sym.Range.EndColumn, sym.Kind, sym.Name)
+		if sym.TypeParams != nil {
+			line += "[" + strings.Join(sym.TypeParams, ", ") + "]"
+		}
+		if sym.Detail != "" {
+			line += " " + sym.Detail
+		}
+		if sym.Instances != nil {
+			line += " {" + strings.Join(sym.Instances, "; ") + "}"
+		}
+		lines = append(lines, line)
+		if children := formatSymbols(sym.Children, indent+"\t"); children != "" {
+			lines = append(lines, children)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestOutline(t *testing.T) {
+	root, cleanup := loadertest.WriteTree(t, map[string]string{
+		"go.mod": "module example.com/app\n",
+		"lib/lib.fo": libSrc + `
+func (b Box[T]) Map[U](f func(T) U) U {
+	return f(b.value)
+}
+
+type Color enum { Red, Green }
+
+const Answer = 42
+
+var Default = Box[int]{}
+`,
+		"lib/other.fo": `package lib
+
+func (c Color) String() string { return "" }
+`,
+		"main.fo": mainSrc + `
+var _ = lib.Wrap[bool](true).Map[string](nil)
+`,
+	})
+	defer cleanup()
+	prog, err := Load(root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	symbols, err := prog.Outline(filepath.Join(root, "lib", "lib.fo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `3:6-5:2 type Getter interface{...}
+	4:2-4:11 method Get func() int
+7:6-9:2 type Box[T] struct{...} {Box[bool]; Box[int]; Box[string]}
+	8:2-8:9 field value T
+	11:1-13:2 method Get func() T {Box[bool].Get; Box[int].Get; Box[string].Get}
+	19:1-21:2 method Map[U] func(f func(T) U) U {Box[bool].Map[string]}
+15:1-17:2 func Wrap[T] func(x T) Box[T] {Wrap[bool]; Wrap[int]; Wrap[string]}
+23:6-23:31 type Color enum{...}
+	23:19-23:22 const Red
+	23:24-23:29 const Green
+25:7-25:18 const Answer untyped int
+27:5-27:25 var Default Box[int]`
+	if got := formatSymbols(symbols, ""); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if got := symbols[1].NameRange; got != (Range{Line: 7, Column: 6, EndLine: 7, EndColumn: 9}) {
+		t.Errorf("got name range %+v for Box", got)
+	}
+
+	// Methods of types declared in other files are named after their
+	// receiver type.
+	symbols, err = prog.Outline(filepath.Join(root, "lib", "other.fo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := formatSymbols(symbols, ""), "3:1-3:45 method Color.String func() string"; got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	if _, err := prog.Outline(filepath.Join(root, "nosuch.fo")); err == nil {
+		t.Error("no error for a file which is not part of the program")
+	}
+}
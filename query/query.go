@@ -0,0 +1,555 @@
+// Package query answers questions about the identifiers of a Fo program, such
+// as where they are declared and where they are used, for editor integrations
+// which do not use a language server.
+//
+// Positions are given as file name, line and column, as printed by the Fo and
+// Go tools: lines and columns are 1-based and columns are counted in bytes.
+//
+// Queries are aware of generics: a generic declaration and its instantiations
+// are treated as the same object, so that the referrers of a generic function
+// include all of the places where it is instantiated, and the methods and
+// fields of each concrete type are related to those of its generic type.
+package query
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+
+	"github.com/qProust/fo/ast"
+	"github.com/qProust/fo/loader"
+	"github.com/qProust/fo/parser"
+	"github.com/qProust/fo/token"
+	"github.com/qProust/fo/types"
+)
+
+// A Program is a type-checked directory tree of Fo packages.
+type Program struct {
+	Fset     *token.FileSet
+	Packages []*Package // sorted in dependency order
+
+	files map[string]*file // by absolute file name
+}
+
+// A Package is a type-checked Fo package of a Program.
+type Package struct {
+	*loader.Package
+	Files []*ast.File
+	Types *types.Package
+	Info  *types.Info
+
+	// Errors holds the syntax and type errors found in the package. Queries
+	// still work for packages with errors, but their answers may be
+	// incomplete.
+	Errors []error
+}
+
+type file struct {
+	pkg *Package
+	ast *ast.File
+	tok *token.File
+	src []byte
+}
+
+// A Result is a position in the source of a Program together with a
+// description of what is found there.
+type Result struct {
+	Filename    string `json:"filename"`
+	Line        int    `json:"line"`
+	Column      int    `json:"column"`
+	Description string `json:"description"`
+}
+
+func (r Result) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s", r.Filename, r.Line, r.Column, r.Description)
+}
+
+// Load loads and type-checks the packages in the directory tree rooted at
+// root, as found by loader.Load. Imports of packages outside of the tree are
+// resolved by imp. Syntax and type errors are recorded in the Errors field of
+// each package instead of being returned. Comments are kept in the syntax
+// trees, so that doc comments are available.
+func Load(root string, imp types.Importer) (*Program, error) {
+	fset := token.NewFileSet()
+	pkgs, err := loader.LoadFileSet(fset, root)
+	if err != nil {
+		return nil, err
+	}
+	prog := &Program{
+		Fset:  fset,
+		files: map[string]*file{},
+	}
+	checked := &programImporter{
+		checked:  map[string]*types.Package{},
+		fallback: imp,
+	}
+	for _, lpkg := range pkgs {
+		pkg := &Package{
+			Package: lpkg,
+			Info: &types.Info{
+				Types:      map[ast.Expr]types.TypeAndValue{},
+				Defs:       map[*ast.Ident]types.Object{},
+				Uses:       map[*ast.Ident]types.Object{},
+				Selections: map[*ast.SelectorExpr]*types.Selection{},
+				TypeArgs:   map[*ast.IndexExpr]*ast.TypeArgExpr{},
+			},
+		}
+		for _, filename := range append(append([]string{}, lpkg.FoFiles...), lpkg.GoFiles...) {
+			src, err := ioutil.ReadFile(filename)
+			if err != nil {
+				return nil, err
+			}
+			f, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+			if err != nil {
+				pkg.Errors = append(pkg.Errors, err)
+			}
+			if f == nil {
+				continue
+			}
+			pkg.Files = append(pkg.Files, f)
+			abs, err := filepath.Abs(filename)
+			if err != nil {
+				return nil, err
+			}
+			prog.files[abs] = &file{pkg: pkg, ast: f, tok: fset.File(f.Pos()), src: src}
+		}
+		conf := &types.Config{
+			Importer: checked,
+			Error: func(err error) {
+				pkg.Errors = append(pkg.Errors, err)
+			},
+		}
+		pkg.Types, _ = conf.Check(lpkg.ImportPath, fset, pkg.Files, pkg.Info)
+		checked.checked[lpkg.ImportPath] = pkg.Types
+		prog.Packages = append(prog.Packages, pkg)
+	}
+	return prog, nil
+}
+
+// programImporter resolves imports of the packages of a Program which were
+// already checked and uses fallback for everything else.
+type programImporter struct {
+	checked  map[string]*types.Package
+	fallback types.Importer
+}
+
+func (imp *programImporter) Import(path string) (*types.Package, error) {
+	if pkg, found := imp.checked[path]; found {
+		return pkg, nil
+	}
+	if imp.fallback == nil {
+		return nil, fmt.Errorf("can't find import: %q", path)
+	}
+	return imp.fallback.Import(path)
+}
+
+// Pos returns the position of the given line and column in the file
+// filename, which must belong to one of the packages of prog.
+func (prog *Program) Pos(filename string, line, col int) (token.Pos, error) {
+	f, err := prog.file(filename)
+	if err != nil {
+		return token.NoPos, err
+	}
+	return f.pos(line, col)
+}
+
+// LineColumn returns the line and column of the byte offset offset in the
+// file filename, which must belong to one of the packages of prog.
+func (prog *Program) LineColumn(filename string, offset int) (line, col int, err error) {
+	f, err := prog.file(filename)
+	if err != nil {
+		return 0, 0, err
+	}
+	if offset < 0 || offset > f.tok.Size() {
+		return 0, 0, fmt.Errorf("invalid offset %d in %s", offset, filename)
+	}
+	p := prog.Fset.PositionFor(f.tok.Pos(offset), false)
+	return p.Line, p.Column, nil
+}
+
+// File returns the syntax tree of the file filename and the package to which
+// it belongs.
+func (prog *Program) File(filename string) (*Package, *ast.File, error) {
+	f, err := prog.file(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f.pkg, f.ast, nil
+}
+
+func (prog *Program) file(filename string) (*file, error) {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	f, found := prog.files[abs]
+	if !found {
+		return nil, fmt.Errorf("%s is not part of any loaded package", filename)
+	}
+	return f, nil
+}
+
+func (f *file) pos(line, col int) (token.Pos, error) {
+	if line < 1 || col < 1 {
+		return token.NoPos, fmt.Errorf("invalid position %d:%d", line, col)
+	}
+	offset := 0
+	for i := 1; i < line; i++ {
+		j := bytes.IndexByte(f.src[offset:], '\n')
+		if j < 0 {
+			return token.NoPos, fmt.Errorf("%s has fewer than %d lines", f.tok.Name(), line)
+		}
+		offset += j + 1
+	}
+	end := len(f.src)
+	if j := bytes.IndexByte(f.src[offset:], '\n'); j >= 0 {
+		end = offset + j
+	}
+	if offset+col-1 > end {
+		return token.NoPos, fmt.Errorf("line %d of %s has fewer than %d columns", line, f.tok.Name(), col)
+	}
+	return f.tok.Pos(offset + col - 1), nil
+}
+
+// identAt returns the identifier at the given position. The position may
+// also directly follow the identifier, which is where editors usually place
+// the cursor after typing it.
+func (prog *Program) identAt(filename string, line, col int) (*Package, *ast.Ident, error) {
+	f, err := prog.file(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	pos, err := f.pos(line, col)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The whole file is inspected since the position of a TypeArgExpr, and
+	// thus of the expressions starting with one, is that of its "[".
+	var inside, after *ast.Ident
+	ast.Inspect(f.ast, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && id.Pos() <= pos && pos <= id.End() {
+			if pos < id.End() {
+				inside = id
+			} else {
+				after = id
+			}
+		}
+		return inside == nil
+	})
+	if inside != nil {
+		return f.pkg, inside, nil
+	}
+	if after != nil {
+		return f.pkg, after, nil
+	}
+	return nil, nil, fmt.Errorf("%s:%d:%d: no identifier at this position", filename, line, col)
+}
+
+// objectAt returns the object denoted by the identifier at the given
+// position.
+func (prog *Program) objectAt(filename string, line, col int) (*Package, types.Object, error) {
+	pkg, id, err := prog.identAt(filename, line, col)
+	if err != nil {
+		return nil, nil, err
+	}
+	obj := pkg.Info.ObjectOf(id)
+	if obj == nil {
+		return nil, nil, fmt.Errorf("%s:%d:%d: no object for identifier %s", filename, line, col, id.Name)
+	}
+	return pkg, obj, nil
+}
+
+// An objectKey identifies an object independently of the instantiations of
+// generic declarations. The methods and fields of a concrete type are
+// distinct objects from those of its generic type, but they have the same
+// position.
+type objectKey struct {
+	pkg  string
+	name string
+	pos  token.Pos
+}
+
+func keyOf(obj types.Object) objectKey {
+	key := objectKey{name: obj.Name(), pos: obj.Pos()}
+	if obj.Pkg() != nil {
+		key.pkg = obj.Pkg().Path()
+	}
+	return key
+}
+
+func (prog *Program) result(pos token.Pos, description string) Result {
+	p := prog.Fset.Position(pos)
+	return Result{
+		Filename:    p.Filename,
+		Line:        p.Line,
+		Column:      p.Column,
+		Description: description,
+	}
+}
+
+// Definition returns the position at which the object denoted by the
+// identifier at the given position is declared.
+func (prog *Program) Definition(filename string, line, col int) (Result, error) {
+	pkg, obj, err := prog.objectAt(filename, line, col)
+	if err != nil {
+		return Result{}, err
+	}
+	if !obj.Pos().IsValid() {
+		return Result{}, fmt.Errorf("%s is predeclared", obj.Name())
+	}
+	obj = prog.declaration(obj)
+	return prog.result(obj.Pos(), types.ObjectString(obj, qualifier(pkg.Types))), nil
+}
+
+// declaration returns the object declared at the position of obj. For the
+// methods and fields of a concrete type, this is the object of the generic
+// declaration.
+func (prog *Program) declaration(obj types.Object) types.Object {
+	f, err := prog.file(prog.Fset.Position(obj.Pos()).Filename)
+	if err != nil {
+		return obj
+	}
+	for id, def := range f.pkg.Info.Defs {
+		if def != nil && id.Pos() == obj.Pos() {
+			return def
+		}
+	}
+	return obj
+}
+
+// Referrers returns the positions of all uses of the object denoted by the
+// identifier at the given position, sorted by position. The uses of a generic
+// declaration include all of its instantiations and the uses of the methods
+// and fields of each of its concrete types; their descriptions name the
+// instantiation which is used.
+func (prog *Program) Referrers(filename string, line, col int) ([]Result, error) {
+	_, obj, err := prog.objectAt(filename, line, col)
+	if err != nil {
+		return nil, err
+	}
+	return prog.referrers(obj), nil
+}
+
+func (prog *Program) referrers(obj types.Object) []Result {
+	key := keyOf(obj)
+	var results []Result
+	for _, pkg := range prog.Packages {
+		qf := qualifier(pkg.Types)
+		for _, f := range pkg.Files {
+			// Parents are visited before their children, so the description of
+			// an identifier is known by the time it is reached.
+			descriptions := map[*ast.Ident]string{}
+			describe := func(id *ast.Ident, description string) {
+				if _, found := descriptions[id]; !found {
+					descriptions[id] = description
+				}
+			}
+			ast.Inspect(f, func(n ast.Node) bool {
+				switch n := n.(type) {
+				case *ast.TypeArgExpr:
+					if id := instantiated(n.X); id != nil {
+						describe(id, types.ExprString(n))
+					}
+				case *ast.IndexExpr:
+					if _, ok := pkg.Info.TypeArgs[n]; ok {
+						if id := instantiated(n.X); id != nil {
+							describe(id, types.ExprString(n))
+						}
+					}
+				case *ast.SelectorExpr:
+					if sel := pkg.Info.Selections[n]; sel != nil {
+						recv := sel.Recv()
+						if ptr, ok := recv.(*types.Pointer); ok {
+							recv = ptr.Elem()
+						}
+						if _, ok := recv.(*types.ConcreteNamed); ok {
+							describe(n.Sel, types.TypeString(recv, qf)+"."+n.Sel.Name)
+						}
+					}
+				case *ast.Ident:
+					use := pkg.Info.Uses[n]
+					if use == nil || keyOf(use) != key {
+						break
+					}
+					description, found := descriptions[n]
+					if !found {
+						description = n.Name
+					}
+					results = append(results, prog.result(n.Pos(), description))
+				}
+				return true
+			})
+		}
+	}
+	sortResults(results)
+	return results
+}
+
+// Identifiers returns the identifiers in prog which declare or refer to obj,
+// sorted by position. Like Referrers, it treats the methods and fields of
+// concrete types as the objects of their generic declarations.
+func (prog *Program) Identifiers(obj types.Object) []*ast.Ident {
+	key := keyOf(obj)
+	var ids []*ast.Ident
+	for _, pkg := range prog.Packages {
+		for _, objs := range []map[*ast.Ident]types.Object{pkg.Info.Defs, pkg.Info.Uses} {
+			for id, other := range objs {
+				if other != nil && keyOf(other) == key {
+					ids = append(ids, id)
+				}
+			}
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i].Pos() < ids[j].Pos()
+	})
+	return ids
+}
+
+// instantiated returns the identifier of the generic declaration which is
+// instantiated by an expression of the form x[T], or nil if x is not an
+// identifier or a selector.
+func instantiated(x ast.Expr) *ast.Ident {
+	switch x := x.(type) {
+	case *ast.Ident:
+		return x
+	case *ast.SelectorExpr:
+		return x.Sel
+	}
+	return nil
+}
+
+// Implements returns the implementation relations of the type named by the
+// identifier at the given position with the package-level types declared in
+// prog. For an interface type, the results are the types which implement it;
+// for any other type, they are the interfaces which it implements. Each
+// instantiation of a generic type is considered separately. Interfaces
+// without methods are ignored, since every type implements them.
+func (prog *Program) Implements(filename string, line, col int) ([]Result, error) {
+	pkg, obj, err := prog.objectAt(filename, line, col)
+	if err != nil {
+		return nil, err
+	}
+	tname, ok := obj.(*types.TypeName)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a type", obj.Name())
+	}
+	qf := qualifier(pkg.Types)
+
+	// Collect the interfaces and the other named types of the program,
+	// replacing each generic type with its instantiations.
+	var ifaces, concretes []types.Type
+	for _, p := range prog.Packages {
+		if p.Types == nil {
+			continue
+		}
+		scope := p.Types.Scope()
+		for _, name := range scope.Names() {
+			tn, ok := scope.Lookup(name).(*types.TypeName)
+			if !ok || tn.IsAlias() {
+				continue
+			}
+			switch typ := tn.Type().(type) {
+			case *types.GenericNamed:
+				if decl := p.Types.Generics()[name]; decl != nil {
+					for _, usage := range decl.Usages {
+						concretes = append(concretes, usage)
+					}
+				}
+			case *types.Named:
+				if iface, ok := typ.Underlying().(*types.Interface); ok {
+					if iface.NumMethods() > 0 {
+						ifaces = append(ifaces, typ)
+					}
+				} else {
+					concretes = append(concretes, typ)
+				}
+			}
+		}
+	}
+
+	targets := []types.Type{tname.Type()}
+	if _, ok := tname.Type().(*types.GenericNamed); ok {
+		targets = nil
+		if decl := tname.Pkg().Generics()[tname.Name()]; decl != nil {
+			for _, usage := range decl.Usages {
+				targets = append(targets, usage)
+			}
+		}
+	}
+
+	var results []Result
+	for _, target := range targets {
+		if iface, ok := target.Underlying().(*types.Interface); ok {
+			for _, typ := range concretes {
+				if impl := implementation(typ, iface); impl != nil {
+					description := fmt.Sprintf("%s implements %s", types.TypeString(impl, qf), types.TypeString(target, qf))
+					results = append(results, prog.result(declPos(typ), description))
+				}
+			}
+			continue
+		}
+		for _, typ := range ifaces {
+			if impl := implementation(target, typ.Underlying().(*types.Interface)); impl != nil {
+				description := fmt.Sprintf("%s implements %s", types.TypeString(impl, qf), types.TypeString(typ, qf))
+				results = append(results, prog.result(declPos(typ), description))
+			}
+		}
+	}
+	sortResults(results)
+	return results, nil
+}
+
+// implementation returns typ or a pointer to typ, whichever implements iface,
+// or nil if neither does.
+func implementation(typ types.Type, iface *types.Interface) types.Type {
+	if types.Implements(typ, iface) {
+		return typ
+	}
+	if ptr := types.NewPointer(typ); types.Implements(ptr, iface) {
+		return ptr
+	}
+	return nil
+}
+
+// declPos returns the position of the declaration of a named type, which is
+// that of its generic type for a concrete type.
+func declPos(typ types.Type) token.Pos {
+	switch typ := typ.(type) {
+	case *types.Named:
+		return typ.Obj().Pos()
+	case types.ConcreteType:
+		return typ.GenericType().Object().Pos()
+	}
+	return token.NoPos
+}
+
+// qualifier returns a types.Qualifier which qualifies the objects of packages
+// other than pkg by their package name, as they are referred to in pkg, and
+// which prints instantiations as they are written in Fo source.
+func qualifier(pkg *types.Package) types.Qualifier {
+	return types.FoNames(func(other *types.Package) string {
+		if other == pkg {
+			return ""
+		}
+		return other.Name()
+	})
+}
+
+func sortResults(results []Result) {
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		if a.Column != b.Column {
+			return a.Column < b.Column
+		}
+		return a.Description < b.Description
+	})
+}
@@ -0,0 +1,205 @@
+package query
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/qProust/fo/loader/loadertest"
+)
+
+const libSrc = `package lib
+
+type Getter interface {
+	Get() int
+}
+
+type Box[T] struct {
+	value T
+}
+
+func (b Box[T]) Get() T {
+	return b.value
+}
+
+func Wrap[T](x T) Box[T] {
+	return Box[T]{value: x}
+}
+`
+
+const mainSrc = `package main
+
+import "example.com/app/lib"
+
+type Counter int
+
+func (c Counter) Get() int { return int(c) }
+
+func main() {
+	b := lib.Wrap[int](1)
+	s := lib.Wrap[string]("x")
+	var g lib.Getter = b
+	_, _ = s.Get(), g
+	_ = b.Get()
+}
+`
+
+func loadTestProgram(t *testing.T) (*Program, string, func()) {
+	t.Helper()
+	root, cleanup := loadertest.WriteTree(t, map[string]string{
+		"go.mod":     "module example.com/app\n",
+		"lib/lib.fo": libSrc,
+		"main.fo":    mainSrc,
+	})
+	prog, err := Load(root, nil)
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	for _, pkg := range prog.Packages {
+		if len(pkg.Errors) > 0 {
+			cleanup()
+			t.Fatalf("unexpected errors in %s: %v", pkg.ImportPath, pkg.Errors)
+		}
+	}
+	return prog, root, cleanup
+}
+
+// formatResults formats results with file names relative to root.
+func formatResults(root string, results []Result) string {
+	var lines []string
+	for _, r := range results {
+		rel, _ := filepath.Rel(root, r.Filename)
+		lines = append(lines, fmt.Sprintf("%s:%d:%d: %s", filepath.ToSlash(rel), r.Line, r.Column, r.Description))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestDefinition(t *testing.T) {
+	prog, root, cleanup := loadTestProgram(t)
+	defer cleanup()
+
+	for _, test := range []struct {
+		line, col int
+		expected  string
+	}{
+		{10, 11, "lib/lib.fo:15:6: func lib.Wrap"},
+		{10, 15, "lib/lib.fo:15:6: func lib.Wrap"}, // directly after the identifier
+		{12, 6, "main.fo:12:6: var g lib.Getter"},
+		{14, 8, "lib/lib.fo:11:17"}, // method of a concrete type
+	} {
+		result, err := prog.Definition(filepath.Join(root, "main.fo"), test.line, test.col)
+		if err != nil {
+			t.Errorf("%d:%d: unexpected error: %s", test.line, test.col, err)
+			continue
+		}
+		if got := formatResults(root, []Result{result}); !strings.HasPrefix(got, test.expected) {
+			t.Errorf("%d:%d: expected %q, got %q", test.line, test.col, test.expected, got)
+		}
+	}
+
+	if _, err := prog.Definition(filepath.Join(root, "main.fo"), 9, 1); err == nil {
+		t.Error("expected an error for a position without an identifier")
+	}
+}
+
+func TestReferrers(t *testing.T) {
+	prog, root, cleanup := loadTestProgram(t)
+	defer cleanup()
+
+	for _, test := range []struct {
+		filename  string
+		line, col int
+		expected  []string
+	}{
+		{
+			// generic function
+			"lib/lib.fo", 15, 6,
+			[]string{
+				"main.fo:10:11: lib.Wrap[int]",
+				"main.fo:11:11: lib.Wrap[string]",
+			},
+		},
+		{
+			// method of a generic type, used through its concrete types
+			"main.fo", 14, 8,
+			[]string{
+				"main.fo:13:11: lib.Box[string].Get",
+				"main.fo:14:8: lib.Box[int].Get",
+			},
+		},
+		{
+			// field of a generic type, used in the bodies of its
+			// declarations
+			"lib/lib.fo", 8, 2,
+			[]string{
+				"lib/lib.fo:12:11: value",
+				"lib/lib.fo:16:16: value",
+			},
+		},
+		{
+			"main.fo", 11, 2,
+			[]string{
+				"main.fo:13:9: s",
+			},
+		},
+	} {
+		results, err := prog.Referrers(filepath.Join(root, test.filename), test.line, test.col)
+		if err != nil {
+			t.Errorf("%s:%d:%d: unexpected error: %s", test.filename, test.line, test.col, err)
+			continue
+		}
+		expected := strings.Join(test.expected, "\n")
+		if got := formatResults(root, results); got != expected {
+			t.Errorf("%s:%d:%d: wrong referrers\nexpected:\n%s\ngot:\n%s", test.filename, test.line, test.col, expected, got)
+		}
+	}
+}
+
+func TestImplements(t *testing.T) {
+	prog, root, cleanup := loadTestProgram(t)
+	defer cleanup()
+
+	for _, test := range []struct {
+		filename  string
+		line, col int
+		expected  []string
+	}{
+		{
+			// interface
+			"lib/lib.fo", 3, 6,
+			[]string{
+				"lib/lib.fo:7:6: Box[int] implements Getter",
+				"main.fo:5:6: main.Counter implements Getter",
+			},
+		},
+		{
+			// generic type: Box[string] does not implement Getter
+			"lib/lib.fo", 7, 6,
+			[]string{
+				"lib/lib.fo:3:6: Box[int] implements Getter",
+			},
+		},
+		{
+			"main.fo", 5, 6,
+			[]string{
+				"lib/lib.fo:3:6: Counter implements lib.Getter",
+			},
+		},
+	} {
+		results, err := prog.Implements(filepath.Join(root, test.filename), test.line, test.col)
+		if err != nil {
+			t.Errorf("%s:%d:%d: unexpected error: %s", test.filename, test.line, test.col, err)
+			continue
+		}
+		expected := strings.Join(test.expected, "\n")
+		if got := formatResults(root, results); got != expected {
+			t.Errorf("%s:%d:%d: wrong implementations\nexpected:\n%s\ngot:\n%s", test.filename, test.line, test.col, expected, got)
+		}
+	}
+
+	if _, err := prog.Implements(filepath.Join(root, "main.fo"), 10, 2); err == nil {
+		t.Error("expected an error for an identifier which does not denote a type")
+	}
+}
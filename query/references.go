@@ -0,0 +1,124 @@
+package query
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/qProust/fo/transform"
+	"github.com/qProust/fo/types"
+)
+
+// References returns the declaration of the object denoted by the identifier
+// at the given position followed by all of its uses, like Referrers, sorted by
+// position.
+//
+// If generated is set, the results also include the corresponding positions
+// in the Go files generated from the .fo files, as found in the source maps
+// written next to them by fo build --sourcemap. Files without a source map are
+// skipped. For a generic declaration, these include the concrete declarations
+// generated for each of its instantiations.
+func (prog *Program) References(filename string, line, col int, generated bool) ([]Result, error) {
+	pkg, obj, err := prog.objectAt(filename, line, col)
+	if err != nil {
+		return nil, err
+	}
+	decl := prog.declaration(obj)
+	results := prog.referrers(obj)
+	if decl.Pos().IsValid() {
+		results = append(results, prog.result(decl.Pos(), types.ObjectString(decl, qualifier(pkg.Types))))
+	}
+	if generated {
+		var generic string
+		if decl.Pkg() != nil && decl.Pkg().Generics()[genericName(decl)] != nil {
+			generic = genericName(decl)
+		}
+		genResults, err := generatedResults(results, prog.Fset.Position(decl.Pos()).Filename, generic)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, genResults...)
+	}
+	sortResults(results)
+	return results, nil
+}
+
+// generatedResults returns the positions in generated Go files which
+// correspond to results, and the concrete declarations generated for the
+// generic declaration generic in the file declFile.
+func generatedResults(results []Result, declFile, generic string) ([]Result, error) {
+	maps := map[string]*transform.SourceMap{} // by .fo file; nil if there is none
+	sourceMap := func(filename string) (*transform.SourceMap, error) {
+		if sm, found := maps[filename]; found || !strings.HasSuffix(filename, ".fo") {
+			return sm, nil
+		}
+		sm, err := transform.ReadSourceMap(strings.TrimSuffix(filename, ".fo") + ".go.map")
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		maps[filename] = sm
+		return sm, err
+	}
+
+	type position struct {
+		filename     string
+		line, column int
+	}
+	seen := map[position]bool{}
+	var genResults []Result
+	add := func(filename string, line, column int, description string) {
+		pos := position{filename, line, column}
+		if !seen[pos] {
+			seen[pos] = true
+			genResults = append(genResults, Result{Filename: filename, Line: line, Column: column, Description: description})
+		}
+	}
+
+	for _, r := range results {
+		sm, err := sourceMap(r.Filename)
+		if err != nil {
+			return nil, err
+		}
+		if sm == nil {
+			continue
+		}
+		genFile := strings.TrimSuffix(r.Filename, ".fo") + ".go"
+		for _, p := range sm.Positions {
+			if p.SourceLine == r.Line && p.SourceColumn == r.Column {
+				add(genFile, p.Line, p.Column, "generated from "+r.Description)
+			}
+		}
+	}
+
+	if generic == "" {
+		return genResults, nil
+	}
+	sm, err := sourceMap(declFile)
+	if err != nil || sm == nil {
+		return genResults, err
+	}
+	genFile := strings.TrimSuffix(declFile, ".fo") + ".go"
+	for _, d := range sm.Decls {
+		if d.Generic == generic {
+			add(genFile, d.Line, 1, fmt.Sprintf("%s generated for %s[%s]", d.Name, generic, strings.Join(d.TypeArgs, ", ")))
+		}
+	}
+	return genResults, nil
+}
+
+// genericName returns the name by which source maps refer to the generic
+// declaration of obj, qualified by the receiver type for methods.
+func genericName(obj types.Object) string {
+	if fn, ok := obj.(*types.Func); ok {
+		if sig, ok := fn.Type().(interface{ Recv() *types.Var }); ok && sig.Recv() != nil {
+			recv := sig.Recv().Type()
+			if ptr, ok := recv.(*types.Pointer); ok {
+				recv = ptr.Elem()
+			}
+			if named, ok := recv.(types.BaseNamed); ok {
+				return named.Obj().Name() + "." + obj.Name()
+			}
+		}
+	}
+	return obj.Name()
+}
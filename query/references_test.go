@@ -0,0 +1,80 @@
+package query
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/qProust/fo/loader/loadertest"
+)
+
+func TestReferences(t *testing.T) {
+	root, cleanup := loadertest.WriteTree(t, map[string]string{
+		"go.mod":     "module example.com/app\n",
+		"lib/lib.fo": libSrc,
+		"main.fo":    mainSrc,
+		// source maps as written by fo build --sourcemap, with only the
+		// entries which matter here
+		"lib/lib.go.map": `{
+	"file": "lib.go",
+	"source": "lib.fo",
+	"decls": [
+		{"name": "Box__int", "line": 7, "endLine": 9, "sourceLine": 7, "generic": "Box", "typeArgs": ["int"]},
+		{"name": "Wrap__int", "line": 15, "endLine": 17, "sourceLine": 15, "generic": "Wrap", "typeArgs": ["int"]},
+		{"name": "Wrap__string", "line": 27, "endLine": 29, "sourceLine": 15, "generic": "Wrap", "typeArgs": ["string"]}
+	],
+	"positions": []
+}`,
+		"main.go.map": `{
+	"file": "main.go",
+	"source": "main.fo",
+	"decls": [],
+	"positions": [
+		{"line": 10, "column": 7, "sourceLine": 10, "sourceColumn": 7},
+		{"line": 10, "column": 11, "sourceLine": 10, "sourceColumn": 11},
+		{"line": 11, "column": 11, "sourceLine": 11, "sourceColumn": 11}
+	]
+}`,
+	})
+	defer cleanup()
+	prog, err := Load(root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		generated bool
+		expected  []string
+	}{
+		{
+			false,
+			[]string{
+				"lib/lib.fo:15:6: func Wrap(x T) Box[T]",
+				"main.fo:10:11: lib.Wrap[int]",
+				"main.fo:11:11: lib.Wrap[string]",
+			},
+		},
+		{
+			true,
+			[]string{
+				"lib/lib.fo:15:6: func Wrap(x T) Box[T]",
+				"lib/lib.go:15:1: Wrap__int generated for Wrap[int]",
+				"lib/lib.go:27:1: Wrap__string generated for Wrap[string]",
+				"main.fo:10:11: lib.Wrap[int]",
+				"main.fo:11:11: lib.Wrap[string]",
+				"main.go:10:11: generated from lib.Wrap[int]",
+				"main.go:11:11: generated from lib.Wrap[string]",
+			},
+		},
+	} {
+		results, err := prog.References(filepath.Join(root, "lib", "lib.fo"), 15, 6, test.generated)
+		if err != nil {
+			t.Errorf("generated=%t: unexpected error: %s", test.generated, err)
+			continue
+		}
+		expected := strings.Join(test.expected, "\n")
+		if got := formatResults(root, results); got != expected {
+			t.Errorf("generated=%t: wrong references\nexpected:\n%s\ngot:\n%s", test.generated, expected, got)
+		}
+	}
+}
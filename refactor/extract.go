@@ -0,0 +1,466 @@
+package refactor
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/qProust/fo/ast"
+	"github.com/qProust/fo/astutil"
+	"github.com/qProust/fo/format"
+	"github.com/qProust/fo/query"
+	"github.com/qProust/fo/token"
+	"github.com/qProust/fo/types"
+)
+
+// Extract moves the statements between the positions start and end in the
+// file filename into a new function called name, which is declared after the
+// function containing them, and replaces them with a call of the new
+// function. It returns the new contents of filename. The range must cover
+// whole statements of a single block, but may include the white space around
+// them.
+//
+// The local variables which the statements use but which are declared before
+// them become parameters of the new function, and the variables which they
+// declare and which are used after them become its results. If the
+// statements use type parameters of the enclosing generic function or
+// method, the new function is generic as well and is called with them as its
+// type arguments.
+//
+// Statements which return from the enclosing function, jump out of the range
+// or assign to variables declared outside of it cannot be extracted.
+func Extract(prog *query.Program, filename string, start, end token.Pos, name string) (map[string][]byte, error) {
+	if !isIdentifier(name) {
+		return nil, fmt.Errorf("%q is not a valid identifier", name)
+	}
+	pkg, file, err := prog.File(filename)
+	if err != nil {
+		return nil, err
+	}
+	if other := pkg.Types.Scope().Lookup(name); other != nil {
+		return nil, fmt.Errorf("%s is already declared in package %s at %s", name, pkg.ImportPath, prog.Fset.Position(other.Pos()))
+	}
+	var decl *ast.FuncDecl
+	for _, d := range file.Decls {
+		if fd, ok := d.(*ast.FuncDecl); ok && fd.Body != nil && fd.Body.Lbrace < start && end <= fd.Body.Rbrace {
+			decl = fd
+		}
+	}
+	if decl == nil {
+		return nil, fmt.Errorf("%s: the selection is not inside the body of a function", prog.Fset.Position(start))
+	}
+	stmts := selectStmts(decl.Body, start, end)
+	if len(stmts) == 0 {
+		return nil, fmt.Errorf("%s: the selection does not consist of whole statements of a single block", prog.Fset.Position(start))
+	}
+	sel := &selection{
+		info:  pkg.Info,
+		decl:  decl,
+		stmts: stmts,
+		start: stmts[0].Pos(),
+		end:   stmts[len(stmts)-1].End(),
+	}
+	if err := sel.checkControlFlow(); err != nil {
+		return nil, fmt.Errorf("%s: %s", prog.Fset.Position(sel.start), err)
+	}
+	params, err := sel.params()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", prog.Fset.Position(sel.start), err)
+	}
+	results := sel.results()
+	typeParams := sel.typeParams(append(append([]*types.Var{}, params...), results...))
+
+	path := prog.Fset.Position(file.Pos()).Filename
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	offset := func(pos token.Pos) int {
+		return prog.Fset.Position(pos).Offset
+	}
+	qf := qualifier(pkg.Types)
+
+	// Declaration of the new function.
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "func %s", name)
+	if len(typeParams) > 0 {
+		buf.WriteString("[")
+		for i, tp := range typeParams {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			buf.WriteString(tp.String())
+			if tp.Constraint() != nil {
+				buf.WriteString(" " + typeString(tp.Constraint(), qf))
+			}
+		}
+		buf.WriteString("]")
+	}
+	buf.WriteString("(")
+	for i, v := range params {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(v.Name() + " " + typeString(v.Type(), qf))
+	}
+	buf.WriteString(")")
+	if len(results) == 1 {
+		buf.WriteString(" " + typeString(results[0].Type(), qf))
+	} else if len(results) > 1 {
+		buf.WriteString(" (")
+		for i, v := range results {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			buf.WriteString(typeString(v.Type(), qf))
+		}
+		buf.WriteString(")")
+	}
+	buf.WriteString(" {\n\t")
+	indent := lineIndent(src, offset(sel.start))
+	body := string(src[offset(sel.start):offset(sel.end)])
+	buf.WriteString(strings.Replace(body, "\n"+indent, "\n\t", -1))
+	if len(results) > 0 {
+		buf.WriteString("\n\treturn " + strings.Join(varNames(results), ", "))
+	}
+	buf.WriteString("\n}")
+	newDecl, err := formatDecl(buf.String())
+	if err != nil {
+		return nil, err
+	}
+
+	// Call of the new function.
+	call := name
+	if len(typeParams) > 0 {
+		var names []string
+		for _, tp := range typeParams {
+			names = append(names, tp.String())
+		}
+		call += "[" + strings.Join(names, ", ") + "]"
+	}
+	call += "(" + strings.Join(varNames(params), ", ") + ")"
+	if len(results) > 0 {
+		call = strings.Join(varNames(results), ", ") + " := " + call
+	}
+
+	edits := []edit{
+		{offset: offset(sel.start), length: offset(sel.end) - offset(sel.start), text: call},
+		{offset: offset(sel.decl.End()), text: "\n\n" + newDecl},
+	}
+	return map[string][]byte{path: apply(src, edits)}, nil
+}
+
+// selectStmts returns the statements between start and end, which must be
+// consecutive statements of the same block. It returns nil if there are no
+// such statements.
+func selectStmts(body *ast.BlockStmt, start, end token.Pos) []ast.Stmt {
+	var selected []ast.Stmt
+	ast.Inspect(body, func(n ast.Node) bool {
+		if selected != nil || n == nil || n.End() <= start || end <= n.Pos() {
+			return false
+		}
+		var list []ast.Stmt
+		switch n := n.(type) {
+		case *ast.BlockStmt:
+			list = n.List
+		case *ast.CaseClause:
+			list = n.Body
+		case *ast.CommClause:
+			list = n.Body
+		default:
+			return true
+		}
+		// The outermost list whose statements are either entirely inside or
+		// entirely outside of the range is the one which is selected.
+		var inside []ast.Stmt
+		for _, stmt := range list {
+			if stmt.End() <= start || end <= stmt.Pos() {
+				continue
+			}
+			if stmt.Pos() < start || end < stmt.End() {
+				return true
+			}
+			inside = append(inside, stmt)
+		}
+		if len(inside) > 0 {
+			selected = inside
+		}
+		return true
+	})
+	return selected
+}
+
+// A selection is a list of statements to extract from a function.
+type selection struct {
+	info       *types.Info
+	decl       *ast.FuncDecl
+	stmts      []ast.Stmt
+	start, end token.Pos
+}
+
+func (sel *selection) contains(pos token.Pos) bool {
+	return sel.start <= pos && pos < sel.end
+}
+
+// local reports whether obj is a variable (including parameters and
+// receivers) declared in the function containing sel.
+func (sel *selection) local(obj types.Object) (*types.Var, bool) {
+	v, ok := obj.(*types.Var)
+	if !ok || v.IsField() || v.Pos() < sel.decl.Pos() || sel.decl.End() <= v.Pos() {
+		return nil, false
+	}
+	return v, true
+}
+
+// inspect calls f for each node of the statements of sel.
+func (sel *selection) inspect(f func(n ast.Node) bool) {
+	for _, stmt := range sel.stmts {
+		ast.Inspect(stmt, f)
+	}
+}
+
+// checkControlFlow returns an error if the statements of sel return from the
+// enclosing function or jump to a statement outside of sel.
+func (sel *selection) checkControlFlow() error {
+	var err error
+	var check func(n ast.Node, inLoop, inBreakable bool)
+	check = func(n ast.Node, inLoop, inBreakable bool) {
+		ast.Inspect(n, func(n ast.Node) bool {
+			if err != nil {
+				return false
+			}
+			switch n := n.(type) {
+			case *ast.FuncLit:
+				return false
+			case *ast.ReturnStmt:
+				err = fmt.Errorf("the selection contains a return statement")
+			case *ast.BranchStmt:
+				switch {
+				case n.Label != nil || n.Tok == token.GOTO || n.Tok == token.FALLTHROUGH:
+					err = fmt.Errorf("the selection contains a %s statement which may jump out of it", n.Tok)
+				case n.Tok == token.BREAK && !inBreakable, n.Tok == token.CONTINUE && !inLoop:
+					err = fmt.Errorf("the selection contains a %s statement which jumps out of it", n.Tok)
+				}
+			case *ast.ForStmt:
+				check(n.Body, true, true)
+				return false
+			case *ast.RangeStmt:
+				check(n.Body, true, true)
+				return false
+			case *ast.SwitchStmt:
+				check(n.Body, inLoop, true)
+				return false
+			case *ast.TypeSwitchStmt:
+				check(n.Body, inLoop, true)
+				return false
+			case *ast.SelectStmt:
+				check(n.Body, inLoop, true)
+				return false
+			}
+			return true
+		})
+	}
+	for _, stmt := range sel.stmts {
+		check(stmt, false, false)
+	}
+	return err
+}
+
+// params returns the local variables which are declared before sel and used
+// in it, in the order of their first use. It returns an error if any of them
+// is assigned or has its address taken in sel, since the new function would
+// only change a copy.
+func (sel *selection) params() ([]*types.Var, error) {
+	var params []*types.Var
+	seen := map[*types.Var]bool{}
+	sel.inspect(func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok {
+			if v, ok := sel.local(sel.info.Uses[id]); ok && !sel.contains(v.Pos()) && !seen[v] {
+				seen[v] = true
+				params = append(params, v)
+			}
+		}
+		return true
+	})
+
+	var err error
+	assigned := func(x ast.Expr) {
+		if id, ok := astutil.Unparen(x).(*ast.Ident); ok && err == nil {
+			if v, ok := sel.info.Uses[id].(*types.Var); ok && seen[v] {
+				err = fmt.Errorf("the selection assigns to %s, which is declared outside of it", id.Name)
+			}
+		}
+	}
+	sel.inspect(func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			for _, lhs := range n.Lhs {
+				assigned(lhs)
+			}
+		case *ast.IncDecStmt:
+			assigned(n.X)
+		case *ast.RangeStmt:
+			if n.Tok == token.ASSIGN {
+				assigned(n.Key)
+				if n.Value != nil {
+					assigned(n.Value)
+				}
+			}
+		case *ast.UnaryExpr:
+			if n.Op == token.AND {
+				assigned(n.X)
+			}
+		}
+		return true
+	})
+	return params, err
+}
+
+// results returns the variables which are declared in sel and used after it,
+// in the order of their declarations.
+func (sel *selection) results() []*types.Var {
+	usedAfter := map[types.Object]bool{}
+	for id, obj := range sel.info.Uses {
+		if sel.end <= id.Pos() && id.Pos() < sel.decl.End() {
+			usedAfter[obj] = true
+		}
+	}
+	var results []*types.Var
+	sel.inspect(func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok {
+			if v, ok := sel.local(sel.info.Defs[id]); ok && usedAfter[v] {
+				results = append(results, v)
+			}
+		}
+		return true
+	})
+	return results
+}
+
+// typeParams returns the type parameters of the enclosing declaration which
+// are used in sel or in the types of vars, in the order of their
+// declaration.
+func (sel *selection) typeParams(vars []*types.Var) []*types.TypeParam {
+	used := map[string]*types.TypeParam{}
+	for _, v := range vars {
+		collectTypeParams(v.Type(), used)
+	}
+	sel.inspect(func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok {
+			if obj := sel.info.Uses[id]; obj != nil {
+				collectTypeParams(obj.Type(), used)
+			}
+		}
+		return true
+	})
+
+	// The type parameters of a method are those of its receiver type followed
+	// by its own.
+	var names []*ast.Ident
+	if sel.decl.Recv != nil && len(sel.decl.Recv.List) > 0 {
+		recvType := sel.decl.Recv.List[0].Type
+		if star, ok := recvType.(*ast.StarExpr); ok {
+			recvType = star.X
+		}
+		if typeArgs, ok := recvType.(*ast.TypeArgExpr); ok {
+			for _, arg := range typeArgs.Types {
+				if id, ok := arg.(*ast.Ident); ok {
+					names = append(names, id)
+				}
+			}
+		}
+	}
+	if sel.decl.TypeParams != nil {
+		names = append(names, sel.decl.TypeParams.Names...)
+	}
+	var typeParams []*types.TypeParam
+	for _, id := range names {
+		if tp := used[id.Name]; tp != nil {
+			typeParams = append(typeParams, tp)
+			delete(used, id.Name)
+		}
+	}
+	return typeParams
+}
+
+// collectTypeParams adds the type parameters which occur in typ to used.
+func collectTypeParams(typ types.Type, used map[string]*types.TypeParam) {
+	switch t := typ.(type) {
+	case *types.TypeParam:
+		if used[t.String()] == nil {
+			used[t.String()] = t
+		}
+	case *types.Pointer:
+		collectTypeParams(t.Elem(), used)
+	case *types.Slice:
+		collectTypeParams(t.Elem(), used)
+	case *types.Array:
+		collectTypeParams(t.Elem(), used)
+	case *types.Map:
+		collectTypeParams(t.Key(), used)
+		collectTypeParams(t.Elem(), used)
+	case *types.Chan:
+		collectTypeParams(t.Elem(), used)
+	case *types.Tuple:
+		for i := 0; i < t.Len(); i++ {
+			collectTypeParams(t.At(i).Type(), used)
+		}
+	case *types.Signature:
+		collectTypeParams(t.Params(), used)
+		collectTypeParams(t.Results(), used)
+	case *types.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			collectTypeParams(t.Field(i).Type(), used)
+		}
+	case types.ConcreteType:
+		for _, arg := range t.TypeMap() {
+			collectTypeParams(arg, used)
+		}
+	}
+}
+
+// typeString returns the Fo source for typ.
+func typeString(typ types.Type, qf types.Qualifier) string {
+	return types.TypeString(typ, types.FoNames(qf))
+}
+
+// qualifier returns a types.Qualifier which qualifies the objects of packages
+// other than pkg by their package name, as they are referred to in pkg.
+func qualifier(pkg *types.Package) types.Qualifier {
+	return func(other *types.Package) string {
+		if other == pkg {
+			return ""
+		}
+		return other.Name()
+	}
+}
+
+// formatDecl formats the source of a declaration like gofmt.
+func formatDecl(decl string) (string, error) {
+	const header = "package p\n\n"
+	src, err := format.Source([]byte(header + decl))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(string(src), header), "\n"), nil
+}
+
+// lineIndent returns the white space at the start of the line containing
+// offset.
+func lineIndent(src []byte, offset int) string {
+	start := bytes.LastIndexByte(src[:offset], '\n') + 1
+	end := start
+	for end < offset && (src[end] == ' ' || src[end] == '\t') {
+		end++
+	}
+	return string(src[start:end])
+}
+
+func varNames(vars []*types.Var) []string {
+	var names []string
+	for _, v := range vars {
+		names = append(names, v.Name())
+	}
+	return names
+}
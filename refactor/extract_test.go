@@ -0,0 +1,187 @@
+package refactor
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/qProust/fo/loader/loadertest"
+	"github.com/qProust/fo/query"
+)
+
+const extractSrc = `package main
+
+type Pair[K comparable, V] struct {
+	Key   K
+	Value V
+}
+
+func Entries[K comparable, V](m map[K]V, skip K) []Pair[K, V] {
+	entries := make([]Pair[K, V], 0, len(m))
+	for k, v := range m {
+		if k == skip {
+			continue
+		}
+		entries = append(entries, Pair[K, V]{k, v})
+	}
+	return entries
+}
+
+func (p Pair[K, V]) IsZero() bool {
+	var zero K
+	return p.Key == zero
+}
+
+func Count(xs []int) int {
+	n := 0
+	for _, x := range xs {
+		if x < 0 {
+			return -1
+		}
+		n += x
+	}
+	return n
+}
+
+func main() {
+	_ = Entries[string, []int](nil, "")
+	_ = Pair[string, int]{}.IsZero()
+	_ = Count(nil)
+}
+`
+
+func extract(t *testing.T, root string, startLine, startCol, endLine, endCol int, name string) (string, error) {
+	t.Helper()
+	prog, err := query.Load(root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(root, "main.fo")
+	start, err := prog.Pos(filename, startLine, startCol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	end, err := prog.Pos(filename, endLine, endCol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed, err := Extract(prog, filename, start, end, name)
+	if err != nil {
+		return "", err
+	}
+	return string(changed[filename]), nil
+}
+
+func TestExtractGeneric(t *testing.T) {
+	root, cleanup := loadertest.WriteTree(t, map[string]string{
+		"go.mod":  "module example.com/app\n",
+		"main.fo": extractSrc,
+	})
+	defer cleanup()
+
+	for _, test := range []struct {
+		startLine, startCol, endLine, endCol int
+		name                                 string
+		before, after                        string
+	}{
+		{
+			// The white space around the statements is ignored.
+			8, 64, 15, 3, "collect",
+			`	entries := make([]Pair[K, V], 0, len(m))
+	for k, v := range m {
+		if k == skip {
+			continue
+		}
+		entries = append(entries, Pair[K, V]{k, v})
+	}
+	return entries
+}
+`,
+			`	entries := collect[K, V](m, skip)
+	return entries
+}
+
+func collect[K comparable, V](m map[K]V, skip K) []Pair[K, V] {
+	entries := make([]Pair[K, V], 0, len(m))
+	for k, v := range m {
+		if k == skip {
+			continue
+		}
+		entries = append(entries, Pair[K, V]{k, v})
+	}
+	return entries
+}
+`,
+		},
+		{
+			// The type parameters of a method come from its receiver.
+			20, 2, 20, 12, "zeroOf",
+			`	var zero K
+	return p.Key == zero
+}
+`,
+			`	zero := zeroOf[K]()
+	return p.Key == zero
+}
+
+func zeroOf[K comparable]() K {
+	var zero K
+	return zero
+}
+`,
+		},
+	} {
+		got, err := extract(t, root, test.startLine, test.startCol, test.endLine, test.endCol, test.name)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+			continue
+		}
+		expected := strings.Replace(extractSrc, test.before, test.after, 1)
+		if got != expected {
+			t.Errorf("%s: wrong result\nexpected:\n%s\ngot:\n%s", test.name, expected, got)
+			continue
+		}
+
+		// The result must still type-check.
+		resultRoot, cleanupResult := loadertest.WriteTree(t, map[string]string{
+			"go.mod":  "module example.com/app\n",
+			"main.fo": got,
+		})
+		prog, err := query.Load(resultRoot, nil)
+		cleanupResult()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if errs := prog.Packages[0].Errors; len(errs) > 0 {
+			t.Errorf("%s: result does not type-check: %v", test.name, errs)
+		}
+	}
+}
+
+func TestExtractErrors(t *testing.T) {
+	root, cleanup := loadertest.WriteTree(t, map[string]string{
+		"go.mod":  "module example.com/app\n",
+		"main.fo": extractSrc,
+	})
+	defer cleanup()
+
+	for _, test := range []struct {
+		startLine, startCol, endLine, endCol int
+		name                                 string
+		err                                  string
+	}{
+		{26, 2, 31, 3, "sum", "the selection contains a return statement"},
+		{30, 3, 30, 9, "add", "the selection assigns to n, which is declared outside of it"},
+		{9, 2, 10, 10, "collect", "the selection does not consist of whole statements of a single block"},
+		{3, 1, 3, 5, "f", "the selection is not inside the body of a function"},
+		{9, 2, 9, 42, "Pair", "Pair is already declared"},
+		{9, 2, 9, 42, "func", `"func" is not a valid identifier`},
+	} {
+		_, err := extract(t, root, test.startLine, test.startCol, test.endLine, test.endCol, test.name)
+		if err == nil {
+			t.Errorf("%d:%d-%d:%d: expected an error", test.startLine, test.startCol, test.endLine, test.endCol)
+		} else if !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%d:%d-%d:%d: expected error containing %q, got %q", test.startLine, test.startCol, test.endLine, test.endCol, test.err, err)
+		}
+	}
+}
@@ -0,0 +1,393 @@
+package refactor
+
+import (
+	"bytes"
+	"fmt"
+	goast "go/ast"
+	"go/build"
+	goparser "go/parser"
+	gotoken "go/token"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/qProust/fo/ast"
+	"github.com/qProust/fo/astutil"
+	"github.com/qProust/fo/format"
+	"github.com/qProust/fo/parser"
+	"github.com/qProust/fo/query"
+	"github.com/qProust/fo/token"
+	"github.com/qProust/fo/types"
+)
+
+// An ImportFix is the result of FixImports for one file.
+type ImportFix struct {
+	Filename string
+	Src      []byte // new contents of the file; the old contents if nothing changed
+
+	Added   []string // import paths of the imports which were added, sorted
+	Removed []string // import paths of the imports which were removed, sorted
+
+	// Missing holds the sorted names of the packages which are used by the
+	// file but which could not be found.
+	Missing []string
+}
+
+// Changed reports whether the imports of the file were changed.
+func (fix *ImportFix) Changed() bool {
+	return len(fix.Added) > 0 || len(fix.Removed) > 0
+}
+
+// Title describes the changes of fix in a few words, e.g. as the title of a
+// code action offered by an editor.
+func (fix *ImportFix) Title() string {
+	switch {
+	case len(fix.Added) == 1 && len(fix.Removed) == 0:
+		return fmt.Sprintf("Add import %q", fix.Added[0])
+	case len(fix.Added) == 0 && len(fix.Removed) == 1:
+		return fmt.Sprintf("Remove unused import %q", fix.Removed[0])
+	}
+	return "Organize imports"
+}
+
+// FixImports adds the missing imports of the .fo file filename of prog and
+// removes those which are not used, like goimports does for Go files.
+//
+// A package is missing if the file refers to one of its members, e.g. as in
+// strings.Builder, but does not import it. This includes references in type
+// arguments, such as Box[bytes.Buffer], which may be the only use of a
+// package. A missing package is looked for among the packages of prog and
+// in the standard library; it must have the name used by the file and
+// declare every exported member that the file refers to. If there are several
+// such packages, the standard library is preferred, then the one with the
+// shortest import path. Packages which cannot be found are reported in the
+// Missing field of the result and left for the user to import.
+//
+// Imports for their side effects (import _ "p") and dot imports are never
+// removed, and neither are imports of packages whose name is not known
+// because they can be neither type checked nor found. As long as the file
+// has such an import or a dot import, no imports are added, since the names
+// which they declare are not known either.
+//
+// The file is reformatted only if its imports change.
+func FixImports(prog *query.Program, filename string) (*ImportFix, error) {
+	pkg, file, err := prog.File(filename)
+	if err != nil {
+		return nil, err
+	}
+	fix := &ImportFix{Filename: prog.Fset.Position(file.Pos()).Filename}
+	fix.Src, err = ioutil.ReadFile(fix.Filename)
+	if err != nil {
+		return nil, err
+	}
+
+	// The package names which are used by the file, with the members which
+	// are selected from them. The parser resolves every identifier which is
+	// declared in the file, except for the package-level declarations of
+	// other files; imported package names are never resolved.
+	used := map[string]map[string]bool{}
+	unresolved := map[*ast.Ident]bool{}
+	for _, id := range file.Unresolved {
+		unresolved[id] = true
+	}
+	ast.Inspect(file, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if x, ok := sel.X.(*ast.Ident); ok && unresolved[x] {
+			if pkg.Types.Scope().Lookup(x.Name) == nil && types.Universe.Lookup(x.Name) == nil {
+				if used[x.Name] == nil {
+					used[x.Name] = map[string]bool{}
+				}
+				used[x.Name][sel.Sel.Name] = true
+			}
+		}
+		return true
+	})
+
+	imported := map[string]bool{} // names of the imported packages
+	guess := true                 // whether the names of all imported packages are known
+	var unused []*ast.ImportSpec
+	for _, spec := range file.Imports {
+		importPath, _ := strconv.Unquote(spec.Path.Value)
+		name := ""
+		if spec.Name != nil {
+			name = spec.Name.Name
+		} else {
+			for _, imp := range pkg.Types.Imports() {
+				if imp.Path() == importPath {
+					name = imp.Name()
+				}
+			}
+			if name == "" {
+				// The package could not be type checked, but its
+				// sources may still be found.
+				if bpkg, err := build.Import(importPath, pkg.Dir, 0); err == nil {
+					name = bpkg.Name
+				}
+			}
+		}
+		switch name {
+		case "", ".":
+			// The name of a package which could not be imported is
+			// unknown, and a dot import declares names which may be
+			// mistaken for packages, so any unresolved name may refer
+			// to them.
+			guess = false
+			continue
+		case "_":
+			continue
+		}
+		imported[name] = true
+		if used[name] == nil && importPath != "C" {
+			unused = append(unused, spec)
+		}
+	}
+	var names []string
+	for name := range used {
+		if !imported[name] && guess {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	finder := &importFinder{prog: prog, pkg: pkg}
+	var add []*ast.ImportSpec
+	for _, name := range names {
+		importPath := finder.find(name, used[name])
+		if importPath == "" {
+			fix.Missing = append(fix.Missing, name)
+			continue
+		}
+		spec := &ast.ImportSpec{Path: &ast.BasicLit{Value: strconv.Quote(importPath)}}
+		if name != defaultName(importPath) {
+			spec.Name = &ast.Ident{Name: name}
+		}
+		add = append(add, spec)
+	}
+	if len(add) == 0 && len(unused) == 0 {
+		return fix, nil
+	}
+
+	// Apply the changes to a syntax tree with comments, which the trees of
+	// prog do not have.
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, fix.Filename, fix.Src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	// Imports are added first, so that the comments of a declaration whose
+	// imports are all removed are kept.
+	for _, spec := range add {
+		importPath, _ := strconv.Unquote(spec.Path.Value)
+		name := ""
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		astutil.AddNamedImport(fset, f, name, importPath)
+		fix.Added = append(fix.Added, importPath)
+	}
+	for _, spec := range unused {
+		importPath, _ := strconv.Unquote(spec.Path.Value)
+		name := ""
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		deleteImportComments(f, name, importPath)
+		astutil.DeleteNamedImport(fset, f, name, importPath)
+		fix.Removed = append(fix.Removed, importPath)
+	}
+	sort.Strings(fix.Added)
+	sort.Strings(fix.Removed)
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, f); err != nil {
+		return nil, err
+	}
+	fix.Src = buf.Bytes()
+	return fix, nil
+}
+
+// deleteImportComments deletes the comments of the import of importPath
+// with the given name from f, which astutil.DeleteNamedImport leaves behind
+// unless the import declaration is left with a single import.
+func deleteImportComments(f *ast.File, name, importPath string) {
+	for _, spec := range f.Imports {
+		specName := ""
+		if spec.Name != nil {
+			specName = spec.Name.Name
+		}
+		if specPath, _ := strconv.Unquote(spec.Path.Value); specPath != importPath || specName != name {
+			continue
+		}
+		comments := f.Comments[:0]
+		for _, cg := range f.Comments {
+			if cg != spec.Doc && cg != spec.Comment {
+				comments = append(comments, cg)
+			}
+		}
+		f.Comments = comments
+		spec.Doc, spec.Comment = nil, nil
+	}
+}
+
+// defaultName returns the name by which the package importPath is most
+// likely declared: the last element of the path, skipping a major version
+// suffix such as /v2.
+func defaultName(importPath string) string {
+	name := path.Base(importPath)
+	if isMajorVersion(name) && path.Dir(importPath) != "." {
+		name = path.Base(path.Dir(importPath))
+	}
+	return name
+}
+
+func isMajorVersion(elem string) bool {
+	if len(elem) < 2 || elem[0] != 'v' {
+		return false
+	}
+	for _, c := range elem[1:] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// An importFinder looks for the packages which can be imported by a package
+// of a Program.
+type importFinder struct {
+	prog *query.Program
+	pkg  *query.Package
+
+	stdDirs []string // directories of the standard library, by import path
+}
+
+// find returns the import path of a package called name which exports all
+// of members, or "" if there is none.
+func (finder *importFinder) find(name string, members map[string]bool) string {
+	if importPath := finder.findStd(name, members); importPath != "" {
+		return importPath
+	}
+	var candidates []string
+	for _, pkg := range finder.prog.Packages {
+		if pkg.Name != name || pkg == finder.pkg || pkg.Types == nil {
+			continue
+		}
+		exports := true
+		for member := range members {
+			obj := pkg.Types.Scope().Lookup(member)
+			exports = exports && obj != nil && obj.Exported()
+		}
+		if exports {
+			candidates = append(candidates, pkg.ImportPath)
+		}
+	}
+	return shortest(candidates)
+}
+
+// findStd is like find but only looks for packages of the standard library,
+// which is read from the Go sources in GOROOT.
+func (finder *importFinder) findStd(name string, members map[string]bool) string {
+	if finder.stdDirs == nil {
+		finder.stdDirs = stdDirs()
+	}
+	root := filepath.Join(build.Default.GOROOT, "src")
+	var candidates []string
+	for _, dir := range finder.stdDirs {
+		importPath := filepath.ToSlash(dir[len(root)+1:])
+		if defaultName(importPath) != name {
+			continue
+		}
+		bpkg, err := build.ImportDir(dir, 0)
+		if err != nil || bpkg.Name != name {
+			continue
+		}
+		exports := goExports(dir, bpkg.GoFiles)
+		found := true
+		for member := range members {
+			found = found && exports[member]
+		}
+		if found {
+			candidates = append(candidates, importPath)
+		}
+	}
+	return shortest(candidates)
+}
+
+// stdDirs returns the directories of the packages of the standard library
+// which can be imported by other packages.
+func stdDirs() []string {
+	root := filepath.Join(build.Default.GOROOT, "src")
+	dirs := []string{}
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return nil
+		}
+		switch info.Name() {
+		case "internal", "vendor", "testdata":
+			return filepath.SkipDir
+		}
+		if path == filepath.Join(root, "cmd") {
+			return filepath.SkipDir
+		}
+		if path != root {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	return dirs
+}
+
+// goExports returns the exported package-level names declared by the given
+// Go files in dir.
+func goExports(dir string, filenames []string) map[string]bool {
+	exports := map[string]bool{}
+	fset := gotoken.NewFileSet()
+	for _, filename := range filenames {
+		f, err := goparser.ParseFile(fset, filepath.Join(dir, filename), nil, goparser.SkipObjectResolution)
+		if err != nil {
+			continue
+		}
+		for _, decl := range f.Decls {
+			switch decl := decl.(type) {
+			case *goast.FuncDecl:
+				if decl.Recv == nil {
+					exports[decl.Name.Name] = true
+				}
+			case *goast.GenDecl:
+				for _, spec := range decl.Specs {
+					switch spec := spec.(type) {
+					case *goast.TypeSpec:
+						exports[spec.Name.Name] = true
+					case *goast.ValueSpec:
+						for _, name := range spec.Names {
+							exports[name.Name] = true
+						}
+					}
+				}
+			}
+		}
+	}
+	for name := range exports {
+		if !goast.IsExported(name) {
+			delete(exports, name)
+		}
+	}
+	return exports
+}
+
+// shortest returns the shortest of the given import paths, or the first of
+// them in lexical order if there are several, or "" if there are none.
+func shortest(paths []string) string {
+	best := ""
+	for _, p := range paths {
+		if best == "" || len(p) < len(best) || len(p) == len(best) && p < best {
+			best = p
+		}
+	}
+	return best
+}
@@ -0,0 +1,133 @@
+package refactor
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/qProust/fo/loader/loadertest"
+	"github.com/qProust/fo/query"
+)
+
+var importsTree = map[string]string{
+	"go.mod": "module example.com/app\n",
+	"lib/lib.fo": `package lib
+
+type Box[T] struct {
+	Value T
+}
+
+func Get[T](b Box[T]) T {
+	return b.Value
+}
+`,
+	// A package with the same name and a shorter import path, which does
+	// not declare Get.
+	"l/lib.fo": `package lib
+
+type Box struct{}
+`,
+	"unused/unused.fo": `package unused
+
+const Answer = 42
+`,
+	"main.fo": `package main
+
+// Imports are fixed.
+import (
+	"example.com/app/unused" // not needed
+)
+
+var box lib.Box[strings.Builder]
+
+func main() {
+	_ = lib.Get[bytes.Buffer](lib.Box[bytes.Buffer]{})
+	_ = nosuch.Thing
+}
+`,
+}
+
+func TestFixImports(t *testing.T) {
+	root, cleanup := loadertest.WriteTree(t, importsTree)
+	defer cleanup()
+	prog, err := query.Load(root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fix, err := FixImports(prog, filepath.Join(root, "main.fo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"bytes", "example.com/app/lib", "strings"}; !reflect.DeepEqual(fix.Added, want) {
+		t.Errorf("added %v, want %v", fix.Added, want)
+	}
+	if want := []string{"example.com/app/unused"}; !reflect.DeepEqual(fix.Removed, want) {
+		t.Errorf("removed %v, want %v", fix.Removed, want)
+	}
+	if want := []string{"nosuch"}; !reflect.DeepEqual(fix.Missing, want) {
+		t.Errorf("missing %v, want %v", fix.Missing, want)
+	}
+	if !fix.Changed() || fix.Title() != "Organize imports" {
+		t.Errorf("got Changed() = %v, Title() = %q", fix.Changed(), fix.Title())
+	}
+	want := `package main
+
+// Imports are fixed.
+import (
+	"bytes"
+	"example.com/app/lib"
+	"strings"
+)
+
+var box lib.Box[strings.Builder]
+
+func main() {
+	_ = lib.Get[bytes.Buffer](lib.Box[bytes.Buffer]{})
+	_ = nosuch.Thing
+}
+`
+	if got := string(fix.Src); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestFixImportsUnchanged(t *testing.T) {
+	src := `package main
+
+import "example.com/app/lib"
+
+var box lib.Box[int]
+`
+	root, cleanup := loadertest.WriteTree(t, map[string]string{
+		"go.mod":     "module example.com/app\n",
+		"lib/lib.fo": importsTree["lib/lib.fo"],
+		"main.fo":    src,
+	})
+	defer cleanup()
+	prog, err := query.Load(root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fix, err := FixImports(prog, filepath.Join(root, "main.fo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fix.Changed() || string(fix.Src) != src {
+		t.Errorf("imports changed: added %v, removed %v:\n%s", fix.Added, fix.Removed, fix.Src)
+	}
+}
+
+func TestImportFixTitle(t *testing.T) {
+	for _, test := range []struct {
+		fix  ImportFix
+		want string
+	}{
+		{ImportFix{Added: []string{"strings"}}, `Add import "strings"`},
+		{ImportFix{Removed: []string{"os"}}, `Remove unused import "os"`},
+		{ImportFix{Added: []string{"strings"}, Removed: []string{"os"}}, "Organize imports"},
+	} {
+		if got := test.fix.Title(); got != test.want {
+			t.Errorf("Title() = %q, want %q", got, test.want)
+		}
+	}
+}
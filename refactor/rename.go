@@ -0,0 +1,231 @@
+// Package refactor implements refactorings of Fo programs which are aware of
+// generics. Refactorings return the new contents of the files they change
+// instead of writing them, so that callers can show or check them first.
+package refactor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/qProust/fo/ast"
+	"github.com/qProust/fo/parser"
+	"github.com/qProust/fo/query"
+	"github.com/qProust/fo/token"
+	"github.com/qProust/fo/types"
+)
+
+// Rename renames a package-level declaration of prog, which is given as
+// <package>.<name>, to the name to. The package is identified by its import
+// path or, if that is unambiguous, by its name. Rename returns the new
+// contents of the files which change, by file name.
+//
+// The declaration and all references to it in the .fo files of prog are
+// found with the type checker, so identifiers which merely have the same name
+// are left alone. References to a generic declaration include its
+// instantiations, e.g. the Map in Map[int]. The .go files which were already
+// generated from the .fo files are updated as well: the concrete
+// declarations generated for the instantiations of a generic declaration,
+// such as Map__int, are renamed along with their uses, so that the generated
+// code stays consistent with the .fo source until it is built again.
+func Rename(prog *query.Program, from, to string) (map[string][]byte, error) {
+	if !isIdentifier(to) {
+		return nil, fmt.Errorf("%q is not a valid identifier", to)
+	}
+	i := strings.LastIndex(from, ".")
+	if i <= 0 || i == len(from)-1 {
+		return nil, fmt.Errorf("invalid declaration %q (expected <package>.<name>)", from)
+	}
+	pkg, err := findPackage(prog, from[:i])
+	if err != nil {
+		return nil, err
+	}
+	scope := pkg.Types.Scope()
+	obj := scope.Lookup(from[i+1:])
+	if obj == nil {
+		return nil, fmt.Errorf("%s is not declared in package %s", from[i+1:], pkg.ImportPath)
+	}
+	if obj.Name() == to {
+		return map[string][]byte{}, nil
+	}
+	if other := scope.Lookup(to); other != nil {
+		pos := prog.Fset.Position(other.Pos())
+		return nil, fmt.Errorf("%s is already declared in package %s at %s", to, pkg.ImportPath, pos)
+	}
+
+	edits := map[string][]edit{}
+	for _, id := range prog.Identifiers(obj) {
+		pos := prog.Fset.Position(id.Pos())
+		if !ast.IsExported(to) && filepath.Dir(pos.Filename) != pkg.Dir {
+			return nil, fmt.Errorf("can't rename %s to %s: it is used outside of package %s at %s", obj.Name(), to, pkg.ImportPath, pos)
+		}
+		if other := shadowing(prog, obj, id, to); other != nil {
+			return nil, fmt.Errorf("can't rename %s to %s: the reference at %s would refer to the %s declared at %s", obj.Name(), to, pos, to, prog.Fset.Position(other.Pos()))
+		}
+		edits[pos.Filename] = append(edits[pos.Filename], edit{offset: pos.Offset, length: len(id.Name), text: to})
+	}
+	for _, other := range prog.Packages {
+		for _, filename := range other.FoFiles {
+			generated := strings.TrimSuffix(filename, ".fo") + ".go"
+			genEdits, err := generatedEdits(generated, pkg.Types, obj.Name(), to, other == pkg)
+			if err != nil {
+				return nil, err
+			}
+			if len(genEdits) > 0 {
+				edits[generated] = genEdits
+			}
+		}
+	}
+
+	result := map[string][]byte{}
+	for filename, fileEdits := range edits {
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		result[filename] = apply(src, fileEdits)
+	}
+	return result, nil
+}
+
+// shadowing returns the object other than obj which is named to and would be
+// found instead of obj at its unqualified reference id once it is renamed to
+// to, such as a local variable declared before id, or nil if there is none.
+// Qualified references (e.g. lib.Map) cannot be shadowed.
+func shadowing(prog *query.Program, obj types.Object, id *ast.Ident, to string) types.Object {
+	for _, pkg := range prog.Packages {
+		scope := pkg.Types.Scope().Innermost(id.Pos())
+		if scope == nil {
+			continue
+		}
+		if _, found := scope.LookupParent(obj.Name(), id.Pos()); found != obj {
+			return nil
+		}
+		if _, other := scope.LookupParent(to, id.Pos()); other != nil && other != obj {
+			return other
+		}
+		return nil
+	}
+	return nil
+}
+
+// findPackage returns the package of prog with the given import path or, if
+// there is none, the only package with the given name.
+func findPackage(prog *query.Program, path string) (*query.Package, error) {
+	var named []*query.Package
+	for _, pkg := range prog.Packages {
+		if pkg.ImportPath == path {
+			return pkg, nil
+		}
+		if pkg.Name == path {
+			named = append(named, pkg)
+		}
+	}
+	switch len(named) {
+	case 0:
+		return nil, fmt.Errorf("package %s not found", path)
+	case 1:
+		return named[0], nil
+	}
+	var paths []string
+	for _, pkg := range named {
+		paths = append(paths, pkg.ImportPath)
+	}
+	return nil, fmt.Errorf("package name %s is ambiguous (%s); use an import path instead", path, strings.Join(paths, ", "))
+}
+
+// generatedEdits returns the edits which rename the declaration oldName of
+// pkg to newName in the generated .go file filename, if it exists. Since
+// generated files are not type-checked, references are found with the
+// identifier resolution of the parser: an identifier is renamed if it is
+// called oldName or has the form oldName__<type arguments> and refers to a
+// package-level declaration, either unqualified if the file belongs to pkg
+// (local is true) or qualified with the name under which the file imports pkg.
+func generatedEdits(filename string, pkg *types.Package, oldName, newName string, local bool) ([]edit, error) {
+	src, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, 0)
+	if err != nil {
+		return nil, fmt.Errorf("error in '%s': %s", filename, err)
+	}
+	unresolved := map[*ast.Ident]bool{}
+	for _, id := range file.Unresolved {
+		unresolved[id] = true
+	}
+	importName := ""
+	for _, spec := range file.Imports {
+		if path, _ := strconv.Unquote(spec.Path.Value); path == pkg.Path() {
+			importName = pkg.Name()
+			if spec.Name != nil {
+				importName = spec.Name.Name
+			}
+		}
+	}
+
+	var edits []edit
+	rename := func(id *ast.Ident) {
+		if id.Name != oldName && !strings.HasPrefix(id.Name, oldName+"__") {
+			return
+		}
+		edits = append(edits, edit{
+			offset: fset.Position(id.Pos()).Offset,
+			length: len(oldName),
+			text:   newName,
+		})
+	}
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			if x, ok := n.X.(*ast.Ident); ok && importName != "" && x.Name == importName && unresolved[x] {
+				rename(n.Sel)
+			}
+		case *ast.Ident:
+			if local && (unresolved[n] || n.Obj != nil && n.Obj == file.Scope.Lookup(n.Name)) {
+				rename(n)
+			}
+		}
+		return true
+	})
+	return edits, nil
+}
+
+// An edit replaces length bytes at offset in a file with text.
+type edit struct {
+	offset int
+	length int
+	text   string
+}
+
+// apply returns a copy of src with edits applied. Edits must not overlap.
+func apply(src []byte, edits []edit) []byte {
+	sort.Slice(edits, func(i, j int) bool {
+		return edits[i].offset < edits[j].offset
+	})
+	var result []byte
+	last := 0
+	for _, e := range edits {
+		result = append(result, src[last:e.offset]...)
+		result = append(result, e.text...)
+		last = e.offset + e.length
+	}
+	return append(result, src[last:]...)
+}
+
+func isIdentifier(name string) bool {
+	for i, c := range name {
+		if !unicode.IsLetter(c) && c != '_' && (i == 0 || !unicode.IsDigit(c)) {
+			return false
+		}
+	}
+	return name != "" && !token.Lookup(name).IsKeyword()
+}
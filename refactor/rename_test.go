@@ -0,0 +1,229 @@
+package refactor
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/qProust/fo/loader/loadertest"
+	"github.com/qProust/fo/query"
+)
+
+var renameTree = map[string]string{
+	"go.mod": "module example.com/app\n",
+	"lib/lib.fo": `package lib
+
+type Box[T] struct {
+	value T
+}
+
+func Wrap[T](x T) Box[T] {
+	return Box[T]{value: x}
+}
+
+func Ints() Box[int] {
+	f := Wrap[int]
+	Wrap := f(1)
+	return Wrap
+}
+`,
+	// lib/lib.go and main.go are generated from the .fo files.
+	"lib/lib.go": `package lib
+
+type (
+	Box__int struct {
+		value int
+	}
+	Box__string struct {
+		value string
+	}
+)
+
+func Wrap__int(x int) Box__int {
+	return Box__int{value: x}
+}
+func Wrap__string(x string) Box__string {
+	return Box__string{value: x}
+}
+
+func Ints() Box__int {
+	f := Wrap__int
+	Wrap := f(1)
+	return Wrap
+}
+`,
+	"main.fo": `package main
+
+import "example.com/app/lib"
+
+func main() {
+	b := lib.Wrap[string]("x")
+	_ = b
+	_ = lib.Ints()
+}
+`,
+	"main.go": `package main
+
+import "example.com/app/lib"
+
+func main() {
+	b := lib.Wrap__string("x")
+	_ = b
+	_ = lib.Ints()
+}
+`,
+}
+
+func TestRenameGeneric(t *testing.T) {
+	root, cleanup := loadertest.WriteTree(t, renameTree)
+	defer cleanup()
+	prog, err := query.Load(root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changed, err := Rename(prog, "example.com/app/lib.Wrap", "Make")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var filenames []string
+	for filename := range changed {
+		rel, _ := filepath.Rel(root, filename)
+		filenames = append(filenames, filepath.ToSlash(rel))
+	}
+	sort.Strings(filenames)
+	if got, expected := strings.Join(filenames, " "), "lib/lib.fo lib/lib.go main.fo main.go"; got != expected {
+		t.Fatalf("expected changed files %s, got %s", expected, got)
+	}
+
+	expected := map[string]string{
+		"lib/lib.fo": `package lib
+
+type Box[T] struct {
+	value T
+}
+
+func Make[T](x T) Box[T] {
+	return Box[T]{value: x}
+}
+
+func Ints() Box[int] {
+	f := Make[int]
+	Wrap := f(1)
+	return Wrap
+}
+`,
+		"lib/lib.go": `package lib
+
+type (
+	Box__int struct {
+		value int
+	}
+	Box__string struct {
+		value string
+	}
+)
+
+func Make__int(x int) Box__int {
+	return Box__int{value: x}
+}
+func Make__string(x string) Box__string {
+	return Box__string{value: x}
+}
+
+func Ints() Box__int {
+	f := Make__int
+	Wrap := f(1)
+	return Wrap
+}
+`,
+		"main.fo": strings.Replace(renameTree["main.fo"], "lib.Wrap", "lib.Make", 1),
+		"main.go": strings.Replace(renameTree["main.go"], "lib.Wrap", "lib.Make", 1),
+	}
+	for name, src := range expected {
+		if got := string(changed[filepath.Join(root, filepath.FromSlash(name))]); got != src {
+			t.Errorf("wrong result for %s\nexpected:\n%s\ngot:\n%s", name, src, got)
+		}
+	}
+}
+
+func TestRenameErrors(t *testing.T) {
+	root, cleanup := loadertest.WriteTree(t, renameTree)
+	defer cleanup()
+	prog, err := query.Load(root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		from, to string
+		err      string
+	}{
+		{"lib.Wrap", "func", `"func" is not a valid identifier`},
+		{"Wrap", "Make", "invalid declaration"},
+		{"other.Wrap", "Make", "package other not found"},
+		{"lib.Unwrap", "Make", "Unwrap is not declared in package example.com/app/lib"},
+		{"lib.Wrap", "Box", "Box is already declared in package example.com/app/lib"},
+		{"lib.Wrap", "wrap", "can't rename Wrap to wrap: it is used outside of package example.com/app/lib"},
+	} {
+		_, err := Rename(prog, test.from, test.to)
+		if err == nil {
+			t.Errorf("%s -> %s: expected an error", test.from, test.to)
+		} else if !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s -> %s: expected error containing %q, got %q", test.from, test.to, test.err, err)
+		}
+	}
+
+	// An unexported name is fine as long as the declaration is only used in
+	// its own package.
+	if _, err := Rename(prog, "lib.Box", "box"); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+// A declaration cannot be renamed to a name which a local declaration gives
+// to something else at one of its references.
+func TestRenameShadowed(t *testing.T) {
+	root, cleanup := loadertest.WriteTree(t, map[string]string{
+		"go.mod": "module example.com/app\n",
+		"lib/lib.fo": `package lib
+
+func Pair[T, U](x T, y U) T {
+	return x
+}
+
+func use() {
+	a := 1
+	_ = Pair[int, string](a, "")
+}
+`,
+		"main.fo": `package main
+
+import "example.com/app/lib"
+
+func main() {
+	B := 2
+	_ = lib.Pair[int, string](B, "")
+}
+`,
+	})
+	defer cleanup()
+	prog, err := query.Load(root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Rename(prog, "lib.Pair", "a")
+	if want := "can't rename Pair to a: the reference at " + filepath.Join(root, "lib", "lib.fo") + ":9:6 would refer to the a declared at " + filepath.Join(root, "lib", "lib.fo") + ":8:2"; err == nil || err.Error() != want {
+		t.Errorf("expected error %q, got %v", want, err)
+	}
+	// The qualified reference in package main is not shadowed by B.
+	changes, err := Rename(prog, "lib.Pair", "B")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := string(changes[filepath.Join(root, "main.fo")]); !strings.Contains(got, "lib.B[int, string](B, \"\")") {
+		t.Errorf("wrong renamed main.fo:\n%s", got)
+	}
+}
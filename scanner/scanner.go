@@ -46,6 +46,11 @@ type Scanner struct {
 	lineOffset int  // current line offset
 	insertSemi bool // insert a semicolon before next newline
 
+	// names holds the identifiers and keywords which were scanned, so that
+	// each of them is allocated and looked up in the keywords only once. It is
+	// kept when the scanner is reused.
+	names map[string]name
+
 	// public state - ok to modify
 	ErrorCount int // number of errors encountered
 }
@@ -129,6 +134,9 @@ func (s *Scanner) Init(file *token.File, src []byte, err ErrorHandler, mode Mode
 	s.lineOffset = 0
 	s.insertSemi = false
 	s.ErrorCount = 0
+	if s.names == nil {
+		s.names = make(map[string]name, len(src)/64)
+	}
 
 	s.next()
 	if s.ch == bom {
@@ -264,12 +272,30 @@ func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9' || ch >= utf8.RuneSelf && unicode.IsDigit(ch)
 }
 
-func (s *Scanner) scanIdentifier() string {
+// A name is an identifier or keyword.
+type name struct {
+	tok token.Token // IDENT or keyword
+	lit string
+}
+
+func (s *Scanner) scanIdentifier() (token.Token, string) {
 	offs := s.offset
 	for isLetter(s.ch) || isDigit(s.ch) {
 		s.next()
 	}
-	return string(s.src[offs:s.offset])
+	if s.offset-offs == 1 {
+		// Keywords are longer than one letter, and converting a single byte to
+		// a string doesn't allocate.
+		return token.IDENT, string(s.src[offs:s.offset])
+	}
+	// The conversion in the map index expression doesn't allocate either.
+	if n, ok := s.names[string(s.src[offs:s.offset])]; ok {
+		return n.tok, n.lit
+	}
+	lit := string(s.src[offs:s.offset])
+	tok := token.Lookup(lit)
+	s.names[lit] = name{tok, lit}
+	return tok, lit
 }
 
 func digitVal(ch rune) int {
@@ -314,6 +340,17 @@ func (s *Scanner) scanNumber(seenDecimalPoint bool) (token.Token, string) {
 				// only scanned "0x" or "0X"
 				s.error(offs, "illegal hexadecimal number")
 			}
+		} else if s.ch == 'o' || s.ch == 'O' {
+			// octal int with the 0o prefix of Go 1.13
+			s.next()
+			s.scanMantissa(8)
+			if s.ch == '8' || s.ch == '9' {
+				s.scanMantissa(10)
+				s.error(offs, "illegal octal number")
+			} else if s.offset-offs <= 2 {
+				// only scanned "0o" or "0O"
+				s.error(offs, "illegal octal number")
+			}
 		} else {
 			// octal int or float
 			seenDecimalDigit := false
@@ -612,17 +649,10 @@ scanAgain:
 	insertSemi := false
 	switch ch := s.ch; {
 	case isLetter(ch):
-		lit = s.scanIdentifier()
-		if len(lit) > 1 {
-			// keywords are longer than one letter - avoid lookup otherwise
-			tok = token.Lookup(lit)
-			switch tok {
-			case token.IDENT, token.BREAK, token.CONTINUE, token.FALLTHROUGH, token.RETURN:
-				insertSemi = true
-			}
-		} else {
+		tok, lit = s.scanIdentifier()
+		switch tok {
+		case token.IDENT, token.BREAK, token.CONTINUE, token.FALLTHROUGH, token.RETURN:
 			insertSemi = true
-			tok = token.IDENT
 		}
 	case '0' <= ch && ch <= '9':
 		insertSemi = true
@@ -61,6 +61,8 @@ var tokens = [...]elt{
 	{token.INT, "123456789012345678890", literal},
 	{token.INT, "01234567", literal},
 	{token.INT, "0xcafebabe", literal},
+	{token.INT, "0o1234567", literal},
+	{token.INT, "0O17", literal},
 	{token.FLOAT, "0.", literal},
 	{token.FLOAT, ".0", literal},
 	{token.FLOAT, "3.14159265", literal},
@@ -723,6 +725,8 @@ var errors = []struct {
 	{"07800000009", token.INT, 0, "07800000009", "illegal octal number"},
 	{"0x", token.INT, 0, "0x", "illegal hexadecimal number"},
 	{"0X", token.INT, 0, "0X", "illegal hexadecimal number"},
+	{"0o", token.INT, 0, "0o", "illegal octal number"},
+	{"0o78", token.INT, 0, "0o78", "illegal octal number"},
 	{"\"abc\x00def\"", token.STRING, 4, "\"abc\x00def\"", "illegal character NUL"},
 	{"\"abc\x80def\"", token.STRING, 4, "\"abc\x80def\"", "illegal UTF-8 encoding"},
 	{"\ufeff\ufeff", token.ILLEGAL, 3, "\ufeff\ufeff", "illegal byte order mark"},                        // only first BOM is ignored
@@ -0,0 +1,261 @@
+package transform
+
+import (
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/qProust/fo/ast"
+	"github.com/qProust/fo/astutil"
+	"github.com/qProust/fo/constant"
+	"github.com/qProust/fo/token"
+	"github.com/qProust/fo/types"
+)
+
+// lowerOrderBuiltins replaces the calls of the predeclared min, max and clamp
+// in f with plain comparisons, since Go has no clamp, and min and max only as
+// of Go 1.21. A call with constant arguments is replaced by the argument which
+// is its result (e.g. max(1, n) for an untyped constant n by n), so that it is
+// still a constant, and any other call by a call of a function literal, e.g.
+// min(a, b) for int operands becomes
+//
+//	func(x int, ys ...int) int {
+//		for _, y := range ys {
+//			if y < x {
+//				x = y
+//			}
+//		}
+//		return x
+//	}(a, b)
+//
+// The operands are compared with < and >, so a floating-point NaN is only the
+// result if it is the first argument.
+//
+// If the generated code targets Go 1.21 or later, only clamp is replaced.
+func (trans *Transformer) lowerOrderBuiltins(f *ast.File) {
+	// The constant calls are replaced after their arguments, which may be
+	// constant calls themselves. Their result is looked up before that.
+	results := map[*ast.CallExpr]int{}
+	pre := func(c *astutil.Cursor) bool {
+		call, ok := c.Node().(*ast.CallExpr)
+		if !ok || trans.orderBuiltin(call) == "" {
+			return true
+		}
+		if trans.orderBuiltin(call) != "clamp" && trans.targets(1, 21) {
+			// Go has min and max.
+			return true
+		}
+		tv := trans.Info.Types[call]
+		if tv.Value == nil {
+			call.Fun = trans.orderFuncLit(trans.orderBuiltin(call), tv.Type, call.Lparen)
+			return true
+		}
+		for i, arg := range call.Args {
+			if val := trans.Info.Types[arg].Value; val != nil && constant.Compare(val, token.EQL, tv.Value) {
+				results[call] = i
+				break
+			}
+		}
+		return true
+	}
+	post := func(c *astutil.Cursor) bool {
+		call, ok := c.Node().(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		if i, found := results[call]; found {
+			c.Replace(trans.constantResult(call.Args[i], trans.Info.Types[call]))
+		}
+		return true
+	}
+	astutil.Apply(f, pre, post)
+}
+
+// orderBuiltin returns the name of the predeclared min, max or clamp if call
+// calls it, and "" otherwise.
+func (trans *Transformer) orderBuiltin(call *ast.CallExpr) string {
+	id, ok := astutil.Unparen(call.Fun).(*ast.Ident)
+	if !ok {
+		return ""
+	}
+	if builtin, ok := trans.Info.Uses[id].(*types.Builtin); ok {
+		switch builtin.Name() {
+		case "min", "max", "clamp":
+			return builtin.Name()
+		}
+	}
+	return ""
+}
+
+// orderFuncLit returns the function literal which computes the builtin name
+// (min, max or clamp) for operands of type typ.
+func (trans *Transformer) orderFuncLit(name string, typ types.Type, pos token.Pos) *ast.FuncLit {
+	ret := func(name string) ast.Stmt {
+		return &ast.ReturnStmt{Results: []ast.Expr{ast.NewIdent(name)}}
+	}
+	if name == "clamp" {
+		// func(x, lo, hi T) T
+		return &ast.FuncLit{
+			Type: &ast.FuncType{
+				Func: pos,
+				Params: &ast.FieldList{List: []*ast.Field{{
+					Names: []*ast.Ident{ast.NewIdent("x"), ast.NewIdent("lo"), ast.NewIdent("hi")},
+					Type:  trans.typeToExpr(typ),
+				}}},
+				Results: &ast.FieldList{List: []*ast.Field{{Type: trans.typeToExpr(typ)}}},
+			},
+			Body: &ast.BlockStmt{List: []ast.Stmt{
+				&ast.IfStmt{
+					Cond: &ast.BinaryExpr{X: ast.NewIdent("x"), Op: token.LSS, Y: ast.NewIdent("lo")},
+					Body: &ast.BlockStmt{List: []ast.Stmt{ret("lo")}},
+				},
+				&ast.IfStmt{
+					Cond: &ast.BinaryExpr{X: ast.NewIdent("x"), Op: token.GTR, Y: ast.NewIdent("hi")},
+					Body: &ast.BlockStmt{List: []ast.Stmt{ret("hi")}},
+				},
+				ret("x"),
+			}},
+		}
+	}
+	// func(x T, ys ...T) T
+	op := token.LSS
+	if name == "max" {
+		op = token.GTR
+	}
+	return &ast.FuncLit{
+		Type: &ast.FuncType{
+			Func: pos,
+			Params: &ast.FieldList{List: []*ast.Field{
+				{Names: []*ast.Ident{ast.NewIdent("x")}, Type: trans.typeToExpr(typ)},
+				{Names: []*ast.Ident{ast.NewIdent("ys")}, Type: &ast.Ellipsis{Elt: trans.typeToExpr(typ)}},
+			}},
+			Results: &ast.FieldList{List: []*ast.Field{{Type: trans.typeToExpr(typ)}}},
+		},
+		Body: &ast.BlockStmt{List: []ast.Stmt{
+			&ast.RangeStmt{
+				Key:   ast.NewIdent("_"),
+				Value: ast.NewIdent("y"),
+				Tok:   token.DEFINE,
+				X:     ast.NewIdent("ys"),
+				Body: &ast.BlockStmt{List: []ast.Stmt{&ast.IfStmt{
+					Cond: &ast.BinaryExpr{X: ast.NewIdent("y"), Op: op, Y: ast.NewIdent("x")},
+					Body: &ast.BlockStmt{List: []ast.Stmt{&ast.AssignStmt{
+						Lhs: []ast.Expr{ast.NewIdent("x")},
+						Tok: token.ASSIGN,
+						Rhs: []ast.Expr{ast.NewIdent("y")},
+					}}},
+				}}},
+			},
+			ret("x"),
+		}},
+	}
+}
+
+// constantResult returns the expression which replaces a constant call of
+// min, max or clamp of type and value tv, whose result is its argument arg.
+// A typed result is converted to the type of the call unless arg is a
+// constant of that type, since an untyped argument (e.g. the 2 in min(n, 2))
+// would otherwise take the type of its context. An untyped result keeps the
+// kind of the call, e.g. min(1, 2.5) is 1.0.
+func (trans *Transformer) constantResult(arg ast.Expr, tv types.TypeAndValue) ast.Expr {
+	basic, _ := tv.Type.(*types.Basic)
+	switch {
+	case basic == nil || basic.Info()&types.IsUntyped == 0:
+		var obj types.Object
+		switch x := astutil.Unparen(arg).(type) {
+		case *ast.Ident:
+			obj = trans.Info.Uses[x]
+		case *ast.SelectorExpr:
+			obj = trans.Info.Uses[x.Sel]
+		}
+		if c, ok := obj.(*types.Const); !ok || !types.Identical(c.Type(), tv.Type) {
+			return &ast.CallExpr{Fun: trans.typeToExpr(tv.Type), Args: []ast.Expr{arg}}
+		}
+	case basic.Kind() == types.UntypedRune:
+		if r, ok := constant.Int64Val(tv.Value); ok && utf8.ValidRune(rune(r)) {
+			return &ast.BasicLit{ValuePos: arg.Pos(), Kind: token.CHAR, Value: strconv.QuoteRune(rune(r))}
+		}
+	case basic.Kind() == types.UntypedFloat && tv.Value.Kind() == constant.Int:
+		return &ast.BasicLit{ValuePos: arg.Pos(), Kind: token.FLOAT, Value: tv.Value.ExactString() + ".0"}
+	}
+	switch arg.(type) {
+	case *ast.BinaryExpr, *ast.UnaryExpr:
+		return &ast.ParenExpr{X: arg}
+	}
+	return arg
+}
+
+// removeImplAssertions removes the calls of the predeclared assertImplements
+// from f, which the Checker verified, so that no code is generated for them.
+// They can only occur as statements.
+func (trans *Transformer) removeImplAssertions(f *ast.File) {
+	astutil.Apply(f, func(c *astutil.Cursor) bool {
+		switch stmt := c.Node().(type) {
+		case *ast.ForStmt:
+			if trans.implAssertionStmt(stmt.Init) {
+				stmt.Init = nil
+			}
+			if trans.implAssertionStmt(stmt.Post) {
+				stmt.Post = nil
+			}
+		case *ast.IfStmt:
+			if trans.implAssertionStmt(stmt.Init) {
+				stmt.Init = nil
+			}
+		case *ast.SwitchStmt:
+			if trans.implAssertionStmt(stmt.Init) {
+				stmt.Init = nil
+			}
+		case *ast.TypeSwitchStmt:
+			if trans.implAssertionStmt(stmt.Init) {
+				stmt.Init = nil
+			}
+		case ast.Stmt:
+			if !trans.implAssertionStmt(stmt) {
+				break
+			}
+			trans.addRemoved(stmt)
+			if c.Index() >= 0 {
+				c.Delete()
+			} else {
+				// the statement of a labeled statement
+				c.Replace(&ast.EmptyStmt{Semicolon: stmt.Pos(), Implicit: true})
+			}
+			return false
+		}
+		return true
+	}, nil)
+}
+
+// implAssertionStmt reports whether stmt is a call of the predeclared
+// assertImplements (possibly deferred or in a go statement).
+func (trans *Transformer) implAssertionStmt(stmt ast.Stmt) bool {
+	var call *ast.CallExpr
+	switch stmt := stmt.(type) {
+	case *ast.ExprStmt:
+		call, _ = stmt.X.(*ast.CallExpr)
+	case *ast.DeferStmt:
+		call = stmt.Call
+	case *ast.GoStmt:
+		call = stmt.Call
+	}
+	return call != nil && trans.implAssertion(call)
+}
+
+// implAssertion reports whether call calls the predeclared assertImplements.
+func (trans *Transformer) implAssertion(call *ast.CallExpr) bool {
+	var fun ast.Expr
+	switch x := astutil.Unparen(call.Fun).(type) {
+	case *ast.TypeArgExpr:
+		fun = x.X
+	case *ast.IndexExpr:
+		fun = x.X
+	default:
+		return false
+	}
+	id, ok := astutil.Unparen(fun).(*ast.Ident)
+	if !ok {
+		return false
+	}
+	builtin, ok := trans.Info.Uses[id].(*types.Builtin)
+	return ok && builtin.Name() == "assertImplements"
+}
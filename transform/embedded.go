@@ -0,0 +1,92 @@
+package transform
+
+import (
+	"github.com/qProust/fo/ast"
+	"github.com/qProust/fo/token"
+	"github.com/qProust/fo/types"
+)
+
+// An embedded field of a generic type, such as Box[int] in
+//
+//	type Outer struct {
+//		Box[int]
+//	}
+//
+// is named after the generic type in Fo (o.Box) but after the concrete type in
+// the generated code (o.Box__int), which embeds Box__int instead. Selectors and
+// composite literal keys which refer to such a field are renamed accordingly.
+// Promoted fields and methods (o.Get()) need no changes, since Go promotes them
+// from Box__int as well.
+
+// findEmbeddedFields records the identifiers of f which refer to embedded
+// fields of generic types, along with the types of the fields. The identifiers
+// whose type is concrete are renamed right away. Those in generic declarations
+// whose type depends on type parameters (e.g. w.Box in a method of Wrapper[U]
+// which embeds Box[U]) are renamed for each instance by renameEmbeddedFields.
+func (trans *Transformer) findEmbeddedFields(f *ast.File) {
+	ast.Inspect(f, func(n ast.Node) bool {
+		id, ok := n.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		field, ok := trans.Info.Uses[id].(*types.Var)
+		if !ok || !field.IsField() || !field.Anonymous() {
+			return true
+		}
+		typ := field.Type()
+		if ptr, ok := typ.(*types.Pointer); ok {
+			typ = ptr.Elem()
+		}
+		switch typ := typ.(type) {
+		case *types.ConcreteNamed:
+			trans.renameEmbeddedField(id, typ, nil)
+		case *types.PartialGenericNamed:
+			trans.namesMu.Lock()
+			if trans.embeddedFields == nil {
+				trans.embeddedFields = map[token.Pos]types.ConcreteType{}
+			}
+			trans.embeddedFields[id.Pos()] = typ
+			trans.namesMu.Unlock()
+		}
+		return true
+	})
+}
+
+// renameEmbeddedFields renames the identifiers in n, a copy of (part of) a
+// generic declaration made for the usage with the type map typeMap, which
+// refer to embedded fields whose type depends on type parameters (see
+// findEmbeddedFields).
+func (trans *Transformer) renameEmbeddedFields(n ast.Node, typeMap map[string]types.Type) {
+	ast.Inspect(n, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok {
+			trans.namesMu.Lock()
+			typ, found := trans.embeddedFields[id.Pos()]
+			trans.namesMu.Unlock()
+			if found {
+				trans.renameEmbeddedField(id, typ, typeMap)
+			}
+		}
+		return true
+	})
+}
+
+// renameEmbeddedField renames id, which refers to an embedded field of the
+// type typ, after the concrete type which is embedded in the generated code.
+// The type parameters in the type arguments of typ are replaced using
+// typeMap.
+func (trans *Transformer) renameEmbeddedField(id *ast.Ident, typ types.ConcreteType, typeMap map[string]types.Type) {
+	expr := trans.concreteNamedTypeToExpr(typ).(*ast.TypeArgExpr)
+	if trans.nativeGeneric(expr.X) {
+		// Go names the field after the generic type as well.
+		return
+	}
+	if typeMap != nil {
+		expr = trans.replaceIdentsInScope(expr, typeMap).(*ast.TypeArgExpr)
+	}
+	switch name := trans.concreteTypeExpr(expr).(type) {
+	case *ast.Ident:
+		id.Name = name.Name
+	case *ast.SelectorExpr:
+		id.Name = name.Sel.Name
+	}
+}
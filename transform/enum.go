@@ -0,0 +1,226 @@
+package transform
+
+import (
+	"strconv"
+
+	"github.com/qProust/fo/ast"
+	"github.com/qProust/fo/astutil"
+	"github.com/qProust/fo/token"
+)
+
+// expandEnums replaces each enum type declared in f with a defined int type.
+// The constants for its values and its String and MarshalText methods are
+// added after the declaration of the type, e.g.
+//
+//	type Color enum { Red, Green }
+//
+// becomes
+//
+//	type Color int
+//
+//	const (
+//		Red Color = iota
+//		Green
+//	)
+//
+//	func (x Color) String() string { ... }
+//
+//	func (x Color) MarshalText() ([]byte, error) { ... }
+//
+// Package strconv is imported if f does not import it already.
+func (trans *Transformer) expandEnums(f *ast.File) {
+	var enums []*ast.TypeSpec
+	for _, decl := range f.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			if typeSpec, ok := spec.(*ast.TypeSpec); ok {
+				if _, ok := typeSpec.Type.(*ast.EnumType); ok {
+					enums = append(enums, typeSpec)
+				}
+			}
+		}
+	}
+	if len(enums) == 0 {
+		return
+	}
+
+	itoa := trans.importStrconv(f)
+	var decls []ast.Decl
+	for _, decl := range f.Decls {
+		decls = append(decls, decl)
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			typeSpec, ok := spec.(*ast.TypeSpec)
+			if !ok {
+				continue
+			}
+			enum, ok := typeSpec.Type.(*ast.EnumType)
+			if !ok {
+				continue
+			}
+			typeSpec.Type = &ast.Ident{NamePos: enum.Enum, Name: "int"}
+			decls = append(decls, enumDecls(typeSpec.Name.Name, enum, itoa)...)
+		}
+	}
+	f.Decls = decls
+}
+
+// importStrconv makes sure that f imports package strconv and returns the
+// expression which denotes strconv.Itoa in f.
+func (trans *Transformer) importStrconv(f *ast.File) ast.Expr {
+	name := "strconv"
+	for trans.Pkg.Scope().Lookup(name) != nil {
+		name += "_"
+	}
+	var spec *ast.ImportSpec
+	for _, imp := range f.Imports {
+		if path, err := strconv.Unquote(imp.Path.Value); err == nil && path == "strconv" {
+			spec = imp
+			if imp.Name == nil || imp.Name.Name != "_" {
+				break
+			}
+		}
+	}
+	switch {
+	case spec == nil:
+		if name == "strconv" {
+			astutil.AddImport(trans.Fset, f, "strconv")
+		} else {
+			astutil.AddNamedImport(trans.Fset, f, name, "strconv")
+		}
+	case spec.Name == nil:
+		name = "strconv"
+	case spec.Name.Name == ".":
+		return ast.NewIdent("Itoa")
+	case spec.Name.Name == "_":
+		// The blank import is used now.
+		if name == "strconv" {
+			spec.Name = nil
+		} else {
+			spec.Name = &ast.Ident{NamePos: spec.Name.NamePos, Name: name}
+		}
+	default:
+		name = spec.Name.Name
+	}
+	return &ast.SelectorExpr{X: ast.NewIdent(name), Sel: ast.NewIdent("Itoa")}
+}
+
+// enumDecls returns the declarations of the values and methods of the enum type
+// typeName. itoa denotes strconv.Itoa. The declarations have the position of
+// the enum type, so that they are related to it in source maps.
+func enumDecls(typeName string, enum *ast.EnumType, itoa ast.Expr) []ast.Decl {
+	pos := enum.Enum
+
+	// The receiver must not shadow any of the names used in the methods.
+	recv := "x"
+	for {
+		conflict := recv == typeName
+		if sel, ok := itoa.(*ast.SelectorExpr); ok {
+			conflict = conflict || recv == sel.X.(*ast.Ident).Name
+		}
+		for _, value := range enum.Values {
+			conflict = conflict || recv == value.Name
+		}
+		if !conflict {
+			break
+		}
+		recv += "_"
+	}
+	recvList := func() *ast.FieldList {
+		return &ast.FieldList{List: []*ast.Field{{
+			Names: []*ast.Ident{ast.NewIdent(recv)},
+			Type:  ast.NewIdent(typeName),
+		}}}
+	}
+
+	var decls []ast.Decl
+	if len(enum.Values) > 0 {
+		values := &ast.GenDecl{
+			TokPos: pos,
+			Tok:    token.CONST,
+			Lparen: pos,
+			Rparen: enum.Rbrace,
+		}
+		for i, value := range enum.Values {
+			spec := &ast.ValueSpec{Names: []*ast.Ident{ast.NewIdent(value.Name)}}
+			if i == 0 {
+				spec.Type = ast.NewIdent(typeName)
+				spec.Values = []ast.Expr{ast.NewIdent("iota")}
+			}
+			values.Specs = append(values.Specs, spec)
+		}
+		decls = append(decls, values)
+	}
+
+	// func (x T) String() string
+	cases := &ast.BlockStmt{}
+	for _, value := range enum.Values {
+		cases.List = append(cases.List, &ast.CaseClause{
+			List: []ast.Expr{ast.NewIdent(value.Name)},
+			Body: []ast.Stmt{&ast.ReturnStmt{
+				Results: []ast.Expr{&ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(value.Name)}},
+			}},
+		})
+	}
+	// return "T(" + strconv.Itoa(int(x)) + ")"
+	unknown := &ast.BinaryExpr{
+		X: &ast.BinaryExpr{
+			X:  &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(typeName + "(")},
+			Op: token.ADD,
+			Y: &ast.CallExpr{
+				Fun: itoa,
+				Args: []ast.Expr{&ast.CallExpr{
+					Fun:  ast.NewIdent("int"),
+					Args: []ast.Expr{ast.NewIdent(recv)},
+				}},
+			},
+		},
+		Op: token.ADD,
+		Y:  &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(")")},
+	}
+	decls = append(decls, &ast.FuncDecl{
+		Recv: recvList(),
+		Name: ast.NewIdent("String"),
+		Type: &ast.FuncType{
+			Func:    pos,
+			Params:  &ast.FieldList{},
+			Results: &ast.FieldList{List: []*ast.Field{{Type: ast.NewIdent("string")}}},
+		},
+		Body: &ast.BlockStmt{List: []ast.Stmt{
+			&ast.SwitchStmt{Tag: ast.NewIdent(recv), Body: cases},
+			&ast.ReturnStmt{Results: []ast.Expr{unknown}},
+		}},
+	})
+
+	// func (x T) MarshalText() ([]byte, error)
+	decls = append(decls, &ast.FuncDecl{
+		Recv: recvList(),
+		Name: ast.NewIdent("MarshalText"),
+		Type: &ast.FuncType{
+			Func:   pos,
+			Params: &ast.FieldList{},
+			Results: &ast.FieldList{List: []*ast.Field{
+				{Type: &ast.ArrayType{Elt: ast.NewIdent("byte")}},
+				{Type: ast.NewIdent("error")},
+			}},
+		},
+		Body: &ast.BlockStmt{List: []ast.Stmt{
+			&ast.ReturnStmt{Results: []ast.Expr{
+				&ast.CallExpr{
+					Fun: &ast.ArrayType{Elt: ast.NewIdent("byte")},
+					Args: []ast.Expr{&ast.CallExpr{
+						Fun: &ast.SelectorExpr{X: ast.NewIdent(recv), Sel: ast.NewIdent("String")},
+					}},
+				},
+				ast.NewIdent("nil"),
+			}},
+		}},
+	})
+	return decls
+}
@@ -0,0 +1,25 @@
+package transform_test
+
+import (
+	"flag"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/qProust/fo/transform/transformtest"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// TestTransformGolden transforms each .fo file in testdata and compares the
+// output with the .golden file next to it. Use go test -update to update the
+// golden files.
+func TestTransformGolden(t *testing.T) {
+	sources, err := filepath.Glob(filepath.Join("testdata", "*.fo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, source := range sources {
+		transformtest.Golden(t, source, strings.TrimSuffix(source, ".fo")+".golden", *update)
+	}
+}
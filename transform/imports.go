@@ -0,0 +1,307 @@
+package transform
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/qProust/fo/ast"
+	"github.com/qProust/fo/astclone"
+	"github.com/qProust/fo/astutil"
+	"github.com/qProust/fo/scanner"
+	"github.com/qProust/fo/types"
+)
+
+// qualifierIdent returns the name of pkg as the qualifier of a qualified
+// identifier generated from a type. The identifier is marked as such by an
+// ast.Object of kind ast.Pkg holding pkg (which the copies made by astclone
+// share), so that resolveQualifiers can find it once the file is transformed.
+func qualifierIdent(pkg *types.Package) *ast.Ident {
+	return &ast.Ident{Name: pkg.Name(), Obj: &ast.Object{Kind: ast.Pkg, Name: pkg.Name(), Data: pkg}}
+}
+
+// resolveQualifiers replaces the qualifiers of the qualified identifiers
+// generated from types in f (see qualifierIdent) with the names under which f
+// imports their packages. The generated code may refer to packages which f
+// does not import, e.g. to other.Thing in the instance lib.Box__other_Thing of
+// a generic type declared in package lib, so the missing imports are added.
+func (trans *Transformer) resolveQualifiers(f *ast.File) {
+	names := map[*types.Package]string{}
+	astutil.Apply(f, func(c *astutil.Cursor) bool {
+		sel, ok := c.Node().(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		x, ok := sel.X.(*ast.Ident)
+		if !ok || x.Obj == nil || x.Obj.Kind != ast.Pkg {
+			return true
+		}
+		pkg, ok := x.Obj.Data.(*types.Package)
+		if !ok {
+			return true
+		}
+		name, found := names[pkg]
+		if !found {
+			name = trans.importPackage(f, pkg.Path(), pkg.Name())
+			names[pkg] = name
+		}
+		if name == "." {
+			c.Replace(sel.Sel)
+			return false
+		}
+		sel.X = &ast.Ident{NamePos: x.NamePos, Name: name}
+		return false
+	}, nil)
+}
+
+// importPackage makes sure that f imports the package with the given path and
+// name and returns the name under which f imports it, which is "." for a dot
+// import. A blank import of the package is turned into a regular one. If f
+// does not import the package, an import is added, which is renamed if its
+// name is already declared in the package being transformed or imported by f.
+func (trans *Transformer) importPackage(f *ast.File, path, pkgName string) string {
+	name := pkgName
+	for trans.importNameTaken(f, path, name) {
+		name += "_"
+	}
+	var spec *ast.ImportSpec
+	for _, imp := range f.Imports {
+		if impPath, err := strconv.Unquote(imp.Path.Value); err == nil && impPath == path {
+			spec = imp
+			if imp.Name == nil || imp.Name.Name != "_" {
+				break
+			}
+		}
+	}
+	switch {
+	case spec == nil:
+		// The name is given unless it is the last element of the path, so
+		// that blankUnusedImports finds the import.
+		if name == path[strings.LastIndex(path, "/")+1:] {
+			astutil.AddImport(trans.Fset, f, path)
+		} else {
+			astutil.AddNamedImport(trans.Fset, f, name, path)
+		}
+	case spec.Name == nil:
+		name = pkgName
+	case spec.Name.Name == "_":
+		// The blank import is used now.
+		if name == pkgName && name == path[strings.LastIndex(path, "/")+1:] {
+			spec.Name = nil
+		} else {
+			spec.Name = &ast.Ident{NamePos: spec.Name.NamePos, Name: name}
+		}
+	default:
+		name = spec.Name.Name
+	}
+	return name
+}
+
+// importNameTaken reports whether name is declared in the package being
+// transformed or is the name of an import of f of a package other than the
+// one with the given path.
+func (trans *Transformer) importNameTaken(f *ast.File, path, name string) bool {
+	if trans.Pkg.Scope().Lookup(name) != nil {
+		return true
+	}
+	for _, imp := range f.Imports {
+		impPath, err := strconv.Unquote(imp.Path.Value)
+		if err != nil || impPath == path {
+			continue
+		}
+		impName := impPath[strings.LastIndex(impPath, "/")+1:]
+		for _, pkg := range trans.Pkg.Imports() {
+			if pkg.Path() == impPath {
+				impName = pkg.Name()
+			}
+		}
+		if imp.Name != nil {
+			impName = imp.Name.Name
+		}
+		if impName == name {
+			return true
+		}
+	}
+	return false
+}
+
+// packageQualified returns the type argument expression arg with its qualified
+// identifiers qualified by the names of their packages, as in the expressions
+// generated from types (see objToExpr), rather than by the names under which
+// the file imports them. For example, o.Thing becomes other.Thing if package
+// other is imported as o, and Thing becomes other.Thing if it is dot-imported,
+// so that the instance is named lib.Box__other_Thing either way. arg itself is
+// returned if it needs no changes.
+func (trans *Transformer) packageQualified(arg ast.Expr) ast.Expr {
+	// The identifiers to replace are found in arg, where their objects are
+	// recorded, and replaced in a copy of arg, which has the same identifiers
+	// in the same order.
+	type qualifier struct {
+		pkg *types.Package
+		dot bool // whether the identifier is a dot-imported name
+	}
+	var qualifiers []qualifier
+	changed := false
+	sels := map[*ast.Ident]bool{}
+	ast.Inspect(arg, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			sels[n.Sel] = true
+		case *ast.Ident:
+			var q qualifier
+			switch obj := trans.Info.Uses[n].(type) {
+			case *types.PkgName:
+				if obj.Name() != obj.Imported().Name() {
+					q.pkg = obj.Imported()
+				}
+			case *types.TypeName:
+				if !sels[n] && obj.Pkg() != nil && obj.Pkg() != trans.Pkg {
+					q = qualifier{pkg: obj.Pkg(), dot: true}
+				}
+			}
+			qualifiers = append(qualifiers, q)
+			changed = changed || q.pkg != nil
+		}
+		return true
+	})
+	if !changed {
+		return arg
+	}
+	i := 0
+	return astutil.Apply(astclone.Clone(arg), nil, func(c *astutil.Cursor) bool {
+		ident, ok := c.Node().(*ast.Ident)
+		if !ok {
+			return true
+		}
+		q := qualifiers[i]
+		i++
+		switch {
+		case q.pkg == nil:
+		case q.dot:
+			c.Replace(&ast.SelectorExpr{X: ast.NewIdent(q.pkg.Name()), Sel: ident})
+		default:
+			c.Replace(ast.NewIdent(q.pkg.Name()))
+		}
+		return true
+	}).(ast.Expr)
+}
+
+// checkImportCycles verifies that the generated code of the package being
+// transformed needs no import which would close an import cycle. This is the
+// case if an instance of one of its generic declarations has a type argument
+// declared in a package which imports it, directly or indirectly, e.g. for
+// lib.Box[main.Mine], since the instance lib.Box__main_Mine is generated in
+// package lib. The errors are reported at the usages which first required the
+// instances, and the result is a scanner.ErrorList, or nil if there are none.
+func (trans *Transformer) checkImportCycles() error {
+	var errs scanner.ErrorList
+	generics := trans.Pkg.Generics()
+	keys := make([]string, 0, len(generics))
+	for key := range generics {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	importers := map[*types.Package]bool{}
+	for _, key := range keys {
+		decl := generics[key]
+		if decl.Native {
+			continue
+		}
+		for _, usg := range decl.Instances() {
+			pkgs := map[*types.Package]bool{}
+			for _, arg := range usg.TypeArgs {
+				typePackages(arg, pkgs, map[types.Type]bool{})
+			}
+			var cyclic []string
+			for pkg := range pkgs {
+				if pkg != trans.Pkg && imports(pkg, trans.Pkg, importers, map[*types.Package]bool{}) {
+					cyclic = append(cyclic, pkg.Path())
+				}
+			}
+			if len(cyclic) == 0 {
+				continue
+			}
+			sort.Strings(cyclic)
+			pos := usg.Pos
+			if !pos.IsValid() {
+				pos = decl.Obj().Pos()
+			}
+			errs.Add(trans.Fset.Position(pos), "instance of "+key+" cannot be generated in package "+trans.Pkg.Path()+": its type arguments are declared in "+strings.Join(cyclic, ", ")+", which imports "+trans.Pkg.Path()+" (import cycle)")
+		}
+	}
+	errs.Sort()
+	return errs.Err()
+}
+
+// imports reports whether pkg imports target, directly or indirectly. The
+// results are memoized in known; seen holds the packages being visited.
+func imports(pkg, target *types.Package, known, seen map[*types.Package]bool) bool {
+	if result, found := known[pkg]; found {
+		return result
+	}
+	if seen[pkg] {
+		return false
+	}
+	seen[pkg] = true
+	result := false
+	for _, imp := range pkg.Imports() {
+		if imp == target || imports(imp, target, known, seen) {
+			result = true
+			break
+		}
+	}
+	known[pkg] = result
+	return result
+}
+
+// typePackages adds the packages of the named types in typ to pkgs. seen holds
+// the types which have been visited, since named types may be recursive.
+func typePackages(typ types.Type, pkgs map[*types.Package]bool, seen map[types.Type]bool) {
+	if typ == nil || seen[typ] {
+		return
+	}
+	seen[typ] = true
+	switch t := typ.(type) {
+	case *types.Named:
+		if t.Obj() != nil && t.Obj().Pkg() != nil {
+			pkgs[t.Obj().Pkg()] = true
+		}
+	case *types.ConcreteSignature:
+		typePackages(t.Signature, pkgs, seen)
+	case types.ConcreteType:
+		if obj := t.GenericType().Object(); obj.Pkg() != nil {
+			pkgs[obj.Pkg()] = true
+		}
+		for _, arg := range t.TypeMap() {
+			typePackages(arg, pkgs, seen)
+		}
+	case *types.Pointer:
+		typePackages(t.Elem(), pkgs, seen)
+	case *types.Slice:
+		typePackages(t.Elem(), pkgs, seen)
+	case *types.Array:
+		typePackages(t.Elem(), pkgs, seen)
+	case *types.Map:
+		typePackages(t.Key(), pkgs, seen)
+		typePackages(t.Elem(), pkgs, seen)
+	case *types.Chan:
+		typePackages(t.Elem(), pkgs, seen)
+	case *types.Signature:
+		for _, tuple := range []*types.Tuple{t.Params(), t.Results()} {
+			for i := 0; i < tuple.Len(); i++ {
+				typePackages(tuple.At(i).Type(), pkgs, seen)
+			}
+		}
+	case *types.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			typePackages(t.Field(i).Type(), pkgs, seen)
+		}
+	case *types.Interface:
+		for i := 0; i < t.NumMethods(); i++ {
+			typePackages(t.Method(i).Type(), pkgs, seen)
+		}
+		for i := 0; i < t.NumEmbeddeds(); i++ {
+			typePackages(t.EmbeddedType(i), pkgs, seen)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package transform
+
+import (
+	"github.com/qProust/fo/ast"
+	"github.com/qProust/fo/token"
+	"github.com/qProust/fo/types"
+)
+
+// insertInferredTypeArgs makes the type arguments which the Checker inferred
+// for the calls of generic functions and methods and for the composite
+// literals of generic types in f explicit (see types.Info.InferredTypeArgs),
+// e.g. NewList(xs).Map(f) becomes NewList[int](xs).Map[string](f), and Box{v: 3}
+// in var b Box[int] = Box{v: 3} becomes Box[int]{v: 3}. They are then replaced
+// by the concrete functions and types like any other instantiation, including
+// in the copies of generic declarations, where the inferred type arguments may
+// be type parameters. Calls of native generic functions are left to the Go
+// compiler, which infers their type arguments itself.
+func (trans *Transformer) insertInferredTypeArgs(f *ast.File) {
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.CallExpr:
+			targs, found := trans.Info.InferredTypeArgs[n]
+			if !found {
+				return true
+			}
+			fun := n.Fun
+			for {
+				paren, ok := fun.(*ast.ParenExpr)
+				if !ok {
+					break
+				}
+				fun = paren.X
+			}
+			if trans.nativeGeneric(fun) {
+				return true
+			}
+			n.Fun = trans.inferredTypeArgExpr(fun, n.Lparen, targs)
+		case *ast.CompositeLit:
+			if targs, found := trans.Info.InferredTypeArgs[n]; found {
+				n.Type = trans.inferredTypeArgExpr(n.Type, n.Lbrace, targs)
+			}
+		}
+		return true
+	})
+}
+
+// inferredTypeArgExpr returns the type argument expression x[targs...], placed
+// at pos.
+func (trans *Transformer) inferredTypeArgExpr(x ast.Expr, pos token.Pos, targs []types.Type) *ast.TypeArgExpr {
+	typeArgExpr := &ast.TypeArgExpr{X: x, Lbrack: pos, Rbrack: pos}
+	for _, targ := range targs {
+		typeArgExpr.Types = append(typeArgExpr.Types, trans.typeToExpr(targ))
+	}
+	return typeArgExpr
+}
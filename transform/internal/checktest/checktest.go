@@ -0,0 +1,46 @@
+// Package checktest parses and type-checks Fo source files for the tests of
+// package transform and of package transformtest, which cannot share the
+// helpers of transformtest since it imports transform.
+package checktest
+
+import (
+	"fmt"
+
+	"github.com/qProust/fo/ast"
+	"github.com/qProust/fo/parser"
+	"github.com/qProust/fo/token"
+	"github.com/qProust/fo/types"
+)
+
+// A File is a Fo source file.
+type File struct {
+	Name string
+	Src  string
+}
+
+// Check parses files with the given mode and type-checks them with conf as the
+// package path. The returned types.Info records everything the transformer
+// needs.
+func Check(conf *types.Config, fset *token.FileSet, path string, mode parser.Mode, files ...File) ([]*ast.File, *types.Package, *types.Info, error) {
+	var parsed []*ast.File
+	for _, file := range files {
+		f, err := parser.ParseFile(fset, file.Name, file.Src, mode)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("ParseFile returned error: %s", err.Error())
+		}
+		parsed = append(parsed, f)
+	}
+	info := &types.Info{
+		Types:            map[ast.Expr]types.TypeAndValue{},
+		Selections:       map[*ast.SelectorExpr]*types.Selection{},
+		TypeArgs:         map[*ast.IndexExpr]*ast.TypeArgExpr{},
+		InferredTypeArgs: map[ast.Expr][]types.Type{},
+		Defs:             map[*ast.Ident]types.Object{},
+		Uses:             map[*ast.Ident]types.Object{},
+	}
+	pkg, err := conf.Check(path, fset, parsed, info)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("conf.Check returned error: %s", err.Error())
+	}
+	return parsed, pkg, info, nil
+}
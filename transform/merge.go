@@ -0,0 +1,120 @@
+package transform
+
+import (
+	"errors"
+	"fmt"
+	"go/build/constraint"
+	"path"
+	"sort"
+	"strconv"
+
+	"github.com/qProust/fo/ast"
+	"github.com/qProust/fo/token"
+)
+
+// Merge combines files, the files of the package of trans as returned by
+// File, into a single file, so that all of the Go code generated for the
+// package can be written to one file. The declarations of the files are kept
+// in order. Their imports are combined into a single import declaration
+// without duplicates, in which a blank import of a package is dropped if the
+// package is imported by name as well. The result shares the nodes of files,
+// whose positions are out of order in it, so it should be printed after
+// calling Renumber.
+//
+// Since imports and build constraints only apply to the file they appear in,
+// Merge returns an error if files import two packages by the same name, if
+// they have a dot import or an import of "C", or if they have build
+// constraints.
+func (trans *Transformer) Merge(files []*ast.File) (*ast.File, error) {
+	if len(files) == 0 {
+		return nil, errors.New("no files to merge")
+	}
+	names := map[string]string{}
+	for _, imp := range trans.Pkg.Imports() {
+		names[imp.Path()] = imp.Name()
+	}
+
+	merged := &ast.File{Package: files[0].Package, Name: files[0].Name}
+	imports := &ast.GenDecl{Tok: token.IMPORT}
+	byName := map[string]*ast.ImportSpec{} // imports by the name they declare
+	var blank []*ast.ImportSpec
+	for _, f := range files {
+		for _, cg := range f.Comments {
+			if cg.End() >= f.Package {
+				break
+			}
+			for _, c := range cg.List {
+				if constraint.IsGoBuild(c.Text) || constraint.IsPlusBuild(c.Text) {
+					return nil, fmt.Errorf("%s: cannot merge a file with build constraints", trans.Fset.Position(c.Pos()))
+				}
+			}
+		}
+		for _, decl := range f.Decls {
+			if decl, ok := decl.(*ast.GenDecl); ok && decl.Tok == token.IMPORT {
+				if !imports.TokPos.IsValid() {
+					imports.TokPos = decl.TokPos
+				}
+				continue
+			}
+			merged.Decls = append(merged.Decls, decl)
+		}
+		for _, spec := range f.Imports {
+			importPath, _ := strconv.Unquote(spec.Path.Value)
+			name := names[importPath]
+			if name == "" {
+				name = path.Base(importPath)
+			}
+			if spec.Name != nil {
+				name = spec.Name.Name
+			}
+			switch {
+			case importPath == "C":
+				return nil, fmt.Errorf(`%s: cannot merge a file which imports "C"`, trans.Fset.Position(spec.Pos()))
+			case name == ".":
+				return nil, fmt.Errorf("%s: cannot merge a file with a dot import", trans.Fset.Position(spec.Pos()))
+			case name == "_":
+				blank = append(blank, spec)
+				continue
+			}
+			if other, found := byName[name]; found {
+				if other.Path.Value != spec.Path.Value {
+					return nil, fmt.Errorf("%s: cannot merge the import of %s as %s with the one of %s at %s", trans.Fset.Position(spec.Pos()), spec.Path.Value, name, other.Path.Value, trans.Fset.Position(other.Pos()))
+				}
+				continue
+			}
+			byName[name] = spec
+			imports.Specs = append(imports.Specs, spec)
+		}
+		merged.Comments = append(merged.Comments, f.Comments...)
+	}
+	for _, spec := range blank {
+		imported := false
+		for _, other := range imports.Specs {
+			imported = imported || other.(*ast.ImportSpec).Path.Value == spec.Path.Value
+		}
+		if !imported {
+			imports.Specs = append(imports.Specs, spec)
+		}
+	}
+	if len(imports.Specs) == 0 {
+		return merged, nil
+	}
+	sort.SliceStable(imports.Specs, func(i, j int) bool {
+		return importPathOf(imports.Specs[i]) < importPathOf(imports.Specs[j])
+	})
+	for _, spec := range imports.Specs {
+		merged.Imports = append(merged.Imports, spec.(*ast.ImportSpec))
+	}
+	if len(imports.Specs) > 1 {
+		// The printer needs the positions of the parentheses to place the
+		// comments which follow the declaration.
+		imports.Lparen, imports.Rparen = imports.TokPos, imports.TokPos
+	}
+	merged.Decls = append([]ast.Decl{imports}, merged.Decls...)
+	return merged, nil
+}
+
+func importPathOf(spec ast.Spec) string {
+	importPath, _ := strconv.Unquote(spec.(*ast.ImportSpec).Path.Value)
+	return importPath
+}
@@ -0,0 +1,143 @@
+package transform
+
+import (
+	"github.com/qProust/fo/ast"
+	"github.com/qProust/fo/scanner"
+	"github.com/qProust/fo/types"
+)
+
+// Migrate rewrites the Fo file f into standard Go code which uses the type
+// parameters of Go 1.18 and later instead of generating concrete declarations,
+// and returns the resulting source code. src must be the source f was parsed
+// from, with parser.ParseComments. As for FilePreserving, the declarations
+// which do not change are copied from src, so the formatting and comments of
+// the file are kept. f is modified in place.
+//
+// Type parameters without a constraint get the constraint any, or comparable
+// if the type checker found that their type arguments must be comparable
+// (e.g. because they are used as the key type of a map), so
+//
+//	type Set[T] map[T]bool
+//
+// becomes
+//
+//	type Set[T comparable] map[T]bool
+//
+// Enum types are expanded as by File. Instantiations need no change since
+// their syntax is the same in Go.
+//
+// Some Fo constructs have no equivalent in Go: methods which declare their own
+// type parameters (in interfaces and on concrete types) and type parameters
+// which are used as the length of an array type. If f contains any of them,
+// Migrate returns a scanner.ErrorList which reports each of them.
+func (trans *Transformer) Migrate(f *ast.File, src []byte) ([]byte, error) {
+	_, out, err := trans.preserving(f, src, func(f *ast.File) (*ast.File, error) {
+		return f, trans.migrate(f)
+	})
+	return out, err
+}
+
+// migrate rewrites f in place for Migrate.
+func (trans *Transformer) migrate(f *ast.File) error {
+	var errs scanner.ErrorList
+	report := func(n ast.Node, msg string) {
+		errs.Add(trans.Fset.Position(n.Pos()), msg)
+	}
+
+	trans.expandEnums(f)
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.TypeSpec:
+			trans.disambiguateTypeParam(n)
+			if n.TypeParams != nil {
+				trans.migrateTypeParams(n.Name, n.TypeParams, report)
+			}
+		case *ast.FuncDecl:
+			if n.TypeParams == nil {
+				break
+			}
+			if n.Recv != nil {
+				report(n.TypeParams, "generic methods are not supported by Go; method "+n.Name.Name+" must be turned into a function")
+				break
+			}
+			trans.migrateTypeParams(n.Name, n.TypeParams, report)
+		case *ast.InterfaceType:
+			for _, method := range n.Methods.List {
+				if ftyp, ok := method.Type.(*ast.FuncType); ok && ftyp.TypeParams != nil {
+					report(ftyp.TypeParams, "generic methods are not supported by Go; interface method "+method.Names[0].Name+" must be removed")
+				}
+			}
+		}
+		return true
+	})
+
+	errs.Sort()
+	return errs.Err()
+}
+
+// disambiguateTypeParam turns the array type of typeSpec into a type
+// parameter if the type checker found that the brackets enclose the only type
+// parameter of a generic type rather than an array length, as in
+// type Set[T] map[T]bool, which the parser can't tell apart from an array type.
+func (trans *Transformer) disambiguateTypeParam(typeSpec *ast.TypeSpec) {
+	arrayType, ok := typeSpec.Type.(*ast.ArrayType)
+	if !ok || typeSpec.TypeParams != nil {
+		return
+	}
+	length, ok := arrayType.Len.(*ast.Ident)
+	if !ok {
+		return
+	}
+	obj := trans.Pkg.Scope().Lookup(typeSpec.Name.Name)
+	if obj == nil || obj.Pos() != typeSpec.Name.Pos() {
+		return
+	}
+	if _, ok := obj.Type().(*types.GenericNamed); !ok {
+		return
+	}
+	typeSpec.TypeParams = ast.NewTypeParamDecl(length)
+	typeSpec.TypeParams.Lbrack = arrayType.Lbrack
+	typeSpec.Type = arrayType.Elt
+}
+
+// migrateTypeParams adds the constraints required by Go to the type
+// parameters of the package-level generic declaration name. A constraint is
+// only written after the last of several consecutive type parameters which
+// share it, as in [K, V any], since in Go a constraint applies to all the
+// names before it.
+func (trans *Transformer) migrateTypeParams(name *ast.Ident, decl *ast.TypeParamDecl, report func(ast.Node, string)) {
+	obj := trans.Pkg.Scope().Lookup(name.Name)
+	if obj == nil || obj.Pos() != name.Pos() {
+		// Generic declarations are only allowed at package level.
+		return
+	}
+	genType, ok := obj.Type().(types.GenericType)
+	if !ok {
+		return
+	}
+	typeParams := genType.TypeParams()
+
+	constraints := make([]ast.Expr, len(decl.Names))
+	for i, tpName := range decl.Names {
+		if i < len(decl.Constraints) && decl.Constraints[i] != nil {
+			constraints[i] = decl.Constraints[i]
+			continue
+		}
+		constraint := "any"
+		if i < len(typeParams) {
+			if typeParams[i].IsConst() {
+				report(tpName, "type parameter "+tpName.Name+" of "+name.Name+" is used as an array length, which is not supported by Go")
+			}
+			if typeParams[i].Constraint() != nil {
+				constraint = "comparable"
+			}
+		}
+		constraints[i] = &ast.Ident{NamePos: tpName.End(), Name: constraint}
+	}
+	for i := range constraints[:len(constraints)-1] {
+		if types.ExprString(constraints[i]) == types.ExprString(constraints[i+1]) {
+			constraints[i] = nil
+		}
+	}
+	decl.Constraints = constraints
+}
@@ -0,0 +1,165 @@
+package transform
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/qProust/fo/ast"
+	"github.com/qProust/fo/format"
+	"github.com/qProust/fo/printer"
+	"github.com/qProust/fo/token"
+)
+
+// FilePreserving transforms f like File and returns the resulting file along
+// with its formatted source code. src must be the source f was parsed from,
+// with parser.ParseComments so that the comments of generated declarations
+// are kept.
+//
+// Unlike formatting the whole file returned by File, which reflows the entire
+// file, FilePreserving copies declarations which are not changed by the
+// transformation (e.g. non-generic declarations which do not use any generic
+// types or functions) byte for byte from src, along with the text between
+// declarations. Only generated and modified declarations are printed. This
+// keeps the diffs of checked-in generated code small.
+func (trans *Transformer) FilePreserving(f *ast.File, src []byte) (*ast.File, []byte, error) {
+	return trans.preserving(f, src, func(f *ast.File) (*ast.File, error) {
+		result, _, err := trans.File(f)
+		return result, err
+	})
+}
+
+// preserving applies transform to f, which was parsed from src, and returns
+// the resulting file along with its source code, in which the declarations
+// that transform leaves unchanged are copied from src as described for
+// FilePreserving. Declarations generated by transform must have the positions
+// of the declaration they replace.
+func (trans *Transformer) preserving(f *ast.File, src []byte, transform func(*ast.File) (*ast.File, error)) (*ast.File, []byte, error) {
+	tokFile := trans.Fset.File(f.Pos())
+	if tokFile == nil || tokFile.Size() != len(src) {
+		return nil, nil, fmt.Errorf("source of %s does not match the parsed file", f.Name.Name)
+	}
+
+	// The declarations of f may be modified in place by transform, so they
+	// are printed up front.
+	type declRange struct {
+		start, end int    // offsets of the declaration (including its doc comment) in src
+		printed    string // the original declaration, without comments
+	}
+	ranges := make([]declRange, len(f.Decls))
+	buf := &bytes.Buffer{}
+	for i, decl := range f.Decls {
+		start := decl.Pos()
+		if doc := declDoc(decl); doc != nil {
+			start = doc.Pos()
+		}
+		buf.Reset()
+		if err := printer.Fprint(buf, trans.Fset, decl); err != nil {
+			return nil, nil, err
+		}
+		ranges[i] = declRange{
+			start:   tokFile.Offset(start),
+			end:     tokFile.Offset(decl.End()),
+			printed: buf.String(),
+		}
+	}
+
+	transformed, err := transform(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(ranges) == 0 {
+		return transformed, src, nil
+	}
+
+	// Group the resulting declarations by the original declaration they were
+	// generated from. Generated declarations keep the positions of the
+	// original one.
+	groups := make([][]ast.Decl, len(ranges))
+	group := 0
+	for _, decl := range transformed.Decls {
+		offset := tokFile.Offset(decl.Pos())
+		for i := group; i < len(ranges); i++ {
+			if offset >= ranges[i].start && offset <= ranges[i].end {
+				group = i
+				break
+			}
+		}
+		groups[group] = append(groups[group], decl)
+	}
+
+	out := &bytes.Buffer{}
+	prev := 0
+	deleted := false
+	for i, r := range ranges {
+		gap := src[prev:r.start]
+		if deleted {
+			gap = trimDeleted(gap)
+		}
+		out.Write(gap)
+		prev = r.end
+		deleted = len(groups[i]) == 0
+		if deleted {
+			continue
+		}
+		if len(groups[i]) == 1 {
+			buf.Reset()
+			if err := printer.Fprint(buf, trans.Fset, groups[i][0]); err != nil {
+				return nil, nil, err
+			}
+			if buf.String() == r.printed {
+				out.Write(src[r.start:r.end])
+				continue
+			}
+		}
+		comments := commentsBetween(f.Comments, tokFile.Pos(r.start), tokFile.Pos(r.end))
+		for j, decl := range groups[i] {
+			if j > 0 {
+				out.WriteString("\n\n")
+			}
+			if err := format.Node(out, trans.Fset, &printer.CommentedNode{Node: decl, Comments: comments}); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	if deleted {
+		out.Write(bytes.TrimRight(trimDeleted(src[prev:]), " \t\n"))
+		out.WriteByte('\n')
+	} else {
+		out.Write(src[prev:])
+	}
+	return transformed, out.Bytes(), nil
+}
+
+// declDoc returns the doc comment of decl, if any.
+func declDoc(decl ast.Decl) *ast.CommentGroup {
+	switch decl := decl.(type) {
+	case *ast.GenDecl:
+		return decl.Doc
+	case *ast.FuncDecl:
+		return decl.Doc
+	}
+	return nil
+}
+
+// commentsBetween returns the comment groups in comments which lie between
+// start and end.
+func commentsBetween(comments []*ast.CommentGroup, start token.Pos, end token.Pos) []*ast.CommentGroup {
+	var result []*ast.CommentGroup
+	for _, c := range comments {
+		if c.Pos() >= start && c.End() <= end {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// trimDeleted removes the rest of the line of a deleted declaration and the
+// blank lines following it from gap, the text after the declaration.
+func trimDeleted(gap []byte) []byte {
+	if i := bytes.IndexByte(gap, '\n'); i >= 0 {
+		gap = gap[i+1:]
+	} else {
+		gap = nil
+	}
+	return bytes.TrimLeft(gap, " \t\n")
+}
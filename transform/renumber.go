@@ -0,0 +1,368 @@
+package transform
+
+import (
+	"go/build/constraint"
+	"reflect"
+	"strings"
+
+	"github.com/qProust/fo/ast"
+	"github.com/qProust/fo/astclone"
+	"github.com/qProust/fo/token"
+)
+
+// Renumber returns a copy of f, a file returned by trans.File whose positions
+// belong to trans.Fset, in which every valid position is replaced by a fresh
+// one in a synthetic file named filename. The new positions increase
+// monotonically in the order in which the nodes are printed, and the returned
+// file set contains only the synthetic file.
+//
+// The declarations generated by the transformer keep the positions of the
+// generic declarations (and type arguments) they were created from, which are
+// out of order in the output. Printing such a file misplaces line breaks, e.g.
+// the copies of a generic method are not separated by a blank line. Renumber
+// keeps the line breaks between the nodes of each declaration as they are in
+// the Fo source, without the lines of code left out of the declaration (such
+// as duplicate type switch cases) or of comments, and separates declarations which are not in source order by
+// a blank line. Nodes copied from elsewhere in the source (e.g. the type
+// arguments of a concrete declaration) stay on the line of the preceding
+// node.
+//
+// The doc and line comments of declarations, specs and fields stay with their
+// nodes, so each declaration generated from a generic one gets its doc
+// comment, including directives such as //go:noinline. Of the other comments,
+// only the directives for the Go tools are kept (see isDirective): those
+// before the package clause, such as build constraints, stay there, and those
+// between declarations, such as //go:generate, are placed before the
+// declaration which follows them in the source.
+//
+// f may also be the result of Transformer.Merge, whose nodes come from several
+// files. The comments before the package clause of a file other than the
+// first one are treated like the ones between declarations.
+func (trans *Transformer) Renumber(f *ast.File, filename string) (*token.FileSet, *ast.File) {
+	fset := trans.Fset
+	f = astclone.Clone(f).(*ast.File)
+	r := &renumberer{fset: fset, lines: []int{0}, skippedLines: map[sourceLine]bool{}}
+	for _, cg := range f.Comments {
+		r.skip(cg)
+	}
+	for _, n := range trans.removed {
+		r.skip(n)
+	}
+
+	// Find the declarations which the directives outside of declarations
+	// precede.
+	var header, trailer []*ast.CommentGroup
+	floating := map[ast.Decl][]*ast.CommentGroup{}
+	for _, cg := range f.Comments {
+		if fset.File(cg.Pos()) == fset.File(f.Package) && cg.End() < f.Package {
+			if cg = directives(cg, true); cg != nil {
+				header = append(header, cg)
+			}
+			continue
+		}
+		if cg = directives(cg, false); cg == nil {
+			continue
+		}
+		var next ast.Decl
+		inside := false
+		for _, decl := range f.Decls {
+			start, end := extent(decl)
+			if fset.File(start) != fset.File(cg.Pos()) {
+				continue
+			}
+			inside = inside || start <= cg.Pos() && cg.End() <= end
+			if next == nil && start > cg.End() {
+				next = decl
+			}
+		}
+		switch {
+		case inside:
+		case next != nil:
+			floating[next] = append(floating[next], cg)
+		default:
+			trailer = append(trailer, cg)
+		}
+	}
+
+	for _, cg := range header {
+		r.newDecl = true
+		r.comments(cg, false)
+	}
+	if len(header) > 0 {
+		// Build constraints must be followed by a blank line.
+		r.minLines = 2
+	}
+	r.newDecl = true
+	r.pos(&f.Package)
+	r.walk(reflect.ValueOf(f.Name))
+	f.Imports = nil
+	for _, decl := range f.Decls {
+		r.start, r.end = extent(decl)
+		if cgs := floating[decl]; len(cgs) > 0 {
+			r.start = cgs[0].Pos()
+		}
+		r.newDecl = true
+		for _, cg := range floating[decl] {
+			r.comments(cg, false)
+		}
+		r.walk(reflect.ValueOf(decl))
+		if decl, ok := decl.(*ast.GenDecl); ok && decl.Tok == token.IMPORT {
+			for _, spec := range decl.Specs {
+				f.Imports = append(f.Imports, spec.(*ast.ImportSpec))
+			}
+		}
+	}
+	r.newDecl = true
+	for _, cg := range trailer {
+		r.comments(cg, false)
+	}
+	f.Doc = nil
+	f.Comments = r.kept
+	f.Scope = nil
+	f.Unresolved = nil
+
+	newFset := token.NewFileSet()
+	file := newFset.AddFile(filename, -1, r.offset+1)
+	file.SetLines(r.lines)
+	for i, p := range r.positions {
+		*p = file.Pos(r.offsets[i])
+	}
+	return newFset, f
+}
+
+// extent returns the positions of the start of decl, including its doc
+// comment, and of its end.
+func extent(decl ast.Decl) (start, end token.Pos) {
+	start, end = decl.Pos(), decl.End()
+	if doc := declDoc(decl); doc != nil {
+		start = doc.Pos()
+	}
+	if decl, ok := decl.(*ast.GenDecl); ok {
+		// The specs of a group may be generated from several declarations.
+		for _, spec := range decl.Specs {
+			if specEnd := spec.End(); specEnd > end {
+				end = specEnd
+			}
+		}
+	}
+	return start, end
+}
+
+// directives returns a comment group of the directives in cg, or nil if
+// there are none. If header is set, cg precedes the package clause, where
+// build constraints of the old form (// +build) are kept as well.
+func directives(cg *ast.CommentGroup, header bool) *ast.CommentGroup {
+	var list []*ast.Comment
+	for _, c := range cg.List {
+		if isDirective(c.Text) || header && constraint.IsPlusBuild(c.Text) {
+			list = append(list, c)
+		}
+	}
+	if list == nil {
+		return nil
+	}
+	return &ast.CommentGroup{List: list}
+}
+
+// isDirective reports whether the comment c is a directive for the Go tools,
+// such as //go:build, //go:generate, //go:noinline or the //export of cgo.
+// Like the go command, it accepts any comment of the form //word:arg, where
+// word consists of lower-case letters and digits. Line directives and the
+// pragmas of Fo (//fo:...) are not directives for the generated code, since
+// they do not apply to it.
+func isDirective(c string) bool {
+	if !strings.HasPrefix(c, "//") {
+		return false
+	}
+	c = c[len("//"):]
+	if strings.HasPrefix(c, "extern ") || strings.HasPrefix(c, "export ") {
+		return true
+	}
+	if strings.HasPrefix(c, "fo:") {
+		return false
+	}
+	colon := strings.Index(c, ":")
+	if colon <= 0 || colon+1 >= len(c) {
+		return false
+	}
+	for i := 0; i <= colon+1; i++ {
+		if i == colon {
+			continue
+		}
+		if b := c[i]; !('a' <= b && b <= 'z' || '0' <= b && b <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// A renumberer computes the offsets of the positions of a file in the
+// synthetic file which replaces it.
+type renumberer struct {
+	fset      *token.FileSet
+	positions []*token.Pos        // positions to renumber, in order
+	offsets   []int               // new offsets of positions
+	lines     []int               // line offsets of the synthetic file
+	offset    int                 // next offset in the synthetic file
+	kept      []*ast.CommentGroup // comments which are kept, in order
+
+	start, end token.Pos      // extent of the declaration being renumbered
+	newDecl    bool           // whether the next position starts a declaration
+	prev       token.Position // last position within the extent
+	minLines   int            // least number of line breaks before the next position
+
+	// skippedLines holds the source lines which are (partly) covered by
+	// comments or by code which the transformer left out, e.g. the type
+	// switch cases removed by fixTypeAssertions. They are not counted as
+	// line breaks between positions, since the comments are not necessarily
+	// kept and the code is not.
+	skippedLines map[sourceLine]bool
+}
+
+type sourceLine struct {
+	filename string
+	line     int
+}
+
+// skip records the source lines of n as skipped lines.
+func (r *renumberer) skip(n ast.Node) {
+	start, end := r.fset.Position(n.Pos()), r.fset.Position(n.End())
+	for line := start.Line; line <= end.Line; line++ {
+		r.skippedLines[sourceLine{start.Filename, line}] = true
+	}
+}
+
+// lineBreaks returns the number of lines from the previous position to orig,
+// which follows it in the same file, not counting the skipped lines in
+// between.
+func (r *renumberer) lineBreaks(orig token.Position) int {
+	lines := orig.Line - r.prev.Line
+	for line := r.prev.Line + 1; line < orig.Line; line++ {
+		if r.skippedLines[sourceLine{orig.Filename, line}] {
+			lines--
+		}
+	}
+	return lines
+}
+
+// walk renumbers the positions in v in the order in which they are printed.
+func (r *renumberer) walk(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return
+		}
+		switch n := v.Interface().(type) {
+		case *ast.CommentGroup, *ast.Object, *ast.Scope:
+			return
+		case *ast.FuncDecl:
+			// The doc comment and the func keyword are printed before the
+			// receiver.
+			r.comments(n.Doc, false)
+			r.pos(&n.Type.Func)
+			funcPos := n.Type.Func
+			n.Type.Func = token.NoPos
+			r.walk(reflect.ValueOf(n.Recv))
+			r.walk(reflect.ValueOf(n.Name))
+			r.walk(reflect.ValueOf(n.Type))
+			r.walk(reflect.ValueOf(n.Body))
+			n.Type.Func = funcPos
+			return
+		}
+		r.walk(v.Elem())
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			r.walk(v.Index(i))
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Field(i)
+			if !field.CanSet() {
+				continue
+			}
+			switch x := field.Addr().Interface().(type) {
+			case *token.Pos:
+				r.pos(x)
+				continue
+			case **ast.CommentGroup:
+				// Doc comments precede the other fields, line comments
+				// follow them.
+				r.comments(*x, v.Type().Field(i).Name == "Comment")
+				continue
+			}
+			r.walk(field)
+		}
+	}
+}
+
+// comments renumbers the comments of cg, if it is not nil, and keeps them. A
+// line comment stays on the line of the previous position.
+func (r *renumberer) comments(cg *ast.CommentGroup, line bool) {
+	if cg == nil {
+		return
+	}
+	for _, c := range cg.List {
+		if !line {
+			// The comment must not end up at the end of the previous
+			// line.
+			r.minLines = 1
+		}
+		r.place(&c.Slash, len(c.Text), line)
+		// Nothing can follow a comment on its line.
+		r.minLines = 1
+	}
+	r.kept = append(r.kept, cg)
+}
+
+// pos records the new offset of the valid position *p.
+func (r *renumberer) pos(p *token.Pos) {
+	r.place(p, 1, false)
+}
+
+// place records the new offset of the valid position *p of a token or comment
+// which is size bytes long, preceded by as many line breaks (at most two) as
+// separate it from the previous position, but at least minLines. If sameLine
+// is set, there are no line breaks.
+func (r *renumberer) place(p *token.Pos, size int, sameLine bool) {
+	if !p.IsValid() {
+		return
+	}
+	orig := r.fset.Position(*p)
+	inDecl := *p >= r.start && *p <= r.end
+	forward := r.prev.IsValid() && orig.Filename == r.prev.Filename && orig.Offset >= r.prev.Offset
+	lines := 0
+	switch {
+	case r.newDecl && forward:
+		lines = r.lineBreaks(orig)
+		if lines < 1 {
+			lines = 1
+		}
+	case r.newDecl:
+		if r.prev.IsValid() {
+			lines = 2
+		}
+	case inDecl && forward:
+		lines = r.lineBreaks(orig)
+	}
+	if lines > 2 {
+		lines = 2
+	}
+	if lines < r.minLines && r.offset > 0 {
+		lines = r.minLines
+	}
+	if sameLine {
+		lines = 0
+	}
+	for i := 0; i < lines; i++ {
+		r.offset++ // newline
+		r.lines = append(r.lines, r.offset)
+	}
+	r.positions = append(r.positions, p)
+	r.offsets = append(r.offsets, r.offset)
+	r.offset += size
+	if inDecl || r.newDecl {
+		r.prev = orig
+	}
+	r.newDecl = false
+	r.minLines = 0
+}
@@ -3,149 +3,434 @@ package transform
 import (
 	"bytes"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"unicode"
 
 	"github.com/qProust/fo/ast"
+	"github.com/qProust/fo/astclone"
 	"github.com/qProust/fo/format"
 	"github.com/qProust/fo/token"
 	"github.com/qProust/fo/types"
 )
 
-const maxSafeStringCounter = 1000
-
-var safeSymbolMap = map[string]string{
-	".": "_",
-	"[": "_",
-	"]": "_",
-	"*": "_",
-	"/": "_",
-	"-": "_",
-	" ": "_",
+// A nameTable assigns the safe strings which stand for the type arguments in
+// the names of instances, e.g. __string in Box____string for Box[[]string].
+// Since the unsafe symbols of different type strings may be replaced with the
+// same safe string (e.g. []string and **string), the colliding type strings
+// are told apart by a counter suffix (__string_0). The suffixes only depend on
+// the set of colliding type strings, which are registered before any of them
+// is assigned: they are ordered by their type strings, and the first one
+// gets no suffix.
+type nameTable struct {
+	mu         sync.Mutex
+	registered map[string][]string // unsafe strings by safe string, before assignment
+	assigned   bool
+	toSafe     map[string]string   // safe strings by unsafe string
+	taken      map[string]struct{} // assigned safe strings
 }
 
-// unsafeToSafe is a mapping of unsafe type strings to safe type strings.
-var unsafeToSafe map[string]string = map[string]string{}
-
-// safeToUnsafe is a mapping of safe type strings to unsafe type strings.
-var safeToUnsafe map[string]string = map[string]string{}
+func newNameTable() *nameTable {
+	return &nameTable{
+		registered: map[string][]string{},
+		toSafe:     map[string]string{},
+		taken:      map[string]struct{}{},
+	}
+}
 
-func typeToSafeString(typ types.Type) string {
-	return exprToSafeString(typeToExpr(typ))
+// register adds the type string unsafe to the ones which the table assigns
+// safe strings to. It must be called before the first call to safe.
+func (t *nameTable) register(unsafe string) {
+	unsafe = strings.TrimSpace(unsafe)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	base := replaceUnsafeSymbols(unsafe)
+	for _, u := range t.registered[base] {
+		if u == unsafe {
+			return
+		}
+	}
+	t.registered[base] = append(t.registered[base], unsafe)
 }
 
-// TODO(albrow): This could be optimized.
-func replaceUnsafeSymbols(unsafe string) string {
+// safe returns the safe string for the type string unsafe.
+func (t *nameTable) safe(unsafe string) string {
 	unsafe = strings.TrimSpace(unsafe)
-	if safe, found := unsafeToSafe[unsafe]; found {
-		return safe
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.assigned {
+		t.assign()
 	}
-	safe := unsafe
-	for unsafeSymbol, safeSymbol := range safeSymbolMap {
-		safe = strings.Replace(safe, unsafeSymbol, safeSymbol, -1)
+	if safe, found := t.toSafe[unsafe]; found {
+		return safe
 	}
-	if _, found := safeToUnsafe[safe]; found {
-		// The safe string collides with another safe string that we have generated.
-		// We need to append a counter to make it unique.
-		safe = appendSafeStringCounter(safe)
+	// The type string was not registered, e.g. because it was written in
+	// a way that differs from the type of any usage. It gets the first free
+	// suffix.
+	safe := replaceUnsafeSymbols(unsafe)
+	if _, found := t.taken[safe]; found {
+		safe = t.appendCounter(safe)
 	}
-	unsafeToSafe[unsafe] = safe
-	safeToUnsafe[safe] = unsafe
+	t.toSafe[unsafe] = safe
+	t.taken[safe] = struct{}{}
 	return safe
 }
 
-// TODO(albrow): This could be optimized.
-func appendSafeStringCounter(s string) string {
-	for i := 0; i < 100; i++ {
+// assign assigns the safe strings of all registered type strings. The safe
+// strings without a suffix are reserved first, so that a suffix never takes
+// the place of the safe string of another type string (e.g. a type named
+// x_0). It must be called with t.mu held.
+func (t *nameTable) assign() {
+	bases := make([]string, 0, len(t.registered))
+	for base, unsafes := range t.registered {
+		sort.Strings(unsafes)
+		bases = append(bases, base)
+		t.toSafe[unsafes[0]] = base
+		t.taken[base] = struct{}{}
+	}
+	sort.Strings(bases)
+	for _, base := range bases {
+		for _, unsafe := range t.registered[base][1:] {
+			safe := t.appendCounter(base)
+			t.toSafe[unsafe] = safe
+			t.taken[safe] = struct{}{}
+		}
+	}
+	t.registered = nil
+	t.assigned = true
+}
+
+// appendCounter returns s followed by the first counter suffix for which the
+// result is not taken. It must be called with t.mu held.
+func (t *nameTable) appendCounter(s string) string {
+	for i := 0; ; i++ {
 		stringWithCounter := fmt.Sprintf("%s_%d", s, i)
-		if _, found := safeToUnsafe[stringWithCounter]; !found {
+		if _, found := t.taken[stringWithCounter]; !found {
 			return stringWithCounter
 		}
 	}
-	panic(fmt.Errorf("Could not find unique safe string for %s", s))
 }
 
-func exprToSafeString(expr ast.Expr) string {
-	buf := bytes.Buffer{}
-	format.Node(&buf, token.NewFileSet(), expr)
-	return replaceUnsafeSymbols(buf.String())
+// ShareNames makes transformers use the same safe strings for the type
+// arguments in the names of instances. Transformers of packages which refer to
+// each other's instances, such as the packages of a build, must share them,
+// since a suffix which tells colliding type strings apart depends on all of
+// the type arguments used with the generic declarations of the packages. It
+// must be called before any of the transformers transforms a file.
+func ShareNames(transformers []*Transformer) {
+	table := newNameTable()
+	for _, trans := range transformers {
+		trans.safeStrings = table
+		trans.registerTypeArgs(table)
+	}
+}
+
+// nameTable returns the table of safe strings used by trans. Unless it was
+// given one by ShareNames, trans uses its own table, which is created on first
+// use.
+func (trans *Transformer) nameTable() *nameTable {
+	trans.safeStringsOnce.Do(func() {
+		if trans.safeStrings == nil {
+			trans.safeStrings = newNameTable()
+			trans.registerTypeArgs(trans.safeStrings)
+		}
+	})
+	return trans.safeStrings
 }
 
-func typeToExpr(typ types.Type) ast.Expr {
+// registerTypeArgs registers the type arguments of the usages of the generic
+// declarations of trans.Pkg and the packages it imports (directly or
+// indirectly) with table, as they are written in the code generated for
+// trans.Pkg.
+func (trans *Transformer) registerTypeArgs(table *nameTable) {
+	seen := map[*types.Package]bool{trans.Pkg: true}
+	pkgs := []*types.Package{trans.Pkg}
+	for i := 0; i < len(pkgs); i++ {
+		for _, decl := range pkgs[i].Generics() {
+			if decl.Native {
+				continue
+			}
+			for _, usg := range decl.Usages {
+				for _, param := range decl.Type.TypeParams() {
+					if typ := usg.TypeMap()[param.String()]; typ != nil {
+						table.register(typeString(trans.typeToExpr(typ)))
+					}
+				}
+			}
+		}
+		for _, imp := range pkgs[i].Imports() {
+			if !seen[imp] {
+				seen[imp] = true
+				pkgs = append(pkgs, imp)
+			}
+		}
+	}
+}
+
+func (trans *Transformer) typeToSafeString(typ types.Type) string {
+	return trans.exprToSafeString(trans.typeToExpr(typ))
+}
+
+// replaceUnsafeSymbols replaces each character of the type string unsafe which
+// cannot be part of an identifier (e.g. the brackets, stars and spaces in
+// map[string]*int, or the arrow in <-chan int) with an underscore.
+func replaceUnsafeSymbols(unsafe string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, unsafe)
+}
+
+// bufPool holds buffers used for formatting type expressions.
+var bufPool = sync.Pool{
+	New: func() interface{} { return &bytes.Buffer{} },
+}
+
+// exprToSafeString returns the safe string which stands for the type
+// expression expr in the names of instances.
+func (trans *Transformer) exprToSafeString(expr ast.Expr) string {
+	return trans.nameTable().safe(typeString(expr))
+}
+
+// typeString returns the type expression expr formatted like format.Node,
+// except that struct and interface types are written on a single line (see
+// writeBlockType).
+func typeString(expr ast.Expr) string {
+	buf := bufPool.Get().(*bytes.Buffer)
+	defer bufPool.Put(buf)
+	buf.Reset()
+	if !writeSimpleExpr(buf, expr) {
+		buf.Reset()
+		if !writeBlockType(buf, expr) {
+			buf.Reset()
+			format.Node(buf, token.NewFileSet(), expr)
+		}
+	}
+	return buf.String()
+}
+
+// writeBlockType writes expr to buf if it is a struct or interface type, with
+// its fields or methods separated by semicolons rather than on lines of their
+// own (e.g. struct{i int; x string}), which format.Node would put them on. Tags
+// are always written as interpreted string literals, and the methods and
+// embedded types of an interface are sorted, since their order does not
+// matter for its identity. It returns false if expr is any other kind of
+// expression.
+func writeBlockType(buf *bytes.Buffer, expr ast.Expr) bool {
+	var fields *ast.FieldList
+	iface := false
+	switch x := expr.(type) {
+	case *ast.StructType:
+		buf.WriteString("struct{")
+		fields = x.Fields
+	case *ast.InterfaceType:
+		buf.WriteString("interface{")
+		fields = x.Methods
+		iface = true
+	default:
+		return false
+	}
+	var entries []string
+	if fields != nil {
+		for _, field := range fields.List {
+			var names []string
+			for _, name := range field.Names {
+				names = append(names, name.Name)
+			}
+			entry := strings.Join(names, ", ")
+			switch {
+			case iface && len(names) > 0:
+				// A method, e.g. Get() T.
+				entry += strings.TrimPrefix(typeString(field.Type), "func")
+			case len(names) > 0:
+				entry += " " + typeString(field.Type)
+			default:
+				entry = typeString(field.Type)
+			}
+			if field.Tag != nil {
+				if tag, err := strconv.Unquote(field.Tag.Value); err == nil {
+					entry += " " + strconv.Quote(tag)
+				}
+			}
+			entries = append(entries, entry)
+		}
+	}
+	if iface {
+		sort.Strings(entries)
+	}
+	buf.WriteString(strings.Join(entries, "; "))
+	buf.WriteByte('}')
+	return true
+}
+
+// writeSimpleExpr writes expr to buf in the same way as format.Node, which is
+// comparatively expensive, but only for the most common kinds of type
+// expressions. It returns false if expr contains any other kind of
+// expression, in which case buf holds partial output.
+func writeSimpleExpr(buf *bytes.Buffer, expr ast.Expr) bool {
+	switch x := expr.(type) {
+	case *ast.Ident:
+		buf.WriteString(x.Name)
+		return true
+	case *ast.BasicLit:
+		buf.WriteString(x.Value)
+		return true
+	case *ast.SelectorExpr:
+		if _, ok := x.X.(*ast.Ident); !ok {
+			return false
+		}
+		writeSimpleExpr(buf, x.X)
+		buf.WriteByte('.')
+		buf.WriteString(x.Sel.Name)
+		return true
+	case *ast.StarExpr:
+		buf.WriteByte('*')
+		return writeSimpleExpr(buf, x.X)
+	case *ast.ArrayType:
+		buf.WriteByte('[')
+		if x.Len != nil {
+			lit, ok := x.Len.(*ast.BasicLit)
+			if !ok {
+				return false
+			}
+			buf.WriteString(lit.Value)
+		}
+		buf.WriteByte(']')
+		return writeSimpleExpr(buf, x.Elt)
+	case *ast.MapType:
+		buf.WriteString("map[")
+		if !writeSimpleExpr(buf, x.Key) {
+			return false
+		}
+		buf.WriteByte(']')
+		return writeSimpleExpr(buf, x.Value)
+	}
+	return false
+}
+
+func (trans *Transformer) typeToExpr(typ types.Type) ast.Expr {
 	switch typ := typ.(type) {
+	case *types.Basic:
+		// The name of a basic type, without the detour through
+		// types.TypeString, except for unsafe.Pointer which is qualified.
+		if typ.Kind() != types.UnsafePointer {
+			return ast.NewIdent(typ.Name())
+		}
 	case *types.Pointer:
-		return pointerTypeToExpr(typ)
+		return trans.pointerTypeToExpr(typ)
 	case *types.Slice:
-		return sliceTypeToExpr(typ)
+		return trans.sliceTypeToExpr(typ)
 	case *types.Array:
-		return arrayTypeToExpr(typ)
+		return trans.arrayTypeToExpr(typ)
 	case *types.Map:
-		return mapTypetoExpr(typ)
+		return trans.mapTypetoExpr(typ)
 	case *types.Chan:
-		return chanTypeToExpr(typ)
+		return trans.chanTypeToExpr(typ)
 	case *types.Struct:
-		return structTypeToExpr(typ)
+		return trans.structTypeToExpr(typ)
 	case *types.Signature:
-		return signatureTypeToExpr(typ)
+		return trans.signatureTypeToExpr(typ)
+	case *types.ConcreteSignature:
+		// The type of an instance of a generic function used as a value,
+		// e.g. of f in f := Map[int, string].
+		return trans.signatureTypeToExpr(typ.Signature)
 	case *types.Named:
-		return namedTypeToExpr(typ)
+		return trans.namedTypeToExpr(typ)
+	case *types.ConcreteNamed:
+		return trans.concreteNamedTypeToExpr(typ)
+	case *types.PartialGenericNamed:
+		return trans.concreteNamedTypeToExpr(typ)
+	case *types.ConstArg:
+		return &ast.BasicLit{
+			Kind:  token.INT,
+			Value: typ.String(),
+		}
+	case *types.Interface:
+		if typ.Empty() && trans.useAny() {
+			return ast.NewIdent("any")
+		}
+		return trans.interfaceTypeToExpr(typ)
 	}
 	return ast.NewIdent(typ.String())
 }
 
-func pointerTypeToExpr(ptr *types.Pointer) ast.Expr {
+func (trans *Transformer) pointerTypeToExpr(ptr *types.Pointer) ast.Expr {
 	return &ast.StarExpr{
-		X: typeToExpr(ptr.Elem()),
+		X: trans.typeToExpr(ptr.Elem()),
 	}
 }
 
-func sliceTypeToExpr(slice *types.Slice) ast.Expr {
+func (trans *Transformer) sliceTypeToExpr(slice *types.Slice) ast.Expr {
 	return &ast.ArrayType{
 		Len: nil,
-		Elt: typeToExpr(slice.Elem()),
+		Elt: trans.typeToExpr(slice.Elem()),
 	}
 }
 
-func arrayTypeToExpr(array *types.Array) ast.Expr {
+func (trans *Transformer) arrayTypeToExpr(array *types.Array) ast.Expr {
+	if tp := array.LenParam(); tp != nil {
+		return &ast.ArrayType{
+			Len: ast.NewIdent(tp.String()),
+			Elt: trans.typeToExpr(array.Elem()),
+		}
+	}
 	return &ast.ArrayType{
 		Len: &ast.BasicLit{
 			Kind:  token.INT,
 			Value: strconv.Itoa(int(array.Len())),
 		},
-		Elt: typeToExpr(array.Elem()),
+		Elt: trans.typeToExpr(array.Elem()),
 	}
 }
 
-func mapTypetoExpr(m *types.Map) ast.Expr {
+func (trans *Transformer) mapTypetoExpr(m *types.Map) ast.Expr {
 	return &ast.MapType{
-		Key:   typeToExpr(m.Key()),
-		Value: typeToExpr(m.Elem()),
+		Key:   trans.typeToExpr(m.Key()),
+		Value: trans.typeToExpr(m.Elem()),
 	}
 }
 
-func chanTypeToExpr(ch *types.Chan) ast.Expr {
+func (trans *Transformer) chanTypeToExpr(ch *types.Chan) ast.Expr {
 	var chanDir ast.ChanDir
 	switch ch.Dir() {
 	case types.SendRecv:
-		chanDir = ast.SEND & ast.RECV
+		chanDir = ast.SEND | ast.RECV
 	case types.SendOnly:
 		chanDir = ast.SEND
 	case types.RecvOnly:
 		chanDir = ast.RECV
 	}
+	elem := trans.typeToExpr(ch.Elem())
+	if elemChan, ok := ch.Elem().(*types.Chan); ok && ch.Dir() == types.SendRecv && elemChan.Dir() == types.RecvOnly {
+		// chan <-chan int would be chan<- chan int.
+		elem = &ast.ParenExpr{X: elem}
+	}
 	return &ast.ChanType{
 		Dir:   chanDir,
-		Value: typeToExpr(ch.Elem()),
+		Value: elem,
 	}
 }
 
-func structTypeToExpr(st *types.Struct) ast.Expr {
+func (trans *Transformer) structTypeToExpr(st *types.Struct) ast.Expr {
 	fieldList := make([]*ast.Field, st.NumFields())
 	for i := 0; i < st.NumFields(); i++ {
 		field := st.Field(i)
 		fieldList[i] = &ast.Field{
-			Names: []*ast.Ident{ast.NewIdent(field.Name())},
-			Type:  typeToExpr(field.Type()),
+			Type: trans.typeToExpr(field.Type()),
+		}
+		if !field.Anonymous() {
+			fieldList[i].Names = []*ast.Ident{ast.NewIdent(field.Name())}
+		}
+		if tag := st.Tag(i); tag != "" {
+			value := strconv.Quote(tag)
+			if strconv.CanBackquote(tag) {
+				value = "`" + tag + "`"
+			}
+			fieldList[i].Tag = &ast.BasicLit{Kind: token.STRING, Value: value}
 		}
 	}
 	return &ast.StructType{
@@ -155,33 +440,125 @@ func structTypeToExpr(st *types.Struct) ast.Expr {
 	}
 }
 
-func signatureTypeToExpr(sig *types.Signature) ast.Expr {
+// interfaceTypeToExpr returns the interface type expression for iface, with
+// its explicitly declared methods and embedded types.
+func (trans *Transformer) interfaceTypeToExpr(iface *types.Interface) ast.Expr {
+	var fieldList []*ast.Field
+	for i := 0; i < iface.NumEmbeddeds(); i++ {
+		fieldList = append(fieldList, &ast.Field{
+			Type: trans.typeToExpr(iface.EmbeddedType(i)),
+		})
+	}
+	for i := 0; i < iface.NumExplicitMethods(); i++ {
+		m := iface.ExplicitMethod(i)
+		fieldList = append(fieldList, &ast.Field{
+			Names: []*ast.Ident{ast.NewIdent(m.Name())},
+			Type:  trans.signatureTypeToExpr(m.Type().(*types.Signature)),
+		})
+	}
+	return &ast.InterfaceType{
+		Methods: &ast.FieldList{
+			List: fieldList,
+		},
+	}
+}
+
+// signatureTypeToExpr returns the function type expression for sig. The names
+// of the parameters and results are left out, since they do not matter for the
+// identity of the type, so that the instances for func(x int) int and func(int)
+// int get the same name.
+func (trans *Transformer) signatureTypeToExpr(sig *types.Signature) ast.Expr {
+	params := trans.tupleToFieldList(sig.Params())
+	if sig.Variadic() {
+		last := params.List[len(params.List)-1]
+		last.Type = &ast.Ellipsis{Elt: last.Type.(*ast.ArrayType).Elt}
+	}
 	return &ast.FuncType{
-		Params:  tupleToFieldList(sig.Params()),
-		Results: tupleToFieldList(sig.Results()),
+		Params:  params,
+		Results: trans.tupleToFieldList(sig.Results()),
+	}
+}
+
+// withoutParamNames returns the type expression expr with the names of the
+// parameters and results of the function types in it left out, as in the
+// expressions written by signatureTypeToExpr (e.g. func(int, int) int for
+// func(a, b int) (sum int)). expr itself is returned if there are no names.
+func withoutParamNames(expr ast.Expr) ast.Expr {
+	hasNames := func(list *ast.FieldList) bool {
+		return list != nil && len(list.List) > 0 && len(list.List[0].Names) > 0
+	}
+	named := false
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if ftyp, ok := n.(*ast.FuncType); ok && (hasNames(ftyp.Params) || hasNames(ftyp.Results)) {
+			named = true
+		}
+		return !named
+	})
+	if !named {
+		return expr
 	}
+	unname := func(list *ast.FieldList) {
+		if !hasNames(list) {
+			return
+		}
+		var fields []*ast.Field
+		for _, field := range list.List {
+			for range field.Names {
+				fields = append(fields, &ast.Field{Type: field.Type})
+			}
+		}
+		list.List = fields
+	}
+	expr = astclone.Clone(expr).(ast.Expr)
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if ftyp, ok := n.(*ast.FuncType); ok {
+			unname(ftyp.Params)
+			unname(ftyp.Results)
+		}
+		return true
+	})
+	return expr
 }
 
-func namedTypeToExpr(named *types.Named) ast.Expr {
+func (trans *Transformer) namedTypeToExpr(named *types.Named) ast.Expr {
 	if named.Obj() == nil || named.Obj().Pkg() == nil {
 		return ast.NewIdent(named.String())
 	}
-	if named.Obj().Pkg().Name() == "main" {
-		return ast.NewIdent(named.Obj().Id())
+	return trans.objToExpr(named.Obj())
+}
+
+// concreteNamedTypeToExpr returns the type argument expression for a concrete
+// type, e.g. Box[int], or a partially generic one, e.g. Box[U]. It is replaced
+// with the name of the concrete type together with the other type argument
+// expressions.
+func (trans *Transformer) concreteNamedTypeToExpr(named types.ConcreteType) ast.Expr {
+	genType := named.GenericType()
+	var typeArgs []ast.Expr
+	for _, param := range genType.TypeParams() {
+		typeArgs = append(typeArgs, trans.typeToExpr(named.TypeMap()[param.String()]))
+	}
+	return ast.NewTypeArgExpr(trans.objToExpr(genType.Object()), typeArgs...)
+}
+
+// objToExpr returns the name of obj, which is qualified unless obj is declared
+// in the package being transformed. The qualifier is the name of the package of
+// obj, which is replaced with the name under which the file imports it once the
+// file is transformed (see resolveQualifiers).
+func (trans *Transformer) objToExpr(obj types.Object) ast.Expr {
+	if obj.Pkg() == trans.Pkg {
+		return ast.NewIdent(obj.Name())
 	}
 	return &ast.SelectorExpr{
-		X:   ast.NewIdent(named.Obj().Pkg().Name()),
-		Sel: ast.NewIdent(named.Obj().Id()),
+		X:   qualifierIdent(obj.Pkg()),
+		Sel: ast.NewIdent(obj.Name()),
 	}
 }
 
-func tupleToFieldList(tuple *types.Tuple) *ast.FieldList {
+func (trans *Transformer) tupleToFieldList(tuple *types.Tuple) *ast.FieldList {
 	fieldList := make([]*ast.Field, tuple.Len())
 	for i := 0; i < tuple.Len(); i++ {
-		field := tuple.At(i)
 		fieldList[i] = &ast.Field{
-			Names: []*ast.Ident{ast.NewIdent(field.Name())},
-			Type:  typeToExpr(field.Type()),
+			Type: trans.typeToExpr(tuple.At(i).Type()),
 		}
 	}
 	return &ast.FieldList{
@@ -0,0 +1,261 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+
+	"github.com/qProust/fo/ast"
+	"github.com/qProust/fo/parser"
+	"github.com/qProust/fo/token"
+	"github.com/qProust/fo/types"
+)
+
+// A SourceMap relates positions in a generated Go file to positions in the Fo
+// source file it was generated from. It is meant to be encoded as JSON and
+// written next to the generated file for use by debuggers, coverage tools and
+// editors.
+type SourceMap struct {
+	File      string              `json:"file"`   // name of the generated file
+	Source    string              `json:"source"` // name of the Fo source file
+	Decls     []SourceMapDecl     `json:"decls"`
+	Positions []SourceMapPosition `json:"positions"`
+}
+
+// A SourceMapDecl describes a top-level declaration (or a method of an
+// interface type) in a generated file.
+type SourceMapDecl struct {
+	Name       string   `json:"name"`               // name of the declaration, qualified by the receiver type for methods
+	Line       int      `json:"line"`               // first line in the generated file
+	EndLine    int      `json:"endLine"`            // last line in the generated file
+	SourceLine int      `json:"sourceLine"`         // line in the Fo source, or 0 if unknown
+	Generic    string   `json:"generic,omitempty"`  // generic declaration it was generated from, if any
+	TypeArgs   []string `json:"typeArgs,omitempty"` // type arguments of the usage it was generated for
+}
+
+// A SourceMapPosition maps a position in the generated file to the position
+// in the Fo source of the node that starts there. Lines and columns start at
+// 1.
+type SourceMapPosition struct {
+	Line         int `json:"line"`
+	Column       int `json:"column"`
+	SourceLine   int `json:"sourceLine"`
+	SourceColumn int `json:"sourceColumn"`
+}
+
+// ReadSourceMap reads the source map written to the file filename, usually
+// the name of the generated file followed by .map.
+func ReadSourceMap(filename string) (*SourceMap, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var sm SourceMap
+	if err := json.Unmarshal(data, &sm); err != nil {
+		return nil, fmt.Errorf("invalid source map %s: %s", filename, err)
+	}
+	return &sm, nil
+}
+
+// SourceMap returns the source map for the generated file named filename,
+// whose contents src are the formatted output of f. f must have been returned
+// by trans.File. Nodes which were created by the transformer and do not
+// correspond to any Fo source (e.g. concrete type arguments) are not mapped.
+func (trans *Transformer) SourceMap(f *ast.File, filename string, src []byte) (*SourceMap, error) {
+	genFset := token.NewFileSet()
+	gen, err := parser.ParseFile(genFset, filename, src, 0)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse generated file: %s", err)
+	}
+	source := trans.Fset.File(f.Package)
+	if source == nil {
+		return nil, fmt.Errorf("no position information for %s", f.Name.Name)
+	}
+	result := &SourceMap{
+		File:      filename,
+		Source:    source.Name(),
+		Decls:     []SourceMapDecl{},
+		Positions: []SourceMapPosition{},
+	}
+
+	// Printing the transformed file and parsing it again results in the same
+	// tree, so the nodes can be matched by the order in which they are
+	// visited. Comments are skipped because the parser may attach them
+	// differently.
+	nodes, genNodes := sourceMapNodes(f), sourceMapNodes(gen)
+	for i, n := range nodes {
+		if i >= len(genNodes) || reflect.TypeOf(n) != reflect.TypeOf(genNodes[i]) {
+			// The trees diverge, so no further positions can be trusted.
+			break
+		}
+		genNode := genNodes[i]
+		switch n := n.(type) {
+		case *ast.FuncDecl, *ast.TypeSpec:
+			result.Decls = append(result.Decls, trans.sourceMapDecl(n, genNode, genFset, source))
+		case *ast.Field:
+			if _, found := trans.InstanceOf(n); found {
+				result.Decls = append(result.Decls, trans.sourceMapDecl(n, genNode, genFset, source))
+			}
+		}
+		pos := n.Pos()
+		if !pos.IsValid() || trans.Fset.File(pos) != source {
+			continue
+		}
+		genPos := genFset.Position(genNode.Pos())
+		if last := len(result.Positions) - 1; last >= 0 {
+			if prev := result.Positions[last]; prev.Line == genPos.Line && prev.Column == genPos.Column {
+				continue
+			}
+		}
+		srcPos := trans.Fset.Position(pos)
+		result.Positions = append(result.Positions, SourceMapPosition{
+			Line:         genPos.Line,
+			Column:       genPos.Column,
+			SourceLine:   srcPos.Line,
+			SourceColumn: srcPos.Column,
+		})
+	}
+	return result, nil
+}
+
+// sourceMapNodes returns the nodes in n (excluding comments) in depth-first
+// order.
+func sourceMapNodes(n ast.Node) []ast.Node {
+	var nodes []ast.Node
+	ast.Inspect(n, func(n ast.Node) bool {
+		switch n.(type) {
+		case nil, *ast.CommentGroup, *ast.Comment:
+			return false
+		}
+		nodes = append(nodes, n)
+		return true
+	})
+	return nodes
+}
+
+// sourceMapDecl returns the description of the declaration n, which
+// corresponds to genNode in the generated file.
+func (trans *Transformer) sourceMapDecl(n ast.Node, genNode ast.Node, genFset *token.FileSet, source *token.File) SourceMapDecl {
+	decl := SourceMapDecl{
+		Line:    genFset.Position(genNode.Pos()).Line,
+		EndLine: genFset.Position(genNode.End()).Line,
+	}
+	switch n := n.(type) {
+	case *ast.FuncDecl:
+		decl.Name = n.Name.Name
+		if n.Recv != nil && len(n.Recv.List) == 1 {
+			if recv := recvTypeName(n.Recv.List[0].Type); recv != "" {
+				decl.Name = recv + "." + decl.Name
+			}
+		}
+	case *ast.TypeSpec:
+		decl.Name = n.Name.Name
+	case *ast.Field:
+		if len(n.Names) > 0 {
+			decl.Name = n.Names[0].Name
+		}
+	}
+	if pos := n.Pos(); pos.IsValid() && trans.Fset.File(pos) == source {
+		decl.SourceLine = trans.Fset.Position(pos).Line
+	}
+	if inst, found := trans.InstanceOf(n); found {
+		decl.Generic = inst.Decl.Name
+		params := inst.Decl.Type.TypeParams()
+		if sig, ok := inst.Decl.Type.(*types.GenericSignature); ok && sig.Recv() != nil {
+			// A method of a generic type is generated for the type arguments of
+			// the receiver as well as its own.
+			recvType := sig.Recv().Type()
+			if ptr, ok := recvType.(*types.Pointer); ok {
+				recvType = ptr.Elem()
+			}
+			if named, ok := recvType.(types.BaseNamed); ok {
+				decl.Generic = named.Obj().Name() + "." + decl.Generic
+			}
+			params = append(append([]*types.TypeParam{}, sig.RecvTypeParams()...), params...)
+		}
+		qualifier := types.FoNames(types.RelativeTo(trans.Pkg))
+		for _, param := range params {
+			if typ := inst.Usage.TypeMap()[param.String()]; typ != nil {
+				decl.TypeArgs = append(decl.TypeArgs, types.TypeString(typ, qualifier))
+			}
+		}
+	}
+	return decl
+}
+
+// recvTypeName returns the name of the base type of the receiver type expr, or
+// the empty string if it is not a (possibly pointer to a) named type.
+func recvTypeName(expr ast.Expr) string {
+	switch x := expr.(type) {
+	case *ast.StarExpr:
+		return recvTypeName(x.X)
+	case *ast.ParenExpr:
+		return recvTypeName(x.X)
+	case *ast.TypeArgExpr:
+		return recvTypeName(x.X)
+	case *ast.Ident:
+		return x.Name
+	}
+	return ""
+}
+
+// LineDirectives returns src, the contents of the generated file described by
+// sm, with //line directives added which refer to the Fo source. The Go
+// toolchain then reports positions in the Fo source instead of the generated
+// file, e.g. in compiler errors, stack traces and debug information. A
+// directive is added before each line which starts a node whose source line
+// does not follow the one of the previous line.
+func (sm *SourceMap) LineDirectives(src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, sm.File, src, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse generated file: %s", err)
+	}
+	source, err := filepath.Abs(sm.Source)
+	if err != nil {
+		return nil, err
+	}
+
+	// A directive can't be inserted before a line which begins inside a
+	// comment or a string literal.
+	inside := map[int]bool{}
+	mark := func(n ast.Node) {
+		for line := fset.Position(n.Pos()).Line + 1; line <= fset.Position(n.End()).Line; line++ {
+			inside[line] = true
+		}
+	}
+	for _, group := range f.Comments {
+		for _, c := range group.List {
+			mark(c)
+		}
+	}
+	ast.Inspect(f, func(n ast.Node) bool {
+		if lit, ok := n.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+			mark(lit)
+		}
+		return true
+	})
+
+	sourceLines := map[int]int{} // generated line -> source line of its first node
+	for _, pos := range sm.Positions {
+		if _, found := sourceLines[pos.Line]; !found {
+			sourceLines[pos.Line] = pos.SourceLine
+		}
+	}
+	buf := &bytes.Buffer{}
+	next := 0 // source line of the next line if there is no directive
+	for i, line := range bytes.SplitAfter(src, []byte("\n")) {
+		if sourceLine, found := sourceLines[i+1]; found && sourceLine != next && !inside[i+1] {
+			fmt.Fprintf(buf, "//line %s:%d\n", source, sourceLine)
+			next = sourceLine
+		}
+		buf.Write(line)
+		if next != 0 {
+			next++
+		}
+	}
+	return buf.Bytes(), nil
+}
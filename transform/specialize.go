@@ -0,0 +1,119 @@
+package transform
+
+import (
+	"sort"
+
+	"github.com/qProust/fo/scanner"
+	"github.com/qProust/fo/types"
+)
+
+// specialization returns the hand-written function which replaces the
+// instance of the generic function decl for usg, or nil if there is none. A
+// specialization is an ordinary function of the package which has the name of
+// the instance, e.g. Sum__float64 for Sum[float64]. No code is generated for
+// the instance then, and its usages call the specialization instead, since
+// they are replaced by the same name.
+func (trans *Transformer) specialization(decl *types.GenericDecl, usg types.ConcreteType) *types.Func {
+	if sig, ok := decl.Type.(*types.GenericSignature); !ok || sig.Recv() != nil || decl.Native {
+		return nil
+	}
+	fn, _ := trans.Pkg.Scope().Lookup(trans.concreteTypeName(decl, usg)).(*types.Func)
+	if fn == nil {
+		return nil
+	}
+	if _, ok := fn.Type().(*types.Signature); !ok {
+		// another generic function
+		return nil
+	}
+	return fn
+}
+
+// checkSpecializations verifies that each specialization of an instance of a
+// generic function has the type of the instance. Any other declaration with
+// the name of an instance would clash with the generated code, so it is
+// reported as well: a declaration with the name of an instance of a generic
+// function which is not a specialization, any declaration with the name of an
+// instance of a generic type (which cannot be specialized, since its methods
+// would be generated anyway), and a method or field with the name of an
+// instance of a generic method of its type. The result is a
+// scanner.ErrorList, or nil if there are no errors.
+func (trans *Transformer) checkSpecializations() error {
+	var errs scanner.ErrorList
+	generics := trans.Pkg.Generics()
+	keys := make([]string, 0, len(generics))
+	for key := range generics {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	// The instances of a generic method of a generic type have the same name
+	// for each type argument of the receiver, so clashes are only reported
+	// once.
+	clashes := map[types.Object]bool{}
+	for _, key := range keys {
+		decl := generics[key]
+		if decl.Native {
+			continue
+		}
+		for _, usg := range decl.Usages {
+			name := trans.concreteTypeName(decl, usg)
+			if name == decl.Name {
+				continue
+			}
+			switch typ := decl.Type.(type) {
+			case *types.GenericNamed:
+				if obj := trans.Pkg.Scope().Lookup(name); obj != nil {
+					errs.Add(trans.Fset.Position(obj.Pos()), name+" is the name of an instance of the generic type "+decl.Name+", which cannot be specialized")
+				}
+			case *types.GenericSignature:
+				if recv := typ.Recv(); recv != nil {
+					if obj := methodClash(recv, trans.Pkg, name); obj != nil && !clashes[obj] {
+						clashes[obj] = true
+						errs.Add(trans.Fset.Position(obj.Pos()), name+" is the name of an instance of the generic method "+recvBaseName(recv)+"."+decl.Name+", which cannot be specialized")
+					}
+					continue
+				}
+				fn := trans.specialization(decl, usg)
+				if fn == nil {
+					if obj := trans.Pkg.Scope().Lookup(name); obj != nil {
+						errs.Add(trans.Fset.Position(obj.Pos()), name+" is the name of an instance of the generic function "+decl.Name+", which can only be specialized by a function without type parameters")
+					}
+					continue
+				}
+				instance := usg.(*types.ConcreteSignature).Signature
+				if !types.Identical(fn.Type(), instance) {
+					errs.Add(trans.Fset.Position(fn.Pos()), "specialization "+name+" of "+decl.Name+" has type "+fn.Type().String()+", but the instance has type "+instance.String())
+				}
+			}
+		}
+	}
+	errs.Sort()
+	return errs.Err()
+}
+
+// methodClash returns the field or method of the receiver type of recv which
+// is declared in pkg with the given name, the name of an instance of a generic
+// method, or nil if there is none. Fields and methods which are promoted from
+// embedded types do not clash, since they are shadowed by the instance.
+func methodClash(recv *types.Var, pkg *types.Package, name string) types.Object {
+	recvType := recv.Type()
+	if ptr, ok := recvType.(*types.Pointer); ok {
+		recvType = ptr.Elem()
+	}
+	obj, index, _ := types.LookupFieldOrMethod(recvType, true, pkg, name)
+	if len(index) != 1 {
+		return nil
+	}
+	return obj
+}
+
+// recvBaseName returns the name of the base type of the receiver recv.
+func recvBaseName(recv *types.Var) string {
+	recvType := recv.Type()
+	if ptr, ok := recvType.(*types.Pointer); ok {
+		recvType = ptr.Elem()
+	}
+	if named, ok := recvType.(types.BaseNamed); ok {
+		return named.Obj().Name()
+	}
+	return recvType.String()
+}
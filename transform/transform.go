@@ -1,15 +1,17 @@
 package transform
 
 import (
-	"bytes"
 	"fmt"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/qProust/fo/ast"
 	"github.com/qProust/fo/astclone"
 	"github.com/qProust/fo/astutil"
-	"github.com/qProust/fo/printer"
+	"github.com/qProust/fo/constant"
+	"github.com/qProust/fo/scanner"
 	"github.com/qProust/fo/token"
 	"github.com/qProust/fo/types"
 )
@@ -21,22 +23,368 @@ type Transformer struct {
 	Fset *token.FileSet
 	Pkg  *types.Package
 	Info *types.Info
+
+	// SourceOrder keeps the specs of type declarations in source order.
+	// Without it, the specs of a group are sorted by name, which may move the
+	// instances of a generic type away from the place of its declaration (and
+	// reorder the other specs of the group). With it, the instances take the
+	// place of the generic type, sorted by name among themselves. Functions
+	// and methods always take the place of their generic declaration.
+	SourceOrder bool
+
+	// UnexportedInstances gives the concrete declarations generated for the
+	// usages of exported generic types and functions which are only used in
+	// their own package unexported names, e.g. box__int instead of Box__int
+	// for Box[int], so that they do not become part of the API of the package.
+	// The instances which another package uses keep their exported names, as
+	// do the instances of generic methods. The instances of unexported generic
+	// declarations always have unexported names.
+	UnexportedInstances bool
+
+	// GoVersion is the version of Go which the generated code targets. The
+	// constructs of later versions are avoided: the predeclared min and max
+	// are only kept as of Go 1.21, and empty interfaces are only written as
+	// any as of Go 1.18. If zero, the generated code is meant for any
+	// version, so all of them are avoided. The Checker must have been
+	// configured with the same version (see types.Config.GoVersion).
+	GoVersion types.GoVersion
+
+	namesMu   sync.Mutex
+	names     map[types.ConcreteType]string // concrete names by usage
+	instances map[ast.Node]Instance         // generated nodes and the usages they were generated for
+	origins   map[ast.Node]ast.Node         // generic nodes by the nodes generated from them (see addOrigin)
+	removed   []ast.Node                    // nodes of generic declarations left out of some instances (see addRemoved)
+
+	// embeddedFields holds the types of the embedded fields referred to by
+	// identifiers in generic declarations, by position (see
+	// findEmbeddedFields).
+	embeddedFields map[token.Pos]types.ConcreteType
+
+	// unexported maps the default names of the concrete declarations which
+	// are renamed because of UnexportedInstances to their new names (see
+	// findUnexportedNames).
+	unexportedOnce sync.Once
+	unexported     map[string]string
+
+	// safeStrings holds the safe strings of the type arguments in the names
+	// of instances (see nameTable and ShareNames).
+	safeStringsOnce sync.Once
+	safeStrings     *nameTable
+
+	// checkErr holds the result of the checks of the package run by
+	// CheckPackage.
+	checkOnce sync.Once
+	checkErr  error
+}
+
+// targets reports whether the generated code may use the constructs of Go
+// version major.minor (see GoVersion).
+func (trans *Transformer) targets(major, minor int) bool {
+	return trans.GoVersion != (types.GoVersion{}) && trans.GoVersion.AtLeast(major, minor)
+}
+
+// useAny reports whether the empty interface type is written as any, which
+// requires Go 1.18 (and a package which does not declare any itself).
+func (trans *Transformer) useAny() bool {
+	return trans.targets(1, 18) && trans.Pkg.Scope().Lookup("any") == nil
+}
+
+// emptyInterface returns the expression for the empty interface type at pos,
+// any or interface{} (see useAny).
+func (trans *Transformer) emptyInterface(pos token.Pos) ast.Expr {
+	if trans.useAny() {
+		return &ast.Ident{NamePos: pos, Name: "any"}
+	}
+	// The braces need valid positions on the same line for the printer to
+	// keep interface{} on a single line.
+	return &ast.InterfaceType{
+		Interface: pos,
+		Methods:   &ast.FieldList{Opening: pos, Closing: pos},
+	}
+}
+
+// An Instance describes the usage of a generic declaration for which a
+// concrete declaration was generated.
+type Instance struct {
+	Decl  *types.GenericDecl
+	Usage types.ConcreteType
+}
+
+// InstanceOf reports the usage for which n was generated. n may be a
+// *ast.TypeSpec, a *ast.FuncDecl or a *ast.Field (for methods of an interface
+// type) in a file returned by trans.File.
+func (trans *Transformer) InstanceOf(n ast.Node) (Instance, bool) {
+	trans.namesMu.Lock()
+	defer trans.namesMu.Unlock()
+	inst, found := trans.instances[n]
+	return inst, found
+}
+
+// addInstance records that n was generated for the usage usg of decl.
+func (trans *Transformer) addInstance(n ast.Node, decl *types.GenericDecl, usg types.ConcreteType) {
+	trans.namesMu.Lock()
+	defer trans.namesMu.Unlock()
+	if trans.instances == nil {
+		trans.instances = map[ast.Node]Instance{}
+	}
+	trans.instances[n] = Instance{Decl: decl, Usage: usg}
+}
+
+// addRemoved records that n, a node of a generic declaration, was left out of
+// one of its instances, so that Renumber does not count its lines as line
+// breaks.
+func (trans *Transformer) addRemoved(n ast.Node) {
+	trans.namesMu.Lock()
+	defer trans.namesMu.Unlock()
+	trans.removed = append(trans.removed, n)
+}
+
+// addOrigin records that n was generated from the node origin of the file
+// being transformed. If origin is itself a copy made for an instantiation, n
+// is recorded as generated from the node that was copied.
+func (trans *Transformer) addOrigin(n, origin ast.Node) {
+	trans.namesMu.Lock()
+	defer trans.namesMu.Unlock()
+	if trans.origins == nil {
+		trans.origins = map[ast.Node]ast.Node{}
+	}
+	if o, found := trans.origins[origin]; found {
+		origin = o
+	}
+	trans.origins[n] = origin
+}
+
+// cloneGeneric returns a copy of n, a generic declaration or a method of a
+// generic interface, which is made for one of its instantiations. The type
+// argument expressions of the copy are recorded as originating from those of
+// n, so that the concrete names which replace them can be traced back to n.
+func (trans *Transformer) cloneGeneric(n ast.Node) ast.Node {
+	clone := astclone.Clone(n)
+	var exprs []ast.Node
+	ast.Inspect(n, func(n ast.Node) bool {
+		switch n.(type) {
+		case *ast.TypeArgExpr, *ast.IndexExpr:
+			exprs = append(exprs, n)
+		}
+		return true
+	})
+	i := 0
+	ast.Inspect(clone, func(n ast.Node) bool {
+		switch n.(type) {
+		case *ast.TypeArgExpr, *ast.IndexExpr:
+			if i < len(exprs) {
+				trans.addOrigin(n, exprs[i])
+			}
+			i++
+		}
+		return true
+	})
+	return clone
 }
 
-func (trans *Transformer) File(f *ast.File) (*ast.File, error) {
+// File transforms f into Go code. The generic declarations of f are replaced by
+// a concrete declaration for each of their usages, and the type argument
+// expressions which instantiate them (e.g. Box[int]) by the names of the
+// concrete declarations (e.g. Box__int).
+//
+// File also returns the provenance of the nodes it generated, which links
+// each of them to the node of f it was generated from: the concrete
+// *ast.TypeSpec, *ast.FuncDecl or *ast.Field (for methods of an interface
+// type) to the generic one, and each concrete name to the type argument
+// expression it replaces, which may be in the body of a generic declaration.
+// The usage for which a declaration was generated is reported by InstanceOf;
+// the one of a type argument expression by the Types recorded in trans.Info.
+//
+// No code is generated for an instance of a generic function which is
+// specialized by a hand-written function with its name (e.g. Sum__float64 for
+// Sum[float64]). If the type of a specialization differs from that of the
+// instance, or if any other declaration has the name of an instance (such as
+// a type named Box__int or a method Map__string of the receiver type of a
+// generic method Map), File returns a scanner.ErrorList which reports it
+// instead of generating a duplicate declaration.
+//
+// Generated code which refers to types of packages that f does not import,
+// such as other.Thing in the instance Box__other_Thing of a generic type Box
+// used elsewhere, adds the imports of those packages. If the type arguments of
+// an instance are declared in a package which imports the package of f, which
+// would close an import cycle, File returns a scanner.ErrorList which reports
+// them at the usages. Both kinds of errors concern the whole package and are
+// found once by CheckPackage.
+//
+// The comments of the declarations which are deleted, such as generic
+// declarations without any usages, are removed from the resulting file.
+func (trans *Transformer) File(f *ast.File) (*ast.File, map[ast.Node]ast.Node, error) {
+	if err := trans.CheckPackage(); err != nil {
+		return nil, nil, err
+	}
+	trans.expandEnums(f)
+	trans.findEmbeddedFields(f)
+	trans.insertInferredTypeArgs(f)
+	trans.lowerOrderBuiltins(f)
+	trans.removeImplAssertions(f)
+	decls := append([]ast.Decl{}, f.Decls...)
 	withConcreteTypes := astutil.Apply(f, trans.generateConcreteTypes(), nil)
 	result := astutil.Apply(withConcreteTypes, trans.replaceGenericIdents(), nil)
 	resultFile, ok := result.(*ast.File)
 	if !ok {
 		panic(fmt.Errorf("astutil.Apply returned a non-file type: %T", result))
 	}
+	trans.resolveQualifiers(resultFile)
+	trans.blankUnusedImports(resultFile)
+	removeDeletedComments(resultFile, decls)
+
+	return resultFile, trans.provenance(resultFile), nil
+}
+
+// CheckPackage verifies that the code generated for the package can be
+// compiled as far as the package as a whole is concerned: no declaration may
+// clash with an instance (see File), and no instance may need an import which
+// would close an import cycle. The checks are only run once, and File returns
+// their result for each file of the package, so callers which transform
+// several files of a package should call CheckPackage first to report its
+// errors only once. The result is a scanner.ErrorList, or nil if there are no
+// errors.
+func (trans *Transformer) CheckPackage() error {
+	trans.checkOnce.Do(func() {
+		var errs scanner.ErrorList
+		for _, check := range []func() error{trans.checkSpecializations, trans.checkImportCycles} {
+			if list, ok := check().(scanner.ErrorList); ok {
+				errs = append(errs, list...)
+			}
+		}
+		errs.Sort()
+		trans.checkErr = errs.Err()
+	})
+	return trans.checkErr
+}
+
+// removeDeletedComments removes the comments of the declarations of decls,
+// the declarations of f before it was transformed, which are no longer in f
+// from f.Comments. Declarations which were replaced keep their position, so a
+// declaration was deleted if there is no declaration at its position.
+func removeDeletedComments(f *ast.File, decls []ast.Decl) {
+	kept := map[token.Pos]bool{}
+	for _, decl := range f.Decls {
+		kept[decl.Pos()] = true
+	}
+	var deleted []ast.Decl
+	for _, decl := range decls {
+		if !kept[decl.Pos()] {
+			deleted = append(deleted, decl)
+		}
+	}
+	if len(deleted) == 0 {
+		return
+	}
+	comments := make([]*ast.CommentGroup, 0, len(f.Comments))
+	for _, c := range f.Comments {
+		inDeleted := false
+		for _, decl := range deleted {
+			start := decl.Pos()
+			if doc := declDoc(decl); doc != nil {
+				start = doc.Pos()
+			}
+			inDeleted = inDeleted || c.Pos() >= start && c.End() <= decl.End()
+		}
+		if !inDeleted {
+			comments = append(comments, c)
+		}
+	}
+	f.Comments = comments
+}
+
+// provenance returns the origins of the nodes in f, which were generated by
+// trans.File.
+func (trans *Transformer) provenance(f *ast.File) map[ast.Node]ast.Node {
+	trans.namesMu.Lock()
+	defer trans.namesMu.Unlock()
+	provenance := map[ast.Node]ast.Node{}
+	ast.Inspect(f, func(n ast.Node) bool {
+		if origin, found := trans.origins[n]; found && origin.Pos().IsValid() {
+			provenance[n] = origin
+		}
+		return true
+	})
+	return provenance
+}
 
-	return resultFile, nil
+// blankUnusedImports turns imports which are no longer used in the transformed
+// file f into blank imports. This happens when a package is only used in type
+// arguments (e.g. lib.Box[bytes.Buffer] becomes lib.Box__bytes_Buffer) or in
+// generic declarations which are never instantiated. The import is kept rather
+// than removed so that the package is still initialized.
+//
+// The operands of selectors are only counted if they denote a package rather
+// than, say, a local variable which shadows it. The copies made for instances
+// are not in trans.Info, but keep the positions of the identifiers they copy,
+// so the packages are looked up by position. Identifiers without a position
+// are generated (e.g. the qualifiers of types, see resolveQualifiers), and
+// always denote packages.
+func (trans *Transformer) blankUnusedImports(f *ast.File) {
+	names := map[string]string{}
+	for _, imp := range trans.Pkg.Imports() {
+		names[imp.Path()] = imp.Name()
+	}
+	pkgNames := map[token.Pos]bool{}
+	for ident, obj := range trans.Info.Uses {
+		if _, ok := obj.(*types.PkgName); ok {
+			pkgNames[ident.NamePos] = true
+		}
+	}
+	used := map[string]bool{}
+	ast.Inspect(f, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if x, ok := sel.X.(*ast.Ident); ok && (!x.NamePos.IsValid() || pkgNames[x.NamePos]) {
+				used[x.Name] = true
+			}
+		}
+		return true
+	})
+	for _, decl := range f.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.IMPORT {
+			continue
+		}
+		for i, spec := range genDecl.Specs {
+			importSpec := spec.(*ast.ImportSpec)
+			path, err := strconv.Unquote(importSpec.Path.Value)
+			if err != nil {
+				continue
+			}
+			name, found := names[path]
+			if !found {
+				name = path[strings.LastIndex(path, "/")+1:]
+			}
+			if importSpec.Name != nil {
+				name = importSpec.Name.Name
+			}
+			if name == "_" || name == "." || used[name] {
+				continue
+			}
+			newSpec := *importSpec
+			newSpec.Name = &ast.Ident{NamePos: importSpec.Path.Pos(), Name: "_"}
+			genDecl.Specs[i] = &newSpec
+			for j, imp := range f.Imports {
+				if imp == importSpec {
+					f.Imports[j] = &newSpec
+				}
+			}
+		}
+	}
 }
 
 func (trans *Transformer) formatTypeArgs(args []ast.Expr) string {
 	result := ""
 	for i, arg := range args {
+		// A constant type argument is named by its value, like the concrete
+		// declaration (e.g. 4 for 0x4, 2+2 or a constant Size = 4).
+		if tv, found := trans.Info.Types[arg]; found && tv.Value != nil {
+			if i != 0 {
+				result += "__"
+			}
+			result += trans.typeToSafeString(types.NewConstArg(constant.ToInt(tv.Value)))
+			continue
+		}
 		// Check if the type argument is a type alias.
 		if ident, ok := arg.(*ast.Ident); ok {
 			if obj, found := trans.Info.Uses[ident]; found {
@@ -47,7 +395,7 @@ func (trans *Transformer) formatTypeArgs(args []ast.Expr) string {
 						if i != 0 {
 							result += "__"
 						}
-						result += typeToSafeString(typeName.Type().Underlying())
+						result += trans.typeToSafeString(typeName.Type().Underlying())
 						continue
 					}
 				}
@@ -57,33 +405,72 @@ func (trans *Transformer) formatTypeArgs(args []ast.Expr) string {
 		if i != 0 {
 			result += "__"
 		}
-		result += exprToSafeString(arg)
+		result += trans.exprToSafeString(withoutParamNames(trans.packageQualified(arg)))
 	}
 	return result
 }
 
-// TODO(albrow): this could be optimized
+// concreteTypeName returns the name of the concrete declaration generated from
+// decl for the usage usg. Names are computed once per usage, since each one is
+// needed for the declaration itself as well as for each of its methods.
 func (trans *Transformer) concreteTypeName(decl *types.GenericDecl, usg types.ConcreteType) string {
-	stringParams := []string{}
-	for _, param := range decl.Type.TypeParams() {
-		typ := usg.TypeMap()[param.String()]
-		stringParams = append(stringParams, typeToSafeString(typ))
+	trans.namesMu.Lock()
+	name, found := trans.names[usg]
+	trans.namesMu.Unlock()
+	if found {
+		return name
+	}
+	name = trans.instanceName(decl, usg)
+	if sig, ok := decl.Type.(*types.GenericSignature); !ok || sig.Recv() == nil {
+		// Generic methods keep their names (see findUnexportedNames).
+		name = trans.localName(name)
 	}
-	if len(stringParams) == 0 {
+	trans.namesMu.Lock()
+	defer trans.namesMu.Unlock()
+	if trans.names == nil {
+		trans.names = map[types.ConcreteType]string{}
+	}
+	trans.names[usg] = name
+	return name
+}
+
+// instanceName returns the default name of the concrete declaration generated
+// from decl for the usage usg, which is made of the name of decl and the
+// type arguments of usg (e.g. Box__int for Box[int]).
+func (trans *Transformer) instanceName(decl *types.GenericDecl, usg types.ConcreteType) string {
+	params := decl.Type.TypeParams()
+	if len(params) == 0 {
 		return decl.Name
 	}
-	return decl.Name + "__" + strings.Join(stringParams, "__")
+	buf := &strings.Builder{}
+	buf.WriteString(decl.Name)
+	for _, param := range params {
+		buf.WriteString("__")
+		buf.WriteString(trans.typeToSafeString(usg.TypeMap()[param.String()]))
+	}
+	return buf.String()
+}
+
+// concreteIdent returns the name of the concrete declaration generated from
+// the generic declaration named by ident. The new identifier keeps the position
+// of ident so that types.Info.OriginOf can find the generic object.
+func (trans *Transformer) concreteIdent(ident *ast.Ident, decl *types.GenericDecl, usg types.ConcreteType) *ast.Ident {
+	return &ast.Ident{NamePos: ident.NamePos, Name: trans.concreteTypeName(decl, usg)}
 }
 
 func (trans *Transformer) concreteTypeExpr(e *ast.TypeArgExpr) ast.Node {
 	switch x := e.X.(type) {
 	case *ast.Ident:
 		newIdent := astclone.Clone(x).(*ast.Ident)
-		newIdent.Name = newIdent.Name + "__" + trans.formatTypeArgs(e.Types)
+		newIdent.Name = trans.localName(newIdent.Name + "__" + trans.formatTypeArgs(e.Types))
 		return newIdent
 	case *ast.SelectorExpr:
+		// The operand is cloned along with the selector, so any generic
+		// identifiers in it (e.g. in f[int]().Map[string]) are replaced
+		// first.
+		x.X = astutil.Apply(x.X, trans.replaceGenericIdents(), nil).(ast.Expr)
 		newSel := astclone.Clone(x).(*ast.SelectorExpr)
-		newSel.Sel = ast.NewIdent(newSel.Sel.Name + "__" + trans.formatTypeArgs(e.Types))
+		newSel.Sel = &ast.Ident{NamePos: x.Sel.NamePos, Name: x.Sel.Name + "__" + trans.formatTypeArgs(e.Types)}
 		return newSel
 	default:
 		panic(fmt.Errorf("type arguments for expr %v of type %T are not yet supported", e.X, e.X))
@@ -93,7 +480,7 @@ func (trans *Transformer) concreteTypeExpr(e *ast.TypeArgExpr) ast.Node {
 func (trans *Transformer) recvTypeParams(typeParams []*types.TypeParam, typeMap map[string]types.Type) []ast.Expr {
 	types := []ast.Expr{}
 	for _, param := range typeParams {
-		types = append(types, typeToExpr(typeMap[param.String()]))
+		types = append(types, trans.typeToExpr(typeMap[param.String()]))
 	}
 	if len(types) > 0 {
 		return types
@@ -105,6 +492,10 @@ func (trans *Transformer) recvTypeParams(typeParams []*types.TypeParam, typeMap
 // expandReceiverType adds the appropriate type parameters to a receiver type
 // if they were not included in the original source code.
 func (trans *Transformer) expandReceiverType(funcDecl *ast.FuncDecl, genDecl *types.GenericDecl, usg types.ConcreteType) {
+	if genDecl == nil {
+		// The receiver type is not generic.
+		return
+	}
 	astutil.Apply(funcDecl.Recv, func(c *astutil.Cursor) bool {
 		switch n := c.Node().(type) {
 		case *ast.TypeArgExpr:
@@ -112,12 +503,7 @@ func (trans *Transformer) expandReceiverType(funcDecl *ast.FuncDecl, genDecl *ty
 			return false
 		case *ast.Ident:
 			if n.Name == genDecl.Name {
-				c.Replace(&ast.TypeArgExpr{
-					X:      ast.NewIdent(n.Name),
-					Lbrack: token.NoPos,
-					Types:  trans.recvTypeParams(genDecl.Type.TypeParams(), usg.TypeMap()),
-					Rbrack: token.NoPos,
-				})
+				c.Replace(ast.NewTypeArgExpr(ast.NewIdent(n.Name), trans.recvTypeParams(genDecl.Type.TypeParams(), usg.TypeMap())...))
 			}
 		}
 		return true
@@ -138,27 +524,27 @@ func (trans *Transformer) generateConcreteTypes() func(c *astutil.Cursor) bool {
 					continue
 				}
 				if _, found := trans.Pkg.Generics()[typeSpec.Name.Name]; !found {
-					newTypeSpecs = append(newTypeSpecs, typeSpec)
+					newTypeSpecs = append(newTypeSpecs, trans.expandInterfaceMethods(typeSpec))
 					used = true
 					continue
 				}
-				newTypeSpecs = append(newTypeSpecs, trans.generateTypeSpecs(typeSpec)...)
+				instances := trans.generateTypeSpecs(typeSpec)
+				if trans.SourceOrder {
+					sortTypeSpecs(instances)
+				}
+				newTypeSpecs = append(newTypeSpecs, instances...)
 			}
 			if len(newTypeSpecs) > 0 {
-				sort.Slice(newTypeSpecs, func(i int, j int) bool {
-					iSpec, ok := newTypeSpecs[i].(*ast.TypeSpec)
-					if !ok {
-						return true
-					}
-					jSpec, ok := newTypeSpecs[j].(*ast.TypeSpec)
-					if !ok {
-						return true
-					}
-					return iSpec.Name.Name < jSpec.Name.Name
-				})
-				newDecl := astclone.Clone(n).(*ast.GenDecl)
+				// Only type declarations are sorted; the order of constants
+				// matters because of iota.
+				if n.Tok == token.TYPE && !trans.SourceOrder {
+					sortTypeSpecs(newTypeSpecs)
+				}
+				// The specs are replaced, so the rest of the declaration
+				// needs no deep copy.
+				newDecl := *n
 				newDecl.Specs = newTypeSpecs
-				c.Replace(newDecl)
+				c.Replace(&newDecl)
 			} else if !used {
 				c.Delete()
 			}
@@ -180,17 +566,26 @@ func (trans *Transformer) generateConcreteTypes() func(c *astutil.Cursor) bool {
 	}
 }
 
+// sortTypeSpecs sorts specs, which are type specs, by name.
+func sortTypeSpecs(specs []ast.Spec) {
+	sort.SliceStable(specs, func(i int, j int) bool {
+		return specs[i].(*ast.TypeSpec).Name.Name < specs[j].(*ast.TypeSpec).Name.Name
+	})
+}
+
+// sortFuncs sorts funcs by name. Functions with the same name are methods
+// generated for different receivers, so they are ordered by the type of their
+// receiver (e.g. (*Box__int).Set comes before (*Box__string).Set).
 func sortFuncs(funcs []*ast.FuncDecl) {
-	sort.Slice(funcs, func(i int, j int) bool {
+	recvs := make(map[*ast.FuncDecl]string, len(funcs))
+	for _, f := range funcs {
+		if f.Recv != nil && len(f.Recv.List) > 0 {
+			recvs[f] = types.ExprString(f.Recv.List[0].Type)
+		}
+	}
+	sort.SliceStable(funcs, func(i int, j int) bool {
 		if funcs[i].Name.Name == funcs[j].Name.Name {
-			// If the two function names are the same, they must have different
-			// receivers. There's lots of edge cases to consider, so as a shortcut
-			// we use printer.Fprint to convert each FuncDecl to a string.
-			// TODO(albrow): optimize this
-			iBuff, jBuff := &bytes.Buffer{}, &bytes.Buffer{}
-			_ = printer.Fprint(iBuff, token.NewFileSet(), funcs[i])
-			_ = printer.Fprint(jBuff, token.NewFileSet(), funcs[j])
-			return iBuff.String() < jBuff.String()
+			return recvs[funcs[i]] < recvs[funcs[j]]
 		}
 		return funcs[i].Name.Name < funcs[j].Name.Name
 	})
@@ -198,56 +593,85 @@ func sortFuncs(funcs []*ast.FuncDecl) {
 
 func (trans *Transformer) replaceGenericIdents() func(c *astutil.Cursor) bool {
 	return func(c *astutil.Cursor) bool {
+		// replace replaces the current node, the type argument expression e or
+		// an IndexExpr which was upgraded to e, with the concrete name.
+		replace := func(e *ast.TypeArgExpr) {
+			concrete := trans.concreteTypeExpr(e)
+			trans.addOrigin(concrete, c.Node())
+			c.Replace(concrete)
+		}
 		switch n := c.Node().(type) {
 		case *ast.TypeArgExpr:
-			c.Replace(trans.concreteTypeExpr(n))
+			if trans.nativeGeneric(n.X) {
+				// Only the type arguments may need to be replaced.
+				break
+			}
+			replace(n)
 		case *ast.IndexExpr:
-			// Check if we are dealing with an ambiguous IndexExpr from the parser. In
-			// some cases we need to disambiguate this by upgrading to a
-			// TypeArgExpr.
-			switch x := n.X.(type) {
-			case *ast.Ident:
-				if _, found := trans.Pkg.Generics()[x.Name]; found {
-					typeArgExpr := &ast.TypeArgExpr{
-						X:      n.X,
-						Lbrack: n.Lbrack,
-						Types:  []ast.Expr{n.Index},
-						Rbrack: n.Rbrack,
-					}
-					c.Replace(trans.concreteTypeExpr(typeArgExpr))
-				}
-			case *ast.SelectorExpr:
-				selection, found := trans.Info.Selections[x]
-				if !found {
-					return true
-				}
-				var key string
-				switch selection.Kind() {
-				case types.FieldVal:
-					key = selection.Obj().Name()
-				case types.MethodVal:
-					if named, ok := selection.Recv().(*types.ConcreteNamed); ok {
-						key = named.Obj().Name() + "." + selection.Obj().Name()
-					}
-				}
-				if key != "" {
-					if _, found := trans.Pkg.Generics()[key]; found {
-						typeArgExpr := &ast.TypeArgExpr{
-							X:      n.X,
-							Lbrack: n.Lbrack,
-							Types:  []ast.Expr{n.Index},
-							Rbrack: n.Rbrack,
-						}
-						c.Replace(trans.concreteTypeExpr(typeArgExpr))
-						return false
-					}
-				}
+			// The parser cannot tell a type argument expression with a single
+			// type argument apart from an index expression, but the Checker
+			// can.
+			if !trans.isTypeArgExpr(n) || trans.nativeGeneric(n.X) {
+				break
 			}
+			replace(typeArgExprOf(n))
+			return false
 		}
 		return true
 	}
 }
 
+// isTypeArgExpr reports whether n, an IndexExpr of the file being transformed
+// or a copy of one made by cloneGeneric, was resolved as a type argument
+// expression by the Checker (see types.Info.TypeArgs).
+func (trans *Transformer) isTypeArgExpr(n *ast.IndexExpr) bool {
+	trans.namesMu.Lock()
+	origin, found := trans.origins[n]
+	trans.namesMu.Unlock()
+	if found {
+		n, _ = origin.(*ast.IndexExpr)
+	}
+	_, found = trans.Info.TypeArgs[n]
+	return found
+}
+
+// typeArgExprOf returns the type argument expression for n, an IndexExpr
+// which the parser could not tell apart from one, e.g. Box[int].
+func typeArgExprOf(n *ast.IndexExpr) *ast.TypeArgExpr {
+	expr := ast.NewTypeArgExpr(n.X, n.Index)
+	expr.Lbrack, expr.Rbrack = n.Lbrack, n.Rbrack
+	return expr
+}
+
+// nativeGeneric reports whether x, the operand of a type argument expression,
+// is a qualified identifier for a generic declaration imported from the export
+// data of a Go package (see types.AddNativeGeneric). Instantiations of such
+// declarations are kept as they are, since the Go compiler handles them.
+func (trans *Transformer) nativeGeneric(x ast.Expr) bool {
+	sel, ok := x.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	var pkg *types.Package
+	if obj, found := trans.Info.Uses[sel.Sel]; found {
+		pkg = obj.Pkg()
+	} else if id, ok := sel.X.(*ast.Ident); ok {
+		// Expressions generated from types (see objToExpr) are not recorded
+		// in Info.
+		for _, imp := range trans.Pkg.Imports() {
+			if imp.Name() == id.Name {
+				pkg = imp
+				break
+			}
+		}
+	}
+	if pkg == nil {
+		return false
+	}
+	decl, found := pkg.Generics()[sel.Sel.Name]
+	return found && decl.Native
+}
+
 func (trans *Transformer) generateTypeSpecs(typeSpec *ast.TypeSpec) []ast.Spec {
 	key := typeSpec.Name.Name
 	genericDecl, found := trans.Pkg.Generics()[key]
@@ -255,6 +679,7 @@ func (trans *Transformer) generateTypeSpecs(typeSpec *ast.TypeSpec) []ast.Spec {
 		panic(fmt.Errorf("could not find generic type declaration for %s", key))
 	}
 	var results []ast.Spec
+	origin := typeSpec
 	// Check if we are dealing with an ambiguous ArrayType from the parser. In
 	// some cases we need to disambiguate this by adding type parameters and
 	// changing the type.
@@ -262,25 +687,73 @@ func (trans *Transformer) generateTypeSpecs(typeSpec *ast.TypeSpec) []ast.Spec {
 		if arrayType, ok := typeSpec.Type.(*ast.ArrayType); ok {
 			if length, ok := arrayType.Len.(*ast.Ident); ok {
 				typeSpec = astclone.Clone(typeSpec).(*ast.TypeSpec)
-				typeSpec.TypeParams = &ast.TypeParamDecl{
-					Lbrack: arrayType.Lbrack,
-					Names:  []*ast.Ident{},
-					Rbrack: arrayType.Lbrack + token.Pos(len(length.Name)),
-				}
+				typeSpec.TypeParams = ast.NewTypeParamDecl(length)
 				typeSpec.Type = arrayType.Elt
 			}
 		}
 	}
 	for _, usg := range genericDecl.Usages {
-		newTypeSpec := astclone.Clone(typeSpec).(*ast.TypeSpec)
-		newTypeSpec.Name = ast.NewIdent(trans.concreteTypeName(genericDecl, usg))
+		newTypeSpec := trans.cloneGeneric(typeSpec).(*ast.TypeSpec)
+		newTypeSpec.Name = trans.concreteIdent(typeSpec.Name, genericDecl, usg)
 		newTypeSpec.TypeParams = nil
 		trans.replaceIdentsInScope(newTypeSpec, usg.TypeMap())
+		trans.addInstance(newTypeSpec, genericDecl, usg)
+		trans.addOrigin(newTypeSpec, origin)
 		results = append(results, newTypeSpec)
 	}
 	return results
 }
 
+// expandInterfaceMethods replaces each method of an interface type which
+// declares its own type parameters with one concrete method for each usage.
+func (trans *Transformer) expandInterfaceMethods(typeSpec *ast.TypeSpec) *ast.TypeSpec {
+	iface, ok := typeSpec.Type.(*ast.InterfaceType)
+	if !ok || iface.Methods == nil {
+		return typeSpec
+	}
+	hasGenericMethods := false
+	for _, field := range iface.Methods.List {
+		if ftyp, ok := field.Type.(*ast.FuncType); ok && ftyp.TypeParams != nil {
+			hasGenericMethods = true
+		}
+	}
+	if !hasGenericMethods {
+		return typeSpec
+	}
+	newTypeSpec := astclone.Clone(typeSpec).(*ast.TypeSpec)
+	newIface := newTypeSpec.Type.(*ast.InterfaceType)
+	var methods []*ast.Field
+	for i, field := range newIface.Methods.List {
+		ftyp, ok := field.Type.(*ast.FuncType)
+		if !ok || ftyp.TypeParams == nil {
+			methods = append(methods, field)
+			continue
+		}
+		key := typeSpec.Name.Name + "." + field.Names[0].Name
+		genDecl, found := trans.Pkg.Generics()[key]
+		if !found {
+			panic(fmt.Errorf("could not find generic method declaration for %s", key))
+		}
+		var newMethods []*ast.Field
+		for _, usg := range genDecl.Usages {
+			origin := iface.Methods.List[i]
+			newMethod := trans.cloneGeneric(origin).(*ast.Field)
+			newMethod.Names = []*ast.Ident{trans.concreteIdent(field.Names[0], genDecl, usg)}
+			newMethod.Type.(*ast.FuncType).TypeParams = nil
+			trans.replaceIdentsInScope(newMethod.Type, usg.TypeMap())
+			trans.addInstance(newMethod, genDecl, usg)
+			trans.addOrigin(newMethod, origin)
+			newMethods = append(newMethods, newMethod)
+		}
+		sort.Slice(newMethods, func(i int, j int) bool {
+			return newMethods[i].Names[0].Name < newMethods[j].Names[0].Name
+		})
+		methods = append(methods, newMethods...)
+	}
+	newIface.Methods.List = methods
+	return newTypeSpec
+}
+
 func (trans *Transformer) generateFuncDecls(funcDecl *ast.FuncDecl) (newFuncs []*ast.FuncDecl, recvIsGeneric bool) {
 	var recv ast.Expr
 	recvHasTypeArgs := false
@@ -306,7 +779,7 @@ func (trans *Transformer) generateFuncDecls(funcDecl *ast.FuncDecl) (newFuncs []
 		genRecvDecl, found = trans.Pkg.Generics()[recvTypeName.Name]
 		if !found && recvHasTypeArgs {
 			panic(fmt.Errorf("could not find generic type declaration for %s", recvTypeName.Name))
-		} else {
+		} else if found {
 			recvIsGeneric = true
 		}
 	}
@@ -318,31 +791,189 @@ func (trans *Transformer) generateFuncDecls(funcDecl *ast.FuncDecl) (newFuncs []
 	if !found && funcDecl.TypeParams != nil {
 		panic(fmt.Errorf("could not find generic type declaration for %s", fkey))
 	}
+	var operands map[token.Pos]types.Type
+	if genFuncDecl != nil || genRecvDecl != nil {
+		operands = trans.assertionOperands(funcDecl)
+	}
 	if genFuncDecl != nil {
 		for _, usg := range genFuncDecl.Usages {
-			newFunc := astclone.Clone(funcDecl).(*ast.FuncDecl)
+			if trans.specialization(genFuncDecl, usg) != nil {
+				continue
+			}
+			newFunc := trans.cloneGeneric(funcDecl).(*ast.FuncDecl)
 			trans.expandReceiverType(newFunc, genRecvDecl, usg)
-			newFunc.Name = ast.NewIdent(trans.concreteTypeName(genFuncDecl, usg))
+			newFunc.Name = trans.concreteIdent(funcDecl.Name, genFuncDecl, usg)
 			newFunc.TypeParams = nil
+			trans.renameEmbeddedFields(newFunc, usg.TypeMap())
 			trans.replaceIdentsInScope(newFunc, usg.TypeMap())
+			trans.fixTypeAssertions(newFunc, operands, usg.TypeMap())
+			trans.addInstance(newFunc, genFuncDecl, usg)
+			trans.addOrigin(newFunc, funcDecl)
 			newFuncs = append(newFuncs, newFunc)
 		}
 	} else if genRecvDecl != nil {
 		for _, usg := range genRecvDecl.Usages {
-			newFunc := astclone.Clone(funcDecl).(*ast.FuncDecl)
+			newFunc := trans.cloneGeneric(funcDecl).(*ast.FuncDecl)
 			trans.expandReceiverType(newFunc, genRecvDecl, usg)
+			trans.renameEmbeddedFields(newFunc, usg.TypeMap())
 			trans.replaceIdentsInScope(newFunc, usg.TypeMap())
+			trans.fixTypeAssertions(newFunc, operands, usg.TypeMap())
+			trans.addInstance(newFunc, genRecvDecl, usg)
+			trans.addOrigin(newFunc, funcDecl)
 			newFuncs = append(newFuncs, newFunc)
 		}
 	}
 	return newFuncs, recvIsGeneric
 }
 
+// exprType returns the type of x as recorded by the type checker, or nil if it
+// is not known.
+func (trans *Transformer) exprType(x ast.Expr) types.Type {
+	if tv, found := trans.Info.Types[x]; found {
+		return tv.Type
+	}
+	if ident, ok := x.(*ast.Ident); ok {
+		if obj, found := trans.Info.Uses[ident]; found {
+			return obj.Type()
+		}
+	}
+	return nil
+}
+
+// assertionOperands returns the types of the operands of the type assertions
+// in n, which include the guards of type switches, by the positions of their
+// left parentheses.
+func (trans *Transformer) assertionOperands(n ast.Node) map[token.Pos]types.Type {
+	operands := map[token.Pos]types.Type{}
+	ast.Inspect(n, func(n ast.Node) bool {
+		if assert, ok := n.(*ast.TypeAssertExpr); ok {
+			if typ := trans.exprType(assert.X); typ != nil {
+				operands[assert.Lparen] = typ
+			}
+		}
+		return true
+	})
+	return operands
+}
+
+// fixTypeAssertions makes the type assertions and type switches in a function
+// which was just instantiated with concrete types valid Go.
+//
+// operands holds the types of the operands of the assertions in the generic
+// function, as returned by assertionOperands, and typeMap the type arguments
+// of the instance. The operand of each assertion whose type is a type
+// parameter is converted to the empty interface, since after replacing the
+// type parameter it may no longer be an interface type.
+//
+// Type switch cases which became duplicates because a type parameter was
+// replaced with a type already listed in an earlier case are removed. Just
+// like for the generic function, the first matching case is the one selected.
+// If the switch declares a variable, which has the type of the operand in a
+// clause listing several types, a clause left with a single type which refers
+// to the variable declares it again with the type of the operand, e.g. with
+// { v := interface{}(v); ... } for case T, string with T = string, so that it
+// does not become a string.
+func (trans *Transformer) fixTypeAssertions(n ast.Node, operands map[token.Pos]types.Type, typeMap map[string]types.Type) {
+	astutil.Apply(n, func(c *astutil.Cursor) bool {
+		switch n := c.Node().(type) {
+		case *ast.TypeAssertExpr:
+			if _, ok := operands[n.Lparen].(*types.TypeParam); ok {
+				n.X = &ast.CallExpr{
+					Fun:  trans.emptyInterface(n.Lparen),
+					Args: []ast.Expr{n.X},
+				}
+			}
+		case *ast.TypeSwitchStmt:
+			var symbol *ast.Ident
+			var operand types.Type
+			if assign, ok := n.Assign.(*ast.AssignStmt); ok {
+				symbol = assign.Lhs[0].(*ast.Ident)
+				operand = operands[assign.Rhs[0].(*ast.TypeAssertExpr).Lparen]
+			}
+			seen := map[string]struct{}{}
+			var clauses []ast.Stmt
+			for _, stmt := range n.Body.List {
+				clause := stmt.(*ast.CaseClause)
+				if clause.List == nil {
+					// The default clause.
+					clauses = append(clauses, clause)
+					continue
+				}
+				var list []ast.Expr
+				for _, typ := range clause.List {
+					key := types.ExprString(typ)
+					if _, found := seen[key]; found {
+						continue
+					}
+					seen[key] = struct{}{}
+					list = append(list, typ)
+				}
+				if len(list) == 0 {
+					trans.addRemoved(clause)
+					continue
+				}
+				if operand != nil && len(clause.List) > 1 && len(list) == 1 && refersTo(clause.Body, symbol.Name) {
+					redecl := &ast.AssignStmt{
+						Lhs: []ast.Expr{ast.NewIdent(symbol.Name)},
+						Tok: token.DEFINE,
+						Rhs: []ast.Expr{&ast.CallExpr{
+							Fun:  trans.operandTypeExpr(operand, typeMap, clause.Colon),
+							Args: []ast.Expr{ast.NewIdent(symbol.Name)},
+						}},
+					}
+					// The variable is declared in the block of the clause,
+					// so it can only be declared again in a nested one.
+					clause.Body = []ast.Stmt{&ast.BlockStmt{
+						List: append([]ast.Stmt{redecl}, clause.Body...),
+					}}
+				}
+				clause.List = list
+				clauses = append(clauses, clause)
+			}
+			n.Body.List = clauses
+		}
+		return true
+	}, nil)
+}
+
+// operandTypeExpr returns the type of the operand of a type switch in an
+// instance with the type arguments typeMap, given the type typ of the operand
+// in the generic function. An operand of a type parameter type is converted to
+// the empty interface (see fixTypeAssertions).
+func (trans *Transformer) operandTypeExpr(typ types.Type, typeMap map[string]types.Type, pos token.Pos) ast.Expr {
+	if _, ok := typ.(*types.TypeParam); ok {
+		return trans.emptyInterface(pos)
+	}
+	if iface, ok := typ.(*types.Interface); ok && iface.Empty() {
+		return trans.emptyInterface(pos)
+	}
+	return trans.replaceIdentsInScope(trans.typeToExpr(typ), typeMap).(ast.Expr)
+}
+
+// refersTo reports whether one of stmts refers to name, other than as the
+// selector of a selector expression.
+func refersTo(stmts []ast.Stmt, name string) bool {
+	found := false
+	for _, stmt := range stmts {
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.SelectorExpr:
+				found = found || refersTo([]ast.Stmt{&ast.ExprStmt{X: n.X}}, name)
+				return false
+			case *ast.Ident:
+				found = found || n.Name == name
+			}
+			return !found
+		})
+	}
+	return found
+}
+
 func (trans *Transformer) replaceIdentsInScope(n ast.Node, typeMap map[string]types.Type) ast.Node {
 	return astutil.Apply(n, nil, func(c *astutil.Cursor) bool {
 		if ident, ok := c.Node().(*ast.Ident); ok {
 			if typ, found := typeMap[ident.Name]; found {
-				c.Replace(typeToExpr(typ))
+				c.Replace(trans.typeToExpr(typ))
 			}
 		}
 		return true
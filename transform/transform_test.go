@@ -2,6 +2,9 @@ package transform
 
 import (
 	"bytes"
+	"fmt"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -9,7 +12,9 @@ import (
 	"github.com/qProust/fo/format"
 	"github.com/qProust/fo/importer"
 	"github.com/qProust/fo/parser"
+	"github.com/qProust/fo/scanner"
 	"github.com/qProust/fo/token"
+	"github.com/qProust/fo/transform/internal/checktest"
 	"github.com/qProust/fo/types"
 	"github.com/aryann/difflib"
 )
@@ -253,6 +258,187 @@ func main() {
 	testParseFile(t, src, expected)
 }
 
+func TestTransformTypeParamSwitch(t *testing.T) {
+	src := `package main
+
+type Box[T] struct {
+	val T
+}
+
+func Unbox[T](x interface{}) T {
+	switch b := x.(type) {
+	case Box[T]:
+		return b.val
+	case T:
+		return b
+	case int:
+		var zero T
+		return zero
+	}
+	return x.(*Box[T]).val
+}
+
+func Cast[T, U](x T) U {
+	return x.(U)
+}
+
+func main() {
+	_ = Unbox[int](nil)
+	_ = Unbox[string](nil)
+	_ = Cast[int, string](0)
+}
+`
+
+	expected := `package main
+
+type (
+	Box__int struct {
+		val int
+	}
+	Box__string struct {
+		val string
+	}
+)
+
+func Unbox__int(x interface{}) int {
+	switch b := x.(type) {
+	case Box__int:
+		return b.val
+	case int:
+		return b
+	}
+	return x.(*Box__int).val
+}
+
+func Unbox__string(x interface{}) string {
+	switch b := x.(type) {
+	case Box__string:
+		return b.val
+	case string:
+		return b
+	case int:
+		var zero string
+		return zero
+	}
+	return x.(*Box__string).val
+}
+
+func Cast__int__string(x int) string {
+	return interface{}(x).(string)
+}
+
+func main() {
+	_ = Unbox__int(nil)
+	_ = Unbox__string(nil)
+	_ = Cast__int__string(0)
+}
+`
+
+	testParseFile(t, src, expected)
+}
+
+func TestTransformTypeParamSwitchVar(t *testing.T) {
+	src := `package main
+
+type Getter interface {
+	Get() int
+}
+
+type Impl struct{}
+
+func (*Impl) Get() int { return 0 }
+
+func Describe[T](x interface{}) string {
+	switch v := x.(type) {
+	case T, string:
+		_, ok := v.(string)
+		if ok {
+			return "string"
+		}
+		return "T"
+	case []T, []string:
+		return "slice"
+	}
+	return "other"
+}
+
+func Get[T](g Getter) int {
+	switch v := g.(type) {
+	case T, *Impl:
+		return v.Get()
+	}
+	return 0
+}
+
+func main() {
+	_ = Describe[string](nil)
+	_ = Describe[int](nil)
+	_ = Get[*Impl](nil)
+}
+`
+
+	expected := `package main
+
+type Getter interface {
+	Get() int
+}
+
+type Impl struct{}
+
+func (*Impl) Get() int { return 0 }
+
+func Describe__int(x interface{}) string {
+	switch v := x.(type) {
+	case int, string:
+		_, ok := v.(string)
+		if ok {
+			return "string"
+		}
+		return "T"
+	case []int, []string:
+		return "slice"
+	}
+	return "other"
+}
+
+func Describe__string(x interface{}) string {
+	switch v := x.(type) {
+	case string:
+		{
+			v := interface{}(v)
+			_, ok := v.(string)
+			if ok {
+				return "string"
+			}
+			return "T"
+		}
+	case []string:
+		return "slice"
+	}
+	return "other"
+}
+
+func Get___Impl(g Getter) int {
+	switch v := g.(type) {
+	case *Impl:
+		{
+			v := Getter(v)
+			return v.Get()
+		}
+	}
+	return 0
+}
+
+func main() {
+	_ = Describe__string(nil)
+	_ = Describe__int(nil)
+	_ = Get___Impl(nil)
+}
+`
+
+	testParseFile(t, src, expected)
+}
+
 func TestTransformFuncDecl(t *testing.T) {
 	src := `package main
 
@@ -281,6 +467,7 @@ import "fmt"
 func Print__int(t int) {
 	fmt.Println(t)
 }
+
 func Print__string(t string) {
 	fmt.Println(t)
 }
@@ -300,6 +487,125 @@ func main() {
 	testParseFile(t, src, expected)
 }
 
+func TestTransformShadowedGeneric(t *testing.T) {
+	src := `package main
+
+type Box[T] struct {
+	v T
+}
+
+func Get[T](b Box[T]) T {
+	return b.v
+}
+
+func main() {
+	_ = Get[int](Box[int]{v: 1})
+	Get := []int{1, 2}
+	_ = Get[1]
+	for _, Box := range []map[string]int{nil} {
+		_ = Box["x"]
+	}
+}
+`
+
+	expected := `package main
+
+type Box__int struct {
+	v int
+}
+
+func Get__int(b Box__int) int {
+	return b.v
+}
+
+func main() {
+	_ = Get__int(Box__int{v: 1})
+	Get := []int{1, 2}
+	_ = Get[1]
+	for _, Box := range []map[string]int{nil} {
+		_ = Box["x"]
+	}
+}
+`
+
+	testParseFile(t, src, expected)
+}
+
+func TestTransformEmbeddedGenericField(t *testing.T) {
+	src := `package main
+
+type Box[T] struct {
+	v T
+}
+
+func (b Box[T]) Get() T {
+	return b.v
+}
+
+type Outer struct {
+	Box[int]
+	name string
+}
+
+type Wrapper[U] struct {
+	*Box[U]
+}
+
+func (w Wrapper[U]) Inner() Box[U] {
+	return *w.Box
+}
+
+func main() {
+	o := Outer{Box: Box[int]{v: 1}}
+	_ = o.Get() + o.Box.Get() + o.v
+	w := Wrapper[string]{Box: &Box[string]{}}
+	_ = w.Get() + w.Inner().v
+}
+`
+
+	expected := `package main
+
+type (
+	Box__int struct {
+		v int
+	}
+	Box__string struct {
+		v string
+	}
+)
+
+func (b Box__int) Get() int {
+	return b.v
+}
+
+func (b Box__string) Get() string {
+	return b.v
+}
+
+type Outer struct {
+	Box__int
+	name string
+}
+
+type Wrapper__string struct {
+	*Box__string
+}
+
+func (w Wrapper__string) Inner() Box__string {
+	return *w.Box__string
+}
+
+func main() {
+	o := Outer{Box__int: Box__int{v: 1}}
+	_ = o.Get() + o.Box__int.Get() + o.v
+	w := Wrapper__string{Box__string: &Box__string{}}
+	_ = w.Get() + w.Inner().v
+}
+`
+
+	testParseFile(t, src, expected)
+}
+
 func TestTransformStructTypeInherited(t *testing.T) {
 	src := `package main
 
@@ -570,10 +876,12 @@ func (A__bool) f0() bool {
 	var x bool
 	return x
 }
+
 func (A__string) f0() string {
 	var x string
 	return x
 }
+
 func (A__uint) f0() uint {
 	var x uint
 	return x
@@ -582,9 +890,11 @@ func (A__uint) f0() uint {
 func (a A__bool) f1() bool {
 	return bool(a)
 }
+
 func (a A__string) f1() string {
 	return string(a)
 }
+
 func (a A__uint) f1() uint {
 	return uint(a)
 }
@@ -595,9 +905,11 @@ func (a A__uint) f2__float64__int8() (uint, float64, int8) {
 	return uint(a), x, y
 }
 
-func (*A__bool) f3()   {}
+func (*A__bool) f3() {}
+
 func (*A__string) f3() {}
-func (*A__uint) f3()   {}
+
+func (*A__uint) f3() {}
 
 type (
 	B__int struct {
@@ -805,33 +1117,30 @@ type (
 	List___5_ast_Ident         [][5]ast.Ident
 	List____ast_Ident          [][]ast.Ident
 	List___ast_Ident           []*ast.Ident
-	List__ast_Ident            []ast.Ident
+	List__chan_ast_Ident       []chan ast.Ident
 	List__map_string_ast_Ident []map[string]ast.Ident
 )
 
 func NewList___5_ast_Ident() List___5_ast_Ident {
 	return List___5_ast_Ident{}
 }
+
 func NewList____ast_Ident() List____ast_Ident {
 	return List____ast_Ident{}
 }
+
 func NewList___ast_Ident() List___ast_Ident {
 	return List___ast_Ident{}
 }
-func NewList__ast_Ident() List__ast_Ident {
-	return List__ast_Ident{}
+
+func NewList__chan_ast_Ident() List__chan_ast_Ident {
+	return List__chan_ast_Ident{}
 }
+
 func NewList__map_string_ast_Ident() List__map_string_ast_Ident {
 	return List__map_string_ast_Ident{}
 }
 
-func (l List__ast_Ident) Head() ast.Ident {
-	if len(l) > 0 {
-		return l[0]
-	}
-	var x ast.Ident
-	return x
-}
 func (l List___ast_Ident) Head() *ast.Ident {
 	if len(l) > 0 {
 		return l[0]
@@ -839,6 +1148,7 @@ func (l List___ast_Ident) Head() *ast.Ident {
 	var x *ast.Ident
 	return x
 }
+
 func (l List___5_ast_Ident) Head() [5]ast.Ident {
 	if len(l) > 0 {
 		return l[0]
@@ -846,6 +1156,7 @@ func (l List___5_ast_Ident) Head() [5]ast.Ident {
 	var x [5]ast.Ident
 	return x
 }
+
 func (l List____ast_Ident) Head() []ast.Ident {
 	if len(l) > 0 {
 		return l[0]
@@ -853,6 +1164,15 @@ func (l List____ast_Ident) Head() []ast.Ident {
 	var x []ast.Ident
 	return x
 }
+
+func (l List__chan_ast_Ident) Head() chan ast.Ident {
+	if len(l) > 0 {
+		return l[0]
+	}
+	var x chan ast.Ident
+	return x
+}
+
 func (l List__map_string_ast_Ident) Head() map[string]ast.Ident {
 	if len(l) > 0 {
 		return l[0]
@@ -861,26 +1181,30 @@ func (l List__map_string_ast_Ident) Head() map[string]ast.Ident {
 	return x
 }
 
-func (l List__ast_Ident) Append(v ast.Ident) List__ast_Ident {
-	var result List__ast_Ident = make([]ast.Ident, len(l))
-	result = append(result, v)
-	return result
-}
 func (l List___ast_Ident) Append(v *ast.Ident) List___ast_Ident {
 	var result List___ast_Ident = make([]*ast.Ident, len(l))
 	result = append(result, v)
 	return result
 }
+
 func (l List___5_ast_Ident) Append(v [5]ast.Ident) List___5_ast_Ident {
 	var result List___5_ast_Ident = make([][5]ast.Ident, len(l))
 	result = append(result, v)
 	return result
 }
+
 func (l List____ast_Ident) Append(v []ast.Ident) List____ast_Ident {
 	var result List____ast_Ident = make([][]ast.Ident, len(l))
 	result = append(result, v)
 	return result
 }
+
+func (l List__chan_ast_Ident) Append(v chan ast.Ident) List__chan_ast_Ident {
+	var result List__chan_ast_Ident = make([]chan ast.Ident, len(l))
+	result = append(result, v)
+	return result
+}
+
 func (l List__map_string_ast_Ident) Append(v map[string]ast.Ident) List__map_string_ast_Ident {
 	var result List__map_string_ast_Ident = make([]map[string]ast.Ident, len(l))
 	result = append(result, v)
@@ -1026,6 +1350,7 @@ func F__float64__complex64() (float64, complex64) {
 func G____int() []int {
 	return H____int()
 }
+
 func G__string() string {
 	return H__string()
 }
@@ -1033,6 +1358,7 @@ func G__string() string {
 func H____int() []int {
 	return G____int()
 }
+
 func H__string() string {
 	return G__string()
 }
@@ -1097,63 +1423,99 @@ type (
 		val ****string
 	}
 	Box______string_0 struct {
-		val []**string
+		val **[]string
 	}
 	Box______string_1 struct {
-		val **[]string
+		val []**string
 	}
 	Box______string_2 struct {
 		val [][]string
 	}
 	Box____string struct {
-		val []string
+		val **string
 	}
 	Box____string_0 struct {
-		val **string
+		val []string
 	}
 )
 
 func main() {
-	var _ = Box____string_0{}
 	var _ = Box____string{}
+	var _ = Box____string_0{}
 	var _ = Box______string{}
-	var _ = Box______string_0{}
 	var _ = Box______string_1{}
+	var _ = Box______string_0{}
 	var _ = Box______string_2{}
 }
 `
 	testParseFile(t, src, expected)
 }
 
-func testParseFile(t *testing.T, src string, expected string) {
-	t.Helper()
-	fset := token.NewFileSet()
-	orig, err := parser.ParseFile(fset, "transform_test", src, 0)
-	if err != nil {
-		t.Fatalf("ParseFile returned error: %s", err.Error())
+// The suffixes of colliding names only depend on the colliding type strings,
+// so using the same instantiations in a different order does not change
+// their names.
+func TestTransformSafeStringCollisionsOrder(t *testing.T) {
+	src := `package main
+
+type Box[T] struct{
+	val T
+}
+
+func main() {
+	var _ = Box[[][]string]{}
+	var _ = Box[**[]string]{}
+	var _ = Box[[]**string]{}
+	var _ = Box[****string]{}
+	var _ = Box[[]string]{}
+	var _ = Box[**string]{}
+}
+`
+
+	expected := `package main
+
+type (
+	Box______string struct {
+		val ****string
 	}
-	conf := types.Config{}
-	conf.Importer = importer.Default()
-	info := &types.Info{
-		Selections: map[*ast.SelectorExpr]*types.Selection{},
-		Uses:       map[*ast.Ident]types.Object{},
+	Box______string_0 struct {
+		val **[]string
 	}
-	pkg, err := conf.Check("transformtest", fset, []*ast.File{orig}, info)
-	if err != nil {
-		t.Fatalf("conf.Check returned error: %s", err.Error())
+	Box______string_1 struct {
+		val []**string
 	}
-	trans := &Transformer{
-		Fset: fset,
-		Pkg:  pkg,
-		Info: info,
+	Box______string_2 struct {
+		val [][]string
 	}
-	transformed, err := trans.File(orig)
-	if err != nil {
-		t.Fatalf("Transform returned error: %s", err.Error())
+	Box____string struct {
+		val **string
 	}
-	output := bytes.NewBuffer(nil)
-	if err := format.Node(output, fset, transformed); err != nil {
-		t.Fatalf("format.Node returned error: %s", err.Error())
+	Box____string_0 struct {
+		val []string
+	}
+)
+
+func main() {
+	var _ = Box______string_2{}
+	var _ = Box______string_0{}
+	var _ = Box______string_1{}
+	var _ = Box______string{}
+	var _ = Box____string_0{}
+	var _ = Box____string{}
+}
+`
+	testParseFile(t, src, expected)
+}
+
+// testParseFile transforms src, which may import packages with the default
+// importer, and fails t unless the output, renumbered like the output of the
+// fo command, is expected.
+func testParseFile(t *testing.T, src string, expected string) {
+	t.Helper()
+	trans, transformed, _ := transformSourceWith(t, src, importer.Default())
+	fset, renumbered := trans.Renumber(transformed, "transform_test.go")
+	output := bytes.NewBuffer(nil)
+	if err := format.Node(output, fset, renumbered); err != nil {
+		t.Fatalf("format.Node returned error: %s", err.Error())
 	}
 	if output.String() != expected {
 		diff := difflib.Diff(strings.Split(expected, "\n"), strings.Split(output.String(), "\n"))
@@ -1167,3 +1529,2949 @@ func testParseFile(t *testing.T, src string, expected string) {
 		)
 	}
 }
+
+func TestTransformInterfaceGenericMethods(t *testing.T) {
+	src := `package main
+
+type Mapper interface {
+	Map[U](f func(int) U) []U
+	Len() int
+}
+
+type Ints []int
+
+func (xs Ints) Map[U](f func(int) U) []U {
+	result := make([]U, len(xs))
+	for i, x := range xs {
+		result[i] = f(x)
+	}
+	return result
+}
+
+func (xs Ints) Len() int {
+	return len(xs)
+}
+
+func apply(m Mapper) {
+	_ = m.Map[string](nil)
+	_ = m.Map[bool](nil)
+}
+
+func main() {
+	apply(Ints{1, 2, 3})
+}
+`
+
+	expected := `package main
+
+type Mapper interface {
+	Map__bool(f func(int) bool) []bool
+	Map__string(f func(int) string) []string
+	Len() int
+}
+
+type Ints []int
+
+func (xs Ints) Map__bool(f func(int) bool) []bool {
+	result := make([]bool, len(xs))
+	for i, x := range xs {
+		result[i] = f(x)
+	}
+	return result
+}
+
+func (xs Ints) Map__string(f func(int) string) []string {
+	result := make([]string, len(xs))
+	for i, x := range xs {
+		result[i] = f(x)
+	}
+	return result
+}
+
+func (xs Ints) Len() int {
+	return len(xs)
+}
+
+func apply(m Mapper) {
+	_ = m.Map__string(nil)
+	_ = m.Map__bool(nil)
+}
+
+func main() {
+	apply(Ints{1, 2, 3})
+}
+`
+
+	testParseFile(t, src, expected)
+}
+
+func TestTransformMethodExprs(t *testing.T) {
+	src := `package main
+
+type List[T] struct {
+	items []T
+}
+
+func (l List[T]) Head() T {
+	return l.items[0]
+}
+
+func (l *List[T]) Push(x T) {
+	l.items = append(l.items, x)
+}
+
+func (l List[T]) Map[U](f func(T) U) List[U] {
+	return List[U]{}
+}
+
+func (l *List[T]) Zip[U, V](other List[U], f func(T, U) V) List[V] {
+	return List[V]{}
+}
+
+func main() {
+	l := List[int]{}
+	push := (*List[int]).Push
+	push(&l, 1)
+	head := List[bool].Head
+	mapToString := List[int].Map[string]
+	zip := (*List[int]).Zip[string, bool]
+	_ = head(zip(&l, mapToString(l, nil), nil))
+}
+`
+
+	expected := `package main
+
+type (
+	List__bool struct {
+		items []bool
+	}
+	List__int struct {
+		items []int
+	}
+	List__string struct {
+		items []string
+	}
+)
+
+func (l List__bool) Head() bool {
+	return l.items[0]
+}
+
+func (l List__int) Head() int {
+	return l.items[0]
+}
+
+func (l List__string) Head() string {
+	return l.items[0]
+}
+
+func (l *List__bool) Push(x bool) {
+	l.items = append(l.items, x)
+}
+
+func (l *List__int) Push(x int) {
+	l.items = append(l.items, x)
+}
+
+func (l *List__string) Push(x string) {
+	l.items = append(l.items, x)
+}
+
+func (l List__int) Map__string(f func(int) string) List__string {
+	return List__string{}
+}
+
+func (l *List__int) Zip__string__bool(other List__string, f func(int, string) bool) List__bool {
+	return List__bool{}
+}
+
+func main() {
+	l := List__int{}
+	push := (*List__int).Push
+	push(&l, 1)
+	head := List__bool.Head
+	mapToString := List__int.Map__string
+	zip := (*List__int).Zip__string__bool
+	_ = head(zip(&l, mapToString(l, nil), nil))
+}
+`
+
+	testParseFile(t, src, expected)
+}
+
+func TestTransformSpecializations(t *testing.T) {
+	src := `package main
+
+func Sum[T](xs []T, add func(T, T) T) T {
+	var sum T
+	for _, x := range xs {
+		sum = add(sum, x)
+	}
+	return sum
+}
+
+func Sum__float64(xs []float64, _ func(float64, float64) float64) float64 {
+	sum := 0.0
+	for _, x := range xs {
+		sum += x
+	}
+	return sum
+}
+
+func Max[T](x, y T, less func(T, T) bool) T {
+	if less(x, y) {
+		return y
+	}
+	return x
+}
+
+func Max__int(x, y int, _ func(int, int) bool) int {
+	if x < y {
+		return y
+	}
+	return x
+}
+
+func main() {
+	_ = Sum[float64](nil, nil)
+	_ = Sum[string](nil, nil)
+	_ = Max[int](1, 2, nil)
+}
+`
+
+	expected := `package main
+
+func Sum__string(xs []string, add func(string, string) string) string {
+	var sum string
+	for _, x := range xs {
+		sum = add(sum, x)
+	}
+	return sum
+}
+
+func Sum__float64(xs []float64, _ func(float64, float64) float64) float64 {
+	sum := 0.0
+	for _, x := range xs {
+		sum += x
+	}
+	return sum
+}
+
+func Max__int(x, y int, _ func(int, int) bool) int {
+	if x < y {
+		return y
+	}
+	return x
+}
+
+func main() {
+	_ = Sum__float64(nil, nil)
+	_ = Sum__string(nil, nil)
+	_ = Max__int(1, 2, nil)
+}
+`
+
+	testParseFile(t, src, expected)
+}
+
+func TestTransformInferredTypeArgs(t *testing.T) {
+	src := `package main
+
+type List[T] []T
+
+func NewList[T](xs ...T) List[T] {
+	return List[T](xs)
+}
+
+func (l List[T]) Map[U](f func(T) U) List[U] {
+	var out List[U]
+	for _, x := range l {
+		out = append(out, f(x))
+	}
+	return out
+}
+
+func (l List[T]) Filter(p func(T) bool) List[T] {
+	var out List[T]
+	for _, x := range l {
+		if p(x) {
+			out = append(out, x)
+		}
+	}
+	return out
+}
+
+func Wrap[T](x T) List[List[T]] {
+	return NewList(NewList(x))
+}
+
+func main() {
+	_ = NewList(1, 2, 3).Map(func(x int) string { return "" }).Filter(func(s string) bool { return s != "" })
+	_ = Wrap(true)
+}
+`
+
+	expected := `package main
+
+type (
+	List__List_bool_ []List__bool
+	List__bool       []bool
+	List__int        []int
+	List__string     []string
+)
+
+func NewList__List_bool_(xs ...List__bool) List__List_bool_ {
+	return List__List_bool_(xs)
+}
+
+func NewList__bool(xs ...bool) List__bool {
+	return List__bool(xs)
+}
+
+func NewList__int(xs ...int) List__int {
+	return List__int(xs)
+}
+
+func (l List__int) Map__string(f func(int) string) List__string {
+	var out List__string
+	for _, x := range l {
+		out = append(out, f(x))
+	}
+	return out
+}
+
+func (l List__List_bool_) Filter(p func(List__bool) bool) List__List_bool_ {
+	var out List__List_bool_
+	for _, x := range l {
+		if p(x) {
+			out = append(out, x)
+		}
+	}
+	return out
+}
+
+func (l List__bool) Filter(p func(bool) bool) List__bool {
+	var out List__bool
+	for _, x := range l {
+		if p(x) {
+			out = append(out, x)
+		}
+	}
+	return out
+}
+
+func (l List__int) Filter(p func(int) bool) List__int {
+	var out List__int
+	for _, x := range l {
+		if p(x) {
+			out = append(out, x)
+		}
+	}
+	return out
+}
+
+func (l List__string) Filter(p func(string) bool) List__string {
+	var out List__string
+	for _, x := range l {
+		if p(x) {
+			out = append(out, x)
+		}
+	}
+	return out
+}
+
+func Wrap__bool(x bool) List__List_bool_ {
+	return NewList__List_bool_(NewList__bool(x))
+}
+
+func main() {
+	_ = NewList__int(1, 2, 3).Map__string(func(x int) string { return "" }).Filter(func(s string) bool { return s != "" })
+	_ = Wrap__bool(true)
+}
+`
+
+	testParseFile(t, src, expected)
+}
+
+func TestTransformInferredLiteralTypeArgs(t *testing.T) {
+	src := `package main
+
+type Tuple[A, B] struct {
+	first  A
+	second B
+}
+
+func MakeTuple[A, B](first A, second B) Tuple[A, B] {
+	return Tuple{first, second}
+}
+
+var t Tuple[int, string] = Tuple{1, "t"}
+
+func main() {
+	var p *Tuple[bool, int] = &Tuple{true, 1}
+	_ = []Tuple[string, int]{Tuple{"a", 1}}
+	_, _ = p, MakeTuple(1.5, false)
+}
+`
+
+	expected := `package main
+
+type (
+	Tuple__bool__int struct {
+		first  bool
+		second int
+	}
+	Tuple__float64__bool struct {
+		first  float64
+		second bool
+	}
+	Tuple__int__string struct {
+		first  int
+		second string
+	}
+	Tuple__string__int struct {
+		first  string
+		second int
+	}
+)
+
+func MakeTuple__float64__bool(first float64, second bool) Tuple__float64__bool {
+	return Tuple__float64__bool{first, second}
+}
+
+var t Tuple__int__string = Tuple__int__string{1, "t"}
+
+func main() {
+	var p *Tuple__bool__int = &Tuple__bool__int{true, 1}
+	_ = []Tuple__string__int{Tuple__string__int{"a", 1}}
+	_, _ = p, MakeTuple__float64__bool(1.5, false)
+}
+`
+
+	testParseFile(t, src, expected)
+}
+
+func TestTransformOrderBuiltins(t *testing.T) {
+	src := `package main
+
+type Dur int64
+
+const Second Dur = 1000
+
+const (
+	hi   = max(2, 10) * 2
+	f    = min(1, 2.5)
+	r    = max('a', 98)
+	n8   int8 = 3
+	m8   = min(n8, 2)
+	same = max(n8, -1)
+	nest = min(max(1, 2), 3-1)
+)
+
+func Count[T](xs []T) int {
+	return min(len(xs), 3)
+}
+
+func main() {
+	a, b := 3, 7
+	_ = min(a, b, 1)
+	_ = clamp(90*Second, Second, 60*Second)
+	_ = Count([]string{})
+}
+`
+
+	expected := `package main
+
+type Dur int64
+
+const Second Dur = 1000
+
+const (
+	hi        = 10 * 2
+	f         = 1.0
+	r         = 'b'
+	n8   int8 = 3
+	m8        = int8(2)
+	same      = n8
+	nest      = 2
+)
+
+func Count__string(xs []string) int {
+	return func(x int, ys ...int) int {
+		for _, y := range ys {
+			if y < x {
+				x = y
+			}
+		}
+		return x
+	}(len(xs), 3)
+}
+
+func main() {
+	a, b := 3, 7
+	_ = func(x int, ys ...int) int {
+		for _, y := range ys {
+			if y < x {
+				x = y
+			}
+		}
+		return x
+	}(a, b, 1)
+	_ = Dur(60 * Second)
+	_ = Count__string([]string{})
+}
+`
+
+	testParseFile(t, src, expected)
+}
+
+func TestTransformImplAssertions(t *testing.T) {
+	src := `package main
+
+type Named interface {
+	Name() string
+}
+
+type Person struct{}
+
+func (Person) Name() string { return "" }
+
+func Describe[T](x T) string {
+	assertImplements[T, Named]()
+	return "described"
+}
+
+func main() {
+	assertImplements[Person, Named]()
+	for assertImplements[*Person, Named](); ; {
+		break
+	}
+	_ = Describe(Person{})
+}
+`
+
+	expected := `package main
+
+type Named interface {
+	Name() string
+}
+
+type Person struct{}
+
+func (Person) Name() string { return "" }
+
+func Describe__Person(x Person) string {
+	return "described"
+}
+
+func main() {
+	for {
+		break
+	}
+	_ = Describe__Person(Person{})
+}
+`
+
+	testParseFile(t, src, expected)
+}
+
+func TestTransformGenericFuncValues(t *testing.T) {
+	src := `package main
+
+type Fn[T] func(T) T
+
+type Box[T] struct{ v T }
+
+type Pair[T] struct {
+	apply Fn[T]
+	get   func(Box[T]) T
+}
+
+func Id[T](x T) T { return x }
+
+func Get[T](b Box[T]) T { return b.v }
+
+func Wrap[T](v T) Box[T] { return Box[T]{v} }
+
+func Apply[T](x T) T {
+	f := Id[T]
+	p := Pair[T]{apply: f, get: Get[T]}
+	return p.get(Wrap(p.apply(x)))
+}
+
+var global Fn[string] = Id[string]
+
+func main() {
+	_ = Apply[int](1)
+	var b Box[func(int) int] = Wrap(Id[int])
+	b = Box[func(x int) int]{Id[int]}
+	_ = b
+}
+`
+
+	expected := `package main
+
+type (
+	Fn__int    func(int) int
+	Fn__string func(string) string
+)
+
+type (
+	Box__func_int__int struct{ v func(int) int }
+	Box__int           struct{ v int }
+)
+
+type Pair__int struct {
+	apply Fn__int
+	get   func(Box__int) int
+}
+
+func Id__int(x int) int { return x }
+
+func Id__string(x string) string { return x }
+
+func Get__int(b Box__int) int { return b.v }
+
+func Wrap__func_int__int(v func(int) int) Box__func_int__int { return Box__func_int__int{v} }
+
+func Wrap__int(v int) Box__int { return Box__int{v} }
+
+func Apply__int(x int) int {
+	f := Id__int
+	p := Pair__int{apply: f, get: Get__int}
+	return p.get(Wrap__int(p.apply(x)))
+}
+
+var global Fn__string = Id__string
+
+func main() {
+	_ = Apply__int(1)
+	var b Box__func_int__int = Wrap__func_int__int(Id__int)
+	b = Box__func_int__int{Id__int}
+	_ = b
+}
+`
+
+	testParseFile(t, src, expected)
+}
+
+func TestTransformAnonymousTypes(t *testing.T) {
+	src := `package main
+
+type Inner struct{ n int }
+
+type Box[T] struct{ v T }
+
+func Wrap[T](v T) Box[T] { return Box[T]{v} }
+
+func Read[T](g interface{ Get() T }) T { return g.Get() }
+
+func Pair[T](x T) struct{ i int; x T } {
+	return struct{ i int; x T }{0, x}
+}
+
+func main() {
+	_ = Pair[string]("a").x
+	var g interface{ Get() int }
+	_ = Read[int](g)
+	_ = Wrap(g)
+	_ = Wrap(struct {
+		Inner
+		v int "key:\"v\""
+	}{})
+	_ = Box[interface{ Get() int }]{g}
+}
+`
+
+	expected := `package main
+
+type Inner struct{ n int }
+
+type (
+	Box__interface_Get___int_ struct {
+		v interface {
+			Get() int
+		}
+	}
+	Box__struct_Inner__v_int__key___v____ struct {
+		v struct {
+			Inner
+			v int ` + "`key:\"v\"`" + `
+		}
+	}
+)
+
+func Wrap__interface_Get___int_(v interface {
+	Get() int
+}) Box__interface_Get___int_ { return Box__interface_Get___int_{v} }
+
+func Wrap__struct_Inner__v_int__key___v____(v struct {
+	Inner
+	v int ` + "`key:\"v\"`" + `
+}) Box__struct_Inner__v_int__key___v____ { return Box__struct_Inner__v_int__key___v____{v} }
+
+func Read__int(g interface {
+	Get() int
+}) int { return g.Get() }
+
+func Pair__string(x string) struct {
+	i int
+	x string
+} {
+	return struct {
+		i int
+		x string
+	}{0, x}
+}
+
+func main() {
+	_ = Pair__string("a").x
+	var g interface {
+		Get() int
+	}
+	_ = Read__int(g)
+	_ = Wrap__interface_Get___int_(g)
+	_ = Wrap__struct_Inner__v_int__key___v____(struct {
+		Inner
+		v int "key:\"v\""
+	}{})
+	_ = Box__interface_Get___int_{g}
+}
+`
+
+	testParseFile(t, src, expected)
+}
+
+func TestTransformSpecializationErrors(t *testing.T) {
+	src := `package main
+
+type Box[T] struct{ v T }
+
+type Box__int int
+
+func Sum[T](xs []T) T {
+	var sum T
+	return sum
+}
+
+func Sum__float64(xs []float64) int {
+	return 0
+}
+
+func main() {
+	_ = Box[int]{}
+	_ = Sum[float64](nil)
+}
+`
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "transform_test", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &types.Info{
+		Types:      map[ast.Expr]types.TypeAndValue{},
+		Selections: map[*ast.SelectorExpr]*types.Selection{},
+		TypeArgs:   map[*ast.IndexExpr]*ast.TypeArgExpr{},
+		Uses:       map[*ast.Ident]types.Object{},
+	}
+	pkg, err := (&types.Config{}).Check("transformtest", fset, []*ast.File{f}, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trans := &Transformer{Fset: fset, Pkg: pkg, Info: info}
+	_, _, err = trans.File(f)
+	errs, ok := err.(scanner.ErrorList)
+	if !ok {
+		t.Fatalf("expected a scanner.ErrorList but got %v", err)
+	}
+	expected := []string{
+		"transform_test:5:6: Box__int is the name of an instance of the generic type Box, which cannot be specialized",
+		"transform_test:12:6: specialization Sum__float64 of Sum has type func(xs []float64) int, but the instance has type func(xs []float64) float64",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("wrong errors (expected %q but got %q)", expected, errs)
+	}
+	for i, err := range errs {
+		if err.Error() != expected[i] {
+			t.Errorf("wrong error\nexpected: %s\ngot:      %s", expected[i], err)
+		}
+	}
+}
+
+// The errors of a package with several files are found once, by
+// CheckPackage, rather than for each file.
+func TestTransformCheckPackageOnce(t *testing.T) {
+	srcs := []string{`package main
+
+type Box[T] struct{ v T }
+
+type Box__int int
+`, `package main
+
+func main() {
+	_ = Box[int]{}
+}
+`}
+
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for i, src := range srcs {
+		f, err := parser.ParseFile(fset, fmt.Sprintf("%c.fo", 'a'+i), src, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, f)
+	}
+	info := &types.Info{
+		Types:      map[ast.Expr]types.TypeAndValue{},
+		Selections: map[*ast.SelectorExpr]*types.Selection{},
+		TypeArgs:   map[*ast.IndexExpr]*ast.TypeArgExpr{},
+		Uses:       map[*ast.Ident]types.Object{},
+	}
+	pkg, err := (&types.Config{}).Check("transformtest", fset, files, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trans := &Transformer{Fset: fset, Pkg: pkg, Info: info}
+	err = trans.CheckPackage()
+	errs, ok := err.(scanner.ErrorList)
+	if !ok {
+		t.Fatalf("expected a scanner.ErrorList but got %v", err)
+	}
+	expected := "a.fo:5:6: Box__int is the name of an instance of the generic type Box, which cannot be specialized"
+	if len(errs) != 1 || errs[0].Error() != expected {
+		t.Fatalf("wrong errors (expected [%s] but got %q)", expected, errs)
+	}
+	// File returns the same errors instead of checking the package again.
+	for _, f := range files {
+		if _, _, err := trans.File(f); !reflect.DeepEqual(err, errs) {
+			t.Errorf("File returned %v, expected the errors of CheckPackage", err)
+		}
+	}
+}
+
+func TestTransformInstanceNameClashes(t *testing.T) {
+	src := `package main
+
+type Box[T] struct {
+	v           T
+	Map__string int
+}
+
+func (b Box[T]) Map[U](f func(T) U) U {
+	return f(b.v)
+}
+
+type List struct{}
+
+func (List) Each[U](x U) {}
+
+func (List) Each__int(x int) {}
+
+func Max[T](a, b T) T {
+	return a
+}
+
+var Max__int = 0
+
+func Min[T](a, b T) T {
+	return a
+}
+
+func Min__int[T](a, b T) T {
+	return a
+}
+
+func main() {
+	_ = Box[int]{}.Map[string](nil)
+	_ = Box[bool]{}.Map[string](nil)
+	List{}.Each[int](1)
+	_ = Max[int](1, 2)
+	_ = Min[int](1, 2)
+	_ = Min__int[bool](true, false)
+}
+`
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "transform_test", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &types.Info{
+		Types:      map[ast.Expr]types.TypeAndValue{},
+		Selections: map[*ast.SelectorExpr]*types.Selection{},
+		TypeArgs:   map[*ast.IndexExpr]*ast.TypeArgExpr{},
+		Uses:       map[*ast.Ident]types.Object{},
+	}
+	pkg, err := (&types.Config{}).Check("transformtest", fset, []*ast.File{f}, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trans := &Transformer{Fset: fset, Pkg: pkg, Info: info}
+	_, _, err = trans.File(f)
+	errs, ok := err.(scanner.ErrorList)
+	if !ok {
+		t.Fatalf("expected a scanner.ErrorList but got %v", err)
+	}
+	expected := []string{
+		"transform_test:5:2: Map__string is the name of an instance of the generic method Box.Map, which cannot be specialized",
+		"transform_test:16:13: Each__int is the name of an instance of the generic method List.Each, which cannot be specialized",
+		"transform_test:22:5: Max__int is the name of an instance of the generic function Max, which can only be specialized by a function without type parameters",
+		"transform_test:28:6: Min__int is the name of an instance of the generic function Min, which can only be specialized by a function without type parameters",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("wrong errors (expected %q but got %q)", expected, errs)
+	}
+	for i, err := range errs {
+		if err.Error() != expected[i] {
+			t.Errorf("wrong error\nexpected: %s\ngot:      %s", expected[i], err)
+		}
+	}
+}
+
+func TestTransformOriginOf(t *testing.T) {
+	src := `package main
+
+type Box[T] struct {
+	val T
+}
+
+func (b Box[T]) Get() T {
+	return b.val
+}
+
+func Wrap[T](x T) Box[T] {
+	return Box[T]{val: x}
+}
+
+func main() {
+	_ = Wrap[int](1).Get()
+}
+`
+
+	trans, transformed, _ := transformSource(t, src)
+	info, pkg := trans.Info, trans.Pkg
+	expected := map[string]string{
+		"Box__int":  "Box",
+		"Wrap__int": "Wrap",
+		"Get":       "Get",
+		"val":       "val",
+		"x":         "x",
+	}
+	found := map[string]bool{}
+	ast.Inspect(transformed, func(n ast.Node) bool {
+		ident, ok := n.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		origName, ok := expected[ident.Name]
+		if !ok {
+			return true
+		}
+		obj := info.OriginOf(ident)
+		if obj == nil {
+			t.Errorf("OriginOf(%s) at %s returned nil", ident.Name, trans.Fset.Position(ident.Pos()))
+			return true
+		}
+		if obj.Name() != origName || obj.Pkg() != pkg {
+			t.Errorf("wrong origin for %s (expected %s but got %s)", ident.Name, origName, obj)
+		}
+		found[ident.Name] = true
+		return true
+	})
+	for name := range expected {
+		if !found[name] {
+			t.Errorf("identifier %s not found in transformed file", name)
+		}
+	}
+}
+
+// benchmarkSource returns the source of a package with n instantiations of a
+// generic type with two methods and of a generic function.
+func benchmarkSource(n int) string {
+	buf := &bytes.Buffer{}
+	buf.WriteString(`package main
+
+type Box[T] struct {
+	val T
+}
+
+func (b Box[T]) Get() T {
+	return b.val
+}
+
+func (b *Box[T]) Set(val T) {
+	b.val = val
+}
+
+func Map[T, U](xs []T, f func(T) U) []U {
+	result := make([]U, len(xs))
+	for i, x := range xs {
+		result[i] = f(x)
+	}
+	return result
+}
+
+func main() {
+`)
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(buf, "\tvar _ = Box[[%d]*int]{}\n", i+1)
+		fmt.Fprintf(buf, "\tvar _ = Map[map[string][%d]int, int](nil, nil)\n", i+1)
+	}
+	buf.WriteString("}\n")
+	return buf.String()
+}
+
+func BenchmarkTransform(b *testing.B) {
+	src := benchmarkSource(200)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		fset := token.NewFileSet()
+		orig, err := parser.ParseFile(fset, "transform_test", src, 0)
+		if err != nil {
+			b.Fatal(err)
+		}
+		info := &types.Info{
+			Types:      map[ast.Expr]types.TypeAndValue{},
+			Selections: map[*ast.SelectorExpr]*types.Selection{},
+			TypeArgs:   map[*ast.IndexExpr]*ast.TypeArgExpr{},
+			Uses:       map[*ast.Ident]types.Object{},
+		}
+		pkg, err := (&types.Config{}).Check("transformtest", fset, []*ast.File{orig}, info)
+		if err != nil {
+			b.Fatal(err)
+		}
+		trans := &Transformer{
+			Fset: fset,
+			Pkg:  pkg,
+			Info: info,
+		}
+		b.StartTimer()
+		if _, _, err := trans.File(orig); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// sortFuncsSource returns n methods named Get and n functions named F_i, in
+// reverse order.
+func sortFuncsSource(n int) []*ast.FuncDecl {
+	var funcs []*ast.FuncDecl
+	for i := n - 1; i >= 0; i-- {
+		funcs = append(funcs, &ast.FuncDecl{
+			Recv: &ast.FieldList{List: []*ast.Field{{
+				Names: []*ast.Ident{ast.NewIdent("b")},
+				Type:  &ast.StarExpr{X: ast.NewIdent(fmt.Sprintf("Box__%d", i))},
+			}}},
+			Name: ast.NewIdent("Get"),
+			Type: &ast.FuncType{Params: &ast.FieldList{}},
+		})
+		funcs = append(funcs, &ast.FuncDecl{
+			Name: ast.NewIdent(fmt.Sprintf("F_%d", i)),
+			Type: &ast.FuncType{Params: &ast.FieldList{}},
+		})
+	}
+	return funcs
+}
+
+func TestSortFuncs(t *testing.T) {
+	funcs := sortFuncsSource(3)
+	funcs = append(funcs, &ast.FuncDecl{
+		Recv: &ast.FieldList{List: []*ast.Field{{
+			Names: []*ast.Ident{ast.NewIdent("b")},
+			Type:  ast.NewIdent("Box__1__x"),
+		}}},
+		Name: ast.NewIdent("Get"),
+		Type: &ast.FuncType{Params: &ast.FieldList{}},
+	})
+	sortFuncs(funcs)
+	var got []string
+	for _, f := range funcs {
+		name := f.Name.Name
+		if f.Recv != nil {
+			name = "(" + types.ExprString(f.Recv.List[0].Type) + ")." + name
+		}
+		got = append(got, name)
+	}
+	expected := []string{"F_0", "F_1", "F_2", "(*Box__0).Get", "(*Box__1).Get", "(*Box__2).Get", "(Box__1__x).Get"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("wrong order\nexpected: %v\ngot:      %v", expected, got)
+	}
+}
+
+func BenchmarkSortFuncs(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		funcs := sortFuncsSource(500)
+		b.StartTimer()
+		sortFuncs(funcs)
+	}
+}
+
+func TestTransformSourceOrder(t *testing.T) {
+	src := `package main
+
+type (
+	Zeta int
+
+	Pair[A, B] struct {
+		a A
+		b B
+	}
+
+	Alpha string
+)
+
+func main() {
+	_ = Pair[string, int]{}
+	_ = Pair[int, string]{}
+	_ = Pair[bool, bool]{}
+}
+`
+	expected := `package main
+
+type (
+	Zeta int
+
+	Pair__bool__bool struct {
+		a bool
+		b bool
+	}
+	Pair__int__string struct {
+		a int
+		b string
+	}
+	Pair__string__int struct {
+		a string
+		b int
+	}
+
+	Alpha string
+)
+
+func main() {
+	_ = Pair__string__int{}
+	_ = Pair__int__string{}
+	_ = Pair__bool__bool{}
+}
+`
+	fset := token.NewFileSet()
+	orig, err := parser.ParseFile(fset, "transform_test.fo", src, 0)
+	if err != nil {
+		t.Fatalf("ParseFile returned error: %s", err.Error())
+	}
+	info := &types.Info{
+		Types:      map[ast.Expr]types.TypeAndValue{},
+		Selections: map[*ast.SelectorExpr]*types.Selection{},
+		TypeArgs:   map[*ast.IndexExpr]*ast.TypeArgExpr{},
+		Uses:       map[*ast.Ident]types.Object{},
+	}
+	pkg, err := (&types.Config{}).Check("transformtest", fset, []*ast.File{orig}, info)
+	if err != nil {
+		t.Fatalf("conf.Check returned error: %s", err.Error())
+	}
+	trans := &Transformer{
+		Fset:        fset,
+		Pkg:         pkg,
+		Info:        info,
+		SourceOrder: true,
+	}
+	transformed, _, err := trans.File(orig)
+	if err != nil {
+		t.Fatalf("File returned error: %s", err.Error())
+	}
+	fset, renumbered := trans.Renumber(transformed, "transform_test.go")
+	output := bytes.NewBuffer(nil)
+	if err := format.Node(output, fset, renumbered); err != nil {
+		t.Fatalf("format.Node returned error: %s", err.Error())
+	}
+	if output.String() != expected {
+		t.Errorf("wrong output\nexpected:\n%s\ngot:\n%s", expected, output.String())
+	}
+}
+
+func TestWriteSimpleExpr(t *testing.T) {
+	exprs := []string{
+		"int",
+		"*int",
+		"**[]string",
+		"[]*lib.Box",
+		"[3][0x10]byte",
+		"map[string][]*int",
+		"map[*T]map[[2]int]U",
+		"chan int",
+		"func(int) string",
+		"struct{ x int }",
+		"map[string]interface{}",
+		"*(int)",
+	}
+	for _, src := range exprs {
+		expr, err := parser.ParseExpr(src)
+		if err != nil {
+			t.Fatalf("ParseExpr(%q) returned error: %s", src, err)
+		}
+		expected := &bytes.Buffer{}
+		if err := format.Node(expected, token.NewFileSet(), expr); err != nil {
+			t.Fatal(err)
+		}
+		got := &bytes.Buffer{}
+		if writeSimpleExpr(got, expr) && got.String() != expected.String() {
+			t.Errorf("wrong output for %s (expected %q but got %q)", src, expected.String(), got.String())
+		}
+	}
+}
+
+func TestTransformSourceMap(t *testing.T) {
+	src := `package main
+
+type Box[T] struct {
+	val T
+}
+
+func (b Box[T]) Get() T {
+	return b.val
+}
+
+func main() {
+	_ = Box[int]{}.Get()
+}
+`
+
+	trans, transformed, output := transformSource(t, src)
+	// The generated file is:
+	//
+	//	1 package main
+	//	2
+	//	3 type Box__int struct {
+	//	4 	val int
+	//	5 }
+	//	6
+	//	7 func (b Box__int) Get() int {
+	//	8 	return b.val
+	//	9 }
+	//	10
+	//	11 func main() {
+	//	12 	_ = Box__int{}.Get()
+	//	13 }
+	sm, err := trans.SourceMap(transformed, "transform_test.go", output)
+	if err != nil {
+		t.Fatalf("SourceMap returned error: %s", err.Error())
+	}
+	expectedDecls := []SourceMapDecl{
+		{Name: "Box__int", Line: 3, EndLine: 5, SourceLine: 3, Generic: "Box", TypeArgs: []string{"int"}},
+		{Name: "Box__int.Get", Line: 7, EndLine: 9, SourceLine: 7, Generic: "Box.Get", TypeArgs: []string{"int"}},
+		{Name: "main", Line: 11, EndLine: 13, SourceLine: 11},
+	}
+	if !reflect.DeepEqual(sm.Decls, expectedDecls) {
+		t.Errorf("wrong decls\nexpected: %+v\ngot:      %+v", expectedDecls, sm.Decls)
+	}
+	expectedPos := SourceMapPosition{Line: 8, Column: 9, SourceLine: 8, SourceColumn: 9}
+	found := false
+	for _, pos := range sm.Positions {
+		if pos == expectedPos {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("position of b.val not found in %+v", sm.Positions)
+	}
+}
+
+func TestTransformLineDirectives(t *testing.T) {
+	src := `package main
+
+type Box[T] struct {
+	val T
+}
+
+func (b Box[T]) Get() T {
+	s := ` + "`a\nb`" + `
+	_ = s
+	return b.val
+}
+
+func main() {
+	_ = Box[int]{}.Get()
+	_ = Box[string]{}.Get()
+}
+`
+
+	trans, transformed, output := transformSource(t, src)
+	sm, err := trans.SourceMap(transformed, "transform_test.go", output)
+	if err != nil {
+		t.Fatalf("SourceMap returned error: %s", err.Error())
+	}
+	result, err := sm.LineDirectives(output)
+	if err != nil {
+		t.Fatalf("LineDirectives returned error: %s", err.Error())
+	}
+	source, err := filepath.Abs("transform_test.fo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := strings.Replace(`//line transform_test.fo:1
+package main
+
+type (
+//line transform_test.fo:3
+	Box__int struct {
+		val int
+	}
+//line transform_test.fo:3
+	Box__string struct {
+		val string
+	}
+)
+
+//line transform_test.fo:7
+func (b Box__int) Get() int {
+	s := `+"`a\nb`"+`
+	_ = s
+	return b.val
+}
+//line transform_test.fo:7
+func (b Box__string) Get() string {
+	s := `+"`a\nb`"+`
+	_ = s
+	return b.val
+}
+
+func main() {
+	_ = Box__int{}.Get()
+	_ = Box__string{}.Get()
+}
+`, "transform_test.fo", source, -1)
+	if string(result) != expected {
+		diff := difflib.Diff(strings.Split(expected, "\n"), strings.Split(string(result), "\n"))
+		diffStrings := ""
+		for _, d := range diff {
+			diffStrings += d.String() + "\n"
+		}
+		t.Fatalf("output of LineDirectives did not match expected\n\n%s", diffStrings)
+	}
+}
+
+func TestRenumber(t *testing.T) {
+	src := `package main
+
+type Box[T] struct {
+	v T
+}
+
+func (b Box[T]) Get() T {
+	return b.v
+}
+
+func main() {
+	b := Box[int]{v: 1}
+	s := Box[string]{
+		v: "x",
+	}
+	_ = b.Get()
+	_ = s.Get()
+}
+`
+	// Without renumbering, the copies of Get are not separated by a blank
+	// line since they have the same positions.
+	expected := `package main
+
+type (
+	Box__int struct {
+		v int
+	}
+	Box__string struct {
+		v string
+	}
+)
+
+func (b Box__int) Get() int {
+	return b.v
+}
+
+func (b Box__string) Get() string {
+	return b.v
+}
+
+func main() {
+	b := Box__int{v: 1}
+	s := Box__string{
+		v: "x",
+	}
+	_ = b.Get()
+	_ = s.Get()
+}
+`
+	trans, transformed, _ := transformSource(t, src)
+	fset, renumbered := trans.Renumber(transformed, "transform_test.go")
+	output := bytes.NewBuffer(nil)
+	if err := format.Node(output, fset, renumbered); err != nil {
+		t.Fatalf("format.Node returned error: %s", err.Error())
+	}
+	if output.String() != expected {
+		t.Errorf("wrong output\nexpected:\n%s\ngot:\n%s", expected, output.String())
+	}
+
+	var prev token.Pos
+	for _, decl := range renumbered.Decls {
+		if decl.Pos() <= prev {
+			t.Errorf("declaration at %s does not follow the previous one", fset.Position(decl.Pos()))
+		}
+		prev = decl.End()
+	}
+	if name := fset.Position(renumbered.Pos()).Filename; name != "transform_test.go" {
+		t.Errorf("renumbered file has positions in %s", name)
+	}
+	if name := trans.Fset.Position(transformed.Decls[1].Pos()).Filename; name != "transform_test.fo" {
+		t.Errorf("Renumber changed the positions of its argument to %s", name)
+	}
+}
+
+func TestRenumberComments(t *testing.T) {
+	src := `//go:build linux
+// +build linux
+
+// Package main is not printed.
+package main
+
+//go:generate stringer -type=Color
+// Not a directive.
+
+// Max returns the larger value.
+//go:noinline
+func Max[T](a, b T, less func(T, T) bool) T {
+	// Not printed.
+	if less(a, b) {
+		return b
+	}
+	return a
+}
+
+//go:noinline
+func Unused[T]() {}
+
+type (
+	//go:notinheap
+	Box[T] struct {
+		v T // the value
+	}
+)
+
+//fo:instantiate Box[bool]
+
+func main() {
+	_ = Max[int](1, 2, nil)
+	_ = Max[string]("a", "b", nil)
+	_ = Box[int]{}
+}
+
+//go:generate echo done
+`
+	expected := `//go:build linux
+// +build linux
+
+package main
+
+//go:generate stringer -type=Color
+
+// Max returns the larger value.
+//go:noinline
+func Max__int(a, b int, less func(int, int) bool) int {
+	if less(a, b) {
+		return b
+	}
+	return a
+}
+
+// Max returns the larger value.
+//go:noinline
+func Max__string(a, b string, less func(string, string) bool) string {
+	if less(a, b) {
+		return b
+	}
+	return a
+}
+
+type (
+	//go:notinheap
+	Box__bool struct {
+		v bool // the value
+	}
+	//go:notinheap
+	Box__int struct {
+		v int // the value
+	}
+)
+
+func main() {
+	_ = Max__int(1, 2, nil)
+	_ = Max__string("a", "b", nil)
+	_ = Box__int{}
+}
+
+//go:generate echo done
+`
+	fset := token.NewFileSet()
+	orig, err := parser.ParseFile(fset, "transform_test.fo", src, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("ParseFile returned error: %s", err.Error())
+	}
+	info := &types.Info{
+		Types:      map[ast.Expr]types.TypeAndValue{},
+		Selections: map[*ast.SelectorExpr]*types.Selection{},
+		TypeArgs:   map[*ast.IndexExpr]*ast.TypeArgExpr{},
+		Uses:       map[*ast.Ident]types.Object{},
+	}
+	pkg, err := (&types.Config{}).Check("transformtest", fset, []*ast.File{orig}, info)
+	if err != nil {
+		t.Fatalf("conf.Check returned error: %s", err.Error())
+	}
+	trans := &Transformer{
+		Fset: fset,
+		Pkg:  pkg,
+		Info: info,
+	}
+	transformed, _, err := trans.File(orig)
+	if err != nil {
+		t.Fatalf("File returned error: %s", err.Error())
+	}
+	fset, renumbered := trans.Renumber(transformed, "transform_test.go")
+	output := bytes.NewBuffer(nil)
+	if err := format.Node(output, fset, renumbered); err != nil {
+		t.Fatalf("format.Node returned error: %s", err.Error())
+	}
+	if output.String() != expected {
+		t.Errorf("wrong output\nexpected:\n%s\ngot:\n%s", expected, output.String())
+	}
+}
+
+// libImporter imports package unsafe and the packages lib and other/lib,
+// which are both named lib and declare a type T and a variable X.
+type libImporter struct{}
+
+func (libImporter) Import(path string) (*types.Package, error) {
+	if path == "unsafe" {
+		return types.Unsafe, nil
+	}
+	if path != "lib" && path != "other/lib" {
+		return nil, fmt.Errorf("can't find import: %q", path)
+	}
+	pkg := types.NewPackage(path, "lib")
+	obj := types.NewTypeName(token.NoPos, pkg, "T", nil)
+	types.NewNamed(obj, types.Typ[types.Int], nil)
+	pkg.Scope().Insert(obj)
+	pkg.Scope().Insert(types.NewVar(token.NoPos, pkg, "X", types.Typ[types.Int]))
+	pkg.MarkComplete()
+	return pkg, nil
+}
+
+// mergeSources type-checks the files of a package with the given sources,
+// which are parsed as a.fo, b.fo and so on, transforms them and merges the
+// results. It returns the formatted output and the error returned by Merge.
+func mergeSources(t *testing.T, srcs ...string) ([]byte, error) {
+	t.Helper()
+	var sources []checktest.File
+	for i, src := range srcs {
+		sources = append(sources, checktest.File{Name: fmt.Sprintf("%c.fo", 'a'+i), Src: src})
+	}
+	fset := token.NewFileSet()
+	files, pkg, info, err := checktest.Check(&types.Config{Importer: libImporter{}}, fset, "transformtest", parser.ParseComments, sources...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trans := &Transformer{
+		Fset: fset,
+		Pkg:  pkg,
+		Info: info,
+	}
+	for i, f := range files {
+		if files[i], _, err = trans.File(f); err != nil {
+			t.Fatalf("File returned error: %s", err.Error())
+		}
+	}
+	merged, err := trans.Merge(files)
+	if err != nil {
+		return nil, err
+	}
+	fset, renumbered := trans.Renumber(merged, "merged.go")
+	output := bytes.NewBuffer(nil)
+	if err := format.Node(output, fset, renumbered); err != nil {
+		t.Fatalf("format.Node returned error: %s", err.Error())
+	}
+	return output.Bytes(), nil
+}
+
+func TestMerge(t *testing.T) {
+	a := `// Package main is not printed.
+package main
+
+import "lib"
+
+// Box holds a value.
+type Box[T] struct {
+	v T
+}
+
+var _ = lib.X
+`
+	b := `//go:generate echo b
+
+package main
+
+import "lib"
+
+func main() {
+	_ = Box[lib.T]{}
+	_ = Box[int]{}
+}
+`
+	c := `package main
+
+import (
+	_ "lib"
+	"unsafe"
+)
+
+var size = unsafe.Sizeof(0)
+`
+	expected := `package main
+
+import (
+	"lib"
+	"unsafe"
+)
+
+// Box holds a value.
+type (
+	Box__int struct {
+		v int
+	}
+	Box__lib_T struct {
+		v lib.T
+	}
+)
+
+var _ = lib.X
+
+//go:generate echo b
+
+func main() {
+	_ = Box__lib_T{}
+	_ = Box__int{}
+}
+
+var size = unsafe.Sizeof(0)
+`
+	output, err := mergeSources(t, a, b, c)
+	if err != nil {
+		t.Fatalf("Merge returned error: %s", err.Error())
+	}
+	if string(output) != expected {
+		t.Errorf("wrong output\nexpected:\n%s\ngot:\n%s", expected, output)
+	}
+}
+
+func TestMergeErrors(t *testing.T) {
+	for _, test := range []struct {
+		srcs     []string
+		expected string
+	}{
+		{
+			[]string{
+				"package main\n\nimport \"lib\"\n\nvar _ = lib.X\n",
+				"package main\n\nimport \"other/lib\"\n\nvar _ = lib.X\n",
+			},
+			`b.fo:3:8: cannot merge the import of "other/lib" as lib with the one of "lib" at a.fo:3:8`,
+		},
+		{
+			[]string{
+				"package main\n",
+				"package main\n\nimport . \"lib\"\n\nvar _ = X\n",
+			},
+			"b.fo:3:8: cannot merge a file with a dot import",
+		},
+		{
+			[]string{
+				"//go:build linux\n\npackage main\n",
+				"package main\n",
+			},
+			"a.fo:1:1: cannot merge a file with build constraints",
+		},
+	} {
+		_, err := mergeSources(t, test.srcs...)
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("got error %v, expected %s", err, test.expected)
+		}
+	}
+}
+
+func TestTransformFilePreserving(t *testing.T) {
+	src := `package main
+
+// Box holds a value.
+type Box[T] struct {
+	val T // the value
+}
+
+// Unused is never used.
+func Unused[T](x T) T { return x }
+
+const   answer   =   42 // not formatted
+
+// Get returns the value.
+func (b Box[T]) Get() T {
+	// Just return it.
+	return b.val
+}
+
+func  double(x int) int { return 2*x }
+
+func main() {
+	_ = Box[int]{val: double(answer)}.Get()
+	_ = Box[string]{}.Get()
+}
+`
+	fset := token.NewFileSet()
+	orig, err := parser.ParseFile(fset, "transform_test.fo", src, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("ParseFile returned error: %s", err.Error())
+	}
+	info := &types.Info{
+		Types:      map[ast.Expr]types.TypeAndValue{},
+		Selections: map[*ast.SelectorExpr]*types.Selection{},
+		TypeArgs:   map[*ast.IndexExpr]*ast.TypeArgExpr{},
+		Uses:       map[*ast.Ident]types.Object{},
+	}
+	pkg, err := (&types.Config{}).Check("transformtest", fset, []*ast.File{orig}, info)
+	if err != nil {
+		t.Fatalf("conf.Check returned error: %s", err.Error())
+	}
+	trans := &Transformer{
+		Fset: fset,
+		Pkg:  pkg,
+		Info: info,
+	}
+	_, result, err := trans.FilePreserving(orig, []byte(src))
+	if err != nil {
+		t.Fatalf("FilePreserving returned error: %s", err.Error())
+	}
+	// Unchanged declarations are copied as is, even though they are not
+	// formatted.
+	expected := `package main
+
+// Box holds a value.
+type (
+	Box__int struct {
+		val int // the value
+	}
+	Box__string struct {
+		val string
+	}
+)
+
+const   answer   =   42 // not formatted
+
+// Get returns the value.
+func (b Box__int) Get() int {
+	// Just return it.
+	return b.val
+}
+
+// Get returns the value.
+func (b Box__string) Get() string {
+	// Just return it.
+	return b.val
+}
+
+func  double(x int) int { return 2*x }
+
+func main() {
+	_ = Box__int{val: double(answer)}.Get()
+	_ = Box__string{}.Get()
+}
+`
+	if string(result) != expected {
+		diff := difflib.Diff(strings.Split(expected, "\n"), strings.Split(string(result), "\n"))
+		diffStrings := ""
+		for _, d := range diff {
+			diffStrings += d.String() + "\n"
+		}
+		t.Fatalf("output of FilePreserving did not match expected\n\n%s", diffStrings)
+	}
+}
+
+func TestTransformBlankUnusedImports(t *testing.T) {
+	src := `package main
+
+import (
+	"unsafe"
+)
+
+func Unused[T]() {
+	var _ unsafe.Pointer
+}
+
+func main() {}
+`
+
+	_, _, output := transformSource(t, src)
+	expected := `package main
+
+import (
+	_ "unsafe"
+)
+
+func main() {}
+`
+	if string(output) != expected {
+		t.Errorf("wrong output\nexpected:\n%s\ngot:\n%s", expected, output)
+	}
+}
+
+func TestTransformConstParams(t *testing.T) {
+	src := `package main
+
+type Vec[T, N] [N]T
+
+func Fill[T, N](x T) [N]T {
+	var a [N]T
+	for i := range a {
+		a[i] = x
+	}
+	return a
+}
+
+func main() {
+	var v Vec[int, 3]
+	_ = Fill[string, 2]("x")
+	_ = v
+}
+`
+
+	_, _, output := transformSource(t, src)
+	expected := `package main
+
+type Vec__int__3 [3]int
+
+func Fill__string__2(x string) [2]string {
+	var a [2]string
+	for i := range a {
+		a[i] = x
+	}
+	return a
+}
+
+func main() {
+	var v Vec__int__3
+	_ = Fill__string__2("x")
+	_ = v
+}
+`
+	if string(output) != expected {
+		t.Errorf("wrong output\nexpected:\n%s\ngot:\n%s", expected, output)
+	}
+}
+
+// Constant type arguments are named by their values, so that the usages of
+// an instance are named like its declaration however the constant is written.
+func TestTransformConstArgNames(t *testing.T) {
+	src := `package main
+
+type Vec[T, N] [N]T
+
+const Size = 3
+
+func main() {
+	var a Vec[int, 0x4]
+	var b Vec[int, Size]
+	var c Vec[int, 2+3]
+	var d Vec[int, 1 << 2]
+	_, _, _, _ = a, b, c, d
+}
+`
+
+	_, _, output := transformSource(t, src)
+	expected := `package main
+
+type (
+	Vec__int__3 [3]int
+	Vec__int__4 [4]int
+	Vec__int__5 [5]int
+)
+
+const Size = 3
+
+func main() {
+	var a Vec__int__4
+	var b Vec__int__3
+	var c Vec__int__5
+	var d Vec__int__4
+	_, _, _, _ = a, b, c, d
+}
+`
+	if string(output) != expected {
+		t.Errorf("wrong output\nexpected:\n%s\ngot:\n%s", expected, output)
+	}
+}
+
+func TestTransformEnums(t *testing.T) {
+	src := `package main
+
+type Color enum {
+	Red
+	Green
+}
+
+var strconv = Red
+
+func main() {
+	_ = Green.String()
+}
+`
+
+	_, _, output := transformSource(t, src)
+	expected := `package main
+
+import strconv_ "strconv"
+
+type Color int
+
+const (
+	Red Color = iota
+	Green
+)
+
+func (x Color) String() string {
+	switch x {
+	case Red:
+		return "Red"
+	case Green:
+		return "Green"
+	}
+	return "Color(" + strconv_.Itoa(int(x)) + ")"
+}
+func (x Color) MarshalText() ([]byte, error) { return []byte(x.String()), nil }
+
+var strconv = Red
+
+func main() {
+	_ = Green.String()
+}
+`
+	if string(output) != expected {
+		t.Errorf("wrong output\nexpected:\n%s\ngot:\n%s", expected, output)
+	}
+}
+
+func TestTransformNestedInstances(t *testing.T) {
+	src := `package seqtest
+
+type point struct{ x int }
+
+type Seq[T] func(yield func(T) bool)
+
+func From[T](x T) Seq[T] {
+	return func(yield func(T) bool) { yield(x) }
+}
+
+func (s Seq[T]) Map[U](f func(T) U) Seq[U] {
+	return func(yield func(U) bool) {
+		s(func(x T) bool { return yield(f(x)) })
+	}
+}
+
+var _ = From[point](point{}).Map[Seq[point]](From[point])
+`
+
+	_, _, output := transformSource(t, src)
+	expected := `package seqtest
+
+type point struct{ x int }
+
+type (
+	Seq__Seq_point_ func(yield func(Seq__point) bool)
+	Seq__point      func(yield func(point) bool)
+)
+
+func From__point(x point) Seq__point {
+	return func(yield func(point) bool) { yield(x) }
+}
+
+func (s Seq__point) Map__Seq_point_(f func(point) Seq__point) Seq__Seq_point_ {
+	return func(yield func(Seq__point) bool) {
+		s(func(x point) bool { return yield(f(x)) })
+	}
+}
+
+var _ = From__point(point{}).Map__Seq_point_(From__point)
+`
+	if string(output) != expected {
+		t.Errorf("wrong output\nexpected:\n%s\ngot:\n%s", expected, output)
+	}
+}
+
+// nativeImporter imports the package lib, whose generic declarations
+//
+//	func Map[T, U any](xs []T, f func(T) U) []U
+//	type List[T any] struct{ elems []T }
+//
+// are created as the importer creates those of Go packages.
+type nativeImporter struct{}
+
+func (nativeImporter) Import(path string) (*types.Package, error) {
+	if path != "lib" {
+		return nil, fmt.Errorf("can't find import: %q", path)
+	}
+	pkg := types.NewPackage("lib", "lib")
+	param := func(name string, typ types.Type) *types.Var {
+		return types.NewParam(token.NoPos, pkg, name, typ)
+	}
+
+	tp, up := types.NewTypeParam("T"), types.NewTypeParam("U")
+	mapSig := types.NewGenericSignature(
+		nil,
+		types.NewTuple(param("xs", types.NewSlice(tp)), param("f", types.NewSignature(nil, types.NewTuple(param("", tp)), types.NewTuple(param("", up)), false))),
+		types.NewTuple(param("", types.NewSlice(up))),
+		false,
+		[]*types.TypeParam{tp, up},
+		nil,
+	)
+	mapFunc := types.NewGenericFunc(token.NoPos, pkg, "Map", mapSig)
+	pkg.Scope().Insert(mapFunc)
+	types.AddNativeGeneric(mapFunc)
+
+	elem := types.NewTypeParam("T")
+	obj := types.NewTypeName(token.NoPos, pkg, "List", nil)
+	fields := []*types.Var{types.NewField(token.NoPos, pkg, "elems", types.NewSlice(elem), false)}
+	types.NewGenericNamed(obj, types.NewStruct(fields, nil), nil, []*types.TypeParam{elem})
+	pkg.Scope().Insert(obj)
+	types.AddNativeGeneric(obj)
+
+	pkg.MarkComplete()
+	return pkg, nil
+}
+
+// Instantiations of generic declarations of Go packages are left to the Go
+// compiler, but their type arguments are replaced.
+func TestTransformNative(t *testing.T) {
+	src := `package main
+
+import "lib"
+
+type Box[T] struct{ v T }
+
+func main() {
+	var l lib.List[Box[int]]
+	var b Box[lib.List[string]]
+	ss := lib.Map[int, Box[string]]([]int{1}, func(int) Box[string] { return Box[string]{} })
+	_, _, _ = l, b, ss
+}
+`
+
+	_, _, output := transformSourceWith(t, src, nativeImporter{})
+	expected := `package main
+
+import "lib"
+
+type (
+	Box__int              struct{ v int }
+	Box__lib_List_string_ struct{ v lib.List[string] }
+	Box__string           struct{ v string }
+)
+
+func main() {
+	var l lib.List[Box__int]
+	var b Box__lib_List_string_
+	ss := lib.Map[int, Box__string]([]int{1}, func(int) Box__string { return Box__string{} })
+	_, _, _ = l, b, ss
+}
+`
+	if string(output) != expected {
+		t.Errorf("wrong output\nexpected:\n%s\ngot:\n%s", expected, output)
+	}
+}
+
+// packagesImporter imports the packages it holds by their paths.
+type packagesImporter map[string]*types.Package
+
+func (imp packagesImporter) Import(path string) (*types.Package, error) {
+	if pkg, found := imp[path]; found {
+		return pkg, nil
+	}
+	return nil, fmt.Errorf("can't find import: %q", path)
+}
+
+// checkPackages type-checks the packages with the given paths and sources in
+// order, each of which may import the previous ones. It returns the packages
+// along with their files and types.Info.
+func checkPackages(t *testing.T, fset *token.FileSet, srcs ...string) ([]*types.Package, []*ast.File, []*types.Info) {
+	t.Helper()
+	imp := packagesImporter{}
+	var pkgs []*types.Package
+	var files []*ast.File
+	var infos []*types.Info
+	for i := 0; i < len(srcs); i += 2 {
+		path, src := srcs[i], srcs[i+1]
+		f, pkg, info, err := checktest.Check(&types.Config{Importer: imp}, fset, path, 0, checktest.File{Name: path + ".fo", Src: src})
+		if err != nil {
+			t.Fatal(err)
+		}
+		imp[path] = pkg
+		pkgs, files, infos = append(pkgs, pkg), append(files, f[0]), append(infos, info)
+	}
+	return pkgs, files, infos
+}
+
+// Instances of generic declarations with type arguments from other packages
+// import those packages, and their names do not depend on how the packages
+// are imported where they are used.
+func TestTransformQualifiedTypeArgs(t *testing.T) {
+	other := `package other
+
+type Thing struct{ N int }
+`
+	lib := `package lib
+
+type Box[T] struct{ v T }
+
+func other() {}
+`
+	main := `package main
+
+import (
+	"example.com/lib"
+	o "example.com/other"
+	. "example.com/other"
+)
+
+func main() {
+	_ = lib.Box[o.Thing]{}
+	_ = lib.Box[Thing]{}
+	_ = lib.Box[chan (<-chan o.Thing)]{}
+	_ = lib.Box[func(o.Thing) <-chan Thing]{}
+}
+`
+
+	fset := token.NewFileSet()
+	pkgs, files, infos := checkPackages(t, fset, "example.com/other", other, "example.com/lib", lib, "main", main)
+	for i, expected := range []string{
+		`package lib
+
+import other_ "example.com/other"
+
+type (
+	Box__chan____chan_other_Thing_            struct{ v chan (<-chan other_.Thing) }
+	Box__func_other_Thing____chan_other_Thing struct {
+		v func(other_.Thing) <-chan other_.Thing
+	}
+	Box__other_Thing struct{ v other_.Thing }
+)
+
+func other() {}
+`,
+		`package main
+
+import (
+	"example.com/lib"
+	. "example.com/other"
+	_ "example.com/other"
+)
+
+func main() {
+	_ = lib.Box__other_Thing{}
+	_ = lib.Box__other_Thing{}
+	_ = lib.Box__chan____chan_other_Thing_{}
+	_ = lib.Box__func_other_Thing____chan_other_Thing{}
+}
+`,
+	} {
+		trans := &Transformer{Fset: fset, Pkg: pkgs[i+1], Info: infos[i+1]}
+		transformed, _, err := trans.File(files[i+1])
+		if err != nil {
+			t.Fatalf("File returned error: %s", err.Error())
+		}
+		output := bytes.NewBuffer(nil)
+		if err := format.Node(output, fset, transformed); err != nil {
+			t.Fatalf("format.Node returned error: %s", err.Error())
+		}
+		if output.String() != expected {
+			t.Errorf("wrong output of %s\nexpected:\n%s\ngot:\n%s", pkgs[i+1].Path(), expected, output)
+		}
+	}
+}
+
+// The generic methods which implement a generic interface method are
+// instantiated for the usages of the interface method in other packages.
+func TestTransformInterfaceGenericMethodsAcrossPackages(t *testing.T) {
+	lib := `package lib
+
+type Mapper interface {
+	Map[U](f func(int) U) []U
+}
+
+type Ints []int
+
+func (xs Ints) Map[U](f func(int) U) []U {
+	return nil
+}
+
+func Apply(m Mapper) {
+	m.Map[string](nil)
+}
+`
+	main := `package main
+
+import "example.com/lib"
+
+type Box struct{ v int }
+
+func (b Box) Map[U](f func(int) U) []U {
+	return []U{f(b.v)}
+}
+
+func main() {
+	lib.Apply(Box{})
+	var m lib.Mapper = lib.Ints{}
+	m.Map[bool](nil)
+}
+`
+
+	fset := token.NewFileSet()
+	pkgs, files, infos := checkPackages(t, fset, "example.com/lib", lib, "main", main)
+	for i, expected := range []string{
+		`package lib
+
+type Mapper interface {
+	Map__bool(f func(int) bool) []bool
+	Map__string(f func(int) string) []string
+}
+
+type Ints []int
+
+func (xs Ints) Map__bool(f func(int) bool) []bool {
+	return nil
+}
+func (xs Ints) Map__string(f func(int) string) []string {
+	return nil
+}
+
+func Apply(m Mapper) {
+	m.Map__string(nil)
+}
+`,
+		`package main
+
+import "example.com/lib"
+
+type Box struct{ v int }
+
+func (b Box) Map__bool(f func(int) bool) []bool {
+	return []bool{f(b.v)}
+}
+func (b Box) Map__string(f func(int) string) []string {
+	return []string{f(b.v)}
+}
+
+func main() {
+	lib.Apply(Box{})
+	var m lib.Mapper = lib.Ints{}
+	m.Map__bool(nil)
+}
+`,
+	} {
+		trans := &Transformer{Fset: fset, Pkg: pkgs[i], Info: infos[i]}
+		transformed, _, err := trans.File(files[i])
+		if err != nil {
+			t.Fatalf("File returned error: %s", err.Error())
+		}
+		output := bytes.NewBuffer(nil)
+		if err := format.Node(output, fset, transformed); err != nil {
+			t.Fatalf("format.Node returned error: %s", err.Error())
+		}
+		if output.String() != expected {
+			t.Errorf("wrong output of %s\nexpected:\n%s\ngot:\n%s", pkgs[i].Path(), expected, output)
+		}
+	}
+}
+
+// Instances with type arguments from packages which import the package of
+// the generic declaration cannot be generated.
+func TestTransformImportCycleErrors(t *testing.T) {
+	lib := `package lib
+
+type Box[T] struct{ v T }
+
+func Wrap[T](v T) Box[T] { return Box[T]{v} }
+`
+	main := `package main
+
+import "example.com/lib"
+
+type Mine struct{}
+
+func main() {
+	_ = lib.Box[int]{}
+	_ = lib.Wrap(Mine{})
+}
+`
+
+	fset := token.NewFileSet()
+	pkgs, files, infos := checkPackages(t, fset, "example.com/lib", lib, "example.com/app", main)
+	trans := &Transformer{Fset: fset, Pkg: pkgs[0], Info: infos[0]}
+	_, _, err := trans.File(files[0])
+	errs, ok := err.(scanner.ErrorList)
+	if !ok {
+		t.Fatalf("expected a scanner.ErrorList but got %v", err)
+	}
+	expected := []string{
+		"example.com/app.fo:9:6: instance of Box cannot be generated in package example.com/lib: its type arguments are declared in example.com/app, which imports example.com/lib (import cycle)",
+		"example.com/app.fo:9:6: instance of Wrap cannot be generated in package example.com/lib: its type arguments are declared in example.com/app, which imports example.com/lib (import cycle)",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("wrong errors (expected %q but got %q)", expected, errs)
+	}
+	for i, err := range errs {
+		if err.Error() != expected[i] {
+			t.Errorf("wrong error\nexpected: %s\ngot:      %s", expected[i], err)
+		}
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	src := `package main
+
+// Set is a set of values.
+type Set[T] map[T]bool
+
+type Pair[K, V] struct {
+	Key   K
+	Value V
+}
+
+type Color enum {
+	Red
+	Green
+}
+
+func (s Set[T]) Add(x T) {
+	s[x] = true
+}
+
+// Keys returns the keys of m.
+func Keys[K, V, W](m map[K]V, w W) []Pair[K, W] {
+	var result []Pair[K, W]
+	for k := range m {
+		result = append(result, Pair[K, W]{k, w})
+	}
+	return result
+}
+
+func main() {
+	s := Set[string]{}
+	s.Add("x")
+	_ = Keys[string, bool, Color](s, Red)
+}
+`
+
+	output, err := migrateSource(t, src)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := `package main
+
+import "strconv"
+
+// Set is a set of values.
+type Set[T comparable] map[T]bool
+
+type Pair[K, V any] struct {
+	Key   K
+	Value V
+}
+
+type Color int
+
+const (
+	Red Color = iota
+	Green
+)
+
+func (x Color) String() string {
+	switch x {
+	case Red:
+		return "Red"
+	case Green:
+		return "Green"
+	}
+	return "Color(" + strconv.Itoa(int(x)) + ")"
+}
+
+func (x Color) MarshalText() ([]byte, error) { return []byte(x.String()), nil }
+
+func (s Set[T]) Add(x T) {
+	s[x] = true
+}
+
+// Keys returns the keys of m.
+func Keys[K comparable, V, W any](m map[K]V, w W) []Pair[K, W] {
+	var result []Pair[K, W]
+	for k := range m {
+		result = append(result, Pair[K, W]{k, w})
+	}
+	return result
+}
+
+func main() {
+	s := Set[string]{}
+	s.Add("x")
+	_ = Keys[string, bool, Color](s, Red)
+}
+`
+	if string(output) != expected {
+		t.Errorf("wrong output\nexpected:\n%s\ngot:\n%s", expected, output)
+	}
+}
+
+func TestMigrateErrors(t *testing.T) {
+	src := `package main
+
+type Mapper interface {
+	Map[U](f func(int) U) []U
+}
+
+type Ints []int
+
+func (xs Ints) Map[U](f func(int) U) []U {
+	return nil
+}
+
+type Vec[T, N] [N]T
+
+func main() {
+	var _ Mapper = Ints{}
+	var _ Vec[int, 2]
+}
+`
+
+	_, err := migrateSource(t, src)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	var got []string
+	for _, e := range err.(scanner.ErrorList) {
+		got = append(got, e.Error())
+	}
+	expected := []string{
+		"transform_test.fo:4:5: generic methods are not supported by Go; interface method Map must be removed",
+		"transform_test.fo:9:19: generic methods are not supported by Go; method Map must be turned into a function",
+		"transform_test.fo:13:13: type parameter N of Vec is used as an array length, which is not supported by Go",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("wrong errors\nexpected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+// migrateSource type-checks and migrates src, which is parsed as the file
+// transform_test.fo. It returns the migrated source code and the error
+// returned by Migrate.
+func migrateSource(t *testing.T, src string) ([]byte, error) {
+	t.Helper()
+	fset := token.NewFileSet()
+	files, pkg, info, err := checktest.Check(&types.Config{Importer: unsafeImporter{}}, fset, "transformtest", parser.ParseComments, checktest.File{Name: "transform_test.fo", Src: src})
+	if err != nil {
+		t.Fatal(err)
+	}
+	trans := &Transformer{
+		Fset: fset,
+		Pkg:  pkg,
+		Info: info,
+	}
+	return trans.Migrate(files[0], []byte(src))
+}
+
+func TestTransformBlankShadowedImports(t *testing.T) {
+	src := `package main
+
+import (
+	"unsafe"
+)
+
+type S struct {
+	Pointer int
+}
+
+func Unused[T]() {
+	var _ unsafe.Pointer
+}
+
+func main() {
+	unsafe := S{}
+	_ = unsafe.Pointer
+}
+`
+
+	_, _, output := transformSource(t, src)
+	expected := `package main
+
+import (
+	_ "unsafe"
+)
+
+type S struct {
+	Pointer int
+}
+
+func main() {
+	unsafe := S{}
+	_ = unsafe.Pointer
+}
+`
+	if string(output) != expected {
+		t.Errorf("wrong output\nexpected:\n%s\ngot:\n%s", expected, output)
+	}
+}
+
+func TestTransformImportsUsedInInstances(t *testing.T) {
+	src := `package main
+
+import (
+	"unsafe"
+)
+
+func Used[T]() {
+	var _ unsafe.Pointer
+}
+
+func main() {
+	Used[int]()
+}
+`
+
+	_, _, output := transformSource(t, src)
+	expected := `package main
+
+import (
+	"unsafe"
+)
+
+func Used__int() {
+	var _ unsafe.Pointer
+}
+
+func main() {
+	Used__int()
+}
+`
+	if string(output) != expected {
+		t.Errorf("wrong output\nexpected:\n%s\ngot:\n%s", expected, output)
+	}
+}
+
+// transformSource type-checks and transforms src, which is parsed as the file
+// transform_test.fo. It returns the transformer, the transformed file and its
+// formatted output.
+func transformSource(t *testing.T, src string) (*Transformer, *ast.File, []byte) {
+	t.Helper()
+	return transformSourceWith(t, src, unsafeImporter{})
+}
+
+// transformSourceWith is like transformSource, but imports packages with imp.
+func transformSourceWith(t *testing.T, src string, imp types.Importer) (*Transformer, *ast.File, []byte) {
+	t.Helper()
+	fset := token.NewFileSet()
+	files, pkg, info, err := checktest.Check(&types.Config{Importer: imp}, fset, "transformtest", 0, checktest.File{Name: "transform_test.fo", Src: src})
+	if err != nil {
+		t.Fatal(err)
+	}
+	trans := &Transformer{
+		Fset: fset,
+		Pkg:  pkg,
+		Info: info,
+	}
+	transformed, _, err := trans.File(files[0])
+	if err != nil {
+		t.Fatalf("Transform returned error: %s", err.Error())
+	}
+	output := bytes.NewBuffer(nil)
+	if err := format.Node(output, fset, transformed); err != nil {
+		t.Fatalf("format.Node returned error: %s", err.Error())
+	}
+	return trans, transformed, output.Bytes()
+}
+
+// unsafeImporter only imports package unsafe, which does not depend on export
+// data.
+type unsafeImporter struct{}
+
+func (unsafeImporter) Import(path string) (*types.Package, error) {
+	if path == "unsafe" {
+		return types.Unsafe, nil
+	}
+	return nil, fmt.Errorf("can't find import: %q", path)
+}
+
+func TestTransformProvenance(t *testing.T) {
+	src := `package main
+
+type Box[T] struct {
+	v T
+}
+
+func (b Box[T]) Get() Box[T] {
+	return Box[T]{v: b.v}
+}
+
+type Mapper interface {
+	Map[U](f func(int) U) []U
+}
+
+func main() {
+	b := Box[int]{v: 1}
+	_ = b.Get()
+	var m Mapper
+	_ = m.Map[string]
+}
+`
+	fset := token.NewFileSet()
+	orig, err := parser.ParseFile(fset, "transform_test.fo", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &types.Info{
+		Types:      map[ast.Expr]types.TypeAndValue{},
+		Selections: map[*ast.SelectorExpr]*types.Selection{},
+		TypeArgs:   map[*ast.IndexExpr]*ast.TypeArgExpr{},
+		Uses:       map[*ast.Ident]types.Object{},
+	}
+	pkg, err := (&types.Config{}).Check("transformtest", fset, []*ast.File{orig}, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trans := &Transformer{Fset: fset, Pkg: pkg, Info: info}
+	transformed, provenance, err := trans.File(orig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// describe returns the source text of a node of orig.
+	describe := func(n ast.Node) string {
+		start, end := fset.Position(n.Pos()).Offset, fset.Position(n.End()).Offset
+		if e, ok := n.(*ast.TypeArgExpr); ok {
+			// the position of a TypeArgExpr is that of its "["
+			start = fset.Position(e.X.Pos()).Offset
+		}
+		return fmt.Sprintf("%T %s", n, strings.SplitN(src[start:end], "\n", 2)[0])
+	}
+	var got []string
+	ast.Inspect(transformed, func(n ast.Node) bool {
+		if origin, found := provenance[n]; found {
+			got = append(got, fmt.Sprintf("%s <- %s", types.ExprString(nameOf(n)), describe(origin)))
+		}
+		return true
+	})
+	expected := []string{
+		"Box__int <- *ast.TypeSpec Box[T] struct {",
+		"Get <- *ast.FuncDecl func (b Box[T]) Get() Box[T] {",
+		"Box__int <- *ast.TypeArgExpr Box[T]",
+		"Box__int <- *ast.TypeArgExpr Box[T]",
+		"Box__int <- *ast.TypeArgExpr Box[T]",
+		"Map__string <- *ast.Field Map[U](f func(int) U) []U",
+		"Box__int <- *ast.TypeArgExpr Box[int]",
+		"m.Map__string <- *ast.IndexExpr m.Map[string]",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got provenance\n%s\nexpected\n%s", strings.Join(got, "\n"), strings.Join(expected, "\n"))
+	}
+	for n := range provenance {
+		if decl, ok := n.(*ast.FuncDecl); ok {
+			if _, found := trans.InstanceOf(decl); !found {
+				t.Errorf("no instance for %s", decl.Name.Name)
+			}
+		}
+	}
+}
+
+// nameOf returns the name of a generated node.
+func nameOf(n ast.Node) ast.Expr {
+	switch n := n.(type) {
+	case *ast.TypeSpec:
+		return n.Name
+	case *ast.FuncDecl:
+		return n.Name
+	case *ast.Field:
+		return n.Names[0]
+	}
+	return n.(ast.Expr)
+}
+
+// pkgImporter imports package unsafe and the packages it holds by import
+// path.
+type pkgImporter map[string]*types.Package
+
+func (imp pkgImporter) Import(path string) (*types.Package, error) {
+	if path == "unsafe" {
+		return types.Unsafe, nil
+	}
+	if pkg, found := imp[path]; found {
+		return pkg, nil
+	}
+	return nil, fmt.Errorf("can't find import: %q", path)
+}
+
+func TestTransformUnexportedInstances(t *testing.T) {
+	libSrc := `package lib
+
+type Box[T] struct {
+	v T
+}
+
+func (b Box[T]) Get() T {
+	return b.v
+}
+
+func (b Box[T]) Map[U](f func(T) U) Box[U] {
+	return Wrap[U](f(b.v))
+}
+
+func Wrap[T](v T) Box[T] {
+	return Box[T]{v: v}
+}
+
+func Sum[T](xs ...T) T {
+	var sum T
+	return sum
+}
+
+func Sum__float64(xs ...float64) float64 {
+	return 0
+}
+
+type wrap__bool struct{}
+
+type pair[T] struct {
+	a, b T
+}
+
+func Use() {
+	_ = Wrap[int](1).Get()
+	_ = Wrap[bool](true)
+	_ = Box[int]{}.Map[byte](nil)
+	_ = Sum[int](1, 2) + int(Sum[float64](1))
+	_ = pair[int]{}
+}
+`
+	mainSrc := `package main
+
+import "lib"
+
+func main() {
+	_ = lib.Wrap[string]("x").Map[int](nil)
+}
+`
+	fset := token.NewFileSet()
+	libFile, err := parser.ParseFile(fset, "lib.fo", libSrc, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mainFile, err := parser.ParseFile(fset, "main.fo", mainSrc, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &types.Info{
+		Types:      map[ast.Expr]types.TypeAndValue{},
+		Selections: map[*ast.SelectorExpr]*types.Selection{},
+		TypeArgs:   map[*ast.IndexExpr]*ast.TypeArgExpr{},
+		Uses:       map[*ast.Ident]types.Object{},
+	}
+	lib, err := (&types.Config{Importer: unsafeImporter{}}).Check("lib", fset, []*ast.File{libFile}, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&types.Config{Importer: pkgImporter{"lib": lib}}).Check("main", fset, []*ast.File{mainFile}, nil); err != nil {
+		t.Fatal(err)
+	}
+	trans := &Transformer{
+		Fset:                fset,
+		Pkg:                 lib,
+		Info:                info,
+		UnexportedInstances: true,
+	}
+	transformed, _, err := trans.File(libFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := bytes.NewBuffer(nil)
+	if err := format.Node(output, fset, transformed); err != nil {
+		t.Fatal(err)
+	}
+
+	// main uses Wrap[string], Box[string] and Box[int], the result type of
+	// Map[int]. Wrap[int] is only called by the code generated for Map[int],
+	// which is in lib. Wrap[bool] keeps its name, which would otherwise
+	// collide with wrap__bool, and so does the specialization of Sum[float64].
+	expected := `package lib
+
+type (
+	Box__int struct {
+		v int
+	}
+	Box__string struct {
+		v string
+	}
+	box__bool struct {
+		v bool
+	}
+	box__byte struct {
+		v byte
+	}
+)
+
+func (b box__bool) Get() bool {
+	return b.v
+}
+func (b box__byte) Get() byte {
+	return b.v
+}
+func (b Box__int) Get() int {
+	return b.v
+}
+func (b Box__string) Get() string {
+	return b.v
+}
+
+func (b Box__int) Map__byte(f func(int) byte) box__byte {
+	return wrap__byte(f(b.v))
+}
+func (b Box__string) Map__int(f func(string) int) Box__int {
+	return wrap__int(f(b.v))
+}
+
+func Wrap__bool(v bool) box__bool {
+	return box__bool{v: v}
+}
+func Wrap__string(v string) Box__string {
+	return Box__string{v: v}
+}
+func wrap__byte(v byte) box__byte {
+	return box__byte{v: v}
+}
+func wrap__int(v int) Box__int {
+	return Box__int{v: v}
+}
+
+func sum__int(xs ...int) int {
+	var sum int
+	return sum
+}
+
+func Sum__float64(xs ...float64) float64 {
+	return 0
+}
+
+type wrap__bool struct{}
+
+type pair__int struct {
+	a, b int
+}
+
+func Use() {
+	_ = wrap__int(1).Get()
+	_ = Wrap__bool(true)
+	_ = Box__int{}.Map__byte(nil)
+	_ = sum__int(1, 2) + int(Sum__float64(1))
+	_ = pair__int{}
+}
+`
+	if output.String() != expected {
+		diff := difflib.Diff(strings.Split(expected, "\n"), strings.Split(output.String(), "\n"))
+		diffStrings := ""
+		for _, d := range diff {
+			diffStrings += d.String() + "\n"
+		}
+		t.Fatalf("output of Transform did not match expected\n\n%s", diffStrings)
+	}
+}
+
+func TestTransformGoVersion(t *testing.T) {
+	src := `package main
+
+func Kind[T](x T) string {
+	switch x.(type) {
+	case int:
+		return "int"
+	}
+	return "other"
+}
+
+func main() {
+	a, b := 3, 7
+	_ = min(a, b)
+	_ = max(a, 2)
+	_ = clamp(a, 0, b)
+	_ = Kind(a)
+}
+`
+
+	expected := `package main
+
+func Kind__int(x int) string {
+	switch any(x).(type) {
+	case int:
+		return "int"
+	}
+	return "other"
+}
+
+func main() {
+	a, b := 3, 7
+	_ = min(a, b)
+	_ = max(a, 2)
+	_ = func(x, lo, hi int) int {
+		if x < lo {
+			return lo
+		}
+		if x > hi {
+			return hi
+		}
+		return x
+	}(a, 0, b)
+	_ = Kind__int(a)
+}
+`
+	fset := token.NewFileSet()
+	orig, err := parser.ParseFile(fset, "transform_test.fo", src, 0)
+	if err != nil {
+		t.Fatalf("ParseFile returned error: %s", err.Error())
+	}
+	info := &types.Info{
+		Types:            map[ast.Expr]types.TypeAndValue{},
+		Selections:       map[*ast.SelectorExpr]*types.Selection{},
+		TypeArgs:         map[*ast.IndexExpr]*ast.TypeArgExpr{},
+		InferredTypeArgs: map[ast.Expr][]types.Type{},
+		Uses:             map[*ast.Ident]types.Object{},
+	}
+	pkg, err := (&types.Config{GoVersion: "1.21"}).Check("transformtest", fset, []*ast.File{orig}, info)
+	if err != nil {
+		t.Fatalf("conf.Check returned error: %s", err.Error())
+	}
+	trans := &Transformer{
+		Fset:      fset,
+		Pkg:       pkg,
+		Info:      info,
+		GoVersion: types.GoVersion{Major: 1, Minor: 21},
+	}
+	transformed, _, err := trans.File(orig)
+	if err != nil {
+		t.Fatalf("File returned error: %s", err.Error())
+	}
+	fset, renumbered := trans.Renumber(transformed, "transform_test.go")
+	output := bytes.NewBuffer(nil)
+	if err := format.Node(output, fset, renumbered); err != nil {
+		t.Fatalf("format.Node returned error: %s", err.Error())
+	}
+	if output.String() != expected {
+		t.Errorf("wrong output\nexpected:\n%s\ngot:\n%s", expected, output.String())
+	}
+}
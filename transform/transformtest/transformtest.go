@@ -0,0 +1,130 @@
+// Package transformtest helps write tests for transformations of Fo source
+// files into Go source files, either with the expected output inline or in
+// golden files.
+//
+// A typical golden test transforms each .fo file of a testdata directory and
+// compares the result with the .golden file next to it:
+//
+//	func TestGolden(t *testing.T) {
+//		sources, _ := filepath.Glob("testdata/*.fo")
+//		for _, source := range sources {
+//			transformtest.Golden(t, source, strings.TrimSuffix(source, ".fo")+".golden", *update)
+//		}
+//	}
+//
+// where update is a flag declared by the test, so that running the tests with
+// go test -update writes the golden files instead.
+package transformtest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/aryann/difflib"
+	"github.com/qProust/fo/format"
+	"github.com/qProust/fo/importer"
+	"github.com/qProust/fo/token"
+	"github.com/qProust/fo/transform"
+	"github.com/qProust/fo/transform/internal/checktest"
+	"github.com/qProust/fo/types"
+)
+
+// Transform parses, type-checks and transforms the Fo source file src and
+// returns the formatted Go output, renumbered like the output of the fo
+// command (see transform.Transformer.Renumber). The file is checked as
+// package transformtest, with the default importer. The filename is only used
+// for positions in errors.
+func Transform(filename string, src []byte) ([]byte, error) {
+	return TransformWith(filename, src, Options{})
+}
+
+// Options configures TransformWith.
+type Options struct {
+	// Importer imports the packages which the source file imports. If nil,
+	// the default importer is used.
+	Importer types.Importer
+}
+
+// TransformWith is like Transform, but checks the file with opts.
+func TransformWith(filename string, src []byte, opts Options) ([]byte, error) {
+	conf := &types.Config{Importer: opts.Importer}
+	if conf.Importer == nil {
+		conf.Importer = importer.Default()
+	}
+	fset := token.NewFileSet()
+	files, pkg, info, err := checktest.Check(conf, fset, "transformtest", 0, checktest.File{Name: filename, Src: string(src)})
+	if err != nil {
+		return nil, err
+	}
+	trans := &transform.Transformer{
+		Fset: fset,
+		Pkg:  pkg,
+		Info: info,
+	}
+	transformed, _, err := trans.File(files[0])
+	if err != nil {
+		return nil, fmt.Errorf("Transform returned error: %s", err.Error())
+	}
+	fset, renumbered := trans.Renumber(transformed, filename)
+	output := bytes.NewBuffer(nil)
+	if err := format.Node(output, fset, renumbered); err != nil {
+		return nil, fmt.Errorf("format.Node returned error: %s", err.Error())
+	}
+	return output.Bytes(), nil
+}
+
+// Check transforms the Fo source src and fails t, with a diff, unless the
+// output is expected.
+func Check(t testing.TB, src string, expected string) {
+	t.Helper()
+	output, err := Transform("transform_test", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(output) != expected {
+		t.Fatalf("output of Transform did not match expected\n\n%s", Diff(expected, string(output)))
+	}
+}
+
+// Golden transforms the Fo source file source and fails t, with a diff,
+// unless the output is the content of the file golden. If update is set, it
+// writes the output to golden instead.
+func Golden(t testing.TB, source, golden string, update bool) {
+	t.Helper()
+	src, err := ioutil.ReadFile(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := Transform(source, src)
+	if err != nil {
+		t.Fatalf("%s: %s", source, err)
+	}
+	if update {
+		if err := ioutil.WriteFile(golden, output, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	expected, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(output, expected) {
+		t.Fatalf("output of Transform for %s did not match %s\n\n%s", source, golden, Diff(string(expected), string(output)))
+	}
+}
+
+// Diff returns a line by line diff of expected and got, with lines that are
+// only in expected prefixed by "- " and lines that are only in got prefixed by
+// "+ ".
+func Diff(expected, got string) string {
+	diff := difflib.Diff(strings.Split(expected, "\n"), strings.Split(got, "\n"))
+	diffStrings := ""
+	for _, d := range diff {
+		diffStrings += d.String() + "\n"
+	}
+	return diffStrings
+}
@@ -0,0 +1,62 @@
+package transform
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/qProust/fo/ast"
+)
+
+// localName returns the name of the concrete declaration which is named name
+// by default (e.g. Box__int), as it is referred to in the package of its
+// generic declaration. It differs from name only if UnexportedInstances is set
+// (see findUnexportedNames).
+func (trans *Transformer) localName(name string) string {
+	if !trans.UnexportedInstances {
+		return name
+	}
+	trans.unexportedOnce.Do(trans.findUnexportedNames)
+	if unexported, found := trans.unexported[name]; found {
+		return unexported
+	}
+	return name
+}
+
+// findUnexportedNames determines the concrete declarations of trans.Pkg which
+// are renamed because of UnexportedInstances: those generated for exported
+// generic types and functions which no other package refers to, as reported
+// by types.GenericDecl.UsedElsewhere. Generic methods keep their names, and so
+// do the declarations whose unexported name would be taken by another
+// declaration or a hand-written specialization.
+func (trans *Transformer) findUnexportedNames() {
+	trans.unexported = map[string]string{}
+	taken := map[string]bool{}
+	var candidates []string
+	for key, decl := range trans.Pkg.Generics() {
+		if decl.Native {
+			continue
+		}
+		for _, usg := range decl.Usages {
+			name := trans.instanceName(decl, usg)
+			taken[name] = true
+			if strings.Contains(key, ".") || !ast.IsExported(name) || decl.UsedElsewhere(usg) {
+				continue
+			}
+			if trans.Pkg.Scope().Lookup(name) != nil {
+				// The instance is specialized by a hand-written declaration.
+				continue
+			}
+			candidates = append(candidates, name)
+		}
+	}
+	for _, name := range candidates {
+		r, size := utf8.DecodeRuneInString(name)
+		unexported := string(unicode.ToLower(r)) + name[size:]
+		if taken[unexported] || trans.Pkg.Scope().Lookup(unexported) != nil {
+			continue
+		}
+		taken[unexported] = true
+		trans.unexported[name] = unexported
+	}
+}
@@ -41,10 +41,11 @@ import (
 // package (such as "unused variable"); "hard" errors may lead to unpredictable
 // behavior if ignored.
 type Error struct {
-	Fset *token.FileSet // file set for interpretation of Pos
-	Pos  token.Pos      // error position
-	Msg  string         // error message
-	Soft bool           // if set, error is "soft"
+	Fset    *token.FileSet // file set for interpretation of Pos
+	Pos     token.Pos      // error position
+	Msg     string         // error message
+	Soft    bool           // if set, error is "soft"
+	Warning bool           // if set, error is a warning (see Config.Warn)
 }
 
 // Error returns an error string formatted as follows:
@@ -95,7 +96,10 @@ type ImporterFrom interface {
 // The zero value for Config is a ready-to-use default configuration.
 type Config struct {
 	// If IgnoreFuncBodies is set, function bodies are not
-	// type-checked.
+	// type-checked. The usages of generic declarations in them
+	// are not recorded either, so the package can't be
+	// transformed, and unused generic declarations are not
+	// reported. This is meant for quick diagnostics in editors.
 	IgnoreFuncBodies bool
 
 	// If FakeImportC is set, `import "C"` (for packages requiring Cgo)
@@ -131,6 +135,89 @@ type Config struct {
 	// If DisableUnusedImportCheck is set, packages are not checked
 	// for unused imports.
 	DisableUnusedImportCheck bool
+
+	// If Warn != nil, it is called with each warning found during
+	// type checking; err has dynamic type Error with Warning set.
+	// Warnings do not stop type checking and are not returned by
+	// Check.
+	Warn func(err error)
+
+	// If WarningsAsErrors is set, warnings are reported as soft
+	// errors instead, like the errors of the Strict options, so
+	// that they cause type checking to fail.
+	WarningsAsErrors bool
+
+	// If WarnUnusedGenerics is set, a warning is reported for each
+	// generic type or function which is never instantiated. Such
+	// declarations do not generate any code, which is usually a
+	// mistake. Exported declarations are only reported in package
+	// main, since other packages may instantiate them.
+	WarnUnusedGenerics bool
+
+	// If StrictUnusedGenerics is set, the generic declarations
+	// described for WarnUnusedGenerics are reported as errors
+	// instead of warnings.
+	StrictUnusedGenerics bool
+
+	// If WarnIncompleteSwitches is set, a warning is reported for
+	// each type switch without a default case which handles some
+	// instantiations of a generic type, but not all of the
+	// instantiations known when the package is checked (see
+	// Package.Generics). Instantiations which cannot be stored in
+	// the operand of the switch are not required.
+	WarnIncompleteSwitches bool
+
+	// If StrictIncompleteSwitches is set, the type switches
+	// described for WarnIncompleteSwitches are reported as errors
+	// instead of warnings.
+	StrictIncompleteSwitches bool
+
+	// If WarnUnusedTypeParams is set, a warning is reported for
+	// each type parameter which is not used in the declaration of
+	// its generic type, function or method. Type parameters of
+	// receivers are exempt, since all of them have to be listed.
+	WarnUnusedTypeParams bool
+
+	// If WarnShadowedTypeParams is set, a warning is reported for
+	// each type parameter which has the name of a declaration in an
+	// enclosing scope, such as a package-level type or a predeclared
+	// type like int.
+	WarnShadowedTypeParams bool
+
+	// If WarnImplicitConstraints is set, a warning is reported for
+	// each type parameter which is declared without a constraint
+	// and is therefore implicitly constrained by interface{}.
+	// Type parameters of receivers are exempt.
+	WarnImplicitConstraints bool
+
+	// MaxInstantiationDepth limits how deeply the creation of
+	// concrete types may nest, e.g. when the instantiation of a
+	// generic type requires instantiating it again with different
+	// type arguments. If the limit is exceeded, an error listing
+	// the chain of instantiations is reported. If zero, a default
+	// of 100 is used.
+	MaxInstantiationDepth int
+
+	// MaxInstantiations limits the total number of concrete types
+	// and functions which may be created for a package. If zero,
+	// a default of 100000 is used.
+	MaxInstantiations int
+
+	// If TraceInstantiation != nil, it is called with each
+	// instantiation of a generic type or function, whether written
+	// (e.g. Box[int]), inferred or required by another one, once
+	// its type has been created or found in the cache of concrete
+	// types. This is meant for debugging the instantiations chosen
+	// by the type checker.
+	TraceInstantiation func(inst Instantiation)
+
+	// GoVersion is the version of Go which the generated code
+	// targets, e.g. "1.17" (see ParseGoVersion). Constructs which
+	// cannot be translated for an earlier version are reported as
+	// errors, e.g. instantiations of the generic declarations of Go
+	// packages, which require Go 1.18. If empty, the latest version
+	// is targeted.
+	GoVersion string
 }
 
 // Info holds result type information for a type-checked package.
@@ -190,6 +277,22 @@ type Info struct {
 	// to their corresponding selections.
 	Selections map[*ast.SelectorExpr]*Selection
 
+	// TypeArgs maps index expressions which denote instantiations of generic
+	// types or functions with a single type argument (e.g. Box[int], which
+	// the parser cannot tell apart from an index expression) to the type
+	// argument expressions they stand for. Index expressions whose operand is
+	// a value, including a value of a generic type, are not recorded.
+	TypeArgs map[*ast.IndexExpr]*ast.TypeArgExpr
+
+	// InferredTypeArgs maps the expressions which instantiate a generic
+	// declaration without giving its type arguments to the type arguments
+	// which were inferred, in the order of its type parameters. The
+	// expressions are calls of generic functions and methods (e.g. Map(xs, f)
+	// or l.Map(f)), whose type arguments are inferred from the arguments of
+	// the call, and composite literals of generic types (e.g. Box{v: 3}),
+	// whose type arguments are those of the type they are assigned to.
+	InferredTypeArgs map[ast.Expr][]Type
+
 	// Scopes maps ast.Nodes to the scopes they define. Package scopes are not
 	// associated with a specific node but with all files belonging to a package.
 	// Thus, the package scope can be found in the type-checked Package object.
@@ -221,6 +324,8 @@ type Info struct {
 	// in source order. Variables without an initialization expression do not
 	// appear in this list.
 	InitOrder []*Initializer
+
+	origins map[token.Pos]Object // index used by OriginOf; built lazily
 }
 
 // TypeOf returns the type of expression e, or nil if not found.
@@ -253,6 +358,49 @@ func (info *Info) ObjectOf(id *ast.Ident) Object {
 	return info.Uses[id]
 }
 
+// SelectionOf returns the selection denoted by the selector expression e,
+// or nil if e is not recorded in the Selections map (e.g., because it is a
+// qualified identifier).
+//
+// Precondition: the Selections map is populated.
+//
+func (info *Info) SelectionOf(e *ast.SelectorExpr) *Selection {
+	return info.Selections[e]
+}
+
+// OriginOf returns the object denoted by the specified id, or nil if not
+// found. Unlike ObjectOf, id may also be an identifier in a concrete
+// declaration which was generated from a generic one (e.g., by package
+// transform). Such identifiers are copies of identifiers in the checked
+// files, and are matched with the originals by position, so the result is
+// the object of the generic declaration (e.g., the *TypeName of Box for the
+// name of a generated type Box__int).
+//
+// OriginOf must only be called once type checking is complete.
+//
+// Precondition: the Uses and Defs maps are populated.
+//
+func (info *Info) OriginOf(id *ast.Ident) Object {
+	if obj := info.ObjectOf(id); obj != nil {
+		return obj
+	}
+	if !id.Pos().IsValid() {
+		return nil
+	}
+	if info.origins == nil {
+		info.origins = make(map[token.Pos]Object, len(info.Defs)+len(info.Uses))
+		for id, obj := range info.Uses {
+			info.origins[id.Pos()] = obj
+		}
+		for id, obj := range info.Defs {
+			if obj != nil {
+				info.origins[id.Pos()] = obj
+			}
+		}
+	}
+	return info.origins[id.Pos()]
+}
+
 // TypeAndValue reports the type and value (for constants)
 // of the corresponding expression.
 type TypeAndValue struct {
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"reflect"
 	"regexp"
+	"sort"
 	"strings"
 	"testing"
 
@@ -328,6 +329,48 @@ func TestImplicitsInfo(t *testing.T) {
 	}
 }
 
+func TestTypeArgsInfo(t *testing.T) {
+	var tests = []struct {
+		src  string
+		want []string // type argument expressions, in source order
+	}{
+		{`package t0; type Box[T] struct{}; var _ Box[int]`, nil}, // parsed as a type argument expression
+		{`package t1; type Box[T] struct{}; var _ = Box[string]{}`, nil},
+		{`package t2; func F[T](x T) T { return x }; var _ = F[int](1)`, []string{"F[int]"}},
+		{`package t3; type Box[T] struct{}; func (Box[T]) Get[U]() {}; var _ = Box[int]{}.Get[bool]`, []string{"(Box[int] literal).Get[bool]"}},
+		{`package t4; func F[T](x T) T { return x }; func G[U](x U) { _ = F[U] }; var _ = G[int]`, []string{"F[U]", "G[int]"}},
+		{`package t5; type Box[T, U] struct{}; var _ Box[int, bool]`, nil}, // no ambiguity
+		{`package t6; var a []int; var _ = a[0]`, nil},
+		// A local variable which shadows a generic function.
+		{`package t7; func F[T](x T) T { return x }; func _() { F := []int{1}; _ = F[0] }`, nil},
+	}
+
+	for _, test := range tests {
+		info := Info{
+			TypeArgs: make(map[*ast.IndexExpr]*ast.TypeArgExpr),
+		}
+		name := mustTypecheck(t, "TypeArgsInfo", test.src, &info)
+
+		var exprs []*ast.IndexExpr
+		for x, e := range info.TypeArgs {
+			if e.X != x.X || len(e.Types) != 1 || e.Types[0] != x.Index {
+				t.Errorf("package %s: %s recorded as %s", name, ExprString(x), ExprString(e))
+			}
+			exprs = append(exprs, x)
+		}
+		sort.Slice(exprs, func(i, j int) bool {
+			return exprs[i].Pos() < exprs[j].Pos()
+		})
+		var got []string
+		for _, x := range exprs {
+			got = append(got, ExprString(x))
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("package %s: got %q; want %q", name, got, test.want)
+		}
+	}
+}
+
 func predString(tv TypeAndValue) string {
 	var buf bytes.Buffer
 	pred := func(b bool, s string) {
@@ -699,6 +742,24 @@ func TestInitOrderInfo(t *testing.T) {
 		var x2 = 0`, []string{
 			"x1 = 0", "y1 = f1()", "x2 = 0", "y2 = f2()",
 		}},
+		// dependencies through instantiations of generic functions and types
+		{`package p16
+
+		var a = first[int]()
+		var b = Box[string]{}.Get()
+		var c = Box[int]{}.Map[string]()
+
+		func first[T]() int { return second[T]() }
+		func second[T]() int { return x }
+
+		type Box[T] struct{}
+
+		func (Box[T]) Get() int { return y }
+		func (Box[T]) Map[U]() int { return z }
+
+		var x, y, z = 1, 2, 3`, []string{
+			"x = 1", "a = first[int]()", "y = 2", "b = (Box[string] literal).Get()", "z = 3", "c = (Box[int] literal).Map[string]()",
+		}},
 	}
 
 	for _, test := range tests {
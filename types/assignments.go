@@ -66,6 +66,12 @@ func (check *Checker) assignment(x *operand, T Type, context string) {
 	}
 
 	if reason := ""; !x.assignableTo(check.conf, T, &reason) {
+		if Ti, ok := T.Underlying().(*Interface); ok {
+			if m, wrongType := MissingMethod(x.typ, Ti, true); m != nil {
+				// describe the methods of instances of generic types
+				reason = check.missingMethodReason(x.typ, m, wrongType)
+			}
+		}
 		if reason != "" {
 			check.errorf(x.pos(), "cannot use %s as %s value in %s: %s", x, T, context, reason)
 		} else {
@@ -214,7 +220,13 @@ func (check *Checker) assignVar(lhs ast.Expr, x *operand) Type {
 // return expressions, and returnPos is the position of the return statement.
 func (check *Checker) initVars(lhs []*Var, rhs []ast.Expr, returnPos token.Pos) {
 	l := len(lhs)
-	get, r, commaOk := unpack(func(x *operand, i int) { check.multiExpr(x, rhs[i]) }, len(rhs), l == 2 && !returnPos.IsValid())
+	get, r, commaOk := unpack(func(x *operand, i int) {
+		var hint Type
+		if l == len(rhs) {
+			hint = lhs[i].typ
+		}
+		check.multiExprWithHint(x, rhs[i], hint)
+	}, len(rhs), l == 2 && !returnPos.IsValid())
 	if get == nil || l != r {
 		// invalidate lhs and use rhs
 		for _, obj := range lhs {
@@ -56,7 +56,7 @@ func (check *Checker) builtin(x *operand, call *ast.CallExpr, id builtinId) (_ b
 				return
 			}
 		}
-	case _Make, _New, _Offsetof, _Trace:
+	case _AssertImplements, _Clamp, _Make, _Max, _Min, _New, _Offsetof, _Trace:
 		// arguments require special handling
 	}
 
@@ -134,6 +134,44 @@ func (check *Checker) builtin(x *operand, call *ast.CallExpr, id builtinId) (_ b
 			check.recordBuiltinType(call.Fun, sig)
 		}
 
+	case _AssertImplements:
+		// assertImplements[T, I]() asserts that the type T implements the
+		// interface I. No code is generated for it.
+		fun := unparen(call.Fun)
+		var targs []ast.Expr
+		switch e := fun.(type) {
+		case *ast.TypeArgExpr:
+			fun, targs = e.X, e.Types
+		case *ast.IndexExpr:
+			fun, targs = e.X, []ast.Expr{e.Index}
+		}
+		if len(targs) != 2 {
+			check.errorf(fun.Pos(), "%s requires 2 type arguments (a type and an interface), found %d", fun, len(targs))
+			return
+		}
+		// evaluated like the type arguments of a generic type (see createTypeMap)
+		var targ [2]operand
+		for i, e := range targs {
+			check.rawExpr(&targ[i], e, nil)
+			if targ[i].mode != typexpr {
+				if targ[i].mode != invalid {
+					check.errorf(e.Pos(), "%s is not a type", &targ[i])
+				}
+				return
+			}
+			check.typeArgsRequired(e.Pos(), targ[i].typ)
+		}
+		T, I := targ[0].typ, targ[1].typ
+		if _, isTypeParam := I.(*TypeParam); isTypeParam || !IsInterface(I) {
+			check.invalidArg(targs[1].Pos(), "%s is not an interface", I)
+			return
+		}
+		check.assertImplements(targs[0].Pos(), T, I)
+		x.mode = novalue
+		if check.Types != nil {
+			check.recordBuiltinType(call.Fun, makeSig(nil))
+		}
+
 	case _Cap, _Len:
 		// cap(x)
 		// len(x)
@@ -157,7 +195,9 @@ func (check *Checker) builtin(x *operand, call *ast.CallExpr, id builtinId) (_ b
 			// if the type of s is an array or pointer to an array and
 			// the expression s does not contain channel receives or
 			// function calls; in this case s is not evaluated."
-			if !check.hasCallOrRecv {
+			// The length of an array whose length is a type parameter is only
+			// known once the type parameter is replaced.
+			if !check.hasCallOrRecv && t.lenParam == nil {
 				mode = constant_
 				val = constant.MakeInt64(t.len)
 			}
@@ -183,6 +223,68 @@ func (check *Checker) builtin(x *operand, call *ast.CallExpr, id builtinId) (_ b
 			check.recordBuiltinType(call.Fun, makeSig(x.typ, typ))
 		}
 
+	case _Clamp, _Max, _Min:
+		// clamp(x, lo, hi T) T
+		// max(x T, y ...T) T
+		// min(x T, y ...T) T
+		// where T is an ordered type which is inferred from the arguments
+		// (no argument evaluated yet)
+		args := make([]*operand, nargs)
+		valid := true
+		for i := range args {
+			args[i] = new(operand)
+			check.expr(args[i], call.Args[i])
+			valid = valid && args[i].mode != invalid
+		}
+		if !valid {
+			return
+		}
+		typ := check.orderedOperands(args)
+		if typ == nil {
+			return
+		}
+
+		// the result is one of the arguments, and a constant if all of them are
+		allConst := true
+		for _, a := range args {
+			allConst = allConst && a.mode == constant_
+		}
+		*x = *args[0]
+		switch {
+		case id == _Clamp && allConst:
+			lo, hi := args[1], args[2]
+			if constant.Compare(lo.val, token.GTR, hi.val) {
+				check.invalidArg(lo.pos(), "lower bound %s is greater than upper bound %s", lo, hi)
+				return
+			}
+			if constant.Compare(x.val, token.LSS, lo.val) {
+				x.val = lo.val
+			} else if constant.Compare(x.val, token.GTR, hi.val) {
+				x.val = hi.val
+			}
+		case allConst:
+			op := token.LSS
+			if id == _Max {
+				op = token.GTR
+			}
+			for _, a := range args[1:] {
+				if constant.Compare(a.val, op, x.val) {
+					x.val = a.val
+				}
+			}
+		default:
+			x.mode = value
+		}
+		x.typ = typ
+
+		if check.Types != nil && x.mode != constant_ {
+			params := make([]Type, nargs)
+			for i := range params {
+				params[i] = typ
+			}
+			check.recordBuiltinType(call.Fun, makeSig(typ, params...))
+		}
+
 	case _Close:
 		// close(c)
 		c, _ := x.typ.Underlying().(*Chan)
@@ -627,6 +729,53 @@ func (check *Checker) builtin(x *operand, call *ast.CallExpr, id builtinId) (_ b
 	return true
 }
 
+// orderedOperands converts the untyped arguments args of a call of min, max
+// or clamp to the type of the typed ones, which must all be identical, and
+// returns it. If all the arguments are untyped, their type is the one of the
+// largest kind, as for untyped constant operands (e.g. untyped float for 1
+// and 2.5), or its default type if not all of them are constants. It reports
+// an error and returns nil if the arguments have no common type, or if it is
+// not ordered (which includes type parameters).
+func (check *Checker) orderedOperands(args []*operand) Type {
+	var first *operand // the argument whose type is the one of all of them
+	for _, a := range args {
+		if isTyped(a.typ) {
+			first = a
+			break
+		}
+	}
+	typ := Type(nil)
+	if first != nil {
+		typ = first.typ
+	} else {
+		allConst := true
+		for _, a := range args {
+			if typ == nil || isNumeric(typ) && isNumeric(a.typ) && typ.(*Basic).kind < a.typ.(*Basic).kind {
+				first, typ = a, a.typ
+			}
+			allConst = allConst && a.mode == constant_
+		}
+		if !allConst {
+			typ = Default(typ)
+		}
+	}
+	if !isOrdered(typ) {
+		check.invalidArg(first.pos(), "%s cannot be ordered", first)
+		return nil
+	}
+	for _, a := range args {
+		check.convertUntyped(a, typ)
+		if a.mode == invalid {
+			return nil
+		}
+		if !Identical(a.typ, typ) {
+			check.invalidArg(a.pos(), "mismatched types %s and %s", typ, a.typ)
+			return nil
+		}
+	}
+	return typ
+}
+
 // makeSig makes a signature for the given argument and result types.
 // Default types are used for untyped arguments, and res may be nil.
 func makeSig(res Type, args ...Type) *Signature {
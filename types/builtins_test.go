@@ -27,11 +27,18 @@ var builtinCalls = []struct {
 	{"append", `type T []byte; var s T; var str string; _ = append(s, str...)`, `func(p.T, string...) p.T`},
 	{"append", `type T []byte; type U string; var s T; var str U; _ = append(s, str...)`, `func(p.T, p.U...) p.T`},
 
+	{"assertImplements", `type I interface{}; assertImplements[int, I]()`, `func()`},
+	{"assertImplements", `type T struct{}; assertImplements[(*T), interface{}]()`, `func()`},
+
 	{"cap", `var s [10]int; _ = cap(s)`, `invalid type`},  // constant
 	{"cap", `var s [10]int; _ = cap(&s)`, `invalid type`}, // constant
 	{"cap", `var s []int64; _ = cap(s)`, `func([]int64) int`},
 	{"cap", `var c chan<-bool; _ = cap(c)`, `func(chan<- bool) int`},
 
+	{"clamp", `_ = clamp(5, 0, 3)`, `invalid type`}, // constant
+	{"clamp", `var x int; _ = clamp(x, 0, 3)`, `func(int, int, int) int`},
+	{"clamp", `type T string; var s T; _ = clamp(s, "a", "m")`, `func(p.T, p.T, p.T) p.T`},
+
 	{"len", `_ = len("foo")`, `invalid type`}, // constant
 	{"len", `var s string; _ = len(s)`, `func(string) int`},
 	{"len", `var s [10]int; _ = len(s)`, `invalid type`},  // constant
@@ -73,6 +80,12 @@ var builtinCalls = []struct {
 	{"make", `_ = make([]int, 10)`, `func([]int, int) []int`},
 	{"make", `type T []byte; _ = make(T, 10, 20)`, `func(p.T, int, int) p.T`},
 
+	{"max", `_ = max(1, 2.5)`, `invalid type`}, // constant
+	{"max", `var x float64; _ = max(x, 1)`, `func(float64, float64) float64`},
+
+	{"min", `var s string; _ = min(s)`, `func(string) string`},
+	{"min", `var x, y int8; _ = min(x, y, 1)`, `func(int8, int8, int8) int8`},
+
 	{"new", `_ = new(int)`, `func(int) *int`},
 	{"new", `type T struct{}; _ = new(T)`, `func(p.T) *p.T`},
 
@@ -194,6 +207,9 @@ func testBuiltinSignature(t *testing.T, name, src0, want string) {
 		case *ast.ParenExpr:
 			fun = p.X // unpack
 
+		case *ast.TypeArgExpr:
+			fun = p.X // assertImplements[T, I]
+
 		case *ast.SelectorExpr:
 			// built-in from package unsafe - ignore details
 			return // we're done
@@ -60,8 +60,24 @@ func (check *Checker) call(x *operand, e *ast.CallExpr) exprKind {
 		// TODO(albrow): abstract this into a helper function, or create a Signature
 		// interface
 
+		args, nargs := getter(func(x *operand, i int) { check.multiExpr(x, e.Args[i]) }), len(e.Args)
+		if genType := check.inferable(x, e); genType != nil {
+			args, nargs = check.inferCall(x, e, genType, args, nargs)
+			if x.mode == invalid {
+				x.expr = e
+				return statement
+			}
+		}
+
 		var sig *Signature
-		switch t := x.typ.Underlying().(type) {
+		typ := x.typ.Underlying()
+		if partial, ok := x.typ.(*PartialGenericSignature); ok {
+			// The type arguments may be type parameters of the enclosing
+			// declaration (e.g. f[U] in the body of g[U]), so they are
+			// substituted to get the types of the arguments and results.
+			typ = substTypeParams(partial.Signature, partial.typeMap)
+		}
+		switch t := typ.(type) {
 		case *Signature:
 			sig = t
 		case *GenericSignature:
@@ -77,7 +93,7 @@ func (check *Checker) call(x *operand, e *ast.CallExpr) exprKind {
 			return statement
 		}
 
-		arg, n, _ := unpack(func(x *operand, i int) { check.multiExpr(x, e.Args[i]) }, len(e.Args), false)
+		arg, n, _ := unpack(args, nargs, false)
 		if arg != nil {
 			check.arguments(x, e, sig, arg, n)
 		} else {
@@ -411,29 +427,20 @@ func (check *Checker) selector(x *operand, e *ast.SelectorExpr) {
 
 		check.recordSelection(e, MethodExpr, x.typ, m, index, indirect)
 
-		// the receiver type becomes the type of the first function
-		// argument of the method expression's function type
-		var params []*Var
-		// TODO(albrow): de-duplicate this code
-		var sig *Signature
-		switch t := m.typ.(type) {
-		case *Signature:
-			sig = t
-		case *GenericSignature:
-			sig = t.Signature
-		case *PartialGenericSignature:
-			sig = t.Signature
-		case *ConcreteSignature:
-			sig = t.Signature
-		}
-		if sig.params != nil {
-			params = sig.params.vars
-		}
-		x.mode = value
-		x.typ = &Signature{
-			params:   NewTuple(append([]*Var{NewVar(token.NoPos, check.pkg, "", x.typ)}, params...)...),
-			results:  sig.results,
-			variadic: sig.variadic,
+		if genType, ok := methodValueType(m).(GenericType); ok && len(genType.TypeParams()) > 0 {
+			// A method with type parameters of its own (e.g. List[int].Map)
+			// only becomes a function once it is instantiated (e.g. as
+			// List[int].Map[string]); see the *ast.TypeArgExpr case of
+			// exprInternal.
+			if check.methodExprRecvs == nil {
+				check.methodExprRecvs = make(map[*ast.SelectorExpr]Type)
+			}
+			check.methodExprRecvs[e] = x.typ
+			x.mode = value
+			x.typ = genType
+		} else {
+			x.mode = value
+			x.typ = check.methodExprType(x.typ, m.typ)
 		}
 
 		check.addDeclDep(m)
@@ -485,30 +492,7 @@ func (check *Checker) selector(x *operand, e *ast.SelectorExpr) {
 			}
 
 			x.mode = value
-
-			switch sig := obj.typ.(type) {
-			case *Signature:
-				// Default Go case
-				x.typ = sig
-				// sig.recv = nil
-			case *ConcreteSignature:
-				x.typ = sig
-			case *GenericSignature:
-				recvTyp, _ := deref(sig.recv.typ)
-				if genRecv, ok := recvTyp.(ConcreteType); ok {
-					x.typ = &PartialGenericSignature{
-						Signature: sig.Signature,
-						genType:   sig,
-						typeMap:   genRecv.TypeMap(),
-					}
-				} else {
-					x.typ = sig
-				}
-			case *PartialGenericSignature:
-				x.typ = sig
-			default:
-				panic(fmt.Errorf("unexpected Func type: %T", obj.typ))
-			}
+			x.typ = methodValueType(obj)
 			check.addDeclDep(obj)
 
 		default:
@@ -524,3 +508,81 @@ Error:
 	x.mode = invalid
 	x.expr = e
 }
+
+// instance sets x.typ to the instance of genType, the type of e.X, for the
+// type arguments of e. It reports whether the instantiation succeeded. An
+// instantiated method expression (e.g. List[int].Map[string]) becomes a
+// function whose first parameter is the receiver, like any method expression.
+func (check *Checker) instance(x *operand, e *ast.TypeArgExpr, genType GenericType) bool {
+	x.typ = check.concreteType(e, genType)
+	if x.typ == Typ[Invalid] {
+		return false
+	}
+	if sel, ok := unparen(e.X).(*ast.SelectorExpr); ok {
+		if recv := check.methodExprRecvs[sel]; recv != nil {
+			x.typ = check.methodExprType(recv, x.typ)
+		}
+	}
+	return true
+}
+
+// methodValueType returns the type of the method value x.m for the method m.
+// If m has type parameters of its own and the type of x is concrete, the
+// result is a partial generic signature which maps the type parameters of
+// the receiver to the type arguments of x.
+func methodValueType(m *Func) Type {
+	switch sig := m.typ.(type) {
+	case *Signature:
+		// Default Go case
+		return sig
+	case *ConcreteSignature:
+		return sig
+	case *GenericSignature:
+		recvTyp, _ := deref(sig.recv.typ)
+		if genRecv, ok := recvTyp.(ConcreteType); ok {
+			return &PartialGenericSignature{
+				Signature: sig.Signature,
+				genType:   sig,
+				typeMap:   genRecv.TypeMap(),
+			}
+		}
+		return sig
+	case *PartialGenericSignature:
+		return sig
+	}
+	panic(fmt.Errorf("unexpected Func type: %T", m.typ))
+}
+
+// methodExprType returns the type of a method expression T.m, where recv is
+// the type T and typ the type of the method: the receiver type becomes the
+// type of the first function argument of the method expression's function
+// type.
+func (check *Checker) methodExprType(recv Type, typ Type) *Signature {
+	sig := underlyingSignature(typ)
+	var params []*Var
+	if sig.params != nil {
+		params = sig.params.vars
+	}
+	return &Signature{
+		params:   NewTuple(append([]*Var{NewVar(token.NoPos, check.pkg, "", recv)}, params...)...),
+		results:  sig.results,
+		variadic: sig.variadic,
+	}
+}
+
+// underlyingSignature returns the signature of the function type typ, which
+// may be generic or an instance of a generic function, or nil if typ is not a
+// function type.
+func underlyingSignature(typ Type) *Signature {
+	switch t := typ.(type) {
+	case *Signature:
+		return t
+	case *GenericSignature:
+		return t.Signature
+	case *PartialGenericSignature:
+		return t.Signature
+	case *ConcreteSignature:
+		return t.Signature
+	}
+	return nil
+}
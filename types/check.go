@@ -76,12 +76,14 @@ type importKey struct {
 type Checker struct {
 	// package information
 	// (initialized by NewChecker, valid for the life-time of checker)
-	conf *Config
-	fset *token.FileSet
-	pkg  *Package
+	conf      *Config
+	fset      *token.FileSet
+	pkg       *Package
+	goVersion GoVersion // parsed conf.GoVersion
 	*Info
-	objMap map[Object]*declInfo   // maps package-level object to declaration info
-	impMap map[importKey]*Package // maps (import path, source directory) to (complete or fake) package
+	objMap   map[Object]*declInfo   // maps package-level object to declaration info
+	impMap   map[importKey]*Package // maps (import path, source directory) to (complete or fake) package
+	concrete typeCache              // concrete types which were created for the package
 
 	// information collected during type-checking of a set of package files
 	// (initialized by Files, valid only for the duration of check.Files;
@@ -95,6 +97,20 @@ type Checker struct {
 	funcs    []funcInfo            // list of functions to type-check
 	delayed  []func()              // delayed checks requiring fully setup types
 
+	// instantiation guard (see enterInstance)
+	instStack []instance // concrete types which are currently being created
+	instCount int        // total number of concrete types created
+
+	usagePkg *Package // package whose code refers to the usages being added, if not pkg (see genericDependents)
+
+	typeArgs     []typeArgUse // type arguments whose constraints are verified at the end
+	typeSwitches []typeSwitch // type switches whose completeness is verified at the end
+
+	typeParams     []*TypeName        // declared type parameters whose uses are verified at the end
+	usedTypeParams map[*TypeName]bool // type parameters which are used
+
+	methodExprRecvs map[*ast.SelectorExpr]Type // receiver types of method expressions of generic methods
+
 	// context within which the current object is type-checked
 	// (valid only for the duration of type-checking a specific object)
 	context
@@ -126,6 +142,11 @@ func (check *Checker) addDeclDep(to Object) {
 	if from == nil {
 		return // not in a package-level init expression
 	}
+	if f, _ := to.(*Func); f != nil {
+		// a method of an instantiated generic type depends on what
+		// the method of the generic type does
+		to = f.origin()
+	}
 	if _, found := check.objMap[to]; !found {
 		return // to is not a package-level object
 	}
@@ -176,8 +197,9 @@ func NewChecker(conf *Config, fset *token.FileSet, pkg *Package, info *Info) *Ch
 		fset:   fset,
 		pkg:    pkg,
 		Info:   info,
-		objMap: make(map[Object]*declInfo),
-		impMap: make(map[importKey]*Package),
+		objMap:   make(map[Object]*declInfo),
+		impMap:   make(map[importKey]*Package),
+		concrete: make(typeCache),
 	}
 }
 
@@ -193,6 +215,13 @@ func (check *Checker) initFiles(files []*ast.File) {
 	check.untyped = nil
 	check.funcs = nil
 	check.delayed = nil
+	check.instStack = nil
+	check.instCount = 0
+	check.typeArgs = nil
+	check.typeSwitches = nil
+	check.typeParams = nil
+	check.usedTypeParams = nil
+	check.methodExprRecvs = nil
 
 	// determine package name and collect valid files
 	pkg := check.pkg
@@ -236,6 +265,12 @@ func (check *Checker) Files(files []*ast.File) error { return check.checkFiles(f
 func (check *Checker) checkFiles(files []*ast.File) (err error) {
 	defer check.handleBailout(&err)
 
+	if check.conf.GoVersion != "" {
+		if check.goVersion, err = ParseGoVersion(check.conf.GoVersion); err != nil {
+			return err
+		}
+	}
+
 	check.initFiles(files)
 
 	check.collectObjects()
@@ -244,11 +279,31 @@ func (check *Checker) checkFiles(files []*ast.File) (err error) {
 
 	check.functionBodies()
 
+	check.instantiatePragmas()
+
 	// HACK(albrow): The order in which we iterate through generic declarations
 	// sometimes means we can miss dependent usages. If we iterate through twice,
 	// it's obviously less effecient but should work.
 	check.genericDependents()
 	check.genericDependents()
+	for check.interfaceMethodUsages() {
+		check.genericDependents()
+	}
+	check.verifyTypeArgs()
+	check.verifyImplAssertions()
+
+	// If function bodies are not checked, the usages in them are missing.
+	if (check.conf.WarnUnusedGenerics || check.conf.StrictUnusedGenerics) && !check.conf.IgnoreFuncBodies {
+		check.unusedGenerics()
+	}
+
+	if check.conf.WarnIncompleteSwitches || check.conf.StrictIncompleteSwitches {
+		check.incompleteSwitches()
+	}
+
+	if check.conf.WarnUnusedTypeParams && !check.conf.IgnoreFuncBodies {
+		check.unusedTypeParams()
+	}
 
 	check.initOrder()
 
@@ -298,10 +353,11 @@ func (check *Checker) recordTypeAndValue(x ast.Expr, mode operandMode, typ Type,
 }
 
 func (check *Checker) recordBuiltinType(f ast.Expr, sig *Signature) {
-	// f must be a (possibly parenthesized) identifier denoting a built-in
-	// (built-ins in package unsafe always produce a constant result and
-	// we don't record their signatures, so we don't see qualified idents
-	// here): record the signature for f and possible children.
+	// f must be a (possibly parenthesized) identifier denoting a built-in,
+	// with type arguments for assertImplements (built-ins in package unsafe
+	// always produce a constant result and we don't record their signatures,
+	// so we don't see qualified idents here): record the signature for f and
+	// possible children.
 	for {
 		check.recordTypeAndValue(f, builtin, sig, nil)
 		switch p := f.(type) {
@@ -309,6 +365,8 @@ func (check *Checker) recordBuiltinType(f ast.Expr, sig *Signature) {
 			return // we're done
 		case *ast.ParenExpr:
 			f = p.X
+		case *ast.TypeArgExpr:
+			f = p.X // assertImplements[T, I]
 		default:
 			unreachable()
 		}
@@ -372,6 +430,20 @@ func (check *Checker) recordSelection(x *ast.SelectorExpr, kind SelectionKind, r
 	}
 }
 
+func (check *Checker) recordTypeArgs(x *ast.IndexExpr, e *ast.TypeArgExpr) {
+	assert(x != nil && e != nil)
+	if m := check.TypeArgs; m != nil {
+		m[x] = e
+	}
+}
+
+func (check *Checker) recordInferredTypeArgs(x ast.Expr, targs []Type) {
+	assert(x != nil)
+	if m := check.InferredTypeArgs; m != nil {
+		m[x] = targs
+	}
+}
+
 func (check *Checker) recordScope(node ast.Node, scope *Scope) {
 	assert(node != nil)
 	assert(scope != nil)
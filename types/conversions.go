@@ -41,6 +41,13 @@ func (check *Checker) conversion(x *operand, T Type) {
 	}
 
 	if !ok {
+		if Ti, isIface := T.Underlying().(*Interface); isIface && x.mode != constant_ && !isUntyped(x.typ) {
+			if m, wrongType := MissingMethod(x.typ, Ti, true); m != nil {
+				check.errorf(x.pos(), "cannot convert %s to %s (%s)", x, T, check.missingMethodReason(x.typ, m, wrongType))
+				x.mode = invalid
+				return
+			}
+		}
 		check.errorf(x.pos(), "cannot convert %s to %s", x, T)
 		x.mode = invalid
 		return
@@ -87,8 +94,8 @@ func (x *operand) convertibleTo(conf *Config, T Type) bool {
 
 	// "x's type and T have identical underlying types if tags are ignored"
 	V := x.typ
-	Vu := V.Underlying()
-	Tu := T.Underlying()
+	Vu := substUnderlying(V)
+	Tu := substUnderlying(T)
 	if IdenticalIgnoreTags(Vu, Tu) {
 		return true
 	}
@@ -97,7 +104,7 @@ func (x *operand) convertibleTo(conf *Config, T Type) bool {
 	// have identical underlying types if tags are ignored"
 	if V, ok := V.(*Pointer); ok {
 		if T, ok := T.(*Pointer); ok {
-			if IdenticalIgnoreTags(V.base.Underlying(), T.base.Underlying()) {
+			if IdenticalIgnoreTags(substUnderlying(V.base), substUnderlying(T.base)) {
 				return true
 			}
 		}
@@ -76,7 +76,11 @@ func (check *Checker) objDecl(obj Object, def *Named, path []*TypeName) {
 	switch obj := obj.(type) {
 	case *Const:
 		check.decl = d // new package-level const decl
-		check.constDecl(obj, d.typ, d.init)
+		if d.enum != nil {
+			check.enumValueDecl(obj, d.enum)
+		} else {
+			check.constDecl(obj, d.typ, d.init)
+		}
 	case *Var:
 		check.decl = d // new package-level var decl
 		check.varDecl(obj, d.lhs, d.typ, d.init)
@@ -91,6 +95,14 @@ func (check *Checker) objDecl(obj Object, def *Named, path []*TypeName) {
 	}
 }
 
+// enumValueDecl declares the value obj of the enum type tname. Its constant
+// value is the index of the value in the declaration.
+func (check *Checker) enumValueDecl(obj *Const, tname *TypeName) {
+	assert(obj.typ == nil)
+	check.objDecl(tname, nil, nil)
+	obj.typ = tname.typ
+}
+
 func (check *Checker) constDecl(obj *Const, typ, init ast.Expr) {
 	assert(obj.typ == nil)
 
@@ -170,7 +182,8 @@ func (check *Checker) varDecl(obj *Var, lhs []*Var, typ, init ast.Expr) {
 	if lhs == nil || len(lhs) == 1 {
 		assert(lhs == nil || lhs[0] == obj)
 		var x operand
-		check.expr(&x, init)
+		check.multiExprWithHint(&x, init, obj.typ)
+		check.singleValue(&x)
 		check.initVar(obj, &x, "variable declaration")
 		return
 	}
@@ -204,16 +217,23 @@ func (check *Checker) varDecl(obj *Var, lhs []*Var, typ, init ast.Expr) {
 
 // underlying returns the underlying type of typ; possibly by following
 // forward chains of named types. Such chains only exist while named types
-// are incomplete.
+// are incomplete. A concrete type of a generic type is followed as well, so
+// that the underlying type of Named in type Named Box[int] is the struct type
+// of Box[int], as for a hand-written type.
 func underlying(typ Type) Type {
 	for {
-		n, _ := typ.(*Named)
-		if n == nil {
-			break
+		switch t := typ.(type) {
+		case *Named:
+			if t == nil {
+				return typ
+			}
+			typ = t.underlying
+		case *ConcreteNamed:
+			typ = t.underlying
+		default:
+			return typ
 		}
-		typ = n.underlying
 	}
-	return typ
 }
 
 func (n *Named) setUnderlying(typ Type) {
@@ -229,17 +249,15 @@ func (check *Checker) typeDecl(obj *TypeName, typ ast.Expr, def *Named, path []*
 	assert(check.iota == nil)
 
 	// Disambiguate cases where `ArrayType` should actually be
-	// `TypeParamDecl Type`.
-	if arrayType, ok := typ.(*ast.ArrayType); ok {
+	// `TypeParamDecl Type`. If the declaration already has type parameters, the
+	// brackets may enclose one of them as the array length (e.g. [N]T).
+	if arrayType, ok := typ.(*ast.ArrayType); ok && tpDecl == nil {
 		if length, ok := arrayType.Len.(*ast.Ident); ok {
 			if _, obj := check.scope.LookupParent(length.Name, length.NamePos); obj == nil {
 				// If the ident inside the brackets is not a declared type, assume we
 				// are actually dealing with a TypeParamDecl.
-				tpDecl = &ast.TypeParamDecl{
-					Lbrack: arrayType.Lbrack,
-					Names:  []*ast.Ident{length},
-					Rbrack: arrayType.Lbrack + token.Pos(len(length.Name)),
-				}
+				tpDecl = ast.NewTypeParamDecl(length)
+				tpDecl.Lbrack = arrayType.Lbrack
 				typ = arrayType.Elt
 			}
 		}
@@ -260,13 +278,9 @@ func (check *Checker) typeDecl(obj *TypeName, typ ast.Expr, def *Named, path []*
 		var typeParams []*TypeParam
 		if tpDecl != nil {
 			origScope := check.scope
-			tpScope := NewScope(check.scope, check.scope.Pos(), check.scope.End(), "named type type parameters")
-			for _, ident := range tpDecl.Names {
-				tp := NewTypeParam(ident.Name)
-				typeParams = append(typeParams, tp)
-				paramObj := NewTypeName(ident.Pos(), check.pkg, ident.Name, tp)
-				scopePos := ident.Pos()
-				check.declare(tpScope, ident, paramObj, scopePos)
+			tpScope := NewScope(check.scope, tpDecl.Pos(), typ.End(), "named type type parameters")
+			for i := range tpDecl.Names {
+				typeParams = append(typeParams, check.declareTypeParam(tpScope, tpDecl, i))
 			}
 			check.scope = tpScope
 			defer func() {
@@ -284,7 +298,11 @@ func (check *Checker) typeDecl(obj *TypeName, typ ast.Expr, def *Named, path []*
 		}
 
 		// determine underlying type of named
-		check.typExpr(typ, named, append(path, obj))
+		if enum, ok := typ.(*ast.EnumType); ok && typeParams == nil {
+			check.enumType(obj, named, enum)
+		} else {
+			check.typExpr(typ, named, append(path, obj))
+		}
 
 		if _, ok := named.underlying.(*Interface); ok && len(typeParams) > 0 {
 			check.error(typ.Pos(), "generic interface types are not supported")
@@ -315,6 +333,30 @@ func (check *Checker) typeDecl(obj *TypeName, typ ast.Expr, def *Named, path []*
 	check.addMethodDecls(obj)
 }
 
+// enumType sets the underlying type of the enum type named declared by e and
+// adds its String and MarshalText methods. The values of the enum type are
+// declared with the other package-level objects.
+func (check *Checker) enumType(obj *TypeName, named *Named, e *ast.EnumType) {
+	named.underlying = Typ[Int]
+	check.recordTypeAndValue(e, typexpr, Typ[Int], nil)
+	if obj.parent != check.pkg.scope {
+		check.errorf(e.Pos(), "enum types are only allowed in package-level type declarations")
+		return
+	}
+
+	pos := e.Pos()
+	recv := NewVar(pos, check.pkg, "", named)
+	str := NewSignature(recv, nil, NewTuple(NewVar(pos, check.pkg, "", Typ[String])), false)
+	marshalText := NewSignature(recv, nil, NewTuple(
+		NewVar(pos, check.pkg, "", NewSlice(universeByte)),
+		NewVar(pos, check.pkg, "", Universe.Lookup("error").Type()),
+	), false)
+	named.methods = append(named.methods,
+		NewFunc(pos, check.pkg, "String", str),
+		NewFunc(pos, check.pkg, "MarshalText", marshalText),
+	)
+}
+
 func (check *Checker) addMethodDecls(obj *TypeName) {
 	// get associated methods
 	methods := check.methods[obj.name]
@@ -410,6 +452,10 @@ func (check *Checker) funcDecl(obj *Func, decl *declInfo) {
 		}
 		obj.typ = genSig
 		check.genericFuncType(genSig, fdecl.Recv, fdecl.Type, typeParams)
+		// The type parameters are in scope in the function declaration only
+		// (and Scope.Innermost must find the function scope within it).
+		tpScope := sig.scope.parent
+		tpScope.pos, tpScope.end = fdecl.Pos(), fdecl.End()
 		if (obj.name == "init" && sig.recv == nil) || obj.name == "main" {
 			if len(genSig.typeParams) > 0 || len(genSig.recvTypeParams) > 0 {
 				check.errorf(fdecl.Pos(), "func %s must have no type parameters", obj.name)
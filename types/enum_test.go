@@ -0,0 +1,93 @@
+package types
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/qProust/fo/ast"
+	"github.com/qProust/fo/constant"
+	"github.com/qProust/fo/parser"
+	"github.com/qProust/fo/token"
+)
+
+func TestEnumValues(t *testing.T) {
+	src := `package enumtest
+
+type Color enum {
+	Red
+	Green, Blue
+}
+
+var _ interface {
+	String() string
+	MarshalText() ([]byte, error)
+} = Green
+
+var _ Color = 7
+`
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "enumtest.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var conf Config
+	pkg, err := conf.Check("enumtest", fset, []*ast.File{f}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	color := pkg.Scope().Lookup("Color").Type()
+	if !Identical(color.Underlying(), Typ[Int]) {
+		t.Errorf("wrong underlying type for Color: %s", color.Underlying())
+	}
+	for i, name := range []string{"Red", "Green", "Blue"} {
+		obj, ok := pkg.Scope().Lookup(name).(*Const)
+		if !ok {
+			t.Errorf("%s is not a constant", name)
+			continue
+		}
+		if obj.Type() != color {
+			t.Errorf("wrong type for %s: %s", name, obj.Type())
+		}
+		if !constant.Compare(obj.Val(), token.EQL, constant.MakeInt64(int64(i))) {
+			t.Errorf("wrong value for %s: %s", name, obj.Val())
+		}
+	}
+}
+
+func TestEnumErrors(t *testing.T) {
+	src := `package enumtest
+
+type Color enum { Red, Green }
+
+func (c Color) String() string { return "" }
+
+type Alias = enum { A }
+
+type enum int
+
+var _ enum = 1
+
+func f() {
+	type Local enum { B }
+}
+`
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "enumtest.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errs []string
+	conf := Config{Error: func(err error) { errs = append(errs, err.Error()) }}
+	conf.Check("enumtest", fset, []*ast.File{f}, nil)
+	expected := []string{
+		"enumtest.go:5:16: method String already declared for type Color int",
+		"enumtest.go:3:12: \tother declaration of String",
+		"enumtest.go:7:14: enum types are only allowed in package-level type declarations",
+		"enumtest.go:14:13: enum types are only allowed in package-level type declarations",
+	}
+	if strings.Join(errs, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong errors\nexpected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(errs, "\n"))
+	}
+}
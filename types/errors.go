@@ -33,6 +33,8 @@ func (check *Checker) qualifier(pkg *Package) string {
 }
 
 func (check *Checker) sprintf(format string, args ...interface{}) string {
+	// instantiations are printed as in Fo source, e.g. Box[int]
+	qf := FoNames(check.qualifier)
 	for i, arg := range args {
 		switch a := arg.(type) {
 		case nil:
@@ -40,15 +42,15 @@ func (check *Checker) sprintf(format string, args ...interface{}) string {
 		case operand:
 			panic("internal error: should always pass *operand")
 		case *operand:
-			arg = operandString(a, check.qualifier)
+			arg = operandString(a, qf)
 		case token.Pos:
 			arg = check.fset.Position(a).String()
 		case ast.Expr:
 			arg = ExprString(a)
 		case Object:
-			arg = ObjectString(a, check.qualifier)
+			arg = ObjectString(a, qf)
 		case Type:
-			arg = TypeString(a, check.qualifier)
+			arg = TypeString(a, qf)
 		}
 		args[i] = arg
 	}
@@ -69,7 +71,7 @@ func (check *Checker) dump(format string, args ...interface{}) {
 }
 
 func (check *Checker) err(pos token.Pos, msg string, soft bool) {
-	err := Error{check.fset, pos, msg, soft}
+	err := Error{Fset: check.fset, Pos: pos, Msg: msg, Soft: soft}
 	if check.firstErr == nil {
 		check.firstErr = err
 	}
@@ -92,6 +94,19 @@ func (check *Checker) softErrorf(pos token.Pos, format string, args ...interface
 	check.err(pos, check.sprintf(format, args...), true)
 }
 
+// warnf reports a warning at pos. Warnings are passed to conf.Warn (if set)
+// and only cause type checking to fail if conf.WarningsAsErrors is set, in
+// which case they are reported as soft errors.
+func (check *Checker) warnf(pos token.Pos, format string, args ...interface{}) {
+	if check.conf.WarningsAsErrors {
+		check.softErrorf(pos, format, args...)
+		return
+	}
+	if f := check.conf.Warn; f != nil {
+		f(Error{Fset: check.fset, Pos: pos, Msg: check.sprintf(format, args...), Soft: true, Warning: true})
+	}
+}
+
 func (check *Checker) invalidAST(pos token.Pos, format string, args ...interface{}) {
 	check.errorf(pos, "invalid AST: "+format, args...)
 }
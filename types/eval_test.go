@@ -188,3 +188,119 @@ func split(s, sep string) (string, string) {
 	i := strings.Index(s, sep)
 	return strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+len(sep):])
 }
+
+func TestEvalGenerics(t *testing.T) {
+	src := `
+	package p
+	type Box[T] struct{ v T }
+	func (b Box[T]) Get() T { return b.v }
+	func (b Box[T]) Map[U](f func(T) U) Box[U] { return Box[U]{f(b.v)} }
+	type Pair[K, V] struct { k K; v V }
+	func Keys[K comparable, V](m map[K]V) []K { return nil }
+	type Vec[T, N] [N]T
+	var b Box[int]
+	func f[T](x T) {
+		/* Box[T]{x}.Get() => , T */
+	}
+	`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg, err := (&Config{}).Check("p", fset, []*ast.File{file}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	usages := func() int {
+		n := 0
+		for _, decl := range pkg.Generics() {
+			n += len(decl.Usages)
+		}
+		return n
+	}
+	before := usages()
+
+	for _, test := range []struct {
+		expr, typ, val string
+	}{
+		{"Box[string]{}", "p.Box[string]", ""},
+		{"Box[float64]{}.Get()", "float64", ""},
+		{"b.Map[string]", "func(f func(int) string) p.Box[string]", ""},
+		{"Pair[int, Box[bool]]{}", "p.Pair[int,p.Box[bool]]", ""},
+		{"len(Vec[int, 3]{})", "int", "3"},
+	} {
+		testEval(t, fset, pkg, token.NoPos, test.expr, nil, test.typ, test.val)
+	}
+	comment := file.Comments[0].List[0]
+	testEval(t, fset, pkg, comment.Pos(), "Box[T]{x}.Get()", nil, "T", "")
+
+	for _, test := range []struct {
+		expr, err string
+	}{
+		{"Box[int, int]{}", "eval:1:4: wrong number of type arguments for Box (expected 1 but got 2): extra type argument int"},
+		{"Keys[[]int, int]", "eval:1:6: []int does not satisfy comparable (required by type parameter K)"},
+		{"Vec[int, string]{}", "eval:1:10: string is not a constant (type parameter N is an array length)"},
+		{"b.Map[string](0)", "eval:1:15: cannot convert 0 (untyped int constant) to func(int) string"},
+	} {
+		if _, err := Eval(fset, pkg, token.NoPos, test.expr); err == nil || err.Error() != test.err {
+			t.Errorf("Eval(%q) got error %v, want %s", test.expr, err, test.err)
+		}
+	}
+
+	if after := usages(); after != before {
+		t.Errorf("Eval changed the number of usages from %d to %d", before, after)
+	}
+}
+
+func TestCheckExpr(t *testing.T) {
+	src := `
+	package p
+	type Box[T] struct{ v T }
+	func Wrap[T](v T) Box[T] { return Box[T]{v} }
+	`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg, err := (&Config{}).Check("p", fset, []*ast.File{file}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expr, err := parser.ParseExpr("Wrap[string](`x`).v")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &Info{
+		Types: make(map[ast.Expr]TypeAndValue),
+		Uses:  make(map[*ast.Ident]Object),
+	}
+	if err := CheckExpr(fset, pkg, token.NoPos, expr, info); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if e, ok := n.(ast.Expr); ok {
+			if tv, ok := info.Types[e]; ok {
+				got = append(got, ExprString(e)+": "+TypeString(tv.Type, FoNames(RelativeTo(pkg))))
+			}
+		}
+		return true
+	})
+	want := []string{
+		"Wrap[string](`x`).v: string",
+		"Wrap[string](`x`): Box[string]",
+		"Wrap[string]: func(v string) Box[string]",
+		"Wrap: func[T](v T) Box[T]",
+		"string: string",
+		"`x`: string",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got types\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if obj := info.Uses[expr.(*ast.SelectorExpr).Sel]; obj == nil || obj.Name() != "v" {
+		t.Errorf("got use %v, want field v", obj)
+	}
+}
@@ -1070,6 +1070,12 @@ func (check *Checker) exprInternal(x *operand, e ast.Expr, hint Type) exprKind {
 				}
 			}
 			typ = check.typ(e.Type)
+			if genType, ok := typ.(*GenericNamed); ok && hint != nil {
+				if inst := literalInstance(genType, hint); inst != nil {
+					typ = inst
+					check.recordInferredTypeArgs(e, typeArgsOf(genType, inst.TypeMap()))
+				}
+			}
 			check.typeArgsRequired(e.Type.Pos(), typ)
 			base = typ
 
@@ -1159,7 +1165,7 @@ func (check *Checker) exprInternal(x *operand, e ast.Expr, hint Type) exprKind {
 				check.error(e.Pos(), "illegal cycle in type declaration")
 				goto Error
 			}
-			n := check.indexedElts(e.Elts, utyp.elem, utyp.len)
+			n := check.indexedElts(e.Elts, utyp.elem, utyp.knownLen())
 			// If we have an "open" [...]T array, set the length now that we know it
 			// and record the type for [...] (usually done by check.typExpr which is
 			// not called for [...]).
@@ -1261,27 +1267,30 @@ func (check *Checker) exprInternal(x *operand, e ast.Expr, hint Type) exprKind {
 			check.use(e.Index)
 			goto Error
 		}
+		if x.mode == builtin && x.id == _AssertImplements {
+			return expression // the type argument is checked by the call (see builtin)
+		}
 
 		// There is ambiguity in the AST that the parser cannot resolve and we must
 		// resolve here. Namely, an *ast.IndexExpr might actually be a
 		// *ast.TypeArgExpr with only one type parameter. We resolve the ambiguity
-		// by observing the type of e.X.
-		if genType, ok := x.typ.(GenericType); ok {
+		// by observing the type of e.X, and record the resolution in
+		// Info.TypeArgs.
+		if _, isNamed := x.typ.(BaseNamed); isNamed && x.mode != typexpr {
+			// A value of a generic type (e.g. method receiver x of type A
+			// used in the body of the method) is indexed as usual.
+		} else if genType, ok := x.typ.(GenericType); ok {
 			if conType, ok := genType.(ConcreteType); ok && len(conType.TypeMap()) == len(conType.GenericType().TypeParams()) {
 				// We have a partial generic type where each type arg is accounted for
 				// by an inherited type parameter. (e.g. method receiver A[T] being
 				// used in the body of the method). Do nothing.
 			} else {
-				if len(genType.TypeParams()) > 1 {
-					check.errorf(check.pos, "wrong number of type arguments for %s (expected %d but got 1)", e.X, len(genType.TypeParams()))
-				}
-				typeArgExpr := &ast.TypeArgExpr{
-					X:      e.X,
-					Lbrack: e.Lbrack,
-					Types:  []ast.Expr{e.Index},
-					Rbrack: e.Rbrack,
+				typeArgExpr := ast.NewTypeArgExpr(e.X, e.Index)
+				typeArgExpr.Lbrack, typeArgExpr.Rbrack = e.Lbrack, e.Rbrack
+				if !check.instance(x, typeArgExpr, genType) {
+					goto Error
 				}
-				x.typ = check.concreteType(typeArgExpr, genType)
+				check.recordTypeArgs(e, typeArgExpr)
 				return expression
 			}
 		}
@@ -1308,7 +1317,7 @@ func (check *Checker) exprInternal(x *operand, e ast.Expr, hint Type) exprKind {
 
 		case *Array:
 			valid = true
-			length = typ.len
+			length = typ.knownLen()
 			if x.mode != variable {
 				x.mode = value
 			}
@@ -1317,7 +1326,7 @@ func (check *Checker) exprInternal(x *operand, e ast.Expr, hint Type) exprKind {
 		case *Pointer:
 			if typ, _ := typ.base.Underlying().(*Array); typ != nil {
 				valid = true
-				length = typ.len
+				length = typ.knownLen()
 				x.mode = variable
 				x.typ = typ.elem
 			}
@@ -1382,7 +1391,7 @@ func (check *Checker) exprInternal(x *operand, e ast.Expr, hint Type) exprKind {
 
 		case *Array:
 			valid = true
-			length = typ.len
+			length = typ.knownLen()
 			if x.mode != variable {
 				check.invalidOp(x.pos(), "cannot slice %s (value not addressable)", x)
 				goto Error
@@ -1392,7 +1401,7 @@ func (check *Checker) exprInternal(x *operand, e ast.Expr, hint Type) exprKind {
 		case *Pointer:
 			if typ, _ := typ.base.Underlying().(*Array); typ != nil {
 				valid = true
-				length = typ.len
+				length = typ.knownLen()
 				x.typ = &Slice{elem: typ.elem}
 			}
 
@@ -1456,11 +1465,16 @@ func (check *Checker) exprInternal(x *operand, e ast.Expr, hint Type) exprKind {
 
 	case *ast.TypeArgExpr:
 		check.exprOrType(x, e.X)
+		if x.mode == builtin && x.id == _AssertImplements {
+			return expression // the type arguments are checked by the call (see builtin)
+		}
 		genType, ok := x.typ.(GenericType)
 		if !ok {
 			check.errorf(e.Pos(), "type arguments provided for non-generic type %s", x.typ)
 		} else {
-			x.typ = check.concreteType(e, genType)
+			if !check.instance(x, e, genType) {
+				goto Error
+			}
 			return expression
 		}
 
@@ -1510,7 +1524,12 @@ func (check *Checker) exprInternal(x *operand, e ast.Expr, hint Type) exprKind {
 		}
 
 	case *ast.UnaryExpr:
-		check.expr(x, e.X)
+		if ptr, _ := hint.(*Pointer); ptr != nil && e.Op == token.AND {
+			// &Box{v: 3} for a *Box[int]
+			check.exprWithHint(x, e.X, ptr.base)
+		} else {
+			check.expr(x, e.X)
+		}
 		if x.mode == invalid {
 			goto Error
 		}
@@ -1590,13 +1609,7 @@ func (check *Checker) typeAssertion(pos token.Pos, x *operand, xtyp *Interface,
 		return
 	}
 
-	var msg string
-	if wrongType {
-		msg = "wrong type for method"
-	} else {
-		msg = "missing method"
-	}
-	check.errorf(pos, "%s cannot have dynamic type %s (%s %s)", x, T, msg, method.name)
+	check.errorf(pos, "%s cannot have dynamic type %s (%s)", x, T, check.missingMethodReason(T, method, wrongType))
 }
 
 func (check *Checker) singleValue(x *operand) {
@@ -1621,7 +1634,14 @@ func (check *Checker) expr(x *operand, e ast.Expr) {
 
 // multiExpr is like expr but the result may be a multi-value.
 func (check *Checker) multiExpr(x *operand, e ast.Expr) {
-	check.rawExpr(x, e, nil)
+	check.multiExprWithHint(x, e, nil)
+}
+
+// multiExprWithHint is like multiExpr, but hint is the type of the variable e
+// is assigned to, or nil if it is not known. A composite literal of a generic
+// type without type arguments takes them from the hint (see literalInstance).
+func (check *Checker) multiExprWithHint(x *operand, e ast.Expr, hint Type) {
+	check.rawExpr(x, e, hint)
 	var msg string
 	switch x.mode {
 	default:
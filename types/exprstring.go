@@ -159,6 +159,16 @@ func WriteExpr(buf *bytes.Buffer, x ast.Expr) {
 		writeFieldList(buf, x.Methods, "; ", true)
 		buf.WriteByte('}')
 
+	case *ast.EnumType:
+		buf.WriteString("enum{")
+		for i, v := range x.Values {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			buf.WriteString(v.Name)
+		}
+		buf.WriteByte('}')
+
 	case *ast.MapType:
 		buf.WriteString("map[")
 		WriteExpr(buf, x.Key)
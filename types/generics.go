@@ -1,17 +1,22 @@
 package types
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"sort"
 	"strings"
 
 	"github.com/qProust/fo/ast"
+	"github.com/qProust/fo/constant"
 	"github.com/qProust/fo/token"
 )
 
 var enableCache = true
 
+// A typeCache holds the concrete types which were created by a Checker, by
+// their generic type and usage key (see usageKey), so that each instantiation
+// such as Box[int] is only created once per package, however often it occurs.
 type typeCache map[GenericType]map[string]ConcreteType
 
 func (tc typeCache) add(conType ConcreteType) {
@@ -29,7 +34,6 @@ func (tc typeCache) add(conType ConcreteType) {
 }
 
 func (tc typeCache) get(genType GenericType, typeMap map[string]Type) ConcreteType {
-	// fmt.Printf("checking cache for %p %+v %+v\n", genType, genType, typeMap)
 	if !enableCache {
 		return nil
 	}
@@ -38,22 +42,132 @@ func (tc typeCache) get(genType GenericType, typeMap map[string]Type) ConcreteTy
 		return nil
 	}
 	uk := usageKey(typeMap)
-	// fmt.Printf("found cached type for %s: %s %T\n", uk, entry[uk], entry[uk])
 	return entry[uk]
 }
 
-var cache = typeCache{}
-
-type typeArg struct {
-	name string
-	typ  Type
-}
-
+// A GenericDecl is a generic type, function or method declared by a package,
+// together with the usages (instantiations) of it found while type-checking.
 type GenericDecl struct {
 	Name       string
 	Type       GenericType
 	Usages     []ConcreteType
+	Native     bool // imported from Go export data; instantiated by the Go compiler
 	seenUsages map[string]struct{}
+	elsewhere  map[string]struct{}  // keys of the usages by other packages
+	sites      map[string]usageSite // keys of the usages to where they were first required
+}
+
+// A usageSite records where a usage was first required.
+type usageSite struct {
+	pos token.Pos
+	pkg *Package
+}
+
+// A GenericKind describes the kind of a generic declaration.
+type GenericKind int
+
+const (
+	GenericTypeDecl   GenericKind = iota // a generic named type
+	GenericFuncDecl                      // a generic function
+	GenericMethodDecl                    // a method of a generic type, or with type parameters of its own
+)
+
+var genericKindNames = [...]string{
+	GenericTypeDecl:   "type",
+	GenericFuncDecl:   "func",
+	GenericMethodDecl: "method",
+}
+
+func (k GenericKind) String() string {
+	if 0 <= k && int(k) < len(genericKindNames) {
+		return genericKindNames[k]
+	}
+	return fmt.Sprintf("GenericKind(%d)", int(k))
+}
+
+// Kind returns the kind of decl.
+func (decl *GenericDecl) Kind() GenericKind {
+	sig, ok := decl.Type.(*GenericSignature)
+	switch {
+	case !ok:
+		return GenericTypeDecl
+	case sig.recv != nil:
+		return GenericMethodDecl
+	}
+	return GenericFuncDecl
+}
+
+// Obj returns the object declared by decl: a *TypeName for a generic type,
+// and a *Func for a generic function or method.
+func (decl *GenericDecl) Obj() Object {
+	return decl.Type.Object()
+}
+
+// Key returns the key of decl in the map returned by Package.Generics: the
+// name of decl, qualified by the name of the receiver type for methods (e.g.
+// "List.Push").
+func (decl *GenericDecl) Key() string {
+	return declKey(decl.Type)
+}
+
+// Recv returns the type name of the receiver of a method, or nil if decl is
+// not a method.
+func (decl *GenericDecl) Recv() *TypeName {
+	sig, ok := decl.Type.(*GenericSignature)
+	if !ok || sig.recv == nil {
+		return nil
+	}
+	recvType, _ := deref(sig.recv.typ)
+	if named, ok := recvType.(interface{ Obj() *TypeName }); ok {
+		return named.Obj()
+	}
+	return nil
+}
+
+// TypeParams returns the type parameters of decl. For a method, the type
+// parameters of the receiver type come first, as named in the receiver of the
+// method declaration.
+func (decl *GenericDecl) TypeParams() []*TypeParam {
+	if sig, ok := decl.Type.(*GenericSignature); ok && len(sig.recvTypeParams) > 0 {
+		return append(append([]*TypeParam{}, sig.recvTypeParams...), sig.typeParams...)
+	}
+	return decl.Type.TypeParams()
+}
+
+// A GenericUsage describes one of the usages of a generic declaration.
+type GenericUsage struct {
+	Type     ConcreteType // the concrete type of the usage
+	TypeArgs []Type       // the type arguments, in the order of GenericDecl.TypeParams
+	Pos      token.Pos    // where the usage was first required; token.NoPos if unknown
+	Pkg      *Package     // the package whose code first required the usage
+}
+
+// Instances returns the usages of decl in the order in which they were found,
+// along with their type arguments and positions. For a usage required while
+// instantiating another generic declaration, Pos is the position of the
+// outermost instantiation in the source.
+func (decl *GenericDecl) Instances() []GenericUsage {
+	params := decl.TypeParams()
+	usages := make([]GenericUsage, len(decl.Usages))
+	for i, typ := range decl.Usages {
+		typeMap := typ.TypeMap()
+		args := make([]Type, len(params))
+		for j, param := range params {
+			args[j] = typeMap[param.String()]
+		}
+		site := decl.sites[usageKey(typeMap)]
+		usages[i] = GenericUsage{Type: typ, TypeArgs: args, Pos: site.pos, Pkg: site.pkg}
+	}
+	return usages
+}
+
+// UsedElsewhere reports whether usg, one of the usages of decl, was
+// instantiated while checking a package other than the one of decl. The code
+// generated for such a package may then refer to the concrete declaration of
+// usg by name.
+func (decl *GenericDecl) UsedElsewhere(usg ConcreteType) bool {
+	_, found := decl.elsewhere[usageKey(usg.TypeMap())]
+	return found
 }
 
 func addGenericDecl(obj Object, typ GenericType) {
@@ -68,7 +182,39 @@ func addGenericDecl(obj Object, typ GenericType) {
 	}
 }
 
-func addGenericUsage(genObj Object, typ ConcreteType) {
+// AddNativeGeneric registers obj, a generic function, method or type of a
+// package compiled by Go 1.18 or later, as a generic declaration of its
+// package. Such declarations are marked as Native: their instantiations are
+// type-checked like any other, but left to the Go compiler instead of being
+// generated. It is used by importers.
+func AddNativeGeneric(obj Object) {
+	genType := obj.Type().(GenericType)
+	addGenericDecl(obj, genType)
+	obj.Pkg().generics[declKey(genType)].Native = true
+}
+
+// usageFrom returns the package whose code refers to the usages being added.
+func (check *Checker) usageFrom() *Package {
+	if check.usagePkg != nil {
+		return check.usagePkg
+	}
+	return check.pkg
+}
+
+// usagePos returns the position of the outermost instantiation in the current
+// chain which has a position, or token.NoPos if there is none.
+func (check *Checker) usagePos() token.Pos {
+	for _, inst := range check.instStack {
+		if inst.pos.IsValid() {
+			return inst.pos
+		}
+	}
+	return token.NoPos
+}
+
+// addGenericUsage records typ as a usage of the generic declaration of genObj
+// by the package from, required at pos.
+func addGenericUsage(genObj Object, typ ConcreteType, from *Package, pos token.Pos) {
 	pkg := genObj.Pkg()
 	if pkg.generics == nil {
 		pkg.generics = map[string]*GenericDecl{}
@@ -86,6 +232,55 @@ func addGenericUsage(genObj Object, typ ConcreteType) {
 	if _, seen := genDecl.seenUsages[uk]; !seen {
 		genDecl.Usages = append(genDecl.Usages, typ)
 		genDecl.seenUsages[uk] = struct{}{}
+		if genDecl.sites == nil {
+			genDecl.sites = map[string]usageSite{}
+		}
+		genDecl.sites[uk] = usageSite{pos: pos, pkg: from}
+	}
+	if from != pkg {
+		if genDecl.elsewhere == nil {
+			genDecl.elsewhere = map[string]struct{}{}
+		}
+		genDecl.elsewhere[uk] = struct{}{}
+	}
+}
+
+// A usageSnapshot records the number of usages of generic declarations, so
+// that the usages added later can be discarded.
+type usageSnapshot map[*GenericDecl]int
+
+// snapshotUsages records the usages of the generic declarations of pkg and
+// the packages it imports (directly or indirectly), which are the ones an
+// expression checked in pkg may instantiate.
+func snapshotUsages(pkg *Package) usageSnapshot {
+	snap := usageSnapshot{}
+	seen := map[*Package]bool{}
+	var walk func(pkg *Package)
+	walk = func(pkg *Package) {
+		if pkg == nil || seen[pkg] {
+			return
+		}
+		seen[pkg] = true
+		for _, decl := range pkg.generics {
+			snap[decl] = len(decl.Usages)
+		}
+		for _, imp := range pkg.imports {
+			walk(imp)
+		}
+	}
+	walk(pkg)
+	return snap
+}
+
+// restore discards the usages added since the snapshot was taken.
+func (snap usageSnapshot) restore() {
+	for decl, n := range snap {
+		for _, usg := range decl.Usages[n:] {
+			delete(decl.seenUsages, usageKey(usg.TypeMap()))
+			delete(decl.elsewhere, usageKey(usg.TypeMap()))
+			delete(decl.sites, usageKey(usg.TypeMap()))
+		}
+		decl.Usages = decl.Usages[:n]
 	}
 }
 
@@ -116,45 +311,182 @@ func declKey(typ GenericType) string {
 // type arguments. Another usage with the same type arguments will have the
 // same key.
 func usageKey(typeMap map[string]Type) string {
-	typeArgs := []typeArg{}
-	for name, typ := range typeMap {
-		typeArgs = append(typeArgs, typeArg{
-			name: name,
-			typ:  typ,
-		})
+	names := make([]string, 0, len(typeMap))
+	for name := range typeMap {
+		names = append(names, name)
 	}
-	sort.Slice(typeArgs, func(i int, j int) bool {
-		return typeArgs[i].name < typeArgs[j].name
-	})
-	stringParams := []string{}
-	for _, arg := range typeArgs {
-		stringParams = append(stringParams, arg.typ.String())
+	sort.Strings(names)
+	var buf bytes.Buffer
+	for i, name := range names {
+		if i > 0 {
+			buf.WriteByte(';')
+		}
+		WriteType(&buf, typeMap[name], keyQualifier)
 	}
-	return strings.Join(stringParams, ";")
+	return buf.String()
 }
 
 func checkIsPartial(typeMap map[string]Type) bool {
 	for _, typ := range typeMap {
-		if _, ok := typ.(*TypeParam); ok {
+		if containsTypeParams(typ) {
 			return true
 		}
 	}
 	return false
 }
 
+// containsTypeParams reports whether typ is a type parameter or a compound type
+// which mentions a type parameter (e.g. []T or map[string]T).
+func containsTypeParams(typ Type) bool {
+	switch t := typ.(type) {
+	case *TypeParam, *PartialGenericNamed, *PartialGenericSignature:
+		return true
+	case *Pointer:
+		return containsTypeParams(t.base)
+	case *Slice:
+		return containsTypeParams(t.elem)
+	case *Array:
+		return t.lenParam != nil || containsTypeParams(t.elem)
+	case *Map:
+		return containsTypeParams(t.key) || containsTypeParams(t.elem)
+	case *Chan:
+		return containsTypeParams(t.elem)
+	case *Struct:
+		for _, field := range t.fields {
+			if containsTypeParams(field.typ) {
+				return true
+			}
+		}
+	case *Tuple:
+		if t != nil {
+			for _, v := range t.vars {
+				if containsTypeParams(v.typ) {
+					return true
+				}
+			}
+		}
+	case *Interface:
+		for _, m := range t.methods {
+			if containsTypeParams(m.typ) {
+				return true
+			}
+		}
+		for _, typ := range t.embeddeds {
+			if containsTypeParams(typ) {
+				return true
+			}
+		}
+	case *Signature:
+		return containsTypeParams(t.params) || containsTypeParams(t.results)
+	}
+	return false
+}
+
 // concreteType returns a new type with the concrete type arguments of e
 // applied.
 func (check *Checker) concreteType(expr *ast.TypeArgExpr, genType GenericType) Type {
-	// buf := &bytes.Buffer{}
-	// if err := printer.Fprint(buf, token.NewFileSet(), expr); err != nil {
-	// 	panic(err)
-	// }
-	// fmt.Printf("concreteType(%s, %+v)\n", buf.String(), genType)
-	typeMap := check.createTypeMap(expr, genType.TypeParams())
+	typeMap := check.createTypeMap(expr, genType)
 	if typeMap == nil {
 		return Typ[Invalid]
 	}
-	if cachedType := cache.get(genType, typeMap); cachedType != nil {
+	return check.instantiate(expr.Pos(), genType, typeMap)
+}
+
+// Instantiate returns the type obtained by substituting targs for the type
+// parameters of genType. The result is a concrete type, or a partially generic
+// one if targs mention type parameters. It is used by importers to create the
+// instantiations found in export data.
+func Instantiate(genType GenericType, targs []Type) (typ Type, err error) {
+	typeParams := genType.TypeParams()
+	if len(targs) != len(typeParams) {
+		return nil, fmt.Errorf("got %d type arguments for %s, but it has %d type parameters", len(targs), genType.Object().Name(), len(typeParams))
+	}
+	typeMap := map[string]Type{}
+	for i, tp := range typeParams {
+		typeMap[tp.String()] = targs[i]
+	}
+	conf := &Config{
+		Error: func(e error) {
+			if err == nil {
+				err = e
+			}
+		},
+	}
+	check := NewChecker(conf, token.NewFileSet(), genType.Object().Pkg(), nil)
+	typ = check.instantiate(token.NoPos, genType, typeMap)
+	if err != nil {
+		return nil, err
+	}
+	return typ, nil
+}
+
+// instantiate returns the type obtained by applying typeMap to genType, for an
+// instantiation at pos. The instantiation is reported to
+// Config.TraceInstantiation, if set.
+func (check *Checker) instantiate(pos token.Pos, genType GenericType, typeMap map[string]Type) Type {
+	trace := check.conf.TraceInstantiation
+	if trace == nil {
+		return check.instantiateType(pos, genType, typeMap)
+	}
+	cached := check.concrete.get(genType, typeMap) != nil
+	if partial, ok := genType.(PartialGenericType); ok && !cached {
+		cached = check.concrete.get(partial.GenericType(), typeMap) != nil
+	}
+	typ := check.instantiateType(pos, genType, typeMap)
+	if !pos.IsValid() {
+		pos = check.usagePos()
+	}
+	trace(Instantiation{Pos: pos, Generic: genType, TypeMap: typeMap, Type: typ, Cached: cached})
+	return typ
+}
+
+// An Instantiation describes an instantiation of a generic type or function
+// by the type checker, as reported to Config.TraceInstantiation.
+type Instantiation struct {
+	Pos     token.Pos       // where the instantiation is required; token.NoPos if unknown
+	Generic GenericType     // the generic (or partially generic) type or function
+	TypeMap map[string]Type // the type arguments by type parameter name
+	Type    Type            // the resulting type, which may be partially generic or invalid
+	Cached  bool            // whether Type was created by an earlier instantiation
+}
+
+// String returns a description of inst without its position, e.g.
+// "Box[T=int] = Box[int] (cached)".
+func (inst Instantiation) String() string {
+	names := make([]string, 0, len(inst.TypeMap))
+	for name := range inst.TypeMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	buf := &bytes.Buffer{}
+	buf.WriteString(inst.Generic.Object().Name())
+	buf.WriteByte('[')
+	for i, name := range names {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(name)
+		buf.WriteByte('=')
+		WriteType(buf, inst.TypeMap[name], nil)
+	}
+	buf.WriteString("] = ")
+	WriteType(buf, inst.Type, nil)
+	if inst.Cached {
+		buf.WriteString(" (cached)")
+	}
+	return buf.String()
+}
+
+// instantiateType is like instantiate, but does not report the instantiation.
+func (check *Checker) instantiateType(pos token.Pos, genType GenericType, typeMap map[string]Type) Type {
+	if pos.IsValid() && !check.goVersion.AtLeast(1, 18) {
+		// The instantiations of native generics are left to the Go compiler.
+		obj := genType.Object()
+		if decl := obj.Pkg().generics[declKey(genType)]; decl != nil && decl.Native {
+			check.errorf(pos, "%s.%s is a generic declaration of a Go package; instantiating it requires go1.18 or later (targeting %s)", obj.Pkg().name, obj.Name(), check.goVersion)
+		}
+	}
+	if cachedType := check.concrete.get(genType, typeMap); cachedType != nil {
 		return cachedType
 	}
 	isPartial := checkIsPartial(typeMap)
@@ -171,6 +503,10 @@ func (check *Checker) concreteType(expr *ast.TypeArgExpr, genType GenericType) T
 			}
 			return partial
 		}
+		if !check.enterInstance(pos, genType, typeMap) {
+			return Typ[Invalid]
+		}
+		defer check.exitInstance()
 		newNamed := check.replaceTypesInNamed(genType.Named, typeMap)
 		newType := &ConcreteNamed{
 			Named:   newNamed,
@@ -178,12 +514,12 @@ func (check *Checker) concreteType(expr *ast.TypeArgExpr, genType GenericType) T
 			typeMap: typeMap,
 		}
 		newType.methods = check.replaceTypesInMethods(genType.methods, typeMap)
-		cache.add(newType)
-		addGenericUsage(genType.Object(), newType)
+		check.concrete.add(newType)
+		addGenericUsage(genType.Object(), newType, check.usageFrom(), check.usagePos())
 		return newType
 
 	case *PartialGenericNamed:
-		if cachedType := cache.get(genType.genType, typeMap); cachedType != nil {
+		if cachedType := check.concrete.get(genType.genType, typeMap); cachedType != nil {
 			return cachedType
 		}
 		if isPartial {
@@ -198,6 +534,10 @@ func (check *Checker) concreteType(expr *ast.TypeArgExpr, genType GenericType) T
 			return partial
 		}
 		newTypeMap := mergeTypeMap(genType.typeMap, typeMap)
+		if !check.enterInstance(pos, genType.genType, newTypeMap) {
+			return Typ[Invalid]
+		}
+		defer check.exitInstance()
 		newNamed := check.replaceTypesInNamed(genType.Named, newTypeMap)
 		newType := &ConcreteNamed{
 			Named:   newNamed,
@@ -205,8 +545,8 @@ func (check *Checker) concreteType(expr *ast.TypeArgExpr, genType GenericType) T
 			typeMap: newTypeMap,
 		}
 		newType.methods = check.replaceTypesInMethods(genType.methods, typeMap)
-		cache.add(newType)
-		addGenericUsage(genType.Object(), newType)
+		check.concrete.add(newType)
+		addGenericUsage(genType.Object(), newType, check.usageFrom(), check.usagePos())
 		return newType
 
 	case *GenericSignature:
@@ -221,18 +561,22 @@ func (check *Checker) concreteType(expr *ast.TypeArgExpr, genType GenericType) T
 			}
 			return partial
 		}
+		if !check.enterInstance(pos, genType, typeMap) {
+			return Typ[Invalid]
+		}
+		defer check.exitInstance()
 		newSig := check.replaceTypesInSignature(genType.Signature, typeMap)
 		newType := &ConcreteSignature{
 			Signature: newSig,
 			genType:   genType,
 			typeMap:   typeMap,
 		}
-		cache.add(newType)
-		addGenericUsage(genType.Object(), newType)
+		check.concrete.add(newType)
+		addGenericUsage(genType.Object(), newType, check.usageFrom(), check.usagePos())
 		return newType
 
 	case *PartialGenericSignature:
-		if cachedType := cache.get(genType.genType, typeMap); cachedType != nil {
+		if cachedType := check.concrete.get(genType.genType, typeMap); cachedType != nil {
 			return cachedType
 		}
 		if isPartial {
@@ -247,18 +591,114 @@ func (check *Checker) concreteType(expr *ast.TypeArgExpr, genType GenericType) T
 			return partial
 		}
 		newTypeMap := mergeTypeMap(genType.typeMap, typeMap)
+		if !check.enterInstance(pos, genType.genType, newTypeMap) {
+			return Typ[Invalid]
+		}
+		defer check.exitInstance()
 		newSig := check.replaceTypesInSignature(genType.Signature, newTypeMap)
 		newType := &ConcreteSignature{
 			Signature: newSig,
 			genType:   genType.genType,
 			typeMap:   newTypeMap,
 		}
-		cache.add(newType)
-		addGenericUsage(genType.Object(), newType)
+		check.concrete.add(newType)
+		addGenericUsage(genType.Object(), newType, check.usageFrom(), check.usagePos())
 		return newType
 	}
 
-	panic(fmt.Errorf("unexpected generic for %s: %T", expr.X, genType))
+	panic(fmt.Errorf("unexpected generic for %s: %T", genType.Object().Name(), genType))
+}
+
+// An instance describes a concrete type which is being created from a generic
+// type. It is used to report the chain of instantiations when a limit is
+// exceeded.
+type instance struct {
+	pos     token.Pos
+	genType GenericType
+	typeMap map[string]Type
+}
+
+func (inst instance) String() string {
+	args := make([]string, len(inst.genType.TypeParams()))
+	for i, param := range inst.genType.TypeParams() {
+		if typ, found := inst.typeMap[param.String()]; found {
+			args[i] = TypeString(typ, FoNames(nil))
+		} else {
+			args[i] = param.String()
+		}
+	}
+	return declKey(inst.genType) + "[" + strings.Join(args, ", ") + "]"
+}
+
+const (
+	defaultMaxInstantiationDepth = 100
+	defaultMaxInstantiations     = 100000
+)
+
+// enterInstance records that a concrete type of genType with the given type
+// arguments is about to be created. It reports an error and returns false if
+// doing so would exceed the instantiation limits of the configuration, which
+// happens e.g. for recursive generic types whose type arguments keep growing.
+// If enterInstance returns true, the caller must call exitInstance once the
+// concrete type is complete.
+func (check *Checker) enterInstance(pos token.Pos, genType GenericType, typeMap map[string]Type) bool {
+	inst := instance{pos: pos, genType: genType, typeMap: typeMap}
+	maxDepth := check.conf.MaxInstantiationDepth
+	if maxDepth <= 0 {
+		maxDepth = defaultMaxInstantiationDepth
+	}
+	maxCount := check.conf.MaxInstantiations
+	if maxCount <= 0 {
+		maxCount = defaultMaxInstantiations
+	}
+	switch {
+	case len(check.instStack) >= maxDepth:
+		check.errorf(check.instancePos(inst), "instantiation depth limit of %d exceeded: %s", maxDepth, check.instanceChain(inst))
+		return false
+	case check.instCount >= maxCount:
+		check.errorf(check.instancePos(inst), "too many instantiations (limit is %d) while instantiating %s", maxCount, inst)
+		return false
+	}
+	check.instStack = append(check.instStack, inst)
+	check.instCount++
+	return true
+}
+
+func (check *Checker) exitInstance() {
+	check.instStack = check.instStack[:len(check.instStack)-1]
+}
+
+// instancePos returns the position at which to report an error for inst. This
+// is the position of the outermost instantiation in the current chain which
+// has a position, or else the position of the generic declaration.
+func (check *Checker) instancePos(inst instance) token.Pos {
+	for _, outer := range check.instStack {
+		if outer.pos.IsValid() {
+			return outer.pos
+		}
+	}
+	if inst.pos.IsValid() {
+		return inst.pos
+	}
+	return inst.genType.Object().Pos()
+}
+
+// instanceChain formats the current chain of instantiations, followed by
+// inst. Long chains are abbreviated.
+func (check *Checker) instanceChain(inst instance) string {
+	const edge = 4
+	chain := append(append([]instance{}, check.instStack...), inst)
+	parts := []string{}
+	for i, inst := range chain {
+		if len(chain) > 2*edge+1 && i == edge {
+			parts = append(parts, fmt.Sprintf("(%d more)", len(chain)-2*edge))
+		}
+		if len(chain) > 2*edge+1 && i >= edge && i < len(chain)-edge {
+			continue
+		}
+		parts = append(parts, inst.String())
+	}
+	return strings.Join(parts, " -> ")
 }
 
 // b overwrites a
@@ -273,7 +713,7 @@ func mergeTypeMap(a, b map[string]Type) map[string]Type {
 	return result
 }
 
-func remapTypes(partial, incoming map[string]Type) map[string]Type {
+func (check *Checker) remapTypes(partial, incoming map[string]Type) map[string]Type {
 	result := map[string]Type{}
 	for key, typ := range partial {
 		for inc, newTyp := range incoming {
@@ -283,30 +723,446 @@ func remapTypes(partial, incoming map[string]Type) map[string]Type {
 			}
 		}
 		if _, found := result[key]; !found {
+			// The type argument may still mention the incoming type parameters
+			// (e.g. []T), in which case they need to be replaced as well.
+			if containsTypeParams(typ) {
+				typ = check.replaceTypes(typ, incoming)
+			}
 			result[key] = typ
 		}
 	}
 	return result
 }
 
-// TODO(albrow): test case with wrong number of type arguments.
-func (check *Checker) createTypeMap(typeArgExpr *ast.TypeArgExpr, typeParams []*TypeParam) map[string]Type {
+// createTypeMap returns a map of the type parameters of genType to the type
+// arguments in typeArgExpr. It returns nil if the number of type arguments is
+// wrong.
+func (check *Checker) createTypeMap(typeArgExpr *ast.TypeArgExpr, genType GenericType) map[string]Type {
 	typeArgs := typeArgExpr.Types
+	typeParams := genType.TypeParams()
 	if len(typeArgs) != len(typeParams) {
-		check.errorf(typeArgExpr.Pos(), "wrong number of type arguments (expected %d but got %d)", len(typeParams), len(typeArgs))
+		check.typeArgCountError(typeArgExpr, genType)
 		return nil
 	}
 	typeMap := map[string]Type{}
 	for i, typ := range typeArgs {
 		var x operand
 		check.rawExpr(&x, typ, nil)
+		if x.mode == constant_ {
+			arg := check.constArg(&x)
+			if arg == nil {
+				return nil
+			}
+			typeMap[typeParams[i].String()] = arg
+			check.typeArgs = append(check.typeArgs, typeArgUse{typ.Pos(), typeParams[i], arg})
+			continue
+		}
 		if x.typ != nil {
 			typeMap[typeParams[i].String()] = x.typ
+			check.typeArgs = append(check.typeArgs, typeArgUse{typ.Pos(), typeParams[i], x.typ})
 		}
 	}
 	return typeMap
 }
 
+// constArg returns the constant type argument for the constant x, or nil if x
+// is not a valid array length.
+func (check *Checker) constArg(x *operand) *ConstArg {
+	if isUntyped(x.typ) || isInteger(x.typ) {
+		if val := constant.ToInt(x.val); val.Kind() == constant.Int {
+			if representableConst(val, check.conf, Typ[Int], nil) {
+				if n, ok := constant.Int64Val(val); ok && n >= 0 {
+					return NewConstArg(constant.MakeInt64(n))
+				}
+			}
+		}
+	}
+	check.errorf(x.pos(), "type argument %s must be a non-negative integer constant", x)
+	return nil
+}
+
+// typeArgCountError reports that typeArgExpr has the wrong number of type
+// arguments for genType. The error names the missing type parameters or the
+// extra type arguments and is followed by a secondary error at the
+// declaration of genType.
+func (check *Checker) typeArgCountError(typeArgExpr *ast.TypeArgExpr, genType GenericType) {
+	typeArgs := typeArgExpr.Types
+	typeParams := genType.TypeParams()
+	obj := genType.Object()
+	var hint string
+	if len(typeArgs) < len(typeParams) {
+		var names []string
+		for _, tp := range typeParams[len(typeArgs):] {
+			names = append(names, tp.String())
+		}
+		hint = "missing type argument for " + strings.Join(names, ", ")
+		if len(names) > 1 {
+			hint = "missing type arguments for " + strings.Join(names, ", ")
+		}
+	} else {
+		var args []string
+		for _, arg := range typeArgs[len(typeParams):] {
+			args = append(args, ExprString(arg))
+		}
+		hint = "extra type argument " + strings.Join(args, ", ")
+		if len(args) > 1 {
+			hint = "extra type arguments " + strings.Join(args, ", ")
+		}
+	}
+	check.errorf(
+		typeArgExpr.Pos(),
+		"wrong number of type arguments for %s (expected %d but got %d): %s",
+		obj.Name(),
+		len(typeParams),
+		len(typeArgs),
+		hint,
+	)
+	if pos := obj.Pos(); pos.IsValid() {
+		var params []string
+		for _, tp := range typeParams {
+			if tp.constraint != nil {
+				params = append(params, tp.String()+" "+tp.constraint.String())
+			} else {
+				params = append(params, tp.String())
+			}
+		}
+		check.errorf(pos, "\t%s declared with type parameters [%s]", obj.Name(), strings.Join(params, ", ")) // secondary error, \t indented
+	}
+}
+
+// declareTypeParam declares the i-th type parameter of tpDecl in scope and
+// returns it. Unless the type parameter is blank, the warnings about type
+// parameters which are enabled in the configuration are checked for it.
+func (check *Checker) declareTypeParam(scope *Scope, tpDecl *ast.TypeParamDecl, i int) *TypeParam {
+	ident := tpDecl.Names[i]
+	tp := NewTypeParam(ident.Name)
+	tp.constraint = check.typeParamConstraint(tpDecl, i)
+	obj := NewTypeName(ident.Pos(), check.pkg, ident.Name, tp)
+	if ident.Name != "_" {
+		if check.conf.WarnShadowedTypeParams {
+			if _, shadowed := scope.LookupParent(ident.Name, token.NoPos); shadowed != nil && shadowed.Parent() != scope {
+				if shadowed.Pos().IsValid() {
+					check.warnf(ident.Pos(), "type parameter %s shadows %s declared at %s", ident.Name, ident.Name, check.fset.Position(shadowed.Pos()))
+				} else {
+					check.warnf(ident.Pos(), "type parameter %s shadows predeclared %s", ident.Name, ident.Name)
+				}
+			}
+		}
+		if check.conf.WarnImplicitConstraints && (i >= len(tpDecl.Constraints) || tpDecl.Constraints[i] == nil) {
+			check.warnf(ident.Pos(), "type parameter %s has no constraint (implicitly interface{})", ident.Name)
+		}
+		if check.conf.WarnUnusedTypeParams {
+			check.typeParams = append(check.typeParams, obj)
+		}
+	}
+	check.declare(scope, ident, obj, ident.Pos())
+	return tp
+}
+
+// unusedTypeParams reports the declared type parameters which are never used
+// (see Config.WarnUnusedTypeParams).
+func (check *Checker) unusedTypeParams() {
+	var unused []*TypeName
+	for _, obj := range check.typeParams {
+		if !check.usedTypeParams[obj] {
+			unused = append(unused, obj)
+		}
+	}
+	sort.Slice(unused, func(i, j int) bool {
+		return unused[i].Pos() < unused[j].Pos()
+	})
+	for _, obj := range unused {
+		check.warnf(obj.Pos(), "type parameter %s is never used", obj.name)
+	}
+}
+
+// typeParamConstraint returns the constraint declared for the i-th type
+// parameter in tpDecl, or nil if there is none. A constraint is either the
+// predeclared comparable or an interface type, usually a named one such as
+// fmt.Stringer, which the type arguments must implement.
+func (check *Checker) typeParamConstraint(tpDecl *ast.TypeParamDecl, i int) Type {
+	if i >= len(tpDecl.Constraints) || tpDecl.Constraints[i] == nil {
+		return nil
+	}
+	e := tpDecl.Constraints[i]
+	if ident, ok := e.(*ast.Ident); ok {
+		if _, obj := check.scope.LookupParent(ident.Name, check.pos); obj != nil && obj.Type() == universeComparable {
+			check.recordUse(ident, obj)
+			return universeComparable
+		}
+	}
+	typ := check.typ(e)
+	if typ == Typ[Invalid] {
+		return nil
+	}
+	if _, isTypeParam := typ.(*TypeParam); isTypeParam || !IsInterface(typ) {
+		check.errorf(e.Pos(), "invalid constraint %s (must be comparable or an interface type)", typ)
+		return nil
+	}
+	return typ
+}
+
+// interfaceConstraint returns the interface which the type arguments for tp
+// must implement, or nil if tp has no interface constraint.
+func interfaceConstraint(tp *TypeParam) *Interface {
+	if tp.constraint == nil || tp.constraint == universeComparable {
+		return nil
+	}
+	iface, _ := tp.constraint.Underlying().(*Interface)
+	return iface
+}
+
+// requireComparable constrains tp (and the type parameter of the receiver type
+// it stands for, if any) by comparable. It reports whether tp was not
+// constrained before.
+func (check *Checker) requireComparable(tp *TypeParam) bool {
+	changed := false
+	for ; tp != nil; tp = tp.origin {
+		if tp.constraint == nil {
+			tp.constraint = universeComparable
+			changed = true
+		}
+	}
+	return changed
+}
+
+// requireConst marks tp (and the type parameter of the receiver type it stands
+// for, if any) as a constant type parameter. It reports whether tp was not
+// constant before.
+func (check *Checker) requireConst(tp *TypeParam) bool {
+	changed := false
+	for ; tp != nil; tp = tp.origin {
+		if !tp.isConst {
+			tp.isConst = true
+			changed = true
+		}
+	}
+	return changed
+}
+
+// A typeArgUse records a type argument given for a type parameter, so that
+// the constraint of the type parameter can be verified once it is known.
+// Type parameters used as map keys only become constrained when the map type
+// is checked, which may happen after a usage (e.g. in a function body).
+type typeArgUse struct {
+	pos   token.Pos
+	param *TypeParam
+	arg   Type
+}
+
+// verifyTypeArgs reports an error for each type argument which does not
+// satisfy the constraint of its type parameter. A type parameter which is
+// itself used as a type argument for a comparable (or constant) type parameter
+// becomes comparable (or constant) too.
+func (check *Checker) verifyTypeArgs() {
+	for changed := true; changed; {
+		changed = false
+		for _, use := range check.typeArgs {
+			tp, ok := use.arg.(*TypeParam)
+			if !ok {
+				continue
+			}
+			if use.param.constraint == universeComparable && check.requireComparable(tp) {
+				changed = true
+			}
+			if use.param.isConst && check.requireConst(tp) {
+				changed = true
+			}
+		}
+	}
+	for _, use := range check.typeArgs {
+		if isConstArg(use.arg) != use.param.isConst {
+			if use.param.isConst {
+				check.errorf(use.pos, "%s is not a constant (type parameter %s is an array length)", use.arg, use.param)
+			} else {
+				check.errorf(use.pos, "%s is not a type (type parameter %s is not an array length)", use.arg, use.param)
+			}
+			continue
+		}
+		if iface := interfaceConstraint(use.param); iface != nil {
+			if m, wrongType := MissingMethod(use.arg, iface, true); m != nil {
+				check.errorf(use.pos, "%s does not satisfy %s (%s, required by type parameter %s)", use.arg, use.param.constraint, check.missingMethodReason(use.arg, m, wrongType), use.param)
+				continue
+			}
+		}
+		if _, ok := use.arg.(*TypeParam); ok {
+			continue
+		}
+		if use.param.constraint == universeComparable && !Comparable(use.arg) {
+			check.errorf(use.pos, "%s does not satisfy comparable (required by type parameter %s)", use.arg, use.param)
+		}
+	}
+}
+
+// An implAssertion records a call of assertImplements[T, I]() in the body of
+// a generic function or method whose type T mentions the type parameters of
+// the function, so that it can be verified for each usage of the function.
+type implAssertion struct {
+	pos   token.Pos
+	typ   Type
+	iface Type
+}
+
+// assertImplements reports an error at pos if typ does not implement the
+// interface iface, for a call of assertImplements[typ, iface](). If typ
+// mentions the type parameters of the enclosing generic function, it is
+// verified for each usage of the function instead (see verifyImplAssertions).
+func (check *Checker) assertImplements(pos token.Pos, typ, iface Type) {
+	if check.genSig != nil && containsTypeParams(typ) {
+		check.genSig.assertions = append(check.genSig.assertions, implAssertion{pos, typ, iface})
+		return
+	}
+	check.verifyImplements(pos, typ, iface, "")
+}
+
+// verifyImplements reports an error at pos if typ does not implement the
+// interface iface. The type arguments of the usage for which typ is verified,
+// if any, are described by usage (e.g. "T = int").
+func (check *Checker) verifyImplements(pos token.Pos, typ, iface Type, usage string) {
+	m, wrongType := MissingMethod(typ, iface.Underlying().(*Interface), true)
+	if m == nil {
+		return
+	}
+	if usage != "" {
+		check.errorf(pos, "%s does not implement %s (%s) for %s", typ, iface, check.missingMethodReason(typ, m, wrongType), usage)
+	} else {
+		check.errorf(pos, "%s does not implement %s (%s)", typ, iface, check.missingMethodReason(typ, m, wrongType))
+	}
+}
+
+// verifyImplAssertions verifies the assertions of the generic functions and
+// methods of the package and the packages it imports for each of their usages
+// by the package, e.g. assertImplements[T, fmt.Stringer]() in the body of a
+// function F[T] is reported for a usage F[int]. The usages of an imported
+// function by its own package were verified when that package was checked.
+func (check *Checker) verifyImplAssertions() {
+	qf := FoNames(check.qualifier)
+	for _, pkg := range packageAndImports(check.pkg) {
+		keys := make([]string, 0, len(pkg.generics))
+		for key := range pkg.generics {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			genDecl := pkg.generics[key]
+			genSig, ok := genDecl.Type.(*GenericSignature)
+			if !ok || len(genSig.assertions) == 0 {
+				continue
+			}
+			for _, usg := range genDecl.Usages {
+				typeMap := usg.TypeMap()
+				if pkg != check.pkg && !genDecl.UsedElsewhere(usg) || checkIsPartial(typeMap) {
+					continue
+				}
+				var args []string
+				for _, tp := range append(append([]*TypeParam{}, genSig.recvTypeParams...), genSig.typeParams...) {
+					args = append(args, fmt.Sprintf("%s = %s", tp, TypeString(typeMap[tp.String()], qf)))
+				}
+				for _, a := range genSig.assertions {
+					check.verifyImplements(a.pos, check.substConcrete(a.typ, typeMap), a.iface, strings.Join(args, ", "))
+				}
+			}
+		}
+	}
+}
+
+// substConcrete is like substTypeParams, but instantiates typ (or the base
+// type of a pointer type) if it is a partially instantiated generic type,
+// since only the concrete type has the methods of its generic type (e.g.
+// Box[int] for Box[T] with T = int).
+func (check *Checker) substConcrete(typ Type, typeMap map[string]Type) Type {
+	typ = substTypeParams(typ, typeMap)
+	base, isPtr := deref(typ)
+	partial, ok := base.(*PartialGenericNamed)
+	if !ok || checkIsPartial(partial.typeMap) {
+		return typ
+	}
+	base = check.instantiate(token.NoPos, partial.genType, partial.typeMap)
+	if isPtr {
+		return NewPointer(base)
+	}
+	return base
+}
+
+// missingMethodReason describes why V does not implement an interface whose
+// method m is missing from V or has the wrong type, as reported by
+// MissingMethod. For an instance of a generic type, the method is described by
+// its generic declaration, along with the type arguments which make its type
+// differ from the required one, e.g. "wrong type for method Get: have Get() int
+// because T = int in func (Box[T]) Get() T, want Get() string".
+func (check *Checker) missingMethodReason(V Type, m *Func, wrongType bool) string {
+	reason := "missing method " + m.name
+	if wrongType {
+		reason = "wrong type for method " + m.name
+	}
+	base, isPtr := deref(V)
+	if _, ok := base.(*ConcreteNamed); !ok {
+		return reason
+	}
+	qf := FoNames(check.qualifier)
+	obj, _, _ := lookupFieldOrMethod(V, false, m.pkg, m.name)
+	f, _ := obj.(*Func)
+	if f == nil {
+		if !isPtr {
+			// The method may be declared with a pointer receiver.
+			obj, _, _ = lookupFieldOrMethod(NewPointer(V), false, m.pkg, m.name)
+			if f, _ := obj.(*Func); f != nil {
+				if sig, ok := f.typ.(*ConcreteSignature); ok {
+					return fmt.Sprintf("%s (%s has a pointer receiver)", reason, genericMethodString(f.name, sig.genType, qf))
+				}
+			}
+		}
+		return reason
+	}
+	sig, ok := f.typ.(*ConcreteSignature)
+	if !wrongType || !ok {
+		return reason
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s: have %s", reason, f.name)
+	writeSignature(&buf, sig.Signature, qf, nil)
+	buf.WriteString(" because ")
+	for i, param := range sig.genType.recvTypeParams {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		fmt.Fprintf(&buf, "%s = %s", param, TypeString(sig.typeMap[param.String()], qf))
+	}
+	fmt.Fprintf(&buf, " in %s, want %s", genericMethodString(f.name, sig.genType, qf), m.name)
+	writeMethodSignature(&buf, m, qf, nil)
+	return buf.String()
+}
+
+// genericMethodString returns the declaration of the method name of a generic
+// type whose signature is sig, as in func (*Box[T]) Set(v T).
+func genericMethodString(name string, sig *GenericSignature, qf Qualifier) string {
+	var buf bytes.Buffer
+	buf.WriteString("func (")
+	recv, isPtr := deref(sig.recv.typ)
+	if isPtr {
+		buf.WriteByte('*')
+	}
+	writeType(&buf, recv, qf, nil)
+	fmt.Fprintf(&buf, ") %s", name)
+	if len(sig.typeParams) > 0 {
+		writeTypeParams(&buf, sig.typeParams)
+	}
+	writeSignature(&buf, sig.Signature, qf, nil)
+	return buf.String()
+}
+
+// isConstArg reports whether arg is a constant type argument or a constant
+// type parameter.
+func isConstArg(arg Type) bool {
+	switch arg := arg.(type) {
+	case *ConstArg:
+		return true
+	case *TypeParam:
+		return arg.isConst
+	}
+	return false
+}
+
 func createMethodTypeMap(recvType Type, typeMap map[string]Type) map[string]Type {
 	recvType, _ = deref(recvType)
 	if recvType, ok := recvType.(ConcreteType); ok {
@@ -370,6 +1226,11 @@ func (check *Checker) replaceTypes(root Type, typeMap map[string]Type) Type {
 	case *Array:
 		newArray := *t
 		newArray.elem = check.replaceTypes(t.elem, typeMap)
+		if t.lenParam != nil {
+			if arg, ok := typeMap[t.lenParam.String()].(*ConstArg); ok {
+				newArray.setLen(arg)
+			}
+		}
 		return &newArray
 	case *Chan:
 		newChan := *t
@@ -377,9 +1238,16 @@ func (check *Checker) replaceTypes(root Type, typeMap map[string]Type) Type {
 		return &newChan
 	case *Struct:
 		return check.replaceTypesInStruct(t, typeMap)
+	case *Interface:
+		return check.replaceTypesInInterface(t, typeMap)
 	case *Signature:
 		return check.replaceTypesInSignature(t, typeMap)
 	case *Named:
+		if !containsTypeParams(t.underlying) {
+			// Only named types declared inside a generic function can mention
+			// its type parameters. Others (which may be recursive) are left as is.
+			return root
+		}
 		return check.replaceTypesInNamed(t, typeMap)
 	case *ConcreteNamed:
 		panic(errors.New("case *ConcreteNamed not implemented"))
@@ -393,6 +1261,109 @@ func (check *Checker) replaceTypes(root Type, typeMap map[string]Type) Type {
 	return root
 }
 
+// substTypeParams returns typ with each type parameter replaced by the
+// corresponding type in smap. Unlike replaceTypes, it never creates concrete
+// types or records usages, so it is safe to use outside of a Checker (e.g. to
+// compare the signatures of generic methods).
+func substTypeParams(typ Type, smap map[string]Type) Type {
+	switch t := typ.(type) {
+	case *TypeParam:
+		if newType, found := smap[t.String()]; found {
+			return newType
+		}
+	case *Pointer:
+		return NewPointer(substTypeParams(t.base, smap))
+	case *Slice:
+		return NewSlice(substTypeParams(t.elem, smap))
+	case *Array:
+		newArray := NewArray(substTypeParams(t.elem, smap), t.len)
+		if t.lenParam != nil {
+			switch arg := smap[t.lenParam.String()].(type) {
+			case *ConstArg:
+				newArray.setLen(arg)
+			case *TypeParam:
+				newArray.lenParam = arg
+			default:
+				newArray.lenParam = t.lenParam
+			}
+		}
+		return newArray
+	case *Map:
+		return NewMap(substTypeParams(t.key, smap), substTypeParams(t.elem, smap))
+	case *Chan:
+		return NewChan(t.dir, substTypeParams(t.elem, smap))
+	case *Struct:
+		fields := make([]*Var, len(t.fields))
+		for i, field := range t.fields {
+			newField := *field
+			newField.typ = substTypeParams(field.typ, smap)
+			fields[i] = &newField
+		}
+		return NewStruct(fields, t.tags)
+	case *Interface:
+		if !containsTypeParams(t) {
+			return t
+		}
+		methods := make([]*Func, len(t.methods))
+		for i, m := range t.methods {
+			sig := m.typ.(*Signature)
+			methods[i] = replaceFuncType(m, NewSignature(nil, substTupleTypeParams(sig.params, smap), substTupleTypeParams(sig.results, smap), sig.variadic))
+		}
+		embeddeds := make([]Type, len(t.embeddeds))
+		for i, typ := range t.embeddeds {
+			embeddeds[i] = substTypeParams(typ, smap)
+		}
+		return NewInterfaceType(methods, embeddeds).Complete()
+	case *Tuple:
+		return substTupleTypeParams(t, smap)
+	case *Signature:
+		return NewSignature(t.recv, substTupleTypeParams(t.params, smap), substTupleTypeParams(t.results, smap), t.variadic)
+	case *PartialGenericNamed:
+		newType := *t
+		newType.typeMap = substTypeMap(t.typeMap, smap)
+		return &newType
+	case *PartialGenericSignature:
+		newType := *t
+		newType.typeMap = substTypeMap(t.typeMap, smap)
+		return &newType
+	}
+	return typ
+}
+
+// substUnderlying returns the underlying type of typ. For a partially
+// instantiated generic type, the type arguments are substituted into the
+// underlying type of the generic declaration, so that e.g. Box[T] and
+// Other[T] in the body of a generic function have identical underlying types
+// if Box and Other are declared alike. Concrete types already have their type
+// arguments substituted.
+func substUnderlying(typ Type) Type {
+	if partial, ok := typ.(*PartialGenericNamed); ok {
+		return substTypeParams(partial.Underlying(), partial.typeMap)
+	}
+	return typ.Underlying()
+}
+
+func substTupleTypeParams(t *Tuple, smap map[string]Type) *Tuple {
+	if t == nil {
+		return nil
+	}
+	vars := make([]*Var, len(t.vars))
+	for i, v := range t.vars {
+		newVar := *v
+		newVar.typ = substTypeParams(v.typ, smap)
+		vars[i] = &newVar
+	}
+	return NewTuple(vars...)
+}
+
+func substTypeMap(typeMap, smap map[string]Type) map[string]Type {
+	result := map[string]Type{}
+	for name, typ := range typeMap {
+		result[name] = substTypeParams(typ, smap)
+	}
+	return result
+}
+
 func (check *Checker) replaceTypesInStruct(root *Struct, typeMap map[string]Type) *Struct {
 	var fields []*Var
 	for _, field := range root.fields {
@@ -403,6 +1374,27 @@ func (check *Checker) replaceTypesInStruct(root *Struct, typeMap map[string]Type
 	return NewStruct(fields, root.tags)
 }
 
+// replaceTypesInInterface returns the interface type root (e.g. interface{
+// Get() T } in the body of a generic function) with the type parameters in
+// the signatures of its methods replaced. The receivers of the new methods are
+// the new interface type.
+func (check *Checker) replaceTypesInInterface(root *Interface, typeMap map[string]Type) *Interface {
+	if !containsTypeParams(root) {
+		return root
+	}
+	methods := make([]*Func, len(root.methods))
+	for i, m := range root.methods {
+		sig := *m.typ.(*Signature)
+		sig.recv = nil
+		methods[i] = replaceFuncType(m, check.replaceTypesInSignature(&sig, typeMap))
+	}
+	embeddeds := make([]Type, len(root.embeddeds))
+	for i, typ := range root.embeddeds {
+		embeddeds[i] = check.replaceTypes(typ, typeMap)
+	}
+	return NewInterfaceType(methods, embeddeds).Complete()
+}
+
 func (check *Checker) replaceTypesInSignature(root *Signature, typeMap map[string]Type) *Signature {
 	var newRecv *Var
 	if root.recv != nil {
@@ -442,7 +1434,7 @@ func (check *Checker) replaceTypesInSignature(root *Signature, typeMap map[strin
 }
 
 func (check *Checker) replaceTypesInGenericSignature(root *GenericSignature, typeMap map[string]Type) Type {
-	if cachedType := cache.get(root, typeMap); cachedType != nil {
+	if cachedType := check.concrete.get(root, typeMap); cachedType != nil {
 		return cachedType
 	}
 	if checkIsPartial(typeMap) {
@@ -456,14 +1448,18 @@ func (check *Checker) replaceTypesInGenericSignature(root *GenericSignature, typ
 		}
 		return partial
 	}
+	if !check.enterInstance(token.NoPos, root, typeMap) {
+		return Typ[Invalid]
+	}
+	defer check.exitInstance()
 	newSig := check.replaceTypesInSignature(root.Signature, typeMap)
 	newType := &ConcreteSignature{
 		Signature: newSig,
 		genType:   root,
 		typeMap:   typeMap,
 	}
-	cache.add(newType)
-	addGenericUsage(root.obj, newType)
+	check.concrete.add(newType)
+	addGenericUsage(root.obj, newType, check.usageFrom(), check.usagePos())
 	return newType
 }
 
@@ -475,10 +1471,10 @@ func (check *Checker) replaceTypesInNamed(root *Named, typeMap map[string]Type)
 }
 
 func (check *Checker) replaceTypesInPartialGenericNamed(root *PartialGenericNamed, typeMap map[string]Type) Type {
-	if cachedType := cache.get(root.genType, typeMap); cachedType != nil {
+	newTypeMap := check.remapTypes(root.typeMap, typeMap)
+	if cachedType := check.concrete.get(root.genType, newTypeMap); cachedType != nil {
 		return cachedType
 	}
-	newTypeMap := remapTypes(root.typeMap, typeMap)
 	if checkIsPartial(newTypeMap) {
 		partial := &PartialGenericNamed{
 			Named:   root.Named,
@@ -490,23 +1486,27 @@ func (check *Checker) replaceTypesInPartialGenericNamed(root *PartialGenericName
 		}
 		return partial
 	}
+	if !check.enterInstance(token.NoPos, root.genType, newTypeMap) {
+		return Typ[Invalid]
+	}
+	defer check.exitInstance()
 	newType := &ConcreteNamed{
 		genType: root.genType,
 		typeMap: newTypeMap,
 	}
-	cache.add(newType)
+	check.concrete.add(newType)
 	newNamed := check.replaceTypesInNamed(root.Named, newTypeMap)
 	newType.Named = newNamed
 	newType.methods = check.replaceTypesInMethods(root.methods, newTypeMap)
-	addGenericUsage(root.obj, newType)
+	addGenericUsage(root.obj, newType, check.usageFrom(), check.usagePos())
 	return newType
 }
 
 func (check *Checker) replaceTypesInPartialGenericSignature(root *PartialGenericSignature, typeMap map[string]Type) Type {
-	if cachedType := cache.get(root.genType, typeMap); cachedType != nil {
+	newTypeMap := check.remapTypes(root.typeMap, typeMap)
+	if cachedType := check.concrete.get(root.genType, newTypeMap); cachedType != nil {
 		return cachedType
 	}
-	newTypeMap := remapTypes(root.typeMap, typeMap)
 	if checkIsPartial(newTypeMap) {
 		partial := &PartialGenericSignature{
 			Signature: root.Signature,
@@ -518,14 +1518,18 @@ func (check *Checker) replaceTypesInPartialGenericSignature(root *PartialGeneric
 		}
 		return partial
 	}
+	if !check.enterInstance(token.NoPos, root.genType, newTypeMap) {
+		return Typ[Invalid]
+	}
+	defer check.exitInstance()
 	newType := &ConcreteSignature{
 		genType: root.genType,
 		typeMap: newTypeMap,
 	}
-	cache.add(newType)
+	check.concrete.add(newType)
 	newSig := check.replaceTypesInSignature(root.Signature, newTypeMap)
 	newType.Signature = newSig
-	addGenericUsage(root.genType.obj, newType)
+	addGenericUsage(root.genType.obj, newType, check.usageFrom(), check.usagePos())
 	return newType
 }
 
@@ -575,6 +1579,7 @@ func replaceFuncType(f *Func, newType Type) *Func {
 			order_:    f.order_,
 			scopePos_: f.scopePos_,
 		},
+		generic: f.origin(),
 	}
 }
 
@@ -590,31 +1595,312 @@ func (check *Checker) typeArgsRequired(pos token.Pos, typ Type) {
 			check.errorf(
 				pos,
 				"wrong number of type arguments for type %s (expected %d but got %d, including implicit type arguments)",
-				typ.String(),
+				typ,
 				len(t.TypeParams()),
 				len(t.TypeMap()),
 			)
 		}
 	case GenericType:
-		check.errorf(pos, "missing type arguments for type %s", typ.String())
+		check.errorf(pos, "missing type arguments for type %s", typ)
 	}
 }
 
 // genericDependents adds usage for each dependent of all declared generic
-// signatures.
+// signatures. This includes the generic signatures of imported packages, since
+// the package may have added usages of them, e.g. a call of lib.Map[int] adds
+// the usages of any generic functions which are called in the body of Map.
+//
+// The code generated for the usages of dependents is in the package of the
+// generic signature, which is therefore recorded as the package they are used
+// by.
 func (check *Checker) genericDependents() {
-	for _, genDecl := range check.pkg.generics {
-		if genSig, ok := genDecl.Type.(*GenericSignature); ok {
+	defer func() { check.usagePkg = nil }()
+	for _, pkg := range packageAndImports(check.pkg) {
+		check.usagePkg = pkg
+		for _, genDecl := range pkg.generics {
+			if genSig, ok := genDecl.Type.(*GenericSignature); ok {
+				for _, usage := range genDecl.Usages {
+					for _, dep := range genSig.dependents {
+						switch partialType := dep.(type) {
+						case *PartialGenericNamed:
+							check.replaceTypesInPartialGenericNamed(partialType, usage.TypeMap())
+						case *PartialGenericSignature:
+							check.replaceTypesInPartialGenericSignature(partialType, usage.TypeMap())
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// packageAndImports returns pkg and all packages it imports, directly or
+// indirectly.
+func packageAndImports(pkg *Package) []*Package {
+	result := []*Package{pkg}
+	seen := map[*Package]bool{pkg: true}
+	for i := 0; i < len(result); i++ {
+		for _, imp := range result[i].imports {
+			if !seen[imp] {
+				seen[imp] = true
+				result = append(result, imp)
+			}
+		}
+	}
+	return result
+}
+
+// interfaceMethodUsages adds usages for the generic methods of the types which
+// implement an interface with generic methods. Each usage of a generic
+// interface method (e.g. m.Map[string] for a Mapper m) is a usage of the
+// corresponding method of every type which implements the interface, since
+// any of them could be the dynamic type of m. The interfaces and the types are
+// those of the package and of the packages it imports, so that the usages of
+// an interface method in one package reach the types of another package which
+// implement it. It reports whether any new usages were added.
+func (check *Checker) interfaceMethodUsages() bool {
+	pkgs := packageAndImports(check.pkg)
+	var ifaceDecls []*GenericDecl
+	for _, pkg := range pkgs {
+		for _, genDecl := range pkg.generics {
+			if sig, ok := genDecl.Type.(*GenericSignature); ok && sig.recv != nil && len(genDecl.Usages) > 0 {
+				if _, ok := sig.recv.typ.Underlying().(*Interface); ok {
+					ifaceDecls = append(ifaceDecls, genDecl)
+				}
+			}
+		}
+	}
+	if len(ifaceDecls) == 0 {
+		return false
+	}
+	sort.Slice(ifaceDecls, func(i, j int) bool {
+		return ifaceDecls[i].Type.Object().Pos() < ifaceDecls[j].Type.Object().Pos()
+	})
+
+	// Collect the types which could implement the interfaces: all non-generic
+	// named types and all concrete types of the generic ones. Only packages
+	// with generic declarations can declare generic methods.
+	var candidates []Type
+	for _, pkg := range pkgs {
+		if len(pkg.generics) == 0 {
+			continue
+		}
+		for _, name := range pkg.scope.Names() {
+			tname, ok := pkg.scope.Lookup(name).(*TypeName)
+			if !ok {
+				continue
+			}
+			switch typ := tname.typ.(type) {
+			case *Named:
+				if typ.obj == tname {
+					candidates = append(candidates, typ)
+				}
+			case *GenericNamed:
+				if genDecl := pkg.generics[name]; genDecl != nil && typ.obj == tname {
+					for _, usage := range genDecl.Usages {
+						candidates = append(candidates, usage)
+					}
+				}
+			}
+		}
+	}
+
+	added := false
+	for _, ifaceDecl := range ifaceDecls {
+		ifaceSig := ifaceDecl.Type.(*GenericSignature)
+		iface := ifaceSig.recv.typ.Underlying().(*Interface)
+		for _, cand := range candidates {
+			if _, ok := cand.Underlying().(*Interface); ok {
+				continue
+			}
+			if m, _ := MissingMethod(cand, iface, true); m != nil {
+				if m, _ = MissingMethod(NewPointer(cand), iface, true); m != nil {
+					continue
+				}
+				cand = NewPointer(cand)
+			}
+			// An unexported method can only be implemented in the package
+			// of the interface.
+			obj, _, _ := lookupFieldOrMethod(cand, false, ifaceSig.obj.Pkg(), ifaceDecl.Name)
+			f, _ := obj.(*Func)
+			if f == nil {
+				continue
+			}
+			for _, usage := range ifaceDecl.Usages {
+				if check.addImplementationUsage(f, ifaceSig, usage.TypeMap()) {
+					added = true
+				}
+			}
+		}
+	}
+	return added
+}
+
+// addImplementationUsage adds a usage of the generic method f for the given
+// type arguments of the interface method ifaceSig, which f implements. The
+// usage belongs to the package of f, which may be an imported one; like the
+// usages of dependents (see genericDependents), its code is generated there.
+// It reports whether the usage is new.
+func (check *Checker) addImplementationUsage(f *Func, ifaceSig *GenericSignature, ifaceTypeMap map[string]Type) bool {
+	var genSig *GenericSignature
+	switch sig := f.typ.(type) {
+	case *GenericSignature:
+		genSig = sig
+	case *PartialGenericSignature:
+		genSig = sig.genType
+	default:
+		return false
+	}
+	if len(genSig.typeParams) != len(ifaceSig.typeParams) {
+		return false
+	}
+	typeMap := map[string]Type{}
+	for i, tp := range genSig.typeParams {
+		typeMap[tp.String()] = ifaceTypeMap[ifaceSig.typeParams[i].String()]
+	}
+	genDecl := genSig.obj.Pkg().generics[declKey(genSig)]
+	if genDecl == nil || genDecl.Native {
+		return false
+	}
+	before := len(genDecl.Usages)
+	switch sig := f.typ.(type) {
+	case *GenericSignature:
+		check.replaceTypesInGenericSignature(sig, typeMap)
+	case *PartialGenericSignature:
+		check.replaceTypesInPartialGenericSignature(sig, typeMap)
+	}
+	return len(genDecl.Usages) > before
+}
+
+// A typeSwitch records the cases of a type switch without a default case, so
+// that they can be compared to the instantiations of generic types once all of
+// them are known.
+type typeSwitch struct {
+	pos   token.Pos
+	xtyp  *Interface // underlying type of the operand
+	cases []Type     // types of the cases (other than nil), in source order
+}
+
+// recordTypeSwitch records the type switch s, whose operand has the underlying
+// type xtyp and whose case types (and their positions) are the keys of seen.
+// Type switches with a default case are not recorded.
+func (check *Checker) recordTypeSwitch(s *ast.TypeSwitchStmt, xtyp *Interface, seen map[Type]token.Pos) {
+	for _, stmt := range s.Body.List {
+		if clause, _ := stmt.(*ast.CaseClause); clause != nil && clause.List == nil {
+			return
+		}
+	}
+	var cases []Type
+	for T := range seen {
+		if T != nil {
+			cases = append(cases, T)
+		}
+	}
+	sort.Slice(cases, func(i, j int) bool {
+		return seen[cases[i]] < seen[cases[j]]
+	})
+	check.typeSwitches = append(check.typeSwitches, typeSwitch{s.Pos(), xtyp, cases})
+}
+
+// incompleteSwitches reports each recorded type switch with a case for an
+// instantiation of a generic type (or a pointer to one) which does not have
+// cases for all other instantiations of the same type. The instantiations are
+// taken from the usages of the generic declaration, so this must be called
+// after all usages are known.
+func (check *Checker) incompleteSwitches() {
+	type generic struct {
+		typ   GenericType
+		isPtr bool
+	}
+	for _, ts := range check.typeSwitches {
+		var missing []string
+		seen := map[generic]bool{}
+		for _, T := range ts.cases {
+			base, isPtr := deref(T)
+			named, ok := base.(*ConcreteNamed)
+			if !ok {
+				continue
+			}
+			gen := generic{named.GenericType(), isPtr}
+			if seen[gen] {
+				continue
+			}
+			seen[gen] = true
+			genDecl := gen.typ.Object().Pkg().generics[declKey(gen.typ)]
+			if genDecl == nil {
+				continue
+			}
+		usages:
 			for _, usage := range genDecl.Usages {
-				for _, dep := range genSig.dependents {
-					switch partialType := dep.(type) {
-					case *PartialGenericNamed:
-						check.replaceTypesInPartialGenericNamed(partialType, usage.TypeMap())
-					case *PartialGenericSignature:
-						check.replaceTypesInPartialGenericSignature(partialType, usage.TypeMap())
+				if checkIsPartial(usage.TypeMap()) {
+					continue
+				}
+				var typ Type = usage
+				if isPtr {
+					typ = NewPointer(usage)
+				}
+				if method, _ := assertableTo(ts.xtyp, typ); method != nil {
+					continue
+				}
+				for _, c := range ts.cases {
+					if Identical(c, typ) {
+						continue usages
 					}
 				}
+				missing = append(missing, TypeString(typ, FoNames(check.qualifier)))
+			}
+		}
+		if len(missing) == 0 {
+			continue
+		}
+		if check.conf.StrictIncompleteSwitches {
+			check.softErrorf(ts.pos, "type switch is missing cases for %s", strings.Join(missing, ", "))
+		} else {
+			check.warnf(ts.pos, "type switch is missing cases for %s", strings.Join(missing, ", "))
+		}
+	}
+}
+
+// unusedGenerics reports each generic declaration in the package which has no
+// usages. Methods are only reported if they declare their own type parameters
+// and their receiver type is used, since every method of an unused generic
+// type is trivially unused as well.
+func (check *Checker) unusedGenerics() {
+	var unused []*GenericDecl
+	for _, genDecl := range check.pkg.generics {
+		if len(genDecl.Usages) > 0 {
+			continue
+		}
+		obj := genDecl.Type.Object()
+		if obj.Exported() && check.pkg.name != "main" {
+			continue
+		}
+		if sig, ok := genDecl.Type.(*GenericSignature); ok && sig.recv != nil {
+			if len(sig.typeParams) == 0 {
+				continue
+			}
+			recvType, _ := deref(sig.recv.typ)
+			if recvNamed, ok := recvType.(GenericType); ok {
+				if recvDecl := check.pkg.generics[recvNamed.Object().Name()]; recvDecl != nil && len(recvDecl.Usages) == 0 {
+					continue
+				}
 			}
 		}
+		unused = append(unused, genDecl)
+	}
+	sort.Slice(unused, func(i, j int) bool {
+		return unused[i].Type.Object().Pos() < unused[j].Type.Object().Pos()
+	})
+	for _, genDecl := range unused {
+		obj := genDecl.Type.Object()
+		kind := "type"
+		if _, ok := genDecl.Type.(*GenericSignature); ok {
+			kind = "function"
+		}
+		if check.conf.StrictUnusedGenerics {
+			check.softErrorf(obj.Pos(), "generic %s %s is never used", kind, declKey(genDecl.Type))
+		} else {
+			check.warnf(obj.Pos(), "generic %s %s is never used", kind, declKey(genDecl.Type))
+		}
 	}
 }
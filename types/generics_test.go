@@ -1,6 +1,9 @@
 package types
 
 import (
+	"fmt"
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/qProust/fo/ast"
@@ -227,3 +230,1942 @@ func main() {
 		}
 	}
 }
+
+func TestGenericsUnusedWarnings(t *testing.T) {
+	src := `package main
+
+type T[U] struct {}
+
+type Used[U] struct {}
+
+func f[T](x T) {}
+
+func (T[U]) f0() {}
+
+func (Used[U]) g[V]() {}
+
+func Exported[T]() {}
+
+func main() {
+	var _ Used[int]
+}
+`
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "genericstest.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var warnings []string
+	conf := Config{
+		WarnUnusedGenerics: true,
+		Warn: func(err error) {
+			warnings = append(warnings, err.Error())
+		},
+	}
+	if _, err := conf.Check("genericstest", fset, []*ast.File{f}, nil); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"genericstest.go:3:6: generic type T is never used",
+		"genericstest.go:7:6: generic function f is never used",
+		"genericstest.go:11:16: generic function Used.g is never used",
+		"genericstest.go:13:6: generic function Exported is never used",
+	}
+	if len(warnings) != len(expected) {
+		t.Fatalf("wrong warnings (expected %q but got %q)", expected, warnings)
+	}
+	for i := range expected {
+		if warnings[i] != expected[i] {
+			t.Errorf("wrong warning (expected %q but got %q)", expected[i], warnings[i])
+		}
+	}
+
+	// In strict mode the same declarations are reported as errors.
+	conf = Config{StrictUnusedGenerics: true}
+	_, err = conf.Check("genericstest", fset, []*ast.File{f}, nil)
+	if err == nil {
+		t.Fatal("expected an error in strict mode but got none")
+	}
+	if err.Error() != expected[0] {
+		t.Errorf("wrong error (expected %q but got %q)", expected[0], err.Error())
+	}
+
+	// Without function bodies, the usages in them are unknown, so nothing is
+	// reported.
+	conf = Config{StrictUnusedGenerics: true, IgnoreFuncBodies: true}
+	if _, err := conf.Check("genericstest", fset, []*ast.File{f}, nil); err != nil {
+		t.Errorf("unexpected error with IgnoreFuncBodies: %s", err)
+	}
+}
+
+func TestTypeParamWarnings(t *testing.T) {
+	src := `package main
+
+type Value struct{}
+
+type Box[T] struct {
+	v T
+}
+
+type Pair[K comparable, V] struct {
+	k K
+}
+
+type Mapper interface {
+	Map[int](x int) int
+}
+
+func (b Box[T]) Get() T { return b.v }
+
+func (b Box[T]) With[U](u U) Box[T] { return b }
+
+func Keys[Value comparable, _]() {}
+
+func Len[T](x []T) int { return len(x) }
+
+func main() {
+	var _ Box[int]
+	var _ Pair[int, string]
+	var _ Mapper
+	Keys[int, int]()
+	Len[int](nil)
+}
+`
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "genericstest.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		conf     Config
+		expected []string
+	}{
+		{
+			Config{WarnUnusedTypeParams: true},
+			[]string{
+				"genericstest.go:9:25: type parameter V is never used",
+				"genericstest.go:21:11: type parameter Value is never used",
+			},
+		},
+		{
+			Config{WarnShadowedTypeParams: true},
+			[]string{
+				"genericstest.go:14:6: type parameter int shadows predeclared int",
+				"genericstest.go:21:11: type parameter Value shadows Value declared at genericstest.go:3:6",
+			},
+		},
+		{
+			Config{WarnImplicitConstraints: true},
+			[]string{
+				"genericstest.go:5:10: type parameter T has no constraint (implicitly interface{})",
+				"genericstest.go:9:25: type parameter V has no constraint (implicitly interface{})",
+				"genericstest.go:14:6: type parameter int has no constraint (implicitly interface{})",
+				"genericstest.go:19:22: type parameter U has no constraint (implicitly interface{})",
+				"genericstest.go:23:10: type parameter T has no constraint (implicitly interface{})",
+			},
+		},
+	}
+	for _, test := range tests {
+		var warnings []string
+		conf := test.conf
+		conf.Warn = func(err error) {
+			if !err.(Error).Warning {
+				t.Errorf("%s is not marked as a warning", err)
+			}
+			warnings = append(warnings, err.Error())
+		}
+		if _, err := conf.Check("genericstest", fset, []*ast.File{f}, nil); err != nil {
+			t.Fatal(err)
+		}
+		// Type parameters are checked in the order of the dependencies
+		// between declarations, not in source order.
+		sort.Strings(warnings)
+		sort.Strings(test.expected)
+		if strings.Join(warnings, "\n") != strings.Join(test.expected, "\n") {
+			t.Errorf("wrong warnings\nexpected:\n%s\ngot:\n%s", strings.Join(test.expected, "\n"), strings.Join(warnings, "\n"))
+		}
+	}
+
+	// With WarningsAsErrors, the warnings are reported as soft errors.
+	var errs []string
+	conf := Config{
+		WarnUnusedTypeParams: true,
+		WarningsAsErrors:     true,
+		Warn: func(err error) {
+			t.Errorf("unexpected warning: %s", err)
+		},
+		Error: func(err error) {
+			if e := err.(Error); !e.Soft || e.Warning {
+				t.Errorf("%s is not a soft error", err)
+			}
+			errs = append(errs, err.Error())
+		},
+	}
+	if _, err := conf.Check("genericstest", fset, []*ast.File{f}, nil); err == nil {
+		t.Fatal("expected an error with WarningsAsErrors but got none")
+	}
+	if len(errs) != 2 || errs[0] != "genericstest.go:9:25: type parameter V is never used" {
+		t.Errorf("wrong errors with WarningsAsErrors: %q", errs)
+	}
+}
+
+func TestGenericsIgnoreFuncBodies(t *testing.T) {
+	src := `package genericstest
+
+type Box[T] struct {
+	v T
+}
+
+var b Box[int] = Box[string]{}
+
+func main() {
+	var x int = "not checked"
+}
+`
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "genericstest.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errs []string
+	conf := Config{
+		IgnoreFuncBodies: true,
+		Error: func(err error) {
+			errs = append(errs, err.Error())
+		},
+	}
+	conf.Check("genericstest", fset, []*ast.File{f}, nil)
+	expected := []string{"genericstest.go:7:21: cannot use (Box[string] literal) (value of type Box[string]) as Box[int] value in variable declaration"}
+	if strings.Join(errs, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong errors\nexpected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(errs, "\n"))
+	}
+}
+
+func TestGenericsInstantiationDepthLimit(t *testing.T) {
+	src := `package genericstest
+
+type L[T] struct {
+	next *L[[]T]
+}
+
+func main() {
+	var _ L[int]
+}
+`
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "genericstest.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := Config{MaxInstantiationDepth: 3}
+	_, err = conf.Check("genericstest", fset, []*ast.File{f}, nil)
+	if err == nil {
+		t.Fatal("expected an error but got none")
+	}
+	expected := "genericstest.go:8:9: instantiation depth limit of 3 exceeded: L[int] -> L[[]int] -> L[[][]int] -> L[[][][]int]"
+	if err.Error() != expected {
+		t.Errorf("wrong error\nexpected: %s\ngot:      %s", expected, err.Error())
+	}
+}
+
+func TestGenericsInterfaceMethods(t *testing.T) {
+	src := `package genericstest
+
+type Mapper interface {
+	Map[U](f func(int) U) []U
+}
+
+type Ints []int
+
+func (xs Ints) Map[U](f func(int) U) []U {
+	return nil
+}
+
+type Box[T] struct {
+	v T
+}
+
+func (b Box[T]) Map[V](f func(T) V) []V {
+	return nil
+}
+
+func apply(m Mapper) {
+	m.Map[string](nil)
+	m.Map[bool](nil)
+}
+
+func main() {
+	apply(Ints{})
+	apply(Box[int]{})
+}
+`
+
+	pkg := parseTestSource(t, src)
+	for _, key := range []string{"Mapper.Map", "Ints.Map", "Box.Map"} {
+		genDecl, found := pkg.generics[key]
+		if !found {
+			t.Fatalf("could not find generic declaration for %s", key)
+		}
+		if len(genDecl.Usages) != 2 {
+			t.Fatalf("wrong number of usages for %s (expected 2 but got %d)", key, len(genDecl.Usages))
+		}
+		got := map[string]struct{}{}
+		for _, usage := range genDecl.Usages {
+			for name, typ := range usage.TypeMap() {
+				got[name+"="+typ.String()] = struct{}{}
+			}
+		}
+		for _, param := range genDecl.Type.TypeParams() {
+			for _, typ := range []string{"string", "bool"} {
+				if _, found := got[param.String()+"="+typ]; !found {
+					t.Errorf("missing usage of %s with %s = %s", key, param, typ)
+				}
+			}
+		}
+	}
+}
+
+func TestGenericsInterfaceMethodsWrongType(t *testing.T) {
+	src := `package genericstest
+
+type Mapper interface {
+	Map[U](f func(int) U) []U
+}
+
+type Strings []string
+
+func (xs Strings) Map[U](f func(string) U) []U {
+	return nil
+}
+
+func main() {
+	var _ Mapper = Strings{}
+}
+`
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "genericstest.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var conf Config
+	_, err = conf.Check("genericstest", fset, []*ast.File{f}, nil)
+	if err == nil {
+		t.Fatal("expected an error but got none")
+	}
+	expected := "genericstest.go:14:17: cannot use (Strings literal) (value of type Strings) as Mapper value in variable declaration: wrong type for method Map"
+	if err.Error() != expected {
+		t.Errorf("wrong error\nexpected: %s\ngot:      %s", expected, err.Error())
+	}
+}
+
+func TestGenericsComparable(t *testing.T) {
+	src := `package genericstest
+
+type Set[K] map[K]bool
+
+type Pair[K comparable, V] struct {
+	k K
+	v V
+}
+
+func Index[T](xs []T) map[T]int {
+	return nil
+}
+
+func Wrap[T](x T) Set[T] {
+	return Set[T]{x: true}
+}
+
+type Tree[T] struct{}
+
+func (Tree[U]) Lookup() map[U]bool {
+	return nil
+}
+
+func main() {
+	_ = Set[string]{}
+	_ = Pair[*int, []int]{}
+	_ = Set[[]int]{}
+	_ = Pair[func(), int]{}
+	_ = Index[map[string]int](nil)
+	_ = Wrap[[]byte](nil)
+	_ = Tree[[]int]{}
+}
+`
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "genericstest.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errs []string
+	conf := Config{Error: func(err error) { errs = append(errs, err.Error()) }}
+	conf.Check("genericstest", fset, []*ast.File{f}, nil)
+	expected := []string{
+		"genericstest.go:27:10: []int does not satisfy comparable (required by type parameter K)",
+		"genericstest.go:28:11: func() does not satisfy comparable (required by type parameter K)",
+		"genericstest.go:29:12: map[string]int does not satisfy comparable (required by type parameter T)",
+		"genericstest.go:30:11: []byte does not satisfy comparable (required by type parameter T)",
+		"genericstest.go:31:11: []int does not satisfy comparable (required by type parameter T)",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("wrong number of errors (expected %d but got %d):\n%s", len(expected), len(errs), strings.Join(errs, "\n"))
+	}
+	for i, err := range errs {
+		if err != expected[i] {
+			t.Errorf("wrong error\nexpected: %s\ngot:      %s", expected[i], err)
+		}
+	}
+}
+
+func TestGenericsComparableInvalidConstraint(t *testing.T) {
+	src := `package genericstest
+
+type A[T int] struct{}
+
+var _ comparable
+`
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "genericstest.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errs []string
+	conf := Config{Error: func(err error) { errs = append(errs, err.Error()) }}
+	conf.Check("genericstest", fset, []*ast.File{f}, nil)
+	expected := []string{
+		"genericstest.go:3:10: invalid constraint int (must be comparable or an interface type)",
+		"genericstest.go:5:7: cannot use comparable outside of a type parameter list",
+	}
+	if strings.Join(errs, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong errors\nexpected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(errs, "\n"))
+	}
+}
+
+func TestGenericsInterfaceConstraints(t *testing.T) {
+	src := `package genericstest
+
+type Stringer interface {
+	String() string
+}
+
+type Name string
+
+func (n Name) String() string { return string(n) }
+
+type Ref struct{}
+
+func (*Ref) String() string { return "ref" }
+
+type Labeled[T Stringer, K comparable] struct {
+	v T
+	k K
+}
+
+func (l Labeled[T, K]) Label() string { return l.v.String() }
+
+func Join[T Stringer](xs []T) string {
+	s := ""
+	for _, x := range xs {
+		var str Stringer = x
+		s += x.String() + str.String()
+	}
+	return s
+}
+
+func Wrap[U Stringer](u U) Labeled[U, int] { return Labeled[U, int]{v: u} }
+
+func JoinAny[U](xs []U) string { return Join[U](xs) }
+
+func main() {
+	_ = Join[Name](nil)
+	_ = Join[*Ref](nil)
+	_ = Wrap[Name]("x").Label()
+	_ = Join[int](nil)
+	_ = Join[Ref](nil)
+}
+`
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "genericstest.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errs []string
+	conf := Config{Error: func(err error) { errs = append(errs, err.Error()) }}
+	conf.Check("genericstest", fset, []*ast.File{f}, nil)
+	expected := []string{
+		"genericstest.go:33:46: U does not satisfy Stringer (missing method String, required by type parameter T)",
+		"genericstest.go:39:11: int does not satisfy Stringer (missing method String, required by type parameter T)",
+		"genericstest.go:40:11: Ref does not satisfy Stringer (missing method String, required by type parameter T)",
+	}
+	if strings.Join(errs, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong errors\nexpected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(errs, "\n"))
+	}
+}
+
+func TestGenericsMissingMethods(t *testing.T) {
+	src := `package genericstest
+
+type Getter interface {
+	Get() string
+}
+
+type Setter interface {
+	Set(v int)
+}
+
+type Box[T] struct {
+	v T
+}
+
+func (b Box[T]) Get() T { return b.v }
+
+func (b *Box[T]) Set(v T) { b.v = v }
+
+func main() {
+	var _ Getter = Box[string]{}
+	var _ Getter = Box[int]{}
+	var _ Setter = Box[int]{}
+	_ = Getter(Box[bool]{})
+	var s Setter
+	_ = s.(Box[int])
+}
+`
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "genericstest.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errs []string
+	conf := Config{Error: func(err error) { errs = append(errs, err.Error()) }}
+	conf.Check("genericstest", fset, []*ast.File{f}, nil)
+	expected := []string{
+		"genericstest.go:21:20: cannot use (Box[int] literal) (value of type Box[int]) as Getter value in variable declaration: wrong type for method Get: have Get() int because T = int in func (Box[T]) Get() T, want Get() string",
+		"genericstest.go:22:20: cannot use (Box[int] literal) (value of type Box[int]) as Setter value in variable declaration: missing method Set (func (*Box[T]) Set(v T) has a pointer receiver)",
+		"genericstest.go:23:16: cannot convert (Box[bool] literal) (value of type Box[bool]) to Getter (wrong type for method Get: have Get() bool because T = bool in func (Box[T]) Get() T, want Get() string)",
+		"genericstest.go:25:6: s (variable of type Setter) cannot have dynamic type Box[int] (missing method Set (func (*Box[T]) Set(v T) has a pointer receiver))",
+	}
+	if strings.Join(errs, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong errors\nexpected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(errs, "\n"))
+	}
+}
+
+func TestGenericsWrongNumberOfTypeArgs(t *testing.T) {
+	src := `package genericstest
+
+type Pair[K comparable, V] struct {
+	k K
+	v V
+}
+
+func Swap[T, U](t T, u U) (U, T) {
+	return u, t
+}
+
+func main() {
+	_ = Pair[string]{}
+	_ = Pair[string, int, bool, byte]{}
+	_, _ = Swap[int](1, 2)
+}
+`
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "genericstest.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errs []string
+	conf := Config{Error: func(err error) { errs = append(errs, err.Error()) }}
+	conf.Check("genericstest", fset, []*ast.File{f}, nil)
+	expected := []string{
+		"genericstest.go:13:10: wrong number of type arguments for Pair (expected 2 but got 1): missing type argument for V",
+		"genericstest.go:3:6: \tPair declared with type parameters [K comparable, V]",
+		"genericstest.go:14:10: wrong number of type arguments for Pair (expected 2 but got 4): extra type arguments bool, byte",
+		"genericstest.go:3:6: \tPair declared with type parameters [K comparable, V]",
+		"genericstest.go:15:13: wrong number of type arguments for Swap (expected 2 but got 1): missing type argument for U",
+		"genericstest.go:8:6: \tSwap declared with type parameters [T, U]",
+	}
+	if strings.Join(errs, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong errors\nexpected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(errs, "\n"))
+	}
+}
+
+func TestGenericsConversions(t *testing.T) {
+	src := `package genericstest
+
+type Box[T] struct{ v T }
+
+type Other[U] struct{ v U }
+
+type IntBox struct{ v int }
+
+func convert[T](x T) T {
+	b := Box[T]{x}
+	o := Other[T](b)
+	p := (*Box[T])(&o)
+	return p.v
+}
+
+func main() {
+	b := Box[int]{1}
+	_ = IntBox(b)
+	_ = Box[int](IntBox{2})
+	_ = Other[int](b)
+	_ = (*IntBox)(&b)
+	_ = convert(3)
+	_ = Other[string](b)
+}
+`
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "genericstest.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errs []string
+	conf := Config{Error: func(err error) { errs = append(errs, err.Error()) }}
+	conf.Check("genericstest", fset, []*ast.File{f}, nil)
+	expected := []string{
+		"genericstest.go:23:20: cannot convert b (variable of type Box[int]) to Other[string]",
+	}
+	if strings.Join(errs, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong errors\nexpected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(errs, "\n"))
+	}
+}
+
+func TestGenericsAssignability(t *testing.T) {
+	src := `package genericstest
+
+type Seq[T] func(yield func(T) bool)
+
+type Box[T] struct{ v T }
+
+func (s Seq[T]) Map[U](f func(T) U) Seq[U] {
+	return func(yield func(U) bool) {
+		s(func(x T) bool { return yield(f(x)) })
+	}
+}
+
+func wrap[U](x U) Box[U] {
+	return struct{ v U }{x}
+}
+
+func main() {
+	var s Seq[int] = func(yield func(int) bool) {}
+	_ = s.Map[string](func(int) string { return "" })
+	_ = wrap(1)
+	var _ Seq[int] = func(yield func(string) bool) {}
+}
+`
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "genericstest.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errs []string
+	conf := Config{Error: func(err error) { errs = append(errs, err.Error()) }}
+	conf.Check("genericstest", fset, []*ast.File{f}, nil)
+	expected := []string{
+		"genericstest.go:21:19: cannot use (func(yield func(string) bool) literal) (value of type func(yield func(string) bool)) as Seq[int] value in variable declaration",
+	}
+	if strings.Join(errs, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong errors\nexpected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(errs, "\n"))
+	}
+}
+
+func TestGenericsConstParams(t *testing.T) {
+	src := `package genericstest
+
+type Vec[T, N] [N]T
+
+func Make[N]() Vec[string, N] {
+	var v Vec[string, N]
+	return v
+}
+
+func main() {
+	var v Vec[int, 3]
+	_ = v[2]
+	_ = v[3]
+	_ = Make[2]()
+	_ = Vec[int, -1]{}
+	_ = Vec[int, 1.5]{}
+	_ = Vec[int, int]{}
+	_ = Vec[3, 2]{}
+	_ = Make[string]()
+}
+`
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "genericstest.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errs []string
+	conf := Config{Error: func(err error) { errs = append(errs, err.Error()) }}
+	info := &Info{Types: map[ast.Expr]TypeAndValue{}}
+	conf.Check("genericstest", fset, []*ast.File{f}, info)
+	expected := []string{
+		"genericstest.go:13:8: index 3 (constant of type int) is out of bounds",
+		"genericstest.go:15:15: type argument -1 (untyped int constant) must be a non-negative integer constant",
+		"genericstest.go:16:15: type argument 1.5 (untyped float constant) must be a non-negative integer constant",
+		"genericstest.go:17:15: int is not a constant (type parameter N is an array length)",
+		"genericstest.go:18:10: 3 is not a type (type parameter T is not an array length)",
+		"genericstest.go:19:11: string is not a constant (type parameter N is an array length)",
+	}
+	if strings.Join(errs, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong errors\nexpected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(errs, "\n"))
+	}
+
+	// The length of a concrete type is known.
+	found := false
+	for expr, tv := range info.Types {
+		if ExprString(expr) != "Vec[int, 3]" {
+			continue
+		}
+		found = true
+		array, ok := tv.Type.Underlying().(*Array)
+		if !ok || array.Len() != 3 || array.LenParam() != nil {
+			t.Errorf("wrong underlying type for %s: %s", ExprString(expr), tv.Type.Underlying())
+		}
+	}
+	if !found {
+		t.Error("no type recorded for Vec[int, 3]")
+	}
+}
+
+func TestGenericsMethodExprs(t *testing.T) {
+	src := `package genericstest
+
+type List[T] struct {
+	items []T
+}
+
+func (l List[T]) Head() T { return l.items[0] }
+
+func (l *List[T]) Push(x T) {}
+
+func (l List[T]) Map[U](f func(T) U) List[U] { return List[U]{} }
+
+func (l *List[T]) Zip[U, V](other List[U], f func(T, U) V) List[V] { return List[V]{} }
+
+var (
+	head  = List[int].Head
+	push  = (*List[int]).Push
+	m     = List[int].Map[string]
+	zip   = (*List[int]).Zip[string, bool]
+	_     = List[int].Map[string](List[int]{}, nil).Head()
+	wrong = List[int].Map[string](List[string]{}, nil)
+)
+`
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "genericstest.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errs []string
+	conf := Config{Error: func(err error) { errs = append(errs, err.Error()) }}
+	pkg, _ := conf.Check("genericstest", fset, []*ast.File{f}, nil)
+	expected := []string{
+		"genericstest.go:21:36: cannot use (List[string] literal) (value of type List[string]) as List[int] value in argument to List[int].Map[string]",
+	}
+	if strings.Join(errs, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong errors\nexpected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(errs, "\n"))
+	}
+	for name, want := range map[string]string{
+		"head": "func(genericstest.List[int]) int",
+		"push": "func(*genericstest.List[int], x int)",
+		"m":    "func(genericstest.List[int], f func(int) string) genericstest.List[string]",
+		"zip":  "func(*genericstest.List[int], other genericstest.List[string], f func(int, string) bool) genericstest.List[bool]",
+	} {
+		if got := pkg.Scope().Lookup(name).Type().String(); got != want {
+			t.Errorf("wrong type for %s\nexpected: %s\ngot:      %s", name, want, got)
+		}
+	}
+}
+
+func TestGenericsInstantiatePragmas(t *testing.T) {
+	const decls = `
+type Box[T] struct{ v T }
+
+func (b Box[T]) Map[U](f func(T) U) Box[U] { return Box[U]{f(b.v)} }
+
+type Pair[K comparable, V] struct {
+	k K
+	v V
+}
+
+func First[T](xs []T) T { return xs[0] }
+`
+	src := `package genericstest
+
+//fo:instantiate Box[int] Pair[int, string]
+//fo:instantiate First[float64] Box[int].Map[string]
+` + decls
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "genericstest.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg, err := (&Config{}).Check("genericstest", fset, []*ast.File{f}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	usages := map[string][]string{}
+	for _, decl := range pkg.Generics() {
+		for _, usg := range decl.Usages {
+			usages[decl.Name] = append(usages[decl.Name], usg.String())
+		}
+	}
+	for name, want := range map[string]string{
+		"Box":   "genericstest.Box[int] genericstest.Box[string]",
+		"Map":   "func(f func(int) string) genericstest.Box[string]",
+		"Pair":  "genericstest.Pair[int,string]",
+		"First": "func(xs []float64) float64",
+	} {
+		sort.Strings(usages[name])
+		if got := strings.Join(usages[name], " "); got != want {
+			t.Errorf("wrong usages of %s\nexpected: %s\ngot:      %s", name, want, got)
+		}
+	}
+
+	src = `package genericstest
+
+//fo:instantiate Box Box[int, int] Box[Nope] Pair[[]int, int]
+//fo:instantiate Box[int
+//fo:instantiate
+` + decls
+	f, err = parser.ParseFile(fset, "genericstest.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errs []string
+	conf := Config{Error: func(err error) { errs = append(errs, err.Error()) }}
+	conf.Check("genericstest", fset, []*ast.File{f}, nil)
+	expected := []string{
+		"genericstest.go:3:18: Box is not an instantiation of a generic type or function",
+		"genericstest.go:3:25: wrong number of type arguments for Box (expected 1 but got 2): extra type argument int",
+		"genericstest.go:7:6: \tBox declared with type parameters [T]",
+		"genericstest.go:3:40: undeclared name: Nope",
+		"genericstest.go:4:18: invalid instantiation Box[int: expected generic type arguments or index or slice expression, found newline",
+		"genericstest.go:5:1: fo:instantiate requires at least one instantiation",
+		"genericstest.go:3:51: []int does not satisfy comparable (required by type parameter K)",
+	}
+	if strings.Join(errs, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong errors\nexpected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(errs, "\n"))
+	}
+}
+
+func TestGenericsFoNames(t *testing.T) {
+	src := `package genericstest
+
+type Box[T] struct{ v T }
+
+type Pair[K, V] struct {
+	k K
+	v V
+}
+
+func First[T](xs []T) T { return xs[0] }
+
+var pair Pair[int, Box[string]]
+
+var _ int = pair
+var _ int = First[Pair[string, Box[int]]]
+`
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "genericstest.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errs []string
+	conf := Config{Error: func(err error) { errs = append(errs, err.Error()) }}
+	pkg, _ := conf.Check("genericstest", fset, []*ast.File{f}, nil)
+	expected := []string{
+		"genericstest.go:14:13: cannot use pair (variable of type Pair[int, Box[string]]) as int value in variable declaration",
+		"genericstest.go:15:13: cannot use First (value of type func(xs []Pair[string, Box[int]]) Pair[string, Box[int]]) as int value in variable declaration",
+	}
+	if strings.Join(errs, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong errors\nexpected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(errs, "\n"))
+	}
+
+	pair := pkg.Scope().Lookup("pair").Type()
+	for _, test := range []struct {
+		qf   Qualifier
+		want string
+	}{
+		{nil, "genericstest.Pair[int,genericstest.Box[string]]"},
+		{FoNames(nil), "genericstest.Pair[int, genericstest.Box[string]]"},
+		{FoNames(RelativeTo(pkg)), "Pair[int, Box[string]]"},
+		{FoNames(func(pkg *Package) string { return pkg.Name() }), "genericstest.Pair[int, genericstest.Box[string]]"},
+	} {
+		if got := TypeString(pair, test.qf); got != test.want {
+			t.Errorf("got %s, want %s", got, test.want)
+		}
+	}
+}
+
+func TestGenericsMethodSets(t *testing.T) {
+	pkg := parseTestSource(t, `package genericstest
+
+type Getter interface{ Get() int }
+
+type Inner struct{ n int }
+
+func (Inner) Hello() {}
+
+type Box[T] struct {
+	Inner
+	v T
+}
+
+func (b Box[T]) Get() T { return b.v }
+
+func (b *Box[T]) Set(v T) { b.v = v }
+
+var (
+	boxInt    Box[int]
+	boxString Box[string]
+)
+`)
+	lookup := func(name string) Type { return pkg.Scope().Lookup(name).Type() }
+	boxInt, boxString := lookup("boxInt"), lookup("boxString")
+
+	for _, test := range []struct {
+		typ  Type
+		want string
+	}{
+		{boxInt, "Get() int, Hello()"},
+		{NewPointer(boxInt), "Get() int, Hello(), Set(v int)"},
+		{lookup("Box"), "Get() T, Hello()"},
+		{NewPointer(lookup("Box")), "Get() T, Hello(), Set(v T)"},
+	} {
+		mset := NewMethodSet(test.typ)
+		var methods []string
+		for i := 0; i < mset.Len(); i++ {
+			m := mset.At(i).Obj().(*Func)
+			methods = append(methods, m.Name()+strings.TrimPrefix(m.Type().String(), "func"))
+		}
+		if got := strings.Join(methods, ", "); got != test.want {
+			t.Errorf("method set of %s: got %s, want %s", test.typ, got, test.want)
+		}
+	}
+
+	obj, index, indirect := LookupFieldOrMethod(boxInt, false, pkg, "Set")
+	if obj != nil || !indirect {
+		t.Errorf("Set of Box[int]: got %v, %v, %v; want a pointer receiver to be required", obj, index, indirect)
+	}
+	obj, index, indirect = LookupFieldOrMethod(boxInt, true, pkg, "Set")
+	if obj == nil || obj.Type().String() != "func(v int)" || fmt.Sprint(index) != "[1]" || indirect {
+		t.Errorf("Set of addressable Box[int]: got %v, %v, %v", obj, index, indirect)
+	}
+	obj, index, _ = LookupFieldOrMethod(boxInt, false, pkg, "n")
+	if obj == nil || obj.Type().String() != "int" || fmt.Sprint(index) != "[0 0]" {
+		t.Errorf("n of Box[int]: got %v, %v", obj, index)
+	}
+
+	getter := lookup("Getter").Underlying().(*Interface)
+	if m, wrongType := MissingMethod(boxInt, getter, true); m != nil {
+		t.Errorf("Box[int] does not implement Getter: missing %s (wrong type: %v)", m.Name(), wrongType)
+	}
+	if m, wrongType := MissingMethod(boxString, getter, true); m == nil || m.Name() != "Get" || !wrongType {
+		t.Errorf("Box[string] implements Getter: got %v, %v", m, wrongType)
+	}
+}
+
+func TestGenericsPointerReceivers(t *testing.T) {
+	src := `package genericstest
+
+type Named Box[int]
+
+type Box[T] struct {
+	v T
+}
+
+func (b *Box[T]) Set(v T) { b.v = v }
+
+type Embedded struct {
+	Box[int]
+}
+
+func newBox() Box[int] { return Box[int]{} }
+
+func main() {
+	var b Box[int]
+	b.Set(1)
+	(&b).Set(1)
+	(&Box[int]{}).Set(1)
+	(*Box[int]).Set(&b, 1)
+	_ = b.Set
+	arr := [1]Box[int]{}
+	arr[0].Set(1)
+	var e Embedded
+	e.Set(1)
+	var n Named
+	n.v = 1
+	(*Box[int])(&n).Set(n.v)
+	_ = Box[int](n)
+
+	Box[int]{}.Set(1)
+	newBox().Set(1)
+	m := map[string]Box[int]{}
+	m["a"].Set(1)
+	Box[int].Set(b, 1)
+	n.Set(1)
+}
+`
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "genericstest.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errs []string
+	conf := Config{Error: func(err error) { errs = append(errs, err.Error()) }}
+	pkg, _ := conf.Check("genericstest", fset, []*ast.File{f}, nil)
+	expected := []string{
+		"genericstest.go:33:5: invalid operation: Set is not in method set of Box[int]",
+		"genericstest.go:34:2: invalid operation: Set is not in method set of Box[int]",
+		"genericstest.go:36:2: invalid operation: Set is not in method set of Box[int]",
+		"genericstest.go:37:2: invalid operation: Set is not in method set of Box[int]",
+		"genericstest.go:38:2: invalid operation: n (variable of type Named) has no field or method Set",
+	}
+	if strings.Join(errs, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong errors\nexpected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(errs, "\n"))
+	}
+	if under := pkg.Scope().Lookup("Named").Type().Underlying(); under.String() != "struct{v int}" {
+		t.Errorf("wrong underlying type of Named: got %s, want struct{v int}", under)
+	}
+}
+
+func TestGenericsIncompleteSwitches(t *testing.T) {
+	src := `package genericstest
+
+type Box[T] struct{ v T }
+
+type Shape interface{ Area() int }
+
+type Square[T] struct{ side T }
+
+func (s Square[T]) Area() T { return s.side }
+
+func main() {
+	var x interface{} = Box[int]{1}
+	_ = Box[string]{}
+	_ = &Box[bool]{}
+	switch x.(type) {
+	case Box[int]:
+	case string:
+	}
+	switch x.(type) {
+	case Box[int], Box[string], Box[bool]:
+	}
+	switch x.(type) {
+	case Box[int]:
+	default:
+	}
+	switch x.(type) {
+	case *Box[int], *Box[bool]:
+	}
+	var s Shape = Square[int]{2}
+	_ = Square[string]{}
+	switch s.(type) {
+	case Square[int]:
+	}
+}
+`
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "genericstest.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"genericstest.go:15:2: type switch is missing cases for Box[string], Box[bool]",
+		"genericstest.go:26:2: type switch is missing cases for *Box[string]",
+	}
+
+	// Warnings.
+	var warnings []string
+	conf := Config{
+		WarnIncompleteSwitches: true,
+		Warn:                   func(err error) { warnings = append(warnings, err.Error()) },
+	}
+	if _, err := conf.Check("genericstest", fset, []*ast.File{f}, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if strings.Join(warnings, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong warnings\nexpected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(warnings, "\n"))
+	}
+
+	// Errors.
+	var errs []string
+	conf = Config{
+		StrictIncompleteSwitches: true,
+		Error:                    func(err error) { errs = append(errs, err.Error()) },
+	}
+	conf.Check("genericstest", fset, []*ast.File{f}, nil)
+	if strings.Join(errs, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong errors\nexpected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(errs, "\n"))
+	}
+}
+
+// mapImporter imports the packages it contains.
+type mapImporter map[string]*Package
+
+func (m mapImporter) Import(path string) (*Package, error) {
+	if pkg := m[path]; pkg != nil {
+		return pkg, nil
+	}
+	return nil, fmt.Errorf("package %q not found", path)
+}
+
+// An import which is only used in type arguments is used.
+func TestGenericsTypeArgImports(t *testing.T) {
+	src := `package genericstest
+
+import (
+	"a"
+	"b"
+	"c"
+	"d"
+	"e"
+)
+
+type Box[T] struct{ v T }
+
+type Pair[K, V] struct{}
+
+func f[T]() {}
+
+var x Box[a.Thing]
+
+type pair Pair[int, b.Thing]
+
+func g(m map[string]Box[c.Thing]) {}
+
+func unused[T]() {
+	_ = Box[d.Thing]{}
+}
+
+func main() {
+	f[e.Thing]()
+}
+`
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "genericstest.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imports := make(mapImporter)
+	for _, path := range []string{"a", "b", "c", "d", "e"} {
+		pkg := NewPackage(path, path)
+		obj := NewTypeName(token.NoPos, pkg, "Thing", nil)
+		NewNamed(obj, NewStruct(nil, nil), nil)
+		pkg.Scope().Insert(obj)
+		pkg.MarkComplete()
+		imports[path] = pkg
+	}
+	conf := Config{Importer: imports}
+	if _, err := conf.Check("genericstest", fset, []*ast.File{f}, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Calling a generic function with the type parameters of the enclosing
+// declaration as type arguments substitutes them in the result type.
+func TestGenericsPartialCalls(t *testing.T) {
+	src := `package genericstest
+
+type Pair[L, R] struct {
+	l L
+	r R
+}
+
+func MakePair[L, R](l L, r R) Pair[L, R] {
+	return Pair[L, R]{l, r}
+}
+
+func swap[A, B](p Pair[B, A], a A, b B) Pair[A, B] {
+	return MakePair[A, B](a, b)
+}
+
+func main() {
+	_ = swap[int, string](Pair[string, int]{}, 1, "")
+}
+`
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "genericstest.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var conf Config
+	if _, err := conf.Check("genericstest", fset, []*ast.File{f}, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGenericsInference(t *testing.T) {
+	src := `package genericstest
+
+type List[T] []T
+
+func NewList[T](xs ...T) List[T] { return List[T](xs) }
+
+func (l List[T]) Map[U](f func(T) U) List[U] { return nil }
+
+func (l List[T]) Filter(p func(T) bool) List[T] { return l }
+
+func Keys[K, V](m map[K]V) List[K] {
+	var keys []K
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return NewList(keys...)
+}
+
+func Pair[T](a, b T) []T { return []T{a, b} }
+
+var a = NewList("a", "b").Map(func(s string) int { return len(s) }).Filter(func(n int) bool { return n > 0 })
+var b = Keys(map[float64]bool{})
+var c = Pair(1, 2.5)
+`
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "genericstest.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &Info{InferredTypeArgs: map[ast.Expr][]Type{}}
+	var conf Config
+	pkg, err := conf.Check("genericstest", fset, []*ast.File{f}, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]string{
+		"a": "genericstest.List[int]",
+		"b": "genericstest.List[float64]",
+		"c": "[]float64",
+	} {
+		if typ := pkg.Scope().Lookup(name).Type().String(); typ != expected {
+			t.Errorf("wrong type for %s (expected %s but got %s)", name, expected, typ)
+		}
+	}
+	var inferred []string
+	for x, targs := range info.InferredTypeArgs {
+		call := x.(*ast.CallExpr)
+		inferred = append(inferred, fmt.Sprintf("%s: %s %v", fset.Position(call.Pos()), ExprString(call.Fun), targs))
+	}
+	sort.Strings(inferred)
+	expected := []string{
+		"genericstest.go:16:9: NewList [K]",
+		"genericstest.go:21:9: NewList [string]",
+		"genericstest.go:21:9: NewList(\"a\", \"b\").Map [int]",
+		"genericstest.go:22:9: Keys [float64 bool]",
+		"genericstest.go:23:9: Pair [float64]",
+	}
+	if strings.Join(inferred, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong inferred type arguments\nexpected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(inferred, "\n"))
+	}
+	var usages []string
+	for _, usg := range pkg.generics["NewList"].Usages {
+		usages = append(usages, usg.String())
+	}
+	sort.Strings(usages)
+	if got := strings.Join(usages, ", "); got != "func(xs ...float64) genericstest.List[float64], func(xs ...string) genericstest.List[string]" {
+		t.Errorf("wrong usages for NewList: %s", got)
+	}
+}
+
+func TestGenericsFuncValues(t *testing.T) {
+	src := `package genericstest
+
+type Box[T] struct{ v T }
+
+func Id[T](x T) T { return x }
+
+func Wrap[T](v T) Box[T] { return Box[T]{v} }
+
+func Apply[T](x T) T {
+	f := Id[T]
+	return f(x)
+}
+
+var a = Wrap(Id[int])
+var b Box[func(int) int] = a
+var c = Box[func(x int) (y int)]{Id[int]}
+var d = Apply[string]("d")
+`
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "genericstest.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &Info{InferredTypeArgs: map[ast.Expr][]Type{}}
+	var conf Config
+	pkg, err := conf.Check("genericstest", fset, []*ast.File{f}, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var inferred []string
+	for x, targs := range info.InferredTypeArgs {
+		call := x.(*ast.CallExpr)
+		inferred = append(inferred, fmt.Sprintf("%s: %s %v", fset.Position(call.Pos()), ExprString(call.Fun), targs))
+	}
+	sort.Strings(inferred)
+	// f(x) calls an instance of Id, so nothing is inferred for it.
+	if got, expected := strings.Join(inferred, "\n"), "genericstest.go:14:9: Wrap [func(x int) int]"; got != expected {
+		t.Errorf("wrong inferred type arguments\nexpected:\n%s\ngot:\n%s", expected, got)
+	}
+	if targ := info.InferredTypeArgs[findCall(f, "Wrap")][0]; fmt.Sprintf("%T", targ) != "*types.Signature" {
+		t.Errorf("type argument inferred from Id[int] is a %T, want a *types.Signature", targ)
+	}
+	var usages []string
+	for _, usg := range pkg.generics["Box"].Usages {
+		usages = append(usages, usg.String())
+	}
+	if got := strings.Join(usages, ", "); got != "genericstest.Box[func(x int) int]" {
+		t.Errorf("wrong usages for Box: %s", got)
+	}
+}
+
+// findCall returns the first call of the function named name in f.
+func findCall(f *ast.File, name string) *ast.CallExpr {
+	var call *ast.CallExpr
+	ast.Inspect(f, func(n ast.Node) bool {
+		if c, ok := n.(*ast.CallExpr); ok && call == nil && ExprString(c.Fun) == name {
+			call = c
+		}
+		return call == nil
+	})
+	return call
+}
+
+func TestGenericsAnonymousTypes(t *testing.T) {
+	src := `package genericstest
+
+type Box[T] struct{ v T }
+
+func (b Box[T]) Get() T { return b.v }
+
+func Read[T](g interface{ Get() T }) T { return g.Get() }
+
+func Pairs[T](xs []T) []struct {
+	i int
+	x T
+} {
+	return nil
+}
+
+var a = Read[string](Box[string]{"a"})
+var b = Pairs[int](nil)
+var c = Read[int](Box[string]{"c"})
+`
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "genericstest.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errs []string
+	conf := Config{Error: func(err error) { errs = append(errs, err.Error()) }}
+	pkg, _ := conf.Check("genericstest", fset, []*ast.File{f}, nil)
+	expected := []string{
+		"genericstest.go:18:22: cannot use (Box[string] literal) (value of type Box[string]) as interface{Get() int} value in argument to Read[int]: wrong type for method Get: have Get() string because T = string in func (Box[T]) Get() T, want Get() int",
+	}
+	if strings.Join(errs, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong errors\nexpected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(errs, "\n"))
+	}
+	for name, expected := range map[string]string{
+		"a": "string",
+		"b": "[]struct{i int; x int}",
+	} {
+		if typ := pkg.Scope().Lookup(name).Type().String(); typ != expected {
+			t.Errorf("wrong type for %s (expected %s but got %s)", name, expected, typ)
+		}
+	}
+	var usages []string
+	for _, usg := range pkg.generics["Read"].Usages {
+		usages = append(usages, usg.String())
+	}
+	sort.Strings(usages)
+	if got := strings.Join(usages, ", "); got != "func(g interface{Get() int}) int, func(g interface{Get() string}) string" {
+		t.Errorf("wrong usages for Read: %s", got)
+	}
+}
+
+func TestGenericsInferenceErrors(t *testing.T) {
+	src := `package genericstest
+
+type Stringer interface {
+	String() string
+}
+
+func Zero[T]() T {
+	var zero T
+	return zero
+}
+
+func Show[T Stringer](x T) string { return x.String() }
+
+func Pair[T](a, b T) []T { return []T{a, b} }
+
+func main() {
+	_ = Zero()
+	_ = Show(1)
+	_ = Pair(nil, nil)
+	_ = Pair(1, "a")
+}
+`
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "genericstest.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errs []string
+	conf := Config{Error: func(err error) { errs = append(errs, err.Error()) }}
+	conf.Check("genericstest", fset, []*ast.File{f}, nil)
+	expected := []string{
+		"genericstest.go:17:11: cannot infer type argument for type parameter T in call to Zero",
+		"genericstest.go:19:19: cannot infer type argument for type parameter T in call to Pair",
+		"genericstest.go:20:14: cannot convert \"a\" (untyped string constant) to int",
+		"genericstest.go:18:12: int does not satisfy Stringer (missing method String, required by type parameter T)",
+	}
+	if strings.Join(errs, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong errors\nexpected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(errs, "\n"))
+	}
+}
+
+func TestGenericsLiteralInference(t *testing.T) {
+	src := `package genericstest
+
+type Box[T] struct{ v T }
+
+type Tuple[A, B] struct {
+	first  A
+	second B
+}
+
+func MakeTuple[A, B](first A, second B) Tuple[A, B] {
+	return Tuple{first, second}
+}
+
+var a Box[int] = Box{v: 3}
+var b *Box[string] = &Box{v: "b"}
+var c = []Box[float64]{Box{v: 1}, {v: 2}}
+
+func main() {
+	var d Tuple[int, string] = Tuple{1, "d"}
+	_ = d
+	_ = Box{v: 4}
+}
+`
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "genericstest.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errs []string
+	info := &Info{InferredTypeArgs: map[ast.Expr][]Type{}}
+	conf := Config{Error: func(err error) { errs = append(errs, err.Error()) }}
+	conf.Check("genericstest", fset, []*ast.File{f}, info)
+	if got := strings.Join(errs, "\n"); got != "genericstest.go:21:6: missing type arguments for type Box" {
+		t.Errorf("wrong errors: %s", got)
+	}
+	var inferred []string
+	for x, targs := range info.InferredTypeArgs {
+		lit := x.(*ast.CompositeLit)
+		inferred = append(inferred, fmt.Sprintf("%s: %s %v", fset.Position(lit.Pos()), ExprString(lit.Type), targs))
+	}
+	sort.Strings(inferred)
+	expected := []string{
+		"genericstest.go:11:9: Tuple [A B]",
+		"genericstest.go:14:18: Box [int]",
+		"genericstest.go:15:23: Box [string]",
+		"genericstest.go:16:24: Box [float64]",
+		"genericstest.go:19:29: Tuple [int string]",
+	}
+	if strings.Join(inferred, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong inferred type arguments\nexpected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(inferred, "\n"))
+	}
+}
+
+// Instantiating a generic declaration of an imported package adds the usages
+// needed by its body to the imported package.
+func TestGenericsImportedDependents(t *testing.T) {
+	libSrc := `package lib
+
+type Box[T] struct{ v T }
+
+func Wrap[T](v T) Box[T] {
+	return Box[T]{v}
+}
+
+func (b Box[T]) Map[U](f func(T) U) Box[U] {
+	return Wrap[U](f(b.v))
+}
+`
+	mainSrc := `package main
+
+import "lib"
+
+func main() {
+	_ = lib.Wrap[int](1).Map[string](func(int) string { return "" })
+}
+`
+
+	fset := token.NewFileSet()
+	libFile, err := parser.ParseFile(fset, "lib.go", libSrc, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mainFile, err := parser.ParseFile(fset, "main.go", mainSrc, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var libConf Config
+	lib, err := libConf.Check("lib", fset, []*ast.File{libFile}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := Config{Importer: mapImporter{"lib": lib}}
+	if _, err := conf.Check("main", fset, []*ast.File{mainFile}, nil); err != nil {
+		t.Fatal(err)
+	}
+	var usages []string
+	for _, usage := range lib.Generics()["Wrap"].Usages {
+		usages = append(usages, usage.String())
+	}
+	sort.Strings(usages)
+	expected := []string{"func(v int) lib.Box[int]", "func(v string) lib.Box[string]"}
+	if strings.Join(usages, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong usages of Wrap\nexpected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(usages, "\n"))
+	}
+}
+
+// The assertions in the body of a generic function are verified for its
+// usages by other packages too.
+func TestGenericsImportedImplAssertions(t *testing.T) {
+	libSrc := `package lib
+
+type Stringer interface {
+	String() string
+}
+
+func Show[T](x T) string {
+	assertImplements[T, Stringer]()
+	return ""
+}
+
+type Name string
+
+func (n Name) String() string { return string(n) }
+
+var _ = Show[Name]
+`
+	mainSrc := `package main
+
+import "lib"
+
+type Age int
+
+func main() {
+	_ = lib.Show(lib.Name(""))
+	_ = lib.Show(Age(3))
+}
+`
+
+	fset := token.NewFileSet()
+	libFile, err := parser.ParseFile(fset, "lib.go", libSrc, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mainFile, err := parser.ParseFile(fset, "main.go", mainSrc, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var libConf Config
+	lib, err := libConf.Check("lib", fset, []*ast.File{libFile}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errs []string
+	conf := Config{
+		Importer: mapImporter{"lib": lib},
+		Error:    func(err error) { errs = append(errs, err.Error()) },
+	}
+	conf.Check("main", fset, []*ast.File{mainFile}, nil)
+	expected := "lib.go:8:19: Age does not implement lib.Stringer (missing method String) for T = Age"
+	if got := strings.Join(errs, "\n"); got != expected {
+		t.Errorf("wrong errors\nexpected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+// nativeLib returns the package lib with the generic declarations
+//
+//	func Map[T, U any](xs []T, f func(T) U) []U
+//	type List[T comparable] struct{ elems []T }
+//	func (l *List[T]) Push(x T)
+//
+// which are created as the importer creates those of Go packages.
+func nativeLib(t *testing.T) *Package {
+	pkg := NewPackage("lib", "lib")
+	param := func(name string, typ Type) *Var {
+		return NewParam(token.NoPos, pkg, name, typ)
+	}
+
+	tp, up := NewTypeParam("T"), NewTypeParam("U")
+	mapSig := NewGenericSignature(
+		nil,
+		NewTuple(param("xs", NewSlice(tp)), param("f", NewSignature(nil, NewTuple(param("", tp)), NewTuple(param("", up)), false))),
+		NewTuple(param("", NewSlice(up))),
+		false,
+		[]*TypeParam{tp, up},
+		nil,
+	)
+	mapFunc := NewGenericFunc(token.NoPos, pkg, "Map", mapSig)
+	pkg.Scope().Insert(mapFunc)
+	AddNativeGeneric(mapFunc)
+
+	elem := NewTypeParam("T")
+	elem.SetConstraint(Universe.Lookup("comparable").Type())
+	obj := NewTypeName(token.NoPos, pkg, "List", nil)
+	fields := []*Var{NewField(token.NoPos, pkg, "elems", NewSlice(elem), false)}
+	list := NewGenericNamed(obj, NewStruct(fields, nil), nil, []*TypeParam{elem})
+	pkg.Scope().Insert(obj)
+	AddNativeGeneric(obj)
+
+	recvElem := NewTypeParam("T")
+	recvElem.SetConstraint(elem.Constraint())
+	recvType, err := Instantiate(list, []Type{recvElem})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pushSig := NewGenericSignature(param("l", NewPointer(recvType)), NewTuple(param("x", recvElem)), nil, false, nil, []*TypeParam{recvElem})
+	push := NewGenericFunc(token.NoPos, pkg, "Push", pushSig)
+	list.AddMethod(push)
+	AddNativeGeneric(push)
+
+	pkg.MarkComplete()
+	return pkg
+}
+
+// Generic declarations of Go packages can be instantiated like those of Fo
+// packages.
+func TestGenericsNative(t *testing.T) {
+	src := `package main
+
+import "lib"
+
+func main() {
+	var l lib.List[string]
+	l.Push("a")
+	_ = lib.Map[int, string]([]int{1}, func(int) string { return "" })
+	var _ lib.List[[]int]
+}
+`
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "main.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lib := nativeLib(t)
+	var errs []string
+	conf := Config{
+		Importer: mapImporter{"lib": lib},
+		Error: func(err error) {
+			errs = append(errs, err.Error())
+		},
+	}
+	conf.Check("main", fset, []*ast.File{f}, nil)
+	expectedErrs := []string{"main.go:9:17: []int does not satisfy comparable (required by type parameter T)"}
+	if strings.Join(errs, "\n") != strings.Join(expectedErrs, "\n") {
+		t.Errorf("wrong errors\nexpected:\n%s\ngot:\n%s", strings.Join(expectedErrs, "\n"), strings.Join(errs, "\n"))
+	}
+
+	for key, expected := range map[string][]string{
+		"Map":       {"func(xs []int, f func(int) string) []string"},
+		"List":      {"lib.List[[]int]", "lib.List[string]"},
+		"List.Push": {"func(x []int)", "func(x string)"},
+	} {
+		decl := lib.Generics()[key]
+		if !decl.Native {
+			t.Errorf("%s is not native", key)
+		}
+		var usages []string
+		for _, usage := range decl.Usages {
+			usages = append(usages, usage.String())
+		}
+		sort.Strings(usages)
+		if strings.Join(usages, "\n") != strings.Join(expected, "\n") {
+			t.Errorf("wrong usages of %s\nexpected:\n%s\ngot:\n%s", key, strings.Join(expected, "\n"), strings.Join(usages, "\n"))
+		}
+	}
+}
+
+// TestGenericsNativeGoVersion tests that instantiating the generic
+// declarations of Go packages is an error when targeting a Go version before
+// 1.18, which the Go compiler would have to instantiate them for.
+func TestGenericsNativeGoVersion(t *testing.T) {
+	src := `package main
+
+import "lib"
+
+func main() {
+	var l lib.List[string]
+	l.Push("a")
+	_ = lib.Map[int, string]([]int{1}, func(int) string { return "" })
+}
+`
+
+	for _, test := range []struct {
+		version string
+		errs    []string
+	}{
+		{"1.18", nil},
+		{"go1.21", nil},
+		{"1.17", []string{
+			"main.go:6:16: lib.List is a generic declaration of a Go package; instantiating it requires go1.18 or later (targeting go1.17)",
+			"main.go:8:13: lib.Map is a generic declaration of a Go package; instantiating it requires go1.18 or later (targeting go1.17)",
+		}},
+	} {
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, "main.go", src, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var errs []string
+		conf := Config{
+			Importer: mapImporter{"lib": nativeLib(t)},
+			Error: func(err error) {
+				errs = append(errs, err.Error())
+			},
+			GoVersion: test.version,
+		}
+		conf.Check("main", fset, []*ast.File{f}, nil)
+		if strings.Join(errs, "\n") != strings.Join(test.errs, "\n") {
+			t.Errorf("%s: wrong errors\nexpected:\n%s\ngot:\n%s", test.version, strings.Join(test.errs, "\n"), strings.Join(errs, "\n"))
+		}
+	}
+}
+
+func TestParseGoVersion(t *testing.T) {
+	for _, test := range []struct {
+		s        string
+		expected string
+		err      string
+	}{
+		{"1.17", "go1.17", ""},
+		{"go1.21", "go1.21", ""},
+		{"1.21.3", "go1.21", ""},
+		{"1", "", `invalid Go version "1" (expected e.g. 1.21)`},
+		{"1.x", "", `invalid Go version "1.x" (expected e.g. 1.21)`},
+		{"1.021", "", `invalid Go version "1.021" (expected e.g. 1.21)`},
+		{"2.0", "", `unsupported Go version "2.0" (expected 1.x)`},
+	} {
+		v, err := ParseGoVersion(test.s)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("ParseGoVersion(%q): expected error %q, got %v", test.s, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseGoVersion(%q): %s", test.s, err)
+		} else if v.String() != test.expected {
+			t.Errorf("ParseGoVersion(%q) = %s, expected %s", test.s, v, test.expected)
+		}
+	}
+	if v := (GoVersion{1, 17}); v.AtLeast(1, 18) || !v.AtLeast(1, 17) || !(GoVersion{}).AtLeast(1, 99) {
+		t.Errorf("wrong results of AtLeast")
+	}
+}
+
+const concreteTypeCacheSrc = `package genericstest
+
+type Box[T] struct {
+	v T
+}
+
+func (b Box[T]) Get() T { return b.v }
+
+func f(b Box[int]) Box[int] {
+	var c Box[int]
+	return c
+}
+
+func main() {
+	_ = f(Box[int]{}).Get()
+}
+`
+
+func checkConcreteTypeCache(t *testing.T) []Type {
+	t.Helper()
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "genericstest.go", concreteTypeCacheSrc, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &Info{Types: map[ast.Expr]TypeAndValue{}}
+	var conf Config
+	if _, err := conf.Check("genericstest", fset, []*ast.File{f}, info); err != nil {
+		t.Fatal(err)
+	}
+	var types []Type
+	ast.Inspect(f, func(n ast.Node) bool {
+		if expr, ok := n.(*ast.TypeArgExpr); ok {
+			// The receiver Box[T] is not concrete.
+			if typ, ok := info.Types[expr].Type.(*ConcreteNamed); ok {
+				types = append(types, typ)
+			}
+		}
+		return true
+	})
+	return types
+}
+
+func TestGenericsConcreteTypeCache(t *testing.T) {
+	types := checkConcreteTypeCache(t)
+	if len(types) != 4 {
+		t.Fatalf("expected 4 usages of Box[int], got %d", len(types))
+	}
+	for _, typ := range types {
+		if typ != types[0] {
+			t.Errorf("Box[int] was created more than once")
+		}
+	}
+
+	// The cache belongs to the package, so checking the source again creates
+	// new concrete types.
+	if other := checkConcreteTypeCache(t); other[0] == types[0] {
+		t.Errorf("Box[int] was reused across packages")
+	}
+}
+
+func TestGenericsTraceInstantiation(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "genericstest.go", concreteTypeCacheSrc, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var traced []string
+	conf := Config{
+		TraceInstantiation: func(inst Instantiation) {
+			traced = append(traced, fmt.Sprintf("%s: %s", fset.Position(inst.Pos), inst))
+		},
+	}
+	if _, err := conf.Check("genericstest", fset, []*ast.File{f}, nil); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		// the receiver of Get
+		"genericstest.go:7:12: Box[T=T] = (partial)genericstest.Box[T]",
+		"genericstest.go:9:13: Box[T=int] = genericstest.Box[int]",
+		"genericstest.go:9:23: Box[T=int] = genericstest.Box[int] (cached)",
+		"genericstest.go:10:11: Box[T=int] = genericstest.Box[int] (cached)",
+		"genericstest.go:15:11: Box[T=int] = genericstest.Box[int] (cached)",
+	}
+	if got := strings.Join(traced, "\n"); got != strings.Join(expected, "\n") {
+		t.Errorf("wrong instantiations\nexpected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), got)
+	}
+}
+
+func BenchmarkGenericsRepeatedUsages(b *testing.B) {
+	var buf strings.Builder
+	buf.WriteString("package genericstest\n\ntype Pair[K comparable, V] struct {\n\tk K\n\tv V\n}\n\nfunc (p Pair[K, V]) Key() K { return p.k }\n")
+	for i := 0; i < 500; i++ {
+		fmt.Fprintf(&buf, "\nfunc f%d(p Pair[string, int]) Pair[string, int] {\n\tvar q Pair[string, int]\n\t_ = p.Key()\n\treturn q\n}\n", i)
+	}
+	src := buf.String()
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "genericstest.go", src, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(src)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var conf Config
+		if _, err := conf.Check("genericstest", fset, []*ast.File{f}, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestGenericDecls(t *testing.T) {
+	var src = `package genericstest
+
+type Box[T] struct{ v T }
+
+func (b Box[T]) With[U](u U) Box[T] { return b }
+
+func Map[T, U](x T, f func(T) U) U { return f(x) }
+
+func main() {
+	var b Box[int]
+	_ = b.With[string]("")
+	_ = Map[bool, int](true, func(bool) int { return 0 })
+}
+`
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "genericstest.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var conf Config
+	pkg, err := conf.Check("genericstest", fset, []*ast.File{f}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := []string{}
+	for _, decl := range pkg.GenericDecls() {
+		if pkg.Generics()[decl.Key()] != decl {
+			t.Errorf("GenericDecls returned %s, which is not in Generics", decl.Key())
+		}
+		recv := ""
+		if decl.Recv() != nil {
+			recv = decl.Recv().Name()
+		}
+		params := []string{}
+		for _, param := range decl.TypeParams() {
+			params = append(params, param.String())
+		}
+		got = append(got, fmt.Sprintf("%s %s recv=%q %s [%s]", decl.Kind(), decl.Key(), recv, decl.Obj().Name(), strings.Join(params, ", ")))
+		for _, usg := range decl.Instances() {
+			args := []string{}
+			for _, arg := range usg.TypeArgs {
+				args = append(args, arg.String())
+			}
+			got = append(got, fmt.Sprintf("  [%s] at %s in %s", strings.Join(args, ", "), fset.Position(usg.Pos), usg.Pkg.Name()))
+		}
+	}
+	want := []string{
+		`type Box recv="" Box [T]`,
+		`  [int] at genericstest.go:10:11 in genericstest`,
+		`method Box.With recv="Box" With [T, U]`,
+		`  [int, string] at genericstest.go:11:12 in genericstest`,
+		`func Map recv="" Map [T, U]`,
+		`  [bool, int] at genericstest.go:12:9 in genericstest`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("wrong generic declarations:\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
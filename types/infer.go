@@ -0,0 +1,274 @@
+package types
+
+import (
+	"github.com/qProust/fo/ast"
+	"github.com/qProust/fo/constant"
+)
+
+// inferable returns the generic type of x, the operand of the function call
+// call, if the type arguments for it are to be inferred from the arguments
+// of the call: x is a generic function (e.g. Map) or a method with type
+// parameters of its own (e.g. l.Map for a l of type List[int]) which was not
+// instantiated. Method expressions (e.g. List[int].Map) are not inferable.
+func (check *Checker) inferable(x *operand, call *ast.CallExpr) GenericType {
+	switch fun := unparen(call.Fun).(type) {
+	case *ast.TypeArgExpr, *ast.IndexExpr:
+		return nil
+	case *ast.SelectorExpr:
+		if check.methodExprRecvs[fun] != nil {
+			return nil
+		}
+	}
+	switch t := x.typ.(type) {
+	case *GenericSignature:
+		return t
+	case *PartialGenericSignature:
+		// The type map of a method value holds the type arguments of the
+		// receiver type, and maps the type parameters of the method to
+		// themselves (see methodValueType and addPartialSigTypeParams). A
+		// type parameter of the enclosing declaration with the same name
+		// (e.g. T in Id[T]) is a type argument like any other.
+		for _, tp := range t.TypeParams() {
+			typ, found := t.typeMap[tp.String()]
+			if !found || typ == tp {
+				return t
+			}
+		}
+	}
+	return nil
+}
+
+// infer returns the type map for the type parameters of genType, the type of
+// the function called by call, which is inferred from the arguments args of
+// the call, as for a type argument expression with those type arguments. sig
+// is the signature of the function, in which the type arguments of the
+// receiver type (if any) were substituted. infer reports an error and returns
+// nil if a type argument cannot be inferred.
+//
+// The type arguments flow from the arguments to the parameters, so that in a
+// chain of calls like NewList(xs).Map(f).Filter(p) the result of each call,
+// which is an instance such as List[int], is the receiver from which the next
+// one is inferred.
+func (check *Checker) infer(call *ast.CallExpr, genType GenericType, sig *Signature, args []*operand) map[string]Type {
+	inf := inference{params: map[string]bool{}, typeMap: map[string]Type{}}
+	for _, tp := range genType.TypeParams() {
+		inf.params[tp.String()] = true
+	}
+	// Typed arguments come first, since an untyped constant (e.g. 1) only
+	// determines a type argument which is not inferred otherwise. Of several
+	// untyped constants, the one of the largest kind does, as in Go (e.g.
+	// float64 for 1 and 2.5).
+	for i, arg := range args {
+		if p := paramTypeOf(call, sig, i); p != nil && arg.mode != invalid && isTyped(arg.typ) {
+			inf.unify(p, arg.typ)
+		}
+	}
+	untyped := map[string]*Basic{}
+	for i, arg := range args {
+		tp, ok := paramTypeOf(call, sig, i).(*TypeParam)
+		if !ok || arg.mode == invalid || isTyped(arg.typ) || arg.typ == Typ[UntypedNil] {
+			continue
+		}
+		typ := arg.typ.(*Basic)
+		if prev, found := untyped[tp.String()]; !found || isNumeric(prev) && isNumeric(typ) && prev.kind < typ.kind {
+			untyped[tp.String()] = typ
+		}
+	}
+	for name, typ := range untyped {
+		inf.bind(name, Default(typ))
+	}
+	for _, tp := range genType.TypeParams() {
+		typ, found := inf.typeMap[tp.String()]
+		if !found {
+			check.errorf(call.Rparen, "cannot infer type argument for type parameter %s in call to %s", tp, call.Fun)
+			return nil
+		}
+		check.typeArgs = append(check.typeArgs, typeArgUse{call.Rparen, tp, typ})
+	}
+	return inf.typeMap
+}
+
+// paramTypeOf returns the type of the parameter of sig for the i-th argument
+// of call, or nil if there is none.
+func paramTypeOf(call *ast.CallExpr, sig *Signature, i int) Type {
+	n := sig.params.Len()
+	if sig.variadic && i >= n-1 {
+		last := sig.params.vars[n-1].typ
+		if call.Ellipsis.IsValid() {
+			return last
+		}
+		if s, ok := last.(*Slice); ok {
+			return s.elem
+		}
+		return nil
+	}
+	if i < n {
+		return sig.params.vars[i].typ
+	}
+	return nil
+}
+
+// An inference collects the type arguments which are inferred for the type
+// parameters params (by name).
+type inference struct {
+	params  map[string]bool
+	typeMap map[string]Type
+}
+
+// bind infers arg as the type argument for the type parameter name, unless
+// it is not one of the type parameters being inferred or already has a type
+// argument. Conflicting type arguments are reported when the arguments of the
+// call are checked against the instantiated signature. The type of an instance
+// of a generic function (e.g. Map[int] passed as an argument) stands for its
+// function type, as if it had been written out (e.g. func([]int) []int).
+func (inf *inference) bind(name string, arg Type) {
+	if sig, ok := arg.(*ConcreteSignature); ok {
+		arg = sig.Signature
+	}
+	if _, found := inf.typeMap[name]; inf.params[name] && !found {
+		inf.typeMap[name] = arg
+	}
+}
+
+// unify infers the type arguments which make the parameter type p identical
+// to the argument type a. An argument of a named type matches a parameter of
+// an unnamed type if its underlying type does, e.g. an IntSlice for a []T.
+func (inf *inference) unify(p, a Type) {
+	switch p := p.(type) {
+	case *TypeParam:
+		inf.bind(p.String(), a)
+	case *PartialGenericNamed:
+		inf.unifyTypeMaps(p.genType, p.typeMap, a)
+	case *PartialGenericSignature:
+		inf.unifyTypeMaps(p.genType, p.typeMap, a)
+	case *Pointer:
+		if a, ok := a.Underlying().(*Pointer); ok {
+			inf.unify(p.base, a.base)
+		}
+	case *Slice:
+		if a, ok := a.Underlying().(*Slice); ok {
+			inf.unify(p.elem, a.elem)
+		}
+	case *Array:
+		if a, ok := a.Underlying().(*Array); ok {
+			if p.lenParam != nil && a.lenParam == nil {
+				inf.bind(p.lenParam.String(), NewConstArg(constant.MakeInt64(a.len)))
+			}
+			inf.unify(p.elem, a.elem)
+		}
+	case *Map:
+		if a, ok := a.Underlying().(*Map); ok {
+			inf.unify(p.key, a.key)
+			inf.unify(p.elem, a.elem)
+		}
+	case *Chan:
+		if a, ok := a.Underlying().(*Chan); ok {
+			inf.unify(p.elem, a.elem)
+		}
+	case *Struct:
+		if a, ok := a.Underlying().(*Struct); ok && len(p.fields) == len(a.fields) {
+			for i, f := range p.fields {
+				inf.unify(f.typ, a.fields[i].typ)
+			}
+		}
+	case *Signature:
+		if a := underlyingSignature(a.Underlying()); a != nil {
+			inf.unifyTuples(p.params, a.params)
+			inf.unifyTuples(p.results, a.results)
+		}
+	}
+}
+
+// unifyTuples unifies the types of the variables of p and a, unless their
+// lengths differ.
+func (inf *inference) unifyTuples(p, a *Tuple) {
+	if p.Len() != a.Len() {
+		return
+	}
+	for i := 0; i < p.Len(); i++ {
+		inf.unify(p.vars[i].typ, a.vars[i].typ)
+	}
+}
+
+// unifyTypeMaps unifies the type arguments typeMap of a partially generic
+// parameter type, an instance of genType, with those of a, if a is an
+// instance of genType as well (e.g. List[T] with List[int]).
+func (inf *inference) unifyTypeMaps(genType GenericType, typeMap map[string]Type, a Type) {
+	conType, ok := a.(ConcreteType)
+	if !ok || conType.GenericType().Object() != genType.Object() {
+		return
+	}
+	for name, typ := range typeMap {
+		if arg, found := conType.TypeMap()[name]; found {
+			inf.unify(typ, arg)
+		}
+	}
+}
+
+// inferCall instantiates x, the generic function or method called by call
+// (see inferable), with the type arguments inferred from the arguments of the
+// call, which are provided by get. It returns a getter for the arguments which
+// does not evaluate them again. If the type arguments cannot be inferred, x
+// becomes invalid.
+func (check *Checker) inferCall(x *operand, call *ast.CallExpr, genType GenericType, get getter, n int) (getter, int) {
+	arg, n, _ := unpack(get, n, false)
+	if arg == nil {
+		x.mode = invalid
+		return nil, 0
+	}
+	args := make([]*operand, n)
+	for i := range args {
+		args[i] = new(operand)
+		arg(args[i], i)
+	}
+	get = func(x *operand, i int) { *x = *args[i] }
+
+	sig := underlyingSignature(genType)
+	partial, _ := genType.(*PartialGenericSignature)
+	if partial != nil {
+		sig = substTypeParams(partial.Signature, partial.typeMap).(*Signature)
+	}
+	typeMap := check.infer(call, genType, sig, args)
+	if typeMap == nil {
+		x.mode = invalid
+		return get, n
+	}
+	instTypeMap := typeMap
+	if partial != nil {
+		// The type arguments of the receiver type are kept, since they may be
+		// type parameters of the enclosing declaration which are yet to be
+		// replaced in its instances (see genericDependents).
+		instTypeMap = mergeTypeMap(partial.typeMap, typeMap)
+	}
+	x.typ = check.instantiate(call.Fun.Pos(), genType, instTypeMap)
+	if x.typ == Typ[Invalid] {
+		x.mode = invalid
+		return get, n
+	}
+	check.recordTypeAndValue(call.Fun, x.mode, x.typ, nil)
+	check.recordInferredTypeArgs(call, typeArgsOf(genType, typeMap))
+	return get, n
+}
+
+// literalInstance returns the type of a composite literal of the generic type
+// genType without type arguments (e.g. Box{v: 3}) which is assigned to a
+// variable of type hint: hint itself if it is an instance of genType (e.g.
+// Box[int], or Box[T] in the body of a generic declaration), and nil
+// otherwise.
+func literalInstance(genType *GenericNamed, hint Type) ConcreteType {
+	inst, ok := hint.(ConcreteType)
+	if !ok || inst.GenericType().Object() != genType.Object() {
+		return nil
+	}
+	return inst
+}
+
+// typeArgsOf returns the type arguments in typeMap for the type parameters of
+// genType, in order.
+func typeArgsOf(genType GenericType, typeMap map[string]Type) []Type {
+	targs := make([]Type, len(genType.TypeParams()))
+	for i, tp := range genType.TypeParams() {
+		targs[i] = typeMap[tp.String()]
+	}
+	return targs
+}
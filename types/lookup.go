@@ -33,6 +33,9 @@ package types
 //      but there was no pointer on the path from the actual receiver type to
 //	the method's formal receiver base type, nor was the receiver addressable.
 //
+// T may be a generic named type or an instantiation of one, like for
+// NewMethodSet.
+//
 func LookupFieldOrMethod(T Type, addressable bool, pkg *Package, name string) (obj Object, index []int, indirect bool) {
 	// Methods cannot be associated to a named pointer type
 	// (spec: "The type denoted by T is called the receiver base type;
@@ -97,103 +100,7 @@ func lookupFieldOrMethod(T Type, addressable bool, pkg *Package, name string) (o
 
 			// If we have a named type, we may have associated methods.
 			// Look for those first.
-			if named, _ := typ.(*Named); named != nil {
-				if seen[named] {
-					// We have seen this type before, at a more shallow depth
-					// (note that multiples of this type at the current depth
-					// were consolidated before). The type at that depth shadows
-					// this same type at the current depth, so we can ignore
-					// this one.
-					continue
-				}
-				if seen == nil {
-					seen = make(map[*Named]bool)
-				}
-				seen[named] = true
-
-				// look for a matching attached method
-				if i, m := lookupMethod(named.methods, pkg, name); m != nil {
-					// potential match
-					assert(m.typ != nil)
-					index = concat(e.index, i)
-					if obj != nil || e.multiples {
-						return nil, index, false // collision
-					}
-					obj = m
-					indirect = e.indirect
-					continue // we can't have a matching field or interface method
-				}
-
-				// continue with underlying type
-				typ = named.underlying
-			} else if concrete, _ := typ.(*ConcreteNamed); concrete != nil {
-				// TODO(albrow): Reduce code duplication for the *Named and
-				// *ConcreteNamed cases.
-				named := concrete.Named
-				if seen[named] {
-					// We have seen this type before, at a more shallow depth
-					// (note that multiples of this type at the current depth
-					// were consolidated before). The type at that depth shadows
-					// this same type at the current depth, so we can ignore
-					// this one.
-					continue
-				}
-				if seen == nil {
-					seen = make(map[*Named]bool)
-				}
-				seen[named] = true
-
-				// look for a matching attached method
-				if i, m := lookupMethod(named.methods, pkg, name); m != nil {
-					// potential match
-					assert(m.typ != nil)
-					index = concat(e.index, i)
-					if obj != nil || e.multiples {
-						return nil, index, false // collision
-					}
-					obj = m
-					indirect = e.indirect
-					continue // we can't have a matching field or interface method
-				}
-
-				// continue with underlying type
-				typ = named.underlying
-			} else if genericNamed, _ := typ.(*GenericNamed); genericNamed != nil {
-				// TODO(albrow): Reduce code duplication for the *Named and
-				// *GenericNamed cases.
-				named := genericNamed.Named
-				if seen[named] {
-					// We have seen this type before, at a more shallow depth
-					// (note that multiples of this type at the current depth
-					// were consolidated before). The type at that depth shadows
-					// this same type at the current depth, so we can ignore
-					// this one.
-					continue
-				}
-				if seen == nil {
-					seen = make(map[*Named]bool)
-				}
-				seen[named] = true
-
-				// look for a matching attached method
-				if i, m := lookupMethod(named.methods, pkg, name); m != nil {
-					// potential match
-					assert(m.typ != nil)
-					index = concat(e.index, i)
-					if obj != nil || e.multiples {
-						return nil, index, false // collision
-					}
-					obj = m
-					indirect = e.indirect
-					continue // we can't have a matching field or interface method
-				}
-
-				// continue with underlying type
-				typ = named.underlying
-			} else if partialGenNamed, _ := typ.(*PartialGenericNamed); partialGenNamed != nil {
-				// TODO(albrow): Reduce code duplication for the *Named and
-				// *PartialGenericNamed cases.
-				named := partialGenNamed.Named
+			if named := namedOf(typ); named != nil {
 				if seen[named] {
 					// We have seen this type before, at a more shallow depth
 					// (note that multiples of this type at the current depth
@@ -222,6 +129,9 @@ func lookupFieldOrMethod(T Type, addressable bool, pkg *Package, name string) (o
 
 				// continue with underlying type
 				typ = named.underlying
+			} else if tp, _ := typ.(*TypeParam); tp != nil {
+				// the methods of a type parameter are those of its constraint
+				typ = tp.Underlying()
 			}
 
 			switch t := typ.(type) {
@@ -289,6 +199,24 @@ func lookupFieldOrMethod(T Type, addressable bool, pkg *Package, name string) (o
 	return nil, nil, false // not found
 }
 
+// namedOf returns the *Named which holds the methods and the underlying type
+// of typ if typ is a named type: a *Named, a *GenericNamed, or an
+// instantiation of one (a *ConcreteNamed or *PartialGenericNamed). Otherwise
+// it returns nil.
+func namedOf(typ Type) *Named {
+	switch t := typ.(type) {
+	case *Named:
+		return t
+	case *GenericNamed:
+		return t.Named
+	case *ConcreteNamed:
+		return t.Named
+	case *PartialGenericNamed:
+		return t.Named
+	}
+	return nil
+}
+
 // embeddedType represents an embedded type
 type embeddedType struct {
 	typ       Type
@@ -362,7 +290,7 @@ func MissingMethod(V Type, T *Interface, static bool) (method *Func, wrongType b
 				if static {
 					return m, false
 				}
-			case !Identical(obj.Type(), m.typ):
+			case !identicalMethod(obj.Type(), m.typ):
 				return m, true
 			}
 		}
@@ -380,7 +308,11 @@ func MissingMethod(V Type, T *Interface, static bool) (method *Func, wrongType b
 
 		// Methods of type *ConcreteSignature should be considered implementing the
 		// method if the underlying signature implements the method.
-		if conSig, ok := f.typ.(*ConcreteSignature); ok {
+		if _, ok := m.typ.(*GenericSignature); ok {
+			if !identicalMethod(f.typ, m.typ) {
+				return m, true
+			}
+		} else if conSig, ok := f.typ.(*ConcreteSignature); ok {
 			if !Identical(conSig.Signature, m.typ) {
 				return m, true
 			}
@@ -394,6 +326,39 @@ func MissingMethod(V Type, T *Interface, static bool) (method *Func, wrongType b
 	return
 }
 
+// identicalMethod reports whether a method of type x implements the interface
+// method of type y. If y declares its own type parameters, x must declare the
+// same number of type parameters and its signature must be identical to y
+// once the type parameters of x are replaced by the corresponding (by
+// position) type parameters of y. Any type arguments of the receiver of x are
+// applied as well.
+func identicalMethod(x, y Type) bool {
+	ySig, ok := y.(*GenericSignature)
+	if !ok {
+		return Identical(x, y)
+	}
+	var xSig *GenericSignature
+	smap := map[string]Type{}
+	switch x := x.(type) {
+	case *GenericSignature:
+		xSig = x
+	case *PartialGenericSignature:
+		xSig = x.genType
+		for name, typ := range x.typeMap {
+			smap[name] = typ
+		}
+	default:
+		return false
+	}
+	if len(xSig.typeParams) != len(ySig.typeParams) {
+		return false
+	}
+	for i, tp := range xSig.typeParams {
+		smap[tp.String()] = ySig.typeParams[i]
+	}
+	return Identical(substTypeParams(xSig.Signature, smap), ySig.Signature)
+}
+
 // assertableTo reports whether a value of type V can be asserted to have type T.
 // It returns (nil, false) as affirmative answer. Otherwise it returns a missing
 // method required by V and whether it is missing or just has the wrong type.
@@ -65,6 +65,9 @@ var emptyMethodSet MethodSet
 
 // NewMethodSet returns the method set for the given type T.
 // It always returns a non-nil method set, even if it is empty.
+// For an instantiation of a generic named type such as Box[int], the
+// methods have the type arguments applied; for the generic type itself,
+// their signatures refer to its type parameters.
 func NewMethodSet(T Type) *MethodSet {
 	// WARNING: The code in this function is extremely subtle - do not modify casually!
 	//          This function and lookupFieldOrMethod should be kept in sync.
@@ -104,7 +107,7 @@ func NewMethodSet(T Type) *MethodSet {
 
 			// If we have a named type, we may have associated methods.
 			// Look for those first.
-			if named, _ := typ.(*Named); named != nil {
+			if named := namedOf(typ); named != nil {
 				if seen[named] {
 					// We have seen this type before, at a more shallow depth
 					// (note that multiples of this type at the current depth
@@ -122,6 +125,9 @@ func NewMethodSet(T Type) *MethodSet {
 
 				// continue with underlying type
 				typ = named.underlying
+			} else if tp, _ := typ.(*TypeParam); tp != nil {
+				// the methods of a type parameter are those of its constraint
+				typ = tp.Underlying()
 			}
 
 			switch t := typ.(type) {
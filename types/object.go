@@ -194,6 +194,8 @@ func (obj *TypeName) IsAlias() bool {
 		return obj.pkg != nil || t.name != obj.name || t == universeByte || t == universeRune
 	case *Named:
 		return obj != t.obj
+	case *GenericNamed:
+		return obj != t.obj
 	default:
 		return true
 	}
@@ -247,6 +249,7 @@ type BaseFunc interface {
 // An abstract method may belong to many interfaces due to embedding.
 type Func struct {
 	object
+	generic *Func // method of a generic type which obj was instantiated from, or nil
 }
 
 // NewFunc returns a new function with the given signature, representing
@@ -257,7 +260,15 @@ func NewFunc(pos token.Pos, pkg *Package, name string, sig *Signature) *Func {
 	if sig != nil {
 		typ = sig
 	}
-	return &Func{object{nil, pos, pkg, name, typ, 0, token.NoPos}}
+	return &Func{object{nil, pos, pkg, name, typ, 0, token.NoPos}, nil}
+}
+
+// NewGenericFunc returns a new function or method with the given generic
+// signature, which records the new function as its declaration.
+func NewGenericFunc(pos token.Pos, pkg *Package, name string, sig *GenericSignature) *Func {
+	obj := &Func{object{nil, pos, pkg, name, sig, 0, token.NoPos}, nil}
+	sig.obj = obj
+	return obj
 }
 
 // FullName returns the package- or receiver-type-qualified name of
@@ -273,6 +284,15 @@ func (obj *Func) Scope() *Scope { return obj.typ.(*Signature).scope }
 
 func (*Func) isDependency() {} // a function may be a dependency of an initialization expression
 
+// origin returns the method of a generic type which obj was instantiated
+// from (e.g. Box.Get for Box[int].Get), or obj itself.
+func (obj *Func) origin() *Func {
+	if obj.generic != nil {
+		return obj.generic
+	}
+	return obj
+}
+
 func (obj *Func) setType(typ Type) {
 	obj.typ = typ
 }
@@ -42,4 +42,9 @@ func TestIsAlias(t *testing.T) {
 	} {
 		check(test.name, test.alias)
 	}
+
+	// generic types
+	g1 := NewTypeName(0, pkg, "g1", nil)
+	g1.typ = NewGenericNamed(g1, new(Struct), nil, []*TypeParam{NewTypeParam("T")})
+	check(g1, false) // type name refers to generic named type and vice versa
 }
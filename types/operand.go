@@ -218,8 +218,8 @@ func (x *operand) assignableTo(conf *Config, T Type, reason *string) bool {
 		return true
 	}
 
-	Vu := V.Underlying()
-	Tu := T.Underlying()
+	Vu := substUnderlying(V)
+	Tu := substUnderlying(T)
 
 	// x is an untyped value representable by a value of type T
 	// TODO(gri) This is borrowing from checker.convertUntyped and
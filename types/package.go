@@ -7,6 +7,7 @@ package types
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/qProust/fo/token"
 )
@@ -62,10 +63,29 @@ func (pkg *Package) Imports() []*Package { return pkg.imports }
 // It is the caller's responsibility to make sure list elements are unique.
 func (pkg *Package) SetImports(list []*Package) { pkg.imports = list }
 
+// Generics returns the generic declarations of pkg, keyed by GenericDecl.Key.
+// Use GenericDecls to iterate over them in a deterministic order.
 func (pkg *Package) Generics() map[string]*GenericDecl {
 	return pkg.generics
 }
 
+// GenericDecls returns the generic declarations of pkg sorted by the position
+// of their declaration, and then by key.
+func (pkg *Package) GenericDecls() []*GenericDecl {
+	decls := make([]*GenericDecl, 0, len(pkg.generics))
+	for _, decl := range pkg.generics {
+		decls = append(decls, decl)
+	}
+	sort.Slice(decls, func(i, j int) bool {
+		pi, pj := decls[i].Obj().Pos(), decls[j].Obj().Pos()
+		if pi != pj {
+			return pi < pj
+		}
+		return decls[i].Key() < decls[j].Key()
+	})
+	return decls
+}
+
 func (pkg *Package) String() string {
 	return fmt.Sprintf("package %s (%q)", pkg.name, pkg.path)
 }
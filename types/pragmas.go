@@ -0,0 +1,155 @@
+package types
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/qProust/fo/ast"
+	"github.com/qProust/fo/parser"
+	"github.com/qProust/fo/scanner"
+	"github.com/qProust/fo/token"
+)
+
+// instantiatePragma is the prefix of a comment which lists instantiations
+// that are generated even if the package does not use them, e.g.
+//
+//	//fo:instantiate Box[int] Box[string] Sum[float64]
+//
+// This lets a library ship concrete types and functions for Go code which
+// imports the generated package.
+const instantiatePragma = "//fo:instantiate"
+
+// instantiatePragmas type-checks the instantiations listed by the
+// //fo:instantiate comments of the package files, which records them as
+// usages of their generic declarations.
+func (check *Checker) instantiatePragmas() {
+	for _, file := range check.files {
+		scope := check.pkg.scope.Innermost(file.Pos())
+		for _, group := range file.Comments {
+			for _, c := range group.List {
+				if c.Text != instantiatePragma && !strings.HasPrefix(c.Text, instantiatePragma+" ") && !strings.HasPrefix(c.Text, instantiatePragma+"\t") {
+					continue
+				}
+				args := splitPragmaArgs(c.Text, len(instantiatePragma))
+				if len(args) == 0 {
+					check.errorf(c.Pos(), "%s requires at least one instantiation", instantiatePragma[2:])
+					continue
+				}
+				for _, arg := range args {
+					check.instantiatePragmaArg(scope, c.Pos()+token.Pos(arg.offset), arg.text)
+				}
+			}
+		}
+	}
+}
+
+// A pragmaArg is an argument of a pragma along with its offset in the comment.
+type pragmaArg struct {
+	offset int
+	text   string
+}
+
+// splitPragmaArgs splits text, starting at offset start, into arguments
+// separated by white space. White space inside brackets and parentheses does
+// not separate arguments, so that e.g. Pair[int, string] is one argument.
+func splitPragmaArgs(text string, start int) []pragmaArg {
+	var args []pragmaArg
+	depth := 0
+	begin := -1
+	for i, r := range text[start:] {
+		i += start
+		switch {
+		case unicode.IsSpace(r) && depth == 0:
+			if begin >= 0 {
+				args = append(args, pragmaArg{begin, text[begin:i]})
+				begin = -1
+			}
+			continue
+		case r == '[' || r == '(' || r == '{':
+			depth++
+		case (r == ']' || r == ')' || r == '}') && depth > 0:
+			depth--
+		}
+		if begin < 0 {
+			begin = i
+		}
+	}
+	if begin >= 0 {
+		args = append(args, pragmaArg{begin, text[begin:]})
+	}
+	return args
+}
+
+// instantiatePragmaArg type-checks the instantiation arg of a pragma, which
+// starts at pos, in the file scope.
+func (check *Checker) instantiatePragmaArg(scope *Scope, pos token.Pos, arg string) {
+	// The argument is parsed as if it stood at pos, so that positions in
+	// errors refer to the comment: a line directive sets the file and line,
+	// and indentation the column.
+	p := check.fset.Position(pos)
+	filename := p.Filename
+	if !filepath.IsAbs(filename) {
+		// line directives are relative to the directory of the file
+		filename = filepath.Base(filename)
+	}
+	src := fmt.Sprintf("//line %s:%d\n%s%s", filename, p.Line, strings.Repeat(" ", p.Column-1), arg)
+	e, err := parser.ParseExprFrom(check.fset, p.Filename, src, 0)
+	if err != nil {
+		if list, ok := err.(scanner.ErrorList); ok && len(list) > 0 {
+			err = fmt.Errorf("%s", list[0].Msg)
+		}
+		check.errorf(pos, "invalid instantiation %s: %v", arg, err)
+		return
+	}
+	if index, ok := e.(*ast.IndexExpr); ok {
+		// Box[int] is parsed as an index expression
+		e = &ast.TypeArgExpr{X: index.X, Lbrack: index.Lbrack, Types: []ast.Expr{index.Index}, Rbrack: index.Rbrack}
+	}
+	inst, ok := e.(*ast.TypeArgExpr)
+	if !ok {
+		check.errorf(pos, "%s is not an instantiation of a generic type or function", arg)
+		return
+	}
+	if pkg := pragmaPackage(scope, inst); pkg != nil {
+		check.errorf(pos, "cannot instantiate %s: it is declared in package %s", arg, pkg.name)
+		return
+	}
+
+	defer func(scope *Scope) {
+		check.scope = scope
+	}(check.scope)
+	check.scope = scope
+	var x operand
+	check.exprOrType(&x, inst)
+}
+
+// pragmaPackage returns the imported package which declares the generic type
+// or function of inst, or nil if it is declared in the checked package.
+func pragmaPackage(scope *Scope, inst *ast.TypeArgExpr) *Package {
+	var e ast.Expr = inst
+	for {
+		switch x := e.(type) {
+		case *ast.TypeArgExpr:
+			e = x.X
+			continue
+		case *ast.SelectorExpr:
+			e = x.X
+			continue
+		case *ast.ParenExpr:
+			e = x.X
+			continue
+		case *ast.StarExpr:
+			e = x.X
+			continue
+		case *ast.Ident:
+			if _, obj := scope.LookupParent(x.Name, token.NoPos); obj != nil {
+				if pkgName, ok := obj.(*PkgName); ok {
+					return pkgName.imported
+				}
+			}
+		}
+		return nil
+	}
+}
@@ -9,6 +9,9 @@ package types
 
 import (
 	"sort"
+
+	"github.com/qProust/fo/constant"
+	"github.com/qProust/fo/token"
 )
 
 func isNamed(typ Type) bool {
@@ -153,6 +156,12 @@ func identical(x, y Type, cmpTags bool, p *ifacePair) bool {
 		// Two array types are identical if they have identical element types
 		// and the same array length.
 		if y, ok := y.(*Array); ok {
+			if (x.lenParam == nil) != (y.lenParam == nil) {
+				return false
+			}
+			if x.lenParam != nil && !identical(x.lenParam, y.lenParam, cmpTags, p) {
+				return false
+			}
 			return x.len == y.len && identical(x.elem, y.elem, cmpTags, p)
 		}
 
@@ -402,6 +411,11 @@ func identical(x, y Type, cmpTags bool, p *ifacePair) bool {
 			return x.String() == y.String()
 		}
 
+	case *ConstArg:
+		if y, ok := y.(*ConstArg); ok {
+			return constant.Compare(x.val, token.EQL, y.val)
+		}
+
 	case nil:
 
 	default:
@@ -25,6 +25,7 @@ type declInfo struct {
 	fdecl      *ast.FuncDecl      // func declaration, or nil
 	typeParams *ast.TypeParamDecl // generic type parameters, or nil
 	alias      bool               // type alias declaration
+	enum       *TypeName          // enum type of an enum value, or nil
 
 	// The deps field tracks initialization expression dependencies.
 	// As a special (overloaded) case, it also tracks dependencies of
@@ -391,6 +392,14 @@ func (check *Checker) collectObjects() {
 						obj := NewTypeName(s.Name.Pos(), pkg, s.Name.Name, nil)
 						check.declarePkgObj(s.Name, obj, &declInfo{file: fileScope, typ: s.Type, typeParams: s.TypeParams, alias: s.Assign.IsValid()})
 
+						// declare the values of an enum type
+						if enum, _ := s.Type.(*ast.EnumType); enum != nil && s.TypeParams == nil && !s.Assign.IsValid() {
+							for i, name := range enum.Values {
+								value := NewConst(name.Pos(), pkg, name.Name, nil, constant.MakeInt64(int64(i)))
+								check.declarePkgObj(name, value, &declInfo{file: fileScope, enum: obj})
+							}
+						}
+
 					default:
 						check.invalidAST(s.Pos(), "unknown ast.Spec node %T", s)
 					}
@@ -63,7 +63,7 @@ func (s *Selection) Type() Type {
 	case MethodVal:
 		// The type of x.f is a method with its receiver type set
 		// to the type of x.
-		sig := *s.obj.(*Func).typ.(*Signature)
+		sig := *underlyingSignature(s.obj.(*Func).typ)
 		recv := *sig.recv
 		recv.typ = s.recv
 		sig.recv = &recv
@@ -74,7 +74,7 @@ func (s *Selection) Type() Type {
 		// and an additional first argument with the same type as x.
 		// TODO(gri) Similar code is already in call.go - factor!
 		// TODO(gri) Compute this eagerly to avoid allocations.
-		sig := *s.obj.(*Func).typ.(*Signature)
+		sig := *underlyingSignature(s.obj.(*Func).typ)
 		arg0 := *sig.recv
 		sig.recv = nil
 		arg0.typ = s.recv
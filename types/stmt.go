@@ -658,6 +658,10 @@ func (check *Checker) stmt(ctxt stmtContext, s ast.Stmt) {
 			check.closeScope()
 		}
 
+		if check.conf.WarnIncompleteSwitches || check.conf.StrictIncompleteSwitches {
+			check.recordTypeSwitch(s, xtyp, seen)
+		}
+
 		// If lhs exists, we must have at least one lhs variable that was used.
 		if lhs != nil {
 			var used bool
@@ -5,7 +5,11 @@
 
 package types
 
-import "sort"
+import (
+	"sort"
+
+	"github.com/qProust/fo/constant"
+)
 
 // A Type represents a type of Go.
 // All types implement the Type interface.
@@ -113,16 +117,37 @@ func (b *Basic) Name() string { return b.name }
 
 // An Array represents an array type.
 type Array struct {
-	len  int64
-	elem Type
+	len      int64
+	elem     Type
+	lenParam *TypeParam // type parameter denoting the length; nil if len is known
 }
 
 // NewArray returns a new array type for the given element type and length.
-func NewArray(elem Type, len int64) *Array { return &Array{len, elem} }
+func NewArray(elem Type, len int64) *Array { return &Array{len: len, elem: elem} }
 
-// Len returns the length of array a.
+// Len returns the length of array a. It is 0 if the length is denoted by a
+// type parameter.
 func (a *Array) Len() int64 { return a.len }
 
+// LenParam returns the type parameter which denotes the length of array a
+// (e.g. N in [N]T), or nil if the length is a constant.
+func (a *Array) LenParam() *TypeParam { return a.lenParam }
+
+// setLen sets the length of array a to the constant type argument arg.
+func (a *Array) setLen(arg *ConstArg) {
+	a.len, _ = constant.Int64Val(arg.val)
+	a.lenParam = nil
+}
+
+// knownLen returns the length of array a, or -1 if it is denoted by a type
+// parameter and therefore not known.
+func (a *Array) knownLen() int64 {
+	if a.lenParam != nil {
+		return -1
+	}
+	return a.len
+}
+
 // Elem returns element type of array a.
 func (a *Array) Elem() Type { return a.elem }
 
@@ -139,22 +164,79 @@ func (s *Slice) Elem() Type { return s.elem }
 
 // TypeParam is an identifier for a type used in generic data structures and
 // functions.
-type TypeParam string
+type TypeParam struct {
+	name       string
+	constraint Type       // constraint on the type arguments; nil if there is none
+	origin     *TypeParam // corresponding type parameter of the receiver type (methods only)
+	isConst    bool       // whether tp is used as an array length
+}
 
 // NewTypeParam returns a new type parameter with the given name.
 func NewTypeParam(name string) *TypeParam {
-	tp := TypeParam(name)
-	return &tp
+	return &TypeParam{name: name}
+}
+
+// Constraint returns the constraint on the type arguments for tp, or nil if
+// any type argument is allowed. The constraint is either the predeclared
+// comparable, which is also implied for type parameters that are used as the
+// key type of a map, or an interface type which the type arguments must
+// implement.
+func (tp *TypeParam) Constraint() Type {
+	return tp.constraint
+}
+
+// SetConstraint sets the constraint of tp, which must be nil, the predeclared
+// comparable or an interface type. It is used by importers.
+func (tp *TypeParam) SetConstraint(constraint Type) {
+	tp.constraint = constraint
+}
+
+// IsConst reports whether tp is used as the length of an array type (e.g. N
+// in [N]T). The type arguments for such a type parameter are non-negative
+// integer constants instead of types.
+func (tp *TypeParam) IsConst() bool {
+	return tp.isConst
+}
+
+// A ConstArg is a constant which is used as the type argument for a type
+// parameter denoting an array length, e.g. the 3 in Vec[int, 3]. It only
+// occurs in type maps.
+type ConstArg struct {
+	val constant.Value
+}
+
+// NewConstArg returns a new constant type argument with the given value.
+func NewConstArg(val constant.Value) *ConstArg {
+	return &ConstArg{val: val}
+}
+
+// Value returns the value of the constant type argument c.
+func (c *ConstArg) Value() constant.Value {
+	return c.val
 }
 
-// Underlying for type parameters always returns the empty interface. The
-// compiler can make no assumptions about the underlying type.
+// Underlying for constant type arguments returns the argument itself.
+func (c *ConstArg) Underlying() Type {
+	return c
+}
+
+func (c *ConstArg) String() string {
+	return c.val.ExactString()
+}
+
+// Underlying for type parameters returns the interface of their constraint,
+// or the empty interface if there is none (or if the constraint is
+// comparable). The compiler can make no other assumptions about the
+// underlying type, but the methods of the constraint may be called.
 func (tp *TypeParam) Underlying() Type {
+	if iface := interfaceConstraint(tp); iface != nil {
+		return iface
+	}
 	return NewInterface(nil, nil)
 }
 
-func (tp TypeParam) String() string {
-	return string(tp)
+func (tp *TypeParam) String() string {
+	return tp.name
 }
 
 // A Struct represents a struct type.
@@ -301,6 +383,9 @@ type GenericSignature struct {
 	// dependents are generic usages inside the function body which inherit
 	// type parameters from the function declaration.
 	dependents []PartialGenericType
+	// assertions are the calls of assertImplements inside the function body
+	// which are verified for each usage of the function.
+	assertions []implAssertion
 }
 
 func NewGenericSignature(recv *Var, params, results *Tuple, variadic bool, typeParams, recvTypeParams []*TypeParam) *GenericSignature {
@@ -338,6 +423,12 @@ func (gs *GenericSignature) TypeParams() []*TypeParam {
 	return gs.typeParams
 }
 
+// RecvTypeParams returns the type parameters of the receiver type of a method,
+// as named in the receiver of the method declaration.
+func (gs *GenericSignature) RecvTypeParams() []*TypeParam {
+	return gs.recvTypeParams
+}
+
 func (gs *GenericSignature) Object() Object {
 	return gs.obj
 }
@@ -669,10 +760,14 @@ func NewGenericNamed(obj *TypeName, underlying Type, methods []*Func, typeParams
 		}
 	}
 
-	return &GenericNamed{
+	genNamed := &GenericNamed{
 		Named:      named,
 		typeParams: typeParams,
 	}
+	if obj.typ == named {
+		obj.typ = genNamed
+	}
+	return genNamed
 }
 
 func (gn *GenericNamed) TypeParams() []*TypeParam {
@@ -40,6 +40,58 @@ func RelativeTo(pkg *Package) Qualifier {
 	}
 }
 
+// FoNames returns a Qualifier which qualifies package-level objects like qf,
+// and which in addition selects the Fo rendering of instantiations of generic
+// types and functions: type arguments are printed (and qualified) as they are
+// written in Fo source, e.g. "Box[int, string]", and partially instantiated
+// types print the type parameters which are not yet bound, e.g. "Box[U]".
+// Other qualifiers print the internal representation, which marks partial
+// instantiations and prints missing type arguments as "?".
+func FoNames(qf Qualifier) Qualifier {
+	return func(pkg *Package) string {
+		if pkg == foNamesProbe {
+			return foNamesMarker
+		}
+		if qf == nil {
+			return pkg.Path()
+		}
+		return qf(pkg)
+	}
+}
+
+// foNamesProbe is never imported, so only a Qualifier returned by FoNames
+// qualifies it with foNamesMarker. (Other qualifiers qualify it with its
+// empty path or name.)
+var foNamesProbe = &Package{}
+
+const foNamesMarker = "fo"
+
+// foNames reports whether qf selects the Fo rendering.
+func foNames(qf Qualifier) bool {
+	return qf != nil && qf(foNamesProbe) == foNamesMarker
+}
+
+// keyQualifier qualifies package-level objects by their import path, like a
+// nil Qualifier, and in addition leaves out the names of the parameters and
+// results of function types, which do not matter for their identity. The
+// strings it prints serve as keys of the usages of generic declarations (see
+// usageKey), so that e.g. Box[func(x int) int] and Box[func(int) int] are the
+// same usage.
+func keyQualifier(pkg *Package) string {
+	if pkg == foNamesProbe {
+		return keyMarker
+	}
+	return pkg.Path()
+}
+
+const keyMarker = "key"
+
+// omitParamNames reports whether qf leaves out the names of parameters and
+// results (see keyQualifier).
+func omitParamNames(qf Qualifier) bool {
+	return qf != nil && qf(foNamesProbe) == keyMarker
+}
+
 // If gcCompatibilityMode is set, printing of types is modified
 // to match the representation of some types in the gc compiler:
 //
@@ -110,7 +162,11 @@ func writeType(buf *bytes.Buffer, typ Type, qf Qualifier, visited []Type) {
 		buf.WriteString(t.name)
 
 	case *Array:
-		fmt.Fprintf(buf, "[%d]", t.len)
+		if t.lenParam != nil {
+			fmt.Fprintf(buf, "[%s]", t.lenParam)
+		} else {
+			fmt.Fprintf(buf, "[%d]", t.len)
+		}
 		writeType(buf, t.elem, qf, visited)
 
 	case *Slice:
@@ -153,9 +209,15 @@ func writeType(buf *bytes.Buffer, typ Type, qf Qualifier, visited []Type) {
 		writeSignature(buf, t.Signature, qf, visited)
 
 	case *PartialGenericSignature:
+		if foNames(qf) {
+			buf.WriteString("func")
+			writeTypeArgs(buf, t.typeMap, t.GenericType().TypeParams(), qf, visited)
+			writeSignature(buf, t.Signature, qf, visited)
+			break
+		}
 		buf.WriteString("(partial)")
 		writeType(buf, t.Signature, qf, visited)
-		writeTypeArgs(buf, t.typeMap, t.GenericType().TypeParams())
+		writeTypeArgs(buf, t.typeMap, t.GenericType().TypeParams(), qf, visited)
 
 	case *ConcreteSignature:
 		buf.WriteString("func")
@@ -183,7 +245,7 @@ func writeType(buf *bytes.Buffer, typ Type, qf Qualifier, visited []Type) {
 					buf.WriteString("; ")
 				}
 				buf.WriteString(m.name)
-				writeSignature(buf, m.typ.(*Signature), qf, visited)
+				writeMethodSignature(buf, m, qf, visited)
 				empty = false
 			}
 		} else {
@@ -193,7 +255,7 @@ func writeType(buf *bytes.Buffer, typ Type, qf Qualifier, visited []Type) {
 					buf.WriteString("; ")
 				}
 				buf.WriteString(m.name)
-				writeSignature(buf, m.typ.(*Signature), qf, visited)
+				writeMethodSignature(buf, m, qf, visited)
 				empty = false
 			}
 			for i, typ := range t.embeddeds {
@@ -261,17 +323,27 @@ func writeType(buf *bytes.Buffer, typ Type, qf Qualifier, visited []Type) {
 		writeType(buf, t.Named, qf, visited)
 
 	case *PartialGenericNamed:
-		buf.WriteString("(partial)")
+		if !foNames(qf) {
+			buf.WriteString("(partial)")
+		}
 		writeType(buf, t.Named, qf, visited)
-		writeTypeArgs(buf, t.typeMap, t.GenericType().TypeParams())
+		writeTypeArgs(buf, t.typeMap, t.GenericType().TypeParams(), qf, visited)
 
 	case *ConcreteNamed:
-		writeType(buf, t.Named, qf, visited)
-		writeTypeArgs(buf, t.typeMap, t.GenericType().TypeParams())
+		if t.Named == nil {
+			// t is still being created (e.g. as part of a recursive type).
+			writeType(buf, t.genType.Named, qf, visited)
+		} else {
+			writeType(buf, t.Named, qf, visited)
+		}
+		writeTypeArgs(buf, t.typeMap, t.GenericType().TypeParams(), qf, visited)
 
 	case *TypeParam:
 		buf.WriteString(t.String())
 
+	case *ConstArg:
+		buf.WriteString(t.String())
+
 	default:
 		// For externally defined implementations of Type.
 		buf.WriteString(t.String())
@@ -285,7 +357,7 @@ func writeTuple(buf *bytes.Buffer, tup *Tuple, variadic bool, qf Qualifier, visi
 			if i > 0 {
 				buf.WriteString(", ")
 			}
-			if v.name != "" {
+			if v.name != "" && !omitParamNames(qf) {
 				buf.WriteString(v.name)
 				buf.WriteByte(' ')
 			}
@@ -329,7 +401,7 @@ func writeSignature(buf *bytes.Buffer, sig *Signature, qf Qualifier, visited []T
 	}
 
 	buf.WriteByte(' ')
-	if n == 1 && sig.results.vars[0].name == "" {
+	if n == 1 && (sig.results.vars[0].name == "" || omitParamNames(qf)) {
 		// single unnamed result
 		writeType(buf, sig.results.vars[0].typ, qf, visited)
 		return
@@ -339,18 +411,47 @@ func writeSignature(buf *bytes.Buffer, sig *Signature, qf Qualifier, visited []T
 	writeTuple(buf, sig.results, false, qf, visited)
 }
 
-func writeTypeArgs(buf *bytes.Buffer, typeMap map[string]Type, typeParams []*TypeParam) {
-	params := []string{}
-	for _, param := range typeParams {
-		if concrete, found := typeMap[param.String()]; found {
-			params = append(params, concrete.String())
+// writeMethodSignature writes the signature of the interface method m,
+// including its type parameters (if any).
+func writeMethodSignature(buf *bytes.Buffer, m *Func, qf Qualifier, visited []Type) {
+	if sig, ok := m.typ.(*GenericSignature); ok {
+		writeTypeParams(buf, sig.TypeParams())
+		writeSignature(buf, sig.Signature, qf, visited)
+		return
+	}
+	writeSignature(buf, m.typ.(*Signature), qf, visited)
+}
+
+// writeTypeArgs writes the type arguments of typeMap for typeParams. In the
+// Fo rendering (see FoNames), the arguments are qualified by qf and missing
+// ones are written as their type parameter.
+func writeTypeArgs(buf *bytes.Buffer, typeMap map[string]Type, typeParams []*TypeParam, qf Qualifier, visited []Type) {
+	if !foNames(qf) {
+		params := []string{}
+		for _, param := range typeParams {
+			if concrete, found := typeMap[param.String()]; found {
+				params = append(params, concrete.String())
+			} else {
+				params = append(params, "?")
+			}
+		}
+		buf.WriteString("[")
+		// TODO(albrow): Can we avoid using the strings package here?
+		buf.WriteString(strings.Join(params, ","))
+		buf.WriteByte(']')
+		return
+	}
+	buf.WriteByte('[')
+	for i, param := range typeParams {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		if concrete, found := typeMap[param.String()]; found && concrete != nil {
+			writeType(buf, concrete, qf, visited)
 		} else {
-			params = append(params, "?")
+			buf.WriteString(param.String())
 		}
 	}
-	buf.WriteString("[")
-	// TODO(albrow): Can we avoid using the strings package here?
-	buf.WriteString(strings.Join(params, ","))
 	buf.WriteByte(']')
 }
 
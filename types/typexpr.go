@@ -70,6 +70,16 @@ func (check *Checker) ident(x *operand, e *ast.Ident, def *Named, path []*TypeNa
 		x.mode = constant_
 
 	case *TypeName:
+		if _, ok := typ.(*TypeParam); ok && check.conf.WarnUnusedTypeParams {
+			if check.usedTypeParams == nil {
+				check.usedTypeParams = make(map[*TypeName]bool)
+			}
+			check.usedTypeParams[obj] = true
+		}
+		if typ == universeComparable {
+			check.errorf(e.Pos(), "cannot use comparable outside of a type parameter list")
+			return
+		}
 		x.mode = typexpr
 		// check for cycle
 		// (it's ok to iterate forward because each named type appears at most once in path)
@@ -182,12 +192,8 @@ func (check *Checker) genericFuncType(sig *GenericSignature, recvPar *ast.FieldL
 		tpScope = NewScope(check.scope, check.scope.Pos(), check.scope.End(), "function type parameters")
 	}
 	if tpList != nil {
-		for _, ident := range tpList.Names {
-			tp := NewTypeParam(ident.Name)
-			typeParams = append(typeParams, tp)
-			obj := NewTypeName(ident.Pos(), check.pkg, ident.Name, tp)
-			scopePos := ident.Pos()
-			check.declare(tpScope, ident, obj, scopePos)
+		for i := range tpList.Names {
+			typeParams = append(typeParams, check.declareTypeParam(tpScope, tpList, i))
 		}
 	}
 
@@ -225,6 +231,24 @@ func (check *Checker) genericFuncType(sig *GenericSignature, recvPar *ast.FieldL
 	sig.recvTypeParams = recvTypeParams
 }
 
+// genericMethodSpec type-checks the signature of an interface method which
+// declares its own type parameters. The type parameters are recorded in sig
+// and the (not yet complete) signature is returned.
+func (check *Checker) genericMethodSpec(sig *GenericSignature, ftyp *ast.FuncType) Type {
+	tpScope := NewScope(check.scope, ftyp.Pos(), ftyp.End(), "method type parameters")
+	sig.typeParams = nil
+	for i := range ftyp.TypeParams.Names {
+		sig.typeParams = append(sig.typeParams, check.declareTypeParam(tpScope, ftyp.TypeParams, i))
+	}
+
+	origScope := check.scope
+	check.scope = tpScope
+	defer func() {
+		check.scope = origScope
+	}()
+	return check.typ(ftyp)
+}
+
 func (check *Checker) recvType(recv *Var, typ Type) {
 	var err string
 	if T, ok := typ.(BaseNamed); ok {
@@ -303,7 +327,11 @@ func (check *Checker) typExprInternal(e ast.Expr, def *Named, path []*TypeName)
 		if e.Len != nil {
 			typ := new(Array)
 			def.setUnderlying(typ)
-			typ.len = check.arrayLength(e.Len)
+			if tp := check.lenTypeParam(e.Len); tp != nil {
+				typ.lenParam = tp
+			} else {
+				typ.len = check.arrayLength(e.Len)
+			}
 			typ.elem = check.typExpr(e.Elt, nil, path)
 			check.typeArgsRequired(e.Elt.Pos(), typ.elem)
 			return typ
@@ -315,6 +343,9 @@ func (check *Checker) typExprInternal(e ast.Expr, def *Named, path []*TypeName)
 			return typ
 		}
 
+	case *ast.EnumType:
+		check.errorf(e.Pos(), "enum types are only allowed in package-level type declarations")
+
 	case *ast.TypeArgExpr:
 		typ := check.typExpr(e.X, nil, path)
 		genType, ok := typ.(GenericType)
@@ -360,6 +391,12 @@ func (check *Checker) typExprInternal(e ast.Expr, def *Named, path []*TypeName)
 		typ.elem = check.typ(e.Value)
 		check.typeArgsRequired(e.Value.Pos(), typ.elem)
 
+		// A type parameter used as a map key must be comparable, even if it
+		// was not declared that way.
+		if tp, ok := typ.key.(*TypeParam); ok {
+			check.requireComparable(tp)
+		}
+
 		// spec: "The comparison operators == and != must be fully defined
 		// for operands of the key type; thus the key type must not be a
 		// function, map, or slice."
@@ -430,6 +467,28 @@ func (check *Checker) typOrNil(e ast.Expr) Type {
 	return Typ[Invalid]
 }
 
+// lenTypeParam returns the type parameter denoted by the array length e, or
+// nil if e does not denote a type parameter. The type parameter becomes a
+// constant type parameter.
+func (check *Checker) lenTypeParam(e ast.Expr) *TypeParam {
+	ident, ok := e.(*ast.Ident)
+	if !ok {
+		return nil
+	}
+	_, obj := check.scope.LookupParent(ident.Name, check.pos)
+	tname, ok := obj.(*TypeName)
+	if !ok {
+		return nil
+	}
+	tp, ok := tname.typ.(*TypeParam)
+	if !ok {
+		return nil
+	}
+	check.recordUse(ident, obj)
+	check.requireConst(tp)
+	return tp
+}
+
 func (check *Checker) arrayLength(e ast.Expr) int64 {
 	var x operand
 	check.expr(&x, e)
@@ -469,8 +528,18 @@ func (check *Checker) recvTypeParams(recvPar *ast.FieldList) ([]*TypeParam, *Sco
 		typ = x.X
 	}
 	if x, ok := typ.(*ast.TypeArgExpr); ok {
+		// The type parameters of the receiver stand for the type parameters of
+		// the receiver base type (if it can be determined).
+		var baseParams []*TypeParam
+		if base, ok := x.X.(*ast.Ident); ok {
+			if _, obj := check.scope.LookupParent(base.Name, check.pos); obj != nil {
+				if genType, ok := obj.Type().(*GenericNamed); ok {
+					baseParams = genType.typeParams
+				}
+			}
+		}
 		tpScope = NewScope(check.scope, check.scope.Pos(), check.scope.End(), "function type parameters")
-		for _, expr := range x.Types {
+		for i, expr := range x.Types {
 			ident, ok := expr.(*ast.Ident)
 			if !ok {
 				check.error(expr.Pos(), "type parameters in method receiver must be identifiers")
@@ -482,6 +551,10 @@ func (check *Checker) recvTypeParams(recvPar *ast.FieldList) ([]*TypeParam, *Sco
 				}
 			}
 			tp := NewTypeParam(ident.Name)
+			if i < len(baseParams) {
+				tp.origin = baseParams[i]
+				tp.constraint = baseParams[i].constraint
+			}
 			typeParams = append(typeParams, tp)
 			obj := NewTypeName(ident.Pos(), check.pkg, ident.Name, tp)
 			scopePos := ident.Pos()
@@ -667,6 +740,15 @@ func (check *Checker) interfaceType(iface *Interface, ityp *ast.InterfaceType, d
 			sig := new(Signature)
 			sig.recv = NewVar(pos, check.pkg, "", recvTyp)
 			m := NewFunc(pos, check.pkg, name.Name, sig)
+			if ftyp, _ := f.Type.(*ast.FuncType); ftyp != nil && ftyp.TypeParams != nil {
+				// A method with its own type parameters. Usages are recorded
+				// under the name of the interface, so it must have one.
+				if def == nil {
+					check.errorf(ftyp.TypeParams.Lbrack, "generic methods are only allowed in named interface types")
+					continue
+				}
+				m.typ = &GenericSignature{Signature: sig, obj: m}
+			}
 			if check.declareInSet(&mset, pos, m) {
 				iface.methods = append(iface.methods, m)
 				iface.allMethods = append(iface.allMethods, m)
@@ -724,7 +806,13 @@ func (check *Checker) interfaceType(iface *Interface, ityp *ast.InterfaceType, d
 
 	for i, m := range iface.methods {
 		expr := signatures[i]
-		typ := check.typ(expr)
+		var typ Type
+		genSig, _ := m.typ.(*GenericSignature)
+		if genSig != nil {
+			typ = check.genericMethodSpec(genSig, expr.(*ast.FuncType))
+		} else {
+			typ = check.typ(expr)
+		}
 		check.typeArgsRequired(expr.Pos(), typ)
 		sig, _ := typ.(*Signature)
 		if sig == nil {
@@ -734,9 +822,17 @@ func (check *Checker) interfaceType(iface *Interface, ityp *ast.InterfaceType, d
 			continue // keep method with empty method signature
 		}
 		// update signature, but keep recv that was set up before
-		old := m.typ.(*Signature)
+		var old *Signature
+		if genSig != nil {
+			old = genSig.Signature
+		} else {
+			old = m.typ.(*Signature)
+		}
 		sig.recv = old.recv
 		*old = *sig // update signature (don't replace it!)
+		if genSig != nil {
+			addGenericDecl(m, genSig)
+		}
 	}
 
 	// TODO(gri) The list of explicit methods is only sorted for now to
@@ -836,6 +932,10 @@ func (check *Checker) structType(styp *Struct, e *ast.StructType, path []*TypeNa
 			// spec: "An embedded type must be specified as a type name T or as a pointer
 			// to a non-interface type name *T, and T itself may not be a pointer type."
 			pos := f.Type.Pos()
+			if x, ok := f.Type.(*ast.TypeArgExpr); ok {
+				// the position of a type argument expression is that of its "["
+				pos = x.X.Pos()
+			}
 			name := anonymousFieldIdent(f.Type)
 			if name == nil {
 				check.invalidAST(pos, "anonymous field type %s has no name", f.Type)
@@ -886,6 +986,10 @@ func anonymousFieldIdent(e ast.Expr) *ast.Ident {
 		}
 	case *ast.SelectorExpr:
 		return e.Sel
+	case *ast.TypeArgExpr:
+		// an instantiation of a generic type, e.g. Box[int], is named after
+		// the generic type
+		return anonymousFieldIdent(e.X)
 	}
 	return nil // invalid anonymous field
 }
@@ -15,11 +15,12 @@ import (
 )
 
 var (
-	Universe     *Scope
-	Unsafe       *Package
-	universeIota *Const
-	universeByte *Basic // uint8 alias, but has name "byte"
-	universeRune *Basic // int32 alias, but has name "rune"
+	Universe           *Scope
+	Unsafe             *Package
+	universeIota       *Const
+	universeByte       *Basic // uint8 alias, but has name "byte"
+	universeRune       *Basic // int32 alias, but has name "rune"
+	universeComparable *Named // constraint for type parameters
 )
 
 // Typ contains the predeclared *Basic types indexed by their
@@ -79,6 +80,10 @@ func defPredeclaredTypes() {
 	typ := &Named{underlying: NewInterface([]*Func{err}, nil).Complete()}
 	sig.recv = NewVar(token.NoPos, nil, "", typ)
 	def(NewTypeName(token.NoPos, nil, "error", typ))
+
+	// comparable may only be used as the constraint of a type parameter
+	comparable := &Named{underlying: NewInterface(nil, nil).Complete()}
+	def(NewTypeName(token.NoPos, nil, "comparable", comparable))
 }
 
 var predeclaredConsts = [...]struct {
@@ -107,7 +112,9 @@ type builtinId int
 const (
 	// universe scope
 	_Append builtinId = iota
+	_AssertImplements
 	_Cap
+	_Clamp
 	_Close
 	_Complex
 	_Copy
@@ -115,6 +122,8 @@ const (
 	_Imag
 	_Len
 	_Make
+	_Max
+	_Min
 	_New
 	_Panic
 	_Print
@@ -138,21 +147,25 @@ var predeclaredFuncs = [...]struct {
 	variadic bool
 	kind     exprKind
 }{
-	_Append:  {"append", 1, true, expression},
-	_Cap:     {"cap", 1, false, expression},
-	_Close:   {"close", 1, false, statement},
-	_Complex: {"complex", 2, false, expression},
-	_Copy:    {"copy", 2, false, statement},
-	_Delete:  {"delete", 2, false, statement},
-	_Imag:    {"imag", 1, false, expression},
-	_Len:     {"len", 1, false, expression},
-	_Make:    {"make", 1, true, expression},
-	_New:     {"new", 1, false, expression},
-	_Panic:   {"panic", 1, false, statement},
-	_Print:   {"print", 0, true, statement},
-	_Println: {"println", 0, true, statement},
-	_Real:    {"real", 1, false, expression},
-	_Recover: {"recover", 0, false, statement},
+	_Append:           {"append", 1, true, expression},
+	_AssertImplements: {"assertImplements", 0, false, statement},
+	_Cap:              {"cap", 1, false, expression},
+	_Clamp:            {"clamp", 3, false, expression},
+	_Close:            {"close", 1, false, statement},
+	_Complex:          {"complex", 2, false, expression},
+	_Copy:             {"copy", 2, false, statement},
+	_Delete:           {"delete", 2, false, statement},
+	_Imag:             {"imag", 1, false, expression},
+	_Len:              {"len", 1, false, expression},
+	_Make:             {"make", 1, true, expression},
+	_Max:              {"max", 1, true, expression},
+	_Min:              {"min", 1, true, expression},
+	_New:              {"new", 1, false, expression},
+	_Panic:            {"panic", 1, false, statement},
+	_Print:            {"print", 0, true, statement},
+	_Println:          {"println", 0, true, statement},
+	_Real:             {"real", 1, false, expression},
+	_Recover:          {"recover", 0, false, statement},
 
 	_Alignof:  {"Alignof", 1, false, expression},
 	_Offsetof: {"Offsetof", 1, false, expression},
@@ -196,6 +209,7 @@ func init() {
 	universeIota = Universe.Lookup("iota").(*Const)
 	universeByte = Universe.Lookup("byte").(*TypeName).typ.(*Basic)
 	universeRune = Universe.Lookup("rune").(*TypeName).typ.(*Basic)
+	universeComparable = Universe.Lookup("comparable").(*TypeName).typ.(*Named)
 }
 
 // Objects with names containing blanks are internal and not entered into
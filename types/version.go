@@ -0,0 +1,52 @@
+package types
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A GoVersion is a version of the Go language, such as 1.21. The zero
+// GoVersion stands for the latest version.
+type GoVersion struct {
+	Major, Minor int
+}
+
+// ParseGoVersion parses a Go version of the form "1.21" or "go1.21". A patch
+// release such as "1.21.3" is accepted, but only the language version is
+// kept.
+func ParseGoVersion(s string) (GoVersion, error) {
+	parts := strings.Split(strings.TrimPrefix(s, "go"), ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return GoVersion{}, fmt.Errorf("invalid Go version %q (expected e.g. 1.21)", s)
+	}
+	var nums [3]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || part != strconv.Itoa(n) {
+			return GoVersion{}, fmt.Errorf("invalid Go version %q (expected e.g. 1.21)", s)
+		}
+		nums[i] = n
+	}
+	if nums[0] != 1 {
+		return GoVersion{}, fmt.Errorf("unsupported Go version %q (expected 1.x)", s)
+	}
+	return GoVersion{Major: nums[0], Minor: nums[1]}, nil
+}
+
+// AtLeast reports whether v is major.minor or later. The zero GoVersion is
+// later than any other.
+func (v GoVersion) AtLeast(major, minor int) bool {
+	if v == (GoVersion{}) {
+		return true
+	}
+	return v.Major > major || v.Major == major && v.Minor >= minor
+}
+
+// String returns v in the form "go1.21", or "latest" for the zero GoVersion.
+func (v GoVersion) String() string {
+	if v == (GoVersion{}) {
+		return "latest"
+	}
+	return fmt.Sprintf("go%d.%d", v.Major, v.Minor)
+}